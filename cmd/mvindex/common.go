@@ -91,6 +91,11 @@ func newRPCClient() (*rpc.Client, error) {
 		WithRetry(
 			config.GetInt("rpc.retries"),
 			config.GetDuration("rpc.retry_delay"),
+		).
+		WithBackoff(config.GetDuration("rpc.retry_max_delay")).
+		WithCircuitBreaker(
+			config.GetInt("rpc.breaker_threshold"),
+			config.GetDuration("rpc.breaker_timeout"),
 		)
 
 	return rpcclient, nil
@@ -127,5 +132,11 @@ func enabledIndexes() (list []model.BlockIndexer) {
 			index.NewTokenIndex(),
 		)
 	}
+	if roles := index.NewRoleIndex(); roles.IsEnabled() {
+		list = append(list, roles)
+	}
+	if upgrades := index.NewUpgradeIndex(); upgrades.IsEnabled() {
+		list = append(list, upgrades)
+	}
 	return
 }
@@ -35,6 +35,7 @@ var (
 	nomonitor    bool
 	norpc        bool
 	noapi        bool
+	replica      bool
 	cors         bool
 	validate     bool
 	stop         int64
@@ -65,6 +66,7 @@ func init() {
 
 	flags.BoolVar(&noapi, "noapi", false, "disable API server")
 	flags.BoolVar(&noindex, "noindex", false, "disable indexing")
+	flags.BoolVar(&replica, "replica", false, "serve read-only from a database written by another process")
 	flags.BoolVar(&nomonitor, "nomonitor", false, "disable block monitor")
 	flags.BoolVar(&validate, "validate", false, "validate account balances")
 	flags.Int64Var(&stop, "stop", 0, "stop indexing after `height`")
@@ -86,9 +88,44 @@ func init() {
 	config.SetDefault("db.log_slow_queries", time.Second)
 	config.SetDefault("db.max_storage_entry_size", 131072) // contract storage max bytes per record
 
+	// bigmap index
+	config.SetDefault("bigmap.persist_anomalies", false) // keep rollback anomaly records on disk
+	config.SetDefault("bigmap.index_addresses", false)   // link addresses embedded in keys/values
+	config.SetDefault("bigmap.value_cache_size", 0)      // decoded API values to cache, 0 = off
+	config.SetDefault("bigmap.decode_workers", 0)        // parallel decoders for large API scans, 0 = serial
+	config.SetDefault("bigmap.audit_log", false)         // append table mutations to <db>/bigmap_audit.json
+	config.SetDefault("bigmap.history_max_updates", 0)   // updates replayed per historic key request, 0 = unlimited
+	config.SetDefault("bigmap.checkpoint_interval", 0)   // store history checkpoints every n updates per bigmap, 0 = off
+	config.SetDefault("bigmap.strict_allocs", false)     // fail (true) or warn (false) on conflicting or missing allocs
+	config.SetDefault("bigmap.script_cache_size", 1024)  // contracts with parsed bigmap types to cache, 0 = off
+
+	// contract index
+	config.SetDefault("contract.dedup_scripts", false) // store code once per code hash, keep per-contract storage
+
+	// token index
+	config.SetDefault("token.prune_zero_owners", false) // remove stale zero balance owner rows, count in expvar token_pruned_owners
+	config.SetDefault("token.prune_retention", 128)     // cycles to keep zero balance owner rows
+	config.SetDefault("token.audit_log", false)         // append table mutations to <db>/token_audit.json
+	config.SetDefault("token.pause_entrypoints", []string{"pause", "set_pause", "setPause"})
+	config.SetDefault("token.unpause_entrypoints", []string{"unpause"})
+	config.SetDefault("token.exclude_self_transfers", false) // skip self-transfers in transfer counts and volumes
+	config.SetDefault("token.alerts", nil)                   // [{name, contract, token_id, types, threshold, decimals, url}], empty = off
+	config.SetDefault("token.alert_url", "")                 // webhook for alert rules without url
+	config.SetDefault("token.alert_max_age", time.Hour)      // skip alerts for older blocks while catching up, 0 = off
+	config.SetDefault("token.alert_timeout", 10*time.Second) // webhook request timeout
+
+	// role index
+	config.SetDefault("role.patterns", nil) // [{contract|code_hash, paths: {storage path: role}}], empty = off
+
+	// upgrade index
+	config.SetDefault("upgrade.patterns", nil) // [{contract|code_hash, path, key}], key = bigmap key when path is a bigmap, empty = off
+
 	// crawling
-	config.SetDefault("crawler.queue", 100)
-	config.SetDefault("crawler.delay", 1)
+	config.SetDefault("crawler.queue", 100)                       // max fetched blocks waiting for the indexer, fetching stalls when full
+	config.SetDefault("crawler.delay", 1)                         // blocks held back from chain head for reorg safety (in addition to queue)
+	config.SetDefault("crawler.supply_check", "off")              // off, lenient (log only), strict (fail on violation)
+	config.SetDefault("crawler.skip_ops", nil)                    // operation types not to index, e.g. [endorsement, preendorsement]
+	config.SetDefault("crawler.shutdown_timeout", 60*time.Second) // flush indexes on shutdown, 0 = off
 	config.SetDefault("crawler.snapshot.path", "./db/snapshots/")
 	config.SetDefault("crawler.snapshot.blocks", nil)
 	config.SetDefault("crawler.snapshot.interval", 0)
@@ -114,6 +151,11 @@ func init() {
 	config.SetDefault("server.max_series_duration", 0)
 	config.SetDefault("server.max_explore_count", 1000)
 	config.SetDefault("server.default_explore_count", 20)
+	config.SetDefault("server.max_response_size", 0) // streamed response bytes, 0 = unlimited
+	config.SetDefault("server.max_heavy_queries", 8) // concurrent expensive queries, 0 = unlimited
+	config.SetDefault("server.admin_key", "")        // bearer token allowing admin overrides
+	config.SetDefault("server.replica", false)       // read replica, implies -noindex
+	config.SetDefault("server.replica_poll", 5*time.Second)
 	config.SetDefault("server.cors_enable", false)
 	config.SetDefault("server.cors_origin", "*")
 	config.SetDefault("server.cors_allow_headers", strings.Join([]string{
@@ -125,6 +167,7 @@ func init() {
 	}, ","))
 	config.SetDefault("server.cors_expose_headers", strings.Join([]string{
 		"Date",
+		"ETag",
 		"X-Runtime",
 		"X-Request-Id",
 		"X-Api-Version",
@@ -155,6 +198,9 @@ func init() {
 	config.SetDefault("rpc.idle_conns", 16)
 	config.SetDefault("rpc.retries", 3)
 	config.SetDefault("rpc.retry_delay", time.Second)
+	config.SetDefault("rpc.retry_max_delay", 30*time.Second) // exponential backoff limit, 0 = constant delay
+	config.SetDefault("rpc.breaker_threshold", 10)           // consecutive failures before failing fast, 0 = off
+	config.SetDefault("rpc.breaker_timeout", 30*time.Second) // time before probing the node again
 	config.SetDefault("rpc.api_key", os.Getenv("MVPRO_API_KEY"))
 
 	// Metadata settings
@@ -167,6 +213,12 @@ func init() {
 	config.SetDefault("meta.http.max_retries", 10)
 	config.SetDefault("meta.http.retry_delay", time.Minute)
 	config.SetDefault("meta.http.retry_interval", time.Second)
+	config.SetDefault("meta.http.max_response_size", 1<<22) // 4 MB, 0 = unlimited
+	config.SetDefault("meta.token.resolve_offchain", false) // fetch token metadata from on-chain token_info URIs instead of meta.token.url
+	config.SetDefault("meta.ipfs.gateways", []string{"https://ipfs.io/ipfs", "https://dweb.link/ipfs", "https://cloudflare-ipfs.com/ipfs"})
+	config.SetDefault("meta.ipfs.timeout", 30*time.Second)
+	config.SetDefault("meta.ipfs.max_retries", 2) // per gateway
+	config.SetDefault("meta.ipfs.retry_delay", 5*time.Second)
 
 	// logging
 	config.SetDefault("log.progress", 10*time.Second)
@@ -15,10 +15,13 @@ import (
 	"blockwatch.cc/packdb/store"
 	"github.com/echa/config"
 	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/cache"
 	"github.com/mavryk-network/mvindex/etl/index"
 	"github.com/mavryk-network/mvindex/etl/metadata"
+	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/rpc"
 	"github.com/mavryk-network/mvindex/server"
+	"github.com/mavryk-network/mvindex/server/explorer"
 )
 
 func runServer() error {
@@ -31,15 +34,21 @@ func runServer() error {
 		return err
 	}
 
-	// init database
+	// init database, replicas never write and require an existing database
 	pathname := config.GetString("db.path")
-	dbOpts := DBOpts(false)
+	replica = replica || config.GetBool("server.replica")
+	if replica {
+		noindex = true
+		log.Info("Running as read replica.")
+	}
+	dbOpts := DBOpts(replica)
 	log.Infof("Using %s database %s", engine, pathname)
 	index.MaxStorageEntrySize = config.GetInt("db.max_storage_entry_size")
 	pack.QueryLogMinDuration = config.GetDuration("db.log_slow_queries")
 	if index.MaxStorageEntrySize > 0 {
 		dataLog.Warnf("Limiting max contract storage entry to %d bytes", index.MaxStorageEntrySize)
 	}
+	cache.BigmapHistoryMaxUpdates = config.GetInt("bigmap.history_max_updates")
 
 	// make sure paths exist
 	if err := os.MkdirAll(pathname, 0700); err != nil {
@@ -55,7 +64,7 @@ func runServer() error {
 	// open shared state database
 	statedb, err := store.Open(engine, filepath.Join(pathname, etl.StateDBName), dbOpts)
 	if err != nil {
-		if !store.IsError(err, store.ErrDbDoesNotExist) {
+		if replica || !store.IsError(err, store.ErrDbDoesNotExist) {
 			return fmt.Errorf("error opening %s database: %v", etl.StateDBName, err)
 		}
 		statedb, err = store.Create(engine, filepath.Join(pathname, etl.StateDBName), dbOpts)
@@ -76,6 +85,11 @@ func runServer() error {
 		noindex = true
 	}
 
+	skipOps, err := model.ParseOpTypeList(config.GetStringSlice("crawler.skip_ops"))
+	if err != nil {
+		return fmt.Errorf("crawler.skip_ops: %v", err)
+	}
+
 	// enable index storage tables
 	indexer := etl.NewIndexer(etl.IndexerConfig{
 		DBPath:    pathname,
@@ -83,6 +97,11 @@ func runServer() error {
 		StateDB:   statedb,
 		Indexes:   enabledIndexes(),
 		LightMode: lightIndex,
+		ReadOnly:  replica,
+		SkipOps:   skipOps,
+
+		BigmapValueCacheSize: config.GetInt("bigmap.value_cache_size"),
+		BigmapDecodeWorkers:  config.GetInt("bigmap.decode_workers"),
 	})
 	defer indexer.Close()
 
@@ -90,14 +109,16 @@ func runServer() error {
 	defer cancel()
 
 	crawler := etl.NewCrawler(etl.CrawlerConfig{
-		DB:            statedb,
-		Indexer:       indexer,
-		Client:        rpcclient,
-		Queue:         config.GetInt("crawler.queue"),
-		Delay:         config.GetInt("crawler.delay"),
-		EnableMonitor: !nomonitor,
-		StopBlock:     stop,
-		Validate:      validate,
+		DB:              statedb,
+		Indexer:         indexer,
+		Client:          rpcclient,
+		Queue:           config.GetInt("crawler.queue"),
+		Delay:           config.GetInt("crawler.delay"),
+		EnableMonitor:   !nomonitor,
+		StopBlock:       stop,
+		Validate:        validate,
+		SupplyCheck:     etl.ParseSupplyCheckMode(config.GetString("crawler.supply_check")),
+		ShutdownTimeout: config.GetDuration("crawler.shutdown_timeout"),
 		Snapshot: &etl.SnapshotConfig{
 			Path:          config.GetString("crawler.snapshot.path"),
 			Blocks:        config.GetInt64Slice("crawler.snapshot.blocks"),
@@ -110,6 +131,16 @@ func runServer() error {
 		if err := crawler.Init(ctx, etl.MODE_INFO); err != nil {
 			return fmt.Errorf("crawler init: %v", err)
 		}
+		if replica {
+			go crawler.RunReplica(ctx, etl.ReplicaConfig{
+				Interval: config.GetDuration("server.replica_poll"),
+				OpenState: func() (store.DB, error) {
+					return store.Open(engine, filepath.Join(pathname, etl.StateDBName), dbOpts)
+				},
+				Indexes:  enabledIndexes,
+				OnReload: explorer.PurgeCaches,
+			})
+		}
 	} else {
 		if err := crawler.Init(ctx, etl.MODE_SYNC); err != nil {
 			return fmt.Errorf("crawler init: %v", err)
@@ -153,6 +184,9 @@ func runServer() error {
 				CacheExpires:        config.GetDuration("server.cache_expires"),
 				CacheMaxExpires:     config.GetDuration("server.cache_max"),
 				MaxSeriesDuration:   config.GetDuration("server.max_series_duration"),
+				MaxResponseSize:     config.GetInt64("server.max_response_size"),
+				MaxHeavyQueries:     config.GetInt("server.max_heavy_queries"),
+				AdminKey:            config.GetString("server.admin_key"),
 			},
 		})
 		if err != nil {
@@ -35,6 +35,7 @@ type Builder struct {
 
 	// build state
 	validate bool
+	supply   *SupplyChecker
 	rpc      *rpc.Client
 	block    *model.Block
 	parent   *model.Block
@@ -56,6 +57,7 @@ func NewBuilder(idx *Indexer, c *rpc.Client, validate bool) *Builder {
 		endorseRights:   make(map[model.AccountID]*vec.BitSet),
 		absentEndorsers: make(map[model.AccountID]struct{}),
 		validate:        validate,
+		supply:          NewSupplyChecker(SupplyCheckOff),
 		rpc:             c,
 	}
 }
@@ -311,6 +313,7 @@ func (b *Builder) Init(ctx context.Context, tip *model.ChainTip, c *rpc.Client)
 		return fmt.Errorf("bakers: %v", err)
 	} else {
 		for _, bkr := range bkrs {
+			bkr.WasActive = bkr.IsActive
 			b.bakerMap[bkr.AccountId] = bkr
 			b.bakerHashMap[b.accCache.AccountHashKey(bkr.Account)] = bkr
 		}
@@ -353,6 +356,9 @@ func (b *Builder) Build(ctx context.Context, tz *rpc.Bundle) (*model.Block, erro
 	if err := b.UpdateStats(ctx); err != nil {
 		return nil, fmt.Errorf("build stage 4: %w", err)
 	}
+	if err := b.supply.Check(ctx, b); err != nil {
+		return nil, fmt.Errorf("build stage 4: %w", err)
+	}
 
 	// 5  sanity checks
 	if b.validate {
@@ -394,6 +400,7 @@ func (b *Builder) Clean() {
 		// reset flags
 		bkr.IsNew = false
 		bkr.IsDirty = false
+		bkr.WasActive = bkr.IsActive
 		acc := bkr.Account
 		acc.IsDirty = false
 		acc.IsNew = false
@@ -497,6 +504,9 @@ func (b *Builder) BuildReorg(ctx context.Context, tz *rpc.Bundle, parent *model.
 }
 
 func (b *Builder) CleanReorg() {
+	// balance sum is invalid after rollback
+	b.supply.Reset()
+
 	// add unique addrs to cache
 	for _, acc := range b.accMap {
 		if acc == nil {
@@ -544,6 +554,7 @@ func (b *Builder) CleanReorg() {
 		// reset flags
 		bkr.IsNew = false
 		bkr.IsDirty = false
+		bkr.WasActive = bkr.IsActive
 		acc := bkr.Account
 		acc.IsDirty = false
 		acc.IsNew = false
@@ -739,17 +750,19 @@ func (b *Builder) InitAccounts(ctx context.Context) error {
 		b.block.ProposerConsensusKeyId = b.block.BakerId
 	}
 
-	if b.block.ProposerId != b.block.ProposerConsensusKeyId {
-		acc, ok := b.AccountById(b.block.ProposerConsensusKeyId)
+	// use active consensus keys when different from the baker key, the node
+	// omits them before consensus key support
+	if addr := b.block.MV.Block.Metadata.ProposerConsensusKey; addr.IsValid() {
+		acc, ok := b.AccountByAddress(addr)
 		if !ok {
-			return fmt.Errorf("missing proposer consensus key account %d", b.block.ProposerConsensusKeyId)
+			return fmt.Errorf("missing proposer consensus key account %s", addr)
 		}
 		b.block.ProposerConsensusKeyId = acc.RowId
 	}
-	if b.block.BakerId != b.block.BakerConsensusKeyId {
-		acc, ok := b.AccountById(b.block.BakerConsensusKeyId)
+	if addr := b.block.MV.Block.Metadata.BakerConsensusKey; addr.IsValid() {
+		acc, ok := b.AccountByAddress(addr)
 		if !ok {
-			return fmt.Errorf("missing baker consensus key account %d", b.block.BakerConsensusKeyId)
+			return fmt.Errorf("missing baker consensus key account %s", addr)
 		}
 		b.block.BakerConsensusKeyId = acc.RowId
 	}
@@ -807,7 +820,8 @@ func (b *Builder) Decorate(ctx context.Context, rollback bool) error {
 }
 
 func (b *Builder) LoadOfflineRightsHolders(ctx context.Context) error {
-	if b.IsLightMode() || b.block.Height == 0 {
+	// without endorsements all rights holders would appear absent
+	if b.IsLightMode() || b.block.Height == 0 || b.idx.SkipOps().Contains(model.OpTypeEndorsement) {
 		return nil
 	}
 
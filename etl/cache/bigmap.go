@@ -5,6 +5,7 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"sync/atomic"
 
 	"blockwatch.cc/packdb/pack"
@@ -18,8 +19,24 @@ import (
 var (
 	BigmapHistoryMaxCacheSize = 2048    // full bigmaps (all keys + values)
 	BigmapMaxCacheSize        = 1 << 20 // 1M entries
+	BigmapHistoryMaxUpdates   = 0       // max updates replayed per build, 0 = unlimited
+	BigmapReplayBatchSize     = 1 << 16 // updates read per query, the table is unlocked in between
 )
 
+// BudgetError is returned when building a bigmap history snapshot would
+// replay more updates than BigmapHistoryMaxUpdates allows.
+type BudgetError struct {
+	BigmapId  int64
+	Height    int64
+	Processed int
+	Limit     int
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("bigmap %d history at height %d exceeds update budget (%d processed, limit %d)",
+		e.BigmapId, e.Height, e.Processed, e.Limit)
+}
+
 type BigmapCache struct {
 	cache *lru.TwoQueueCache[int64, any] // key := bigmap_id
 	size  int64
@@ -72,6 +89,7 @@ func (c BigmapCache) Stats() Stats {
 type BigmapHistory struct {
 	BigmapId     int64
 	Height       int64
+	Updates      int // updates replayed when this snapshot was built
 	KeyOffsets   []uint32
 	ValueOffsets []uint32
 	Data         []byte
@@ -139,6 +157,26 @@ func (h BigmapHistory) Range(from, to int) []*model.BigmapValue {
 	return items
 }
 
+// Values returns all live values in storage order.
+func (h BigmapHistory) Values() []*model.BigmapValue {
+	items := make([]*model.BigmapValue, h.Len())
+	for i := range items {
+		kStart, vStart := int(h.KeyOffsets[i]), int(h.ValueOffsets[i])
+		kEnd, vEnd := vStart, len(h.Data)
+		if i < h.Len()-1 {
+			vEnd = int(h.KeyOffsets[i+1])
+		}
+		items[i] = &model.BigmapValue{
+			RowId:    uint64(i + 1),
+			BigmapId: h.BigmapId,
+			KeyId:    model.GetKeyId(h.BigmapId, micheline.KeyHash(h.Data[kStart:kEnd])),
+			Key:      h.Data[kStart:kEnd],
+			Value:    h.Data[vStart:vEnd],
+		}
+	}
+	return items
+}
+
 type BigmapHistoryCache struct {
 	cache *lru.TwoQueueCache[int64, any] // key := int64(bigmap_id<<32 & height)
 	size  int64
@@ -201,134 +239,122 @@ func (c *BigmapHistoryCache) GetBest(id, height int64) (*BigmapHistory, bool) {
 }
 
 func (c *BigmapHistoryCache) Build(ctx context.Context, updates *pack.Table, id, height int64) (*BigmapHistory, error) {
-	kvStore := make(map[uint64]*model.BigmapValue)
-	upd := &model.BigmapUpdate{}
-	var count, size int
-	err := pack.NewQuery("cache.build").
-		WithTable(updates).
-		WithFields("action", "key_id", "key", "value").
-		AndEqual("bigmap_id", id).
-		AndLte("height", height).
-		Stream(ctx, func(r pack.Row) error {
-			if err := r.Decode(upd); err != nil {
-				return err
-			}
-			count++
-			switch upd.Action {
-			case micheline.DiffActionAlloc, micheline.DiffActionCopy:
-				// ignore
-			case micheline.DiffActionUpdate:
-				size += len(upd.Key) + len(upd.Value)
-				kvStore[upd.KeyId] = upd.ToKV()
-			case micheline.DiffActionRemove:
-				if v, ok := kvStore[upd.KeyId]; ok {
-					size -= len(v.Key) + len(v.Value)
-				}
-				delete(kvStore, upd.KeyId)
-			}
-			return nil
-		})
+	hist, err := ReplayBigmapHistory(ctx, nil, updates, id, height, BigmapHistoryMaxUpdates)
 	if err != nil {
 		return nil, err
 	}
-
 	log.Debugf("Bigmap Cache Build: Processed %d updates, found %d live keys",
-		count, len(kvStore))
+		hist.Updates, hist.Len())
+	c.Add(hist)
+	return hist, nil
+}
 
-	// compile into compact cacheable form
-	hist := &BigmapHistory{
-		BigmapId:     id,
-		Height:       height,
-		KeyOffsets:   make([]uint32, len(kvStore)),
-		ValueOffsets: make([]uint32, len(kvStore)),
-		Data:         make([]byte, 0, size),
-	}
-	count = 0
-	for _, v := range kvStore {
-		hist.KeyOffsets[count] = uint32(len(hist.Data))
-		hist.Data = append(hist.Data, v.Key...)
-		hist.ValueOffsets[count] = uint32(len(hist.Data))
-		hist.Data = append(hist.Data, v.Value...)
-		count++
+func (c *BigmapHistoryCache) Update(ctx context.Context, hist *BigmapHistory, updates *pack.Table, height int64) (*BigmapHistory, error) {
+	hist2, err := ReplayBigmapHistory(ctx, hist, updates, hist.BigmapId, height, BigmapHistoryMaxUpdates)
+	if err != nil {
+		return nil, err
 	}
-	c.cache.Add(c.makeKey(id, height), hist)
+	log.Debugf("Bigmap Cache Update: Processed %d new updates, found %d live keys",
+		hist2.Updates, hist2.Len())
+	c.Add(hist2)
+	return hist2, nil
+}
+
+// Add inserts a bigmap state, e.g. one loaded from a checkpoint.
+func (c *BigmapHistoryCache) Add(hist *BigmapHistory) {
+	c.cache.Add(c.makeKey(hist.BigmapId, hist.Height), hist)
 	c.stats.CountInserts(1)
 	atomic.AddInt64(&c.size, hist.Size())
-	return hist, nil
 }
 
-func (c *BigmapHistoryCache) Update(ctx context.Context, hist *BigmapHistory, updates *pack.Table, height int64) (*BigmapHistory, error) {
+// ReplayBigmapHistory applies updates of bigmap id after base.Height up to
+// height to base and returns the new state. A nil base starts from an
+// empty bigmap. Replay fails with a BudgetError after limit updates when
+// limit is positive. Updates are read in batches of BigmapReplayBatchSize
+// so that long replays don't keep the updates table locked. The result is
+// not cached.
+func ReplayBigmapHistory(ctx context.Context, base *BigmapHistory, updates *pack.Table, id, height int64, limit int) (*BigmapHistory, error) {
 	// unpack all cached values into kvStore map (cached store is read-only)
-	kvStore := make(map[uint64]*model.BigmapValue, len(hist.KeyOffsets))
-	for i, v := range hist.KeyOffsets {
-		kStart, kEnd := v, hist.ValueOffsets[i]
-		vStart, vEnd := kEnd, len(hist.Data)
-		if i < hist.Len()-1 {
-			vEnd = int(hist.KeyOffsets[i+1])
-		}
-		kid := model.GetKeyId(hist.BigmapId, micheline.KeyHash(hist.Data[kStart:kEnd]))
-		kvStore[kid] = &model.BigmapValue{
-			RowId:    uint64(i + 1),
-			BigmapId: hist.BigmapId,
-			KeyId:    kid,
-			Key:      hist.Data[kStart:kEnd],
-			Value:    hist.Data[vStart:vEnd],
+	var (
+		kvStore = make(map[uint64]*model.BigmapValue)
+		from    = int64(-1)
+		size    int
+	)
+	if base != nil {
+		from = base.Height
+		size = len(base.Data)
+		for _, v := range base.Values() {
+			kvStore[v.KeyId] = v
 		}
 	}
 
-	// apply updates between hist.Height+1 and request height
-	upd := &model.BigmapUpdate{}
-	var count, size int
-	err := pack.NewQuery("cache.update").
-		WithTable(updates).
-		WithFields("action", "key_id", "key", "value").
-		AndEqual("bigmap_id", hist.BigmapId).
-		AndGt("height", hist.Height).
-		AndLte("height", height).
-		Stream(ctx, func(r pack.Row) error {
-			if err := r.Decode(upd); err != nil {
-				return err
-			}
-			count++
-			switch upd.Action {
-			case micheline.DiffActionAlloc, micheline.DiffActionCopy:
-				// ignore
-			case micheline.DiffActionUpdate:
-				size += len(upd.Key) + len(upd.Value)
-				kvStore[upd.KeyId] = upd.ToKV()
-			case micheline.DiffActionRemove:
-				if v, ok := kvStore[upd.KeyId]; ok {
-					size -= len(v.Key) + len(v.Value)
+	// apply updates between base height and request height
+	var (
+		upd   = &model.BigmapUpdate{}
+		count int
+		last  uint64
+	)
+	for {
+		var n int
+		err := pack.NewQuery("cache.replay").
+			WithTable(updates).
+			WithFields("row_id", "action", "key_id", "key", "value").
+			WithLimit(BigmapReplayBatchSize).
+			AndEqual("bigmap_id", id).
+			AndGt("height", from).
+			AndLte("height", height).
+			AndGt("row_id", last).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(upd); err != nil {
+					return err
 				}
-				delete(kvStore, upd.KeyId)
-			}
-			return nil
-		})
-	if err != nil {
-		return nil, err
+				n++
+				last = upd.RowId
+				count++
+				if limit > 0 && count > limit {
+					return &BudgetError{BigmapId: id, Height: height, Processed: count - 1, Limit: limit}
+				}
+				switch upd.Action {
+				case micheline.DiffActionAlloc, micheline.DiffActionCopy:
+					// ignore
+				case micheline.DiffActionUpdate:
+					if v, ok := kvStore[upd.KeyId]; ok {
+						size -= len(v.Key) + len(v.Value)
+					}
+					size += len(upd.Key) + len(upd.Value)
+					kvStore[upd.KeyId] = upd.ToKV()
+				case micheline.DiffActionRemove:
+					if v, ok := kvStore[upd.KeyId]; ok {
+						size -= len(v.Key) + len(v.Value)
+					}
+					delete(kvStore, upd.KeyId)
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+		if n < BigmapReplayBatchSize {
+			break
+		}
 	}
 
-	log.Debugf("Bigmap Cache Update: Processed %d new updates, found %d live keys",
-		count, len(kvStore))
-
 	// compile into compact cacheable form
-	hist2 := &BigmapHistory{
-		BigmapId:     hist.BigmapId,
+	hist := &BigmapHistory{
+		BigmapId:     id,
 		Height:       height,
+		Updates:      count,
 		KeyOffsets:   make([]uint32, len(kvStore)),
 		ValueOffsets: make([]uint32, len(kvStore)),
-		Data:         make([]byte, 0, len(hist.Data)+size),
+		Data:         make([]byte, 0, max(size, 0)),
 	}
 	count = 0
 	for _, v := range kvStore {
-		hist2.KeyOffsets[count] = uint32(len(hist2.Data))
-		hist2.Data = append(hist2.Data, v.Key...)
-		hist2.ValueOffsets[count] = uint32(len(hist2.Data))
-		hist2.Data = append(hist2.Data, v.Value...)
+		hist.KeyOffsets[count] = uint32(len(hist.Data))
+		hist.Data = append(hist.Data, v.Key...)
+		hist.ValueOffsets[count] = uint32(len(hist.Data))
+		hist.Data = append(hist.Data, v.Value...)
 		count++
 	}
-	c.cache.Add(c.makeKey(hist2.BigmapId, height), hist2)
-	c.stats.CountInserts(1)
-	atomic.AddInt64(&c.size, hist2.Size())
-	return hist2, nil
+	return hist, nil
 }
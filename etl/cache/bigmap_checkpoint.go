@@ -0,0 +1,173 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	"blockwatch.cc/packdb/pack"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// Checkpoint converts a bigmap state into a storable checkpoint. Offsets
+// are stored as little endian key/value offset pairs.
+func (h BigmapHistory) Checkpoint(nUpdates int64) *model.BigmapCheckpoint {
+	offsets := make([]byte, 0, 8*h.Len())
+	for i := range h.KeyOffsets {
+		offsets = binary.LittleEndian.AppendUint32(offsets, h.KeyOffsets[i])
+		offsets = binary.LittleEndian.AppendUint32(offsets, h.ValueOffsets[i])
+	}
+	return &model.BigmapCheckpoint{
+		BigmapId: h.BigmapId,
+		Height:   h.Height,
+		NUpdates: nUpdates,
+		NKeys:    int64(h.Len()),
+		Offsets:  offsets,
+		Data:     h.Data,
+	}
+}
+
+// NewBigmapHistoryFromCheckpoint restores a bigmap state from cp.
+func NewBigmapHistoryFromCheckpoint(cp *model.BigmapCheckpoint) (*BigmapHistory, error) {
+	if len(cp.Offsets) != 8*int(cp.NKeys) {
+		return nil, fmt.Errorf("bigmap %d checkpoint at height %d: %d offset bytes for %d keys",
+			cp.BigmapId, cp.Height, len(cp.Offsets), cp.NKeys)
+	}
+	hist := &BigmapHistory{
+		BigmapId:     cp.BigmapId,
+		Height:       cp.Height,
+		KeyOffsets:   make([]uint32, cp.NKeys),
+		ValueOffsets: make([]uint32, cp.NKeys),
+		Data:         cp.Data,
+	}
+	var last uint32
+	for i := range hist.KeyOffsets {
+		k := binary.LittleEndian.Uint32(cp.Offsets[8*i:])
+		v := binary.LittleEndian.Uint32(cp.Offsets[8*i+4:])
+		if k < last || v < k || int(v) > len(cp.Data) {
+			return nil, fmt.Errorf("bigmap %d checkpoint at height %d: invalid offsets for key %d",
+				cp.BigmapId, cp.Height, i)
+		}
+		hist.KeyOffsets[i], hist.ValueOffsets[i] = k, v
+		last = v
+	}
+	return hist, nil
+}
+
+// LoadBigmapCheckpoint returns the state of bigmap id from the latest
+// checkpoint at or below height or nil when there is none.
+func LoadBigmapCheckpoint(ctx context.Context, table *pack.Table, id, height int64) (*BigmapHistory, error) {
+	refs, err := listBigmapCheckpoints(ctx, table, id)
+	if err != nil {
+		return nil, err
+	}
+	ref, ok := bestBigmapCheckpoint(refs, height)
+	if !ok {
+		return nil, nil
+	}
+	return loadBigmapCheckpoint(ctx, table, ref)
+}
+
+type bigmapCheckpointRef struct {
+	RowId  uint64
+	Height int64
+}
+
+// BigmapCheckpointIndex caches row ids and heights of stored checkpoints
+// per bigmap so that lookups don't scan the checkpoint table each time.
+// Writers call Add after storing and Purge after deleting checkpoints.
+type BigmapCheckpointIndex struct {
+	cache *lru.Cache[int64, []bigmapCheckpointRef]
+}
+
+func NewBigmapCheckpointIndex(sz int) *BigmapCheckpointIndex {
+	c, _ := lru.New[int64, []bigmapCheckpointRef](sz)
+	return &BigmapCheckpointIndex{cache: c}
+}
+
+// Load returns the state of bigmap id from the latest checkpoint at or
+// below height or nil when there is none.
+func (x *BigmapCheckpointIndex) Load(ctx context.Context, table *pack.Table, id, height int64) (*BigmapHistory, error) {
+	refs, ok := x.cache.Get(id)
+	if !ok {
+		var err error
+		refs, err = listBigmapCheckpoints(ctx, table, id)
+		if err != nil {
+			return nil, err
+		}
+		x.cache.Add(id, refs)
+	}
+	ref, ok := bestBigmapCheckpoint(refs, height)
+	if !ok {
+		return nil, nil
+	}
+	hist, err := loadBigmapCheckpoint(ctx, table, ref)
+	if hist == nil && err == nil {
+		// deleted by a concurrent rollback
+		x.cache.Remove(id)
+	}
+	return hist, err
+}
+
+// Add registers a stored checkpoint.
+func (x *BigmapCheckpointIndex) Add(cp *model.BigmapCheckpoint) {
+	if refs, ok := x.cache.Get(cp.BigmapId); ok {
+		ref := bigmapCheckpointRef{RowId: cp.RowId, Height: cp.Height}
+		x.cache.Add(cp.BigmapId, append(slices.Clip(refs), ref))
+	}
+}
+
+func (x *BigmapCheckpointIndex) Purge() {
+	x.cache.Purge()
+}
+
+func listBigmapCheckpoints(ctx context.Context, table *pack.Table, id int64) ([]bigmapCheckpointRef, error) {
+	// read heights without decoding data
+	refs := make([]bigmapCheckpointRef, 0)
+	err := pack.NewQuery("cache.list_checkpoints").
+		WithTable(table).
+		WithFields("row_id", "height").
+		AndEqual("bigmap_id", id).
+		Stream(ctx, func(r pack.Row) error {
+			var v model.BigmapCheckpoint
+			if err := r.Decode(&v); err != nil {
+				return err
+			}
+			refs = append(refs, bigmapCheckpointRef{RowId: v.RowId, Height: v.Height})
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func bestBigmapCheckpoint(refs []bigmapCheckpointRef, height int64) (bigmapCheckpointRef, bool) {
+	var best bigmapCheckpointRef
+	for _, v := range refs {
+		if v.Height > height {
+			continue
+		}
+		if best.RowId == 0 || v.Height > best.Height || v.Height == best.Height && v.RowId > best.RowId {
+			best = v
+		}
+	}
+	return best, best.RowId > 0
+}
+
+func loadBigmapCheckpoint(ctx context.Context, table *pack.Table, ref bigmapCheckpointRef) (*BigmapHistory, error) {
+	cp := &model.BigmapCheckpoint{}
+	err := pack.NewQuery("cache.load_checkpoint").
+		WithTable(table).
+		AndEqual("row_id", ref.RowId).
+		Execute(ctx, cp)
+	if err != nil || cp.RowId == 0 {
+		return nil, err
+	}
+	return NewBigmapHistoryFromCheckpoint(cp)
+}
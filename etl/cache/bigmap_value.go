@@ -0,0 +1,103 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package cache
+
+import (
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// BigmapValueCache keeps decoded JSON of bigmap values for API lookups.
+// Entries are keyed by key_id and only returned when the hash of the raw
+// value still matches, so stale entries are never served even when an
+// update was missed. A zero size disables the cache.
+type BigmapValueCache struct {
+	cache *lru.Cache[uint64, bigmapValueElem] // key := key_id
+	size  int64
+	stats Stats
+}
+
+type bigmapValueElem struct {
+	hash uint64
+	data []byte
+}
+
+func NewBigmapValueCache(sz int) *BigmapValueCache {
+	c := &BigmapValueCache{}
+	if sz > 0 {
+		c.cache, _ = lru.NewWithEvict[uint64, bigmapValueElem](sz, c.onEvict)
+	}
+	return c
+}
+
+func (c *BigmapValueCache) onEvict(_ uint64, e bigmapValueElem) {
+	atomic.AddInt64(&c.size, -int64(len(e.data)))
+	atomic.AddInt64(&c.stats.Evictions, 1)
+}
+
+func (c *BigmapValueCache) IsEnabled() bool {
+	return c.cache != nil
+}
+
+// Hash identifies the raw value bytes and decoding options of a cache entry.
+func (c *BigmapValueCache) Hash(value []byte, unpack bool) uint64 {
+	h := xxhash.New()
+	h.Write(value)
+	if unpack {
+		h.Write([]byte{1})
+	}
+	return h.Sum64()
+}
+
+func (c *BigmapValueCache) Get(keyId, hash uint64) ([]byte, bool) {
+	if c.cache == nil {
+		return nil, false
+	}
+	e, ok := c.cache.Get(keyId)
+	if !ok || e.hash != hash {
+		atomic.AddInt64(&c.stats.Misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&c.stats.Hits, 1)
+	return e.data, true
+}
+
+func (c *BigmapValueCache) Add(keyId, hash uint64, data []byte) {
+	if c.cache == nil {
+		return
+	}
+	if e, ok := c.cache.Peek(keyId); ok {
+		atomic.AddInt64(&c.size, -int64(len(e.data)))
+		atomic.AddInt64(&c.stats.Updates, 1)
+	} else {
+		atomic.AddInt64(&c.stats.Inserts, 1)
+	}
+	c.cache.Add(keyId, bigmapValueElem{hash: hash, data: data})
+	atomic.AddInt64(&c.size, int64(len(data)))
+}
+
+func (c *BigmapValueCache) Drop(keyId uint64) {
+	if c.cache == nil {
+		return
+	}
+	c.cache.Remove(keyId)
+}
+
+func (c *BigmapValueCache) Purge() {
+	if c.cache == nil {
+		return
+	}
+	c.cache.Purge()
+}
+
+func (c *BigmapValueCache) Stats() Stats {
+	s := c.stats.Get()
+	if c.cache != nil {
+		s.Size = c.cache.Len()
+	}
+	s.Bytes = atomic.LoadInt64(&c.size)
+	return s
+}
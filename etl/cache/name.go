@@ -0,0 +1,352 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// NameCache resolves addresses to names registered in Tezos Domains
+// style name registries. Names are taken from reverse records and are
+// only valid when the forward record of the same name points back to
+// the address. Names expire with their forward record. Forward-only
+// registrations without reverse record do not resolve.
+//
+// The cache is built once from live bigmap state and then kept current
+// by applying registry bigmap updates of new blocks.
+type NameCache struct {
+	mu      sync.RWMutex
+	names   map[mavryk.Address]DomainName
+	bigmaps map[int64]*nameRegistry // registries by bigmap id
+	pending micheline.BigmapEvents  // updates received before Build completed
+	ready   bool
+	expired atomic.Bool
+	stats   Stats
+}
+
+type DomainName struct {
+	Name    string
+	Expires time.Time // zero when the name does not expire
+}
+
+func (n DomainName) IsValid(now time.Time) bool {
+	return n.Name != "" && (n.Expires.IsZero() || n.Expires.After(now))
+}
+
+// nameRegistry keeps the decoded bigmap state of a single registry.
+type nameRegistry struct {
+	ids     map[string]int64
+	types   map[string]micheline.Type
+	expiry  map[string]time.Time      // by expiry key
+	forward map[string]forwardRecord  // by name key
+	reverse map[mavryk.Address]string // name key by address
+}
+
+type forwardRecord struct {
+	addr      mavryk.Address
+	expiryKey string
+}
+
+func NewNameCache() *NameCache {
+	return &NameCache{
+		names:   make(map[mavryk.Address]DomainName),
+		bigmaps: make(map[int64]*nameRegistry),
+	}
+}
+
+func (c *NameCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.names)
+}
+
+func (c *NameCache) Stats() Stats {
+	s := c.stats.Get()
+	s.Size = c.Len()
+	return s
+}
+
+// Expire marks the cache for rebuild, e.g. after a new registry was
+// originated or registry updates were rolled back.
+func (c *NameCache) Expire() {
+	c.expired.Store(true)
+}
+
+func (c *NameCache) Expired() bool {
+	return c.expired.Load()
+}
+
+// Tracks reports whether bigmap id belongs to an indexed name registry.
+func (c *NameCache) Tracks(id int64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.bigmaps[id]
+	return ok
+}
+
+// Lookup returns the name of addr when it is registered and not expired
+// at time now.
+func (c *NameCache) Lookup(addr mavryk.Address, now time.Time) (string, bool) {
+	c.mu.RLock()
+	n, ok := c.names[addr]
+	c.mu.RUnlock()
+	if !ok || !n.IsValid(now) {
+		c.stats.CountMisses(1)
+		return "", false
+	}
+	c.stats.CountHits(1)
+	return n.Name, true
+}
+
+// Update applies registry bigmap updates and removals and re-resolves
+// the names of all affected addresses. Updates of blocks connected while
+// the cache is built are queued and applied by Build.
+func (c *NameCache) Update(events micheline.BigmapEvents) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.ready {
+		c.pending = append(c.pending, events...)
+		return
+	}
+	c.apply(events)
+}
+
+func (c *NameCache) apply(events micheline.BigmapEvents) {
+	for _, ev := range events {
+		r, ok := c.bigmaps[ev.Id]
+		if !ok || !ev.Key.IsValid() {
+			continue
+		}
+		var val micheline.Prim
+		switch ev.Action {
+		case micheline.DiffActionUpdate:
+			val = ev.Value
+		case micheline.DiffActionRemove:
+		default:
+			continue
+		}
+		c.stats.CountUpdates(1)
+		for _, addr := range r.apply(ev.Id, ev.Key, val) {
+			c.resolve(addr)
+		}
+	}
+}
+
+// Build loads names from the bigmaps of all registry contracts with code
+// hash codeHash.
+func (c *NameCache) Build(ctx context.Context, contracts, values *pack.Table, codeHash uint64) error {
+	c.stats.CountUpdates(1)
+	list := make([]*model.Contract, 0)
+	err := pack.NewQuery("cache.names").
+		WithTable(contracts).
+		WithoutCache().
+		AndEqual("code_hash", codeHash).
+		Execute(ctx, &list)
+	if err != nil {
+		return err
+	}
+	if err := model.JoinScripts(ctx, contracts, list...); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cc := range list {
+		if err := c.buildRegistry(ctx, cc, values); err != nil {
+			return err
+		}
+	}
+
+	// updates may already be contained in the loaded state, applying them
+	// again yields the same result
+	c.apply(c.pending)
+	c.pending = nil
+	c.ready = true
+	return nil
+}
+
+func (c *NameCache) buildRegistry(ctx context.Context, cc *model.Contract, values *pack.Table) error {
+	script, err := cc.LoadScript()
+	if err != nil || script == nil {
+		return err
+	}
+	var storage micheline.Prim
+	if err := storage.UnmarshalBinary(cc.Storage); err != nil {
+		return err
+	}
+	ids := micheline.DetectBigmaps(script.StorageType().Prim, storage)
+	r := &nameRegistry{
+		ids:     make(map[string]int64),
+		types:   script.BigmapTypes(),
+		expiry:  make(map[string]time.Time),
+		forward: make(map[string]forwardRecord),
+		reverse: make(map[mavryk.Address]string),
+	}
+	// expiry timestamps first, then forward and reverse records
+	for _, n := range []string{"expiry_map", "records", "reverse_records"} {
+		if _, ok := ids[n]; !ok {
+			log.Warnf("NameCache: registry %s has no %s bigmap", cc.Address, n)
+			return nil
+		}
+		r.ids[n] = ids[n]
+	}
+	for _, n := range []string{"expiry_map", "records", "reverse_records"} {
+		id := ids[n]
+		err := streamBigmap(ctx, values, id, func(k, v micheline.Prim) error {
+			r.apply(id, k, v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		c.bigmaps[id] = r
+	}
+	for addr := range r.reverse {
+		c.resolve(addr)
+	}
+	return nil
+}
+
+// resolve updates the name of addr from the current registry state.
+func (c *NameCache) resolve(addr mavryk.Address) {
+	for _, r := range c.bigmaps {
+		if n, ok := r.lookup(addr); ok {
+			if _, ok := c.names[addr]; !ok {
+				c.stats.CountInserts(1)
+			}
+			c.names[addr] = n
+			return
+		}
+	}
+	delete(c.names, addr)
+}
+
+// lookup returns the name of addr when its reverse record and the forward
+// record of the same name match.
+func (r *nameRegistry) lookup(addr mavryk.Address) (DomainName, bool) {
+	key, ok := r.reverse[addr]
+	if !ok {
+		return DomainName{}, false
+	}
+	fwd, ok := r.forward[key]
+	if !ok || !fwd.addr.Equal(addr) {
+		return DomainName{}, false
+	}
+	name, _ := model.UnpackTnsString(key)
+	n := DomainName{Name: name}
+	if fwd.expiryKey != "" {
+		n.Expires = r.expiry[fwd.expiryKey]
+	}
+	return n, true
+}
+
+// apply sets (or removes when v is invalid) key k in bigmap id and returns
+// the addresses whose names may have changed.
+func (r *nameRegistry) apply(id int64, k, v micheline.Prim) []mavryk.Address {
+	switch id {
+	case r.ids["expiry_map"]:
+		key := hex.EncodeToString(k.Bytes)
+		delete(r.expiry, key)
+		if v.IsValid() {
+			var tm time.Time
+			val := micheline.NewValue(r.types["expiry_map"].Right(), v)
+			if err := val.Unmarshal(&tm); err == nil {
+				r.expiry[key] = tm
+			}
+		}
+		var addrs []mavryk.Address
+		for _, fwd := range r.forward {
+			if fwd.expiryKey == key {
+				addrs = append(addrs, fwd.addr)
+			}
+		}
+		return addrs
+
+	case r.ids["records"]:
+		type record struct {
+			Address   string `json:"address"`
+			ExpiryKey string `json:"expiry_key"`
+		}
+		key := hex.EncodeToString(k.Bytes)
+		var addrs []mavryk.Address
+		if old, ok := r.forward[key]; ok {
+			addrs = append(addrs, old.addr)
+			delete(r.forward, key)
+		}
+		if !v.IsValid() {
+			return addrs
+		}
+		var rec record
+		val := micheline.NewValue(r.types["records"].Right(), v)
+		if err := val.Unmarshal(&rec); err != nil || rec.Address == "" {
+			return addrs
+		}
+		addr, err := mavryk.ParseAddress(rec.Address)
+		if err != nil {
+			return addrs
+		}
+		r.forward[key] = forwardRecord{addr: addr, expiryKey: rec.ExpiryKey}
+		return append(addrs, addr)
+
+	case r.ids["reverse_records"]:
+		type reverse struct {
+			Name string `json:"name"`
+		}
+		var addr mavryk.Address
+		switch k.Type {
+		case micheline.PrimBytes:
+			if err := addr.Decode(k.Bytes); err != nil {
+				return nil
+			}
+		case micheline.PrimString:
+			a, err := mavryk.ParseAddress(k.String)
+			if err != nil {
+				return nil
+			}
+			addr = a
+		default:
+			return nil
+		}
+		delete(r.reverse, addr)
+		if v.IsValid() {
+			var rec reverse
+			val := micheline.NewValue(r.types["reverse_records"].Right(), v)
+			if err := val.Unmarshal(&rec); err == nil && rec.Name != "" {
+				r.reverse[addr] = rec.Name
+			}
+		}
+		return []mavryk.Address{addr}
+	}
+	return nil
+}
+
+// streamBigmap calls fn with decoded key and value of each live entry.
+func streamBigmap(ctx context.Context, table *pack.Table, id int64, fn func(k, v micheline.Prim) error) error {
+	var item model.BigmapValue
+	return pack.NewQuery("cache.names").
+		WithTable(table).
+		WithoutCache().
+		AndEqual("bigmap_id", id).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&item); err != nil {
+				return err
+			}
+			var k, v micheline.Prim
+			if err := k.UnmarshalBinary(item.Key); err != nil {
+				return nil
+			}
+			if err := v.UnmarshalBinary(item.Value); err != nil {
+				return nil
+			}
+			return fn(k, v)
+		})
+}
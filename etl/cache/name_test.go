@@ -0,0 +1,189 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	_ "blockwatch.cc/packdb/store/bolt"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func createTestTable(t *testing.T, db *pack.DB, m model.Model) *pack.Table {
+	fields, err := pack.Fields(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := db.CreateTable(m.TableKey(), fields, m.TableOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestNameCache(t *testing.T) {
+	ctx := context.Background()
+	db, err := pack.CreateDatabase(t.TempDir(), "names", "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	contracts := createTestTable(t, db, model.Contract{})
+	values := createTestTable(t, db, model.BigmapValue{})
+
+	// registry storage with records (1), reverse_records (2), expiry_map (3)
+	anno := func(p micheline.Prim, a string) micheline.Prim {
+		return micheline.NewCodeAnno(p.OpCode, a, p.Args...)
+	}
+	records := anno(micheline.NewCode(micheline.T_BIG_MAP,
+		micheline.NewPrim(micheline.T_BYTES),
+		micheline.NewPairType(
+			anno(micheline.NewCode(micheline.T_OPTION, micheline.NewPrim(micheline.T_ADDRESS)), "%address"),
+			anno(micheline.NewCode(micheline.T_OPTION, micheline.NewPrim(micheline.T_BYTES)), "%expiry_key"),
+		),
+	), "%records")
+	reverse := anno(micheline.NewCode(micheline.T_BIG_MAP,
+		micheline.NewPrim(micheline.T_ADDRESS),
+		micheline.NewPairType(
+			anno(micheline.NewCode(micheline.T_OPTION, micheline.NewPrim(micheline.T_BYTES)), "%name"),
+			anno(micheline.NewPrim(micheline.T_ADDRESS), "%owner"),
+		),
+	), "%reverse_records")
+	expiry := anno(micheline.NewCode(micheline.T_BIG_MAP,
+		micheline.NewPrim(micheline.T_BYTES),
+		micheline.NewPrim(micheline.T_TIMESTAMP),
+	), "%expiry_map")
+	script := micheline.NewScript()
+	script.Code.Param = micheline.NewCode(micheline.K_PARAMETER, micheline.NewPrim(micheline.T_UNIT))
+	script.Code.Storage = micheline.NewCode(micheline.K_STORAGE, micheline.NewCode(micheline.T_PAIR, records, reverse, expiry))
+	script.Code.Code = micheline.NewCode(micheline.K_CODE, micheline.NewSeq())
+	storage := micheline.NewCode(micheline.D_PAIR, micheline.NewInt64(1), micheline.NewInt64(2), micheline.NewInt64(3))
+	script.Storage = storage
+	code, _ := script.MarshalBinary()
+	store, _ := storage.MarshalBinary()
+	if err := contracts.Insert(ctx, &model.Contract{
+		Address:  mavryk.NewAddress(mavryk.AddressTypeContract, make([]byte, 20)),
+		Script:   code,
+		Storage:  store,
+		CodeHash: 42,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := func(n byte) mavryk.Address {
+		hash := make([]byte, 20)
+		hash[19] = n
+		return mavryk.NewAddress(mavryk.AddressTypeEd25519, hash)
+	}
+	var (
+		alice = addr(1) // valid name
+		bob   = addr(2) // expired name
+		carol = addr(3) // reverse record points to a name resolving elsewhere
+		dave  = addr(4) // forward-only registration
+		now   = time.Now().UTC()
+	)
+	some := func(p micheline.Prim) micheline.Prim { return micheline.NewCode(micheline.D_SOME, p) }
+	none := micheline.NewCode(micheline.D_NONE)
+	addrPrim := func(a mavryk.Address) micheline.Prim { return micheline.NewBytes(a.Encode()) }
+	items := make([]pack.Item, 0)
+	put := func(id int64, k, v micheline.Prim) {
+		kb, _ := k.MarshalBinary()
+		vb, _ := v.MarshalBinary()
+		items = append(items, &model.BigmapValue{BigmapId: id, Key: kb, Value: vb})
+	}
+	put(3, micheline.NewBytes([]byte("alice.mav")), micheline.NewInt64(now.Add(time.Hour).Unix()))
+	put(3, micheline.NewBytes([]byte("bob.mav")), micheline.NewInt64(now.Add(-time.Hour).Unix()))
+	put(1, micheline.NewBytes([]byte("alice.mav")), micheline.NewPair(some(addrPrim(alice)), some(micheline.NewBytes([]byte("alice.mav")))))
+	put(1, micheline.NewBytes([]byte("bob.mav")), micheline.NewPair(some(addrPrim(bob)), some(micheline.NewBytes([]byte("bob.mav")))))
+	put(1, micheline.NewBytes([]byte("carol.mav")), micheline.NewPair(some(addrPrim(alice)), none))
+	put(1, micheline.NewBytes([]byte("dave.mav")), micheline.NewPair(some(addrPrim(dave)), none))
+	put(2, addrPrim(alice), micheline.NewPair(some(micheline.NewBytes([]byte("alice.mav"))), addrPrim(alice)))
+	put(2, addrPrim(bob), micheline.NewPair(some(micheline.NewBytes([]byte("bob.mav"))), addrPrim(bob)))
+	put(2, addrPrim(carol), micheline.NewPair(some(micheline.NewBytes([]byte("carol.mav"))), addrPrim(carol)))
+	if err := values.Insert(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewNameCache()
+	if err := c.Build(ctx, contracts, values, 42); err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := c.Lookup(alice, now); !ok || name != "alice.mav" {
+		t.Errorf("alice: got %q %t", name, ok)
+	}
+	if _, ok := c.Lookup(alice, now.Add(2*time.Hour)); ok {
+		t.Errorf("alice: name must expire")
+	}
+	for _, a := range []mavryk.Address{bob, carol, dave} {
+		if name, ok := c.Lookup(a, now); ok {
+			t.Errorf("%s: unexpected name %q", a, name)
+		}
+	}
+	if !c.Tracks(2) || c.Tracks(4) {
+		t.Errorf("unexpected tracked bigmaps")
+	}
+
+	// apply registry updates of a new block
+	renew := micheline.BigmapEvents{
+		{
+			Action: micheline.DiffActionUpdate,
+			Id:     3,
+			Key:    micheline.NewBytes([]byte("bob.mav")),
+			Value:  micheline.NewInt64(now.Add(time.Hour).Unix()),
+		},
+	}
+	c.Update(micheline.BigmapEvents{
+		// bob renews his name
+		renew[0],
+		// dave adds a reverse record
+		{
+			Action: micheline.DiffActionUpdate,
+			Id:     2,
+			Key:    addrPrim(dave),
+			Value:  micheline.NewPair(some(micheline.NewBytes([]byte("dave.mav"))), addrPrim(dave)),
+		},
+		// alice's name is removed
+		{
+			Action: micheline.DiffActionRemove,
+			Id:     1,
+			Key:    micheline.NewBytes([]byte("alice.mav")),
+		},
+		// untracked bigmap
+		{
+			Action: micheline.DiffActionUpdate,
+			Id:     4,
+			Key:    addrPrim(carol),
+			Value:  micheline.NewPair(some(micheline.NewBytes([]byte("carol.mav"))), addrPrim(carol)),
+		},
+	})
+	if c.Expired() {
+		t.Errorf("update must not expire the cache")
+	}
+	if name, ok := c.Lookup(bob, now); !ok || name != "bob.mav" {
+		t.Errorf("bob: got %q %t after renewal", name, ok)
+	}
+	if name, ok := c.Lookup(dave, now); !ok || name != "dave.mav" {
+		t.Errorf("dave: got %q %t after reverse record", name, ok)
+	}
+	for _, a := range []mavryk.Address{alice, carol} {
+		if name, ok := c.Lookup(a, now); ok {
+			t.Errorf("%s: unexpected name %q after update", a, name)
+		}
+	}
+
+	// updates received while a cache is built are applied after loading
+	c = NewNameCache()
+	c.Update(renew)
+	if err := c.Build(ctx, contracts, values, 42); err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := c.Lookup(bob, now); !ok || name != "bob.mav" {
+		t.Errorf("bob: got %q %t after renewal during build", name, ok)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package cache
+
+import (
+	"sort"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+var BigmapScriptMaxCacheSize = 1024 // entries
+
+// BigmapScriptCache keeps the annotated bigmap types declared in contract
+// storage. Post-Jakarta allocs lack annotations and are matched against
+// these types. Entries are keyed by contract and only returned when the
+// contract's code hash still matches, so upgraded scripts are reloaded.
+// A zero size disables the cache.
+type BigmapScriptCache struct {
+	cache *lru.Cache[model.AccountID, *BigmapScriptTypes] // key := account_id
+	stats Stats
+}
+
+// BigmapScriptTypes lists bigmap types from a contract's storage type in
+// annotation name order together with their unfolded typedefs used for
+// structural matching.
+type BigmapScriptTypes struct {
+	CodeHash uint64
+	Types    []micheline.Type
+	keys     []micheline.Typedef
+	values   []micheline.Typedef
+}
+
+func NewBigmapScriptTypes(script *micheline.Script, codeHash uint64) *BigmapScriptTypes {
+	t := &BigmapScriptTypes{CodeHash: codeHash}
+	if script == nil {
+		return t
+	}
+	named := script.BigmapTypes()
+	names := make([]string, 0, len(named))
+	for n := range named {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		typ := named[n]
+		t.Types = append(t.Types, typ)
+		t.keys = append(t.keys, typ.Left().Typedef("").Unfold())
+		t.values = append(t.values, typ.Right().Typedef("").Unfold())
+	}
+	return t
+}
+
+// Match returns the annotated key and value type of the first bigmap
+// which structurally equals the unannotated key and value type. Comb and
+// tree pair layouts are considered equal.
+func (t *BigmapScriptTypes) Match(key, value micheline.Prim) (micheline.Prim, micheline.Prim, bool) {
+	kt := micheline.NewType(key).Typedef("").Unfold()
+	vt := micheline.NewType(value).Typedef("").Unfold()
+	for i, typ := range t.Types {
+		if !t.keys[i].Equal(kt) || !t.values[i].Equal(vt) {
+			continue
+		}
+		return typ.Left().Prim.Clone(), typ.Right().Prim.Clone(), true
+	}
+	return micheline.Prim{}, micheline.Prim{}, false
+}
+
+func NewBigmapScriptCache(sz int) *BigmapScriptCache {
+	c := &BigmapScriptCache{}
+	if sz > 0 {
+		c.cache, _ = lru.NewWithEvict[model.AccountID, *BigmapScriptTypes](sz, c.onEvict)
+	}
+	return c
+}
+
+func (c *BigmapScriptCache) onEvict(_ model.AccountID, _ *BigmapScriptTypes) {
+	atomic.AddInt64(&c.stats.Evictions, 1)
+}
+
+func (c *BigmapScriptCache) IsEnabled() bool {
+	return c.cache != nil
+}
+
+// Load returns the bigmap types of contract cc from cache or parses its
+// script and caches the result.
+func (c *BigmapScriptCache) Load(cc *model.Contract) (*BigmapScriptTypes, error) {
+	if c.cache != nil {
+		if t, ok := c.cache.Get(cc.AccountId); ok && t.CodeHash == cc.CodeHash {
+			atomic.AddInt64(&c.stats.Hits, 1)
+			return t, nil
+		}
+		atomic.AddInt64(&c.stats.Misses, 1)
+	}
+	script, err := cc.LoadScript()
+	if err != nil {
+		return nil, err
+	}
+	t := NewBigmapScriptTypes(script, cc.CodeHash)
+	if c.cache != nil {
+		if c.cache.Contains(cc.AccountId) {
+			atomic.AddInt64(&c.stats.Updates, 1)
+		} else {
+			atomic.AddInt64(&c.stats.Inserts, 1)
+		}
+		c.cache.Add(cc.AccountId, t)
+	}
+	return t, nil
+}
+
+func (c *BigmapScriptCache) Purge() {
+	if c.cache == nil {
+		return
+	}
+	c.cache.Purge()
+}
+
+func (c *BigmapScriptCache) Stats() Stats {
+	s := c.stats.Get()
+	if c.cache != nil {
+		s.Size = c.cache.Len()
+	}
+	return s
+}
@@ -10,7 +10,10 @@ import (
 	"time"
 
 	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
 	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/metadata/decoder/domain"
 	"github.com/mavryk-network/mvindex/etl/model"
 )
 
@@ -37,8 +40,17 @@ func (m *Indexer) CacheStats() map[string]interface{} {
 	}
 	stats["bigmap_values"] = m.bigmap_values.Stats()
 	stats["bigmap_types"] = m.bigmap_types.Stats()
+	if m.bigmap_json.IsEnabled() {
+		stats["bigmap_json"] = m.bigmap_json.Stats()
+	}
 	stats["contract_types"] = m.contract_types.Stats()
 	stats["ticket_types"] = m.ticket_types.Stats()
+	if b := m.names.Load(); b != nil {
+		stats["names"] = b.(*cache.NameCache).Stats()
+	}
+	if idx, err := m.Index(index.BigmapIndexKey); err == nil {
+		stats["bigmap_scripts"] = idx.(*index.BigmapIndex).ScriptCacheStats()
+	}
 	return stats
 }
 
@@ -50,8 +62,10 @@ func (m *Indexer) PurgeCaches() {
 	m.rights = atomic.Value{}
 	m.addrs = atomic.Value{}
 	m.proposals = atomic.Value{}
+	m.names = atomic.Value{}
 	m.bigmap_values.Purge()
 	m.bigmap_types.Purge()
+	m.bigmap_json.Purge()
 	m.contract_types.Purge()
 	m.ticket_types.Purge()
 	for _, idx := range m.indexes {
@@ -61,6 +75,53 @@ func (m *Indexer) PurgeCaches() {
 	}
 }
 
+// LookupBigmapValueJSON returns the cached JSON encoding of a decoded bigmap
+// value when the cache is enabled and the cached value is still current.
+func (m *Indexer) LookupBigmapValueJSON(v *model.BigmapValue, unpack bool) ([]byte, bool) {
+	if !m.bigmap_json.IsEnabled() {
+		return nil, false
+	}
+	return m.bigmap_json.Get(v.KeyId, m.bigmap_json.Hash(v.Value, unpack))
+}
+
+func (m *Indexer) CacheBigmapValueJSON(v *model.BigmapValue, unpack bool, buf []byte) {
+	if !m.bigmap_json.IsEnabled() {
+		return
+	}
+	m.bigmap_json.Add(v.KeyId, m.bigmap_json.Hash(v.Value, unpack), buf)
+}
+
+func (m *Indexer) CanCacheBigmapValues() bool {
+	return m.bigmap_json.IsEnabled()
+}
+
+// BigmapDecodeWorkers returns the number of workers for decoding bigmap keys
+// and values on large API scans, see StreamDecoder.
+func (m *Indexer) BigmapDecodeWorkers() int {
+	return m.decodeWorkers
+}
+
+// drops decoded values of keys updated in block
+func (m *Indexer) updateBigmapValues(block *model.Block) {
+	if !m.bigmap_json.IsEnabled() {
+		return
+	}
+	for _, op := range block.Ops {
+		if !op.IsSuccess {
+			continue
+		}
+		for _, diff := range op.BigmapEvents {
+			if diff.Id < 0 {
+				continue
+			}
+			switch diff.Action {
+			case micheline.DiffActionUpdate, micheline.DiffActionRemove:
+				m.bigmap_json.Drop(model.GetKeyId(diff.Id, diff.KeyHash))
+			}
+		}
+	}
+}
+
 func (m *Indexer) NextRights(ctx context.Context, a model.AccountID, height int64) (int64, int64) {
 	cache, err := m.getRights(ctx, height)
 	if err != nil {
@@ -150,6 +211,20 @@ func (m *Indexer) LookupAddress(ctx context.Context, id model.AccountID) mavryk.
 	return cc.GetAddress(id)
 }
 
+// LookupName returns the registered domain name of addr. Names resolve
+// only when forward and reverse records match and are not expired.
+func (m *Indexer) LookupName(ctx context.Context, addr mavryk.Address) (string, bool) {
+	if !addr.IsValid() {
+		return "", false
+	}
+	names, err := m.getNames(ctx)
+	if err != nil {
+		log.Errorf("name cache build failed: %s", err)
+		return "", false
+	}
+	return names.Lookup(addr, time.Now())
+}
+
 func (m *Indexer) LookupRanking(ctx context.Context, id model.AccountID) (*model.AccountRank, bool) {
 	if id == 0 {
 		return nil, false
@@ -373,6 +448,98 @@ func (m *Indexer) updateAddrs(ctx context.Context, accounts map[model.AccountID]
 // 	return m.updateAddrs(ctx, nil)
 // }
 
+func (m *Indexer) getNames(ctx context.Context) (*cache.NameCache, error) {
+	// lazy-load on first call and rebuild after registry updates
+	names := m.names.Load()
+	if names == nil || names.(*cache.NameCache).Expired() {
+		// grab lock
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// check again
+		names = m.names.Load()
+		// build if still not updated by other goroutine
+		if names == nil || names.(*cache.NameCache).Expired() {
+			if err := m.buildNames(ctx); err != nil {
+				return nil, err
+			}
+			names = m.names.Load()
+		}
+	}
+	return names.(*cache.NameCache), nil
+}
+
+func (m *Indexer) buildNames(ctx context.Context) error {
+	startTime := time.Now()
+	contracts, err := m.Table(model.ContractTableKey)
+	if err != nil {
+		return err
+	}
+	values, err := m.Table(model.BigmapValueTableKey)
+	if err != nil {
+		return err
+	}
+	// blocks connected during the build are applied to the new cache
+	next := cache.NewNameCache()
+	m.names_next.Store(next)
+	defer m.names_next.Store((*cache.NameCache)(nil))
+	if err := next.Build(ctx, contracts, values, domain.CodeHash); err != nil {
+		return err
+	}
+	m.names.Store(next)
+	log.Debugf("Name cache with %d entries built in %s", next.Len(), time.Since(startTime))
+	return nil
+}
+
+// updateNames applies registry bigmap updates of a new block to the name
+// cache and to a cache that is being built. Only new registries require
+// a rebuild.
+func (m *Indexer) updateNames(block *model.Block) {
+	next, _ := m.names_next.Load().(*cache.NameCache)
+	if next != nil {
+		applyNames(next, block)
+	}
+	if names := m.names.Load(); names != nil && names.(*cache.NameCache) != next {
+		applyNames(names.(*cache.NameCache), block)
+	}
+}
+
+func applyNames(nc *cache.NameCache, block *model.Block) {
+	for _, op := range block.Ops {
+		if !op.IsSuccess {
+			continue
+		}
+		// new registries
+		if op.Contract != nil && op.Contract.CodeHash == domain.CodeHash && op.Type == model.OpTypeOrigination {
+			nc.Expire()
+			return
+		}
+		nc.Update(op.BigmapEvents)
+	}
+}
+
+// expireNames marks the name cache for rebuild when a rolled back block
+// updated registry bigmaps. Diffs do not contain previous values, so
+// rolled back updates cannot be reverted in place. A cache that is being
+// built may already contain rolled back updates.
+func (m *Indexer) expireNames(block *model.Block) {
+	if next, _ := m.names_next.Load().(*cache.NameCache); next != nil {
+		next.Expire()
+	}
+	names := m.names.Load()
+	if names == nil {
+		return
+	}
+	nc := names.(*cache.NameCache)
+	for _, op := range block.Ops {
+		for _, diff := range op.BigmapEvents {
+			if nc.Tracks(diff.Id) {
+				nc.Expire()
+				return
+			}
+		}
+	}
+}
+
 func (m *Indexer) getProposals(ctx context.Context) (*cache.ProposalCache, error) {
 	if m.lightMode {
 		return nil, ErrNoData
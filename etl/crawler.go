@@ -67,6 +67,10 @@ type CrawlerConfig struct {
 	Snapshot      *SnapshotConfig
 	EnableMonitor bool
 	Validate      bool
+	SupplyCheck   SupplyCheckMode
+
+	// max time to flush indexes on shutdown before tips are stored, 0 = off
+	ShutdownTimeout time.Duration
 }
 
 type SnapshotConfig struct {
@@ -86,12 +90,13 @@ type Crawler struct {
 	useMonitor    bool
 	enableMonitor bool
 	stopHeight    int64
+	flushTimeout  time.Duration
 
 	db        store.DB
 	rpc       *rpc.Client
 	builder   *Builder
 	indexer   *Indexer
-	finalized chan *rpc.Bundle
+	finalized *BlockQueue
 	filter    *ReorgDelayFilter
 	plog      *BlockProgressLogger
 	chainId   mavryk.ChainIdHash
@@ -102,6 +107,9 @@ type Crawler struct {
 	// read-mostly thread-safe access
 	tipStore atomic.Value
 
+	// new block notifications
+	feed *BlockFeed
+
 	// coordinated shutdown
 	quit   chan struct{}
 	ctx    context.Context
@@ -113,7 +121,21 @@ type Crawler struct {
 }
 
 func NewCrawler(cfg CrawlerConfig) *Crawler {
-	queue := make(chan *rpc.Bundle, cfg.Queue)
+	queue := NewBlockQueue(cfg.Queue)
+
+	// balances are incomplete when balance moving ops are skipped
+	if skip := cfg.Indexer.SkipOps(); skipsBalanceOps(skip) {
+		if cfg.SupplyCheck != SupplyCheckOff {
+			log.Warnf("Disabling supply check because skipped operations %v may move balances", skip)
+			cfg.SupplyCheck = SupplyCheckOff
+		}
+		if cfg.Validate {
+			log.Warnf("Disabling validation because skipped operations %v may move balances", skip)
+			cfg.Validate = false
+		}
+	}
+	builder := NewBuilder(cfg.Indexer, cfg.Client, cfg.Validate)
+	builder.supply = NewSupplyChecker(cfg.SupplyCheck)
 	return &Crawler{
 		state:         STATE_LOADING,
 		mode:          MODE_SYNC,
@@ -121,14 +143,16 @@ func NewCrawler(cfg CrawlerConfig) *Crawler {
 		useMonitor:    false,
 		enableMonitor: cfg.EnableMonitor,
 		stopHeight:    cfg.StopBlock,
+		flushTimeout:  cfg.ShutdownTimeout,
 		db:            cfg.DB,
 		rpc:           cfg.Client,
-		builder:       NewBuilder(cfg.Indexer, cfg.Client, cfg.Validate),
+		builder:       builder,
 		indexer:       cfg.Indexer,
 		finalized:     queue,
 		filter:        NewReorgDelayFilter(cfg.Delay, queue),
 		delay:         int64(cfg.Delay),
 		plog:          NewBlockProgressLogger("Processed"),
+		feed:          NewBlockFeed(),
 		quit:          make(chan struct{}),
 	}
 }
@@ -137,6 +161,11 @@ func (c *Crawler) Tip() *model.ChainTip {
 	return c.tipStore.Load().(*model.ChainTip)
 }
 
+// Feed returns the feed of newly connected blocks.
+func (c *Crawler) Feed() *BlockFeed {
+	return c.feed
+}
+
 func (c *Crawler) Height() int64 {
 	return c.Tip().BestHeight
 }
@@ -223,22 +252,22 @@ func (c *Crawler) disableMonitor() {
 }
 
 func (c *Crawler) Params() *rpc.Params {
-	return c.indexer.reg.GetParamsLatest()
+	return c.indexer.current().reg.GetParamsLatest()
 }
 
 func (c *Crawler) ParamsByHeight(height int64) *rpc.Params {
 	if height < 0 {
 		height = c.Height()
 	}
-	return c.indexer.ParamsByHeight(height)
+	return c.indexer.current().ParamsByHeight(height)
 }
 
 func (c *Crawler) ParamsByCycle(cycle int64) *rpc.Params {
-	return c.indexer.ParamsByCycle(cycle)
+	return c.indexer.current().ParamsByCycle(cycle)
 }
 
 func (c *Crawler) ParamsByProtocol(proto mavryk.ProtocolHash) *rpc.Params {
-	p, _ := c.indexer.ParamsByProtocol(proto)
+	p, _ := c.indexer.current().ParamsByProtocol(proto)
 	return p
 }
 
@@ -267,13 +296,14 @@ func (c *Crawler) CacheStats() map[string]interface{} {
 }
 
 type CrawlerStatus struct {
-	Mode       Mode      `json:"mode"`
-	Status     State     `json:"status"`
-	Blocks     int64     `json:"blocks"`
-	Finalized  int64     `json:"finalized"`
-	Indexed    int64     `json:"indexed"`
-	Progress   float64   `json:"progress"`
-	LastUpdate time.Time `json:"last_update"`
+	Mode       Mode       `json:"mode"`
+	Status     State      `json:"status"`
+	Blocks     int64      `json:"blocks"`
+	Finalized  int64      `json:"finalized"`
+	Indexed    int64      `json:"indexed"`
+	Progress   float64    `json:"progress"`
+	LastUpdate time.Time  `json:"last_update"`
+	Node       rpc.Health `json:"node"`
 
 	expires time.Time
 }
@@ -293,6 +323,9 @@ func (c *Crawler) Status() CrawlerStatus {
 	if c.indexer.lightMode {
 		s.Mode = MODE_LIGHT
 	}
+	if c.rpc != nil {
+		s.Node = c.rpc.Health()
+	}
 	head := atomic.LoadInt64(&c.head)
 	if tip.BestHeight > 0 && head > 0 {
 		s.Blocks = head
@@ -531,8 +564,8 @@ func (c *Crawler) Stop(ctx context.Context) {
 		done <- struct{}{}
 	}()
 
-	// prepare shutdown timeout
-	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	// prepare shutdown timeout, leave time for flushing indexes
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second+c.flushTimeout)
 	defer cancel()
 
 	select {
@@ -550,6 +583,7 @@ func (c *Crawler) Stop(ctx context.Context) {
 	// wait for done channel to become readable or closed,
 	// meaning all goroutines have exited by now
 	<-done
+	c.feed.Close()
 	c.setState(STATE_STOPPED, MONITOR_DISABLE)
 	log.Info("Stopped blockchain crawler.")
 }
@@ -652,7 +686,7 @@ func (c *Crawler) runIngest(next chan mavryk.BlockHash) {
 	c.wg.Add(1)
 	defer c.wg.Done()
 	defer close(next)
-	defer close(c.finalized)
+	defer c.finalized.Close()
 
 	// init current state
 	var nextHash mavryk.BlockHash
@@ -753,7 +787,7 @@ func (c *Crawler) runIngest(next chan mavryk.BlockHash) {
 			// be resilient to network errors
 			if tzblock != nil {
 				// push block through reorg/delay filter and into finalized queue; may block
-				// log.Debugf("crawler: queuing block %d %s q=%d", tzblock.Height(), tzblock.Hash(), len(c.finalized))
+				// log.Debugf("crawler: queuing block %d %s q=%d", tzblock.Height(), tzblock.Hash(), c.finalized.Len())
 				err := c.filter.Push(c.ctx, tzblock, c.quit)
 				if err != nil {
 					switch err {
@@ -763,11 +797,15 @@ func (c *Crawler) runIngest(next chan mavryk.BlockHash) {
 						useMon = c.setState(STATE_SYNCHRONIZING, MONITOR_DISABLE)
 
 					case ErrReorgDetected:
-						// clear filter, leave monitor mode and fall back to crawling
-						log.Debugf("crawler: reorg detected at %d. Falling back to crawl mode.", tzblock.Height())
+						// clear filter and queued blocks which may be orphaned, leave
+						// monitor mode and fall back to crawling after the last indexed
+						// block; a block the indexer processes concurrently is fetched
+						// again and skipped as duplicate or reorganized
 						c.filter.Reset()
+						n := c.finalized.Flush()
+						log.Debugf("crawler: reorg detected at %d, flushed %d queued blocks. Falling back to crawl mode.", tzblock.Height(), n)
 						useMon = c.setState(STATE_SYNCHRONIZING, MONITOR_DISABLE)
-						lastblock -= c.delay
+						lastblock = c.Height()
 						// give the node/proxy some time to catch up
 						time.Sleep(time.Second)
 
@@ -836,7 +874,7 @@ func (c *Crawler) ingest(_ context.Context) {
 	// internal next block signal to prefetch blocks; may hold an empty
 	// hash (initially, after errors, and on ticks) or a block hash
 	// when received via monitoring (monitor may break, so we don't rely on it)
-	next := make(chan mavryk.BlockHash, cap(c.finalized))
+	next := make(chan mavryk.BlockHash, c.finalized.Cap())
 
 	if c.enableMonitor {
 		// run monitor loop in go-routine
@@ -850,24 +888,6 @@ func (c *Crawler) ingest(_ context.Context) {
 	next <- mavryk.BlockHash{}
 }
 
-func drain(c chan *rpc.Bundle) {
-	if len(c) == 0 {
-		return
-	}
-	for {
-		select {
-		case <-c:
-			if len(c) > 0 {
-				// keep going until flushed
-				continue
-			}
-			return
-		default:
-			return
-		}
-	}
-}
-
 func (c *Crawler) syncBlockchain() {
 	c.wg.Add(1)
 	defer c.wg.Done()
@@ -886,7 +906,10 @@ func (c *Crawler) syncBlockchain() {
 
 	// run ingest goroutine
 	c.ingest(ctx)
-	defer drain(c.finalized)
+
+	// on exit, release queued blocks until ingest has stopped; runs after
+	// the deferred cleanup below which cancels the context
+	defer c.finalized.Drain()
 
 	var (
 		tzblock    *rpc.Bundle
@@ -922,8 +945,21 @@ func (c *Crawler) syncBlockchain() {
 			c.setState(STATE_FAILED, MONITOR_DISABLE)
 		}
 
-		// flush indexer journals on failure (may take some time)
-		if state, _ := c.getState(); state == STATE_FAILED {
+		// flush all indexes before tips are stored, so stored tips never
+		// point past persisted data; if this fails, older tips remain and
+		// incomplete blocks are truncated on next start
+		if c.flushTimeout > 0 {
+			log.Infof("Flushing indexes at height %d.", tip.BestHeight)
+			fctx, cancel := context.WithTimeout(context.Background(), c.flushTimeout)
+			err := c.indexer.FlushAll(fctx)
+			cancel()
+			if err != nil {
+				log.Errorf("Flushing indexes at height %d: %s", tip.BestHeight, err)
+				c.cancel()
+				return
+			}
+		} else if state, _ := c.getState(); state == STATE_FAILED {
+			// flush indexer journals on failure (may take some time)
 			if err := c.indexer.FlushJournals(ctx); err != nil {
 				log.Errorf("flushing tables: %s", err)
 			}
@@ -944,28 +980,28 @@ func (c *Crawler) syncBlockchain() {
 
 	// process new blocks as they arrive
 	for {
-		select {
-		case <-c.quit:
-			c.setState(STATE_STOPPING, MONITOR_DISABLE)
+		// process finalized blocks, all blocks arriving from this queue
+		// are expected to be in order, gap-free and reorg-free; we may
+		// drop all reorg handling code here and in builder/indexers
+		// when Tenderbake goes live and we set a sufficient margin
+		var err error
+		tzblock, err = c.finalized.Pop(ctx, c.quit)
+		switch {
+		case err == ErrQueueClosed:
 			log.Infof("Stopping blockchain sync at height %d.", tip.BestHeight)
 			return
-		case <-ctx.Done():
+		case err != nil:
 			c.setState(STATE_STOPPING, MONITOR_DISABLE)
-			log.Infof("Context aborted. Stopping blockchain sync at height %d.", tip.BestHeight)
-			return
-		case tzblock = <-c.finalized:
-			// process finalized blocks, all blocks arriving from this queue
-			// are expected to be in order, gap-free and reorg-free; we may
-			// drop all reorg handling code here and in builder/indexers
-			// when Tenderbake goes live and we set a sufficient margin
-			if tzblock == nil {
+			if ctx.Err() != nil {
+				log.Infof("Context aborted. Stopping blockchain sync at height %d.", tip.BestHeight)
+			} else {
 				log.Infof("Stopping blockchain sync at height %d.", tip.BestHeight)
-				return
-			}
-			// log.Tracef("Processing block %d %s", tzblock.Height(), tzblock.Hash())
-			if atomic.LoadInt64(&c.head) > tzblock.Height()+c.delay {
-				c.setState(STATE_SYNCHRONIZING, MONITOR_KEEP)
 			}
+			return
+		}
+		// log.Tracef("Processing block %d %s", tzblock.Height(), tzblock.Hash())
+		if atomic.LoadInt64(&c.head) > tzblock.Height()+c.delay {
+			c.setState(STATE_SYNCHRONIZING, MONITOR_KEEP)
 		}
 
 		// under very rare conditions (tick and monitor triggered the same block download,
@@ -1064,6 +1100,11 @@ func (c *Crawler) syncBlockchain() {
 		// CRITICAL SECTION END
 		//
 
+		// notify subscribers
+		if c.feed.Len() > 0 {
+			c.feed.Publish(NewBlockSummary(block, c.builder))
+		}
+
 		// check for shutdown signal
 		if ctx.Err() != nil {
 			continue
@@ -1093,10 +1134,19 @@ func (c *Crawler) syncBlockchain() {
 		}
 
 		// log progress once every 10sec or immediatly when in sync
-		c.plog.LogBlockHeight(block, len(c.finalized), state, time.Since(blockstart), state == STATE_SYNCHRONIZED)
-
-		// update state every 256 blocks or every block when synchronized
-		if state == STATE_SYNCHRONIZED || block.Height&0xff == 0 {
+		c.plog.LogBlockHeight(block, c.finalized.Len(), state, time.Since(blockstart), state == STATE_SYNCHRONIZED)
+
+		// update state every block when synchronized; during catch-up tables
+		// are flushed together with tips every 256 blocks and before a table
+		// would flush on its own, so data is never persisted far ahead of tips
+		checkpoint := state != STATE_SYNCHRONIZED && (block.Height&0xff == 0 || c.indexer.NeedCheckpoint())
+		if checkpoint {
+			if err := c.indexer.Checkpoint(ctx); err != nil {
+				log.Errorf("Flushing tables at block %d: %s", block.Height, err)
+				break
+			}
+		}
+		if state == STATE_SYNCHRONIZED || checkpoint {
 			err := c.db.Update(func(dbTx store.Tx) error {
 				if err := c.indexer.storeTips(dbTx); err != nil {
 					return err
@@ -0,0 +1,170 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// StreamDecoder decodes items read on a stream goroutine across a bounded
+// pool of workers and emits results in submission order. It is used from
+// pack.Stream callbacks where decoding of rows (e.g. Micheline keys and
+// values) dominates the cost of a scan. Rows must be copied out of the pack
+// with Row.Decode before submission because pack memory is reused.
+//
+// With less than two workers items are decoded and emitted inline.
+//
+// The first error returned by decode or emit stops the pipeline and is
+// returned from all later calls to Submit and from Close. Panics in decode
+// are turned into errors because workers run outside the API call. Emit may return
+// io.EOF to end a stream early, the same as a Stream callback.
+type StreamDecoder[T, R any] struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	decode  func(T) (R, error)
+	emit    func(R) error
+	workers int
+	jobs    chan *decodeJob[T, R] // dispatched to workers
+	queue   chan *decodeJob[T, R] // waiting for emit in submission order
+	wg      sync.WaitGroup
+	done    chan struct{}
+	mu      sync.Mutex
+	err     error
+}
+
+type decodeJob[T, R any] struct {
+	in   T
+	out  R
+	err  error
+	done chan struct{}
+}
+
+func NewStreamDecoder[T, R any](ctx context.Context, workers int, decode func(T) (R, error), emit func(R) error) *StreamDecoder[T, R] {
+	ctx, cancel := context.WithCancel(ctx)
+	d := &StreamDecoder[T, R]{
+		ctx:     ctx,
+		cancel:  cancel,
+		decode:  decode,
+		emit:    emit,
+		workers: workers,
+	}
+	if workers < 2 {
+		return d
+	}
+	// the emit queue bounds the number of items in flight
+	d.jobs = make(chan *decodeJob[T, R], workers)
+	d.queue = make(chan *decodeJob[T, R], 4*workers)
+	d.done = make(chan struct{})
+	d.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	go d.collect()
+	return d
+}
+
+// Submit queues an item for decoding. It blocks while the pipeline is full
+// and returns an error once the pipeline has stopped.
+func (d *StreamDecoder[T, R]) Submit(v T) error {
+	if err := d.Err(); err != nil {
+		return err
+	}
+	if d.workers < 2 {
+		out, err := d.tryDecode(v)
+		if err == nil {
+			err = d.emit(out)
+		}
+		if err != nil {
+			d.fail(err)
+		}
+		return err
+	}
+	job := &decodeJob[T, R]{in: v, done: make(chan struct{})}
+	select {
+	case d.jobs <- job:
+	case <-d.ctx.Done():
+		return d.Err()
+	}
+	select {
+	case d.queue <- job:
+		return nil
+	case <-d.ctx.Done():
+		return d.Err()
+	}
+}
+
+// Close waits for all submitted items to be emitted, stops workers and
+// returns the first error.
+func (d *StreamDecoder[T, R]) Close() error {
+	if d.workers >= 2 {
+		close(d.jobs)
+		close(d.queue)
+		d.wg.Wait()
+		<-d.done
+	}
+	d.cancel()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// Err returns the error that stopped the pipeline, if any.
+func (d *StreamDecoder[T, R]) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil && d.ctx.Err() != nil {
+		d.err = d.ctx.Err()
+	}
+	return d.err
+}
+
+func (d *StreamDecoder[T, R]) fail(err error) {
+	d.mu.Lock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.mu.Unlock()
+	d.cancel()
+}
+
+func (d *StreamDecoder[T, R]) work() {
+	defer d.wg.Done()
+	for job := range d.jobs {
+		if err := d.ctx.Err(); err != nil {
+			job.err = err
+		} else {
+			job.out, job.err = d.tryDecode(job.in)
+		}
+		close(job.done)
+	}
+}
+
+func (d *StreamDecoder[T, R]) tryDecode(v T) (out R, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("decode panic: %v", e)
+		}
+	}()
+	return d.decode(v)
+}
+
+func (d *StreamDecoder[T, R]) collect() {
+	defer close(d.done)
+	for job := range d.queue {
+		// drain the queue after failure
+		<-job.done
+		if d.Err() != nil {
+			continue
+		}
+		if job.err != nil {
+			d.fail(job.err)
+			continue
+		}
+		if err := d.emit(job.out); err != nil {
+			d.fail(err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func runStreamDecoder(ctx context.Context, workers, n int, decode func(int) (int, error), emit func(int) error) error {
+	dec := NewStreamDecoder(ctx, workers, decode, emit)
+	for i := 0; i < n; i++ {
+		if dec.Submit(i) != nil {
+			break
+		}
+	}
+	return dec.Close()
+}
+
+func TestStreamDecoder(t *testing.T) {
+	errDecode := errors.New("decode failed")
+	for _, workers := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			// results are emitted in submission order
+			res := make([]int, 0)
+			err := runStreamDecoder(context.Background(), workers, 1000,
+				func(i int) (int, error) { return 2 * i, nil },
+				func(i int) error { res = append(res, i); return nil },
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(res) != 1000 {
+				t.Fatalf("got %d results, want 1000", len(res))
+			}
+			for i, v := range res {
+				if v != 2*i {
+					t.Fatalf("result %d: got %d, want %d", i, v, 2*i)
+				}
+			}
+
+			// decode errors stop the pipeline
+			res = res[:0]
+			err = runStreamDecoder(context.Background(), workers, 1000,
+				func(i int) (int, error) {
+					if i == 100 {
+						return 0, errDecode
+					}
+					return i, nil
+				},
+				func(i int) error { res = append(res, i); return nil },
+			)
+			if err != errDecode {
+				t.Errorf("got error %v, want %v", err, errDecode)
+			}
+			if len(res) != 100 {
+				t.Errorf("got %d results before error, want 100", len(res))
+			}
+
+			// decode panics stop the pipeline with an error
+			err = runStreamDecoder(context.Background(), workers, 1000,
+				func(i int) (int, error) {
+					if i == 100 {
+						panic("bad value")
+					}
+					return i, nil
+				},
+				func(int) error { return nil },
+			)
+			if err == nil || err.Error() != "decode panic: bad value" {
+				t.Errorf("got error %v, want decode panic", err)
+			}
+
+			// emit ends the stream early
+			res = res[:0]
+			err = runStreamDecoder(context.Background(), workers, 1000,
+				func(i int) (int, error) { return i, nil },
+				func(i int) error {
+					res = append(res, i)
+					if len(res) == 10 {
+						return io.EOF
+					}
+					return nil
+				},
+			)
+			if err != io.EOF || len(res) != 10 {
+				t.Errorf("got %d results and error %v, want 10 and EOF", len(res), err)
+			}
+
+			// cancelation aborts all workers
+			ctx, cancel := context.WithCancel(context.Background())
+			err = runStreamDecoder(ctx, workers, 1000,
+				func(i int) (int, error) {
+					if i == 50 {
+						cancel()
+					}
+					return i, nil
+				},
+				func(int) error { return nil },
+			)
+			if err != context.Canceled {
+				t.Errorf("got error %v, want %v", err, context.Canceled)
+			}
+		})
+	}
+}
+
+// BenchmarkStreamDecoder decodes and JSON encodes values of a 100k key bigmap
+// with nested value types as done by bigmap value API calls.
+func BenchmarkStreamDecoder(b *testing.B) {
+	const nKeys = 100_000
+	typ := micheline.NewType(micheline.NewPairType(
+		micheline.NewMapType(micheline.NewCode(micheline.T_STRING), micheline.NewCode(micheline.T_BYTES)),
+		micheline.NewPairType(
+			micheline.NewCode(micheline.T_LIST, micheline.NewPairType(
+				micheline.NewCode(micheline.T_NAT),
+				micheline.NewCode(micheline.T_TIMESTAMP),
+			)),
+			micheline.NewOptType(micheline.NewCode(micheline.T_STRING)),
+		),
+	))
+	values := make([]*model.BigmapValue, nKeys)
+	for i := range values {
+		info := micheline.NewMap(
+			micheline.NewMapElem(micheline.NewString(""), micheline.NewBytes([]byte(fmt.Sprintf("ipfs://token/%d", i)))),
+			micheline.NewMapElem(micheline.NewString("decimals"), micheline.NewBytes([]byte("0"))),
+			micheline.NewMapElem(micheline.NewString("name"), micheline.NewBytes([]byte(fmt.Sprintf("Token %d", i)))),
+		)
+		hist := micheline.NewSeq()
+		for j := 0; j < 8; j++ {
+			hist.Args = append(hist.Args, micheline.NewPair(
+				micheline.NewNat(big.NewInt(int64(i+j))),
+				micheline.NewInt64(1700000000+int64(j)),
+			))
+		}
+		val := micheline.NewPair(info, micheline.NewPair(hist, micheline.NewOption(micheline.NewString("memo"))))
+		buf, _ := val.MarshalBinary()
+		values[i] = &model.BigmapValue{Value: buf}
+	}
+	decode := func(v *model.BigmapValue) ([]byte, error) {
+		return json.Marshal(v.GetValue(typ))
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				var size int
+				dec := NewStreamDecoder(context.Background(), workers, decode, func(buf []byte) error {
+					size += len(buf)
+					return nil
+				})
+				for _, v := range values {
+					if err := dec.Submit(v); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := dec.Close(); err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(int64(size))
+			}
+		})
+	}
+}
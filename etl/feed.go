@@ -0,0 +1,170 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// BlockSummary describes a newly connected block for feed subscribers.
+// On reorg subscribers first receive a rewind summary for the fork point
+// and then the new main chain blocks, i.e. heights may repeat.
+type BlockSummary struct {
+	Rewind   bool // chain was rewound to the fork point at Height
+	Height   int64
+	Hash     mavryk.BlockHash
+	Parent   mavryk.BlockHash
+	Time     time.Time
+	Cycle    int64
+	NOps     int
+	NEvents  int
+	Events   []*model.Event               // contract events emitted in the block
+	Accounts map[model.AccountID]struct{} // accounts touched by operations
+}
+
+// Touches reports whether any operation in the block involves account id.
+func (b *BlockSummary) Touches(id model.AccountID) bool {
+	_, ok := b.Accounts[id]
+	return ok
+}
+
+func NewBlockSummary(block *model.Block, builder *Builder) *BlockSummary {
+	s := &BlockSummary{
+		Height:   block.Height,
+		Hash:     block.Hash,
+		Time:     block.Timestamp,
+		Cycle:    block.Cycle,
+		NOps:     block.NOpsApplied + block.NOpsFailed,
+		NEvents:  block.NEvents,
+		Accounts: make(map[model.AccountID]struct{}),
+	}
+	if block.Parent != nil {
+		s.Parent = block.Parent.Hash
+	}
+	for _, op := range block.Ops {
+		for _, id := range []model.AccountID{op.SenderId, op.ReceiverId, op.CreatorId, op.BakerId} {
+			if id > 0 {
+				s.Accounts[id] = struct{}{}
+			}
+		}
+		if !op.IsSuccess || op.Raw == nil {
+			continue
+		}
+		for _, v := range op.Raw.Meta().InternalResults {
+			if v.Kind != mavryk.OpTypeEvent {
+				continue
+			}
+			src, ok := builder.AccountByAddress(v.Source)
+			if !ok {
+				continue
+			}
+			s.Events = append(s.Events, model.NewEventWithData(*v, src.RowId, op))
+		}
+	}
+	return s
+}
+
+// NewRewindSummary returns a summary that tells subscribers to discard all
+// blocks above fork, published before blocks of a new main chain.
+func NewRewindSummary(fork *model.ChainTip) *BlockSummary {
+	return &BlockSummary{
+		Rewind: true,
+		Height: fork.BestHeight,
+		Hash:   fork.BestHash,
+		Time:   fork.BestTime,
+	}
+}
+
+// BlockFeed fans out block summaries to subscribers. Publishing never
+// blocks: subscribers whose buffer is full are dropped.
+type BlockFeed struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives block summaries on C until it is closed by
+// the subscriber, dropped for being too slow or the feed shuts down.
+type Subscription struct {
+	C       <-chan *BlockSummary
+	ch      chan *BlockSummary
+	feed    *BlockFeed
+	dropped bool
+}
+
+func NewBlockFeed() *BlockFeed {
+	return &BlockFeed{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Len returns the number of subscribers.
+func (f *BlockFeed) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs)
+}
+
+// Subscribe registers a subscriber which buffers at most size summaries.
+func (f *BlockFeed) Subscribe(size int) *Subscription {
+	ch := make(chan *BlockSummary, max(size, 1))
+	s := &Subscription{
+		C:    ch,
+		ch:   ch,
+		feed: f,
+	}
+	f.mu.Lock()
+	f.subs[s] = struct{}{}
+	f.mu.Unlock()
+	return s
+}
+
+// Publish sends b to all subscribers and drops subscribers which cannot
+// keep up.
+func (f *BlockFeed) Publish(b *BlockSummary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		select {
+		case s.ch <- b:
+		default:
+			s.dropped = true
+			f.remove(s)
+		}
+	}
+}
+
+// Close closes all subscriptions.
+func (f *BlockFeed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		f.remove(s)
+	}
+}
+
+func (f *BlockFeed) remove(s *Subscription) {
+	if _, ok := f.subs[s]; ok {
+		delete(f.subs, s)
+		close(s.ch)
+	}
+}
+
+// Close unsubscribes s from its feed.
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	s.feed.remove(s)
+}
+
+// Dropped reports whether the feed closed s because its buffer was full.
+// Only valid after C was closed.
+func (s *Subscription) Dropped() bool {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	return s.dropped
+}
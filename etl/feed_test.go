@@ -0,0 +1,46 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"testing"
+)
+
+func TestBlockFeed(t *testing.T) {
+	feed := NewBlockFeed()
+	fast := feed.Subscribe(2)
+	slow := feed.Subscribe(1)
+	gone := feed.Subscribe(1)
+	gone.Close()
+	if feed.Len() != 2 {
+		t.Fatalf("expected 2 subscribers, got %d", feed.Len())
+	}
+
+	for h := int64(1); h <= 2; h++ {
+		feed.Publish(&BlockSummary{Height: h})
+		if b := <-fast.C; b.Height != h {
+			t.Errorf("fast: expected height %d, got %d", h, b.Height)
+		}
+	}
+
+	// slow subscriber is dropped after its buffer overflows
+	if b := <-slow.C; b.Height != 1 {
+		t.Errorf("slow: expected height 1, got %d", b.Height)
+	}
+	if _, ok := <-slow.C; ok {
+		t.Errorf("slow: expected closed channel")
+	}
+	if !slow.Dropped() || fast.Dropped() || gone.Dropped() {
+		t.Errorf("unexpected dropped state")
+	}
+	if feed.Len() != 1 {
+		t.Errorf("expected 1 subscriber, got %d", feed.Len())
+	}
+
+	feed.Close()
+	if _, ok := <-fast.C; ok {
+		t.Errorf("fast: expected closed channel")
+	}
+	fast.Close()
+}
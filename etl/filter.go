@@ -17,12 +17,12 @@ var (
 
 type ReorgDelayFilter struct {
 	queue []*rpc.Bundle
-	out   chan<- *rpc.Bundle
+	out   *BlockQueue
 	head  int
 	tail  int
 }
 
-func NewReorgDelayFilter(depth int, out chan<- *rpc.Bundle) *ReorgDelayFilter {
+func NewReorgDelayFilter(depth int, out *BlockQueue) *ReorgDelayFilter {
 	return &ReorgDelayFilter{
 		queue: make([]*rpc.Bundle, depth),
 		out:   out,
@@ -57,14 +57,7 @@ func (f *ReorgDelayFilter) Reset() {
 func (f *ReorgDelayFilter) Push(ctx context.Context, b *rpc.Bundle, quit <-chan struct{}) error {
 	// when disabled, forward directly
 	if len(f.queue) == 0 {
-		select {
-		case f.out <- b: // may block
-			return nil
-		case <-quit: // unblock on shutdown
-			return context.Canceled
-		case <-ctx.Done(): // unblock on forced shutdown
-			return ctx.Err()
-		}
+		return f.out.Push(ctx, b, quit) // may block
 	}
 
 	// check pre-cond
@@ -101,12 +94,8 @@ func (f *ReorgDelayFilter) Push(ctx context.Context, b *rpc.Bundle, quit <-chan
 
 	// output when queue is full
 	if f.tail == f.head && head != nil {
-		select {
-		case f.out <- head: // may block
-		case <-quit: // unblock on shutdown
-			return context.Canceled
-		case <-ctx.Done(): // unblock on forced shutdown
-			return ctx.Err()
+		if err := f.out.Push(ctx, head, quit); err != nil { // may block
+			return err
 		}
 		f.head = (f.head + 1) % len(f.queue)
 	}
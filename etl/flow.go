@@ -8,19 +8,35 @@ import (
 	"github.com/mavryk-network/mvindex/rpc"
 )
 
+// FeePayer returns the account debited for fees in a list of fee balance
+// updates so that fee flows follow the balance updates reported by the node.
+// Defaults to src when no debited account is known.
+func (b *Builder) FeePayer(src *model.Account, fees rpc.BalanceUpdates) *model.Account {
+	for _, u := range fees {
+		if u.Kind != "contract" || u.Change >= 0 {
+			continue
+		}
+		if acc, ok := b.AccountByAddress(u.Address()); ok {
+			return acc
+		}
+	}
+	return src
+}
+
 // Fees for manager operations (optional, i.e. sender may set to zero,
 // for batch ops fees may also be paid by any op in batch)
 func (b *Builder) NewFeeFlows(src *model.Account, fees rpc.BalanceUpdates, id model.OpRef) ([]*model.Flow, int64) {
 	var sum int64
 	flows := make([]*model.Flow, 0)
 	typ := model.MapFlowType(id.Kind)
+	src = b.FeePayer(src, fees)
 	for _, u := range fees {
 		if u.Change == 0 {
 			continue
 		}
 		switch u.Kind {
 		case "contract":
-			// pre/post-Ithaca fees paid by src
+			// pre/post-Ithaca fees paid by src or the batch fee payer
 			f := model.NewFlow(b.block, src, b.block.Proposer.Account, id)
 			f.Kind = model.FlowKindBalance
 			f.Type = typ
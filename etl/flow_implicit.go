@@ -44,6 +44,13 @@ func (b *Builder) NewImplicitFlows() []*model.Flow {
 
 	// decode balance updates in order of appearance
 	for i, u := range bu {
+		// tag flows created from this update with its origin
+		n := len(flows)
+		origin := model.ParseFlowOrigin(u.Origin)
+		if !origin.IsValid() {
+			log.Warnf("block balance update %d:%d unknown origin %q", b.block.Height, i, u.Origin)
+			origin = model.FlowOriginBlock
+		}
 		// 1/ determine who this update is for?
 		//
 		// priority order is defined in rpc/balance.go
@@ -571,6 +578,9 @@ func (b *Builder) NewImplicitFlows() []*model.Flow {
 				}
 			}
 		}
+		for _, f := range flows[n:] {
+			f.Origin = origin
+		}
 	}
 	return flows
 }
@@ -580,6 +590,7 @@ func (b *Builder) NewSubsidyFlow(acc *model.Account, amount int64, id model.OpRe
 	f.Kind = model.FlowKindBalance
 	f.Type = model.FlowTypeSubsidy
 	f.AmountIn = amount
+	f.Origin = model.FlowOriginSubsidy
 	return f
 }
 
@@ -588,6 +599,7 @@ func (b *Builder) NewInvoiceFlow(acc *model.Account, amount int64, id model.OpRe
 	f.Kind = model.FlowKindBalance
 	f.Type = model.FlowTypeInvoice
 	f.AmountIn = amount
+	f.Origin = model.FlowOriginMigration
 	return f
 }
 
@@ -596,5 +608,6 @@ func (b *Builder) NewAirdropFlow(acc *model.Account, amount int64, id model.OpRe
 	f.Kind = model.FlowKindBalance
 	f.Type = model.FlowTypeAirdrop
 	f.AmountIn = amount
+	f.Origin = model.FlowOriginMigration
 	return f
 }
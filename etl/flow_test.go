@@ -0,0 +1,159 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+func TestFeePayerBatch(t *testing.T) {
+	b := NewBuilder(nil, nil, false)
+	newAcc := func(id model.AccountID, fill byte) *model.Account {
+		acc := &model.Account{
+			RowId:   id,
+			Address: mavryk.NewAddress(mavryk.AddressTypeEd25519, bytes.Repeat([]byte{fill}, 20)),
+		}
+		b.accMap[id] = acc
+		b.accHashMap[b.accCache.AddressHashKey(acc.Address)] = acc
+		return acc
+	}
+	proposer := newAcc(1, 1)
+	sponsor := newAcc(2, 2)
+	sender := newAcc(3, 3)
+	b.block = &model.Block{Height: 100, Proposer: &model.Baker{Account: proposer}}
+
+	feesFrom := func(payer *model.Account, fee int64) rpc.BalanceUpdates {
+		return rpc.BalanceUpdates{
+			{Kind: "contract", Contract: payer.Address.String(), Change: -fee},
+			{Kind: "accumulator", Category: "block fees", Change: fee},
+		}
+	}
+
+	// op 1 is sent and paid by sponsor, op 2 is sent by sender but its
+	// fees are also paid by sponsor
+	batch := []struct {
+		src  *model.Account
+		fees rpc.BalanceUpdates
+	}{
+		{sponsor, feesFrom(sponsor, 1000)},
+		{sender, feesFrom(sponsor, 2000)},
+	}
+	for i, v := range batch {
+		id := model.OpRef{Kind: model.OpTypeTransaction, N: i, C: i}
+		flows, paid := b.NewFeeFlows(v.src, v.fees, id)
+		if len(flows) != 1 {
+			t.Fatalf("op %d: expected 1 fee flow, got %d", i, len(flows))
+		}
+		if got := flows[0].AccountId; got != sponsor.RowId {
+			t.Errorf("op %d: fee flow source %d, want payer %d", i, got, sponsor.RowId)
+		}
+		if paid != -v.fees[0].Change {
+			t.Errorf("op %d: fees paid %d, want %d", i, paid, -v.fees[0].Change)
+		}
+	}
+
+	// without a fee balance update the sender pays
+	if acc := b.FeePayer(sender, nil); acc != sender {
+		t.Errorf("expected sender as default payer, got %d", acc.RowId)
+	}
+}
+
+func TestSeedNonceFlows(t *testing.T) {
+	baker := &model.Account{RowId: 1}
+	proposer := &model.Account{RowId: 2}
+	for _, c := range []struct {
+		version int
+		bal     rpc.BalanceUpdates
+		acc     model.AccountID
+		kind    model.FlowKind
+		frozen  bool
+	}{
+		// pre-Ithaca rewards are frozen for the baker
+		{11, rpc.BalanceUpdates{{Kind: "freezer", Category: "rewards", Change: 125000}}, baker.RowId, model.FlowKindRewards, true},
+		// post-Ithaca rewards are paid to the proposer balance
+		{12, rpc.BalanceUpdates{
+			{Kind: "minted", Category: "nonce revelation rewards", Change: -125000},
+			{Kind: "contract", Change: 125000},
+		}, proposer.RowId, model.FlowKindBalance, false},
+	} {
+		b := NewBuilder(nil, nil, false)
+		b.block = &model.Block{
+			Height:   100,
+			Params:   &rpc.Params{Version: c.version},
+			Baker:    &model.Baker{Account: baker},
+			Proposer: &model.Baker{Account: proposer},
+		}
+		flows := b.NewSeedNonceFlows(c.bal, model.OpRef{Kind: model.OpTypeNonceRevelation})
+		if len(flows) != 1 {
+			t.Fatalf("v%d: expected 1 flow, got %d", c.version, len(flows))
+		}
+		f := flows[0]
+		if f.Type != model.FlowTypeNonceRevelation {
+			t.Errorf("v%d: flow type %s", c.version, f.Type)
+		}
+		if f.AccountId != c.acc || f.Kind != c.kind || f.IsFrozen != c.frozen {
+			t.Errorf("v%d: got account=%d kind=%s frozen=%t", c.version, f.AccountId, f.Kind, f.IsFrozen)
+		}
+		if f.AmountIn != 125000 {
+			t.Errorf("v%d: reward %d", c.version, f.AmountIn)
+		}
+		if len(b.block.Flows) != 1 {
+			t.Errorf("v%d: flow not added to block", c.version)
+		}
+	}
+}
+
+func TestImplicitFlowOrigin(t *testing.T) {
+	b := NewBuilder(nil, nil, false)
+	baker := &model.Account{
+		RowId:   1,
+		Address: mavryk.NewAddress(mavryk.AddressTypeEd25519, bytes.Repeat([]byte{1}, 20)),
+	}
+	b.accMap[baker.RowId] = baker
+	b.accHashMap[b.accCache.AddressHashKey(baker.Address)] = baker
+	addr := baker.Address.String()
+
+	// Ithaca migration freezes extra deposits, followed by a regular
+	// deposit from block application
+	b.block = &model.Block{
+		Height: 100,
+		Params: &rpc.Params{Version: 12},
+		MV: &rpc.Bundle{Block: &rpc.Block{Metadata: rpc.BlockMetadata{
+			BalanceUpdates: rpc.BalanceUpdates{
+				{Kind: "contract", Contract: addr, Origin: "migration", Change: -6000},
+				{Kind: "freezer", Category: "deposits", Delegate: addr, Origin: "migration", Change: 6000},
+				{Kind: "contract", Contract: addr, Origin: "block", Change: -100},
+				{Kind: "freezer", Category: "deposits", Delegate: addr, Change: 100},
+			},
+		}}},
+	}
+	flows := b.NewImplicitFlows()
+	want := []struct {
+		kind   model.FlowKind
+		amount int64
+		origin model.FlowOrigin
+	}{
+		{model.FlowKindBalance, -6000, model.FlowOriginMigration},
+		{model.FlowKindDeposits, 6000, model.FlowOriginMigration},
+		{model.FlowKindBalance, -100, model.FlowOriginBlock},
+		{model.FlowKindDeposits, 100, model.FlowOriginBlock},
+	}
+	if len(flows) != len(want) {
+		t.Fatalf("expected %d flows, got %d", len(want), len(flows))
+	}
+	for i, w := range want {
+		f := flows[i]
+		if got := f.AmountIn - f.AmountOut; f.Kind != w.kind || got != w.amount {
+			t.Errorf("flow %d: got kind=%s amount=%d, want kind=%s amount=%d", i, f.Kind, got, w.kind, w.amount)
+		}
+		if f.Origin != w.origin {
+			t.Errorf("flow %d: got origin %s, want %s", i, f.Origin, w.origin)
+		}
+	}
+}
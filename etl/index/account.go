@@ -58,6 +58,7 @@ func (idx *AccountIndex) Create(path, label string, opts interface{}) error {
 	for _, m := range []model.Model{
 		model.Account{},
 		model.Baker{},
+		model.BakerStatus{},
 	} {
 		key := m.TableKey()
 		fields, err := pack.Fields(m)
@@ -92,6 +93,22 @@ func (idx *AccountIndex) Init(path, label string, opts interface{}) error {
 		idx.tables[key] = table
 	}
 
+	// the baker status table was added later and is created on existing
+	// databases, status history starts at the current height
+	m := model.BakerStatus{}
+	key := m.TableKey()
+	fields, err := pack.Fields(m)
+	if err != nil {
+		idx.Close()
+		return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+	}
+	table, err := idx.db.CreateTableIfNotExists(key, fields, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+	if err != nil {
+		idx.Close()
+		return err
+	}
+	idx.tables[key] = table
+
 	return nil
 }
 
@@ -121,6 +138,7 @@ func (idx *AccountIndex) ConnectBlock(ctx context.Context, block *model.Block, b
 	accupd := make([]pack.Item, 0)
 	bkrupd := make([]pack.Item, 0)
 	bkrins := make([]pack.Item, 0)
+	statins := make([]pack.Item, 0)
 	// regular accounts
 	for _, acc := range builder.Accounts() {
 		if !acc.IsDirty {
@@ -138,11 +156,15 @@ func (idx *AccountIndex) ConnectBlock(ctx context.Context, block *model.Block, b
 		} else if bkr.IsDirty {
 			bkrupd = append(bkrupd, bkr)
 		}
+		if bkr.IsActive != bkr.WasActive {
+			statins = append(statins, model.NewBakerStatus(bkr, block))
+		}
 	}
 
 	// send to tables
 	accounts := idx.tables[model.AccountTableKey]
 	bakers := idx.tables[model.BakerTableKey]
+	status := idx.tables[model.BakerStatusTableKey]
 
 	if len(accupd) > 0 {
 		if err := accounts.Update(ctx, accupd); err != nil {
@@ -159,6 +181,11 @@ func (idx *AccountIndex) ConnectBlock(ctx context.Context, block *model.Block, b
 			return err
 		}
 	}
+	if len(statins) > 0 {
+		if err := status.Insert(ctx, statins); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -226,7 +253,7 @@ func (idx *AccountIndex) DisconnectBlock(ctx context.Context, block *model.Block
 			return err
 		}
 	}
-	return nil
+	return idx.deleteBakerStatus(ctx, block.Height)
 }
 
 func (idx *AccountIndex) DeleteBlock(ctx context.Context, height int64) error {
@@ -244,6 +271,17 @@ func (idx *AccountIndex) DeleteBlock(ctx context.Context, height int64) error {
 		WithTable(bakers).
 		AndEqual("baker_since", height).
 		Delete(ctx)
+	if err != nil {
+		return err
+	}
+	return idx.deleteBakerStatus(ctx, height)
+}
+
+func (idx *AccountIndex) deleteBakerStatus(ctx context.Context, height int64) error {
+	_, err := pack.NewQuery("etl.delete").
+		WithTable(idx.tables[model.BakerStatusTableKey]).
+		AndEqual("height", height).
+		Delete(ctx)
 	return err
 }
 
@@ -0,0 +1,260 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"blockwatch.cc/packdb/pack"
+)
+
+type AuditAction string
+
+const (
+	AuditInsert AuditAction = "insert"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+
+	auditLogSuffix = "_audit.json"
+)
+
+// AuditEntry is a single row mutation. Sequence numbers are strictly
+// increasing across restarts. Entries written while a block is rolled back
+// are flagged so consumers can treat them as compensating mutations.
+type AuditEntry struct {
+	Seq      uint64          `json:"seq"`
+	Height   int64           `json:"height"`
+	Table    string          `json:"table"`
+	Action   AuditAction     `json:"action"`
+	RowId    uint64          `json:"row_id"`
+	Rollback bool            `json:"rollback,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"` // row after insert/update
+}
+
+// auditLog appends row mutations of an index to a JSON lines file. All
+// methods are safe to call on a nil log, in which case they only perform
+// the table operation.
+type auditLog struct {
+	sync.Mutex
+	f        *os.File
+	w        *bufio.Writer
+	seq      uint64
+	height   int64
+	rollback bool
+}
+
+func openAuditLog(dir, key string) (*auditLog, error) {
+	path := filepath.Join(dir, key+auditLogSuffix)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	l := &auditLog{f: f, w: bufio.NewWriter(f)}
+	line, off, err := lastLine(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	var e AuditEntry
+	if len(line) > 0 && json.Unmarshal(line, &e) != nil {
+		// a crash while writing leaves a torn last line, drop it and
+		// continue the sequence from the line before
+		log.Warnf("Audit log %s: dropping unparsable trailing line at offset %d", path, off)
+		if err := f.Truncate(off); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("truncating audit log: %w", err)
+		}
+		line, _, err = lastLine(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("reading audit log: %w", err)
+		}
+		if len(line) > 0 {
+			if err := json.Unmarshal(line, &e); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("decoding audit log tail: %w", err)
+			}
+		}
+	}
+	l.seq = e.Seq
+	return l, nil
+}
+
+// lastLine returns the last line of f by reading backwards and the offset
+// where it starts.
+func lastLine(f *os.File) ([]byte, int64, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	var (
+		buf  []byte
+		pos  = st.Size()
+		page = int64(4096)
+	)
+	for pos > 0 {
+		n := min(page, pos)
+		pos -= n
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		buf = append(chunk, buf...)
+		trimmed := bytes.TrimRight(buf, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], pos + int64(i) + 1, nil
+		}
+	}
+	return bytes.TrimRight(buf, "\n"), 0, nil
+}
+
+// begin sets the block height and rollback state for subsequent entries.
+func (l *auditLog) begin(height int64, rollback bool) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	l.height, l.rollback = height, rollback
+	l.Unlock()
+}
+
+func (l *auditLog) insert(ctx context.Context, t *pack.Table, val any) error {
+	if err := t.Insert(ctx, val); err != nil {
+		return err
+	}
+	return l.recordItems(t.Name(), AuditInsert, val)
+}
+
+func (l *auditLog) update(ctx context.Context, t *pack.Table, val any) error {
+	if err := t.Update(ctx, val); err != nil {
+		return err
+	}
+	return l.recordItems(t.Name(), AuditUpdate, val)
+}
+
+func (l *auditLog) deleteIds(ctx context.Context, t *pack.Table, ids []uint64) error {
+	if err := t.DeleteIds(ctx, ids); err != nil {
+		return err
+	}
+	if l == nil {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	for _, id := range ids {
+		if err := l.write(t.Name(), AuditDelete, id, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete removes all rows matching q. With auditing enabled matching row
+// ids are resolved first so that each deleted row is logged.
+func (l *auditLog) delete(ctx context.Context, t *pack.Table, q pack.Query) error {
+	if l == nil {
+		_, err := q.WithTable(t).Delete(ctx)
+		return err
+	}
+	ids := make([]uint64, 0)
+	err := q.WithTable(t).Stream(ctx, func(r pack.Row) error {
+		ids = append(ids, r.Result().PkColumn()[r.N()])
+		return nil
+	})
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return l.deleteIds(ctx, t, ids)
+}
+
+// packItems converts a typed row list for use with insert and update.
+func packItems[T pack.Item](list []T) []pack.Item {
+	items := make([]pack.Item, len(list))
+	for i := range list {
+		items[i] = list[i]
+	}
+	return items
+}
+
+func (l *auditLog) recordItems(table string, action AuditAction, val any) error {
+	if l == nil {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	if item, ok := val.(pack.Item); ok {
+		return l.writeItem(table, action, item)
+	}
+	v := reflect.Indirect(reflect.ValueOf(val))
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("audit: unsupported value type %T", val)
+	}
+	for i := 0; i < v.Len(); i++ {
+		item, ok := v.Index(i).Interface().(pack.Item)
+		if !ok {
+			return fmt.Errorf("audit: unsupported item type %s", v.Index(i).Type())
+		}
+		if err := l.writeItem(table, action, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *auditLog) writeItem(table string, action AuditAction, item pack.Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("audit: encoding %s row %d: %w", table, item.ID(), err)
+	}
+	return l.write(table, action, item.ID(), data)
+}
+
+func (l *auditLog) write(table string, action AuditAction, id uint64, data []byte) error {
+	l.seq++
+	buf, err := json.Marshal(AuditEntry{
+		Seq:      l.seq,
+		Height:   l.height,
+		Table:    table,
+		Action:   action,
+		RowId:    id,
+		Rollback: l.rollback,
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = l.w.Write(append(buf, '\n'))
+	return err
+}
+
+func (l *auditLog) flush() error {
+	if l == nil {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+func (l *auditLog) close() error {
+	if l == nil {
+		return nil
+	}
+	if err := l.flush(); err != nil {
+		return err
+	}
+	return l.f.Close()
+}
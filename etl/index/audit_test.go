@@ -0,0 +1,132 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLogSequence(t *testing.T) {
+	dir := t.TempDir()
+	l, err := openAuditLog(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.begin(10, false)
+	for i := uint64(1); i <= 3; i++ {
+		if err := l.write("t", AuditInsert, i, []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// sequence continues after reopen
+	l, err = openAuditLog(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.begin(10, true)
+	if err := l.write("t", AuditDelete, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "test"+auditLogSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) {
+			t.Errorf("entry %d: seq %d", i, e.Seq)
+		}
+	}
+	if last := entries[3]; !last.Rollback || last.Action != AuditDelete {
+		t.Errorf("expected rollback delete, got %+v", last)
+	}
+
+	// disabled log is a no-op
+	var nl *auditLog
+	nl.begin(1, false)
+	if err := nl.flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditLogTornTail(t *testing.T) {
+	dir := t.TempDir()
+	l, err := openAuditLog(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.begin(10, false)
+	for i := uint64(1); i <= 2; i++ {
+		if err := l.write("t", AuditInsert, i, []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash in the middle of writing entry 3
+	path := filepath.Join(dir, "test"+auditLogSuffix)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"seq":3,"height":1`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// reopen drops the torn line and continues the sequence
+	l, err = openAuditLog(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.write("t", AuditInsert, 3, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seq []uint64
+	s := bufio.NewScanner(bytes.NewReader(buf))
+	for s.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("line %d: %v", len(seq)+1, err)
+		}
+		seq = append(seq, e.Seq)
+	}
+	if len(seq) != 3 || seq[2] != 3 {
+		t.Errorf("expected sequence 1..3, got %v", seq)
+	}
+}
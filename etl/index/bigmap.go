@@ -5,34 +5,95 @@ package index
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
+	"sync/atomic"
 
 	"blockwatch.cc/packdb/pack"
+	"github.com/echa/config"
 	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/mavryk-network/mvgo/mavryk"
 	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/cache"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/etl/task"
+	"github.com/mavryk-network/mvindex/rpc"
 )
 
 const BigmapIndexKey = "bigmap"
 
+var (
+	bigmapAllocRecoveries = expvar.NewInt("bigmap_alloc_recoveries")
+	bigmapCountRepairs    = expvar.NewInt("bigmap_count_repairs")
+)
+
+// AllocEvictFunc is called with the id and alloc of a bigmap that was evicted
+// from the alloc cache. It runs on the indexer's hot path and must not block.
+type AllocEvictFunc func(id int64, alloc *model.BigmapAlloc)
+
 type BigmapIndex struct {
 	db         *pack.DB
 	tables     map[string]*pack.Table
 	allocCache *lru.Cache[int64, *model.BigmapAlloc] // cache bigmap allocs (for fast type access)
+	scripts    *cache.BigmapScriptCache              // cache storage bigmap types (for alloc type matching)
+	onEvict    atomic.Pointer[AllocEvictFunc]        // optional alloc cache eviction hook
+	anomalies  bigmapAnomalyLog                      // recent rollback anomalies
+	indexRefs  bool                                  // index addresses embedded in keys and values
+	strict     bool                                  // fail on conflicting allocs within a block and missing allocs
+	auditLog   bool                                  // log all table mutations
+	audit      *auditLog                             // mutation log, nil when disabled
+	checkpoint bigmapCheckpointer                    // background history checkpoints
 }
 
 var _ model.BlockIndexer = (*BigmapIndex)(nil)
 
 func NewBigmapIndex() *BigmapIndex {
-	ac, _ := lru.New[int64, *model.BigmapAlloc](1 << 15) // 32k
-	return &BigmapIndex{
-		tables:     make(map[string]*pack.Table),
-		allocCache: ac,
+	idx := &BigmapIndex{
+		tables: make(map[string]*pack.Table),
+	}
+	idx.anomalies.persist = config.GetBool("bigmap.persist_anomalies")
+	idx.indexRefs = config.GetBool("bigmap.index_addresses")
+	idx.strict = config.GetBool("bigmap.strict_allocs")
+	idx.auditLog = config.GetBool("bigmap.audit_log")
+	idx.checkpoint.interval = config.GetInt64("bigmap.checkpoint_interval")
+	idx.checkpoint.index = cache.NewBigmapCheckpointIndex(bigmapCheckpointIndexSize)
+	idx.allocCache = idx.newAllocCache(1 << 15) // 32k
+	idx.scripts = cache.NewBigmapScriptCache(config.GetInt("bigmap.script_cache_size"))
+	return idx
+}
+
+func (idx *BigmapIndex) newAllocCache(size int) *lru.Cache[int64, *model.BigmapAlloc] {
+	ac, _ := lru.NewWithEvict[int64, *model.BigmapAlloc](size, idx.evictAlloc)
+	return ac
+}
+
+func (idx *BigmapIndex) evictAlloc(id int64, alloc *model.BigmapAlloc) {
+	if fn := idx.onEvict.Load(); fn != nil {
+		(*fn)(id, alloc)
 	}
 }
 
+// OnAllocEvict installs an optional callback that fires whenever a bigmap
+// alloc is evicted from the alloc cache, e.g. to push hot allocs into a
+// shared second-level cache. The callback also fires for every cached alloc
+// when the cache is purged on reorg, treat these calls as invalidations.
+// The callback is invoked outside the cache lock but on the indexer's hot
+// path, so it must not block. Pass nil to remove a callback.
+func (idx *BigmapIndex) OnAllocEvict(fn AllocEvictFunc) {
+	if fn == nil {
+		idx.onEvict.Store(nil)
+		return
+	}
+	idx.onEvict.Store(&fn)
+}
+
+// ScriptCacheStats returns statistics of the storage bigmap type cache.
+func (idx *BigmapIndex) ScriptCacheStats() cache.Stats {
+	return idx.scripts.Stats()
+}
+
 func (idx *BigmapIndex) DB() *pack.DB {
 	return idx.db
 }
@@ -60,11 +121,15 @@ func (idx *BigmapIndex) Create(path, label string, opts interface{}) error {
 	}
 	defer db.Close()
 
-	for _, m := range []model.Model{
+	models := []model.Model{
 		model.BigmapAlloc{},
 		model.BigmapUpdate{},
 		model.BigmapValue{},
-	} {
+	}
+	if idx.indexRefs {
+		models = append(models, model.BigmapRef{})
+	}
+	for _, m := range models {
 		key := m.TableKey()
 		fields, err := pack.Fields(m)
 		if err != nil {
@@ -91,13 +156,57 @@ func (idx *BigmapIndex) Init(path, label string, opts interface{}) error {
 		model.BigmapUpdate{},
 		model.BigmapValue{},
 	} {
+		t, err := openTable(idx.db, m)
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[m.TableKey()] = t
+	}
+
+	// the address ref table is optional and may be enabled on existing databases
+	if idx.indexRefs {
+		m := model.BigmapRef{}
+		key := m.TableKey()
+		fields, err := pack.Fields(m)
+		if err != nil {
+			idx.Close()
+			return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+		}
+		t, err := idx.db.CreateTableIfNotExists(key, fields, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[key] = t
+	}
+	// checkpoints are optional, an existing table is kept consistent on
+	// rollback even when writing new checkpoints is disabled
+	if idx.checkpoint.interval > 0 {
+		m := model.BigmapCheckpoint{}
 		key := m.TableKey()
-		t, err := idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+		fields, err := pack.Fields(m)
+		if err != nil {
+			idx.Close()
+			return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+		}
+		t, err := idx.db.CreateTableIfNotExists(key, fields, m.TableOpts().Merge(model.ReadConfigOpts(key)))
 		if err != nil {
 			idx.Close()
 			return err
 		}
 		idx.tables[key] = t
+		idx.checkpoint.start(t, idx.tables[model.BigmapUpdateTableKey])
+	} else if t, err := openTable(idx.db, model.BigmapCheckpoint{}); err == nil {
+		idx.tables[t.Name()] = t
+	}
+	idx.anomalies.init(path)
+	if idx.auditLog {
+		idx.audit, err = openAuditLog(path, idx.Key())
+		if err != nil {
+			idx.Close()
+			return err
+		}
 	}
 	return nil
 }
@@ -107,12 +216,17 @@ func (idx *BigmapIndex) FinalizeSync(_ context.Context) error {
 }
 
 func (idx *BigmapIndex) Close() error {
+	idx.checkpoint.stop()
 	for n, v := range idx.tables {
 		if err := v.Close(); err != nil {
 			log.Errorf("Closing %s table: %s", v.Name(), err)
 		}
 		delete(idx.tables, n)
 	}
+	if err := idx.audit.close(); err != nil {
+		log.Errorf("Closing %s audit log: %v", idx.Key(), err)
+	}
+	idx.audit = nil
 	if idx.db != nil {
 		if err := idx.db.Close(); err != nil {
 			return err
@@ -149,17 +263,132 @@ func (idx *BigmapIndex) loadAlloc(ctx context.Context, id int64) (*model.BigmapA
 	if err != nil {
 		return nil, fmt.Errorf("etl.bigmap.alloc decode: %v", err)
 	}
+	if alloc.RowId == 0 {
+		return nil, fmt.Errorf("bigmap %d: %w", id, model.ErrNoBigmapAlloc)
+	}
+	idx.allocCache.Add(id, alloc)
+	return alloc, nil
+}
+
+// loadOrRecoverAlloc loads the alloc of a bigmap that is updated by op. When
+// the alloc is missing (e.g. after a pruned or corrupt range) strict mode
+// fails. Otherwise a minimal alloc is synthesized from existing live keys
+// and updates so indexing can continue. Recovered allocs have no type
+// information.
+func (idx *BigmapIndex) loadOrRecoverAlloc(ctx context.Context, id int64, op *model.Op) (*model.BigmapAlloc, error) {
+	alloc, err := idx.loadAlloc(ctx, id)
+	if err == nil || idx.strict || !errors.Is(err, model.ErrNoBigmapAlloc) {
+		return alloc, err
+	}
+	log.Warnf("bigmap: recovering missing alloc for bigmap %d at block %d op %s", id, op.Height, op.Hash)
+
+	alloc = &model.BigmapAlloc{
+		BigmapId:  id,
+		AccountId: op.ReceiverId,
+		Height:    op.Height,
+		Updated:   op.Height,
+	}
+	alloc.NKeys, err = pack.NewQuery("etl.recover_alloc").
+		WithTable(idx.tables[model.BigmapValueTableKey]).
+		AndEqual("bigmap_id", id).
+		Count(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("etl.bigmap.recover: %v", err)
+	}
+	alloc.NUpdates, err = pack.NewQuery("etl.recover_alloc").
+		WithTable(idx.tables[model.BigmapUpdateTableKey]).
+		AndEqual("bigmap_id", id).
+		Count(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("etl.bigmap.recover: %v", err)
+	}
+	if err := idx.audit.insert(ctx, idx.tables[model.BigmapAllocTableKey], alloc); err != nil {
+		return nil, fmt.Errorf("etl.bigmap.recover: %v", err)
+	}
+	bigmapAllocRecoveries.Add(1)
 	idx.allocCache.Add(id, alloc)
 	return alloc, nil
 }
 
+// RepairCounts recomputes the number of live keys of bigmap id from the
+// value table and corrects alloc.NKeys when it has drifted, e.g. after an
+// incomplete rollback. It returns true when a correction was made. Callers
+// must ensure no block is connected or disconnected concurrently.
+func (idx *BigmapIndex) RepairCounts(ctx context.Context, id int64) (bool, error) {
+	alloc, err := idx.loadAlloc(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := pack.NewQuery("etl.repair_counts").
+		WithTable(idx.tables[model.BigmapValueTableKey]).
+		WithoutCache().
+		AndEqual("bigmap_id", id).
+		Count(ctx)
+	if err != nil {
+		return false, fmt.Errorf("etl.bigmap.repair: %v", err)
+	}
+	if n == alloc.NKeys {
+		return false, nil
+	}
+	log.Warnf("bigmap: repairing key count of bigmap %d from %d to %d", id, alloc.NKeys, n)
+	alloc.NKeys = n
+	if err := idx.audit.update(ctx, idx.tables[model.BigmapAllocTableKey], alloc); err != nil {
+		return false, fmt.Errorf("etl.bigmap.repair: %v", err)
+	}
+	bigmapCountRepairs.Add(1)
+	return true, nil
+}
+
+// checkAllocConflicts returns an error when more than one alloc or copy in a
+// block claims the same real bigmap id. This should never happen and points to
+// inconsistent node data. Temporary (negative) ids are reused across operations
+// and are not checked.
+func checkAllocConflicts(block *model.Block) error {
+	seen := make(map[int64]mavryk.OpHash)
+	for _, op := range block.Ops {
+		if !op.IsSuccess {
+			continue
+		}
+		for _, diff := range op.BigmapEvents {
+			var id int64
+			switch diff.Action {
+			case micheline.DiffActionAlloc:
+				id = diff.Id
+			case micheline.DiffActionCopy:
+				id = diff.DestId
+			default:
+				continue
+			}
+			if id < 0 {
+				continue
+			}
+			if prev, ok := seen[id]; ok {
+				return fmt.Errorf("bigmap %d allocated twice in block %d by %s and %s",
+					id, block.Height, prev, op.Hash)
+			}
+			seen[id] = op.Hash
+		}
+	}
+	return nil
+}
+
 // assumes op ids are already set (must run after OpIndex)
 func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, builder model.BlockBuilder) error {
+	if err := checkAllocConflicts(block); err != nil {
+		if idx.strict {
+			return fmt.Errorf("etl.bigmap: %w", err)
+		}
+		log.Warnf("bigmap: %v", err)
+	}
+
+	idx.audit.begin(block.Height, false)
 	allocTable := idx.tables[model.BigmapAllocTableKey]
 	updateTable := idx.tables[model.BigmapUpdateTableKey]
 	valueTable := idx.tables[model.BigmapValueTableKey]
 
 	tmp := make(map[int64]*InMemoryBigmap)
+	refs := make([]pack.Item, 0)
+	due := make([]*model.BigmapAlloc, 0)
 	for _, op := range block.Ops {
 		// reset temp bigmap after a batch of internal ops has been processed
 		if !op.IsInternal && len(tmp) > 0 {
@@ -180,27 +409,15 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 				// post Jakarta v013, bitmap allocs no longer contain type annotations
 				// so we must lookup the correct bigmap type from script (exclude copies)
 				if block.Params.Version >= 13 && diff.Id > 0 {
-					script, err := op.Contract.LoadScript()
+					types, err := idx.scripts.Load(op.Contract)
 					if err != nil {
 						return fmt.Errorf("etl.bigmap_alloc.load_type: %v", err)
 					}
-					var matchFound bool
 					// compare the allocated bigmap type with annotated type in storage
-					// using converted typedef to match comb and tree type pairs
-					kt := micheline.NewType(diff.KeyType).Typedef("").Unfold()
-					vt := micheline.NewType(diff.ValueType).Typedef("").Unfold()
-					for _, btyp := range script.BigmapTypes() {
-						if !btyp.Left().Typedef("").Unfold().Equal(kt) {
-							continue
-						}
-						if !btyp.Right().Typedef("").Unfold().Equal(vt) {
-							continue
-						}
-						// overwrite type in bigmap diff with annotated type from script
-						diff.KeyType = btyp.Left().Prim.Clone()
-						diff.ValueType = btyp.Right().Prim.Clone()
-						matchFound = true
-						break
+					// and overwrite type in bigmap diff with annotated type from script
+					kt, vt, matchFound := types.Match(diff.KeyType, diff.ValueType)
+					if matchFound {
+						diff.KeyType, diff.ValueType = kt, vt
 					}
 					if !matchFound {
 						log.Errorf("No type match found for bigmap %d in %s for script %s",
@@ -219,14 +436,14 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 				} else {
 					// alloc real bigmap
 					alloc := model.NewBigmapAlloc(op, diff)
-					if err := allocTable.Insert(ctx, alloc); err != nil {
+					if err := idx.audit.insert(ctx, allocTable, alloc); err != nil {
 						return fmt.Errorf("etl.bigmap_alloc.insert: %v", err)
 					}
 					idx.allocCache.Add(alloc.BigmapId, alloc)
 					// log.Debugf("Bigmap type %d stored as id %d", alloc.BigmapId, alloc.RowId)
 
 					// store as update
-					if err := updateTable.Insert(ctx, alloc.ToUpdate(op)); err != nil {
+					if err := idx.audit.insert(ctx, updateTable, alloc.ToUpdate(op)); err != nil {
 						return fmt.Errorf("etl.bigmap_alloc.insert: %v", err)
 					}
 				}
@@ -307,11 +524,17 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 					bm.Updates = updates
 					bm.Live = live
 					tmp[diff.DestId] = bm
+
+					// keep the copy record to resolve provenance of bigmaps
+					// copied from this temp bigmap
+					if err := idx.audit.insert(ctx, updateTable, updates[0]); err != nil {
+						return fmt.Errorf("etl.bigmap.insert: %v", err)
+					}
 					// log.Debugf("Bigmap %s %d: store new temp map %d with %d live keys",
 					// 	diff.Action, diff.SourceId, bm.Alloc.BigmapId, len(live))
 				} else {
 					// store copied data
-					if err := allocTable.Insert(ctx, alloc); err != nil {
+					if err := idx.audit.insert(ctx, allocTable, alloc); err != nil {
 						return fmt.Errorf("etl.bigmap.insert: %v", err)
 					}
 					idx.allocCache.Add(alloc.BigmapId, alloc)
@@ -319,14 +542,14 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 					for i, v := range live {
 						ins[i] = v
 					}
-					if err := valueTable.Insert(ctx, ins); err != nil {
+					if err := idx.audit.insert(ctx, valueTable, ins); err != nil {
 						return fmt.Errorf("etl.bigmap.insert: %v", err)
 					}
 					ins = ins[:0]
 					for _, v := range updates {
 						ins = append(ins, v)
 					}
-					if err := updateTable.Insert(ctx, ins); err != nil {
+					if err := idx.audit.insert(ctx, updateTable, ins); err != nil {
 						return fmt.Errorf("etl.bigmap.insert: %v", err)
 					}
 					// log.Debugf("Bigmap %s %d: store new map %d with %d live keys",
@@ -341,7 +564,7 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 						bm := tmp[diff.Id]
 						delete(tmp, diff.Id)
 						if bm.Alloc != nil {
-							if err := updateTable.Insert(ctx, bm.Alloc.ToRemove(op)); err != nil {
+							if err := idx.audit.insert(ctx, updateTable, bm.Alloc.ToRemove(op)); err != nil {
 								return fmt.Errorf("etl.bigmap.empty: %v", err)
 							}
 						}
@@ -351,7 +574,7 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 					}
 
 					// for regular bigmaps, update alloc
-					alloc, err := idx.loadAlloc(ctx, diff.Id)
+					alloc, err := idx.loadOrRecoverAlloc(ctx, diff.Id, op)
 					if err != nil {
 						return fmt.Errorf("etl.bigmap.empty: %v", err)
 					}
@@ -380,17 +603,17 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 					alloc.Deleted = op.Height
 
 					// add bigmap remove at end
-					if err := updateTable.Insert(ctx, alloc.ToRemove(op)); err != nil {
+					if err := idx.audit.insert(ctx, updateTable, alloc.ToRemove(op)); err != nil {
 						return fmt.Errorf("etl.bigmap.empty: %v", err)
 					}
 
-					if err := allocTable.Update(ctx, alloc); err != nil {
+					if err := idx.audit.update(ctx, allocTable, alloc); err != nil {
 						return fmt.Errorf("etl.bigmap.empty: %v", err)
 					}
-					if err := updateTable.Insert(ctx, updates); err != nil {
+					if err := idx.audit.insert(ctx, updateTable, updates); err != nil {
 						return fmt.Errorf("etl.bigmap.empty: %v", err)
 					}
-					if err := valueTable.DeleteIds(ctx, ids); err != nil {
+					if err := idx.audit.deleteIds(ctx, valueTable, ids); err != nil {
 						return fmt.Errorf("etl.bigmap.empty: %v", err)
 					}
 
@@ -417,7 +640,7 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 					}
 					if pos > -1 {
 						// add remove action
-						if err := updateTable.Insert(ctx, bm.Live[pos].ToUpdateRemove(op)); err != nil {
+						if err := idx.audit.insert(ctx, updateTable, bm.Live[pos].ToUpdateRemove(op)); err != nil {
 							return fmt.Errorf("etl.bigmap.empty: %v", err)
 						}
 						bm.Alloc.NKeys--
@@ -442,7 +665,7 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 				}
 
 				// single key removal from regular bigmap
-				alloc, err := idx.loadAlloc(ctx, diff.Id)
+				alloc, err := idx.loadOrRecoverAlloc(ctx, diff.Id, op)
 				if err != nil {
 					return fmt.Errorf("etl.bigmap.remove: %v", err)
 				}
@@ -473,7 +696,7 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 				if prev != nil {
 					// log.Debugf("Bigmap %s %d: remove single key from map %d with %d live keys",
 					// 	diff.Action, diff.Id, alloc.BigmapId, alloc.NKeys)
-					if err := valueTable.DeleteIds(ctx, []uint64{prev.RowId}); err != nil {
+					if err := idx.audit.deleteIds(ctx, valueTable, []uint64{prev.RowId}); err != nil {
 						return fmt.Errorf("etl.bigmap.remove: %v", err)
 					}
 					alloc.NKeys--
@@ -484,10 +707,10 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 				}
 				alloc.Updated = op.Height
 				alloc.NUpdates++
-				if err := updateTable.Insert(ctx, model.NewBigmapUpdate(op, diff)); err != nil {
+				if err := idx.audit.insert(ctx, updateTable, model.NewBigmapUpdate(op, diff)); err != nil {
 					return fmt.Errorf("etl.bigmap.remove: %v", err)
 				}
-				if err := allocTable.Update(ctx, alloc); err != nil {
+				if err := idx.audit.update(ctx, allocTable, alloc); err != nil {
 					return fmt.Errorf("etl.bigmap.remove: %v", err)
 				}
 
@@ -529,7 +752,7 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 					}
 
 					// insert to update table
-					if err := updateTable.Insert(ctx, bm.Updates[len(bm.Updates)-1]); err != nil {
+					if err := idx.audit.insert(ctx, updateTable, bm.Updates[len(bm.Updates)-1]); err != nil {
 						return fmt.Errorf("etl.bigmap.update: %v", err)
 					}
 
@@ -538,7 +761,7 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 				}
 
 				// regular bigmaps
-				alloc, err := idx.loadAlloc(ctx, diff.Id)
+				alloc, err := idx.loadOrRecoverAlloc(ctx, diff.Id, op)
 				if err != nil {
 					return fmt.Errorf("etl.bigmap.update: load alloc: %v", err)
 				}
@@ -570,14 +793,14 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 				if prev != nil {
 					// replace
 					live.RowId = prev.RowId
-					if err := valueTable.Update(ctx, live); err != nil {
+					if err := idx.audit.update(ctx, valueTable, live); err != nil {
 						return fmt.Errorf("etl.bigmap.replace: %v", err)
 					}
 					// log.Debugf("Bigmap %s %d: replace key in map %d with %d live keys",
 					// 	diff.Action, diff.Id, alloc.BigmapId, alloc.NKeys)
 				} else {
 					// add
-					if err := valueTable.Insert(ctx, live); err != nil {
+					if err := idx.audit.insert(ctx, valueTable, live); err != nil {
 						return fmt.Errorf("etl.bigmap.insert: %v", err)
 					}
 					alloc.NKeys++
@@ -586,26 +809,76 @@ func (idx *BigmapIndex) ConnectBlock(ctx context.Context, block *model.Block, bu
 				}
 				alloc.Updated = op.Height
 				alloc.NUpdates++
+				if idx.checkpoint.isDue(alloc) {
+					due = append(due, alloc)
+				}
 
-				if err := updateTable.Insert(ctx, model.NewBigmapUpdate(op, diff)); err != nil {
+				if err := idx.audit.insert(ctx, updateTable, model.NewBigmapUpdate(op, diff)); err != nil {
 					return fmt.Errorf("etl.bigmap.update: insert into %d: %v", alloc.BigmapId, err)
 				}
-				if err := allocTable.Update(ctx, alloc); err != nil {
+				if idx.indexRefs {
+					refs = idx.appendRefs(refs, builder, diff, op.Height)
+				}
+				if err := idx.audit.update(ctx, allocTable, alloc); err != nil {
 					return fmt.Errorf("etl.bigmap.update: update alloc %d: %v -- diff=%#v", diff.Id, err, diff)
 				}
 			}
 		}
 	}
 
+	if len(refs) > 0 {
+		if err := idx.audit.insert(ctx, idx.tables[model.BigmapRefTableKey], refs); err != nil {
+			return fmt.Errorf("etl.bigmap.refs: %v", err)
+		}
+	}
+
+	// all updates of this block are written, checkpoint hot bigmaps
+	for _, alloc := range due {
+		idx.checkpoint.queue(alloc.BigmapId, block.Height, alloc.NUpdates)
+	}
+
 	return nil
 }
 
+// appendRefs links all known accounts whose address is embedded in the
+// key or value of a bigmap update. Accounts are registered by the builder
+// when it collects embedded addresses from operation receipts.
+func (idx *BigmapIndex) appendRefs(refs []pack.Item, builder model.BlockBuilder, diff micheline.BigmapEvent, height int64) []pack.Item {
+	keyId := model.GetKeyId(diff.Id, diff.KeyHash)
+	seen := make(map[model.AccountID]struct{})
+	collect := rpc.EmbeddedAddressWalker(func(a mavryk.Address) {
+		acc, ok := builder.AccountByAddress(a)
+		if !ok {
+			return
+		}
+		if _, ok := seen[acc.RowId]; ok {
+			return
+		}
+		seen[acc.RowId] = struct{}{}
+		refs = append(refs, &model.BigmapRef{
+			AccountId: acc.RowId,
+			BigmapId:  diff.Id,
+			KeyId:     keyId,
+			Height:    height,
+		})
+	})
+	for _, p := range []micheline.Prim{diff.Key, diff.Value} {
+		if p.IsPacked() {
+			p, _ = p.Unpack()
+		}
+		_ = p.Walk(collect)
+	}
+	return refs
+}
+
 func (idx *BigmapIndex) DisconnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
 	idx.allocCache.Purge()
+	idx.scripts.Purge()
 	return idx.DeleteBlock(ctx, block.Height)
 }
 
 func (idx *BigmapIndex) DeleteBlock(ctx context.Context, height int64) error {
+	idx.audit.begin(height, true)
 	allocTable := idx.tables[model.BigmapAllocTableKey]
 	updateTable := idx.tables[model.BigmapUpdateTableKey]
 	valueTable := idx.tables[model.BigmapValueTableKey]
@@ -626,6 +899,11 @@ func (idx *BigmapIndex) DeleteBlock(ctx context.Context, height int64) error {
 
 	// identify list of updated keys
 	for _, v := range updates {
+		// temp bigmaps have no alloc and no live keys, their updates
+		// are removed below
+		if v.BigmapId < 0 {
+			continue
+		}
 		hash := v.GetKeyHash()
 		key := model.GetKeyId(v.BigmapId, hash)
 
@@ -674,18 +952,20 @@ func (idx *BigmapIndex) DeleteBlock(ctx context.Context, height int64) error {
 			// sanity checks
 			if prev == nil {
 				log.Warnf("rollback: missing previous update for bigmap %d key %s", v.BigmapId, v.GetKeyHash())
+				idx.recordAnomaly(BigmapAnomalyMissingPrev, v.BigmapId, hash, height)
 				continue
 			}
 			if prev.Action != micheline.DiffActionUpdate {
 				// just skip if this was a double remove
 				alloc.NUpdates--
 				log.Debugf("rollback: unexpected prev action %s update for bigmap %d key %s", prev.Action, v.BigmapId, v.GetKeyHash())
+				idx.recordAnomaly(BigmapAnomalyDoubleRemove, v.BigmapId, hash, height)
 			} else {
 				// this was a remove after update, insert previous live key
 				live = prev.ToKV()
 				alloc.NKeys++
 				alloc.NUpdates--
-				if err := valueTable.Insert(ctx, live); err != nil {
+				if err := idx.audit.insert(ctx, valueTable, live); err != nil {
 					return fmt.Errorf("etl.bigmap.rollback insert live key: %v", err)
 				}
 			}
@@ -719,11 +999,12 @@ func (idx *BigmapIndex) DeleteBlock(ctx context.Context, height int64) error {
 				// sanity check
 				if live == nil {
 					log.Warnf("rollback: missing live key in bigmap %d key %s", v.BigmapId, v.GetKeyHash())
+					idx.recordAnomaly(BigmapAnomalyMissingLive, v.BigmapId, hash, height)
 					continue
 				}
 
 				// this was a first-time insert, delete current live key
-				if err := valueTable.DeleteIds(ctx, []uint64{live.RowId}); err != nil {
+				if err := idx.audit.deleteIds(ctx, valueTable, []uint64{live.RowId}); err != nil {
 					return fmt.Errorf("etl.bigmap.rollback delete live key: %v", err)
 				}
 				alloc.NKeys--
@@ -735,7 +1016,7 @@ func (idx *BigmapIndex) DeleteBlock(ctx context.Context, height int64) error {
 			} else {
 				if prev.Action == micheline.DiffActionRemove {
 					// this was an insert after remove, remove current live key
-					if err := valueTable.DeleteIds(ctx, []uint64{live.RowId}); err != nil {
+					if err := idx.audit.deleteIds(ctx, valueTable, []uint64{live.RowId}); err != nil {
 						return fmt.Errorf("etl.bigmap.rollback delete live key: %v", err)
 					}
 					alloc.NKeys--
@@ -750,7 +1031,7 @@ func (idx *BigmapIndex) DeleteBlock(ctx context.Context, height int64) error {
 					// this was an update after update, replace current live key
 					lastLive := prev.ToKV()
 					lastLive.RowId = live.RowId
-					if err := valueTable.Update(ctx, lastLive); err != nil {
+					if err := idx.audit.update(ctx, valueTable, lastLive); err != nil {
 						return fmt.Errorf("etl.bigmap.rollback replace live key: %v", err)
 					}
 					alloc.NUpdates--
@@ -765,14 +1046,32 @@ func (idx *BigmapIndex) DeleteBlock(ctx context.Context, height int64) error {
 	}
 
 	// delete all updates at height
-	_, err = pack.NewQuery("etl.delete").
-		WithTable(updateTable).
-		AndEqual("height", height).
-		Delete(ctx)
+	err = idx.audit.delete(ctx, updateTable, pack.NewQuery("etl.delete").
+		AndEqual("height", height))
 	if err != nil {
 		return err
 	}
 
+	// delete all address refs at height
+	if refTable, ok := idx.tables[model.BigmapRefTableKey]; ok {
+		err = idx.audit.delete(ctx, refTable, pack.NewQuery("etl.delete").
+			AndEqual("height", height))
+		if err != nil {
+			return err
+		}
+	}
+
+	// delete checkpoints at and above height, pending ones are discarded
+	if cpTable, ok := idx.tables[model.BigmapCheckpointTableKey]; ok {
+		err = idx.checkpoint.rollback(func() error {
+			return idx.audit.delete(ctx, cpTable, pack.NewQuery("etl.delete").
+				AndGte("height", height))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	// update rolled back allocs
 	upd := make([]pack.Item, 0)
 	for _, v := range allocs {
@@ -781,15 +1080,13 @@ func (idx *BigmapIndex) DeleteBlock(ctx context.Context, height int64) error {
 		}
 		upd = append(upd, v)
 	}
-	if err := allocTable.Update(ctx, upd); err != nil {
+	if err := idx.audit.update(ctx, allocTable, upd); err != nil {
 		return err
 	}
 
 	// delete all allocs from this block
-	_, err = pack.NewQuery("etl.delete").
-		WithTable(allocTable).
-		AndEqual("h", height). // alloc height
-		Delete(ctx)
+	err = idx.audit.delete(ctx, allocTable, pack.NewQuery("etl.delete").
+		AndEqual("h", height)) // alloc height
 	if err != nil {
 		return err
 	}
@@ -807,6 +1104,9 @@ func (idx *BigmapIndex) Flush(ctx context.Context) error {
 			log.Errorf("Flushing %s table: %v", n, err)
 		}
 	}
+	if err := idx.audit.flush(); err != nil {
+		log.Errorf("Flushing %s audit log: %v", idx.Key(), err)
+	}
 	return nil
 }
 
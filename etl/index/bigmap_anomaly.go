@@ -0,0 +1,130 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"expvar"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+const (
+	BigmapAnomalyMissingPrev  = "missing_prev"  // remove without any previous update
+	BigmapAnomalyDoubleRemove = "double_remove" // remove after remove
+	BigmapAnomalyMissingLive  = "missing_live"  // first-time insert without live key
+
+	bigmapAnomalyFile    = "bigmap_anomalies.json"
+	bigmapAnomalyHistory = 256
+)
+
+var bigmapAnomalyCounter = expvar.NewMap("bigmap_rollback_anomalies")
+
+// BigmapAnomaly records an inconsistency found while rolling back bigmap
+// updates. Anomalies typically point to a mismatch between node and indexer
+// state and do not interrupt the rollback.
+type BigmapAnomaly struct {
+	BigmapId int64           `json:"bigmap_id"`
+	KeyHash  mavryk.ExprHash `json:"key_hash"`
+	Height   int64           `json:"height"`
+	Kind     string          `json:"kind"`
+	Time     time.Time       `json:"time"`
+}
+
+// bigmapAnomalyLog keeps a bounded history of recent rollback anomalies
+// and optionally appends each record to a JSON lines file so they survive
+// restarts.
+type bigmapAnomalyLog struct {
+	sync.Mutex
+	list    []BigmapAnomaly
+	count   int64
+	persist bool
+	path    string
+}
+
+func (l *bigmapAnomalyLog) init(dir string) {
+	l.Lock()
+	defer l.Unlock()
+	l.path = filepath.Join(dir, bigmapAnomalyFile)
+	if !l.persist {
+		return
+	}
+	f, err := os.Open(l.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("bigmap: reading anomaly log: %v", err)
+		}
+		return
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		var a BigmapAnomaly
+		if err := json.Unmarshal(scan.Bytes(), &a); err != nil {
+			log.Warnf("bigmap: decoding anomaly log: %v", err)
+			return
+		}
+		l.push(a)
+	}
+}
+
+func (l *bigmapAnomalyLog) add(a BigmapAnomaly) {
+	bigmapAnomalyCounter.Add(a.Kind, 1)
+	l.Lock()
+	defer l.Unlock()
+	l.count++
+	l.push(a)
+	if !l.persist || l.path == "" {
+		return
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Warnf("bigmap: writing anomaly log: %v", err)
+		return
+	}
+	defer f.Close()
+	buf, _ := json.Marshal(a)
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		log.Warnf("bigmap: writing anomaly log: %v", err)
+	}
+}
+
+func (l *bigmapAnomalyLog) push(a BigmapAnomaly) {
+	if len(l.list) >= bigmapAnomalyHistory {
+		copy(l.list, l.list[1:])
+		l.list = l.list[:len(l.list)-1]
+	}
+	l.list = append(l.list, a)
+}
+
+// RollbackAnomalies returns up to n most recent rollback anomalies, newest
+// first, and the total number of anomalies seen since the index was started.
+func (idx *BigmapIndex) RollbackAnomalies(n int) ([]BigmapAnomaly, int64) {
+	l := &idx.anomalies
+	l.Lock()
+	defer l.Unlock()
+	if n <= 0 || n > len(l.list) {
+		n = len(l.list)
+	}
+	res := make([]BigmapAnomaly, 0, n)
+	for i := len(l.list) - 1; i >= 0 && len(res) < n; i-- {
+		res = append(res, l.list[i])
+	}
+	return res, l.count
+}
+
+func (idx *BigmapIndex) recordAnomaly(kind string, id int64, key mavryk.ExprHash, height int64) {
+	idx.anomalies.add(BigmapAnomaly{
+		BigmapId: id,
+		KeyHash:  key,
+		Height:   height,
+		Kind:     kind,
+		Time:     time.Now().UTC(),
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"expvar"
+	"sync"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+const (
+	// max pending checkpoints, more are dropped until the next interval
+	bigmapCheckpointQueue = 256
+
+	// bigmaps with cached checkpoint lookups
+	bigmapCheckpointIndexSize = 1 << 14
+)
+
+var bigmapCheckpoints = expvar.NewInt("bigmap_checkpoints")
+
+type bigmapCheckpointReq struct {
+	id       int64
+	height   int64
+	nUpdates int64
+	gen      uint64
+}
+
+// bigmapCheckpointer writes bigmap history checkpoints in the background.
+// A checkpoint is due each time a bigmap's update counter reaches a
+// multiple of interval. It is built from the previous checkpoint after all
+// updates of the block are written. Replay reads updates in batches, so
+// the updates table is not locked while large bigmaps are checkpointed.
+// Rollbacks bump a generation counter so that checkpoints of rolled back
+// blocks are discarded.
+type bigmapCheckpointer struct {
+	interval int64 // updates between checkpoints, 0 = off
+	mu       sync.Mutex
+	gen      uint64
+	index    *cache.BigmapCheckpointIndex // checkpoint lookups, shared with API calls
+	table    *pack.Table
+	updates  *pack.Table
+	reqs     chan bigmapCheckpointReq
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func (c *bigmapCheckpointer) start(table, updates *pack.Table) {
+	c.table = table
+	c.updates = updates
+	c.reqs = make(chan bigmapCheckpointReq, bigmapCheckpointQueue)
+	c.done = make(chan struct{})
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.run()
+}
+
+func (c *bigmapCheckpointer) stop() {
+	if c.reqs == nil {
+		return
+	}
+	c.cancel()
+	close(c.reqs)
+	<-c.done
+	c.reqs = nil
+}
+
+func (c *bigmapCheckpointer) isDue(alloc *model.BigmapAlloc) bool {
+	return c.reqs != nil && alloc.NUpdates%c.interval == 0
+}
+
+// queue schedules a checkpoint of bigmap id at height without blocking.
+func (c *bigmapCheckpointer) queue(id, height, nUpdates int64) {
+	c.mu.Lock()
+	req := bigmapCheckpointReq{id: id, height: height, nUpdates: nUpdates, gen: c.gen}
+	c.mu.Unlock()
+	select {
+	case c.reqs <- req:
+	default:
+		log.Debugf("bigmap: checkpoint queue full, skipping bigmap %d at height %d", id, height)
+	}
+}
+
+// rollback runs fn to delete checkpoints and invalidates pending ones.
+func (c *bigmapCheckpointer) rollback(fn func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	defer c.index.Purge()
+	return fn()
+}
+
+func (c *bigmapCheckpointer) run() {
+	defer close(c.done)
+	for req := range c.reqs {
+		if c.ctx.Err() != nil {
+			continue
+		}
+		if err := c.write(c.ctx, req); err != nil {
+			log.Warnf("bigmap: checkpoint for bigmap %d at height %d: %v", req.id, req.height, err)
+		}
+	}
+}
+
+func (c *bigmapCheckpointer) isStale(req bigmapCheckpointReq) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen != req.gen
+}
+
+func (c *bigmapCheckpointer) write(ctx context.Context, req bigmapCheckpointReq) error {
+	if c.isStale(req) {
+		return nil
+	}
+	base, err := c.index.Load(ctx, c.table, req.id, req.height)
+	if err != nil {
+		return err
+	}
+	if base != nil && base.Height == req.height {
+		return nil
+	}
+	hist, err := cache.ReplayBigmapHistory(ctx, base, c.updates, req.id, req.height, 0)
+	if err != nil {
+		return err
+	}
+
+	// don't store checkpoints of blocks rolled back in the meantime
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != req.gen {
+		return nil
+	}
+	cp := hist.Checkpoint(req.nUpdates)
+	if err := c.table.Insert(ctx, cp); err != nil {
+		return err
+	}
+	c.index.Add(cp)
+	bigmapCheckpoints.Add(1)
+	return nil
+}
+
+// LoadCheckpoint returns the state of bigmap id from the latest stored
+// checkpoint at or below height or nil when there is none.
+func (idx *BigmapIndex) LoadCheckpoint(ctx context.Context, id, height int64) (*cache.BigmapHistory, error) {
+	table, ok := idx.tables[model.BigmapCheckpointTableKey]
+	if !ok {
+		return nil, nil
+	}
+	return idx.checkpoint.index.Load(ctx, table, id, height)
+}
@@ -0,0 +1,384 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	_ "blockwatch.cc/packdb/store/bolt"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestBigmapAllocEvict(t *testing.T) {
+	idx := NewBigmapIndex()
+	idx.allocCache = idx.newAllocCache(2)
+
+	var evicted []int64
+	idx.OnAllocEvict(func(id int64, alloc *model.BigmapAlloc) {
+		if alloc.BigmapId != id {
+			t.Errorf("evicted alloc id mismatch: got %d want %d", alloc.BigmapId, id)
+		}
+		evicted = append(evicted, id)
+	})
+
+	for i := int64(1); i <= 3; i++ {
+		idx.allocCache.Add(i, &model.BigmapAlloc{BigmapId: i})
+	}
+	if len(evicted) != 1 || evicted[0] != 1 {
+		t.Fatalf("expected eviction of bigmap 1, got %v", evicted)
+	}
+
+	// touch 2 so 3 becomes least recently used
+	idx.allocCache.Get(2)
+	idx.allocCache.Add(4, &model.BigmapAlloc{BigmapId: 4})
+	if len(evicted) != 2 || evicted[1] != 3 {
+		t.Fatalf("expected eviction of bigmap 3, got %v", evicted)
+	}
+
+	// removed callback must not fire
+	idx.OnAllocEvict(nil)
+	idx.allocCache.Add(5, &model.BigmapAlloc{BigmapId: 5})
+	if len(evicted) != 2 {
+		t.Fatalf("unexpected eviction callback after removal, got %v", evicted)
+	}
+}
+
+func TestBigmapAllocConflicts(t *testing.T) {
+	alloc := func(id int64) micheline.BigmapEvent {
+		return micheline.BigmapEvent{Action: micheline.DiffActionAlloc, Id: id}
+	}
+	block := &model.Block{
+		Height: 1,
+		Ops: []*model.Op{
+			{IsSuccess: true, BigmapEvents: micheline.BigmapEvents{alloc(-1), alloc(5)}},
+			{IsSuccess: true, BigmapEvents: micheline.BigmapEvents{alloc(-1), alloc(6)}},
+			{IsSuccess: false, BigmapEvents: micheline.BigmapEvents{alloc(5)}},
+		},
+	}
+	if err := checkAllocConflicts(block); err != nil {
+		t.Fatalf("unexpected conflict: %v", err)
+	}
+
+	// a second alloc claiming the same positive id
+	block.Ops = append(block.Ops, &model.Op{
+		IsSuccess:    true,
+		BigmapEvents: micheline.BigmapEvents{alloc(5)},
+	})
+	if err := checkAllocConflicts(block); err == nil {
+		t.Fatalf("expected conflict for bigmap 5")
+	}
+
+	// copies claim their destination id
+	block.Ops[3].BigmapEvents = micheline.BigmapEvents{
+		{Action: micheline.DiffActionCopy, SourceId: 5, DestId: 6},
+	}
+	if err := checkAllocConflicts(block); err == nil {
+		t.Fatalf("expected conflict for copy into bigmap 6")
+	}
+}
+
+func TestBigmapRecoverAlloc(t *testing.T) {
+	dir := t.TempDir()
+	idx := NewBigmapIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	ctx := context.Background()
+	op := &model.Op{Height: 10, ReceiverId: 3}
+
+	// strict mode fails with a distinct error
+	idx.strict = true
+	if _, err := idx.loadOrRecoverAlloc(ctx, 7, op); !errors.Is(err, model.ErrNoBigmapAlloc) {
+		t.Fatalf("strict: expected missing alloc error, got %v", err)
+	}
+
+	// lenient mode synthesizes and stores a minimal alloc
+	idx.strict = false
+	n := bigmapAllocRecoveries.Value()
+	alloc, err := idx.loadOrRecoverAlloc(ctx, 7, op)
+	if err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if alloc.RowId == 0 || alloc.BigmapId != 7 || alloc.AccountId != 3 || alloc.Height != 10 {
+		t.Errorf("recover: unexpected alloc %+v", alloc)
+	}
+	if v := bigmapAllocRecoveries.Value(); v != n+1 {
+		t.Errorf("recover: expected counter %d, got %d", n+1, v)
+	}
+	if b := alloc.GetKeyTypeBytes(); b != nil {
+		t.Errorf("recover: expected no key type, got %x", b)
+	}
+
+	// recovered alloc is found on the next load
+	idx.allocCache.Purge()
+	if _, err := idx.loadAlloc(ctx, 7); err != nil {
+		t.Errorf("reload: %v", err)
+	}
+}
+
+func TestBigmapRepairCounts(t *testing.T) {
+	dir := t.TempDir()
+	idx := NewBigmapIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	ctx := context.Background()
+	if _, err := idx.RepairCounts(ctx, 7); !errors.Is(err, model.ErrNoBigmapAlloc) {
+		t.Fatalf("missing: expected missing alloc error, got %v", err)
+	}
+
+	// alloc claims more keys than are live
+	alloc := &model.BigmapAlloc{BigmapId: 7, NKeys: 5}
+	if err := idx.tables[model.BigmapAllocTableKey].Insert(ctx, alloc); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		v := &model.BigmapValue{BigmapId: 7, KeyId: uint64(i + 1)}
+		if err := idx.tables[model.BigmapValueTableKey].Insert(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// values of other bigmaps are not counted
+	if err := idx.tables[model.BigmapValueTableKey].Insert(ctx, &model.BigmapValue{BigmapId: 8}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := bigmapCountRepairs.Value()
+	ok, err := idx.RepairCounts(ctx, 7)
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if !ok {
+		t.Fatalf("repair: expected correction")
+	}
+	if v := bigmapCountRepairs.Value(); v != n+1 {
+		t.Errorf("repair: expected counter %d, got %d", n+1, v)
+	}
+
+	// correction is persisted
+	idx.allocCache.Purge()
+	alloc, err = idx.loadAlloc(ctx, 7)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if alloc.NKeys != 3 {
+		t.Errorf("reload: expected 3 keys, got %d", alloc.NKeys)
+	}
+
+	// consistent counts are left alone
+	if ok, err := idx.RepairCounts(ctx, 7); err != nil || ok {
+		t.Errorf("second repair: ok=%t err=%v", ok, err)
+	}
+}
+
+// makeBigmapContract returns a contract which stores n bigmaps from
+// address to nat with distinct annotations in a right comb.
+func makeBigmapContract(tb testing.TB, n int) *model.Contract {
+	maps := make([]micheline.Prim, n)
+	for i := range maps {
+		maps[i] = micheline.Prim{
+			Type:   micheline.PrimBinaryAnno,
+			OpCode: micheline.T_BIG_MAP,
+			Args:   []micheline.Prim{micheline.NewPrim(micheline.T_ADDRESS), micheline.NewPrim(micheline.T_NAT)},
+			Anno:   []string{fmt.Sprintf("%%map_%03d", i)},
+		}
+	}
+	storage := maps[n-1]
+	for i := n - 2; i >= 0; i-- {
+		storage = micheline.NewPairType(maps[i], storage)
+	}
+	script := micheline.NewScript()
+	script.Code.Param = micheline.NewCode(micheline.K_PARAMETER, micheline.NewPrim(micheline.T_UNIT))
+	script.Code.Storage = micheline.NewCode(micheline.K_STORAGE, storage)
+	script.Code.Code = micheline.NewCode(micheline.K_CODE, micheline.NewSeq())
+	script.Storage = micheline.NewSeq()
+	buf, err := script.MarshalBinary()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &model.Contract{AccountId: 1, Script: buf, CodeHash: 42}
+}
+
+func TestBigmapCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	idx := NewBigmapIndex()
+	idx.checkpoint.interval = 2
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	ctx := context.Background()
+	updates := idx.tables[model.BigmapUpdateTableKey]
+	cpTable := idx.tables[model.BigmapCheckpointTableKey]
+	update := func(height int64, action micheline.DiffAction, key string, val int64) {
+		t.Helper()
+		k, _ := micheline.NewString(key).MarshalBinary()
+		v, _ := micheline.NewInt64(val).MarshalBinary()
+		upd := &model.BigmapUpdate{
+			BigmapId: 7,
+			KeyId:    model.GetKeyId(7, micheline.KeyHash(k)),
+			Action:   action,
+			Height:   height,
+			Key:      k,
+			Value:    v,
+		}
+		if err := updates.Insert(ctx, upd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update(1, micheline.DiffActionUpdate, "a", 1)
+	update(1, micheline.DiffActionUpdate, "b", 2)
+	update(2, micheline.DiffActionUpdate, "a", 3)
+	update(3, micheline.DiffActionRemove, "b", 0)
+
+	write := func(height int64) {
+		t.Helper()
+		req := bigmapCheckpointReq{id: 7, height: height, nUpdates: height}
+		if err := idx.checkpoint.write(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(2)
+	write(4) // built on top of the checkpoint at height 2
+
+	for _, height := range []int64{2, 3, 4} {
+		want, err := cache.ReplayBigmapHistory(ctx, nil, updates, 7, height, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cp, err := cache.LoadBigmapCheckpoint(ctx, cpTable, 7, height)
+		if err != nil {
+			t.Fatalf("load at %d: %v", height, err)
+		}
+		if cp == nil {
+			t.Fatalf("load at %d: missing checkpoint", height)
+		}
+		got, err := cache.ReplayBigmapHistory(ctx, cp, updates, 7, height, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Len() != want.Len() || model.BigmapCommitment(got.Values()) != model.BigmapCommitment(want.Values()) {
+			t.Errorf("height %d: state from checkpoint %d differs", height, cp.Height)
+		}
+
+		// replay in batches yields the same state
+		batch := cache.BigmapReplayBatchSize
+		cache.BigmapReplayBatchSize = 1
+		got, err = cache.ReplayBigmapHistory(ctx, nil, updates, 7, height, 0)
+		cache.BigmapReplayBatchSize = batch
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Updates != want.Updates || model.BigmapCommitment(got.Values()) != model.BigmapCommitment(want.Values()) {
+			t.Errorf("height %d: batched replay differs", height)
+		}
+	}
+	if cp, _ := cache.LoadBigmapCheckpoint(ctx, cpTable, 7, 1); cp != nil {
+		t.Errorf("unexpected checkpoint at height %d", cp.Height)
+	}
+
+	// reorg removes checkpoints at and above the rolled back block
+	if err := idx.DeleteBlock(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if cp, err := cache.LoadBigmapCheckpoint(ctx, cpTable, 7, 4); err != nil || cp == nil || cp.Height != 2 {
+		t.Errorf("after rollback: expected checkpoint at height 2, got %v %v", cp, err)
+	}
+	if cp, err := idx.LoadCheckpoint(ctx, 7, 4); err != nil || cp == nil || cp.Height != 2 {
+		t.Errorf("after rollback: expected cached lookup at height 2, got %v %v", cp, err)
+	}
+
+	// checkpoints requested before a rollback are discarded
+	idx.checkpoint.mu.Lock()
+	req := bigmapCheckpointReq{id: 7, height: 3, nUpdates: 3, gen: idx.checkpoint.gen}
+	idx.checkpoint.mu.Unlock()
+	_ = idx.checkpoint.rollback(func() error { return nil })
+	if err := idx.checkpoint.write(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if cp, _ := cache.LoadBigmapCheckpoint(ctx, cpTable, 7, 3); cp == nil || cp.Height != 2 {
+		t.Errorf("stale request: expected checkpoint at height 2, got %v", cp)
+	}
+}
+
+func TestBigmapScriptCache(t *testing.T) {
+	c := cache.NewBigmapScriptCache(16)
+	cc := makeBigmapContract(t, 3)
+	key, val := micheline.NewPrim(micheline.T_ADDRESS), micheline.NewPrim(micheline.T_NAT)
+	for i := 0; i < 3; i++ {
+		types, err := c.Load(cc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, ok := types.Match(key, val); !ok {
+			t.Fatalf("no type match")
+		}
+	}
+	if s := c.Stats(); s.Misses != 1 || s.Hits != 2 {
+		t.Errorf("expected 1 miss and 2 hits, got %+v", s)
+	}
+
+	// upgraded scripts are reloaded
+	cc = makeBigmapContract(t, 4)
+	cc.CodeHash = 43
+	types, err := c.Load(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types.Types) != 4 {
+		t.Errorf("expected upgraded script with 4 bigmaps, got %d", len(types.Types))
+	}
+	if s := c.Stats(); s.Misses != 2 || s.Updates != 1 {
+		t.Errorf("expected reload on code hash change, got %+v", s)
+	}
+	if _, _, ok := types.Match(val, key); ok {
+		t.Errorf("swapped types must not match")
+	}
+}
+
+// BenchmarkBigmapScriptCache measures type matching for a contract that
+// allocates many bigmaps at origination. Each iteration is one origination
+// with a fresh contract object, i.e. scripts are parsed per origination
+// without cache and once per contract with cache.
+func BenchmarkBigmapScriptCache(b *testing.B) {
+	const n = 64
+	cc := makeBigmapContract(b, n)
+	key, val := micheline.NewPrim(micheline.T_ADDRESS), micheline.NewPrim(micheline.T_NAT)
+	for _, sz := range []int{0, 16} {
+		b.Run(fmt.Sprintf("cache=%d", sz), func(b *testing.B) {
+			c := cache.NewBigmapScriptCache(sz)
+			for i := 0; i < b.N; i++ {
+				con := &model.Contract{AccountId: cc.AccountId, Script: cc.Script, CodeHash: cc.CodeHash}
+				for j := 0; j < n; j++ {
+					types, err := c.Load(con)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, _, ok := types.Match(key, val); !ok {
+						b.Fatal("no type match")
+					}
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 
 	"blockwatch.cc/packdb/pack"
+	"github.com/echa/config"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/mavryk-network/mvgo/micheline"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/etl/task"
@@ -16,14 +18,20 @@ import (
 const ContractIndexKey = "contract"
 
 type ContractIndex struct {
-	db    *pack.DB
-	table *pack.Table
+	db      *pack.DB
+	table   *pack.Table
+	dedup   bool                                 // share scripts between contracts with equal code
+	scripts *lru.Cache[uint64, model.ContractID] // contracts storing shared code by code hash
 }
 
 var _ model.BlockIndexer = (*ContractIndex)(nil)
 
 func NewContractIndex() *ContractIndex {
-	return &ContractIndex{}
+	idx := &ContractIndex{
+		dedup: config.GetBool("contract.dedup_scripts"),
+	}
+	idx.scripts, _ = lru.New[uint64, model.ContractID](1 << 14) // 16k
+	return idx
 }
 
 func (idx *ContractIndex) DB() *pack.DB {
@@ -68,13 +76,15 @@ func (idx *ContractIndex) Init(path, label string, opts interface{}) error {
 	}
 	idx.db = db
 
-	m := model.Contract{}
-	key := m.TableKey()
-	if err != nil {
-		return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+	// the contract table gained the script_ref column, it is only written
+	// when scripts are shared, so check its schema only then
+	var table *pack.Table
+	if idx.dedup {
+		table, err = openTable(idx.db, model.Contract{})
+	} else {
+		m := model.Contract{}
+		table, err = idx.db.Table(m.TableKey(), m.TableOpts().Merge(model.ReadConfigOpts(m.TableKey())))
 	}
-	topts := m.TableOpts().Merge(model.ReadConfigOpts(key))
-	table, err := idx.db.Table(key, topts)
 	if err != nil {
 		idx.Close()
 		return err
@@ -175,17 +185,105 @@ func (idx *ContractIndex) ConnectBlock(ctx context.Context, block *model.Block,
 		}
 	}
 
+	// reference code of earlier contracts
+	if idx.dedup {
+		if err := idx.shareScripts(ctx, ins); err != nil {
+			return fmt.Errorf("contract: %w", err)
+		}
+	}
+
 	// insert, will generate unique row ids
-	if err := idx.table.Insert(ctx, ins); err != nil {
+	restore := splitScripts(ins)
+	err := idx.table.Insert(ctx, ins)
+	restore()
+	if err != nil {
 		return fmt.Errorf("contract: insert: %w", err)
 	}
 
-	if err := idx.table.Update(ctx, upd); err != nil {
+	// reference code of contracts inserted earlier in this block
+	if idx.dedup {
+		upd = append(upd, idx.registerScripts(ins)...)
+	}
+
+	restore = splitScripts(upd)
+	err = idx.table.Update(ctx, upd)
+	restore()
+	if err != nil {
 		return fmt.Errorf("contract: update: %w", err)
 	}
 	return nil
 }
 
+// shareScripts links new contracts to an already stored contract with the
+// same code.
+func (idx *ContractIndex) shareScripts(ctx context.Context, ins []pack.Item) error {
+	for _, v := range ins {
+		c := v.(*model.Contract)
+		if c.CodeHash == 0 || len(c.Script) == 0 {
+			continue
+		}
+		ref, ok := idx.scripts.Get(c.CodeHash)
+		if !ok {
+			cc := &model.Contract{}
+			err := pack.NewQuery("etl.find_script").
+				WithTable(idx.table).
+				WithFields("row_id").
+				AndEqual("code_hash", c.CodeHash).
+				AndEqual("script_ref", 0).
+				WithLimit(1).
+				Execute(ctx, cc)
+			if err != nil {
+				return err
+			}
+			if cc.RowId == 0 {
+				continue
+			}
+			ref = cc.RowId
+			idx.scripts.Add(c.CodeHash, ref)
+		}
+		c.ScriptRef = ref
+	}
+	return nil
+}
+
+// registerScripts remembers new contracts that store their code and links
+// later contracts with the same code in this block. Returns contracts that
+// need an update.
+func (idx *ContractIndex) registerScripts(ins []pack.Item) []pack.Item {
+	upd := make([]pack.Item, 0)
+	for _, v := range ins {
+		c := v.(*model.Contract)
+		if c.CodeHash == 0 || len(c.Script) == 0 || c.IsSharedScript() {
+			continue
+		}
+		if ref, ok := idx.scripts.Get(c.CodeHash); ok && ref != c.RowId {
+			c.ScriptRef = ref
+			upd = append(upd, c)
+			continue
+		}
+		idx.scripts.Add(c.CodeHash, c.RowId)
+	}
+	return upd
+}
+
+// splitScripts replaces shared scripts by their storage segment before
+// writing to the table and returns a function to restore full scripts.
+func splitScripts(items []pack.Item) func() {
+	full := make(map[*model.Contract][]byte)
+	for _, v := range items {
+		c := v.(*model.Contract)
+		if c.IsSharedScript() {
+			full[c] = c.Script
+			c.Script = c.StoredScript()
+		}
+	}
+	return func() {
+		for c, buf := range full {
+			c.Script = buf
+		}
+	}
+}
+
 func (idx *ContractIndex) DisconnectBlock(ctx context.Context, block *model.Block, builder model.BlockBuilder) error {
 	upd := make([]pack.Item, 0)
 	// update all dirty contracts, skip originated contracts (will be removed)
@@ -196,7 +294,10 @@ func (idx *ContractIndex) DisconnectBlock(ctx context.Context, block *model.Bloc
 		v.IsDirty = false
 		upd = append(upd, v)
 	}
-	if err := idx.table.Update(ctx, upd); err != nil {
+	restore := splitScripts(upd)
+	err := idx.table.Update(ctx, upd)
+	restore()
+	if err != nil {
 		return fmt.Errorf("contract: update: %w", err)
 	}
 
@@ -206,6 +307,8 @@ func (idx *ContractIndex) DisconnectBlock(ctx context.Context, block *model.Bloc
 
 func (idx *ContractIndex) DeleteBlock(ctx context.Context, height int64) error {
 	// log.Debugf("Rollback deleting contracts at height %d", height)
+	// deleted contracts may store shared code
+	idx.scripts.Purge()
 	_, err := pack.NewQuery("etl.delete").
 		WithTable(idx.table).
 		AndEqual("first_seen", height).
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+type contractTestBuilder struct {
+	model.BlockBuilder
+	contracts map[model.AccountID]*model.Contract
+}
+
+func (b contractTestBuilder) ContractById(id model.AccountID) (*model.Contract, bool) {
+	c, ok := b.contracts[id]
+	return c, ok
+}
+
+func TestContractSharedScripts(t *testing.T) {
+	dir := t.TempDir()
+	idx := NewContractIndex()
+	idx.dedup = true
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	// shared script lookups by code hash must not scan the table
+	if f := idx.table.Fields().Find("code_hash"); !f.Flags.Contains(pack.FlagBloom) {
+		t.Errorf("code_hash column has no bloom filter")
+	}
+
+	// manager.tz clones only differ in storage, originate 2 in the first
+	// block and more clones in the next block
+	const nClones = 100
+	builder := contractTestBuilder{contracts: make(map[model.AccountID]*model.Contract)}
+	scripts := make(map[model.AccountID][]byte)
+	blocks := []*model.Block{{Height: 1}, {Height: 2}}
+	for i := 1; i <= nClones; i++ {
+		id := model.AccountID(i)
+		acc := &model.Account{
+			RowId:   id,
+			Address: mavryk.NewAddress(mavryk.AddressTypeEd25519, bytes.Repeat([]byte{byte(i)}, 20)),
+		}
+		b := blocks[min(i/3, 1)]
+		c, err := model.NewManagerTzContract(acc, b.Height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.FirstSeen = b.Height
+		builder.contracts[id] = c
+		scripts[id] = c.Script
+		b.Ops = append(b.Ops, &model.Op{
+			Type:       model.OpTypeOrigination,
+			ReceiverId: id,
+			IsSuccess:  true,
+			IsContract: true,
+		})
+	}
+	for _, b := range blocks {
+		if err := idx.ConnectBlock(ctx, b, builder); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// in-memory contracts keep their full scripts
+	first := builder.contracts[1]
+	for id, c := range builder.contracts {
+		if !bytes.Equal(c.Script, scripts[id]) {
+			t.Errorf("contract %d: script changed in memory", id)
+		}
+		if id != 1 && c.ScriptRef != first.RowId {
+			t.Errorf("contract %d: want script ref %d, got %d", id, first.RowId, c.ScriptRef)
+		}
+	}
+
+	// only the first contract stores code
+	list := make([]*model.Contract, 0)
+	if err := pack.NewQuery("test").WithTable(idx.table).Execute(ctx, &list); err != nil {
+		t.Fatal(err)
+	}
+	var stored, full int
+	for _, c := range list {
+		stored += len(c.Script)
+		full += len(scripts[c.AccountId])
+	}
+	t.Logf("%d clones store %d of %d script bytes (%.1f%%)", len(list), stored, full, float64(stored)*100/float64(full))
+	if stored >= full/2 {
+		t.Errorf("want shared scripts to save space, stored %d of %d bytes", stored, full)
+	}
+
+	// loaded scripts are joined transparently
+	if err := model.JoinScripts(ctx, idx.table, list...); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range list {
+		if !bytes.Equal(c.Script, scripts[c.AccountId]) {
+			t.Errorf("contract %d: joined script differs from original", c.AccountId)
+		}
+		s, err := c.LoadScript()
+		if err != nil || s == nil {
+			t.Fatalf("contract %d: load script: %v", c.AccountId, err)
+		}
+		if _, _, err := c.LoadType(); err != nil {
+			t.Errorf("contract %d: load type: %v", c.AccountId, err)
+		}
+	}
+}
@@ -66,10 +66,8 @@ func (idx *FlowIndex) Init(path, label string, opts interface{}) error {
 	}
 	idx.db = db
 
-	m := model.Flow{}
-	key := m.TableKey()
-
-	idx.table, err = idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+	// the flow table gained the origin column, check its schema
+	idx.table, err = openTable(idx.db, model.Flow{})
 	if err != nil {
 		idx.Close()
 		return err
@@ -809,7 +809,7 @@ func (idx *IncomeIndex) updateBlockIncome(ctx context.Context, block *model.Bloc
 				in.EndorsingIncome += op.Reward * mul
 			}
 
-		case model.OpTypeNonceRevelation:
+		case model.OpTypeNonceRevelation, model.OpTypeVdfRevelation:
 			// credit sender
 			in, ok := incomeMap[op.SenderId]
 			if !ok {
@@ -0,0 +1,269 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/echa/config"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/etl/task"
+)
+
+const RoleIndexKey = "role"
+
+// RoleIndex extracts admin and operator addresses from contract storage
+// using configured storage layout patterns (config key `role.patterns`).
+type RoleIndex struct {
+	db       *pack.DB
+	table    *pack.Table
+	patterns []model.RolePattern
+}
+
+var _ model.BlockIndexer = (*RoleIndex)(nil)
+
+func NewRoleIndex() *RoleIndex {
+	idx := &RoleIndex{}
+	if config.GetInterface("role.patterns") == nil {
+		return idx
+	}
+	var cfg struct {
+		Patterns []model.RolePattern `json:"patterns"`
+	}
+	if err := config.Unmarshal("role", &cfg); err != nil {
+		log.Errorf("Reading role patterns: %v", err)
+		return idx
+	}
+	idx.patterns = cfg.Patterns
+	return idx
+}
+
+// IsEnabled returns true when at least one role pattern is configured.
+func (idx *RoleIndex) IsEnabled() bool {
+	return len(idx.patterns) > 0
+}
+
+func (idx *RoleIndex) DB() *pack.DB {
+	return idx.db
+}
+
+func (idx *RoleIndex) Tables() []*pack.Table {
+	return []*pack.Table{idx.table}
+}
+
+func (idx *RoleIndex) Key() string {
+	return RoleIndexKey
+}
+
+func (idx *RoleIndex) Name() string {
+	return RoleIndexKey + " index"
+}
+
+func (idx *RoleIndex) Create(path, label string, opts interface{}) error {
+	db, err := pack.CreateDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return fmt.Errorf("creating %s database: %w", idx.Key(), err)
+	}
+	defer db.Close()
+
+	m := model.ContractRole{}
+	key := m.TableKey()
+	fields, err := pack.Fields(m)
+	if err != nil {
+		return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+	}
+
+	_, err = db.CreateTableIfNotExists(key, fields, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+	return err
+}
+
+func (idx *RoleIndex) Init(path, label string, opts interface{}) error {
+	db, err := pack.OpenDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return err
+	}
+	idx.db = db
+
+	m := model.ContractRole{}
+	key := m.TableKey()
+
+	idx.table, err = idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+	if err != nil {
+		idx.Close()
+		return err
+	}
+	return nil
+}
+
+func (idx *RoleIndex) FinalizeSync(ctx context.Context) error {
+	return nil
+}
+
+func (idx *RoleIndex) Close() error {
+	for _, v := range idx.Tables() {
+		if v != nil {
+			if err := v.Close(); err != nil {
+				log.Errorf("Closing %s table: %s", v.Name(), err)
+			}
+		}
+	}
+	idx.table = nil
+	if idx.db != nil {
+		if err := idx.db.Close(); err != nil {
+			return err
+		}
+		idx.db = nil
+	}
+	return nil
+}
+
+func (idx *RoleIndex) ConnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	// only the final storage of each contract in this block matters
+	last := make(map[model.AccountID]*model.Op)
+	order := make([]model.AccountID, 0)
+	for _, op := range block.Ops {
+		if !op.IsStorageUpdate || !op.IsSuccess || op.Contract == nil {
+			continue
+		}
+		if _, ok := last[op.Contract.AccountId]; !ok {
+			order = append(order, op.Contract.AccountId)
+		}
+		last[op.Contract.AccountId] = op
+	}
+
+	ins := make([]pack.Item, 0)
+	upd := make([]pack.Item, 0)
+	for _, id := range order {
+		op := last[id]
+		var pattern *model.RolePattern
+		for i := range idx.patterns {
+			if idx.patterns[i].Match(op.Contract) {
+				pattern = &idx.patterns[i]
+				break
+			}
+		}
+		if pattern == nil {
+			continue
+		}
+		_, styp, err := op.Contract.LoadType()
+		if err != nil {
+			log.Warnf("role: %s storage type: %v", op.Contract, err)
+			continue
+		}
+		var prim micheline.Prim
+		if err := prim.UnmarshalBinary(op.Storage); err != nil {
+			log.Warnf("role: %s storage: %v", op.Contract, err)
+			continue
+		}
+		roles := pattern.Extract(micheline.NewValue(styp, prim))
+
+		// close roles that were removed
+		active, err := idx.listActive(ctx, id)
+		if err != nil {
+			return fmt.Errorf("role: %w", err)
+		}
+		for _, v := range active {
+			if roles.Contains(v.Role, v.Address) {
+				continue
+			}
+			v.LastHeight = block.Height
+			upd = append(upd, v)
+		}
+
+		// add new roles
+		for role, addrs := range roles {
+			for _, a := range addrs {
+				var exists bool
+				for _, v := range active {
+					if v.Role == role && v.Address.Equal(a) {
+						exists = true
+						break
+					}
+				}
+				if exists {
+					continue
+				}
+				ins = append(ins, &model.ContractRole{
+					Contract:    id,
+					Role:        role,
+					Address:     a,
+					FirstHeight: block.Height,
+				})
+			}
+		}
+	}
+
+	if len(upd) > 0 {
+		if err := idx.table.Update(ctx, upd); err != nil {
+			return fmt.Errorf("role: update: %w", err)
+		}
+	}
+	if len(ins) > 0 {
+		if err := idx.table.Insert(ctx, ins); err != nil {
+			return fmt.Errorf("role: insert: %w", err)
+		}
+	}
+	return nil
+}
+
+func (idx *RoleIndex) listActive(ctx context.Context, id model.AccountID) ([]*model.ContractRole, error) {
+	list := make([]*model.ContractRole, 0)
+	err := pack.NewQuery("etl.list_roles").
+		WithTable(idx.table).
+		AndEqual("contract", id).
+		AndEqual("last_height", 0).
+		Execute(ctx, &list)
+	return list, err
+}
+
+func (idx *RoleIndex) DisconnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	return idx.DeleteBlock(ctx, block.Height)
+}
+
+func (idx *RoleIndex) DeleteBlock(ctx context.Context, height int64) error {
+	_, err := pack.NewQuery("etl.delete").
+		WithTable(idx.table).
+		AndEqual("first_height", height).
+		Delete(ctx)
+	if err != nil {
+		return err
+	}
+
+	// re-open roles closed at this height
+	list := make([]*model.ContractRole, 0)
+	err = pack.NewQuery("etl.list_closed_roles").
+		WithTable(idx.table).
+		AndEqual("last_height", height).
+		Execute(ctx, &list)
+	if err != nil || len(list) == 0 {
+		return err
+	}
+	upd := make([]pack.Item, len(list))
+	for i, v := range list {
+		v.LastHeight = 0
+		upd[i] = v
+	}
+	return idx.table.Update(ctx, upd)
+}
+
+func (idx *RoleIndex) DeleteCycle(ctx context.Context, cycle int64) error {
+	return nil
+}
+
+func (idx *RoleIndex) Flush(ctx context.Context) error {
+	for _, v := range idx.Tables() {
+		if err := v.Flush(ctx); err != nil {
+			log.Errorf("Flushing %s table: %v", v.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (idx *RoleIndex) OnTaskComplete(_ context.Context, _ *task.TaskResult) error {
+	// unused
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// ErrReindexRequired is returned when a stored table lacks columns that were
+// added to its model and the table cannot be upgraded in place. The database
+// must be rebuilt from scratch, see README "Schema upgrades".
+var ErrReindexRequired = errors.New("reindex required, delete the database and rebuild from scratch")
+
+// openTable opens the table for model m and checks the stored schema against
+// the model. Columns removed from a model are ignored on decode and only
+// logged. Missing columns are added in place when the table is still empty
+// (the table is recreated with the current schema). Non-empty tables cannot
+// be altered by packdb, so they fail with ErrReindexRequired instead of
+// silently returning zero values for new fields. All tables whose models
+// gained stored columns must be opened here.
+func openTable(db *pack.DB, m model.Model) (*pack.Table, error) {
+	key := m.TableKey()
+	opts := m.TableOpts().Merge(model.ReadConfigOpts(key))
+	t, err := db.Table(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := pack.Fields(m)
+	if err != nil {
+		return nil, fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+	}
+	stored := t.Fields()
+	missing := make([]string, 0)
+	for _, f := range fields {
+		if !stored.Contains(f.Name) {
+			missing = append(missing, f.Alias)
+		}
+	}
+	for _, f := range stored {
+		if !fields.Contains(f.Name) {
+			log.Warnf("Table %s: stored column %q is no longer used", key, f.Alias)
+		}
+	}
+	if len(missing) == 0 {
+		return t, nil
+	}
+
+	if t.Stats()[0].TupleCount > 0 {
+		return nil, fmt.Errorf("table %s: missing columns [%s]: %w",
+			key, strings.Join(missing, ","), ErrReindexRequired)
+	}
+
+	// empty tables are safe to recreate
+	log.Infof("Table %s: upgrading schema, adding columns [%s]", key, strings.Join(missing, ","))
+	if err := db.DropTable(key); err != nil {
+		return nil, fmt.Errorf("table %s: drop for upgrade: %v", key, err)
+	}
+	t, err = db.CreateTable(key, fields, opts)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: create for upgrade: %v", key, err)
+	}
+	return t, nil
+}
@@ -134,6 +134,7 @@ func (idx *TicketIndex) ConnectBlock(ctx context.Context, block *model.Block, b
 	ins := make([]pack.Item, 0)
 
 	for _, op := range block.Ops {
+		// keep all balance updates as listed in the receipt
 		for _, up := range op.RawTicketUpdates {
 			// load or create type
 			tick, err := idx.getOrCreateTicket(ctx, up.Ticket, op, b)
@@ -158,8 +159,15 @@ func (idx *TicketIndex) ConnectBlock(ctx context.Context, block *model.Block, b
 				tu.OpId = op.Id()
 				ins = append(ins, tu)
 			}
+		}
 
-			// reconcile events
+		// reconcile events from net deltas, so that accounts listed in
+		// multiple updates of the same ticket are counted once
+		for _, up := range rpc.NetTicketUpdates(op.RawTicketUpdates) {
+			tick, err := idx.getOrCreateTicket(ctx, up.Ticket, op, b)
+			if err != nil {
+				return fmt.Errorf("ticket: load/create type for %s: %v", op.Hash, err)
+			}
 			events, err := idx.reconcileEvents(tick, up.Updates, b)
 			if err != nil {
 				log.Errorf("ticket: %d %s reconcile: %v", op.Height, op.Hash, err)
@@ -0,0 +1,118 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+type ticketTestBuilder struct {
+	model.BlockBuilder
+	accounts map[mavryk.Address]*model.Account
+}
+
+func (b ticketTestBuilder) AccountByAddress(a mavryk.Address) (*model.Account, bool) {
+	acc, ok := b.accounts[a]
+	return acc, ok
+}
+
+func (b ticketTestBuilder) LoadAccountByAddress(_ context.Context, a mavryk.Address) (*model.Account, error) {
+	if acc, ok := b.accounts[a]; ok {
+		return acc, nil
+	}
+	return nil, fmt.Errorf("no account %s", a)
+}
+
+func TestTicketNetEvents(t *testing.T) {
+	dir := t.TempDir()
+	idx := NewTicketIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	b := ticketTestBuilder{accounts: make(map[mavryk.Address]*model.Account)}
+	addr := func(typ mavryk.AddressType, n byte) mavryk.Address {
+		a := mavryk.NewAddress(typ, []byte{n, 19: 0})
+		b.accounts[a] = &model.Account{RowId: model.AccountID(n), Address: a}
+		return a
+	}
+	var (
+		sender   = addr(mavryk.AddressTypeEd25519, 1)
+		splitter = addr(mavryk.AddressTypeContract, 2)
+		alice    = addr(mavryk.AddressTypeEd25519, 3)
+		bob      = addr(mavryk.AddressTypeEd25519, 4)
+		ticketer = addr(mavryk.AddressTypeContract, 9)
+	)
+	upd := func(a mavryk.Address, n int64) rpc.TicketBalanceUpdate {
+		return rpc.TicketBalanceUpdate{Account: a, Amount: mavryk.NewZ(n)}
+	}
+
+	// sender transfers 10 to a splitter contract which forwards 6 to alice
+	// and 4 to bob, the receipt lists the splitter three times
+	var tx rpc.TransferTicket
+	tx.Metadata = &rpc.OperationMetadata{}
+	tx.Metadata.Result.Status = mavryk.OpStatusApplied
+	tx.Metadata.Result.TicketUpdatesCorrect = []rpc.TicketUpdate{{
+		Ticket: rpc.Ticket{
+			Ticketer: ticketer,
+			Type:     micheline.NewPrim(micheline.T_STRING),
+			Content:  micheline.NewString("coin"),
+		},
+		Updates: []rpc.TicketBalanceUpdate{
+			upd(sender, -10), upd(splitter, 10),
+			upd(splitter, -6), upd(alice, 6),
+			upd(splitter, -4), upd(bob, 4),
+		},
+	}}
+	tx.Destination = splitter
+	op := &model.Op{RowId: 1, Height: 10, SenderId: 1, RawTicketUpdates: tx.TicketUpdates()}
+	if err := idx.ConnectBlock(ctx, &model.Block{Height: 10, Ops: []*model.Op{op}}, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// every receipt entry is kept as update
+	n, err := pack.NewQuery("test").WithTable(idx.tables[model.TicketUpdateTableKey]).Count(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("got %d updates, want 6", n)
+	}
+
+	// events are reconciled from net deltas, the splitter only forwards
+	events, err := model.ListTicketEvents(ctx, idx.tables[model.TicketEventTableKey], pack.NewQuery("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		from, to model.AccountID
+		amount   int64
+	}{
+		{1, 3, 6},
+		{1, 4, 4},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		ev := events[i]
+		if ev.Type != model.TicketEventTypeTransfer || ev.Sender != w.from || ev.Receiver != w.to || ev.Amount.Int64() != w.amount {
+			t.Errorf("event %d: got %s %d->%d %s, want transfer %d->%d %d",
+				i, ev.Type, ev.Sender, ev.Receiver, ev.Amount, w.from, w.to, w.amount)
+		}
+	}
+}
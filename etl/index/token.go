@@ -5,6 +5,7 @@ package index
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"hash/fnv"
 	"math/big"
@@ -21,6 +22,7 @@ import (
 
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/etl/task"
+	"github.com/mavryk-network/mvindex/rpc"
 )
 
 // we use 6 distinct data sets for data locality
@@ -29,10 +31,16 @@ import (
 // - `token` for storing token identity and header metadata
 // - `token_event` for storing updates transfer/mint/burn
 // - `token_owners` for live token balances per owner and running stats
+// - `token_operators` for FA2 operator permission updates
 
 const TokenIndexKey = "token"
 
-var bigzero = big.NewInt(0)
+var (
+	bigzero = big.NewInt(0)
+
+	// zero balance owner rows reclaimed since start
+	prunedTokenOwners = expvar.NewInt("token_pruned_owners")
+)
 
 type TokenIndex struct {
 	db          *pack.DB
@@ -40,6 +48,16 @@ type TokenIndex struct {
 	tokenCache  *lru.Cache[uint64, *model.Token]
 	ownerCache  *lru.Cache[uint64, *model.TokenOwner]
 	metaBaseUrl string
+	prune       bool         // prune zero balance owner rows
+	pruneCycles int64        // retention in cycles for zero balance owner rows
+	params      *rpc.Params  // last seen params, used to map cycles to heights
+	auditLog    bool         // log all table mutations
+	audit       *auditLog    // mutation log, nil when disabled
+	pauseEps    []string     // entrypoints that pause transfers
+	unpauseEps  []string     // entrypoints that unpause transfers
+	excludeSelf bool         // skip self-transfers in transfer counts and volumes
+	offchain    bool         // resolve metadata from on-chain token_info URIs
+	alerts      *tokenAlerts // webhook alert rules, nil when disabled
 }
 
 var _ model.BlockIndexer = (*TokenIndex)(nil)
@@ -52,9 +70,23 @@ func NewTokenIndex() *TokenIndex {
 		tokenCache:  tc,
 		ownerCache:  oc,
 		metaBaseUrl: config.GetString("meta.token.url"),
+		prune:       config.GetBool("token.prune_zero_owners"),
+		pruneCycles: max(config.GetInt64("token.prune_retention"), 2),
+		auditLog:    config.GetBool("token.audit_log"),
+		pauseEps:    config.GetStringSlice("token.pause_entrypoints"),
+		unpauseEps:  config.GetStringSlice("token.unpause_entrypoints"),
+		excludeSelf: config.GetBool("token.exclude_self_transfers"),
+		offchain:    config.GetBool("meta.token.resolve_offchain"),
+		alerts:      newTokenAlerts(),
 	}
 }
 
+// NumPrunedOwners returns the number of zero balance owner rows reclaimed
+// since the index was started.
+func (idx *TokenIndex) NumPrunedOwners() int64 {
+	return prunedTokenOwners.Value()
+}
+
 func (idx *TokenIndex) DB() *pack.DB {
 	return idx.db
 }
@@ -87,6 +119,9 @@ func (idx *TokenIndex) Create(path, label string, opts interface{}) error {
 		model.TokenMeta{},
 		model.TokenEvent{},
 		model.TokenOwner{},
+		model.TokenOperator{},
+		model.TokenPause{},
+		model.TokenMetaChange{},
 	} {
 		key := m.TableKey()
 		fields, err := pack.Fields(m)
@@ -111,8 +146,6 @@ func (idx *TokenIndex) Init(path, label string, opts interface{}) error {
 
 	for _, m := range []model.Model{
 		model.Token{},
-		model.TokenMeta{},
-		model.TokenEvent{},
 		model.TokenOwner{},
 	} {
 		key := m.TableKey()
@@ -123,6 +156,50 @@ func (idx *TokenIndex) Init(path, label string, opts interface{}) error {
 		}
 		idx.tables[key] = t
 	}
+
+	// the event table gained the is_excluded, amount64 and mint_origin columns,
+	// the metadata table the url, status and updated columns, check their
+	// schema
+	for _, m := range []model.Model{
+		model.TokenEvent{},
+		model.TokenMeta{},
+	} {
+		t, err := openTable(idx.db, m)
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[m.TableKey()] = t
+	}
+
+	// operator, pause and metadata change tables were added later and
+	// are created on existing databases
+	for _, m := range []model.Model{
+		model.TokenOperator{},
+		model.TokenPause{},
+		model.TokenMetaChange{},
+	} {
+		key := m.TableKey()
+		fields, err := pack.Fields(m)
+		if err != nil {
+			idx.Close()
+			return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+		}
+		t, err := idx.db.CreateTableIfNotExists(key, fields, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+		if err != nil {
+			idx.Close()
+			return err
+		}
+		idx.tables[key] = t
+	}
+	if idx.auditLog {
+		idx.audit, err = openAuditLog(path, idx.Key())
+		if err != nil {
+			idx.Close()
+			return err
+		}
+	}
+	idx.alerts.start()
 	return nil
 }
 
@@ -137,6 +214,11 @@ func (idx *TokenIndex) Close() error {
 		}
 		delete(idx.tables, n)
 	}
+	if err := idx.audit.close(); err != nil {
+		log.Errorf("Closing %s audit log: %v", idx.Key(), err)
+	}
+	idx.audit = nil
+	idx.alerts.stop()
 	if idx.db != nil {
 		if err := idx.db.Close(); err != nil {
 			return err
@@ -147,6 +229,18 @@ func (idx *TokenIndex) Close() error {
 }
 
 func (idx *TokenIndex) ConnectBlock(ctx context.Context, block *model.Block, b model.BlockBuilder) error {
+	idx.audit.begin(block.Height, false)
+	idx.alerts.begin()
+
+	// prune stale zero balance owners once per cycle
+	if idx.prune && block.MV.IsCycleStart() && block.Cycle > idx.pruneCycles {
+		idx.params = block.Params
+		if err := idx.DeleteCycle(ctx, block.Cycle-idx.pruneCycles); err != nil {
+			log.Errorf("token: prune owners: %v", err)
+		}
+	}
+
+	var metaUpdates []tokenMetaUpdate
 	for _, op := range block.Ops {
 		// skip non-contract calls
 		if !op.IsContract || op.Contract == nil {
@@ -168,10 +262,26 @@ func (idx *TokenIndex) ConnectBlock(ctx context.Context, block *model.Block, b m
 		// Note: ledger metadata is resolved and updated in metadata index
 		if upd := op.BigmapEvents.Filter(ldgr.MetadataBigmap); len(upd) > 0 {
 			for _, v := range upd {
-				if v.Action != micheline.DiffActionUpdate {
+				if v.Key.Int == nil {
 					continue
 				}
-				if v.Key.Int == nil {
+				// remember value changes for metadata history
+				var hash mavryk.ExprHash
+				switch v.Action {
+				case micheline.DiffActionUpdate:
+					hash = model.TokenInfoHash(v.Value)
+				case micheline.DiffActionRemove:
+				default:
+					continue
+				}
+				metaUpdates = append(metaUpdates, tokenMetaUpdate{
+					ledger:  ldgr,
+					tokenId: mavryk.NewBigZ(v.Key.Int),
+					bigmap:  v.Id,
+					hash:    hash,
+					op:      op,
+				})
+				if v.Action != micheline.DiffActionUpdate {
 					continue
 				}
 				// find token
@@ -180,24 +290,44 @@ func (idx *TokenIndex) ConnectBlock(ctx context.Context, block *model.Block, b m
 					continue
 				}
 
-				// schedule task
+				// schedule task, prefer the off-chain URI from token_info
+				url := strings.Replace(
+					idx.metaBaseUrl,
+					"{addr}",
+					mavryk.NewToken(op.Contract.Address, tokn.TokenId).String(),
+					1,
+				)
+				if idx.offchain {
+					if uri := model.TokenInfoURI(v.Value); uri != "" {
+						url = uri
+					}
+				}
 				req := task.TaskRequest{
 					Index:   idx.Key(),
 					Decoder: 0,
 					Owner:   op.Contract.Address,
 					Flags:   uint64(tokn.Id),
-					Url: strings.Replace(
-						idx.metaBaseUrl,
-						"{addr}",
-						mavryk.NewToken(op.Contract.Address, tokn.TokenId).String(),
-						1,
-					),
+					Url:     url,
 				}
 				_ = b.Sched().Run(req)
 				tokn.Free()
 			}
 		}
 
+		// pause state changes do not touch the ledger
+		if op.Type == model.OpTypeTransaction && op.IsSuccess {
+			if err := idx.indexPauses(ctx, op, ldgr); err != nil {
+				log.Errorf("token: %d %s pauses: %v", op.Height, op.Hash, err)
+			}
+		}
+
+		// FA2 operator permission updates do not touch the ledger
+		if op.Type == model.OpTypeTransaction && op.IsSuccess && ldgr.LedgerType == model.TokenTypeFA2 {
+			if err := idx.indexOperators(ctx, op, ldgr, b); err != nil {
+				log.Errorf("token: %d %s operators: %v", op.Height, op.Hash, err)
+			}
+		}
+
 		// decode balance updates
 		upd, err := ldgr.LedgerSchema.DecodeBalanceUpdates(op.BigmapEvents, ldgr.LedgerBigmap)
 		if err != nil {
@@ -250,13 +380,25 @@ func (idx *TokenIndex) ConnectBlock(ctx context.Context, block *model.Block, b m
 		}
 
 		// complete events
+		var admins []mavryk.Address
 		for _, ev := range events {
 			ev.OpId = op.RowId
+			// remember whether self-transfers were excluded from counts, so
+			// rollback reverts exactly what was applied even when the
+			// setting has changed since
+			ev.Excluded = idx.excludeSelf && ev.IsSelfTransfer()
+			ev.Amount64 = model.TokenAmount64(ev.Amount)
+			if ev.Type == model.TokenEventTypeMint {
+				if admins == nil {
+					admins = idx.ledgerAdmins(ctx, ldgr, b)
+				}
+				ev.Origin = model.NewTokenMintOrigin(sgnr.Address, admins)
+			}
 			// log.Infof("> %s %s", ev.Type, ev.Amount)
 		}
 
 		// store events
-		if err := model.StoreTokenEvents(ctx, idx.tables[model.TokenEventTableKey], events); err != nil {
+		if err := idx.audit.insert(ctx, idx.tables[model.TokenEventTableKey], packItems(events)); err != nil {
 			log.Errorf("token: %d %sstore events: %v", op.Height, op.Hash, err)
 			continue
 		}
@@ -266,8 +408,15 @@ func (idx *TokenIndex) ConnectBlock(ctx context.Context, block *model.Block, b m
 			log.Errorf("token: %d %s process events: %v", op.Height, op.Hash, err)
 		}
 
-		// resolve metadata for new tokens (call after reconcile which adds TokenRef)
+		// post transfers, mints and burns above alert thresholds
+		idx.alerts.check(ctx, idx.tables[model.TokenMetaTableKey], op, ldgr, events, b)
+
+		// resolve metadata for new tokens (call after reconcile which adds TokenRef),
+		// off-chain resolution is triggered by token_metadata updates instead
 		for _, bal := range upd {
+			if idx.offchain {
+				break
+			}
 			if bal.TokenRef.FirstBlock < op.Height {
 				continue
 			}
@@ -292,6 +441,12 @@ func (idx *TokenIndex) ConnectBlock(ctx context.Context, block *model.Block, b m
 			v.Free()
 		}
 	}
+
+	// record metadata changes last, tokens may be minted after their
+	// metadata was written
+	if err := idx.indexMetaChanges(ctx, metaUpdates); err != nil {
+		log.Errorf("token: %d metadata changes: %v", block.Height, err)
+	}
 	return nil
 }
 
@@ -300,6 +455,8 @@ func (idx *TokenIndex) DisconnectBlock(ctx context.Context, block *model.Block,
 }
 
 func (idx *TokenIndex) DeleteBlock(ctx context.Context, height int64) error {
+	idx.audit.begin(height, true)
+
 	// - rollback owner balances, stats and token stats from events
 	events := idx.tables[model.TokenEventTableKey]
 	owners := idx.tables[model.TokenOwnerTableKey]
@@ -333,10 +490,10 @@ func (idx *TokenIndex) DeleteBlock(ctx context.Context, height int64) error {
 			if !recv.WasZero && recv.Balance.IsZero() {
 				tokn.NumHolders--
 			}
-			if err := owners.Update(ctx, recv); err != nil {
+			if err := idx.audit.update(ctx, owners, recv); err != nil {
 				return fmt.Errorf("save receiver %d: %v", ev.Receiver, err)
 			}
-			if err := tokens.Update(ctx, tokn); err != nil {
+			if err := idx.audit.update(ctx, tokens, tokn); err != nil {
 				return fmt.Errorf("save token %d: %v", ev.Token, err)
 			}
 		case model.TokenEventTypeBurn:
@@ -352,10 +509,10 @@ func (idx *TokenIndex) DeleteBlock(ctx context.Context, height int64) error {
 			if sndr.WasZero && !sndr.Balance.IsZero() {
 				tokn.NumHolders++
 			}
-			if err := owners.Update(ctx, sndr); err != nil {
+			if err := idx.audit.update(ctx, owners, sndr); err != nil {
 				return fmt.Errorf("save sender %d: %v", ev.Sender, err)
 			}
-			if err := tokens.Update(ctx, tokn); err != nil {
+			if err := idx.audit.update(ctx, tokens, tokn); err != nil {
 				return fmt.Errorf("save token %d: %v", ev.Token, err)
 			}
 		case model.TokenEventTypeTransfer:
@@ -363,6 +520,23 @@ func (idx *TokenIndex) DeleteBlock(ctx context.Context, height int64) error {
 			if err != nil {
 				return fmt.Errorf("load sender %d: %v", ev.Sender, err)
 			}
+			if ev.IsSelfTransfer() {
+				// balance and holders were unchanged
+				if ev.Excluded {
+					continue
+				}
+				sndr.NumTransfers--
+				sndr.VolSent = sndr.VolSent.Sub(ev.Amount)
+				sndr.VolRecv = sndr.VolRecv.Sub(ev.Amount)
+				tokn.NumTransfers--
+				if err := idx.audit.update(ctx, owners, sndr); err != nil {
+					return fmt.Errorf("save sender %d: %v", ev.Sender, err)
+				}
+				if err := idx.audit.update(ctx, tokens, tokn); err != nil {
+					return fmt.Errorf("save token %d: %v", ev.Token, err)
+				}
+				continue
+			}
 			recv, err := model.GetTokenOwner(ctx, owners, ev.Receiver, ev.Token)
 			if err != nil {
 				return fmt.Errorf("load receiver %d: %v", ev.Sender, err)
@@ -380,32 +554,84 @@ func (idx *TokenIndex) DeleteBlock(ctx context.Context, height int64) error {
 			if recv.Balance.IsZero() && !recv.WasZero {
 				tokn.NumHolders--
 			}
-			if err := owners.Update(ctx, sndr); err != nil {
+			if err := idx.audit.update(ctx, owners, sndr); err != nil {
 				return fmt.Errorf("save sender %d: %v", ev.Sender, err)
 			}
-			if err := owners.Update(ctx, recv); err != nil {
+			if err := idx.audit.update(ctx, owners, recv); err != nil {
 				return fmt.Errorf("save receiver %d: %v", ev.Receiver, err)
 			}
-			if err := tokens.Update(ctx, tokn); err != nil {
+			if err := idx.audit.update(ctx, tokens, tokn); err != nil {
 				return fmt.Errorf("save token %d: %v", ev.Token, err)
 			}
 		}
 	}
 
 	// - remove events
-	_, err = pack.NewQuery("etl.rollback.remove_token_events").
-		WithTable(events).
-		AndEqual("height", height).
-		Delete(ctx)
+	err = idx.audit.delete(ctx, events, pack.NewQuery("etl.rollback.remove_token_events").
+		AndEqual("height", height))
 	if err != nil {
 		return fmt.Errorf("delete token events: %v", err)
 	}
 
+	// - remove operator updates, earlier updates become current again
+	err = idx.audit.delete(ctx, idx.tables[model.TokenOperatorTableKey], pack.NewQuery("etl.rollback.remove_token_operators").
+		AndEqual("height", height))
+	if err != nil {
+		return fmt.Errorf("delete token operators: %v", err)
+	}
+
+	// - remove pause updates, earlier state becomes current again
+	err = idx.audit.delete(ctx, idx.tables[model.TokenPauseTableKey], pack.NewQuery("etl.rollback.remove_token_pauses").
+		AndEqual("height", height))
+	if err != nil {
+		return fmt.Errorf("delete token pauses: %v", err)
+	}
+
+	// - remove metadata changes
+	err = idx.audit.delete(ctx, idx.tables[model.TokenMetaChangeTableKey], pack.NewQuery("etl.rollback.remove_token_meta_changes").
+		AndEqual("height", height))
+	if err != nil {
+		return fmt.Errorf("delete token metadata changes: %v", err)
+	}
+
 	return nil
 }
 
+// DeleteCycle removes zero balance owner rows that were last active at or
+// before the end of cycle. Token records keep their aggregate stats and
+// owners are recreated with fresh counters when they become active again.
+// Only active when pruning is enabled in config.
 func (idx *TokenIndex) DeleteCycle(ctx context.Context, cycle int64) error {
-	// unused
+	if !idx.prune || idx.params == nil {
+		return nil
+	}
+	owners := idx.tables[model.TokenOwnerTableKey]
+	ids := make([]uint64, 0)
+	ownr := &model.TokenOwner{}
+	err := pack.NewQuery("etl.prune_token_owners").
+		WithTable(owners).
+		WithFields("row_id", "account", "token").
+		AndEqual("balance", mavryk.Zero).
+		AndLte("last_seen", idx.params.CycleEndHeight(cycle)).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(ownr); err != nil {
+				return err
+			}
+			ids = append(ids, ownr.ID())
+			idx.ownerCache.Remove(ownerTokenCacheKey(ownr.Account, ownr.Token))
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("list zero balance owners: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := idx.audit.deleteIds(ctx, owners, ids); err != nil {
+		return fmt.Errorf("delete zero balance owners: %w", err)
+	}
+	prunedTokenOwners.Add(int64(len(ids)))
+	log.Infof("token: pruned %d zero balance owners last active in or before cycle %d", len(ids), cycle)
 	return nil
 }
 
@@ -415,31 +641,243 @@ func (idx *TokenIndex) Flush(ctx context.Context) error {
 			return err
 		}
 	}
+	if err := idx.audit.flush(); err != nil {
+		log.Errorf("Flushing %s audit log: %v", idx.Key(), err)
+	}
 	return nil
 }
 
 func (idx *TokenIndex) OnTaskComplete(ctx context.Context, res *task.TaskResult) error {
-	// check success
-	if res.Status != task.TaskStatusSuccess {
+	table := idx.tables[model.TokenMetaTableKey]
+	meta := &model.TokenMeta{
+		Token:   model.TokenID(res.Flags),
+		Url:     res.Url,
+		Updated: time.Now().UTC(),
+	}
+	switch res.Status {
+	case task.TaskStatusSuccess:
+		// check response is proper JSON
+		if gjson.ValidBytes(res.Data) {
+			meta.Status = model.TokenMetaStatusSuccess
+			meta.Data = res.Data
+		} else {
+			meta.Status = model.TokenMetaStatusInvalid
+		}
+	case task.TaskStatusTimeout:
+		meta.Status = model.TokenMetaStatusTimeout
+	default:
+		meta.Status = model.TokenMetaStatusFailed
+	}
+
+	// store new metadata versions
+	if meta.Status == model.TokenMetaStatusSuccess {
+		if err := idx.audit.insert(ctx, table, meta); err != nil {
+			return fmt.Errorf("token: store token T_%d metadata: %v", res.Flags, err)
+		}
+		idx.alerts.forget(meta.Token)
 		return nil
 	}
 
-	// check response is proper JSON
-	if !gjson.ValidBytes(res.Data) {
+	// on failure keep the last resolved version and only record the attempt
+	last := &model.TokenMeta{}
+	err := pack.NewQuery("etl.token_meta.last").
+		WithTable(table).
+		WithDesc().
+		WithLimit(1).
+		AndEqual("token", meta.Token).
+		Execute(ctx, last)
+	if err != nil {
+		return fmt.Errorf("token: load token T_%d metadata: %v", res.Flags, err)
+	}
+	if last.Id == 0 {
+		err = idx.audit.insert(ctx, table, meta)
+	} else {
+		last.Url, last.Status, last.Updated = meta.Url, meta.Status, meta.Updated
+		err = idx.audit.update(ctx, table, last)
+	}
+	if err != nil {
+		return fmt.Errorf("token: store token T_%d metadata status: %v", res.Flags, err)
+	}
+	return nil
+}
+
+// indexOperators stores FA2 operator updates from a successful call. The
+// owner of all-token operator updates is the direct caller, i.e. the source
+// of internal calls and the signer of external calls.
+func (idx *TokenIndex) indexOperators(ctx context.Context, op *model.Op, ldgr *model.Contract, b model.BlockBuilder) error {
+	var p micheline.Parameters
+	if err := p.UnmarshalBinary(op.Parameters); err != nil {
+		return nil
+	}
+	params := ldgr.ConvertParams(p)
+	callerId := op.SenderId
+	if op.IsInternal {
+		callerId = op.CreatorId
+	}
+	caller, ok := b.AccountById(callerId)
+	if !ok {
+		return fmt.Errorf("missing caller account %d", callerId)
+	}
+	upds, err := model.DecodeOperatorUpdates(params, caller.Address)
+	if err != nil {
+		log.Debugf("token: %d %s decode operators: %v", op.Height, op.Hash, err)
 		return nil
 	}
+	ops := make([]*model.TokenOperator, 0, len(upds))
+	for _, upd := range upds {
+		ownr, err := b.LoadAccountByAddress(ctx, upd.Owner)
+		if err != nil {
+			log.Debugf("token: %d %s operator owner %s: %v", op.Height, op.Hash, upd.Owner, err)
+			continue
+		}
+		oper, err := b.LoadAccountByAddress(ctx, upd.Operator)
+		if err != nil {
+			log.Debugf("token: %d %s operator %s: %v", op.Height, op.Hash, upd.Operator, err)
+			continue
+		}
+		ops = append(ops, &model.TokenOperator{
+			Ledger:    ldgr.AccountId,
+			Owner:     ownr.RowId,
+			Operator:  oper.RowId,
+			TokenId:   upd.TokenId,
+			IsAll:     upd.IsAll,
+			IsGranted: upd.IsGranted,
+			Height:    op.Height,
+			Time:      op.Timestamp,
+			OpId:      op.RowId,
+		})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return idx.audit.insert(ctx, idx.tables[model.TokenOperatorTableKey], packItems(ops))
+}
 
-	// store metadata update
-	meta := &model.TokenMeta{
-		Token: model.TokenID(res.Flags),
-		Data:  res.Data,
+// indexPauses stores pause state changes from a successful call to one of
+// the configured pause or unpause entrypoints.
+func (idx *TokenIndex) indexPauses(ctx context.Context, op *model.Op, ldgr *model.Contract) error {
+	var p micheline.Parameters
+	if err := p.UnmarshalBinary(op.Parameters); err != nil {
+		return nil
+	}
+	upds := model.DecodePauseUpdates(ldgr.ConvertParams(p), idx.pauseEps, idx.unpauseEps)
+	if len(upds) == 0 {
+		return nil
+	}
+	rows := make([]*model.TokenPause, len(upds))
+	for i, upd := range upds {
+		rows[i] = &model.TokenPause{
+			Ledger:   ldgr.AccountId,
+			TokenId:  upd.TokenId,
+			IsAll:    upd.IsAll,
+			IsPaused: upd.IsPaused,
+			Height:   op.Height,
+			Time:     op.Timestamp,
+			OpId:     op.RowId,
+		}
 	}
+	return idx.audit.insert(ctx, idx.tables[model.TokenPauseTableKey], packItems(rows))
+}
+
+// tokenMetaUpdate is a write to a token_metadata bigmap entry, hash is
+// zero on removal.
+type tokenMetaUpdate struct {
+	ledger  *model.Contract
+	tokenId mavryk.Z
+	bigmap  int64
+	hash    mavryk.ExprHash
+	op      *model.Op
+}
 
-	if err := idx.tables[model.TokenMetaTableKey].Insert(ctx, meta); err != nil {
-		return fmt.Errorf("token: store token T_%d metadata: %v", res.Flags, err)
+// indexMetaChanges stores metadata writes that change the value of a known
+// token. Writes for tokens that were never minted and writes that repeat
+// the current value are skipped.
+func (idx *TokenIndex) indexMetaChanges(ctx context.Context, upds []tokenMetaUpdate) error {
+	if len(upds) == 0 {
+		return nil
 	}
+	table := idx.tables[model.TokenMetaChangeTableKey]
+	last := make(map[model.TokenID]mavryk.ExprHash)
+	rows := make([]*model.TokenMetaChange, 0, len(upds))
+	for _, upd := range upds {
+		tokn, err := model.GetToken(ctx, idx.tables[model.TokenTableKey], upd.ledger, upd.tokenId)
+		if err != nil {
+			continue
+		}
+		id := tokn.Id
+		tokn.Free()
+		prev, ok := last[id]
+		if !ok {
+			c := &model.TokenMetaChange{}
+			err := pack.NewQuery("etl.find_token_meta_change").
+				WithTable(table).
+				AndEqual("token", id).
+				WithDesc().
+				WithLimit(1).
+				Execute(ctx, c)
+			if err != nil {
+				return err
+			}
+			prev = c.NewHash
+		}
+		if prev.Equal(upd.hash) {
+			continue
+		}
+		rows = append(rows, &model.TokenMetaChange{
+			Token:    id,
+			BigmapId: upd.bigmap,
+			OldHash:  prev,
+			NewHash:  upd.hash,
+			Height:   upd.op.Height,
+			Time:     upd.op.Timestamp,
+			OpId:     upd.op.RowId,
+		})
+		last[id] = upd.hash
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return idx.audit.insert(ctx, table, packItems(rows))
+}
 
-	return nil
+// ledgerAdmins returns the ledger creator unless it is a contract (e.g.
+// a factory) and all active role holders when the role index is enabled.
+// The result is non-nil.
+func (idx *TokenIndex) ledgerAdmins(ctx context.Context, ldgr *model.Contract, b model.BlockBuilder) []mavryk.Address {
+	admins := make([]mavryk.Address, 0)
+	if ldgr.CreatorId > 0 {
+		creator, ok := b.AccountById(ldgr.CreatorId)
+		if !ok {
+			if table, err := b.Table(model.AccountTableKey); err == nil {
+				creator = &model.Account{}
+				err = pack.NewQuery("etl.find_creator").
+					WithTable(table).
+					AndEqual("row_id", ldgr.CreatorId).
+					Execute(ctx, creator)
+				if err != nil {
+					log.Errorf("token: loading creator %d of %s: %v", ldgr.CreatorId, ldgr.Address, err)
+				}
+			}
+		}
+		if creator != nil && creator.RowId > 0 && !creator.IsContract {
+			admins = append(admins, creator.Address)
+		}
+	}
+	if table, err := b.Table(model.ContractRoleTableKey); err == nil {
+		roles := make([]*model.ContractRole, 0)
+		err := pack.NewQuery("etl.list_roles").
+			WithTable(table).
+			AndEqual("contract", ldgr.AccountId).
+			AndEqual("last_height", 0).
+			Execute(ctx, &roles)
+		if err != nil {
+			log.Errorf("token: loading roles of %s: %v", ldgr.Address, err)
+		}
+		for _, v := range roles {
+			admins = append(admins, v.Address)
+		}
+	}
+	return admins
 }
 
 func (idx *TokenIndex) reconcileEvents(
@@ -761,10 +1199,12 @@ func (idx *TokenIndex) processEvents(ctx context.Context, events []*model.TokenE
 			ev.TokenRef.Supply = ev.TokenRef.Supply.Sub(ev.Amount)
 			ev.TokenRef.TotalBurn = ev.TokenRef.TotalBurn.Add(ev.Amount)
 		case model.TokenEventTypeTransfer:
-			ev.TokenRef.NumTransfers++
+			if !ev.Excluded {
+				ev.TokenRef.NumTransfers++
+			}
 		}
 
-		if err := idx.tables[model.TokenTableKey].Update(ctx, ev.TokenRef); err != nil {
+		if err := idx.audit.update(ctx, idx.tables[model.TokenTableKey], ev.TokenRef); err != nil {
 			return fmt.Errorf("T_%d supply update: %w", ev.TokenRef.Id, err)
 		}
 	}
@@ -791,6 +1231,20 @@ func (idx *TokenIndex) updateOwnership(ctx context.Context, ev *model.TokenEvent
 		recv.WasZero = recv.Balance.IsZero() // used in holder update
 	}
 
+	idx.applyEvent(ev, sndr, recv)
+
+	_ = idx.audit.update(ctx, idx.tables[model.TokenOwnerTableKey], sndr)
+	if sndr.Id != recv.Id {
+		_ = idx.audit.update(ctx, idx.tables[model.TokenOwnerTableKey], recv)
+	}
+
+	return nil
+}
+
+// applyEvent updates owner balances, running stats and the holder count of
+// the event's token. Sender and receiver are the same owner on mints, burns
+// and self-transfers.
+func (idx *TokenIndex) applyEvent(ev *model.TokenEvent, sndr, recv *model.TokenOwner) {
 	switch ev.Type {
 	case model.TokenEventTypeMint:
 		// owner table
@@ -813,6 +1267,15 @@ func (idx *TokenIndex) updateOwnership(ctx context.Context, ev *model.TokenEvent
 		}
 
 	case model.TokenEventTypeTransfer:
+		if ev.IsSelfTransfer() {
+			// balance and holders are unchanged
+			if !ev.Excluded {
+				sndr.VolSent = sndr.VolSent.Add(ev.Amount)
+				sndr.VolRecv = sndr.VolRecv.Add(ev.Amount)
+				sndr.NumTransfers++
+			}
+			break
+		}
 		// owner table
 		sndr.VolSent = sndr.VolSent.Add(ev.Amount)
 		sndr.NumTransfers++
@@ -828,13 +1291,6 @@ func (idx *TokenIndex) updateOwnership(ctx context.Context, ev *model.TokenEvent
 			ev.TokenRef.NumHolders++
 		}
 	}
-
-	_ = idx.tables[model.TokenOwnerTableKey].Update(ctx, sndr)
-	if sndr.Id != recv.Id {
-		_ = idx.tables[model.TokenOwnerTableKey].Update(ctx, recv)
-	}
-
-	return nil
 }
 
 func tokenCacheKey(a mavryk.Address, id mavryk.Z) uint64 {
@@ -850,8 +1306,24 @@ func (idx *TokenIndex) getOrCreateToken(ctx context.Context, ledger *model.Contr
 	if ok && itok.Ledger == ledger.AccountId {
 		return itok, nil
 	}
-	tokn, err := model.GetOrCreateToken(ctx, idx.tables[model.TokenTableKey], ledger, signer, tokenId, height, tm)
-	if err != nil {
+	table := idx.tables[model.TokenTableKey]
+	tokn, err := model.GetToken(ctx, table, ledger, tokenId)
+	switch err {
+	case nil:
+	case model.ErrNoToken:
+		tokn = model.NewToken()
+		tokn.Ledger = ledger.AccountId
+		tokn.TokenId = tokenId
+		tokn.TokenId64 = tokenId.Int64()
+		tokn.Creator = signer.RowId
+		tokn.Type = ledger.LedgerType
+		tokn.FirstBlock = height
+		tokn.FirstTime = tm
+		if err := idx.audit.insert(ctx, table, tokn); err != nil {
+			tokn.Free()
+			return nil, err
+		}
+	default:
 		return nil, err
 	}
 	idx.tokenCache.Add(key, tokn)
@@ -879,8 +1351,21 @@ func (idx *TokenIndex) getOrCreateOwner(ctx context.Context, ownerId model.Accou
 	if ok {
 		return iOwner, nil
 	}
-	ownr, err := model.GetOrCreateOwner(ctx, idx.tables[model.TokenOwnerTableKey], ownerId, tokenId, ledgerId)
-	if err != nil {
+	table := idx.tables[model.TokenOwnerTableKey]
+	ownr, err := model.GetTokenOwner(ctx, table, ownerId, tokenId)
+	switch err {
+	case nil:
+	case model.ErrNoTokenOwner:
+		ownr = model.NewTokenOwner()
+		ownr.Account = ownerId
+		ownr.Token = tokenId
+		ownr.Ledger = ledgerId
+		ownr.WasZero = true
+		if err := idx.audit.insert(ctx, table, ownr); err != nil {
+			ownr.Free()
+			return nil, err
+		}
+	default:
 		return nil, err
 	}
 	if ownr.Id > 0 {
@@ -0,0 +1,300 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/echa/config"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+var tokenAlertStats = expvar.NewMap("token_alerts")
+
+const tokenAlertQueueSize = 1024
+
+// tokenAlerts evaluates alert rules (config key `token.alerts`) on new token
+// events and posts events exceeding a rule's threshold to its webhook.
+// Delivery runs in the background and never blocks indexing, alerts are
+// dropped when the delivery queue is full. Recently fired alerts are
+// remembered, so events replayed after a reorg do not fire again. All
+// methods are safe to call on nil, which disables alerts.
+type tokenAlerts struct {
+	rules    []model.TokenAlertRule
+	maxAge   time.Duration
+	client   *http.Client
+	fired    *lru.Cache[uint64, struct{}]   // recently fired alerts
+	decimals *lru.Cache[model.TokenID, int] // metadata decimals, -1 = unknown
+	seen     map[uint64]int                 // identical events in the current block
+	queue    chan tokenAlertRequest
+	cancel   context.CancelFunc
+}
+
+type tokenAlertRequest struct {
+	url   string
+	alert model.TokenAlert
+}
+
+func newTokenAlerts() *tokenAlerts {
+	if config.GetInterface("token.alerts") == nil {
+		return nil
+	}
+	var cfg struct {
+		Alerts []model.TokenAlertRule `json:"alerts"`
+	}
+	if err := config.Unmarshal("token", &cfg); err != nil {
+		log.Errorf("Reading token alert rules: %v", err)
+		return nil
+	}
+	a := &tokenAlerts{
+		maxAge: config.GetDuration("token.alert_max_age"),
+		client: &http.Client{Timeout: config.GetDuration("token.alert_timeout")},
+		seen:   make(map[uint64]int),
+	}
+	url := config.GetString("token.alert_url")
+	for i, r := range cfg.Alerts {
+		if err := r.Parse(); err != nil {
+			log.Errorf("Skipping token alert rule %d %q: %v", i, r.Name, err)
+			continue
+		}
+		if r.Url == "" {
+			r.Url = url
+		}
+		if r.Url == "" {
+			log.Errorf("Skipping token alert rule %d %q: missing webhook url", i, r.Name)
+			continue
+		}
+		a.rules = append(a.rules, r)
+	}
+	if len(a.rules) == 0 {
+		return nil
+	}
+	a.fired, _ = lru.New[uint64, struct{}](1 << 16)      // 64k
+	a.decimals, _ = lru.New[model.TokenID, int](1 << 14) // 16k
+	return a
+}
+
+// start runs webhook delivery in the background.
+func (a *tokenAlerts) start() {
+	if a == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.queue = make(chan tokenAlertRequest, tokenAlertQueueSize)
+	go a.run(ctx, a.queue)
+}
+
+// stop cancels delivery, queued alerts are lost.
+func (a *tokenAlerts) stop() {
+	if a == nil || a.cancel == nil {
+		return
+	}
+	a.cancel()
+	a.cancel = nil
+	if n := len(a.queue); n > 0 {
+		log.Warnf("token: dropping %d undelivered alerts on shutdown", n)
+	}
+}
+
+func (a *tokenAlerts) run(ctx context.Context, queue <-chan tokenAlertRequest) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-queue:
+			if err := a.post(ctx, req); err != nil {
+				tokenAlertStats.Add("failed", 1)
+				log.Warnf("token: alert %q webhook: %v", req.alert.Rule, err)
+				continue
+			}
+			tokenAlertStats.Add("sent", 1)
+		}
+	}
+}
+
+func (a *tokenAlerts) post(ctx context.Context, req tokenAlertRequest) error {
+	buf, err := json.Marshal(req.alert)
+	if err != nil {
+		return err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.url, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// begin resets per-block state.
+func (a *tokenAlerts) begin() {
+	if a == nil {
+		return
+	}
+	clear(a.seen)
+}
+
+// forget drops cached decimals after token metadata has changed.
+func (a *tokenAlerts) forget(id model.TokenID) {
+	if a == nil {
+		return
+	}
+	a.decimals.Remove(id)
+}
+
+// check evaluates all rules on completed events of a ledger call.
+func (a *tokenAlerts) check(ctx context.Context, meta *pack.Table, op *model.Op, ldgr *model.Contract, events []*model.TokenEvent, b model.BlockBuilder) {
+	if a == nil {
+		return
+	}
+	// skip old blocks while catching up
+	if a.maxAge > 0 && time.Since(op.Timestamp) > a.maxAge {
+		return
+	}
+	for _, ev := range events {
+		if ev.TokenRef == nil {
+			continue
+		}
+		var (
+			sender, receiver *mavryk.Address
+			key              uint64
+		)
+		for i, r := range a.rules {
+			if !r.Match(ldgr.Address, ev.TokenRef.TokenId, ev.Type) {
+				continue
+			}
+			dec, ok := a.tokenDecimals(ctx, meta, r, ev.Token)
+			if !ok {
+				tokenAlertStats.Add("no_decimals", 1)
+				continue
+			}
+			if !r.Exceeds(ev.Amount, dec) {
+				continue
+			}
+
+			// identify the event independent of row ids and block position
+			// which change when the operation is replayed after a reorg
+			if key == 0 {
+				sender = lookupAddress(ev.Sender, b)
+				receiver = lookupAddress(ev.Receiver, b)
+				key = a.eventKey(op, ldgr, ev, sender, receiver)
+			}
+			ruleKey := key ^ uint64(i+1)*0x9e3779b97f4a7c15
+			if _, ok := a.fired.Get(ruleKey); ok {
+				tokenAlertStats.Add("suppressed", 1)
+				continue
+			}
+			a.fired.Add(ruleKey, struct{}{})
+
+			req := tokenAlertRequest{
+				url: r.Url,
+				alert: model.TokenAlert{
+					Rule:      r.Name,
+					Type:      ev.Type,
+					Contract:  ldgr.Address,
+					TokenId:   ev.TokenRef.TokenId,
+					Amount:    ev.Amount,
+					Value:     ev.Amount.Decimals(dec),
+					Threshold: r.Threshold,
+					Decimals:  dec,
+					Sender:    sender,
+					Receiver:  receiver,
+					Height:    op.Height,
+					Time:      op.Timestamp,
+					OpHash:    op.Hash,
+				},
+			}
+			select {
+			case a.queue <- req:
+				tokenAlertStats.Add("fired", 1)
+			default:
+				tokenAlertStats.Add("dropped", 1)
+				log.Warnf("token: dropping alert %q for %s, webhook queue full", r.Name, op.Hash)
+			}
+		}
+	}
+}
+
+// eventKey hashes event content and counts identical events in the same
+// operation, e.g. repeated transfers in a batch.
+func (a *tokenAlerts) eventKey(op *model.Op, ldgr *model.Contract, ev *model.TokenEvent, sender, receiver *mavryk.Address) uint64 {
+	h := fnv.New64a()
+	h.Write(op.Hash[:])
+	h.Write(ldgr.Address.Encode())
+	h.Write([]byte(ev.TokenRef.TokenId.String()))
+	h.Write([]byte{byte(ev.Type)})
+	for _, addr := range []*mavryk.Address{sender, receiver} {
+		if addr != nil {
+			h.Write(addr.Encode())
+		}
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(ev.Amount.String()))
+	sig := h.Sum64()
+	n := a.seen[sig]
+	a.seen[sig] = n + 1
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	h.Write(buf[:])
+	return h.Sum64()
+}
+
+// tokenDecimals returns a rule's decimals override or decimals from the
+// latest token metadata.
+func (a *tokenAlerts) tokenDecimals(ctx context.Context, meta *pack.Table, r model.TokenAlertRule, id model.TokenID) (int, bool) {
+	if r.Decimals != nil {
+		return *r.Decimals, true
+	}
+	if d, ok := a.decimals.Get(id); ok {
+		return d, d >= 0
+	}
+	d := -1
+	md := &model.TokenMeta{}
+	err := pack.NewQuery("etl.token_meta.decimals").
+		WithTable(meta).
+		WithDesc().
+		WithLimit(1).
+		AndEqual("token", id).
+		Execute(ctx, md)
+	if err == nil {
+		if v, ok := model.ParseTokenDecimals(md.Data); ok {
+			d = v
+		}
+	}
+	a.decimals.Add(id, d)
+	return d, d >= 0
+}
+
+func lookupAddress(id model.AccountID, b model.BlockBuilder) *mavryk.Address {
+	if id == 0 {
+		return nil
+	}
+	acc, ok := b.AccountById(id)
+	if !ok {
+		return nil
+	}
+	addr := acc.Address.Clone()
+	return &addr
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+type alertTestBuilder struct {
+	model.BlockBuilder
+	accounts map[model.AccountID]*model.Account
+}
+
+func (b alertTestBuilder) AccountById(id model.AccountID) (*model.Account, bool) {
+	a, ok := b.accounts[id]
+	return a, ok
+}
+
+func TestTokenAlertsReplay(t *testing.T) {
+	got := make(chan model.TokenAlert, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a model.TokenAlert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		got <- a
+	}))
+	defer srv.Close()
+
+	dec := 6
+	rule := model.TokenAlertRule{Name: "large", Threshold: "100", Decimals: &dec, Url: srv.URL}
+	if err := rule.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	a := &tokenAlerts{
+		rules:  []model.TokenAlertRule{rule},
+		client: srv.Client(),
+		seen:   make(map[uint64]int),
+	}
+	a.fired, _ = lru.New[uint64, struct{}](16)
+	a.start()
+	defer a.stop()
+
+	ctx := context.Background()
+	ldgr := &model.Contract{Address: mavryk.NewAddress(mavryk.AddressTypeContract, make([]byte, 20))}
+	b := alertTestBuilder{accounts: map[model.AccountID]*model.Account{
+		1: {RowId: 1, Address: mavryk.NewAddress(mavryk.AddressTypeEd25519, make([]byte, 20))},
+		2: {RowId: 2, Address: mavryk.NewAddress(mavryk.AddressTypeEd25519, []byte("01234567890123456789"))},
+	}}
+	op := &model.Op{Height: 10, Timestamp: time.Now()}
+	tokn := &model.Token{Id: 1, TokenId: mavryk.NewZ(0)}
+	events := func() []*model.TokenEvent {
+		// two identical large transfers in a batch and a small transfer
+		return []*model.TokenEvent{
+			{Type: model.TokenEventTypeTransfer, Token: 1, Sender: 1, Receiver: 2, Amount: mavryk.NewZ(150_000000), TokenRef: tokn},
+			{Type: model.TokenEventTypeTransfer, Token: 1, Sender: 1, Receiver: 2, Amount: mavryk.NewZ(150_000000), TokenRef: tokn},
+			{Type: model.TokenEventTypeTransfer, Token: 1, Sender: 1, Receiver: 2, Amount: mavryk.NewZ(100_000000), TokenRef: tokn},
+		}
+	}
+
+	// connect, then replay the same operation after a reorg with new
+	// account ids and at a new height
+	a.begin()
+	a.check(ctx, nil, op, ldgr, events(), b)
+	b.accounts[3], b.accounts[4] = b.accounts[1], b.accounts[2]
+	replay := events()
+	for _, ev := range replay {
+		ev.Sender, ev.Receiver = 3, 4
+	}
+	op.Height++
+	a.begin()
+	a.check(ctx, nil, op, ldgr, replay, b)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-got:
+			if v.Rule != "large" || v.Value != "150.000000" || v.Decimals != 6 || v.Height != 10 {
+				t.Errorf("unexpected alert %+v", v)
+			}
+			if v.Sender == nil || !v.Sender.Equal(b.accounts[1].Address) {
+				t.Errorf("unexpected sender %v", v.Sender)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 2 alerts, got %d", i)
+		}
+	}
+	select {
+	case v := <-got:
+		t.Errorf("unexpected alert on replay %+v", v)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
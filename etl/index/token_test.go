@@ -0,0 +1,221 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestSelfTransfer(t *testing.T) {
+	for _, exclude := range []bool{false, true} {
+		idx := &TokenIndex{excludeSelf: exclude}
+		tokn := &model.Token{NumHolders: 1}
+		ownr := &model.TokenOwner{Id: 1, Account: 7, Balance: mavryk.NewZ(100)}
+		ev := &model.TokenEvent{
+			Type:     model.TokenEventTypeTransfer,
+			Sender:   7,
+			Receiver: 7,
+			Amount:   mavryk.NewZ(100),
+			TokenRef: tokn,
+		}
+		ev.Excluded = exclude && ev.IsSelfTransfer()
+		idx.applyEvent(ev, ownr, ownr)
+
+		if got := ownr.Balance.Int64(); got != 100 {
+			t.Errorf("exclude=%t: balance changed to %d", exclude, got)
+		}
+		if tokn.NumHolders != 1 {
+			t.Errorf("exclude=%t: holders changed to %d", exclude, tokn.NumHolders)
+		}
+		wantXfers := 1
+		if exclude {
+			wantXfers = 0
+		}
+		if ownr.NumTransfers != wantXfers {
+			t.Errorf("exclude=%t: owner transfers %d, want %d", exclude, ownr.NumTransfers, wantXfers)
+		}
+		if exclude && !ownr.VolSent.IsZero() {
+			t.Errorf("exclude=%t: volume counted", exclude)
+		}
+	}
+
+	// regular transfers are not flagged
+	ev := model.TokenEvent{Type: model.TokenEventTypeTransfer, Sender: 1, Receiver: 2}
+	if ev.IsSelfTransfer() {
+		t.Errorf("regular transfer flagged as self-transfer")
+	}
+}
+
+func TestSelfTransferRollback(t *testing.T) {
+	dir := t.TempDir()
+	idx := NewTokenIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	// a self-transfer counted while exclusion was disabled
+	tokn := &model.Token{Ledger: 5, TokenId: mavryk.NewZ(1), TokenId64: 1, NumTransfers: 1}
+	if err := idx.tables[model.TokenTableKey].Insert(ctx, tokn); err != nil {
+		t.Fatal(err)
+	}
+	ownr := &model.TokenOwner{
+		Account:      7,
+		Ledger:       5,
+		Token:        tokn.Id,
+		Balance:      mavryk.NewZ(100),
+		VolSent:      mavryk.NewZ(100),
+		VolRecv:      mavryk.NewZ(100),
+		NumTransfers: 1,
+	}
+	if err := idx.tables[model.TokenOwnerTableKey].Insert(ctx, ownr); err != nil {
+		t.Fatal(err)
+	}
+	ev := &model.TokenEvent{
+		Ledger:   5,
+		Token:    tokn.Id,
+		Type:     model.TokenEventTypeTransfer,
+		Sender:   7,
+		Receiver: 7,
+		Amount:   mavryk.NewZ(100),
+		Height:   10,
+	}
+	if err := idx.tables[model.TokenEventTableKey].Insert(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+
+	// rollback after enabling exclusion reverts the counted transfer
+	idx.excludeSelf = true
+	if err := idx.DeleteBlock(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	o, err := model.GetTokenOwner(ctx, idx.tables[model.TokenOwnerTableKey], 7, tokn.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.NumTransfers != 0 || !o.VolSent.IsZero() || !o.VolRecv.IsZero() {
+		t.Errorf("owner not rolled back: transfers=%d sent=%s recv=%s", o.NumTransfers, o.VolSent, o.VolRecv)
+	}
+	if got := o.Balance.Int64(); got != 100 {
+		t.Errorf("balance changed to %d", got)
+	}
+	tk, err := idx.findTokenId(ctx, tokn.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk.NumTransfers != 0 {
+		t.Errorf("token transfers %d, want 0", tk.NumTransfers)
+	}
+}
+
+func TestTokenMetaChanges(t *testing.T) {
+	dir := t.TempDir()
+	idx := NewTokenIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	ctx := context.Background()
+	ldgr := &model.Contract{AccountId: 5}
+	tokn := &model.Token{Ledger: 5, TokenId: mavryk.NewZ(1), TokenId64: 1}
+	if err := idx.tables[model.TokenTableKey].Insert(ctx, tokn); err != nil {
+		t.Fatal(err)
+	}
+
+	info := func(uri string) mavryk.ExprHash {
+		return model.TokenInfoHash(micheline.NewPair(
+			micheline.NewNat(mavryk.NewZ(1).Big()),
+			micheline.NewMap(micheline.NewMapElem(micheline.NewString(""), micheline.NewBytes([]byte(uri)))),
+		))
+	}
+	write := func(height int64, id int64, hash mavryk.ExprHash) tokenMetaUpdate {
+		return tokenMetaUpdate{
+			ledger:  ldgr,
+			tokenId: mavryk.NewZ(id),
+			bigmap:  9,
+			hash:    hash,
+			op:      &model.Op{Height: height, RowId: model.OpID(height)},
+		}
+	}
+	placeholder, revealed := info("ipfs://placeholder"), info("ipfs://art")
+
+	// first write, unchanged rewrite and unknown token in one block
+	err := idx.indexMetaChanges(ctx, []tokenMetaUpdate{
+		write(10, 1, placeholder),
+		write(10, 1, placeholder),
+		write(10, 2, placeholder),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reveal and removal
+	if err := idx.indexMetaChanges(ctx, []tokenMetaUpdate{write(11, 1, revealed)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.indexMetaChanges(ctx, []tokenMetaUpdate{write(12, 1, mavryk.ExprHash{})}); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func() []*model.TokenMetaChange {
+		t.Helper()
+		res := make([]*model.TokenMetaChange, 0)
+		err := pack.NewQuery("test").
+			WithTable(idx.tables[model.TokenMetaChangeTableKey]).
+			AndEqual("token", tokn.Id).
+			Execute(ctx, &res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	changes := list()
+	want := []struct {
+		height   int64
+		old, new mavryk.ExprHash
+	}{
+		{10, mavryk.ExprHash{}, placeholder},
+		{11, placeholder, revealed},
+		{12, revealed, mavryk.ExprHash{}},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("want %d changes, got %d", len(want), len(changes))
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Height != w.height || !c.OldHash.Equal(w.old) || !c.NewHash.Equal(w.new) {
+			t.Errorf("change %d: got height=%d old=%s new=%s", i, c.Height, c.OldHash, c.NewHash)
+		}
+	}
+	if !changes[2].IsRemove() {
+		t.Errorf("change 2: not flagged as removal")
+	}
+
+	// rollback removes the block's changes and the removal can be replayed
+	if err := idx.DeleteBlock(ctx, 12); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(list()); n != 2 {
+		t.Fatalf("after rollback: want 2 changes, got %d", n)
+	}
+	if err := idx.indexMetaChanges(ctx, []tokenMetaUpdate{write(12, 1, mavryk.ExprHash{})}); err != nil {
+		t.Fatal(err)
+	}
+	if changes := list(); len(changes) != 3 || !changes[2].OldHash.Equal(revealed) {
+		t.Errorf("replay: unexpected changes %d", len(changes))
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/echa/config"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/etl/task"
+)
+
+const UpgradeIndexKey = "upgrade"
+
+// UpgradeIndex tracks implementation changes of upgradeable proxy contracts
+// using configured storage layout patterns (config key `upgrade.patterns`).
+type UpgradeIndex struct {
+	db       *pack.DB
+	table    *pack.Table
+	patterns []model.UpgradePattern
+}
+
+var _ model.BlockIndexer = (*UpgradeIndex)(nil)
+
+func NewUpgradeIndex() *UpgradeIndex {
+	idx := &UpgradeIndex{}
+	if config.GetInterface("upgrade.patterns") == nil {
+		return idx
+	}
+	var cfg struct {
+		Patterns []model.UpgradePattern `json:"patterns"`
+	}
+	if err := config.Unmarshal("upgrade", &cfg); err != nil {
+		log.Errorf("Reading upgrade patterns: %v", err)
+		return idx
+	}
+	idx.patterns = cfg.Patterns
+	return idx
+}
+
+// IsEnabled returns true when at least one upgrade pattern is configured.
+func (idx *UpgradeIndex) IsEnabled() bool {
+	return len(idx.patterns) > 0
+}
+
+func (idx *UpgradeIndex) DB() *pack.DB {
+	return idx.db
+}
+
+func (idx *UpgradeIndex) Tables() []*pack.Table {
+	return []*pack.Table{idx.table}
+}
+
+func (idx *UpgradeIndex) Key() string {
+	return UpgradeIndexKey
+}
+
+func (idx *UpgradeIndex) Name() string {
+	return UpgradeIndexKey + " index"
+}
+
+func (idx *UpgradeIndex) Create(path, label string, opts interface{}) error {
+	db, err := pack.CreateDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return fmt.Errorf("creating %s database: %w", idx.Key(), err)
+	}
+	defer db.Close()
+
+	m := model.ContractUpgrade{}
+	key := m.TableKey()
+	fields, err := pack.Fields(m)
+	if err != nil {
+		return fmt.Errorf("reading fields for table %q from type %T: %v", key, m, err)
+	}
+
+	_, err = db.CreateTableIfNotExists(key, fields, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+	return err
+}
+
+func (idx *UpgradeIndex) Init(path, label string, opts interface{}) error {
+	db, err := pack.OpenDatabase(path, idx.Key(), label, opts)
+	if err != nil {
+		return err
+	}
+	idx.db = db
+
+	m := model.ContractUpgrade{}
+	key := m.TableKey()
+
+	idx.table, err = idx.db.Table(key, m.TableOpts().Merge(model.ReadConfigOpts(key)))
+	if err != nil {
+		idx.Close()
+		return err
+	}
+	return nil
+}
+
+func (idx *UpgradeIndex) FinalizeSync(ctx context.Context) error {
+	return nil
+}
+
+func (idx *UpgradeIndex) Close() error {
+	for _, v := range idx.Tables() {
+		if v != nil {
+			if err := v.Close(); err != nil {
+				log.Errorf("Closing %s table: %s", v.Name(), err)
+			}
+		}
+	}
+	idx.table = nil
+	if idx.db != nil {
+		if err := idx.db.Close(); err != nil {
+			return err
+		}
+		idx.db = nil
+	}
+	return nil
+}
+
+func (idx *UpgradeIndex) ConnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	// current implementation per contract, updated as we go through the block
+	impls := make(map[model.AccountID]mavryk.Address)
+	ins := make([]pack.Item, 0)
+	for _, op := range block.Ops {
+		if !op.IsSuccess || op.Contract == nil {
+			continue
+		}
+		var pattern *model.UpgradePattern
+		for i := range idx.patterns {
+			if idx.patterns[i].Match(op.Contract) {
+				pattern = &idx.patterns[i]
+				break
+			}
+		}
+		if pattern == nil {
+			continue
+		}
+
+		// storage proxies change on storage update, bigmap proxies on
+		// bigmap updates which do not necessarily change storage
+		storage := op.Storage
+		if pattern.Key == "" {
+			if !op.IsStorageUpdate {
+				continue
+			}
+		} else {
+			if len(op.BigmapEvents) == 0 {
+				continue
+			}
+			if len(storage) == 0 {
+				storage = op.Contract.Storage
+			}
+		}
+		_, styp, err := op.Contract.LoadType()
+		if err != nil {
+			log.Warnf("upgrade: %s storage type: %v", op.Contract, err)
+			continue
+		}
+		impl, ok := pattern.Implementation(styp, storage, op.BigmapEvents)
+		if !ok {
+			continue
+		}
+
+		id := op.Contract.AccountId
+		prev, ok := impls[id]
+		if !ok {
+			prev, err = idx.lastImplementation(ctx, id)
+			if err != nil {
+				return fmt.Errorf("upgrade: %w", err)
+			}
+		}
+		if prev.Equal(impl) {
+			continue
+		}
+		impls[id] = impl
+		ins = append(ins, &model.ContractUpgrade{
+			Contract:       id,
+			Implementation: impl,
+			Previous:       prev,
+			Height:         block.Height,
+			Time:           block.Timestamp,
+			OpId:           op.RowId,
+		})
+	}
+
+	if len(ins) > 0 {
+		if err := idx.table.Insert(ctx, ins); err != nil {
+			return fmt.Errorf("upgrade: insert: %w", err)
+		}
+	}
+	return nil
+}
+
+func (idx *UpgradeIndex) lastImplementation(ctx context.Context, id model.AccountID) (mavryk.Address, error) {
+	var last model.ContractUpgrade
+	err := pack.NewQuery("etl.last_upgrade").
+		WithTable(idx.table).
+		WithDesc().
+		WithLimit(1).
+		AndEqual("contract", id).
+		Execute(ctx, &last)
+	if err != nil {
+		return mavryk.InvalidAddress, err
+	}
+	return last.Implementation, nil
+}
+
+func (idx *UpgradeIndex) DisconnectBlock(ctx context.Context, block *model.Block, _ model.BlockBuilder) error {
+	return idx.DeleteBlock(ctx, block.Height)
+}
+
+func (idx *UpgradeIndex) DeleteBlock(ctx context.Context, height int64) error {
+	_, err := pack.NewQuery("etl.delete").
+		WithTable(idx.table).
+		AndEqual("height", height).
+		Delete(ctx)
+	return err
+}
+
+func (idx *UpgradeIndex) DeleteCycle(ctx context.Context, cycle int64) error {
+	return nil
+}
+
+func (idx *UpgradeIndex) Flush(ctx context.Context) error {
+	for _, v := range idx.Tables() {
+		if err := v.Flush(ctx); err != nil {
+			log.Errorf("Flushing %s table: %v", v.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (idx *UpgradeIndex) OnTaskComplete(_ context.Context, _ *task.TaskResult) error {
+	// unused
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/store"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/mavryk-network/mvgo/mavryk"
 	"github.com/mavryk-network/mvindex/etl/cache"
 	"github.com/mavryk-network/mvindex/etl/index"
@@ -25,20 +26,40 @@ type IndexerConfig struct {
 	StateDB   store.DB
 	Indexes   []model.BlockIndexer
 	LightMode bool
+	ReadOnly  bool // read replica, databases are written by another process
+
+	// operation types the builder skips, see Builder.AppendRegularBlockOps
+	SkipOps model.OpTypeList
+
+	// max number of decoded bigmap values to cache for API calls, 0 = off
+	BigmapValueCacheSize int
+
+	// number of workers decoding bigmap keys and values on large API scans,
+	// 0 or 1 = decode serially
+	BigmapDecodeWorkers int
 }
 
 // Indexer defines an index manager that manages and stores multiple indexes.
 type Indexer struct {
 	mu             sync.Mutex
-	blocks         atomic.Value              // cache for all block hashes and timestamps
-	ranks          atomic.Value              // top addresses (>10tez, 100k = 10 MB)
-	rights         atomic.Value              // bitset 400 (bakers) * 6 (cycles) * 4096 (blocks) * 33 (rights)
-	addrs          atomic.Value              // all on-chain address hashes by id
-	proposals      atomic.Value              // gov proposals/protocol hashes by id
-	bigmap_values  *cache.BigmapHistoryCache // bigmap history cache
-	bigmap_types   *cache.BigmapCache        // bigmap allocs
-	contract_types *cache.ContractTypeCache  // contract type data
-	ticket_types   *cache.TicketCache        // ticket type data
+	wmu            sync.Mutex                 // serializes block writes and manual flushes
+	gmu            sync.Mutex                 // protects read replica generations
+	gen            *Indexer                   // current read replica generation
+	refs           int                        // API calls using this generation
+	cfg            IndexerConfig              // opens new read replica generations
+	blocks         atomic.Value               // cache for all block hashes and timestamps
+	ranks          atomic.Value               // top addresses (>10tez, 100k = 10 MB)
+	rights         atomic.Value               // bitset 400 (bakers) * 6 (cycles) * 4096 (blocks) * 33 (rights)
+	addrs          atomic.Value               // all on-chain address hashes by id
+	proposals      atomic.Value               // gov proposals/protocol hashes by id
+	names          atomic.Value               // domain names by address
+	names_next     atomic.Value               // name cache being built
+	bigmap_values  *cache.BigmapHistoryCache  // bigmap history cache
+	bigmap_types   *cache.BigmapCache         // bigmap allocs
+	bigmap_json    *cache.BigmapValueCache    // decoded bigmap values
+	contract_types *cache.ContractTypeCache   // contract type data
+	ticket_types   *cache.TicketCache         // ticket type data
+	script_code    *lru.Cache[uint64, []byte] // shared contract code by code hash
 	dbpath         string
 	dbopts         interface{}
 	statedb        store.DB
@@ -50,23 +71,36 @@ type Indexer struct {
 	taskdb         *pack.DB
 	tasks          *pack.Table
 	lightMode      bool
+	readOnly       bool
+	skipOps        model.OpTypeList
+	decodeWorkers  int
+	flushCalls     int64 // table flushes at the last checkpoint
 }
 
 func NewIndexer(cfg IndexerConfig) *Indexer {
-	return &Indexer{
+	code, _ := lru.New[uint64, []byte](1024)
+	m := &Indexer{
 		dbpath:         cfg.DBPath,
 		dbopts:         cfg.DBOpts,
 		statedb:        cfg.StateDB,
 		indexes:        cfg.Indexes,
 		bigmap_values:  cache.NewBigmapHistoryCache(0),
 		bigmap_types:   cache.NewBigmapCache(0),
+		bigmap_json:    cache.NewBigmapValueCache(cfg.BigmapValueCacheSize),
 		contract_types: cache.NewContractTypeCache(0),
 		ticket_types:   cache.NewTicketCache(0),
+		script_code:    code,
 		reg:            NewRegistry(),
 		tips:           make(map[string]*IndexTip),
 		tables:         make(map[string]*pack.Table),
 		lightMode:      cfg.LightMode,
+		readOnly:       cfg.ReadOnly,
+		skipOps:        cfg.SkipOps,
+		decodeWorkers:  cfg.BigmapDecodeWorkers,
+		cfg:            cfg,
 	}
+	m.gen = m
+	return m
 }
 
 func (m *Indexer) ParamsByHeight(height int64) *rpc.Params {
@@ -89,6 +123,48 @@ func (m *Indexer) IsLightMode() bool {
 	return m.lightMode
 }
 
+// SkipOps returns operation types that are not indexed.
+func (m *Indexer) SkipOps() model.OpTypeList {
+	return m.skipOps
+}
+
+func (m *Indexer) IsReadOnly() bool {
+	return m.readOnly
+}
+
+// Acquire returns the current database generation of a read replica for
+// use by an API call. The generation stays open until release is called,
+// even when reload has opened a newer generation in the meantime. Indexers
+// that own their databases return themselves.
+func (m *Indexer) Acquire() (*Indexer, func()) {
+	if !m.readOnly {
+		return m, func() {}
+	}
+	m.gmu.Lock()
+	g := m.gen
+	g.refs++
+	m.gmu.Unlock()
+	return g, func() { m.release(g) }
+}
+
+func (m *Indexer) release(g *Indexer) {
+	m.gmu.Lock()
+	g.refs--
+	idle := g.refs == 0 && g != m.gen
+	m.gmu.Unlock()
+	if idle {
+		g.closeGeneration()
+	}
+}
+
+// current returns the current read replica generation for lookups of
+// in-memory state like protocol parameters.
+func (m *Indexer) current() *Indexer {
+	m.gmu.Lock()
+	defer m.gmu.Unlock()
+	return m.gen
+}
+
 func (m *Indexer) Sched() *task.Scheduler {
 	return m.sched
 }
@@ -110,6 +186,52 @@ func (m *Indexer) Index(key string) (model.BlockIndexer, error) {
 	return nil, ErrNoIndex
 }
 
+// BigmapAnomalies returns up to n recent anomalies found during bigmap
+// rollback and the total number seen since start.
+func (m *Indexer) BigmapAnomalies(n int) ([]index.BigmapAnomaly, int64) {
+	idx, err := m.Index(index.BigmapIndexKey)
+	if err != nil {
+		return nil, 0
+	}
+	return idx.(*index.BigmapIndex).RollbackAnomalies(n)
+}
+
+// RepairBigmapCounts corrects the live key count of bigmap id when it
+// differs from the value table. Indexing pauses while the repair runs.
+func (m *Indexer) RepairBigmapCounts(ctx context.Context, id int64) (bool, error) {
+	idx, err := m.Index(index.BigmapIndexKey)
+	if err != nil {
+		return false, err
+	}
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	return idx.(*index.BigmapIndex).RepairCounts(ctx, id)
+}
+
+// IndexNames returns the keys of all enabled indexes.
+func (m *Indexer) IndexNames() []string {
+	names := make([]string, 0, len(m.indexes))
+	for _, idx := range m.indexes {
+		names = append(names, idx.Key())
+	}
+	return names
+}
+
+// TableOptions returns the options of all open tables by name. These are
+// table defaults merged with per-table `db.<table>` config overrides.
+func (m *Indexer) TableOptions() map[string]pack.Options {
+	opts := make(map[string]pack.Options)
+	for _, idx := range m.indexes {
+		for _, t := range idx.Tables() {
+			opts[t.Name()] = t.Options()
+		}
+	}
+	if m.tasks != nil {
+		opts[m.tasks.Name()] = m.tasks.Options()
+	}
+	return opts
+}
+
 func (m *Indexer) TableStats() []pack.TableStats {
 	stats := make([]pack.TableStats, 0)
 	for _, idx := range m.indexes {
@@ -117,7 +239,10 @@ func (m *Indexer) TableStats() []pack.TableStats {
 			stats = append(stats, t.Stats()...)
 		}
 	}
-	return append(stats, m.tasks.Stats()...)
+	if m.tasks != nil {
+		stats = append(stats, m.tasks.Stats()...)
+	}
+	return stats
 }
 
 func (m *Indexer) Init(ctx context.Context, tip *model.ChainTip, mode Mode) error {
@@ -161,6 +286,9 @@ func (m *Indexer) Init(ctx context.Context, tip *model.ChainTip, mode Mode) erro
 	// Create the initial state for the indexes as needed.
 	nError := 0
 	nMissing := 0
+	if needCreate && m.readOnly {
+		return fmt.Errorf("Missing index databases! Read replicas require an existing database.")
+	}
 	if needCreate {
 		err := m.statedb.Update(func(dbTx store.Tx) error {
 			// create buckets for index tips in the respecive databases
@@ -222,6 +350,11 @@ func (m *Indexer) Init(ctx context.Context, tip *model.ChainTip, mode Mode) erro
 		}
 	}
 
+	// replicas never run tasks, they are executed by the writing indexer
+	if m.readOnly {
+		return nil
+	}
+
 	// open tasks db/table
 	var tasks task.TaskRequest
 	key := tasks.TableKey()
@@ -238,6 +371,13 @@ func (m *Indexer) Init(ctx context.Context, tip *model.ChainTip, mode Mode) erro
 		return fmt.Errorf("creating %s table: %w", key, err)
 	}
 
+	// remove partially written blocks after an unclean shutdown
+	if mode != MODE_INFO {
+		if err := m.TruncateIncomplete(ctx); err != nil {
+			return err
+		}
+	}
+
 	// start scheduler
 	m.sched = task.NewScheduler()
 	m.sched.WithTable(m.tasks).
@@ -289,6 +429,25 @@ func (m *Indexer) FlushJournals(ctx context.Context) error {
 	return m.tasks.FlushJournal(ctx)
 }
 
+// CompactTable flushes and compacts a single table. Block writes are paused
+// only while the journal is flushed so the table is compacted at a block
+// boundary. Compaction itself holds the table lock which serializes it with
+// concurrent writers to the same table without stalling all other tables.
+func (m *Indexer) CompactTable(ctx context.Context, key string) error {
+	t, err := m.Table(key)
+	if err != nil {
+		return err
+	}
+	m.wmu.Lock()
+	err = t.Flush(ctx)
+	m.wmu.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Infof("Compacting %s.", t.Name())
+	return t.Compact(ctx)
+}
+
 func (m *Indexer) GC(ctx context.Context, ratio float64) error {
 	if err := m.Flush(ctx); err != nil {
 		return err
@@ -334,6 +493,16 @@ func (m *Indexer) GC(ctx context.Context, ratio float64) error {
 }
 
 func (m *Indexer) Close() error {
+	if m.readOnly {
+		// the state database of the first generation is owned by the caller
+		if g := m.current(); g != m {
+			g.closeGeneration()
+		} else {
+			m.closeDatabases()
+		}
+		return nil
+	}
+
 	// shutdown task scheduler
 	if m.sched != nil {
 		m.sched.Stop()
@@ -383,6 +552,9 @@ func (m *Indexer) ConnectProtocol(ctx context.Context, next, prev *rpc.Params) e
 }
 
 func (m *Indexer) ConnectBlock(ctx context.Context, block *model.Block, builder model.BlockBuilder) error {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+
 	// insert block into all indexes
 	for _, t := range m.indexes {
 		key := t.Key()
@@ -422,11 +594,16 @@ func (m *Indexer) ConnectBlock(ctx context.Context, block *model.Block, builder
 	if err := m.updateProposals(ctx, block); err != nil {
 		return err
 	}
+	m.updateBigmapValues(block)
+	m.updateNames(block)
 
 	return nil
 }
 
 func (m *Indexer) DisconnectBlock(ctx context.Context, block *model.Block, builder model.BlockBuilder, ignoreErrors bool) error {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+
 	for _, t := range m.indexes {
 		key := t.Key()
 		tip, ok := m.tips[key]
@@ -449,12 +626,16 @@ func (m *Indexer) DisconnectBlock(ctx context.Context, block *model.Block, build
 	}
 
 	// we don't roll-back caches here because cached data will be overwritten by
-	// roll-forward
+	// roll-forward, names are rebuilt from live bigmap state
+	m.expireNames(block)
 
 	return nil
 }
 
 func (m *Indexer) DeleteBlock(ctx context.Context, tz *rpc.Bundle) error {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+
 	for _, t := range m.indexes {
 		key := t.Key()
 		tip, ok := m.tips[key]
@@ -521,3 +702,50 @@ func (m *Indexer) OnTaskComplete(ctx context.Context, res *task.TaskResult) erro
 	}
 	return idx.OnTaskComplete(ctx, res)
 }
+
+// closeDatabases closes index databases without closing tables. Closing
+// a table stores its journal and metadata which is impossible and not
+// required for read-only databases.
+func (m *Indexer) closeDatabases() {
+	m.tables = nil
+	for _, idx := range m.indexes {
+		if db := idx.DB(); db != nil {
+			if err := db.Close(); err != nil {
+				log.Errorf("Closing %s: %v", idx.Name(), err)
+			}
+		}
+	}
+}
+
+// closeGeneration closes databases of a read replica generation after
+// the last API call using it has completed.
+func (m *Indexer) closeGeneration() {
+	m.closeDatabases()
+	if err := m.statedb.Close(); err != nil {
+		log.Errorf("Closing state database: %v", err)
+	}
+}
+
+// reload opens a new generation of all databases of a read replica after
+// the writing indexer has advanced the chain tip. New API calls use the
+// new generation while calls in flight complete on the previous one which
+// is closed when the last of them has finished.
+func (m *Indexer) reload(ctx context.Context, statedb store.DB, indexes []model.BlockIndexer, tip *model.ChainTip) error {
+	cfg := m.cfg
+	cfg.StateDB = statedb
+	cfg.Indexes = indexes
+	next := NewIndexer(cfg)
+	if err := next.Init(ctx, tip, MODE_INFO); err != nil {
+		next.closeDatabases()
+		return err
+	}
+	m.gmu.Lock()
+	prev := m.gen
+	m.gen = next
+	idle := prev.refs == 0
+	m.gmu.Unlock()
+	if idle {
+		prev.closeGeneration()
+	}
+	return nil
+}
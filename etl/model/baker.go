@@ -73,6 +73,7 @@ type Baker struct {
 	Reliability int64    `pack:"-" json:"-"` // current cycle reliability from rights
 	IsNew       bool     `pack:"-" json:"-"` // first seen this block
 	IsDirty     bool     `pack:"-" json:"-"` // indicates an update happened
+	WasActive   bool     `pack:"-" json:"-"` // active status before this block
 }
 
 // Ensure Baker implements the pack.Item interface.
@@ -201,6 +202,20 @@ func (b Baker) IsOverStaked(p *rpc.Params) bool {
 	}
 }
 
+// Status returns the baker's activity status at cycle. Active bakers whose
+// grace period ends with cycle are deactivated at the start of the next
+// cycle unless they bake, endorse or re-register before.
+func (b Baker) Status(cycle int64) string {
+	switch {
+	case !b.IsActive:
+		return BakerStatusInactive
+	case b.GracePeriod <= cycle:
+		return BakerStatusExpiring
+	default:
+		return BakerStatusActive
+	}
+}
+
 func (b Baker) IsOverDelegated(p *rpc.Params) bool {
 	switch {
 	case p.Version < 18:
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"blockwatch.cc/packdb/pack"
+)
+
+const BakerStatusTableKey = "baker_status"
+
+const (
+	BakerStatusActive   = "active"   // baker has rights and is within its grace period
+	BakerStatusExpiring = "expiring" // grace period ends with the current cycle
+	BakerStatusInactive = "inactive" // deactivated, must re-register to regain rights
+)
+
+type BakerStatusID uint64
+
+// BakerStatus records a baker (re)activation or deactivation. Bakers are
+// activated on registration and reactivated when they re-register or bake
+// again after deactivation. They are deactivated at the start of the first
+// cycle after their grace period, i.e. after missing all rights for
+// several cycles.
+type BakerStatus struct {
+	Id          BakerStatusID `pack:"I,pk"      json:"row_id"`
+	Baker       AccountID     `pack:"B,bloom=3" json:"baker"`
+	Height      int64         `pack:"h,i32"     json:"height"`
+	Cycle       int64         `pack:"c,i16"     json:"cycle"`
+	IsActive    bool          `pack:"a,snappy"  json:"is_active"`
+	GracePeriod int64         `pack:"g,i16"     json:"grace_period"`
+}
+
+// Ensure BakerStatus items implement the pack.Item interface.
+var _ pack.Item = (*BakerStatus)(nil)
+
+func NewBakerStatus(b *Baker, block *Block) *BakerStatus {
+	return &BakerStatus{
+		Baker:       b.AccountId,
+		Height:      block.Height,
+		Cycle:       block.Cycle,
+		IsActive:    b.IsActive,
+		GracePeriod: b.GracePeriod,
+	}
+}
+
+func (m *BakerStatus) ID() uint64 {
+	return uint64(m.Id)
+}
+
+func (m *BakerStatus) SetID(id uint64) {
+	m.Id = BakerStatusID(id)
+}
+
+func (m BakerStatus) TableKey() string {
+	return BakerStatusTableKey
+}
+
+func (m BakerStatus) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    12,  // 4k pack size
+		JournalSizeLog2: 10,  // 1k journal size
+		CacheSize:       2,   // max MB
+		FillLevel:       100, // boltdb fill level to limit reallocations
+	}
+}
+
+func (m BakerStatus) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+func (m BakerStatus) Status() string {
+	if m.IsActive {
+		return BakerStatusActive
+	}
+	return BakerStatusInactive
+}
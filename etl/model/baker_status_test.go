@@ -0,0 +1,32 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"testing"
+)
+
+func TestBakerStatus(t *testing.T) {
+	b := Baker{IsActive: true, GracePeriod: 10}
+	for _, v := range []struct {
+		cycle  int64
+		status string
+	}{
+		{8, BakerStatusActive},
+		{9, BakerStatusActive},
+		{10, BakerStatusExpiring},
+	} {
+		if s := b.Status(v.cycle); s != v.status {
+			t.Errorf("cycle %d: got status %q, want %q", v.cycle, s, v.status)
+		}
+	}
+	b.IsActive = false
+	if s := b.Status(8); s != BakerStatusInactive {
+		t.Errorf("inactive baker: got status %q", s)
+	}
+	ev := NewBakerStatus(&b, &Block{Height: 100, Cycle: 11})
+	if ev.Status() != BakerStatusInactive || ev.Height != 100 || ev.Cycle != 11 {
+		t.Errorf("unexpected status event %+v", ev)
+	}
+}
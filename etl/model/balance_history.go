@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+// BalanceCategory identifies which part of an account balance a flow moves.
+type BalanceCategory byte
+
+const (
+	BalanceCategoryInvalid   BalanceCategory = iota
+	BalanceCategorySpendable                 // spendable balance
+	BalanceCategoryFrozen                    // legacy frozen deposits, rewards, fees and rollup bonds
+	BalanceCategoryStaked                    // staked principal
+	BalanceCategoryUnstaked                  // unstaked, not yet finalized
+)
+
+func (c BalanceCategory) IsValid() bool {
+	return c != BalanceCategoryInvalid
+}
+
+func (c BalanceCategory) String() string {
+	switch c {
+	case BalanceCategorySpendable:
+		return "spendable"
+	case BalanceCategoryFrozen:
+		return "frozen"
+	case BalanceCategoryStaked:
+		return "staked"
+	case BalanceCategoryUnstaked:
+		return "unstaked"
+	default:
+		return "invalid"
+	}
+}
+
+func (c BalanceCategory) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// FlowBalanceCategory maps a flow to the balance category it changes.
+// Delegation flows move balances of other accounts and are not part of an
+// account's own balance.
+func FlowBalanceCategory(f *Flow) BalanceCategory {
+	switch f.Kind {
+	case FlowKindBalance:
+		return BalanceCategorySpendable
+	case FlowKindRewards, FlowKindDeposits, FlowKindFees, FlowKindBond:
+		return BalanceCategoryFrozen
+	case FlowKindStake:
+		switch f.Type {
+		case FlowTypeFinalizeUnstake:
+			return BalanceCategoryUnstaked
+		case FlowTypePenalty:
+			if f.IsUnfrozen {
+				return BalanceCategoryUnstaked
+			}
+		}
+		return BalanceCategoryStaked
+	default:
+		return BalanceCategoryInvalid
+	}
+}
+
+// BalanceSheet keeps running balances per category while replaying the
+// flows of a single account in chain order. Staked balance tracks principal
+// only, staking rewards are not paid as flows.
+type BalanceSheet struct {
+	Spendable int64
+	Frozen    int64
+	Staked    int64
+	Unstaked  int64
+}
+
+func (b BalanceSheet) Total() int64 {
+	return b.Spendable + b.Frozen + b.Staked + b.Unstaked
+}
+
+// Apply updates running balances from f and returns the category it moved.
+// Flows that don't change the account's own balance return an invalid
+// category and leave balances untouched.
+func (b *BalanceSheet) Apply(f *Flow) BalanceCategory {
+	c := FlowBalanceCategory(f)
+	switch c {
+	case BalanceCategorySpendable:
+		b.Spendable += f.AmountIn - f.AmountOut
+	case BalanceCategoryFrozen:
+		b.Frozen += f.AmountIn - f.AmountOut
+	case BalanceCategoryUnstaked:
+		b.Unstaked -= f.AmountOut
+	case BalanceCategoryStaked:
+		if f.Type == FlowTypeUnstake {
+			// only the out flow from staked deposits is accounted,
+			// same as for the account unstaked balance
+			b.Staked -= f.AmountOut
+			b.Unstaked += f.AmountOut
+			break
+		}
+		b.Staked += f.AmountIn - f.AmountOut
+	}
+	return c
+}
+
+// BalanceHistoryEntry is a single flow together with the account's running
+// balances after the flow was applied.
+type BalanceHistoryEntry struct {
+	Flow     *Flow
+	Category BalanceCategory
+	Balance  BalanceSheet
+}
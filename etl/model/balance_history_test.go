@@ -0,0 +1,35 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import "testing"
+
+func TestBalanceSheet(t *testing.T) {
+	var b BalanceSheet
+	for _, c := range []struct {
+		flow Flow
+		want BalanceCategory
+	}{
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeTransaction, AmountIn: 1000}, BalanceCategorySpendable},
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeTransaction, AmountOut: 10, IsFee: true}, BalanceCategorySpendable},
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeStake, AmountOut: 500}, BalanceCategorySpendable},
+		{Flow{Kind: FlowKindStake, Type: FlowTypeStake, AmountIn: 500}, BalanceCategoryStaked},
+		{Flow{Kind: FlowKindStake, Type: FlowTypeUnstake, AmountOut: 200}, BalanceCategoryStaked},
+		{Flow{Kind: FlowKindStake, Type: FlowTypePenalty, AmountOut: 20, IsUnfrozen: true}, BalanceCategoryUnstaked},
+		{Flow{Kind: FlowKindStake, Type: FlowTypeFinalizeUnstake, AmountOut: 180}, BalanceCategoryUnstaked},
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeFinalizeUnstake, AmountIn: 180}, BalanceCategorySpendable},
+		{Flow{Kind: FlowKindDelegation, Type: FlowTypeTransaction, AmountIn: 99}, BalanceCategoryInvalid},
+	} {
+		if got := b.Apply(&c.flow); got != c.want {
+			t.Errorf("%s/%s: category %s, want %s", c.flow.Kind, c.flow.Type, got, c.want)
+		}
+	}
+	want := BalanceSheet{Spendable: 670, Staked: 300}
+	if b != want {
+		t.Errorf("balance %+v, want %+v", b, want)
+	}
+	if b.Total() != 970 {
+		t.Errorf("total %d, want 970", b.Total())
+	}
+}
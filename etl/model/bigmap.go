@@ -16,6 +16,7 @@ import (
 
 var (
 	ErrNoBigmap        = errors.New("bigmap not indexed")
+	ErrNoBigmapAlloc   = errors.New("bigmap alloc not found")
 	ErrInvalidExprHash = errors.New("invalid expr hash")
 )
 
@@ -23,6 +24,9 @@ const (
 	BigmapAllocTableKey  = "bigmap_types"
 	BigmapUpdateTableKey = "bigmap_updates"
 	BigmapValueTableKey  = "bigmap_values"
+	BigmapRefTableKey    = "bigmap_refs"
+
+	BigmapCheckpointTableKey = "bigmap_checkpoints"
 )
 
 // /tables/bigmaps
@@ -36,6 +40,7 @@ type BigmapAlloc struct {
 	Updated   int64     `pack:"u,i32"    json:"update_height"` // last update height
 	Deleted   int64     `pack:"D,i32"    json:"delete_height"` // block when bigmap was removed
 	Data      []byte    `pack:"d,snappy" json:"-"`             // micheline encoded type tree (key/val pair)
+	TypeHash  uint64    `pack:"t,bloom"  json:"type_hash"`     // structural key/value type signature
 
 	// internal, not stored
 	KeyType   micheline.Type `pack:"-" json:"-"`
@@ -80,6 +85,31 @@ func GetKeyId(bigmapid int64, kh mavryk.ExprHash) uint64 {
 	return xxhash.Sum64(buf[:])
 }
 
+// BigmapTypeHash returns a structural signature of a bigmap key and value
+// type. Types that match under Typedef Unfold and Equal (i.e. ignoring
+// annotations and comb vs. tree pair layout) have the same hash.
+func BigmapTypeHash(key, val micheline.Type) uint64 {
+	h := xxhash.New()
+	writeTypedefSignature(h, key.Typedef("").Unfold())
+	writeTypedefSignature(h, val.Typedef("").Unfold())
+	return h.Sum64()
+}
+
+func writeTypedefSignature(h *xxhash.Digest, t micheline.Typedef) {
+	var buf [binary.MaxVarintLen64]byte
+	_, _ = h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(t.Type)))])
+	_, _ = h.WriteString(t.Type)
+	if t.Optional {
+		_, _ = h.Write([]byte{1})
+	} else {
+		_, _ = h.Write([]byte{0})
+	}
+	_, _ = h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(t.Args)))])
+	for _, v := range t.Args {
+		writeTypedefSignature(h, v)
+	}
+}
+
 func (b *BigmapAlloc) GetKeyType() micheline.Type {
 	if !b.KeyType.IsValid() {
 		b.decodeType()
@@ -106,6 +136,9 @@ func (b *BigmapAlloc) decodeType() {
 func (b *BigmapAlloc) GetKeyTypeBytes() []byte {
 	var prim micheline.Prim
 	_ = prim.UnmarshalBinary(b.Data)
+	if len(prim.Args) < 2 {
+		return nil
+	}
 	buf, _ := prim.Args[0].MarshalBinary()
 	return buf
 }
@@ -113,6 +146,9 @@ func (b *BigmapAlloc) GetKeyTypeBytes() []byte {
 func (b *BigmapAlloc) GetValueTypeBytes() []byte {
 	var prim micheline.Prim
 	_ = prim.UnmarshalBinary(b.Data)
+	if len(prim.Args) < 2 {
+		return nil
+	}
 	buf, _ := prim.Args[1].MarshalBinary()
 	return buf
 }
@@ -128,6 +164,7 @@ func NewBigmapAlloc(op *Op, b micheline.BigmapEvent) *BigmapAlloc {
 		Updated:   op.Height,
 	}
 	m.Data, _ = micheline.NewPairType(b.KeyType, b.ValueType).MarshalBinary()
+	m.TypeHash = BigmapTypeHash(micheline.NewType(b.KeyType), micheline.NewType(b.ValueType))
 	return m
 }
 
@@ -138,6 +175,7 @@ func CopyBigmapAlloc(b *BigmapAlloc, op *Op, dst int64) *BigmapAlloc {
 		Height:    op.Height,
 		Updated:   op.Height,
 		Data:      make([]byte, len(b.Data)),
+		TypeHash:  b.TypeHash,
 	}
 	if op.Type == OpTypeOrigination && b.BigmapId < 0 {
 		m.AccountId = op.ReceiverId
@@ -190,12 +228,14 @@ func (m *BigmapAlloc) Reset() {
 
 // /tables/bigmap_values
 type BigmapValue struct {
-	RowId    uint64 `pack:"I,pk"             json:"row_id"`    // internal: id
-	BigmapId int64  `pack:"B,i32,bloom"      json:"bigmap_id"` // unique bigmap id
-	Height   int64  `pack:"h,i32"            json:"height"`    // update height
-	KeyId    uint64 `pack:"K,bloom=3,snappy" json:"key_id"`    // xxhash(BigmapId, KeyHash)
-	Key      []byte `pack:"k,snappy"         json:"key"`       // key/value bytes: binary encoded micheline.Prim Pair
-	Value    []byte `pack:"v,snappy"         json:"value"`     // key/value bytes: binary encoded micheline.Prim Pair
+	RowId    uint64 `pack:"I,pk"             json:"row_id"`     // internal: id
+	BigmapId int64  `pack:"B,i32,bloom"      json:"bigmap_id"`  // unique bigmap id
+	Height   int64  `pack:"h,i32"            json:"height"`     // update height
+	KeyId    uint64 `pack:"K,bloom=3,snappy" json:"key_id"`     // xxhash(BigmapId, KeyHash)
+	Key      []byte `pack:"k,snappy"         json:"key"`        // key/value bytes: binary encoded micheline.Prim Pair
+	Value    []byte `pack:"v,snappy"         json:"value"`      // key/value bytes: binary encoded micheline.Prim Pair
+	NatKey   uint64 `pack:"n,bloom"          json:"nat_key"`    // numeric key for nat/int keyed bigmaps (0 when key is not numeric)
+	Size     int32  `pack:"z,i32"            json:"value_size"` // encoded value size in bytes (0 on values stored by older versions)
 }
 
 var _ pack.Item = (*BigmapValue)(nil)
@@ -239,6 +279,15 @@ func (b *BigmapValue) GetKeyHash() mavryk.ExprHash {
 	return micheline.KeyHash(b.Key)
 }
 
+// BigmapNatKey returns the numeric value of a nat or non-negative int key
+// when it fits into uint64. Used to populate the indexed nat key column.
+func BigmapNatKey(key micheline.Prim) (uint64, bool) {
+	if key.Type != micheline.PrimInt || key.Int == nil || key.Int.Sign() < 0 || !key.Int.IsUint64() {
+		return 0, false
+	}
+	return key.Int.Uint64(), true
+}
+
 func NewBigmapValue(b micheline.BigmapEvent, height int64) *BigmapValue {
 	if b.Action != micheline.DiffActionUpdate {
 		return nil
@@ -248,8 +297,10 @@ func NewBigmapValue(b micheline.BigmapEvent, height int64) *BigmapValue {
 		KeyId:    GetKeyId(b.Id, b.KeyHash),
 		Height:   height,
 	}
+	m.NatKey, _ = BigmapNatKey(b.Key)
 	m.Key, _ = b.Key.MarshalBinary()
 	m.Value, _ = b.Value.MarshalBinary()
+	m.Size = int32(len(m.Value))
 	return m
 }
 
@@ -260,6 +311,8 @@ func CopyBigmapValue(b *BigmapValue, dst, height int64) *BigmapValue {
 		KeyId:    GetKeyId(dst, b.GetKeyHash()),
 		Key:      make([]byte, len(b.Key)),
 		Value:    make([]byte, len(b.Value)),
+		NatKey:   b.NatKey,
+		Size:     int32(len(b.Value)),
 	}
 	copy(m.Key, b.Key)
 	copy(m.Value, b.Value)
@@ -401,9 +454,14 @@ func (b *BigmapUpdate) ToKV() *BigmapValue {
 		Height:   b.Height,
 		Key:      make([]byte, len(b.Key)),
 		Value:    make([]byte, len(b.Value)),
+		Size:     int32(len(b.Value)),
 	}
 	copy(m.Key, b.Key)
 	copy(m.Value, b.Value)
+	var key micheline.Prim
+	if err := key.UnmarshalBinary(b.Key); err == nil {
+		m.NatKey, _ = BigmapNatKey(key)
+	}
 	return m
 }
 
@@ -442,3 +500,41 @@ func (b *BigmapUpdate) ToEvent() micheline.BigmapEvent {
 func (m *BigmapUpdate) Reset() {
 	*m = BigmapUpdate{}
 }
+
+// BigmapRef links an account to a bigmap key whose key or value embeds
+// the account's address. Refs are append-only, one per update that
+// mentions the address.
+type BigmapRef struct {
+	RowId     uint64    `pack:"I,pk"        json:"row_id"`     // internal: id
+	AccountId AccountID `pack:"A,u32,bloom" json:"account_id"` // referenced account
+	BigmapId  int64     `pack:"B,i32"       json:"bigmap_id"`  // unique bigmap id
+	KeyId     uint64    `pack:"K"           json:"key_id"`     // xxhash(BigmapId, KeyHash)
+	Height    int64     `pack:"h,i32"       json:"height"`     // update height
+}
+
+var _ pack.Item = (*BigmapRef)(nil)
+
+func (m *BigmapRef) ID() uint64 {
+	return m.RowId
+}
+
+func (m *BigmapRef) SetID(id uint64) {
+	m.RowId = id
+}
+
+func (m BigmapRef) TableKey() string {
+	return BigmapRefTableKey
+}
+
+func (m BigmapRef) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    15, // 32k pack size
+		JournalSizeLog2: 15, // 32k journal size
+		CacheSize:       16, // max MB
+		FillLevel:       100,
+	}
+}
+
+func (m BigmapRef) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
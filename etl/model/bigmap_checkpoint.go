@@ -0,0 +1,48 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"blockwatch.cc/packdb/pack"
+)
+
+// BigmapCheckpoint is a snapshot of all live keys of a bigmap at a height.
+// Historic bigmap state is rebuilt from the nearest checkpoint below the
+// requested height instead of replaying all updates since allocation.
+type BigmapCheckpoint struct {
+	RowId    uint64 `pack:"I,pk"        json:"row_id"`    // internal: id
+	BigmapId int64  `pack:"B,i32,bloom" json:"bigmap_id"` // unique bigmap id
+	Height   int64  `pack:"h,i32"       json:"height"`    // state after this block
+	NUpdates int64  `pack:"n,i32"       json:"n_updates"` // alloc update counter at height
+	NKeys    int64  `pack:"k,i32"       json:"n_keys"`    // number of live keys
+	Offsets  []byte `pack:"o,snappy"    json:"-"`         // key and value offsets into data
+	Data     []byte `pack:"d,snappy"    json:"-"`         // concatenated binary keys and values
+}
+
+var _ pack.Item = (*BigmapCheckpoint)(nil)
+
+func (m *BigmapCheckpoint) ID() uint64 {
+	return m.RowId
+}
+
+func (m *BigmapCheckpoint) SetID(id uint64) {
+	m.RowId = id
+}
+
+func (m BigmapCheckpoint) TableKey() string {
+	return BigmapCheckpointTableKey
+}
+
+func (m BigmapCheckpoint) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    10, // 1k pack size, rows are large
+		JournalSizeLog2: 10, // 1k journal size
+		CacheSize:       16, // max MB
+		FillLevel:       100,
+	}
+}
+
+func (m BigmapCheckpoint) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
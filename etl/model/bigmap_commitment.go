@@ -0,0 +1,80 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+// BigmapCommitmentScheme identifies the hashing scheme implemented by
+// BigmapCommitment. Change it whenever the scheme changes.
+const BigmapCommitmentScheme = "sha256-merkle-v1"
+
+// BigmapCommitment computes a Merkle root over the live key/value set of a
+// bigmap. The scheme is
+//
+//	leaf = sha256(0x00 || key_hash || sha256(value))
+//	node = sha256(0x01 || left || right)
+//
+// where key_hash is the 32 byte Micheline expression hash of the packed key
+// and value is the binary Micheline encoding of the value. Leaves are sorted
+// by key_id, then by key_hash. Each tree level pairs nodes from left to right.
+// An odd last node is promoted to the next level unchanged. The root of an
+// empty set is 32 zero bytes.
+func BigmapCommitment(values []*BigmapValue) [32]byte {
+	type leaf struct {
+		keyId uint64
+		hash  [32]byte
+		node  [32]byte
+	}
+	leaves := make([]leaf, len(values))
+	for i, v := range values {
+		kh := micheline.KeyHash(v.Key)
+		vh := sha256.Sum256(v.Value)
+		h := sha256.New()
+		h.Write([]byte{0})
+		h.Write(kh[:])
+		h.Write(vh[:])
+		leaves[i].keyId = v.KeyId
+		leaves[i].hash = [32]byte(kh)
+		h.Sum(leaves[i].node[:0])
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		if leaves[i].keyId == leaves[j].keyId {
+			return bytes.Compare(leaves[i].hash[:], leaves[j].hash[:]) < 0
+		}
+		return leaves[i].keyId < leaves[j].keyId
+	})
+
+	var root [32]byte
+	if len(leaves) == 0 {
+		return root
+	}
+	level := make([][32]byte, len(leaves))
+	for i := range leaves {
+		level[i] = leaves[i].node
+	}
+	for len(level) > 1 {
+		next := level[:0]
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				break
+			}
+			h := sha256.New()
+			h.Write([]byte{1})
+			h.Write(level[i][:])
+			h.Write(level[i+1][:])
+			var node [32]byte
+			h.Sum(node[:0])
+			next = append(next, node)
+		}
+		level = next
+	}
+	return level[0]
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+func TestBigmapTypeHash(t *testing.T) {
+	addr := micheline.NewPrim(micheline.T_ADDRESS)
+	nat := micheline.NewPrim(micheline.T_NAT)
+	key := micheline.NewType(micheline.NewPairType(addr, nat))
+	annotated := micheline.NewType(micheline.NewPairType(
+		micheline.NewPrim(micheline.T_ADDRESS, "%owner"),
+		micheline.NewPrim(micheline.T_NAT, "%token_id"),
+	))
+	val := micheline.NewType(nat)
+
+	if BigmapTypeHash(key, val) != BigmapTypeHash(annotated, val) {
+		t.Errorf("annotations must not change the type hash")
+	}
+	if BigmapTypeHash(key, val) == BigmapTypeHash(val, key) {
+		t.Errorf("swapped key and value types must not match")
+	}
+	if BigmapTypeHash(key, val) == BigmapTypeHash(key, micheline.NewType(addr)) {
+		t.Errorf("different value types must not match")
+	}
+}
+
+func TestBigmapNatKey(t *testing.T) {
+	if n, ok := BigmapNatKey(micheline.NewNat(big.NewInt(42))); !ok || n != 42 {
+		t.Errorf("nat key: got %d %t", n, ok)
+	}
+	if _, ok := BigmapNatKey(micheline.NewInt64(-1)); ok {
+		t.Errorf("negative key must not be numeric")
+	}
+	huge := new(big.Int).Lsh(big.NewInt(1), 70)
+	if _, ok := BigmapNatKey(micheline.NewNat(huge)); ok {
+		t.Errorf("key larger than uint64 must not be numeric")
+	}
+	if _, ok := BigmapNatKey(micheline.NewString("42")); ok {
+		t.Errorf("string key must not be numeric")
+	}
+}
+
+func TestBigmapUpdateToKV(t *testing.T) {
+	for _, key := range []micheline.Prim{micheline.NewNat(big.NewInt(42)), micheline.NewString("42")} {
+		ev := micheline.BigmapEvent{
+			Action:  micheline.DiffActionUpdate,
+			Id:      5,
+			Key:     key,
+			KeyHash: micheline.KeyHash(key.ToBytes()),
+			Value:   micheline.NewString("value"),
+		}
+		want := NewBigmapValue(ev, 10)
+		got := NewBigmapUpdate(&Op{Height: 10}, ev).ToKV()
+		if got.NatKey != want.NatKey || got.Size != want.Size {
+			t.Errorf("%s: rollback row nat_key=%d size=%d, insert row nat_key=%d size=%d",
+				key.Dump(), got.NatKey, got.Size, want.NatKey, want.Size)
+		}
+	}
+}
+
+func TestBigmapCommitment(t *testing.T) {
+	var zero [32]byte
+	if BigmapCommitment(nil) != zero {
+		t.Errorf("empty set must commit to zero root")
+	}
+
+	values := make([]*BigmapValue, 0)
+	for i := int64(0); i < 5; i++ {
+		key, _ := micheline.NewInt64(i).MarshalBinary()
+		val, _ := micheline.NewString("v").MarshalBinary()
+		values = append(values, &BigmapValue{
+			KeyId: GetKeyId(1, micheline.KeyHash(key)),
+			Key:   key,
+			Value: val,
+		})
+	}
+	root := BigmapCommitment(values)
+	if root == zero {
+		t.Fatalf("non-empty set committed to zero root")
+	}
+
+	// input order must not matter
+	reversed := make([]*BigmapValue, len(values))
+	for i, v := range values {
+		reversed[len(values)-1-i] = v
+	}
+	if BigmapCommitment(reversed) != root {
+		t.Errorf("root depends on input order")
+	}
+
+	// any value change must change the root
+	changed := *values[4]
+	changed.Value, _ = micheline.NewString("w").MarshalBinary()
+	if BigmapCommitment(append(values[:4:4], &changed)) == root {
+		t.Errorf("root did not change with value")
+	}
+	if BigmapCommitment(values[:4]) == root {
+		t.Errorf("root did not change with removed key")
+	}
+}
@@ -404,6 +404,10 @@ func (b *Block) Update(accounts map[AccountID]*Account, bakers map[AccountID]*Ba
 			b.HasSeeds = true
 			b.MintedSupply += op.Reward
 
+		case OpTypeVdfRevelation:
+			// no reference to a seed nonce, but minted like one
+			b.MintedSupply += op.Reward
+
 		case OpTypeAirdrop, OpTypeInvoice, OpTypeSubsidy:
 			b.MintedSupply += op.Reward
 
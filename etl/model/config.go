@@ -28,6 +28,7 @@ func init() {
 	config.SetDefault("db.bigmaps.cache_size", 128)
 	config.SetDefault("db.bigmap_updates.cache_size", 128)
 	config.SetDefault("db.bigmap_values.cache_size", 1024)
+	config.SetDefault("db.bigmap_checkpoints.cache_size", 16)
 	config.SetDefault("db.block.cache_size", 128)
 	config.SetDefault("db.chain.cache_size", 2)
 	config.SetDefault("db.constant.cache_size", 2)
@@ -59,4 +60,5 @@ func init() {
 	config.SetDefault("db.token_metadata.cache_size", 64)
 	config.SetDefault("db.token_events.cache_size", 16)
 	config.SetDefault("db.token_owners.cache_size", 256)
+	config.SetDefault("db.token_metadata_changes.cache_size", 4)
 }
@@ -48,9 +48,10 @@ type Contract struct {
 	StoragePaid    int64                `pack:"y,i32"     json:"storage_paid"`
 	StorageBurn    int64                `pack:"Y"         json:"storage_burn"`
 	Script         []byte               `pack:"s,snappy"  json:"script"`
+	ScriptRef      ContractID           `pack:"r"         json:"script_ref"` // contract storing shared code
 	Storage        []byte               `pack:"g,snappy"  json:"storage"`
 	InterfaceHash  uint64               `pack:"i,snappy"  json:"iface_hash"`
-	CodeHash       uint64               `pack:"c,snappy"  json:"code_hash"`
+	CodeHash       uint64               `pack:"c,snappy,bloom" json:"code_hash"` // bloom for shared script lookups
 	StorageHash    uint64               `pack:"x,snappy"  json:"storage_hash"`
 	CallStats      []byte               `pack:"S,snappy"  json:"call_stats"`
 	Features       micheline.Features   `pack:"F,snappy"  json:"features"`
@@ -319,9 +320,8 @@ func (c Contract) IsRollup() bool {
 	}
 }
 
-func (c *Contract) ListTxRollupCallStats() map[string]int {
-	res := make(map[string]int, len(c.CallStats)>>2)
-	for i, v := range []string{
+var (
+	txRollupEntrypoints = []string{
 		"deposit", // fake, /sigh/ :(
 		"tx_rollup_submit_batch",
 		"tx_rollup_commit",
@@ -330,15 +330,8 @@ func (c *Contract) ListTxRollupCallStats() map[string]int {
 		"tx_rollup_remove_commitment",
 		"tx_rollup_rejection",
 		"tx_rollup_dispatch_tickets",
-	} {
-		res[v] = int(binary.BigEndian.Uint32(c.CallStats[i*4:]))
 	}
-	return res
-}
-
-func (c *Contract) ListSmartRollupCallStats() map[string]int {
-	res := make(map[string]int, len(c.CallStats)>>2)
-	for i, v := range []string{
+	smartRollupEntrypoints = []string{
 		"deposit", // fake, /sigh/ :(
 		"smart_rollup_add_messages",
 		"smart_rollup_cement",
@@ -347,36 +340,61 @@ func (c *Contract) ListSmartRollupCallStats() map[string]int {
 		"smart_rollup_timeout",
 		"smart_rollup_execute_outbox_message",
 		"smart_rollup_recover_bond",
-	} {
+	}
+)
+
+func (c *Contract) ListTxRollupCallStats() map[string]int {
+	res := make(map[string]int, len(c.CallStats)>>2)
+	for i, v := range txRollupEntrypoints {
 		res[v] = int(binary.BigEndian.Uint32(c.CallStats[i*4:]))
 	}
 	return res
 }
 
-func (c *Contract) ListCallStats() map[string]int {
+func (c *Contract) ListSmartRollupCallStats() map[string]int {
+	res := make(map[string]int, len(c.CallStats)>>2)
+	for i, v := range smartRollupEntrypoints {
+		res[v] = int(binary.BigEndian.Uint32(c.CallStats[i*4:]))
+	}
+	return res
+}
+
+// EntrypointNames returns entrypoint names indexed by entrypoint id as used
+// in call stats and operations.
+func (c *Contract) EntrypointNames() ([]string, error) {
 	switch c.Address.Type() {
 	case mavryk.AddressTypeTxRollup:
-		return c.ListTxRollupCallStats()
+		return txRollupEntrypoints, nil
 	case mavryk.AddressTypeSmartRollup:
-		return c.ListSmartRollupCallStats()
+		return smartRollupEntrypoints, nil
 	}
-	// list entrypoint names first
 	pTyp, _, err := c.LoadType()
 	if err != nil {
-		return nil
+		return nil, err
 	}
-
 	ep, err := pTyp.Entrypoints(false)
 	if err != nil {
-		return nil
+		return nil, err
 	}
-
 	// sort entrypoint map by id, we only need names here
 	byId := make([]string, len(ep))
 	for _, v := range ep {
 		byId[v.Id] = v.Name
 	}
+	return byId, nil
+}
 
+func (c *Contract) ListCallStats() map[string]int {
+	switch c.Address.Type() {
+	case mavryk.AddressTypeTxRollup:
+		return c.ListTxRollupCallStats()
+	case mavryk.AddressTypeSmartRollup:
+		return c.ListSmartRollupCallStats()
+	}
+	byId, err := c.EntrypointNames()
+	if err != nil {
+		return nil
+	}
 	res := make(map[string]int, len(c.CallStats)>>2)
 	for i, name := range byId {
 		res[name] = int(binary.BigEndian.Uint32(c.CallStats[i*4:]))
@@ -0,0 +1,111 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+// Contracts originated from the same code may share a single copy of their
+// script. The first contract with a code hash stores its full script. Later
+// contracts reference it with ScriptRef and only store their own initial
+// storage segment. Contracts loaded from the table must be joined with the
+// shared code before use, contracts written to the table are split again.
+
+// SplitScript splits a binary encoded script into its code and initial
+// storage segments.
+func SplitScript(buf []byte) (code, storage []byte, err error) {
+	if len(buf) < 4 {
+		return nil, nil, io.ErrShortBuffer
+	}
+	n := 4 + int(binary.BigEndian.Uint32(buf))
+	if len(buf) < n+4 {
+		return nil, nil, io.ErrShortBuffer
+	}
+	return buf[:n], buf[n:], nil
+}
+
+// IsSharedScript returns true when the contract's code is stored with
+// another contract.
+func (c *Contract) IsSharedScript() bool {
+	return c.ScriptRef > 0
+}
+
+// StoredScript returns the script data as written to the contract table,
+// which is the storage segment only for shared scripts.
+func (c *Contract) StoredScript() []byte {
+	if !c.IsSharedScript() {
+		return c.Script
+	}
+	_, storage, err := SplitScript(c.Script)
+	if err != nil {
+		return c.Script
+	}
+	return storage
+}
+
+// JoinScript restores the full script of a contract loaded from the contract
+// table from the shared code segment.
+func (c *Contract) JoinScript(code []byte) {
+	if !c.IsSharedScript() {
+		return
+	}
+	buf := make([]byte, 0, len(code)+len(c.Script))
+	buf = append(buf, code...)
+	c.Script = append(buf, c.Script...)
+	c.script = nil
+	c.params = micheline.Type{}
+	c.storage = micheline.Type{}
+}
+
+// LoadScriptCode loads the shared code segment stored with contract id.
+func LoadScriptCode(ctx context.Context, table *pack.Table, id ContractID) ([]byte, error) {
+	cc := &Contract{}
+	err := pack.NewQuery("load_script_code").
+		WithTable(table).
+		WithFields("row_id", "script", "script_ref").
+		AndEqual("row_id", id).
+		Execute(ctx, cc)
+	if err != nil {
+		return nil, err
+	}
+	if cc.RowId == 0 {
+		return nil, ErrNoContract
+	}
+	if cc.IsSharedScript() {
+		return nil, fmt.Errorf("shared script %d references another script %d", id, cc.ScriptRef)
+	}
+	code, _, err := SplitScript(cc.Script)
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// JoinScripts restores shared scripts of contracts loaded from table.
+func JoinScripts(ctx context.Context, table *pack.Table, list ...*Contract) error {
+	codes := make(map[ContractID][]byte)
+	for _, c := range list {
+		if !c.IsSharedScript() {
+			continue
+		}
+		code, ok := codes[c.ScriptRef]
+		if !ok {
+			var err error
+			code, err = LoadScriptCode(ctx, table, c.ScriptRef)
+			if err != nil {
+				return fmt.Errorf("contract %s: %w", c, err)
+			}
+			codes[c.ScriptRef] = code
+		}
+		c.JoinScript(code)
+	}
+	return nil
+}
@@ -0,0 +1,511 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+// ViewBigmaps lists bigmaps read by an on-chain view.
+type ViewBigmaps struct {
+	View    string
+	Paths   []string // storage type paths of bigmaps read by the view
+	Dynamic bool     // view reads bigmaps which cannot be resolved statically
+}
+
+// AnalyzeViewBigmaps determines which storage bigmaps each view of script
+// reads. View code is run on a symbolic stack which tracks where values
+// originate from in the view's input pair. Storage paths are written as
+// a sequence of 0 (left) and 1 (right) branches in the binary pair tree of
+// the storage type, i.e. `pair a b c` equals `pair a (pair b c)` and the
+// path of c is "11". Reads of bigmaps passed as view parameter, of
+// bigmaps with untraceable origin or code the analysis cannot follow
+// mark the view as dynamic. Results are sorted by view name.
+func AnalyzeViewBigmaps(script *micheline.Script) []ViewBigmaps {
+	if script == nil {
+		return nil
+	}
+	views, _ := script.Views(false, true)
+	list := make([]ViewBigmaps, 0, len(views))
+	for name, view := range views {
+		a := &viewAnalyzer{
+			input: micheline.NewPairType(view.Param.Prim, script.StorageType().Prim),
+			paths: make(map[string]struct{}),
+		}
+		stack := a.exec(view.Code, []symValue{{kind: symKnown}})
+		if stack.lost {
+			a.dynamic = true
+		}
+		deps := ViewBigmaps{
+			View:    name,
+			Paths:   make([]string, 0, len(a.paths)),
+			Dynamic: a.dynamic,
+		}
+		for p := range a.paths {
+			deps.Paths = append(deps.Paths, p)
+		}
+		sort.Strings(deps.Paths)
+		list = append(list, deps)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].View < list[j].View })
+	return list
+}
+
+// BigmapAtPath returns the bigmap id stored at a storage type path.
+func BigmapAtPath(typ, val micheline.Prim, path string) (int64, bool) {
+	for _, b := range []byte(path) {
+		var ok bool
+		typ, ok = pairArg(typ, b == '1')
+		if !ok {
+			return 0, false
+		}
+		val, ok = pairArg(val, b == '1')
+		if !ok {
+			return 0, false
+		}
+	}
+	if typ.OpCode != micheline.T_BIG_MAP || val.Type != micheline.PrimInt || val.Int == nil {
+		return 0, false
+	}
+	return val.Int.Int64(), true
+}
+
+type symKind byte
+
+const (
+	symPlain   symKind = iota // cannot be or contain a stored bigmap
+	symKnown                  // originates from path in the view's input pair
+	symUnknown                // untraceable origin, may be a stored bigmap
+)
+
+type symValue struct {
+	kind symKind
+	path string
+}
+
+type symStack struct {
+	vals   []symValue // top of stack is last
+	failed bool       // code path always fails
+	lost   bool       // stack layout is unknown
+}
+
+func (s symStack) clone() symStack {
+	s.vals = append([]symValue(nil), s.vals...)
+	return s
+}
+
+func (s *symStack) push(v ...symValue) {
+	s.vals = append(s.vals, v...)
+}
+
+func (s *symStack) pop(n int) []symValue {
+	if len(s.vals) < n {
+		s.lost = true
+		return nil
+	}
+	l := len(s.vals) - n
+	v := append([]symValue(nil), s.vals[l:]...)
+	s.vals = s.vals[:l]
+	return v
+}
+
+// merge joins stacks of two code branches.
+func (s symStack) merge(o symStack) symStack {
+	switch {
+	case s.lost || o.lost:
+		s.lost = true
+		return s
+	case s.failed:
+		return o
+	case o.failed:
+		return s
+	case len(s.vals) != len(o.vals):
+		s.lost = true
+		return s
+	}
+	for i, v := range o.vals {
+		if s.vals[i] != v {
+			s.vals[i] = symValue{kind: symUnknown}
+		}
+	}
+	return s
+}
+
+type viewAnalyzer struct {
+	input   micheline.Prim // pair param storage
+	paths   map[string]struct{}
+	dynamic bool
+}
+
+// pairArg returns the left or right side of a (comb) pair type or value.
+func pairArg(p micheline.Prim, right bool) (micheline.Prim, bool) {
+	switch {
+	case p.OpCode == micheline.T_PAIR, p.OpCode == micheline.D_PAIR, p.IsSequence():
+	default:
+		return micheline.Prim{}, false
+	}
+	if len(p.Args) < 2 {
+		return micheline.Prim{}, false
+	}
+	if !right {
+		return p.Args[0], true
+	}
+	if len(p.Args) == 2 {
+		return p.Args[1], true
+	}
+	comb := p
+	comb.Args = p.Args[1:]
+	comb.Anno = nil
+	return comb, true
+}
+
+func (a *viewAnalyzer) typeAt(path string) (micheline.Prim, bool) {
+	typ := a.input
+	for _, b := range []byte(path) {
+		var ok bool
+		if typ, ok = pairArg(typ, b == '1'); !ok {
+			return micheline.Prim{}, false
+		}
+	}
+	return typ, true
+}
+
+func containsBigmap(typ micheline.Prim) bool {
+	var found bool
+	_ = typ.Walk(func(p micheline.Prim) error {
+		if p.OpCode == micheline.T_BIG_MAP {
+			found = true
+			return micheline.PrimSkip
+		}
+		return nil
+	})
+	return found
+}
+
+// access returns the value at branch path sub of v.
+func (a *viewAnalyzer) access(v symValue, sub string) symValue {
+	if v.kind != symKnown {
+		return symValue{kind: v.kind}
+	}
+	path := v.path + sub
+	if _, ok := a.typeAt(path); !ok {
+		return symValue{kind: symUnknown}
+	}
+	return symValue{kind: symKnown, path: path}
+}
+
+// derive returns a value derived from the contents of v, e.g. list
+// elements, option or union payloads.
+func (a *viewAnalyzer) derive(v symValue) symValue {
+	switch v.kind {
+	case symPlain:
+		return v
+	case symKnown:
+		if typ, ok := a.typeAt(v.path); ok && !containsBigmap(typ) {
+			return symValue{kind: symPlain}
+		}
+	}
+	return symValue{kind: symUnknown}
+}
+
+// read records a bigmap read from v and returns the looked up value.
+func (a *viewAnalyzer) read(v symValue) symValue {
+	switch v.kind {
+	case symPlain:
+		return v
+	case symUnknown:
+		a.dynamic = true
+		return v
+	}
+	typ, ok := a.typeAt(v.path)
+	if !ok {
+		a.dynamic = true
+		return symValue{kind: symUnknown}
+	}
+	if typ.OpCode == micheline.T_BIG_MAP {
+		if strings.HasPrefix(v.path, "1") {
+			a.paths[v.path[1:]] = struct{}{}
+		} else {
+			// bigmap passed as view parameter
+			a.dynamic = true
+		}
+	}
+	if len(typ.Args) > 1 && !containsBigmap(typ.Args[1]) {
+		return symValue{kind: symPlain}
+	}
+	return symValue{kind: symUnknown}
+}
+
+// combine returns a value built from vals, e.g. a pair or list.
+func combine(vals []symValue) symValue {
+	for _, v := range vals {
+		if v.kind != symPlain {
+			return symValue{kind: symUnknown}
+		}
+	}
+	return symValue{kind: symPlain}
+}
+
+func intArg(p micheline.Prim, dflt int) int {
+	if len(p.Args) > 0 && p.Args[0].Type == micheline.PrimInt && p.Args[0].Int != nil {
+		return int(p.Args[0].Int.Int64())
+	}
+	return dflt
+}
+
+// pairPath returns the branch path of GET n and UNPAIR n components.
+func pairPath(n int) string {
+	return strings.Repeat("1", n/2) + strings.Repeat("0", n%2)
+}
+
+func (a *viewAnalyzer) exec(code micheline.Prim, vals []symValue) symStack {
+	s := symStack{vals: append([]symValue(nil), vals...)}
+	a.run(code, &s)
+	return s
+}
+
+func (a *viewAnalyzer) block(p micheline.Prim, i int) micheline.Prim {
+	if i < len(p.Args) {
+		return p.Args[i]
+	}
+	return micheline.NewSeq()
+}
+
+func (a *viewAnalyzer) run(code micheline.Prim, s *symStack) {
+	if s.lost || s.failed {
+		return
+	}
+	if code.IsSequence() {
+		for _, p := range code.Args {
+			a.run(p, s)
+			if s.lost || s.failed {
+				return
+			}
+		}
+		return
+	}
+	plain := symValue{kind: symPlain}
+	unknown := symValue{kind: symUnknown}
+
+	switch code.OpCode {
+	// stack manipulation
+	case micheline.I_DROP:
+		s.pop(intArg(code, 1))
+	case micheline.I_DUP:
+		n := intArg(code, 1)
+		if n < 1 || n > len(s.vals) {
+			s.lost = true
+			return
+		}
+		s.push(s.vals[len(s.vals)-n])
+	case micheline.I_SWAP:
+		v := s.pop(2)
+		if v != nil {
+			s.push(v[1], v[0])
+		}
+	case micheline.I_DIG:
+		v := s.pop(intArg(code, 0) + 1)
+		if v != nil {
+			s.push(v[1:]...)
+			s.push(v[0])
+		}
+	case micheline.I_DUG:
+		v := s.pop(intArg(code, 0) + 1)
+		if v != nil {
+			s.push(v[len(v)-1])
+			s.push(v[:len(v)-1]...)
+		}
+	case micheline.I_RENAME, micheline.I_CAST:
+		// no stack change
+
+	// pair access
+	case micheline.I_CAR:
+		if v := s.pop(1); v != nil {
+			s.push(a.access(v[0], "0"))
+		}
+	case micheline.I_CDR:
+		if v := s.pop(1); v != nil {
+			s.push(a.access(v[0], "1"))
+		}
+	case micheline.I_UNPAIR:
+		n := intArg(code, 2)
+		v := s.pop(1)
+		if v == nil || n < 2 {
+			s.lost = true
+			return
+		}
+		for i := n - 1; i >= 0; i-- {
+			if i == n-1 {
+				s.push(a.access(v[0], strings.Repeat("1", i)))
+			} else {
+				s.push(a.access(v[0], pairPath(2*i+1)))
+			}
+		}
+	case micheline.I_PAIR:
+		s.push(combine(s.pop(intArg(code, 2))))
+
+	// bigmap reads
+	case micheline.I_GET:
+		if len(code.Args) > 0 {
+			if v := s.pop(1); v != nil {
+				s.push(a.access(v[0], pairPath(intArg(code, 0))))
+			}
+			return
+		}
+		if v := s.pop(2); v != nil {
+			s.push(a.read(v[0]))
+		}
+	case micheline.I_MEM:
+		if v := s.pop(2); v != nil {
+			a.read(v[0])
+			s.push(plain)
+		}
+	case micheline.I_GET_AND_UPDATE:
+		if v := s.pop(3); v != nil {
+			s.push(v[0], a.read(v[0]))
+		}
+	case micheline.I_UPDATE:
+		if len(code.Args) > 0 {
+			s.push(combine(s.pop(2)))
+			return
+		}
+		if v := s.pop(3); v != nil {
+			s.push(v[0])
+		}
+
+	// control flow
+	case micheline.I_FAILWITH, micheline.I_NEVER:
+		s.failed = true
+	case micheline.I_DIP:
+		n := intArg(code, 1)
+		body := a.block(code, len(code.Args)-1)
+		top := s.pop(n)
+		if s.lost {
+			return
+		}
+		a.run(body, s)
+		s.push(top...)
+	case micheline.I_IF:
+		s.pop(1)
+		a.branch(s, code, nil, nil)
+	case micheline.I_IF_NONE:
+		if v := s.pop(1); v != nil {
+			a.branch(s, code, nil, []symValue{a.derive(v[0])})
+		}
+	case micheline.I_IF_LEFT:
+		if v := s.pop(1); v != nil {
+			a.branch(s, code, []symValue{a.derive(v[0])}, []symValue{a.derive(v[0])})
+		}
+	case micheline.I_IF_CONS:
+		if v := s.pop(1); v != nil {
+			a.branch(s, code, []symValue{v[0], a.derive(v[0])}, nil)
+		}
+	case micheline.I_LOOP:
+		s.pop(1)
+		a.loop(s, a.block(code, 0), nil, 1)
+	case micheline.I_LOOP_LEFT:
+		if v := s.pop(1); v != nil {
+			a.loop(s, a.block(code, 0), []symValue{unknown}, 1)
+			s.push(unknown)
+		}
+	case micheline.I_ITER:
+		if v := s.pop(1); v != nil {
+			a.loop(s, a.block(code, 0), []symValue{a.derive(v[0])}, 0)
+		}
+	case micheline.I_MAP:
+		if v := s.pop(1); v != nil {
+			a.loop(s, a.block(code, 0), []symValue{a.derive(v[0])}, 1)
+			s.push(unknown)
+		}
+	case micheline.I_LAMBDA, micheline.I_LAMBDA_REC:
+		// lambda arguments are untraceable
+		body := a.block(code, len(code.Args)-1)
+		args := []symValue{unknown}
+		if code.OpCode == micheline.I_LAMBDA_REC {
+			args = []symValue{plain, unknown}
+		}
+		if ls := a.exec(body, args); ls.lost {
+			a.dynamic = true
+		}
+		s.push(plain)
+
+	// values which cannot be stored bigmaps
+	case micheline.I_PUSH, micheline.I_NIL, micheline.I_NONE, micheline.I_UNIT,
+		micheline.I_EMPTY_SET, micheline.I_EMPTY_MAP, micheline.I_EMPTY_BIG_MAP,
+		micheline.I_NOW, micheline.I_AMOUNT, micheline.I_BALANCE, micheline.I_SENDER,
+		micheline.I_SOURCE, micheline.I_SELF, micheline.I_SELF_ADDRESS,
+		micheline.I_CHAIN_ID, micheline.I_LEVEL, micheline.I_TOTAL_VOTING_POWER,
+		micheline.I_MIN_BLOCK_TIME, micheline.I_SAPLING_EMPTY_STATE,
+		micheline.I_STEPS_TO_QUOTA:
+		s.push(plain)
+	case micheline.I_NOT, micheline.I_NEG, micheline.I_ABS, micheline.I_ISNAT,
+		micheline.I_INT, micheline.I_NAT, micheline.I_BYTES, micheline.I_EQ,
+		micheline.I_NEQ, micheline.I_LT, micheline.I_GT, micheline.I_LE, micheline.I_GE,
+		micheline.I_SIZE, micheline.I_HASH_KEY, micheline.I_BLAKE2B,
+		micheline.I_SHA256, micheline.I_SHA512, micheline.I_KECCAK, micheline.I_SHA3,
+		micheline.I_PACK, micheline.I_UNPACK, micheline.I_CONTRACT, micheline.I_ADDRESS,
+		micheline.I_IMPLICIT_ACCOUNT, micheline.I_VOTING_POWER,
+		micheline.I_SET_DELEGATE, micheline.I_JOIN_TICKETS, micheline.I_PAIRING_CHECK,
+		micheline.I_EMIT:
+		s.pop(1)
+		s.push(plain)
+	case micheline.I_SOME, micheline.I_LEFT, micheline.I_RIGHT:
+		s.push(combine(s.pop(1)))
+	case micheline.I_READ_TICKET:
+		s.push(plain)
+	case micheline.I_ADD, micheline.I_SUB, micheline.I_SUB_MUMAV, micheline.I_MUL,
+		micheline.I_EDIV, micheline.I_LSL, micheline.I_LSR, micheline.I_OR,
+		micheline.I_AND, micheline.I_XOR, micheline.I_COMPARE, micheline.I_TICKET,
+		micheline.I_SPLIT_TICKET, micheline.I_SAPLING_VERIFY_UPDATE:
+		s.pop(2)
+		s.push(plain)
+	case micheline.I_CONS, micheline.I_APPLY, micheline.I_EXEC:
+		// lambda results derive from their arguments and captured values
+		s.push(combine(s.pop(2)))
+	case micheline.I_VIEW:
+		// view return types cannot contain bigmaps
+		s.pop(2)
+		s.push(plain)
+	case micheline.I_CHECK_SIGNATURE, micheline.I_SLICE, micheline.I_TRANSFER_TOKENS,
+		micheline.I_OPEN_CHEST:
+		s.pop(3)
+		s.push(plain)
+	case micheline.I_CREATE_CONTRACT:
+		s.pop(3)
+		s.push(plain, plain)
+	default:
+		// CONCAT arity depends on operand types, others are unsupported
+		s.lost = true
+	}
+}
+
+// branch runs both branches of a conditional which push extra values
+// before branch code runs and merges their results.
+func (a *viewAnalyzer) branch(s *symStack, code micheline.Prim, first, second []symValue) {
+	if s.lost {
+		return
+	}
+	s1, s2 := s.clone(), s.clone()
+	s1.push(first...)
+	s2.push(second...)
+	a.run(a.block(code, 0), &s1)
+	a.run(a.block(code, 1), &s2)
+	*s = s1.merge(s2)
+}
+
+// loop runs body once on stack with extra values pushed, pops n results
+// and merges with the stack after zero iterations.
+func (a *viewAnalyzer) loop(s *symStack, body micheline.Prim, extra []symValue, n int) {
+	if s.lost {
+		return
+	}
+	b := s.clone()
+	b.push(extra...)
+	a.run(body, &b)
+	b.pop(n)
+	*s = s.merge(b)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+func TestAnalyzeViewBigmaps(t *testing.T) {
+	var (
+		nat    = micheline.NewPrim(micheline.T_NAT)
+		addr   = micheline.NewPrim(micheline.T_ADDRESS)
+		str    = micheline.NewPrim(micheline.T_STRING)
+		bytes  = micheline.NewPrim(micheline.T_BYTES)
+		ledger = micheline.NewCode(micheline.T_BIG_MAP, addr, nat)
+		meta   = micheline.NewCode(micheline.T_BIG_MAP, str, bytes)
+		op     = func(c micheline.OpCode, args ...micheline.Prim) micheline.Prim {
+			return micheline.NewCode(c, args...)
+		}
+		seq  = micheline.NewSeq
+		view = func(name string, param, ret, code micheline.Prim) micheline.Prim {
+			return micheline.NewCode(micheline.K_VIEW, micheline.NewString(name), param, ret, code)
+		}
+	)
+	ledger.Anno = []string{"%ledger"}
+	meta.Anno = []string{"%metadata"}
+
+	script := micheline.NewScript()
+	script.Code.Param = micheline.NewCode(micheline.K_PARAMETER, micheline.NewPrim(micheline.T_UNIT))
+	script.Code.Storage = micheline.NewCode(micheline.K_STORAGE, micheline.NewCode(micheline.T_PAIR, ledger, meta, nat))
+	script.Code.Code = micheline.NewCode(micheline.K_CODE, seq())
+	script.Code.View = seq(
+		// storage.ledger[param]
+		view("balance", addr, nat, seq(
+			op(micheline.I_UNPAIR),
+			op(micheline.I_SWAP),
+			op(micheline.I_CAR),
+			op(micheline.I_SWAP),
+			op(micheline.I_GET),
+			op(micheline.I_IF_NONE, seq(op(micheline.I_PUSH, nat, micheline.NewInt64(0))), seq()),
+		)),
+		// storage.metadata[param] via comb access inside DIP
+		view("meta", str, bytes, seq(
+			op(micheline.I_UNPAIR),
+			op(micheline.I_DIP, seq(op(micheline.I_GET, micheline.NewInt64(3)))),
+			op(micheline.I_GET),
+			op(micheline.I_IF_NONE, seq(op(micheline.I_UNIT), op(micheline.I_FAILWITH)), seq()),
+		)),
+		// both bigmaps in different branches of a conditional
+		view("both", str, micheline.NewPrim(micheline.T_BOOL), seq(
+			op(micheline.I_UNPAIR),
+			op(micheline.I_DUP, micheline.NewInt64(2)),
+			op(micheline.I_GET, micheline.NewInt64(4)),
+			op(micheline.I_PUSH, nat, micheline.NewInt64(0)),
+			op(micheline.I_COMPARE),
+			op(micheline.I_EQ),
+			op(micheline.I_IF,
+				seq(op(micheline.I_SWAP), op(micheline.I_CAR), op(micheline.I_SWAP), op(micheline.I_DROP), op(micheline.I_SENDER), op(micheline.I_MEM)),
+				seq(op(micheline.I_SWAP), op(micheline.I_GET, micheline.NewInt64(3)), op(micheline.I_SWAP), op(micheline.I_MEM)),
+			),
+		)),
+		// bigmap passed as parameter
+		view("param", micheline.NewCode(micheline.T_BIG_MAP, nat, nat), nat, seq(
+			op(micheline.I_CAR),
+			op(micheline.I_PUSH, nat, micheline.NewInt64(1)),
+			op(micheline.I_GET),
+			op(micheline.I_IF_NONE, seq(op(micheline.I_PUSH, nat, micheline.NewInt64(0))), seq()),
+		)),
+		// no bigmap reads
+		view("total", micheline.NewPrim(micheline.T_UNIT), nat, seq(
+			op(micheline.I_CDR),
+			op(micheline.I_GET, micheline.NewInt64(4)),
+		)),
+		// unsupported instruction
+		view("concat", str, str, seq(
+			op(micheline.I_UNPAIR),
+			op(micheline.I_CONCAT),
+		)),
+	)
+
+	// analyze scripts as loaded from the database
+	storage := micheline.NewCode(micheline.D_PAIR, micheline.NewInt64(5), micheline.NewInt64(6), micheline.NewInt64(42))
+	script.Storage = storage
+	buf, err := script.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	script = micheline.NewScript()
+	if err := script.UnmarshalBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got := AnalyzeViewBigmaps(script)
+	want := []ViewBigmaps{
+		{View: "balance", Paths: []string{"0"}},
+		{View: "both", Paths: []string{"0", "10"}},
+		{View: "concat", Paths: []string{}, Dynamic: true},
+		{View: "meta", Paths: []string{"10"}},
+		{View: "param", Paths: []string{}, Dynamic: true},
+		{View: "total", Paths: []string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	for path, id := range map[string]int64{"0": 5, "10": 6} {
+		if n, ok := BigmapAtPath(script.StorageType().Prim, storage, path); !ok || n != id {
+			t.Errorf("path %s: got bigmap %d %t, want %d", path, n, ok, id)
+		}
+	}
+	if _, ok := BigmapAtPath(script.StorageType().Prim, storage, "11"); ok {
+		t.Errorf("path 11 is not a bigmap")
+	}
+}
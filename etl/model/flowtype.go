@@ -66,6 +66,60 @@ func (c FlowKind) String() string {
 	}
 }
 
+// FlowOrigin is the origin of the balance update that caused a flow. Most
+// updates are caused by block application, others are injected by protocol
+// migrations, liquidity baking subsidies or delayed operations (slashing).
+type FlowOrigin byte
+
+const (
+	FlowOriginBlock      FlowOrigin = iota // 0 block application
+	FlowOriginMigration                    // 1 protocol migration
+	FlowOriginSubsidy                      // 2 liquidity baking subsidy
+	FlowOriginSimulation                   // 3 simulation (not on-chain)
+	FlowOriginDelayed                      // 4 Atlas+ delayed operation
+	FlowOriginInvalid
+)
+
+// ParseFlowOrigin parses the origin field of RPC balance updates. Updates
+// without origin are from block application.
+func ParseFlowOrigin(s string) FlowOrigin {
+	switch s {
+	case "", "block":
+		return FlowOriginBlock
+	case "migration":
+		return FlowOriginMigration
+	case "subsidy":
+		return FlowOriginSubsidy
+	case "simulation":
+		return FlowOriginSimulation
+	case "delayed_operation":
+		return FlowOriginDelayed
+	default:
+		return FlowOriginInvalid
+	}
+}
+
+func (o FlowOrigin) IsValid() bool {
+	return o < FlowOriginInvalid
+}
+
+func (o FlowOrigin) String() string {
+	switch o {
+	case FlowOriginBlock:
+		return "block"
+	case FlowOriginMigration:
+		return "migration"
+	case FlowOriginSubsidy:
+		return "subsidy"
+	case FlowOriginSimulation:
+		return "simulation"
+	case FlowOriginDelayed:
+		return "delayed_operation"
+	default:
+		return "invalid"
+	}
+}
+
 type FlowType byte
 
 const (
@@ -0,0 +1,171 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// ContractInteraction summarizes all interactions between an account and
+// a contract.
+type ContractInteraction struct {
+	Contract    AccountID
+	FirstHeight int64
+	FirstTime   time.Time
+	LastHeight  int64
+	LastTime    time.Time
+	Count       int
+}
+
+// InteractionPeer returns the contract an account interacted with in op.
+// The direct source of internal operations is the calling contract, so the
+// signer of an operation group only interacts with the contract it called,
+// not with contracts called further down the chain. Accounts interact with
+// contracts they call and with contracts that call or pay them.
+func InteractionPeer(op *Op, id AccountID) (AccountID, bool) {
+	src := op.SenderId
+	if op.IsInternal {
+		src = op.CreatorId
+	}
+	switch {
+	case src == id && op.IsContract && op.ReceiverId != id:
+		return op.ReceiverId, true
+	case op.ReceiverId == id && op.IsInternal && src != id:
+		return src, true
+	default:
+		return 0, false
+	}
+}
+
+// InteractionSet aggregates interactions per contract. An operation is
+// counted once per contract, even when it also emits token events.
+type InteractionSet struct {
+	list map[AccountID]*ContractInteraction
+	seen map[[2]uint64]struct{}
+}
+
+func NewInteractionSet() *InteractionSet {
+	return &InteractionSet{
+		list: make(map[AccountID]*ContractInteraction),
+		seen: make(map[[2]uint64]struct{}),
+	}
+}
+
+func (s *InteractionSet) Add(contract AccountID, op OpID, height int64, tm time.Time) {
+	key := [2]uint64{contract.U64(), op.U64()}
+	if _, ok := s.seen[key]; ok {
+		return
+	}
+	s.seen[key] = struct{}{}
+	v, ok := s.list[contract]
+	if !ok {
+		v = &ContractInteraction{
+			Contract:    contract,
+			FirstHeight: height,
+			FirstTime:   tm,
+			LastHeight:  height,
+			LastTime:    tm,
+		}
+		s.list[contract] = v
+	}
+	if height < v.FirstHeight {
+		v.FirstHeight, v.FirstTime = height, tm
+	}
+	if height > v.LastHeight {
+		v.LastHeight, v.LastTime = height, tm
+	}
+	v.Count++
+}
+
+// List returns interactions sorted by last interaction, most recent first.
+func (s *InteractionSet) List() []*ContractInteraction {
+	list := make([]*ContractInteraction, 0, len(s.list))
+	for _, v := range s.list {
+		list = append(list, v)
+	}
+	slices.SortFunc(list, func(a, b *ContractInteraction) int {
+		if a.LastHeight != b.LastHeight {
+			return cmp.Compare(b.LastHeight, a.LastHeight)
+		}
+		return cmp.Compare(a.Contract, b.Contract)
+	})
+	return list
+}
+
+// EntrypointCall counts calls from an account to a contract entrypoint.
+// NInternal is the number of calls made by the account's contract code
+// and is included in Count.
+type EntrypointCall struct {
+	Contract    AccountID
+	Entrypoint  int
+	Count       int
+	NInternal   int
+	FirstHeight int64
+	LastHeight  int64
+}
+
+// IsEntrypointCaller returns true when an account is the direct source of
+// contract call op. Top-level calls belong to their signer, internal calls
+// to the contract that emitted them, so a signer is not attributed calls
+// made further down the chain.
+func IsEntrypointCaller(op *Op, id AccountID) bool {
+	if !op.IsContract {
+		return false
+	}
+	if op.IsInternal {
+		return op.CreatorId == id
+	}
+	return op.SenderId == id
+}
+
+// EntrypointCallSet aggregates calls per contract and entrypoint.
+type EntrypointCallSet struct {
+	list map[[2]uint64]*EntrypointCall
+}
+
+func NewEntrypointCallSet() *EntrypointCallSet {
+	return &EntrypointCallSet{
+		list: make(map[[2]uint64]*EntrypointCall),
+	}
+}
+
+func (s *EntrypointCallSet) Add(op *Op) {
+	key := [2]uint64{op.ReceiverId.U64(), uint64(op.Entrypoint)}
+	v, ok := s.list[key]
+	if !ok {
+		v = &EntrypointCall{
+			Contract:    op.ReceiverId,
+			Entrypoint:  op.Entrypoint,
+			FirstHeight: op.Height,
+			LastHeight:  op.Height,
+		}
+		s.list[key] = v
+	}
+	v.FirstHeight = min(v.FirstHeight, op.Height)
+	v.LastHeight = max(v.LastHeight, op.Height)
+	v.Count++
+	if op.IsInternal {
+		v.NInternal++
+	}
+}
+
+// List returns calls sorted by count, most frequent first.
+func (s *EntrypointCallSet) List() []*EntrypointCall {
+	list := make([]*EntrypointCall, 0, len(s.list))
+	for _, v := range s.list {
+		list = append(list, v)
+	}
+	slices.SortFunc(list, func(a, b *EntrypointCall) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		if a.Contract != b.Contract {
+			return cmp.Compare(a.Contract, b.Contract)
+		}
+		return cmp.Compare(a.Entrypoint, b.Entrypoint)
+	})
+	return list
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContractInteractions(t *testing.T) {
+	const (
+		user   AccountID = 1
+		dex    AccountID = 2
+		ledger AccountID = 3
+		other  AccountID = 4
+	)
+	// user calls dex which calls the token ledger and pays the user
+	ops := []*Op{
+		{RowId: 10, Height: 100, SenderId: user, ReceiverId: dex, IsContract: true},
+		{RowId: 11, Height: 100, SenderId: user, CreatorId: dex, ReceiverId: ledger, IsContract: true, IsInternal: true},
+		{RowId: 12, Height: 100, SenderId: user, CreatorId: dex, ReceiverId: user, IsInternal: true},
+		// a plain transfer from another user
+		{RowId: 13, Height: 200, SenderId: other, ReceiverId: user},
+		// second dex call
+		{RowId: 14, Height: 300, SenderId: user, ReceiverId: dex, IsContract: true},
+	}
+	set := NewInteractionSet()
+	for _, op := range ops {
+		if peer, ok := InteractionPeer(op, user); ok {
+			set.Add(peer, op.RowId, op.Height, time.Time{})
+		}
+	}
+	// token transfer emitted by the ledger call, the same op from the dex
+	// is only counted once
+	set.Add(ledger, 11, 100, time.Time{})
+	set.Add(dex, 10, 100, time.Time{})
+
+	list := set.List()
+	if len(list) != 2 {
+		t.Fatalf("got %d contracts, want 2: %v", len(list), list)
+	}
+	want := []ContractInteraction{
+		{Contract: dex, FirstHeight: 100, LastHeight: 300, Count: 3},
+		{Contract: ledger, FirstHeight: 100, LastHeight: 100, Count: 1},
+	}
+	for i, w := range want {
+		if got := *list[i]; got != w {
+			t.Errorf("interaction %d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestEntrypointCalls(t *testing.T) {
+	const (
+		user   AccountID = 1
+		proxy  AccountID = 2
+		dex    AccountID = 3
+		ledger AccountID = 4
+	)
+	ops := []*Op{
+		// user calls its proxy which calls the dex which calls the ledger
+		{Height: 100, SenderId: user, ReceiverId: proxy, Entrypoint: 0, IsContract: true},
+		{Height: 100, SenderId: user, CreatorId: proxy, ReceiverId: dex, Entrypoint: 2, IsContract: true, IsInternal: true},
+		{Height: 100, SenderId: user, CreatorId: dex, ReceiverId: ledger, Entrypoint: 1, IsContract: true, IsInternal: true},
+		// direct dex calls
+		{Height: 200, SenderId: user, ReceiverId: dex, Entrypoint: 2, IsContract: true},
+		{Height: 300, SenderId: user, ReceiverId: dex, Entrypoint: 2, IsContract: true},
+		// plain transfer
+		{Height: 300, SenderId: user, ReceiverId: ledger},
+	}
+	for _, c := range []struct {
+		caller AccountID
+		want   []EntrypointCall
+	}{
+		{user, []EntrypointCall{
+			{Contract: dex, Entrypoint: 2, Count: 2, FirstHeight: 200, LastHeight: 300},
+			{Contract: proxy, Entrypoint: 0, Count: 1, FirstHeight: 100, LastHeight: 100},
+		}},
+		{proxy, []EntrypointCall{
+			{Contract: dex, Entrypoint: 2, Count: 1, NInternal: 1, FirstHeight: 100, LastHeight: 100},
+		}},
+	} {
+		set := NewEntrypointCallSet()
+		for _, op := range ops {
+			if IsEntrypointCaller(op, c.caller) {
+				set.Add(op)
+			}
+		}
+		list := set.List()
+		if len(list) != len(c.want) {
+			t.Fatalf("caller %d: got %d calls, want %d", c.caller, len(list), len(c.want))
+		}
+		for i, w := range c.want {
+			if got := *list[i]; got != w {
+				t.Errorf("caller %d call %d: got %+v, want %+v", c.caller, i, got, w)
+			}
+		}
+	}
+}
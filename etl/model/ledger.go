@@ -0,0 +1,69 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+// LedgerEntry is a balance flow in double-entry form. Out-flows debit and
+// in-flows credit the account's balance category. Moves between the
+// account's own categories (staking, unstaking, deposits and unfreeze) are
+// transfers with the account itself as counterparty on the other
+// category, so both legs of a transfer net to zero.
+type LedgerEntry struct {
+	Flow            *Flow
+	Category        BalanceCategory
+	CounterCategory BalanceCategory // valid for transfers only
+	Debit           int64
+	Credit          int64
+	IsTransfer      bool
+}
+
+// NewLedgerEntry converts f into a ledger entry. Delegation flows move
+// balances of other accounts and are not part of an account's ledger.
+func NewLedgerEntry(f *Flow) (*LedgerEntry, bool) {
+	c := FlowBalanceCategory(f)
+	if !c.IsValid() {
+		return nil, false
+	}
+	e := &LedgerEntry{
+		Flow:     f,
+		Category: c,
+		Debit:    f.AmountOut,
+		Credit:   f.AmountIn,
+	}
+	if f.IsFee {
+		return e, true
+	}
+	switch f.Type {
+	case FlowTypeStake:
+		e.IsTransfer = true
+		if c == BalanceCategorySpendable {
+			e.CounterCategory = BalanceCategoryStaked
+		} else {
+			e.CounterCategory = BalanceCategorySpendable
+		}
+	case FlowTypeUnstake:
+		e.IsTransfer = true
+		if f.AmountIn > 0 {
+			// in-flow to the unstaked pool
+			e.Category = BalanceCategoryUnstaked
+			e.CounterCategory = BalanceCategoryStaked
+		} else {
+			e.CounterCategory = BalanceCategoryUnstaked
+		}
+	case FlowTypeFinalizeUnstake:
+		e.IsTransfer = true
+		if c == BalanceCategorySpendable {
+			e.CounterCategory = BalanceCategoryUnstaked
+		} else {
+			e.CounterCategory = BalanceCategorySpendable
+		}
+	case FlowTypeDeposit, FlowTypeInternal:
+		e.IsTransfer = true
+		if c == BalanceCategorySpendable {
+			e.CounterCategory = BalanceCategoryFrozen
+		} else {
+			e.CounterCategory = BalanceCategorySpendable
+		}
+	}
+	return e, true
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import "testing"
+
+func TestLedgerEntry(t *testing.T) {
+	for _, c := range []struct {
+		flow     Flow
+		ok       bool
+		category BalanceCategory
+		counter  BalanceCategory
+		transfer bool
+	}{
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeTransaction, AmountIn: 1000}, true, BalanceCategorySpendable, BalanceCategoryInvalid, false},
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeStake, AmountOut: 10, IsFee: true}, true, BalanceCategorySpendable, BalanceCategoryInvalid, false},
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeStake, AmountOut: 500}, true, BalanceCategorySpendable, BalanceCategoryStaked, true},
+		{Flow{Kind: FlowKindStake, Type: FlowTypeStake, AmountIn: 500}, true, BalanceCategoryStaked, BalanceCategorySpendable, true},
+		{Flow{Kind: FlowKindStake, Type: FlowTypeUnstake, AmountOut: 200}, true, BalanceCategoryStaked, BalanceCategoryUnstaked, true},
+		{Flow{Kind: FlowKindStake, Type: FlowTypeUnstake, AmountIn: 200}, true, BalanceCategoryUnstaked, BalanceCategoryStaked, true},
+		{Flow{Kind: FlowKindStake, Type: FlowTypeFinalizeUnstake, AmountOut: 200}, true, BalanceCategoryUnstaked, BalanceCategorySpendable, true},
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeFinalizeUnstake, AmountIn: 200}, true, BalanceCategorySpendable, BalanceCategoryUnstaked, true},
+		{Flow{Kind: FlowKindBalance, Type: FlowTypeDeposit, AmountOut: 300}, true, BalanceCategorySpendable, BalanceCategoryFrozen, true},
+		{Flow{Kind: FlowKindDeposits, Type: FlowTypeInternal, AmountOut: 300, IsUnfrozen: true}, true, BalanceCategoryFrozen, BalanceCategorySpendable, true},
+		{Flow{Kind: FlowKindRewards, Type: FlowTypeBaking, AmountIn: 40, IsFrozen: true}, true, BalanceCategoryFrozen, BalanceCategoryInvalid, false},
+		{Flow{Kind: FlowKindDelegation, Type: FlowTypeStake, AmountOut: 500}, false, BalanceCategoryInvalid, BalanceCategoryInvalid, false},
+	} {
+		e, ok := NewLedgerEntry(&c.flow)
+		if ok != c.ok {
+			t.Errorf("%s/%s: ok=%t, want %t", c.flow.Kind, c.flow.Type, ok, c.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if e.Category != c.category || e.CounterCategory != c.counter || e.IsTransfer != c.transfer {
+			t.Errorf("%s/%s: got %s/%s transfer=%t, want %s/%s transfer=%t",
+				c.flow.Kind, c.flow.Type, e.Category, e.CounterCategory, e.IsTransfer,
+				c.category, c.counter, c.transfer)
+		}
+		if e.Debit != c.flow.AmountOut || e.Credit != c.flow.AmountIn {
+			t.Errorf("%s/%s: debit=%d credit=%d", c.flow.Kind, c.flow.Type, e.Debit, e.Credit)
+		}
+	}
+}
@@ -162,6 +162,17 @@ func (t OpType) IsEvent() bool {
 	}
 }
 
+// IsProtocolEvent returns true for implicit events injected by protocol
+// migrations which change balances outside of regular block operations.
+func (t OpType) IsProtocolEvent() bool {
+	switch t {
+	case OpTypeInvoice, OpTypeAirdrop, OpTypeMigration:
+		return true
+	default:
+		return false
+	}
+}
+
 func MapOpType(typ mavryk.OpType) OpType {
 	switch typ {
 	case mavryk.OpTypeActivateAccount:
@@ -291,3 +302,15 @@ func (l OpTypeList) Contains(typ OpType) bool {
 	}
 	return false
 }
+
+func ParseOpTypeList(list []string) (OpTypeList, error) {
+	res := make(OpTypeList, 0, len(list))
+	for _, v := range list {
+		var t OpType
+		if err := t.UnmarshalText([]byte(v)); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"strconv"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+// ContractPattern selects contracts by address or by code hash (hex) for
+// config driven storage extraction. When both are set both must match.
+type ContractPattern struct {
+	Contract mavryk.Address `json:"contract"`
+	CodeHash string         `json:"code_hash"`
+}
+
+func (p ContractPattern) Match(c *Contract) bool {
+	if p.Contract.IsValid() && !p.Contract.Equal(c.Address) {
+		return false
+	}
+	if p.CodeHash != "" {
+		h, err := strconv.ParseUint(p.CodeHash, 16, 64)
+		if err != nil || h != c.CodeHash {
+			return false
+		}
+	}
+	return p.Contract.IsValid() || p.CodeHash != ""
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+const ContractRoleTableKey = "contract_roles"
+
+type ContractRoleID uint64
+
+// ContractRole links an address to a named role (e.g. admin, operator) in
+// a contract's storage. Rows are active while LastHeight is zero and closed
+// when a later storage update no longer contains the address.
+type ContractRole struct {
+	Id          ContractRoleID `pack:"I,pk"      json:"row_id"`
+	Contract    AccountID      `pack:"c,bloom=3" json:"contract"`
+	Role        string         `pack:"r,snappy"  json:"role"`
+	Address     mavryk.Address `pack:"a,bloom=3" json:"address"`
+	FirstHeight int64          `pack:"f,i32"     json:"first_height"`
+	LastHeight  int64          `pack:"l,i32"     json:"last_height"` // 0 = active
+}
+
+// Ensure ContractRole items implement the pack.Item interface.
+var _ pack.Item = (*ContractRole)(nil)
+
+func (m *ContractRole) ID() uint64 {
+	return uint64(m.Id)
+}
+
+func (m *ContractRole) SetID(id uint64) {
+	m.Id = ContractRoleID(id)
+}
+
+func (m ContractRole) TableKey() string {
+	return ContractRoleTableKey
+}
+
+func (m ContractRole) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    12,  // 4k pack size
+		JournalSizeLog2: 12,  // 4k journal size
+		CacheSize:       4,   // max MB
+		FillLevel:       100, // boltdb fill level to limit reallocations
+	}
+}
+
+func (m ContractRole) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+func (m ContractRole) IsActive() bool {
+	return m.LastHeight == 0
+}
+
+// RolePattern configures role extraction for contracts with a known storage
+// layout. Paths map storage value paths (as used by micheline.Value.GetValue)
+// to role names.
+type RolePattern struct {
+	ContractPattern
+	Paths map[string]string `json:"paths"`
+}
+
+// RoleSet maps role names to sorted lists of unique addresses.
+type RoleSet map[string][]mavryk.Address
+
+func (s RoleSet) Contains(role string, addr mavryk.Address) bool {
+	return slices.ContainsFunc(s[role], addr.Equal)
+}
+
+// Extract reads role addresses from storage. Paths may point to a single
+// address or to lists, sets and maps of addresses (map keys are used).
+// Missing paths and non-address values are ignored.
+func (p RolePattern) Extract(val micheline.Value) RoleSet {
+	set := make(RoleSet)
+	for path, role := range p.Paths {
+		v, ok := val.GetValue(path)
+		if !ok {
+			continue
+		}
+		for _, a := range collectAddresses(v, nil) {
+			if !set.Contains(role, a) {
+				set[role] = append(set[role], a)
+			}
+		}
+	}
+	for _, list := range set {
+		sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+	}
+	return set
+}
+
+func collectAddresses(v any, res []mavryk.Address) []mavryk.Address {
+	switch t := v.(type) {
+	case mavryk.Address:
+		if t.IsValid() {
+			res = append(res, t)
+		}
+	case string:
+		if a, err := mavryk.ParseAddress(t); err == nil {
+			res = append(res, a)
+		}
+	case []any:
+		for _, vv := range t {
+			res = collectAddresses(vv, res)
+		}
+	case map[string]any:
+		for k := range t {
+			res = collectAddresses(k, res)
+		}
+	}
+	return res
+}
+
+// StorageMatch is a contract whose current storage contains a searched
+// value at the listed paths.
+type StorageMatch struct {
+	Contract *Contract
+	Paths    []string
+}
+
+// FindStorageValue returns sorted paths of storage fields whose value
+// equals s in its string form. Map keys match when s is an address. Paths
+// use the labels of micheline.Value.Map. Bigmap contents are not searched
+// because storage only holds bigmap ids.
+func FindStorageValue(val micheline.Value, s string) []string {
+	m, err := val.Map()
+	if err != nil {
+		return nil
+	}
+	_, err = mavryk.ParseAddress(s)
+	paths := findValue(m, "", s, err == nil, nil)
+	sort.Strings(paths)
+	return paths
+}
+
+func findValue(v any, path, s string, matchKeys bool, res []string) []string {
+	join := func(n string) string {
+		if path == "" {
+			return n
+		}
+		return path + "." + n
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		for k, vv := range t {
+			if matchKeys && k == s {
+				res = append(res, join(k))
+			}
+			res = findValue(vv, join(k), s, matchKeys, res)
+		}
+	case []any:
+		for i, vv := range t {
+			res = findValue(vv, join(strconv.Itoa(i)), s, matchKeys, res)
+		}
+	default:
+		if fmt.Sprint(t) == s {
+			res = append(res, path)
+		}
+	}
+	return res
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+func testAddress(typ mavryk.AddressType, n byte) mavryk.Address {
+	hash := make([]byte, 20)
+	hash[19] = n
+	return mavryk.NewAddress(typ, hash)
+}
+
+func TestRolePatternExtract(t *testing.T) {
+	admin := testAddress(mavryk.AddressTypeEd25519, 1)
+	op1 := testAddress(mavryk.AddressTypeEd25519, 2)
+	op2 := testAddress(mavryk.AddressTypeEd25519, 3)
+
+	typ := micheline.NewType(micheline.NewPairType(
+		micheline.NewPrim(micheline.T_ADDRESS, "%admin"),
+		micheline.NewSetType(micheline.NewPrim(micheline.T_ADDRESS), "%operators"),
+	))
+	val := micheline.NewValue(typ, micheline.NewPair(
+		micheline.NewAddress(admin),
+		micheline.NewSeq(micheline.NewAddress(op1), micheline.NewAddress(op2), micheline.NewAddress(op1)),
+	))
+	p := RolePattern{
+		ContractPattern: ContractPattern{
+			Contract: testAddress(mavryk.AddressTypeContract, 1),
+		},
+		Paths: map[string]string{
+			"admin":     "admin",
+			"operators": "operator",
+			"missing":   "owner",
+		},
+	}
+	roles := p.Extract(val)
+	if !roles.Contains("admin", admin) || len(roles["admin"]) != 1 {
+		t.Errorf("admin role mismatch: %v", roles["admin"])
+	}
+	if !roles.Contains("operator", op1) || !roles.Contains("operator", op2) || len(roles["operator"]) != 2 {
+		t.Errorf("operator role mismatch: %v", roles["operator"])
+	}
+	if _, ok := roles["owner"]; ok {
+		t.Errorf("unexpected role for missing path")
+	}
+
+	if !p.Match(&Contract{Address: p.Contract}) {
+		t.Errorf("pattern must match by address")
+	}
+	if p.Match(&Contract{Address: testAddress(mavryk.AddressTypeContract, 2)}) {
+		t.Errorf("pattern must not match other contracts")
+	}
+	if (RolePattern{}).Match(&Contract{}) {
+		t.Errorf("empty pattern must not match")
+	}
+}
+
+func TestFindStorageValue(t *testing.T) {
+	admin := testAddress(mavryk.AddressTypeEd25519, 1)
+	holder := testAddress(mavryk.AddressTypeEd25519, 2)
+
+	typ := micheline.NewType(micheline.NewPairType(
+		micheline.NewPrim(micheline.T_ADDRESS, "%admin"),
+		micheline.NewPairType(
+			micheline.NewMapType(micheline.NewPrim(micheline.T_ADDRESS), micheline.NewPrim(micheline.T_NAT), "%ledger"),
+			micheline.NewPrim(micheline.T_STRING, "%name"),
+		),
+	))
+	val := micheline.NewValue(typ, micheline.NewPair(
+		micheline.NewAddress(admin),
+		micheline.NewPair(
+			micheline.NewSeq(
+				micheline.NewMapElem(micheline.NewAddress(admin), micheline.NewNat(big.NewInt(42))),
+				micheline.NewMapElem(micheline.NewAddress(holder), micheline.NewNat(big.NewInt(7))),
+			),
+			micheline.NewString("ledger"),
+		),
+	))
+
+	paths := FindStorageValue(val, admin.String())
+	want := []string{"admin", "ledger." + admin.String()}
+	if !slices.Equal(paths, want) {
+		t.Errorf("admin paths %v, want %v", paths, want)
+	}
+	if paths := FindStorageValue(val, "42"); !slices.Equal(paths, []string{"ledger." + admin.String()}) {
+		t.Errorf("value paths %v", paths)
+	}
+	// field names are no values
+	if paths := FindStorageValue(val, "ledger"); !slices.Equal(paths, []string{"name"}) {
+		t.Errorf("string paths %v", paths)
+	}
+	if paths := FindStorageValue(val, testAddress(mavryk.AddressTypeEd25519, 3).String()); len(paths) != 0 {
+		t.Errorf("unexpected match %v", paths)
+	}
+}
@@ -160,7 +160,7 @@ func (s *Supply) Update(b *Block, bakers map[AccountID]*Baker) {
 			s.Activated += op.Volume
 			s.Unclaimed -= op.Volume
 
-		case OpTypeNonceRevelation:
+		case OpTypeNonceRevelation, OpTypeVdfRevelation:
 			s.MintedSeeding += op.Reward
 
 		case OpTypeSeedSlash:
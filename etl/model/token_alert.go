@@ -0,0 +1,103 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+// TokenAlertRule fires a webhook when a token transfer, mint or burn moves
+// more than Threshold tokens. Rules without contract apply to all tokens,
+// rules with contract and without token id to all tokens of a ledger.
+// Thresholds are decimal numbers in token units and are scaled by token
+// metadata decimals (or Decimals when set) to base units before amounts
+// are compared.
+type TokenAlertRule struct {
+	Name      string           `json:"name"`
+	Contract  mavryk.Address   `json:"contract"`  // ledger, omit for all ledgers
+	TokenId   string           `json:"token_id"`  // token id, omit for all tokens
+	Types     []TokenEventType `json:"types"`     // transfer, mint, burn; empty = all
+	Threshold string           `json:"threshold"` // token units, e.g. "1000.5"
+	Decimals  *int             `json:"decimals"`  // overrides metadata decimals
+	Url       string           `json:"url"`       // webhook, empty = token.alert_url
+
+	tokenId   *mavryk.Z
+	threshold *big.Rat
+}
+
+// Parse validates a rule and must be called before it is used.
+func (r *TokenAlertRule) Parse() error {
+	if r.Threshold == "" {
+		return fmt.Errorf("missing threshold")
+	}
+	t, ok := new(big.Rat).SetString(r.Threshold)
+	if !ok || t.Sign() < 0 {
+		return fmt.Errorf("invalid threshold %q", r.Threshold)
+	}
+	r.threshold = t
+	if r.TokenId != "" {
+		if !r.Contract.IsValid() {
+			return fmt.Errorf("token id %s requires contract", r.TokenId)
+		}
+		id, err := mavryk.ParseZ(r.TokenId)
+		if err != nil {
+			return fmt.Errorf("invalid token id %q: %v", r.TokenId, err)
+		}
+		r.tokenId = &id
+	}
+	if r.Decimals != nil && (*r.Decimals < 0 || *r.Decimals > MaxTokenDecimals) {
+		return fmt.Errorf("invalid decimals %d", *r.Decimals)
+	}
+	return nil
+}
+
+// Match returns true when the rule applies to an event of type typ for
+// token id of ledger.
+func (r TokenAlertRule) Match(ledger mavryk.Address, id mavryk.Z, typ TokenEventType) bool {
+	if r.Contract.IsValid() && !r.Contract.Equal(ledger) {
+		return false
+	}
+	if r.tokenId != nil && !r.tokenId.Equal(id) {
+		return false
+	}
+	return len(r.Types) == 0 || slices.Contains(r.Types, typ)
+}
+
+// ScaledThreshold returns the threshold in base units of a token with
+// decimals, rounded down.
+func (r TokenAlertRule) ScaledThreshold(decimals int) *big.Int {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	num := new(big.Int).Mul(r.threshold.Num(), scale)
+	return num.Quo(num, r.threshold.Denom())
+}
+
+// Exceeds returns true when amount in base units is larger than the
+// threshold. Because amounts are integers, comparing against the rounded
+// down threshold is exact.
+func (r TokenAlertRule) Exceeds(amount mavryk.Z, decimals int) bool {
+	return amount.Big().Cmp(r.ScaledThreshold(decimals)) > 0
+}
+
+// TokenAlert is the webhook payload sent when a rule fires. Amount is in
+// base units, Value in token units.
+type TokenAlert struct {
+	Rule      string          `json:"rule"`
+	Type      TokenEventType  `json:"type"`
+	Contract  mavryk.Address  `json:"contract"`
+	TokenId   mavryk.Z        `json:"token_id"`
+	Amount    mavryk.Z        `json:"amount"`
+	Value     string          `json:"value"`
+	Threshold string          `json:"threshold"`
+	Decimals  int             `json:"decimals"`
+	Sender    *mavryk.Address `json:"sender,omitempty"`
+	Receiver  *mavryk.Address `json:"receiver,omitempty"`
+	Height    int64           `json:"height"`
+	Time      time.Time       `json:"time"`
+	OpHash    mavryk.OpHash   `json:"op_hash"`
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+func TestTokenAlertRule(t *testing.T) {
+	ledger := mavryk.NewAddress(mavryk.AddressTypeContract, make([]byte, 20))
+	other := mavryk.NewAddress(mavryk.AddressTypeContract, []byte("01234567890123456789"))
+
+	r := TokenAlertRule{
+		Contract:  ledger,
+		TokenId:   "7",
+		Types:     []TokenEventType{TokenEventTypeMint, TokenEventTypeBurn},
+		Threshold: "1000.5",
+	}
+	if err := r.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Match(ledger, mavryk.NewZ(7), TokenEventTypeMint) {
+		t.Errorf("expected match on mint")
+	}
+	if r.Match(ledger, mavryk.NewZ(7), TokenEventTypeTransfer) {
+		t.Errorf("unexpected match on transfer")
+	}
+	if r.Match(ledger, mavryk.NewZ(8), TokenEventTypeMint) {
+		t.Errorf("unexpected match on other token")
+	}
+	if r.Match(other, mavryk.NewZ(7), TokenEventTypeMint) {
+		t.Errorf("unexpected match on other ledger")
+	}
+
+	// global rules match all ledgers and types
+	g := TokenAlertRule{Threshold: "1"}
+	if err := g.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Match(other, mavryk.NewZ(1), TokenEventTypeTransfer) {
+		t.Errorf("expected global match")
+	}
+
+	// thresholds are scaled by decimals without float conversion
+	for _, c := range []struct {
+		amount string
+		dec    int
+		want   bool
+	}{
+		{"1000", 0, false},
+		{"1001", 0, true},
+		{"1000500000", 6, false},
+		{"1000500001", 6, true},
+		{"1000500000000000000000", 18, false},
+		{"1000500000000000000001", 18, true},
+		{"100050000000000000000000000000000001", 32, true},
+	} {
+		z, err := mavryk.ParseZ(c.amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Exceeds(z, c.dec); got != c.want {
+			t.Errorf("%s with %d decimals: got %t, want %t", c.amount, c.dec, got, c.want)
+		}
+	}
+
+	// invalid rules
+	for _, v := range []TokenAlertRule{
+		{},
+		{Threshold: "-1"},
+		{Threshold: "ten"},
+		{Threshold: "1", TokenId: "1"},
+		{Threshold: "1", Contract: ledger, TokenId: "x"},
+		{Threshold: "1", Decimals: new(int)},
+	} {
+		if v.Decimals != nil {
+			*v.Decimals = MaxTokenDecimals + 1
+		}
+		if err := v.Parse(); err == nil {
+			t.Errorf("%+v: expected error", v)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"sync"
 	"time"
 
@@ -73,21 +75,86 @@ func (t TokenEventType) MarshalText() ([]byte, error) {
 	return []byte(t.String()), nil
 }
 
+// TokenMintOrigin classifies mints by the transaction signer. Admin mints
+// are signed by the ledger creator or an account holding a contract role.
+// Contract mints are issued by contract logic on behalf of other accounts,
+// e.g. bonding curves or public mint functions. Origins of mints on ledgers
+// without a known admin are unknown.
+type TokenMintOrigin byte
+
+const (
+	TokenMintOriginNone TokenMintOrigin = iota // not a mint
+	TokenMintOriginUnknown
+	TokenMintOriginAdmin
+	TokenMintOriginContract
+)
+
+var tokenMintOriginStrings = [...]string{"", "unknown", "admin", "contract"}
+
+func (o TokenMintOrigin) IsValid() bool {
+	return o > TokenMintOriginNone && int(o) < len(tokenMintOriginStrings)
+}
+
+func (o TokenMintOrigin) String() string {
+	if int(o) >= len(tokenMintOriginStrings) {
+		return ""
+	}
+	return tokenMintOriginStrings[o]
+}
+
+func ParseTokenMintOrigin(s string) TokenMintOrigin {
+	for i, v := range tokenMintOriginStrings {
+		if v == s {
+			return TokenMintOrigin(i)
+		}
+	}
+	return TokenMintOriginNone
+}
+
+func (o *TokenMintOrigin) UnmarshalText(data []byte) error {
+	v := ParseTokenMintOrigin(string(data))
+	if !v.IsValid() {
+		return fmt.Errorf("invalid token mint origin %q", string(data))
+	}
+	*o = v
+	return nil
+}
+
+func (o TokenMintOrigin) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// NewTokenMintOrigin classifies a mint signed by signer on a ledger with
+// the given admin addresses.
+func NewTokenMintOrigin(signer mavryk.Address, admins []mavryk.Address) TokenMintOrigin {
+	switch {
+	case len(admins) == 0:
+		return TokenMintOriginUnknown
+	case slices.ContainsFunc(admins, signer.Equal):
+		return TokenMintOriginAdmin
+	default:
+		return TokenMintOriginContract
+	}
+}
+
 type TokenEventID uint64
 
 // TokenEvent tracks all token events such as transfers, mints, burns.
 type TokenEvent struct {
-	Id       TokenEventID   `pack:"I,pk"      json:"row_id"`
-	Ledger   AccountID      `pack:"l,bloom=3" json:"ledger"`
-	Token    TokenID        `pack:"T,bloom=3" json:"token"`
-	Type     TokenEventType `pack:"y"         json:"type"`
-	Signer   AccountID      `pack:"Z"         json:"signer"`
-	Sender   AccountID      `pack:"S"         json:"sender"`
-	Receiver AccountID      `pack:"R"         json:"receiver"`
-	Amount   mavryk.Z       `pack:"A,snappy"  json:"amount"`
-	Height   int64          `pack:"h"         json:"height"`
-	Time     time.Time      `pack:"t"         json:"time"`
-	OpId     OpID           `pack:"d"         json:"op_id"`
+	Id       TokenEventID    `pack:"I,pk"      json:"row_id"`
+	Ledger   AccountID       `pack:"l,bloom=3" json:"ledger"`
+	Token    TokenID         `pack:"T,bloom=3" json:"token"`
+	Type     TokenEventType  `pack:"y"         json:"type"`
+	Signer   AccountID       `pack:"Z"         json:"signer"`
+	Sender   AccountID       `pack:"S"         json:"sender"`
+	Receiver AccountID       `pack:"R"         json:"receiver"`
+	Amount   mavryk.Z        `pack:"A,snappy"  json:"amount"`
+	Amount64 int64           `pack:"a"         json:"amount64"` // range query companion of Amount
+	Height   int64           `pack:"h"         json:"height"`
+	Time     time.Time       `pack:"t"         json:"time"`
+	OpId     OpID            `pack:"d"         json:"op_id"`
+	Excluded bool            `pack:"s,snappy"  json:"is_excluded"` // self-transfer excluded from counts
+	Origin   TokenMintOrigin `pack:"m,u8"      json:"mint_origin"`
 
 	TokenRef *Token `pack:"-" json:"-"`
 }
@@ -103,6 +170,72 @@ func (m *TokenEvent) SetID(id uint64) {
 	m.Id = TokenEventID(id)
 }
 
+// IsSelfTransfer returns true for transfers where sender and receiver are
+// the same account. Such transfers do not change balances.
+func (m TokenEvent) IsSelfTransfer() bool {
+	return m.Type == TokenEventTypeTransfer && m.Sender == m.Receiver
+}
+
+// ApplyBalance replays the balance change of the event onto bal. Used to
+// reconstruct historic token balances from events in chain order.
+func (m TokenEvent) ApplyBalance(bal map[AccountID]mavryk.Z) {
+	switch m.Type {
+	case TokenEventTypeMint:
+		bal[m.Receiver] = bal[m.Receiver].Add(m.Amount)
+	case TokenEventTypeBurn:
+		bal[m.Sender] = bal[m.Sender].Sub(m.Amount)
+	case TokenEventTypeTransfer:
+		if m.IsSelfTransfer() {
+			return
+		}
+		bal[m.Sender] = bal[m.Sender].Sub(m.Amount)
+		bal[m.Receiver] = bal[m.Receiver].Add(m.Amount)
+	}
+}
+
+// TokenAmount64 returns the int64 companion of a token amount. Amounts
+// that exceed int64 saturate at math.MaxInt64 (token amounts are never
+// negative). Saturated companions only bound the real amount from below,
+// so range queries on amount64 must check candidates at math.MaxInt64
+// against the exact amount.
+func TokenAmount64(z mavryk.Z) int64 {
+	if b := z.Big(); !b.IsInt64() {
+		if b.Sign() < 0 {
+			return math.MinInt64
+		}
+		return math.MaxInt64
+	}
+	return z.Int64()
+}
+
+// TokenAmountRange is an inclusive token amount range. Nil bounds are open.
+type TokenAmountRange struct {
+	Min *mavryk.Z
+	Max *mavryk.Z
+}
+
+func (r TokenAmountRange) IsValid() bool {
+	return r.Min != nil || r.Max != nil
+}
+
+// Query adds amount64 conditions matching a superset of the range to q.
+// Use Match to check each result exactly.
+func (r TokenAmountRange) Query(q pack.Query) pack.Query {
+	if r.Min != nil {
+		q = q.AndGte("amount64", TokenAmount64(*r.Min))
+	}
+	if r.Max != nil {
+		q = q.AndLte("amount64", TokenAmount64(*r.Max))
+	}
+	return q
+}
+
+// Match returns true when the exact event amount is inside the range.
+func (r TokenAmountRange) Match(m *TokenEvent) bool {
+	return (r.Min == nil || m.Amount.Cmp(*r.Min) >= 0) &&
+		(r.Max == nil || m.Amount.Cmp(*r.Max) <= 0)
+}
+
 func NewTokenEvent() *TokenEvent {
 	return tokenEventPool.Get().(*TokenEvent)
 }
@@ -0,0 +1,130 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	_ "blockwatch.cc/packdb/store/bolt"
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+func TestTokenEventApplyBalance(t *testing.T) {
+	bal := make(map[AccountID]mavryk.Z)
+	for _, ev := range []TokenEvent{
+		{Type: TokenEventTypeMint, Sender: 1, Receiver: 2, Amount: mavryk.NewZ(100)},
+		{Type: TokenEventTypeTransfer, Sender: 2, Receiver: 3, Amount: mavryk.NewZ(30)},
+		{Type: TokenEventTypeTransfer, Sender: 3, Receiver: 3, Amount: mavryk.NewZ(30)},
+		{Type: TokenEventTypeBurn, Sender: 2, Amount: mavryk.NewZ(20)},
+	} {
+		ev.ApplyBalance(bal)
+	}
+	for id, want := range map[AccountID]int64{1: 0, 2: 50, 3: 30} {
+		if got := bal[id].Int64(); got != want {
+			t.Errorf("account %d: balance %d, want %d", id, got, want)
+		}
+	}
+}
+
+func TestTokenAmountThreshold(t *testing.T) {
+	huge := mavryk.MustParseZ("100000000000000000000") // > MaxInt64
+	huger := huge.Add64(1)
+	if v := TokenAmount64(huge); v != math.MaxInt64 {
+		t.Fatalf("amount64 of %s: got %d, want saturation", huge, v)
+	}
+
+	db, err := pack.CreateDatabase(t.TempDir(), "test", "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fields, err := pack.Fields(TokenEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := db.CreateTable(TokenEventTableKey, fields, TokenEvent{}.TableOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Close()
+
+	ctx := context.Background()
+	events := make([]*TokenEvent, 0)
+	for _, z := range []mavryk.Z{mavryk.NewZ(5), mavryk.NewZ(500), mavryk.NewZ(math.MaxInt64), huge, huger} {
+		events = append(events, &TokenEvent{Type: TokenEventTypeTransfer, Amount: z, Amount64: TokenAmount64(z)})
+	}
+	if err := StoreTokenEvents(ctx, table, events); err != nil {
+		t.Fatal(err)
+	}
+
+	ptr := func(z mavryk.Z) *mavryk.Z { return &z }
+	for _, c := range []struct {
+		name string
+		r    TokenAmountRange
+		want []string
+	}{
+		{"gte small", TokenAmountRange{Min: ptr(mavryk.NewZ(500))}, []string{"500", "9223372036854775807", huge.String(), huger.String()}},
+		{"lte small", TokenAmountRange{Max: ptr(mavryk.NewZ(500))}, []string{"5", "500"}},
+		{"gte huge", TokenAmountRange{Min: ptr(huger)}, []string{huger.String()}},
+		{"lte huge", TokenAmountRange{Max: ptr(huge)}, []string{"5", "500", "9223372036854775807", huge.String()}},
+		{"eq max int64", TokenAmountRange{Min: ptr(mavryk.NewZ(math.MaxInt64)), Max: ptr(mavryk.NewZ(math.MaxInt64))}, []string{"9223372036854775807"}},
+	} {
+		got := make([]string, 0)
+		ev := &TokenEvent{}
+		err := c.r.Query(pack.NewQuery("test").WithTable(table)).Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(ev); err != nil {
+				return err
+			}
+			if c.r.Match(ev) {
+				got = append(got, ev.Amount.String())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestTokenMintOrigin(t *testing.T) {
+	admin := mavryk.NewAddress(mavryk.AddressTypeEd25519, make([]byte, 20))
+	user := mavryk.NewAddress(mavryk.AddressTypeEd25519, append(make([]byte, 19), 1))
+	for _, c := range []struct {
+		signer mavryk.Address
+		admins []mavryk.Address
+		want   TokenMintOrigin
+	}{
+		{admin, nil, TokenMintOriginUnknown},
+		{admin, []mavryk.Address{admin}, TokenMintOriginAdmin},
+		{user, []mavryk.Address{admin}, TokenMintOriginContract},
+	} {
+		if got := NewTokenMintOrigin(c.signer, c.admins); got != c.want {
+			t.Errorf("%s: want origin %s, got %s", c.signer, c.want, got)
+		}
+	}
+	for _, o := range []TokenMintOrigin{TokenMintOriginUnknown, TokenMintOriginAdmin, TokenMintOriginContract} {
+		var v TokenMintOrigin
+		buf, _ := o.MarshalText()
+		if err := v.UnmarshalText(buf); err != nil || v != o {
+			t.Errorf("%s: text round trip failed: %v", o, err)
+		}
+	}
+	var v TokenMintOrigin
+	if err := v.UnmarshalText([]byte("none")); err == nil {
+		t.Errorf("expected error on invalid origin")
+	}
+}
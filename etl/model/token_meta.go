@@ -5,13 +5,21 @@ package model
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/tidwall/gjson"
 )
 
 const (
 	TokenMetaTableKey = "token_metadata"
+
+	// upper bound for decimals taken from untrusted token metadata
+	MaxTokenDecimals = 36
 )
 
 var (
@@ -24,11 +32,41 @@ var (
 
 type TokenMetaID uint64
 
-// TokenMeta tracks token metadata from off-chain resolution
+type TokenMetaStatus byte
+
+const (
+	TokenMetaStatusNone TokenMetaStatus = iota
+	TokenMetaStatusSuccess
+	TokenMetaStatusFailed
+	TokenMetaStatusTimeout
+	TokenMetaStatusInvalid // fetched, but not valid JSON
+)
+
+var tokenMetaStatusStrings = map[TokenMetaStatus]string{
+	TokenMetaStatusSuccess: "success",
+	TokenMetaStatusFailed:  "failed",
+	TokenMetaStatusTimeout: "timeout",
+	TokenMetaStatusInvalid: "invalid",
+}
+
+func (s TokenMetaStatus) String() string {
+	return tokenMetaStatusStrings[s]
+}
+
+func (s TokenMetaStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// TokenMeta tracks token metadata from off-chain resolution. Data holds the
+// last successfully resolved JSON document, Status and Updated describe the
+// most recent fetch attempt.
 type TokenMeta struct {
-	Id    TokenMetaID `pack:"I,pk"      json:"row_id"`
-	Token TokenID     `pack:"T,snappy"  json:"token"`
-	Data  []byte      `pack:"D,snappy"  json:"data"`
+	Id      TokenMetaID     `pack:"I,pk"      json:"row_id"`
+	Token   TokenID         `pack:"T,snappy"  json:"token"`
+	Data    []byte          `pack:"D,snappy"  json:"data"`
+	Url     string          `pack:"u,snappy"  json:"url"`
+	Status  TokenMetaStatus `pack:"s,u8"      json:"status"`
+	Updated time.Time       `pack:"t"         json:"updated"`
 }
 
 // Ensure TokenMeta items implement the pack.Item interface.
@@ -71,3 +109,46 @@ func (m TokenMeta) TableOpts() pack.Options {
 func (m TokenMeta) IndexOpts(key string) pack.Options {
 	return pack.NoOptions
 }
+
+// TokenInfoURI returns the off-chain metadata URI from a TZIP-12
+// token_metadata bigmap value Pair(token_id, token_info) where the URI is
+// stored under the empty key of token_info. Only URIs that can be resolved
+// over the network (ipfs, http and https) are returned.
+func TokenInfoURI(val micheline.Prim) string {
+	if val.OpCode != micheline.D_PAIR || len(val.Args) < 2 {
+		return ""
+	}
+	for _, elt := range val.Args[1].Args {
+		if elt.OpCode != micheline.D_ELT || len(elt.Args) < 2 {
+			continue
+		}
+		if elt.Args[0].Type != micheline.PrimString || elt.Args[0].String != "" {
+			continue
+		}
+		uri := string(elt.Args[1].Bytes)
+		for _, scheme := range []string{"ipfs://", "https://", "http://"} {
+			if strings.HasPrefix(uri, scheme) {
+				return uri
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// ParseTokenDecimals reads decimals from TZIP-21 token metadata. TZIP-12
+// defines decimals as string, but numbers are common as well.
+func ParseTokenDecimals(buf []byte) (int, bool) {
+	if len(buf) == 0 {
+		return 0, false
+	}
+	res := gjson.GetBytes(buf, "decimals")
+	if !res.Exists() {
+		return 0, false
+	}
+	d, err := strconv.Atoi(strings.Trim(res.Raw, `"`))
+	if err != nil || d < 0 || d > MaxTokenDecimals {
+		return 0, false
+	}
+	return d, true
+}
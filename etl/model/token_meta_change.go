@@ -0,0 +1,73 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+const (
+	TokenMetaChangeTableKey = "token_metadata_changes"
+)
+
+type TokenMetaChangeID uint64
+
+// TokenMetaChange records a write to the token_metadata bigmap entry of a
+// token, e.g. the reveal of NFT art. Only hashes of the old and new value are
+// stored, full values are read from bigmap updates on demand. A zero hash
+// means the entry did not exist before (OldHash) or was removed (NewHash).
+type TokenMetaChange struct {
+	Id       TokenMetaChangeID `pack:"I,pk"      json:"row_id"`
+	Token    TokenID           `pack:"T,bloom=3" json:"token"`
+	BigmapId int64             `pack:"B,i32"     json:"bigmap_id"`
+	OldHash  mavryk.ExprHash   `pack:"o"         json:"old_hash"`
+	NewHash  mavryk.ExprHash   `pack:"n"         json:"new_hash"`
+	Height   int64             `pack:"h,i32"     json:"height"`
+	Time     time.Time         `pack:"t"         json:"time"`
+	OpId     OpID              `pack:"d"         json:"op_id"`
+}
+
+// Ensure TokenMetaChange items implement the pack.Item interface.
+var _ pack.Item = (*TokenMetaChange)(nil)
+
+func (m *TokenMetaChange) ID() uint64 {
+	return uint64(m.Id)
+}
+
+func (m *TokenMetaChange) SetID(id uint64) {
+	m.Id = TokenMetaChangeID(id)
+}
+
+func (m TokenMetaChange) TableKey() string {
+	return TokenMetaChangeTableKey
+}
+
+func (m TokenMetaChange) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    12,  // 4k pack size
+		JournalSizeLog2: 12,  // 4k journal size
+		CacheSize:       4,   // max MB
+		FillLevel:       100, // boltdb fill level to limit reallocations
+	}
+}
+
+func (m TokenMetaChange) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// IsRemove returns true when the metadata entry was removed.
+func (m TokenMetaChange) IsRemove() bool {
+	return !m.NewHash.IsValid()
+}
+
+// TokenInfoHash returns the expression hash of a token_metadata bigmap value,
+// i.e. the hash of its packed binary encoding.
+func TokenInfoHash(val micheline.Prim) mavryk.ExprHash {
+	buf, _ := val.MarshalBinary()
+	return micheline.KeyHash(buf)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+func TestTokenInfoURI(t *testing.T) {
+	info := func(key, val string) micheline.Prim {
+		return micheline.NewPair(
+			micheline.NewInt64(1),
+			micheline.NewSeq(
+				micheline.NewCode(micheline.D_ELT, micheline.NewString("decimals"), micheline.NewBytes([]byte("6"))),
+				micheline.NewCode(micheline.D_ELT, micheline.NewString(key), micheline.NewBytes([]byte(val))),
+			),
+		)
+	}
+	for _, c := range []struct {
+		val  micheline.Prim
+		want string
+	}{
+		{info("", "ipfs://QmTest"), "ipfs://QmTest"},
+		{info("", "https://example.com/1.json"), "https://example.com/1.json"},
+		{info("", "mavryk-storage:meta"), ""},
+		{info("name", "ipfs://QmTest"), ""},
+		{micheline.NewInt64(1), ""},
+	} {
+		if got := TokenInfoURI(c.val); got != c.want {
+			t.Errorf("got %q, want %q", got, c.want)
+		}
+	}
+}
+
+func TestParseTokenDecimals(t *testing.T) {
+	for _, c := range []struct {
+		meta string
+		want int
+		ok   bool
+	}{
+		{`{"decimals":"6"}`, 6, true},
+		{`{"decimals":18}`, 18, true},
+		{`{"decimals":"0"}`, 0, true},
+		{`{"name":"x"}`, 0, false},
+		{`{"decimals":"six"}`, 0, false},
+		{`{"decimals":-1}`, 0, false},
+		{`{"decimals":1000}`, 0, false},
+		{``, 0, false},
+	} {
+		d, ok := ParseTokenDecimals([]byte(c.meta))
+		if ok != c.ok || d != c.want {
+			t.Errorf("%s: got (%d, %t), want (%d, %t)", c.meta, d, ok, c.want, c.ok)
+		}
+	}
+}
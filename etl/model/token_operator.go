@@ -0,0 +1,172 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+const (
+	TokenOperatorTableKey = "token_operators"
+)
+
+type TokenOperatorID uint64
+
+// TokenOperator records a single FA2 operator permission update. Rows are
+// append-only, the current permission of an (owner, operator, token) triple
+// is the most recent row. All-token operators (FA2 extensions) are stored
+// with IsAll set and a zero token id; they are independent from per-token
+// permissions of the same owner and operator.
+type TokenOperator struct {
+	Id        TokenOperatorID `pack:"I,pk"      json:"row_id"`
+	Ledger    AccountID       `pack:"l,bloom=3" json:"ledger"`
+	Owner     AccountID       `pack:"o,bloom=3" json:"owner"`
+	Operator  AccountID       `pack:"p,bloom=3" json:"operator"`
+	TokenId   mavryk.Z        `pack:"i,snappy"  json:"token_id"`
+	IsAll     bool            `pack:"a,snappy"  json:"is_all"`     // operator for all tokens of owner
+	IsGranted bool            `pack:"g,snappy"  json:"is_granted"` // add (true) or remove (false)
+	Height    int64           `pack:"h,i32"     json:"height"`
+	Time      time.Time       `pack:"t"         json:"time"`
+	OpId      OpID            `pack:"d"         json:"op_id"`
+}
+
+// Ensure TokenOperator items implement the pack.Item interface.
+var _ pack.Item = (*TokenOperator)(nil)
+
+func (m *TokenOperator) ID() uint64 {
+	return uint64(m.Id)
+}
+
+func (m *TokenOperator) SetID(id uint64) {
+	m.Id = TokenOperatorID(id)
+}
+
+func (m TokenOperator) TableKey() string {
+	return TokenOperatorTableKey
+}
+
+func (m TokenOperator) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    13,  // 8k pack size
+		JournalSizeLog2: 14,  // 16k journal size
+		CacheSize:       16,  // max MB
+		FillLevel:       100, // boltdb fill level to limit reallocations
+	}
+}
+
+func (m TokenOperator) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// Key identifies the permission a row updates.
+func (m TokenOperator) Key() string {
+	if m.IsAll {
+		return fmt.Sprintf("%d_%d_*", m.Owner, m.Operator)
+	}
+	return fmt.Sprintf("%d_%d_%s", m.Owner, m.Operator, m.TokenId)
+}
+
+// CurrentTokenOperators reduces a row id ordered list of operator updates
+// to the permissions that are still granted. Later updates supersede earlier
+// updates of the same permission.
+func CurrentTokenOperators(list []*TokenOperator) []*TokenOperator {
+	last := make(map[string]int, len(list))
+	for i, v := range list {
+		last[v.Key()] = i
+	}
+	res := make([]*TokenOperator, 0, len(last))
+	for i, v := range list {
+		if v.IsGranted && last[v.Key()] == i {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// TokenOperatorUpdate is a decoded FA2 operator permission change.
+type TokenOperatorUpdate struct {
+	Owner     mavryk.Address
+	Operator  mavryk.Address
+	TokenId   mavryk.Z
+	IsAll     bool
+	IsGranted bool
+}
+
+// DecodeOperatorUpdates decodes FA2 operator updates from call parameters.
+// Standard `update_operators` calls carry owner, operator and token id for
+// each permission. All-token extensions (`update_operators_for_all`,
+// `update_all_tokens_operators`) only carry the operator, the owner is the
+// direct caller. Other entrypoints return no updates.
+func DecodeOperatorUpdates(params micheline.Parameters, caller mavryk.Address) ([]TokenOperatorUpdate, error) {
+	switch params.Entrypoint {
+	case "update_operators":
+		return decodeTokenOperators(params.Value)
+	case "update_operators_for_all", "update_all_tokens_operators":
+		return decodeAllTokenOperators(params.Value, caller)
+	default:
+		return nil, nil
+	}
+}
+
+func decodeTokenOperators(prim micheline.Prim) ([]TokenOperatorUpdate, error) {
+	res := make([]TokenOperatorUpdate, 0, len(prim.Args))
+	for _, item := range prim.Args {
+		var (
+			upd struct {
+				Owner    mavryk.Address `prim:"owner,path=0/0"`
+				Operator mavryk.Address `prim:"operator,path=0/1/0"`
+				TokenId  mavryk.Z       `prim:"token_id,path=0/1/1"`
+			}
+			err error
+		)
+		switch {
+		case PrimMatches(item, [][]int{{0, 0}, {0, 1, 0}, {0, 1, 1}}):
+			err = item.Decode(&upd)
+		case PrimMatches(item, [][]int{{0, 0}, {0, 1}, {0, 2}}):
+			var flat struct {
+				Owner    mavryk.Address `prim:"owner,path=0/0"`
+				Operator mavryk.Address `prim:"operator,path=0/1"`
+				TokenId  mavryk.Z       `prim:"token_id,path=0/2"`
+			}
+			err = item.Decode(&flat)
+			upd.Owner, upd.Operator, upd.TokenId = flat.Owner, flat.Operator, flat.TokenId
+		default:
+			err = fmt.Errorf("unsupported fa2 operator update %s", item.Dump())
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, TokenOperatorUpdate{
+			Owner:     upd.Owner,
+			Operator:  upd.Operator,
+			TokenId:   upd.TokenId,
+			IsGranted: item.OpCode == micheline.D_LEFT,
+		})
+	}
+	return res, nil
+}
+
+func decodeAllTokenOperators(prim micheline.Prim, caller mavryk.Address) ([]TokenOperatorUpdate, error) {
+	res := make([]TokenOperatorUpdate, 0, len(prim.Args))
+	for _, item := range prim.Args {
+		var upd struct {
+			Operator mavryk.Address `prim:"operator,path=0"`
+		}
+		if err := item.Decode(&upd); err != nil {
+			return nil, err
+		}
+		res = append(res, TokenOperatorUpdate{
+			Owner:     caller,
+			Operator:  upd.Operator,
+			IsAll:     true,
+			IsGranted: item.OpCode == micheline.D_LEFT,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"slices"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+const (
+	TokenPauseTableKey = "token_pauses"
+)
+
+type TokenPauseID uint64
+
+// TokenPause records a single pause or unpause call on a token ledger. Rows
+// are append-only, the current state of a token is the most recent row that
+// applies to the token, either a ledger-wide row (IsAll) or a row for its
+// token id. Tokens without any row are unpaused.
+type TokenPause struct {
+	Id       TokenPauseID `pack:"I,pk"      json:"row_id"`
+	Ledger   AccountID    `pack:"l,bloom=3" json:"ledger"`
+	TokenId  mavryk.Z     `pack:"i,snappy"  json:"token_id"`
+	IsAll    bool         `pack:"a,snappy"  json:"is_all"`    // applies to all tokens of ledger
+	IsPaused bool         `pack:"p,snappy"  json:"is_paused"` // pause (true) or unpause (false)
+	Height   int64        `pack:"h,i32"     json:"height"`
+	Time     time.Time    `pack:"t"         json:"time"`
+	OpId     OpID         `pack:"d"         json:"op_id"`
+}
+
+// Ensure TokenPause items implement the pack.Item interface.
+var _ pack.Item = (*TokenPause)(nil)
+
+func (m *TokenPause) ID() uint64 {
+	return uint64(m.Id)
+}
+
+func (m *TokenPause) SetID(id uint64) {
+	m.Id = TokenPauseID(id)
+}
+
+func (m TokenPause) TableKey() string {
+	return TokenPauseTableKey
+}
+
+func (m TokenPause) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    12,  // 4k pack size
+		JournalSizeLog2: 12,  // 4k journal size
+		CacheSize:       4,   // max MB
+		FillLevel:       100, // boltdb fill level to limit reallocations
+	}
+}
+
+func (m TokenPause) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// Applies returns true when the row changes the state of token id.
+func (m TokenPause) Applies(id mavryk.Z) bool {
+	return m.IsAll || m.TokenId.Equal(id)
+}
+
+// IsTokenPaused returns the pause state of token id from a row id ordered
+// list of ledger pause updates.
+func IsTokenPaused(list []*TokenPause, id mavryk.Z) bool {
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Applies(id) {
+			return list[i].IsPaused
+		}
+	}
+	return false
+}
+
+// TokenPauseUpdate is a decoded pause state change.
+type TokenPauseUpdate struct {
+	TokenId  mavryk.Z
+	IsAll    bool
+	IsPaused bool
+}
+
+// DecodePauseUpdates decodes pause state changes from call parameters of
+// configured pause and unpause entrypoints. Supported argument patterns are
+// unit (pause or unpause as named by the entrypoint), a bool for the new
+// ledger-wide state and a list of (token_id, bool) pairs in either order.
+// Other entrypoints and unknown argument patterns return no updates.
+func DecodePauseUpdates(params micheline.Parameters, pause, unpause []string) []TokenPauseUpdate {
+	var isPause bool
+	switch {
+	case slices.Contains(pause, params.Entrypoint):
+		isPause = true
+	case slices.Contains(unpause, params.Entrypoint):
+	default:
+		return nil
+	}
+	prim := params.Value
+	switch {
+	case prim.OpCode == micheline.D_UNIT:
+		return []TokenPauseUpdate{{IsAll: true, IsPaused: isPause}}
+	case prim.OpCode == micheline.D_TRUE || prim.OpCode == micheline.D_FALSE:
+		return []TokenPauseUpdate{{IsAll: true, IsPaused: prim.OpCode == micheline.D_TRUE}}
+	case prim.IsSequence():
+		res := make([]TokenPauseUpdate, 0, len(prim.Args))
+		for _, item := range prim.Args {
+			if item.OpCode != micheline.D_PAIR || len(item.Args) != 2 {
+				return nil
+			}
+			id, flag := item.Args[0], item.Args[1]
+			if id.Type != micheline.PrimInt {
+				id, flag = flag, id
+			}
+			if id.Type != micheline.PrimInt || (flag.OpCode != micheline.D_TRUE && flag.OpCode != micheline.D_FALSE) {
+				return nil
+			}
+			res = append(res, TokenPauseUpdate{
+				TokenId:  mavryk.NewBigZ(id.Int),
+				IsPaused: flag.OpCode == micheline.D_TRUE,
+			})
+		}
+		return res
+	default:
+		return nil
+	}
+}
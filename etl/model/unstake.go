@@ -0,0 +1,122 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+// UnstakeRequest is a pending request to return unstaked funds to an account's
+// spendable balance. Requests are not stored in a table, they are replayed
+// from staking flows which are rolled back on reorg together with their block.
+type UnstakeRequest struct {
+	AccountId        AccountID
+	Height           int64 // block where the request was made
+	OpN              int   // operation position in block
+	Cycle            int64 // request cycle
+	FinalizableCycle int64 // first cycle when funds can be finalized
+	Amount           int64 // requested amount
+	Remaining        int64 // amount not yet finalized or slashed
+}
+
+func (r *UnstakeRequest) IsFinalizable(cycle int64) bool {
+	return r.FinalizableCycle <= cycle
+}
+
+// BuildUnstakeQueue replays unstake, finalize and slash flows of a single
+// account in chain order and returns the list of pending unstake requests,
+// oldest first. Finalization consumes the oldest requests first, so partially
+// finalized requests remain in the queue with a reduced remaining amount.
+// Slashing of unstaked funds is distributed proportionally across requests
+// which are still frozen.
+func BuildUnstakeQueue(flows []*Flow, p *rpc.Params) []*UnstakeRequest {
+	delay := p.PreservedCycles + p.MaxSlashingPeriod
+	queue := make([]*UnstakeRequest, 0)
+	for _, f := range flows {
+		if f.Kind != FlowKindStake {
+			continue
+		}
+		switch f.Type {
+		case FlowTypeUnstake:
+			// only the out flow from staked deposits is accounted,
+			// same as for the account unstaked balance
+			if f.AmountOut <= 0 {
+				continue
+			}
+			if n := len(queue); n > 0 && queue[n-1].Height == f.Height && queue[n-1].OpN == f.OpN {
+				queue[n-1].Amount += f.AmountOut
+				queue[n-1].Remaining += f.AmountOut
+				continue
+			}
+			queue = append(queue, &UnstakeRequest{
+				AccountId:        f.AccountId,
+				Height:           f.Height,
+				OpN:              f.OpN,
+				Cycle:            f.Cycle,
+				FinalizableCycle: f.Cycle + delay,
+				Amount:           f.AmountOut,
+				Remaining:        f.AmountOut,
+			})
+
+		case FlowTypeFinalizeUnstake:
+			amount := f.AmountOut
+			for _, r := range queue {
+				if amount <= 0 {
+					break
+				}
+				n := min(amount, r.Remaining)
+				r.Remaining -= n
+				amount -= n
+			}
+
+		case FlowTypePenalty:
+			// unfrozen flag signals a slash of unstaked funds
+			if !f.IsUnfrozen || f.AmountOut <= 0 {
+				continue
+			}
+			var frozen int64
+			for _, r := range queue {
+				if !r.IsFinalizable(f.Cycle) {
+					frozen += r.Remaining
+				}
+			}
+			if frozen == 0 {
+				continue
+			}
+			amount := min(f.AmountOut, frozen)
+			var last *UnstakeRequest
+			for _, r := range queue {
+				if r.IsFinalizable(f.Cycle) || r.Remaining == 0 {
+					continue
+				}
+				// share of the remaining slash amount, the last request
+				// takes all that is left
+				rem := r.Remaining
+				n := min(int64(float64(amount)*float64(rem)/float64(frozen)), rem)
+				r.Remaining -= n
+				amount -= n
+				frozen -= rem
+				last = r
+			}
+			// assign float rounding leftovers to the most recent request
+			if last != nil && amount > 0 {
+				last.Remaining -= min(amount, last.Remaining)
+			}
+		}
+
+		// drop fully consumed requests
+		for len(queue) > 0 && queue[0].Remaining == 0 {
+			queue = queue[1:]
+		}
+	}
+
+	// slashing may leave empty requests inside the queue
+	res := queue[:0]
+	for _, r := range queue {
+		if r.Remaining > 0 {
+			res = append(res, r)
+		}
+	}
+	return res
+}
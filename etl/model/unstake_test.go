@@ -0,0 +1,40 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+func TestBuildUnstakeQueue(t *testing.T) {
+	p := &rpc.Params{PreservedCycles: 2, MaxSlashingPeriod: 2}
+	unstake := func(h, c int64, n int, amount int64) *Flow {
+		return &Flow{Height: h, Cycle: c, OpN: n, Kind: FlowKindStake, Type: FlowTypeUnstake, AmountOut: amount}
+	}
+	flows := []*Flow{
+		unstake(10, 1, 0, 100),
+		// explicit unstake in-flow to the unstaked pool is ignored
+		{Height: 10, Cycle: 1, OpN: 0, Kind: FlowKindStake, Type: FlowTypeUnstake, AmountIn: 100},
+		unstake(20, 2, 3, 50),
+		unstake(30, 3, 1, 40),
+		// partial finalization spanning the first two requests
+		{Height: 60, Cycle: 6, Kind: FlowKindStake, Type: FlowTypeFinalizeUnstake, AmountOut: 120},
+		// slash of unstaked funds only hits frozen requests
+		{Height: 65, Cycle: 6, Kind: FlowKindStake, Type: FlowTypePenalty, AmountOut: 10, IsUnfrozen: true},
+		// staked slashes are ignored
+		{Height: 66, Cycle: 6, Kind: FlowKindStake, Type: FlowTypePenalty, AmountOut: 99},
+	}
+	q := BuildUnstakeQueue(flows, p)
+	if len(q) != 2 {
+		t.Fatalf("got %d requests, want 2", len(q))
+	}
+	if r := q[0]; r.Height != 20 || r.Amount != 50 || r.Remaining != 30 || r.FinalizableCycle != 6 {
+		t.Errorf("partial request mismatch: %+v", r)
+	}
+	if r := q[1]; r.Height != 30 || r.Amount != 40 || r.Remaining != 30 || r.FinalizableCycle != 7 {
+		t.Errorf("slashed request mismatch: %+v", r)
+	}
+}
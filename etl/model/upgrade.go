@@ -0,0 +1,143 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+const ContractUpgradeTableKey = "contract_upgrades"
+
+type ContractUpgradeID uint64
+
+// ContractUpgrade records a change of the implementation address of a proxy
+// contract. The implementation active at height H is the one from the most
+// recent row at or below H.
+type ContractUpgrade struct {
+	Id             ContractUpgradeID `pack:"I,pk"      json:"row_id"`
+	Contract       AccountID         `pack:"c,bloom=3" json:"contract"`
+	Implementation mavryk.Address    `pack:"a,bloom=3" json:"implementation"`
+	Previous       mavryk.Address    `pack:"p"         json:"previous"`
+	Height         int64             `pack:"h,i32"     json:"height"`
+	Time           time.Time         `pack:"t"         json:"time"`
+	OpId           OpID              `pack:"d"         json:"op_id"`
+}
+
+// Ensure ContractUpgrade items implement the pack.Item interface.
+var _ pack.Item = (*ContractUpgrade)(nil)
+
+func (m *ContractUpgrade) ID() uint64 {
+	return uint64(m.Id)
+}
+
+func (m *ContractUpgrade) SetID(id uint64) {
+	m.Id = ContractUpgradeID(id)
+}
+
+func (m ContractUpgrade) TableKey() string {
+	return ContractUpgradeTableKey
+}
+
+func (m ContractUpgrade) TableOpts() pack.Options {
+	return pack.Options{
+		PackSizeLog2:    12,  // 4k pack size
+		JournalSizeLog2: 12,  // 4k journal size
+		CacheSize:       4,   // max MB
+		FillLevel:       100, // boltdb fill level to limit reallocations
+	}
+}
+
+func (m ContractUpgrade) IndexOpts(key string) pack.Options {
+	return pack.NoOptions
+}
+
+// UpgradePattern configures detection of implementation changes for proxy
+// contracts. Path points to the storage field holding the implementation
+// address. When Key is set, Path must point to a bigmap and the
+// implementation is read from the value stored under Key (string or int).
+type UpgradePattern struct {
+	ContractPattern
+	Path string `json:"path"`
+	Key  string `json:"key"`
+}
+
+// Implementation extracts the implementation address from an updated storage
+// or, for bigmap based proxies, from bigmap updates. Returns false when the
+// operation did not touch the implementation.
+func (p UpgradePattern) Implementation(styp micheline.Type, storage []byte, events micheline.BigmapEvents) (mavryk.Address, bool) {
+	if len(storage) == 0 {
+		return mavryk.InvalidAddress, false
+	}
+	var prim micheline.Prim
+	if err := prim.UnmarshalBinary(storage); err != nil {
+		return mavryk.InvalidAddress, false
+	}
+	val := micheline.NewValue(styp, prim)
+	if p.Key == "" {
+		v, ok := val.GetValue(p.Path)
+		if !ok {
+			return mavryk.InvalidAddress, false
+		}
+		if addrs := collectAddresses(v, nil); len(addrs) > 0 {
+			return addrs[0], true
+		}
+		return mavryk.InvalidAddress, false
+	}
+
+	id, ok := val.GetInt64(p.Path)
+	if !ok {
+		return mavryk.InvalidAddress, false
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		ev := events[i]
+		if ev.Id != id || !p.matchKey(ev.Key) {
+			continue
+		}
+		if ev.Action != micheline.DiffActionUpdate {
+			// removed implementation
+			return mavryk.InvalidAddress, ev.Action == micheline.DiffActionRemove
+		}
+		return findAddress(ev.Value)
+	}
+	return mavryk.InvalidAddress, false
+}
+
+func (p UpgradePattern) matchKey(key micheline.Prim) bool {
+	switch key.Type {
+	case micheline.PrimString:
+		return key.String == p.Key
+	case micheline.PrimInt:
+		return key.Int != nil && key.Int.String() == p.Key
+	case micheline.PrimBytes:
+		if a := (mavryk.Address{}); a.Decode(key.Bytes) == nil {
+			return a.String() == p.Key
+		}
+	}
+	return false
+}
+
+// findAddress returns the first address embedded in a Micheline value.
+func findAddress(p micheline.Prim) (addr mavryk.Address, ok bool) {
+	_ = p.Walk(func(p micheline.Prim) error {
+		if ok {
+			return micheline.PrimSkip
+		}
+		switch {
+		case p.Type == micheline.PrimString:
+			if a, err := mavryk.ParseAddress(p.String); err == nil {
+				addr, ok = a, true
+			}
+		case p.Type == micheline.PrimBytes && mavryk.IsAddressBytes(p.Bytes):
+			if a := (mavryk.Address{}); a.Decode(p.Bytes) == nil {
+				addr, ok = a, true
+			}
+		}
+		return nil
+	})
+	return
+}
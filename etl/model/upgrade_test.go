@@ -0,0 +1,56 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package model
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+func TestUpgradePatternImplementation(t *testing.T) {
+	impl := testAddress(mavryk.AddressTypeContract, 1)
+	next := testAddress(mavryk.AddressTypeContract, 2)
+
+	// storage field
+	typ := micheline.NewType(micheline.NewPairType(
+		micheline.NewPrim(micheline.T_ADDRESS, "%admin"),
+		micheline.NewPrim(micheline.T_ADDRESS, "%implementation"),
+	))
+	buf, _ := micheline.NewPair(
+		micheline.NewAddress(testAddress(mavryk.AddressTypeEd25519, 1)),
+		micheline.NewAddress(impl),
+	).MarshalBinary()
+	p := UpgradePattern{Path: "implementation"}
+	if a, ok := p.Implementation(typ, buf, nil); !ok || !a.Equal(impl) {
+		t.Errorf("storage: got %s %t, want %s", a, ok, impl)
+	}
+
+	// bigmap entry
+	typ = micheline.NewType(micheline.NewPairType(
+		micheline.NewPrim(micheline.T_ADDRESS, "%admin"),
+		micheline.NewMapType(
+			micheline.NewPrim(micheline.T_STRING),
+			micheline.NewPrim(micheline.T_ADDRESS),
+			"%lambdas",
+		),
+	))
+	typ.Args[1].OpCode = micheline.T_BIG_MAP
+	buf, _ = micheline.NewPair(
+		micheline.NewAddress(testAddress(mavryk.AddressTypeEd25519, 1)),
+		micheline.NewInt64(42),
+	).MarshalBinary()
+	p = UpgradePattern{Path: "lambdas", Key: "impl"}
+	events := micheline.BigmapEvents{
+		{Action: micheline.DiffActionUpdate, Id: 42, Key: micheline.NewString("other"), Value: micheline.NewAddress(impl)},
+		{Action: micheline.DiffActionUpdate, Id: 42, Key: micheline.NewString("impl"), Value: micheline.NewAddress(next)},
+	}
+	if a, ok := p.Implementation(typ, buf, events); !ok || !a.Equal(next) {
+		t.Errorf("bigmap: got %s %t, want %s", a, ok, next)
+	}
+	if _, ok := p.Implementation(typ, buf, events[:1]); ok {
+		t.Errorf("bigmap: unrelated key must not match")
+	}
+}
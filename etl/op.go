@@ -11,7 +11,31 @@ import (
 	"github.com/mavryk-network/mvindex/rpc"
 )
 
+// balanceNeutralOps lists operation types that never move balances since
+// Ithaca. Skipping them keeps the supply invariant intact.
+var balanceNeutralOps = model.OpTypeList{
+	model.OpTypeEndorsement,
+	model.OpTypePreendorsement,
+	model.OpTypeProposal,
+	model.OpTypeBallot,
+}
+
+// skipsBalanceOps reports whether a skip list contains operation types that
+// may move balances (fees, transfers, rewards or slashes).
+func skipsBalanceOps(skip model.OpTypeList) bool {
+	for _, v := range skip {
+		if !balanceNeutralOps.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppendRegularBlockOps builds ops and flows for all operations in the
+// current block. Operation types in the indexer's skip list are dropped
+// without creating ops, flows or account updates.
 func (b *Builder) AppendRegularBlockOps(ctx context.Context, rollback bool) error {
+	skip := b.idx.SkipOps()
 	for op_l, ol := range b.block.MV.Block.Operations {
 		for op_p, oh := range ol {
 			for op_c, o := range oh.Contents {
@@ -26,6 +50,9 @@ func (b *Builder) AppendRegularBlockOps(ctx context.Context, rollback bool) erro
 					I:    0,
 					Raw:  o,
 				}
+				if skip.Contains(id.Kind) {
+					continue
+				}
 				switch id.Kind {
 				case model.OpTypeEndorsement, model.OpTypePreendorsement:
 					err = b.AppendEndorsementOp(ctx, oh, id, rollback)
@@ -348,6 +348,9 @@ func (b *Builder) AppendImplicitBlockOps(ctx context.Context) error {
 				}
 				o.Volume += v.Amount()
 				f := b.NewSubsidyFlow(dst, v.Amount(), id)
+				if o := model.ParseFlowOrigin(v.Origin); o.IsValid() && v.Origin != "" {
+					f.Origin = o
+				}
 				b.block.Flows = append(b.block.Flows, f)
 			}
 
@@ -336,8 +336,12 @@ func (b *Builder) AppendSmartRollupTransactionOp(ctx context.Context, oh *rpc.Op
 		micheline.NewBytes(res.SmartRollupResult.Encode()),
 	).ToBytes()
 
-	// keep ticket updates
-	op.RawTicketUpdates = res.TicketUpdates()
+	// keep ticket updates, outbox receipts are completed with the rollup debit
+	if tx, ok := o.(*rpc.SmartRollupExecuteOutboxMessage); ok {
+		op.RawTicketUpdates = tx.TicketUpdates()
+	} else {
+		op.RawTicketUpdates = res.TicketUpdates()
+	}
 
 	if op.IsSuccess {
 		flows := b.NewRollupTransactionFlows(
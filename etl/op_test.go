@@ -0,0 +1,141 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+func TestSkipOps(t *testing.T) {
+	newBlock := func() *model.Block {
+		block := &rpc.Block{}
+		block.Operations[0] = []*rpc.Operation{{
+			Contents: rpc.OperationList{&rpc.Endorsement{
+				Generic: rpc.Generic{OpKind: mavryk.OpTypeEndorsement, Metadata: &rpc.OperationMetadata{}},
+			}},
+		}}
+		block.Operations[1] = []*rpc.Operation{{
+			Contents: rpc.OperationList{&rpc.Ballot{
+				Generic: rpc.Generic{OpKind: mavryk.OpTypeBallot, Metadata: &rpc.OperationMetadata{}},
+			}},
+		}}
+		return &model.Block{Height: 100, MV: &rpc.Bundle{Block: block}}
+	}
+
+	// skipped ops don't need baker or account state
+	skip := model.OpTypeList{model.OpTypeEndorsement, model.OpTypeBallot}
+	b := NewBuilder(NewIndexer(IndexerConfig{SkipOps: skip}), nil, false)
+	b.block = newBlock()
+	if err := b.AppendRegularBlockOps(context.Background(), false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(b.block.Ops); n != 0 {
+		t.Errorf("got %d ops, want none", n)
+	}
+
+	// remaining types are processed and fail on the missing voter account
+	b = NewBuilder(NewIndexer(IndexerConfig{SkipOps: skip[:1]}), nil, false)
+	b.block = newBlock()
+	if err := b.AppendRegularBlockOps(context.Background(), false); err == nil {
+		t.Errorf("expected ballot to be processed")
+	}
+
+	// consensus and governance ops don't move balances, checks stay on
+	c := NewCrawler(CrawlerConfig{
+		Indexer:     NewIndexer(IndexerConfig{SkipOps: skip}),
+		SupplyCheck: SupplyCheckStrict,
+		Validate:    true,
+	})
+	if m := c.builder.supply.Mode(); m != SupplyCheckStrict {
+		t.Errorf("supply check %s, want strict", m)
+	}
+
+	// skipping balance moving ops disables supply checks and validation
+	c = NewCrawler(CrawlerConfig{
+		Indexer:     NewIndexer(IndexerConfig{SkipOps: model.OpTypeList{model.OpTypeTransaction}}),
+		SupplyCheck: SupplyCheckStrict,
+		Validate:    true,
+	})
+	if m := c.builder.supply.Mode(); m != SupplyCheckOff {
+		t.Errorf("supply check %s, want off", m)
+	}
+	if c.builder.validate {
+		t.Errorf("expected validation to be disabled")
+	}
+}
+
+func TestSkipOpsIndexed(t *testing.T) {
+	ctx := context.Background()
+	addr := mavryk.NewAddress(mavryk.AddressTypeEd25519, make([]byte, 20))
+
+	// a block with an endorsement, a ballot and a proposal
+	block := &rpc.Block{}
+	block.Operations[0] = []*rpc.Operation{{
+		Contents: rpc.OperationList{&rpc.Endorsement{
+			Generic: rpc.Generic{OpKind: mavryk.OpTypeEndorsement, Metadata: &rpc.OperationMetadata{}},
+		}},
+	}}
+	block.Operations[1] = []*rpc.Operation{{
+		Contents: rpc.OperationList{&rpc.Ballot{
+			Generic: rpc.Generic{OpKind: mavryk.OpTypeBallot, Metadata: &rpc.OperationMetadata{}},
+			Source:  addr,
+		}},
+	}, {
+		Contents: rpc.OperationList{&rpc.Proposals{
+			Generic: rpc.Generic{OpKind: mavryk.OpTypeProposals, Metadata: &rpc.OperationMetadata{}},
+			Source:  addr,
+		}},
+	}}
+
+	// index ballots only
+	skip := model.OpTypeList{model.OpTypeEndorsement, model.OpTypeProposal}
+	b := NewBuilder(NewIndexer(IndexerConfig{SkipOps: skip}), nil, false)
+	b.block = &model.Block{Height: 100, MV: &rpc.Bundle{Block: block}}
+	bkr := &model.Baker{
+		AccountId: 1,
+		Address:   addr,
+		Account:   &model.Account{RowId: 1, Address: addr},
+	}
+	b.bakerMap[bkr.AccountId] = bkr
+	b.bakerHashMap[b.accCache.AddressHashKey(addr)] = bkr
+	if err := b.AppendRegularBlockOps(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	idx := index.NewOpIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if err := idx.ConnectBlock(ctx, b.block, b); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := make([]*model.Op, 0)
+	for _, table := range idx.Tables() {
+		if table.Name() != model.OpTableKey {
+			continue
+		}
+		if err := pack.NewQuery("test").WithTable(table).Execute(ctx, &ops); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ops) != 1 || ops[0].Type != model.OpTypeBallot {
+		t.Fatalf("expected a single indexed ballot, got %d ops", len(ops))
+	}
+	if bkr.NBallot != 1 || bkr.NBakerOps != 1 {
+		t.Errorf("expected baker counts for the ballot only, got %d ballots %d ops", bkr.NBallot, bkr.NBakerOps)
+	}
+}
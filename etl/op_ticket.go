@@ -103,8 +103,8 @@ func (b *Builder) AppendTransferTicketOp(ctx context.Context, oh *rpc.Operation,
 		log.Error(Errorf("marshal parameters errors: %s", err))
 	}
 
-	// keep ticket updates
-	op.RawTicketUpdates = res.TicketUpdates()
+	// keep ticket updates, deposits into rollups are credited to the rollup
+	op.RawTicketUpdates = tx.TicketUpdates()
 
 	if op.IsSuccess {
 		flows := b.NewTransferTicketFlows(
@@ -408,8 +408,8 @@ func (b *Builder) AppendInternalTransactionOp(
 		op.BigmapEvents, _ = b.PatchBigmapEvents(ctx, op.BigmapEvents, dst.Address, nil)
 	}
 
-	// keep ticket updates
-	op.RawTicketUpdates = res.TicketUpdates()
+	// keep ticket updates, deposits into rollups are credited to the rollup
+	op.RawTicketUpdates = iop.TicketUpdates()
 
 	// on success, create flows and update accounts
 	if op.IsSuccess {
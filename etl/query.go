@@ -21,11 +21,13 @@ type ListRequest struct {
 	Order       pack.OrderType
 	SenderId    model.AccountID
 	ReceiverId  model.AccountID
+	PayerId     model.AccountID
 	Entrypoints []int64
 	Period      int64
 	BigmapId    int64
 	BigmapKey   mavryk.ExprHash
 	OpId        model.OpID
+	MinGas      int64
 	WithStorage bool
 }
 
@@ -7,10 +7,12 @@ import (
 	"context"
 	"io"
 	"strings"
+	"time"
 
 	"blockwatch.cc/packdb/pack"
 	"github.com/mavryk-network/mvgo/mavryk"
 	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
 )
 
 func (m *Indexer) LookupAccount(ctx context.Context, addr mavryk.Address) (*model.Account, error) {
@@ -159,3 +161,375 @@ func (m *Indexer) FindActivatedAccount(ctx context.Context, addr mavryk.Address)
 	}
 	return m.LookupAccountById(ctx, o.SenderId)
 }
+
+// ListUnstakeRequests replays staking flows of an account and returns its
+// pending unstake requests, oldest first.
+func (m *Indexer) ListUnstakeRequests(ctx context.Context, acc *model.Account, p *rpc.Params) ([]*model.UnstakeRequest, error) {
+	if acc.UnstakedBalance == 0 {
+		return []*model.UnstakeRequest{}, nil
+	}
+	table, err := m.Table(model.FlowTableKey)
+	if err != nil {
+		return nil, err
+	}
+	flows := make([]*model.Flow, 0)
+	err = pack.NewQuery("api.list_unstake_flows").
+		WithTable(table).
+		WithoutCache().
+		AndEqual("account_id", acc.RowId).
+		AndEqual("kind", model.FlowKindStake).
+		AndIn("type", []model.FlowType{
+			model.FlowTypeUnstake,
+			model.FlowTypeFinalizeUnstake,
+			model.FlowTypePenalty,
+		}).
+		WithOrder(pack.OrderAsc).
+		Execute(ctx, &flows)
+	if err != nil {
+		return nil, err
+	}
+	return model.BuildUnstakeQueue(flows, p), nil
+}
+
+// ListBalanceHistory replays all balance flows of an account in chain order
+// and returns flows in the height range [r.Since, r.Until] together with the
+// running balance after each flow. Offset, limit and cursor (flow row id)
+// apply to flows inside the range. Results are always in ascending order
+// because running balances depend on all earlier flows.
+func (m *Indexer) ListBalanceHistory(ctx context.Context, r ListRequest) ([]*model.BalanceHistoryEntry, error) {
+	table, err := m.Table(model.FlowTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.list_balance_history").
+		WithTable(table).
+		WithoutCache().
+		WithOrder(pack.OrderAsc).
+		AndEqual("account_id", r.Account.RowId).
+		AndNotEqual("kind", model.FlowKindDelegation)
+	if r.Until > 0 {
+		q = q.AndLte("height", r.Until)
+	}
+	var (
+		sheet model.BalanceSheet
+		list  = make([]*model.BalanceHistoryEntry, 0)
+	)
+	err = q.Stream(ctx, func(row pack.Row) error {
+		f := &model.Flow{}
+		if err := row.Decode(f); err != nil {
+			return err
+		}
+		c := sheet.Apply(f)
+		if !c.IsValid() || f.Height < r.Since || f.RowId <= r.Cursor {
+			return nil
+		}
+		if r.Offset > 0 {
+			r.Offset--
+			return nil
+		}
+		list = append(list, &model.BalanceHistoryEntry{
+			Flow:     f,
+			Category: c,
+			Balance:  sheet,
+		})
+		if r.Limit > 0 && len(list) == int(r.Limit) {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListLedger returns balance flows of an account in double-entry form.
+// Delegation flows are skipped. Cursor is a flow row id.
+func (m *Indexer) ListLedger(ctx context.Context, r ListRequest) ([]*model.LedgerEntry, error) {
+	table, err := m.Table(model.FlowTableKey)
+	if err != nil {
+		return nil, err
+	}
+	// cursor and offset are mutually exclusive
+	if r.Cursor > 0 {
+		r.Offset = 0
+	}
+	q := pack.NewQuery("api.list_ledger").
+		WithTable(table).
+		WithOrder(r.Order).
+		WithLimit(int(r.Limit)).
+		WithOffset(int(r.Offset)).
+		AndEqual("account_id", r.Account.RowId).
+		AndNotEqual("kind", model.FlowKindDelegation)
+	if r.Cursor > 0 {
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("row_id", r.Cursor)
+		} else {
+			q = q.AndGt("row_id", r.Cursor)
+		}
+	}
+	if r.Since > 0 {
+		q = q.AndGte("height", r.Since)
+	}
+	if r.Until > 0 {
+		q = q.AndLte("height", r.Until)
+	}
+	flows := make([]*model.Flow, 0, r.Limit)
+	if err := q.Execute(ctx, &flows); err != nil {
+		return nil, err
+	}
+	list := make([]*model.LedgerEntry, 0, len(flows))
+	for _, f := range flows {
+		if e, ok := model.NewLedgerEntry(f); ok {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+// ListContractInteractions aggregates successful contract calls and
+// transfers between an account and contracts together with token events
+// on ledgers the account sent or received tokens on. Token events are
+// skipped when the token index is not enabled.
+func (m *Indexer) ListContractInteractions(ctx context.Context, acc *model.Account) ([]*model.ContractInteraction, error) {
+	table, err := m.Table(model.OpTableKey)
+	if err != nil {
+		return nil, err
+	}
+	set := model.NewInteractionSet()
+	op := &model.Op{}
+	err = pack.NewQuery("api.list_interaction_ops").
+		WithTable(table).
+		WithFields("row_id", "height", "time", "sender_id", "receiver_id", "creator_id", "is_internal", "is_contract").
+		AndIn("type", model.OpTypeList{model.OpTypeTransaction, model.OpTypeTransferTicket}).
+		AndEqual("is_success", true).
+		OrCondition(
+			pack.Equal("sender_id", acc.RowId),
+			pack.Equal("receiver_id", acc.RowId),
+			pack.Equal("creator_id", acc.RowId),
+		).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(op); err != nil {
+				return err
+			}
+			if peer, ok := model.InteractionPeer(op, acc.RowId); ok {
+				set.Add(peer, op.RowId, op.Height, op.Timestamp)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	table, err = m.Table(model.TokenEventTableKey)
+	switch err {
+	case nil:
+	case ErrNoTable:
+		return set.List(), nil
+	default:
+		return nil, err
+	}
+	ev := &model.TokenEvent{}
+	err = pack.NewQuery("api.list_interaction_token_events").
+		WithTable(table).
+		WithFields("ledger", "height", "time", "op_id").
+		OrCondition(
+			pack.Equal("sender", acc.RowId),
+			pack.Equal("receiver", acc.RowId),
+		).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(ev); err != nil {
+				return err
+			}
+			if ev.Ledger != acc.RowId {
+				set.Add(ev.Ledger, ev.OpId, ev.Height, ev.Time)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return set.List(), nil
+}
+
+// ListCalledEntrypoints aggregates successful contract calls made by an
+// account per contract and entrypoint, optionally limited to calls of a
+// single contract. Internal calls count for the contract that emitted them,
+// see model.IsEntrypointCaller.
+func (m *Indexer) ListCalledEntrypoints(ctx context.Context, acc *model.Account, contract model.AccountID) ([]*model.EntrypointCall, error) {
+	table, err := m.Table(model.OpTableKey)
+	if err != nil {
+		return nil, err
+	}
+	set := model.NewEntrypointCallSet()
+	op := &model.Op{}
+	q := pack.NewQuery("api.list_called_entrypoints").
+		WithTable(table).
+		WithFields("height", "sender_id", "receiver_id", "creator_id", "entrypoint_id", "is_internal", "is_contract").
+		AndEqual("type", model.OpTypeTransaction).
+		AndEqual("is_success", true).
+		AndEqual("is_contract", true).
+		AndRange("height", acc.FirstSeen, acc.LastSeen).
+		OrCondition(
+			pack.Equal("sender_id", acc.RowId),
+			pack.Equal("creator_id", acc.RowId),
+		)
+	if contract > 0 {
+		q = q.AndEqual("receiver_id", contract)
+	}
+	err = q.Stream(ctx, func(r pack.Row) error {
+		if err := r.Decode(op); err != nil {
+			return err
+		}
+		if model.IsEntrypointCaller(op, acc.RowId) {
+			set.Add(op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return set.List(), nil
+}
+
+// ActivityCount is the number of operations and balance flows of an account
+// in a series bucket.
+type ActivityCount struct {
+	NOps   int
+	NFlows int
+}
+
+// AccountActivity counts operations and flows of an account in the height
+// range [from, to] per bucket. Bucket maps a block to its bucket number.
+// Buckets without activity are not contained in the result.
+func (m *Indexer) AccountActivity(ctx context.Context, acc *model.Account, from, to int64, bucket func(height, cycle int64, tm time.Time) int64) (map[int64]*ActivityCount, error) {
+	res := make(map[int64]*ActivityCount)
+	get := func(b int64) *ActivityCount {
+		c, ok := res[b]
+		if !ok {
+			c = &ActivityCount{}
+			res[b] = c
+		}
+		return c
+	}
+
+	table, err := m.Table(model.OpTableKey)
+	if err != nil {
+		return nil, err
+	}
+	op := &model.Op{}
+	err = pack.NewQuery("api.account_activity_ops").
+		WithTable(table).
+		WithoutCache().
+		WithFields("height", "cycle", "time").
+		AndRange("height", from, to).
+		OrCondition(
+			pack.Equal("sender_id", acc.RowId),
+			pack.Equal("receiver_id", acc.RowId),
+			pack.Equal("baker_id", acc.RowId),
+			pack.Equal("creator_id", acc.RowId),
+		).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(op); err != nil {
+				return err
+			}
+			get(bucket(op.Height, op.Cycle, op.Timestamp)).NOps++
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	table, err = m.Table(model.FlowTableKey)
+	if err != nil {
+		return nil, err
+	}
+	f := &model.Flow{}
+	err = pack.NewQuery("api.account_activity_flows").
+		WithTable(table).
+		WithoutCache().
+		WithFields("height", "cycle", "time").
+		AndEqual("account_id", acc.RowId).
+		AndRange("height", from, to).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(f); err != nil {
+				return err
+			}
+			get(bucket(f.Height, f.Cycle, f.Timestamp)).NFlows++
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DormantFilter selects funded accounts without activity since a height.
+type DormantFilter struct {
+	Since            int64 // last seen before this height
+	MinBalance       int64 // min total balance including stake (inclusive)
+	ExcludeContracts bool
+	ExcludeBakers    bool
+}
+
+func (f DormantFilter) Match(a *model.Account) bool {
+	switch {
+	case a.LastSeen >= f.Since:
+		return false
+	case f.ExcludeContracts && a.IsContract, f.ExcludeBakers && a.IsBaker:
+		return false
+	}
+	bal := a.Balance() + a.StakedBalance
+	return bal > 0 && bal >= f.MinBalance
+}
+
+// StreamDormantAccounts calls fn for accounts matching f in row id order
+// after r.Cursor. At most r.Limit accounts are returned, zero means all.
+// Scans the full account table.
+func (m *Indexer) StreamDormantAccounts(ctx context.Context, f DormantFilter, r ListRequest, fn func(*model.Account) error) error {
+	table, err := m.Table(model.AccountTableKey)
+	if err != nil {
+		return err
+	}
+	q := pack.NewQuery("api.list_dormant_accounts").
+		WithTable(table).
+		WithoutCache().
+		WithFields(
+			"row_id", "address", "first_seen", "last_seen", "last_in", "last_out",
+			"spendable_balance", "frozen_rollup_bond", "staked_balance", "unstaked_balance",
+			"is_contract", "is_baker",
+		).
+		AndLt("last_seen", f.Since).
+		AndEqual("is_funded", true)
+	if f.ExcludeContracts {
+		q = q.AndEqual("is_contract", false)
+	}
+	if f.ExcludeBakers {
+		q = q.AndEqual("is_baker", false)
+	}
+	if r.Cursor > 0 {
+		q = q.AndGt("row_id", r.Cursor)
+	}
+	var n uint
+	err = q.Stream(ctx, func(row pack.Row) error {
+		acc := &model.Account{}
+		if err := row.Decode(acc); err != nil {
+			return err
+		}
+		if !f.Match(acc) {
+			return nil
+		}
+		if err := fn(acc); err != nil {
+			return err
+		}
+		n++
+		if r.Limit > 0 && n == r.Limit {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestDormantFilter(t *testing.T) {
+	f := DormantFilter{Since: 100, MinBalance: 1000, ExcludeBakers: true}
+	for _, v := range []struct {
+		name string
+		acc  model.Account
+		want bool
+	}{
+		{"dormant", model.Account{LastSeen: 50, SpendableBalance: 1000}, true},
+		{"staked", model.Account{LastSeen: 50, SpendableBalance: 400, StakedBalance: 600}, true},
+		{"active", model.Account{LastSeen: 100, SpendableBalance: 5000}, false},
+		{"small", model.Account{LastSeen: 50, SpendableBalance: 999}, false},
+		{"baker", model.Account{LastSeen: 50, SpendableBalance: 5000, IsBaker: true}, false},
+		{"contract", model.Account{LastSeen: 50, SpendableBalance: 5000, IsContract: true}, true},
+	} {
+		if got := f.Match(&v.acc); got != v.want {
+			t.Errorf("%s: want %t, got %t", v.name, v.want, got)
+		}
+	}
+}
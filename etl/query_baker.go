@@ -102,3 +102,48 @@ func (m *Indexer) ListBakers(ctx context.Context, activeOnly bool) ([]*model.Bak
 	}
 	return bkrs, err
 }
+
+// ListBakerDelegators returns all accounts currently delegating to a baker,
+// excluding the baker itself. Staking accounts are included.
+func (m *Indexer) ListBakerDelegators(ctx context.Context, id model.AccountID) ([]*model.Account, error) {
+	table, err := m.Table(model.AccountTableKey)
+	if err != nil {
+		return nil, err
+	}
+	accs := make([]*model.Account, 0)
+	err = pack.NewQuery("api.list_delegators").
+		WithTable(table).
+		AndEqual("baker_id", id).
+		AndNotEqual("row_id", id).
+		Execute(ctx, &accs)
+	if err != nil {
+		return nil, err
+	}
+	return accs, nil
+}
+
+// ListBakerStatus returns activation and deactivation events of a baker.
+func (m *Indexer) ListBakerStatus(ctx context.Context, r ListRequest) ([]*model.BakerStatus, error) {
+	table, err := m.Table(model.BakerStatusTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.list_baker_status").
+		WithTable(table).
+		WithOrder(r.Order).
+		WithOffset(int(r.Offset)).
+		WithLimit(int(r.Limit)).
+		AndEqual("baker", r.Account.RowId)
+	if r.Cursor > 0 {
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("row_id", r.Cursor)
+		} else {
+			q = q.AndGt("row_id", r.Cursor)
+		}
+	}
+	list := make([]*model.BakerStatus, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -4,12 +4,19 @@
 package etl
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"io"
+	"sort"
 	"time"
 
 	"blockwatch.cc/packdb/pack"
 	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/index"
 	"github.com/mavryk-network/mvindex/etl/model"
 )
 
@@ -58,35 +65,62 @@ func (m *Indexer) LookupBigmapType(ctx context.Context, id int64) (*model.Bigmap
 	return alloc, nil
 }
 
-func (m *Indexer) ListHistoricBigmapKeys(ctx context.Context, r ListRequest) ([]*model.BigmapValue, error) {
-	hist, ok := m.bigmap_values.Get(r.BigmapId, r.Since)
-	if !ok {
-		start := time.Now()
-		table, err := m.Table(model.BigmapUpdateTableKey)
-		if err != nil {
-			return nil, err
-		}
-
-		// check if we have any previous bigmap state cached
-		prev, ok := m.bigmap_values.GetBest(r.BigmapId, r.Since)
-		if ok {
-			// update from existing cache
-			hist, err = m.bigmap_values.Update(ctx, prev, table, r.Since)
-			if err != nil {
-				return nil, err
-			}
-			log.Debugf("Updated history cache for bigmap %d from height %d to height %d with %d entries in %s",
-				r.BigmapId, prev.Height, r.Since, hist.Len(), time.Since(start))
-
+// ListBigmapsByType returns bigmaps whose key and value types structurally
+// match key and val, ignoring annotations and pair layout. Uses the type
+// signature hash stored with each alloc and rechecks matches to filter out
+// hash collisions. Use r.Cursor (row id) for paging.
+func (m *Indexer) ListBigmapsByType(ctx context.Context, key, val micheline.Type, r ListRequest) ([]*model.BigmapAlloc, error) {
+	table, err := m.Table(model.BigmapAllocTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.list_bigmaps_by_type").
+		WithTable(table).
+		WithOrder(r.Order).
+		AndEqual("type_hash", model.BigmapTypeHash(key, val))
+	if r.Cursor > 0 {
+		r.Offset = 0
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("I", r.Cursor)
 		} else {
-			// build a new cache
-			hist, err = m.bigmap_values.Build(ctx, table, r.BigmapId, r.Since)
-			if err != nil {
-				return nil, err
-			}
-			log.Debugf("Built history cache for bigmap %d at height %d with %d entries in %s",
-				r.BigmapId, r.Since, hist.Len(), time.Since(start))
+			q = q.AndGt("I", r.Cursor)
+		}
+	}
+	kt, vt := key.Typedef("").Unfold(), val.Typedef("").Unfold()
+	items := make([]*model.BigmapAlloc, 0)
+	err = q.Stream(ctx, func(row pack.Row) error {
+		alloc := &model.BigmapAlloc{}
+		if err := row.Decode(alloc); err != nil {
+			return err
+		}
+		if !alloc.GetKeyType().Typedef("").Unfold().Equal(kt) ||
+			!alloc.GetValueType().Typedef("").Unfold().Equal(vt) {
+			return nil
 		}
+		if r.Offset > 0 {
+			r.Offset--
+			return nil
+		}
+		items = append(items, alloc)
+		if len(items) == int(r.Limit) {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListHistoricBigmapKeys lists bigmap keys live at height r.Since from a cached
+// snapshot. Missing snapshots are built from bigmap updates which may fail with
+// a *cache.BudgetError on very large bigmaps. Also returns the number of updates
+// replayed for this request (zero on cache hits).
+func (m *Indexer) ListHistoricBigmapKeys(ctx context.Context, r ListRequest) ([]*model.BigmapValue, int, error) {
+	hist, updates, err := m.bigmapHistory(ctx, r.BigmapId, r.Since)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// cursor and offset are mutually exclusive, we use offset below
@@ -119,7 +153,265 @@ func (m *Indexer) ListHistoricBigmapKeys(ctx context.Context, r ListRequest) ([]
 			items[i], items[j] = items[j], items[i]
 		}
 	}
-	return items, nil
+	return items, updates, nil
+}
+
+// bigmapHistory returns the live key set of a bigmap at height from cache,
+// or reconstructs it from updates. The number of replayed updates is only
+// non-zero when the state was not cached.
+func (m *Indexer) bigmapHistory(ctx context.Context, id, height int64) (*cache.BigmapHistory, int, error) {
+	if hist, ok := m.bigmap_values.Get(id, height); ok {
+		return hist, 0, nil
+	}
+	start := time.Now()
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// check if we have any previous bigmap state cached or checkpointed
+	var hist *cache.BigmapHistory
+	prev, ok := m.bigmap_values.GetBest(id, height)
+	if cp := m.bigmapCheckpoint(ctx, id, height); cp != nil && (!ok || cp.Height > prev.Height) {
+		m.bigmap_values.Add(cp)
+		if cp.Height == height {
+			return cp, 0, nil
+		}
+		prev, ok = cp, true
+	}
+	if ok {
+		// update from existing cache
+		hist, err = m.bigmap_values.Update(ctx, prev, table, height)
+		if err != nil {
+			logBudgetError(err)
+			return nil, 0, err
+		}
+		log.Debugf("Updated history cache for bigmap %d from height %d to height %d with %d entries in %s",
+			id, prev.Height, height, hist.Len(), time.Since(start))
+
+	} else {
+		// build a new cache
+		hist, err = m.bigmap_values.Build(ctx, table, id, height)
+		if err != nil {
+			logBudgetError(err)
+			return nil, 0, err
+		}
+		log.Debugf("Built history cache for bigmap %d at height %d with %d entries in %s",
+			id, height, hist.Len(), time.Since(start))
+	}
+	return hist, hist.Updates, nil
+}
+
+// bigmapCheckpoint loads the latest stored checkpoint of bigmap id at or
+// below height. Checkpoints are optional, errors are logged and ignored.
+func (m *Indexer) bigmapCheckpoint(ctx context.Context, id, height int64) *cache.BigmapHistory {
+	idx, err := m.Index(index.BigmapIndexKey)
+	if err != nil {
+		return nil
+	}
+	cp, err := idx.(*index.BigmapIndex).LoadCheckpoint(ctx, id, height)
+	if err != nil {
+		log.Warnf("Loading checkpoint for bigmap %d at height %d: %v", id, height, err)
+		return nil
+	}
+	return cp
+}
+
+// BigmapSample is the value of a bigmap key at a height, Value is nil when
+// the key is not live.
+type BigmapSample struct {
+	Height int64
+	Value  *model.BigmapValue
+}
+
+// BigmapValueSeries samples the value of key in bigmap id at heights from,
+// from+step, ... up to to. Samples are read from the key's own updates in a
+// single pass and bypass the bigmap history cache, so series requests
+// neither replay full bigmap states nor evict cached states.
+func (m *Indexer) BigmapValueSeries(ctx context.Context, id int64, key mavryk.ExprHash, from, to, step int64) ([]BigmapSample, error) {
+	if step <= 0 || to < from {
+		return nil, nil
+	}
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		series = make([]BigmapSample, 0, (to-from)/step+1)
+		height = from
+		value  *model.BigmapValue
+		upd    = &model.BigmapUpdate{}
+	)
+	err = pack.NewQuery("api.bigmap_series").
+		WithTable(table).
+		AndEqual("bigmap_id", id).
+		AndEqual("key_id", model.GetKeyId(id, key)).
+		AndLte("height", to).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(upd); err != nil {
+				return err
+			}
+			// skip other keys with the same key id
+			if len(upd.Key) == 0 || !key.Equal(micheline.KeyHash(upd.Key)) {
+				return nil
+			}
+			// emit samples before this update
+			for ; height <= to && height < upd.Height; height += step {
+				series = append(series, BigmapSample{Height: height, Value: value})
+			}
+			switch upd.Action {
+			case micheline.DiffActionUpdate:
+				value = upd.ToKV()
+			case micheline.DiffActionRemove:
+				value = nil
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for ; height <= to; height += step {
+		series = append(series, BigmapSample{Height: height, Value: value})
+	}
+	return series, nil
+}
+
+// BigmapChurn is the share of live keys of a bigmap changed in a range of
+// blocks starting at Height.
+type BigmapChurn struct {
+	Height   int64
+	NUpdated int     // distinct keys updated or removed
+	NKeys    int     // live keys at the end of the range
+	Ratio    float64 // NUpdated relative to all keys live in the range
+}
+
+// churnCounter tracks the live key set of a bigmap and the distinct keys
+// touched since the last flush.
+type churnCounter struct {
+	live    map[uint64]struct{}
+	touched map[uint64]struct{}
+	nStart  int // live keys at the start of the range
+	nAdded  int // touched keys that were not live at the start
+}
+
+func newChurnCounter(live map[uint64]struct{}) *churnCounter {
+	return &churnCounter{
+		live:    live,
+		touched: make(map[uint64]struct{}),
+		nStart:  len(live),
+	}
+}
+
+func (c *churnCounter) Apply(key uint64, action micheline.DiffAction) {
+	switch action {
+	case micheline.DiffActionUpdate, micheline.DiffActionRemove:
+	default:
+		return
+	}
+	if _, ok := c.touched[key]; !ok {
+		c.touched[key] = struct{}{}
+		if _, ok := c.live[key]; !ok {
+			c.nAdded++
+		}
+	}
+	if action == micheline.DiffActionUpdate {
+		c.live[key] = struct{}{}
+	} else {
+		delete(c.live, key)
+	}
+}
+
+// Flush returns churn since the last flush and starts a new range. Keys
+// inserted in the range count towards the live keys so that the ratio
+// never exceeds 1.
+func (c *churnCounter) Flush(height int64) BigmapChurn {
+	res := BigmapChurn{
+		Height:   height,
+		NUpdated: len(c.touched),
+		NKeys:    len(c.live),
+	}
+	if n := c.nStart + c.nAdded; n > 0 {
+		res.Ratio = float64(res.NUpdated) / float64(n)
+	}
+	clear(c.touched)
+	c.nStart, c.nAdded = len(c.live), 0
+	return res
+}
+
+// BigmapChurn returns the share of live keys of bigmap id changed per step
+// blocks from height from up to to. The live key set at from is read from
+// bigmap history, updates in the range are streamed once.
+func (m *Indexer) BigmapChurn(ctx context.Context, id, from, to, step int64) ([]BigmapChurn, error) {
+	if step <= 0 || to < from {
+		return nil, nil
+	}
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	hist, _, err := m.bigmapHistory(ctx, id, from-1)
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[uint64]struct{}, hist.Len())
+	for _, v := range hist.Values() {
+		live[v.KeyId] = struct{}{}
+	}
+
+	var (
+		c     = newChurnCounter(live)
+		res   = make([]BigmapChurn, 0, (to-from)/step+1)
+		next  = from
+		count int
+		limit = cache.BigmapHistoryMaxUpdates
+		upd   = &model.BigmapUpdate{}
+	)
+	err = pack.NewQuery("api.bigmap_churn").
+		WithTable(table).
+		WithFields("action", "key_id", "height").
+		AndEqual("bigmap_id", id).
+		AndGte("height", from).
+		AndLte("height", to).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(upd); err != nil {
+				return err
+			}
+			count++
+			if limit > 0 && count > limit {
+				return &cache.BudgetError{BigmapId: id, Height: to, Processed: count - 1, Limit: limit}
+			}
+			for upd.Height >= next+step {
+				res = append(res, c.Flush(next))
+				next += step
+			}
+			c.Apply(upd.KeyId, upd.Action)
+			return nil
+		})
+	if err != nil {
+		logBudgetError(err)
+		return nil, err
+	}
+	for ; next <= to; next += step {
+		res = append(res, c.Flush(next))
+	}
+	return res, nil
+}
+
+// BigmapCommitment returns the Merkle root over the live key set of bigmap
+// id at height and the number of live keys, see model.BigmapCommitment.
+func (m *Indexer) BigmapCommitment(ctx context.Context, id, height int64) ([32]byte, int, error) {
+	hist, _, err := m.bigmapHistory(ctx, id, height)
+	if err != nil {
+		return [32]byte{}, 0, err
+	}
+	return model.BigmapCommitment(hist.Values()), hist.Len(), nil
+}
+
+func logBudgetError(err error) {
+	var e *cache.BudgetError
+	if errors.As(err, &e) {
+		log.Warnf("Bigmap history budget hit: %v", e)
+	}
 }
 
 func (m *Indexer) ListBigmapKeys(ctx context.Context, r ListRequest) ([]*model.BigmapValue, error) {
@@ -230,3 +522,914 @@ func (m *Indexer) ListBigmapUpdates(ctx context.Context, r ListRequest) ([]model
 	}
 	return items, nil
 }
+
+// FindBigmapCopy returns the update that created bigmap id as a copy at
+// height or nil when the bigmap was not copied. Temporary bigmap ids are
+// reused, so for them maxOp limits the search to the latest copy at or
+// before the consuming operation. The source id is stored in KeyId.
+func (m *Indexer) FindBigmapCopy(ctx context.Context, id, height int64, maxOp model.OpID) (*model.BigmapUpdate, error) {
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.find_bigmap_copy").
+		WithTable(table).
+		AndEqual("bigmap_id", id).
+		AndEqual("height", height).
+		AndEqual("action", micheline.DiffActionCopy)
+	if maxOp > 0 {
+		q = q.AndLte("op_id", maxOp)
+	}
+	var res *model.BigmapUpdate
+	err = q.Stream(ctx, func(r pack.Row) error {
+		upd := &model.BigmapUpdate{}
+		if err := r.Decode(upd); err != nil {
+			return err
+		}
+		// the alloc copy is the first copy row of an operation, later rows
+		// copy keys; prefer the latest operation
+		if res == nil || upd.OpId > res.OpId {
+			res = upd
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ListBigmapLifecycle returns the structural updates of a bigmap in
+// operation order: the alloc or the copy that created it, copies into other
+// bigmaps using it as source and its removal. Key updates are skipped.
+func (m *Indexer) ListBigmapLifecycle(ctx context.Context, alloc *model.BigmapAlloc) ([]*model.BigmapUpdate, error) {
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*model.BigmapUpdate, 0)
+	collect := func(r pack.Row) error {
+		upd := &model.BigmapUpdate{}
+		if err := r.Decode(upd); err != nil {
+			return err
+		}
+		list = append(list, upd)
+		return nil
+	}
+	fields := []string{"row_id", "bigmap_id", "key_id", "action", "op_id", "height", "time"}
+
+	// alloc or copy creating the bigmap and removal
+	err = pack.NewQuery("api.list_bigmap_lifecycle").
+		WithTable(table).
+		WithFields(fields...).
+		AndEqual("bigmap_id", alloc.BigmapId).
+		AndEqual("key_id", uint64(0)).
+		AndIn("action", []micheline.DiffAction{micheline.DiffActionAlloc, micheline.DiffActionRemove}).
+		Stream(ctx, collect)
+	if err != nil {
+		return nil, err
+	}
+	if upd, err := m.FindBigmapCopy(ctx, alloc.BigmapId, alloc.Height, 0); err != nil {
+		return nil, err
+	} else if upd != nil {
+		list = append(list, upd)
+	}
+
+	// copies from this bigmap, source id is stored in key_id
+	q := pack.NewQuery("api.list_bigmap_copies").
+		WithTable(table).
+		WithFields(fields...).
+		AndEqual("key_id", uint64(alloc.BigmapId)).
+		AndEqual("action", micheline.DiffActionCopy).
+		AndGte("height", alloc.Height)
+	if alloc.Deleted > 0 {
+		q = q.AndLte("height", alloc.Deleted)
+	}
+	if err := q.Stream(ctx, collect); err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RowId < list[j].RowId })
+	return list, nil
+}
+
+// ListTempBigmapCopies returns copies out of a temporary bigmap that was
+// created by update tmp. Temporary ids are reused, so the search ends at the
+// next copy into the same temporary id.
+func (m *Indexer) ListTempBigmapCopies(ctx context.Context, tmp *model.BigmapUpdate) ([]*model.BigmapUpdate, error) {
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*model.BigmapUpdate, 0)
+	err = pack.NewQuery("api.list_temp_bigmap_copies").
+		WithTable(table).
+		WithFields("row_id", "bigmap_id", "key_id", "action", "op_id", "height", "time").
+		AndEqual("height", tmp.Height).
+		AndEqual("action", micheline.DiffActionCopy).
+		AndGt("row_id", tmp.RowId).
+		OrCondition(
+			pack.Equal("bigmap_id", tmp.BigmapId),
+			pack.Equal("key_id", uint64(tmp.BigmapId)),
+		).
+		Stream(ctx, func(r pack.Row) error {
+			upd := &model.BigmapUpdate{}
+			if err := r.Decode(upd); err != nil {
+				return err
+			}
+			if upd.BigmapId == tmp.BigmapId {
+				return io.EOF
+			}
+			list = append(list, upd)
+			return nil
+		})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListBigmapUpdateFeed returns the most recent updates across all bigmaps in
+// descending row order, optionally restricted to a set of actions. Use
+// r.Cursor (row id) to page towards older updates. With r.SenderId and/or
+// r.ReceiverId only updates caused by operations sent by this sender or
+// targeting this contract are returned. Updates of temporary bigmaps
+// (negative ids) are skipped.
+func (m *Indexer) ListBigmapUpdateFeed(ctx context.Context, r ListRequest, actions []micheline.DiffAction) ([]model.BigmapUpdate, error) {
+	if r.SenderId > 0 || r.ReceiverId > 0 {
+		return m.listBigmapOpUpdates(ctx, r, actions)
+	}
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.list_bigmap_feed").
+		WithTable(table).
+		WithDesc().
+		WithLimit(int(r.Limit)).
+		WithOffset(int(r.Offset)).
+		AndGte("bigmap_id", 0)
+	if r.Cursor > 0 {
+		q = q.WithOffset(0).AndLt("I", r.Cursor)
+	}
+	if r.Since > 0 {
+		q = q.AndGte("height", r.Since)
+	}
+	if r.Until > 0 {
+		q = q.AndLte("height", r.Until)
+	}
+	switch len(actions) {
+	case 0:
+	case 1:
+		q = q.AndEqual("action", actions[0])
+	default:
+		q = q.AndIn("action", actions)
+	}
+	items := make([]model.BigmapUpdate, 0)
+	if err := q.Execute(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// max number of operations to join with bigmap updates in a single query
+const bigmapOpBatchSize = 256
+
+// listBigmapOpUpdates walks matching successful operations newest first
+// and joins their bigmap updates in batches. Op ids and update row ids
+// grow together, so batches are naturally ordered and the height range of
+// each batch limits the update table scan.
+func (m *Indexer) listBigmapOpUpdates(ctx context.Context, r ListRequest, actions []micheline.DiffAction) ([]model.BigmapUpdate, error) {
+	opTable, err := m.Table(model.OpTableKey)
+	if err != nil {
+		return nil, err
+	}
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// translate the update cursor into an op id to skip newer operations
+	var maxOpId model.OpID
+	if r.Cursor > 0 {
+		r.Offset = 0
+		var upd model.BigmapUpdate
+		err := pack.NewQuery("api.bigmap_feed_cursor").
+			WithTable(table).
+			WithFields("op_id").
+			AndEqual("I", r.Cursor).
+			Execute(ctx, &upd)
+		if err != nil {
+			return nil, err
+		}
+		if upd.OpId == 0 {
+			return nil, nil
+		}
+		maxOpId = upd.OpId
+	}
+
+	items := make([]model.BigmapUpdate, 0)
+	isFull := func() bool {
+		return r.Limit > 0 && len(items) >= int(r.Limit)
+	}
+	join := func(ids []uint64, minHeight, maxHeight int64) error {
+		q := pack.NewQuery("api.list_bigmap_feed_join").
+			WithTable(table).
+			WithDesc().
+			AndRange("height", minHeight, maxHeight).
+			AndIn("op_id", ids).
+			AndGte("bigmap_id", 0)
+		if r.Cursor > 0 {
+			q = q.AndLt("I", r.Cursor)
+		}
+		switch len(actions) {
+		case 0:
+		case 1:
+			q = q.AndEqual("action", actions[0])
+		default:
+			q = q.AndIn("action", actions)
+		}
+		return q.Stream(ctx, func(row pack.Row) error {
+			var upd model.BigmapUpdate
+			if err := row.Decode(&upd); err != nil {
+				return err
+			}
+			if r.Offset > 0 {
+				r.Offset--
+				return nil
+			}
+			items = append(items, upd)
+			if isFull() {
+				return io.EOF
+			}
+			return nil
+		})
+	}
+
+	var (
+		op                   model.Op
+		batch                = make([]uint64, 0, bigmapOpBatchSize)
+		minHeight, maxHeight int64
+	)
+	q := pack.NewQuery("api.list_bigmap_feed_ops").
+		WithTable(opTable).
+		WithFields("row_id", "height").
+		WithDesc().
+		AndEqual("is_success", true).
+		AndIn("type", model.OpTypeList{model.OpTypeTransaction, model.OpTypeOrigination})
+	if r.SenderId > 0 {
+		q = q.AndEqual("sender_id", r.SenderId)
+	}
+	if r.ReceiverId > 0 {
+		q = q.AndEqual("receiver_id", r.ReceiverId)
+	}
+	if maxOpId > 0 {
+		q = q.AndLte("row_id", maxOpId)
+	}
+	if r.Since > 0 {
+		q = q.AndGte("height", r.Since)
+	}
+	if r.Until > 0 {
+		q = q.AndLte("height", r.Until)
+	}
+	err = q.Stream(ctx, func(row pack.Row) error {
+		if err := row.Decode(&op); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			maxHeight = op.Height
+		}
+		minHeight = op.Height
+		batch = append(batch, op.RowId.U64())
+		if len(batch) < bigmapOpBatchSize {
+			return nil
+		}
+		if err := join(batch, minHeight, maxHeight); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = join(batch, minHeight, maxHeight)
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return items, nil
+}
+
+// BigmapOp summarizes all updates a single operation produced in a bigmap.
+type BigmapOp struct {
+	OpId     model.OpID
+	Height   int64
+	NUpdates int
+	Actions  map[micheline.DiffAction]int
+}
+
+// ListBigmapOps returns one entry per operation that updated bigmap r.BigmapId
+// in r.Order. Paging with r.Cursor uses op ids. Offset and limit count
+// operations, not updates.
+func (m *Indexer) ListBigmapOps(ctx context.Context, r ListRequest) ([]*BigmapOp, error) {
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.list_bigmap_ops").
+		WithTable(table).
+		WithFields("op_id", "height", "action").
+		WithOrder(r.Order).
+		AndEqual("bigmap_id", r.BigmapId)
+	if r.Cursor > 0 {
+		r.Offset = 0
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("op_id", r.Cursor)
+		} else {
+			q = q.AndGt("op_id", r.Cursor)
+		}
+	}
+	if r.Since > 0 {
+		q = q.AndGte("height", r.Since)
+	}
+	if r.Until > 0 {
+		q = q.AndLte("height", r.Until)
+	}
+	var (
+		upd   model.BigmapUpdate
+		items = make([]*BigmapOp, 0)
+		seen  = make(map[model.OpID]*BigmapOp)
+	)
+	err = q.Stream(ctx, func(row pack.Row) error {
+		if err := row.Decode(&upd); err != nil {
+			return err
+		}
+		if op, ok := seen[upd.OpId]; ok {
+			op.NUpdates++
+			op.Actions[upd.Action]++
+			return nil
+		}
+		// stop at the first new block when full, updates from the
+		// same operation are always stored in the same block
+		if r.Limit > 0 && len(items) == int(r.Limit) && items[len(items)-1].Height != upd.Height {
+			return io.EOF
+		}
+		op := &BigmapOp{
+			OpId:     upd.OpId,
+			Height:   upd.Height,
+			NUpdates: 1,
+			Actions:  map[micheline.DiffAction]int{upd.Action: 1},
+		}
+		seen[upd.OpId] = op
+		if r.Offset > 0 {
+			r.Offset--
+			return nil
+		}
+		if r.Limit == 0 || len(items) < int(r.Limit) {
+			items = append(items, op)
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListBigmapPrefixKeys returns live values of a pair-keyed bigmap whose left-most
+// key component equals prefix. Since key_id is a hash over the full key there is
+// no index to use here, so this streams all live values of the bigmap and decodes
+// each key. Cost is linear in the number of live keys (NKeys), callers should
+// always set a limit.
+func (m *Indexer) ListBigmapPrefixKeys(ctx context.Context, r ListRequest, prefix micheline.Key) ([]*model.BigmapValue, error) {
+	table, err := m.Table(model.BigmapValueTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.list_bigmap_prefix").
+		WithTable(table).
+		WithOrder(r.Order).
+		AndEqual("bigmap_id", r.BigmapId)
+	if r.Cursor > 0 {
+		r.Offset = 0
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("I", r.Cursor)
+		} else {
+			q = q.AndGt("I", r.Cursor)
+		}
+	}
+	match := prefix.Bytes()
+	items := make([]*model.BigmapValue, 0)
+	dec := NewStreamDecoder(ctx, m.decodeWorkers,
+		func(b *model.BigmapValue) (*model.BigmapValue, error) {
+			var key micheline.Prim
+			if err := key.UnmarshalBinary(b.Key); err != nil {
+				return nil, nil
+			}
+			if key.OpCode != micheline.D_PAIR || len(key.Args) == 0 {
+				return nil, nil
+			}
+			left, err := micheline.NewKey(prefix.Type, key.Args[0])
+			if err != nil || !bytes.Equal(left.Bytes(), match) {
+				return nil, nil
+			}
+			return b, nil
+		},
+		func(b *model.BigmapValue) error {
+			return r.appendMatch(&items, b)
+		},
+	)
+	err = q.Stream(ctx, func(row pack.Row) error {
+		b := &model.BigmapValue{}
+		if err := row.Decode(b); err != nil {
+			return err
+		}
+		return dec.Submit(b)
+	})
+	if cerr := dec.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return items, nil
+}
+
+// appendMatch appends a matching bigmap value (nil when the value did not
+// match) to items after skipping r.Offset matches. It returns io.EOF once
+// r.Limit items are collected.
+func (r *ListRequest) appendMatch(items *[]*model.BigmapValue, b *model.BigmapValue) error {
+	if b == nil {
+		return nil
+	}
+	// offset applies to matching keys only
+	if r.Offset > 0 {
+		r.Offset--
+		return nil
+	}
+	*items = append(*items, b)
+	if len(*items) == int(r.Limit) {
+		return io.EOF
+	}
+	return nil
+}
+
+// IsNatRangeKeyType returns true when keys of type typ embed a numeric value
+// usable for range queries, i.e. the key itself or the left-most component of
+// a pair key is a nat or int.
+func IsNatRangeKeyType(typ micheline.Type) bool {
+	p := typ.Prim
+	for p.OpCode == micheline.T_PAIR && len(p.Args) > 0 {
+		p = p.Args[0]
+	}
+	return p.OpCode == micheline.T_NAT || p.OpCode == micheline.T_INT
+}
+
+// maxBigmapNatKeyList is the largest nat key range that is queried as a list
+// of keys so the nat key bloom filter can skip packs. Larger ranges are
+// matched against pack min/max statistics only.
+const maxBigmapNatKeyList = 256
+
+// ListBigmapNatRangeKeys returns live values whose embedded numeric key lies
+// in the inclusive range [from, to]. Nat keyed bigmaps use the indexed nat key
+// column, other key types fall back to a scan over all live keys. Results are
+// ordered by row id which is also used as cursor.
+func (m *Indexer) ListBigmapNatRangeKeys(ctx context.Context, r ListRequest, typ micheline.Type, from, to uint64) ([]*model.BigmapValue, error) {
+	table, err := m.Table(model.BigmapValueTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.list_bigmap_range").
+		WithTable(table).
+		WithOrder(r.Order).
+		AndEqual("bigmap_id", r.BigmapId)
+	if typ.OpCode == micheline.T_NAT {
+		if to-from < maxBigmapNatKeyList {
+			keys := make([]uint64, 0, to-from+1)
+			for k := from; ; k++ {
+				keys = append(keys, k)
+				if k == to {
+					break
+				}
+			}
+			q = q.AndIn("nat_key", keys)
+		} else {
+			q = q.AndRange("nat_key", from, to)
+		}
+	}
+	if r.Cursor > 0 {
+		r.Offset = 0
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("I", r.Cursor)
+		} else {
+			q = q.AndGt("I", r.Cursor)
+		}
+	}
+	items := make([]*model.BigmapValue, 0)
+	dec := NewStreamDecoder(ctx, m.decodeWorkers,
+		func(b *model.BigmapValue) (*model.BigmapValue, error) {
+			// check the decoded key, the nat key column cannot represent
+			// keys larger than uint64
+			var key micheline.Prim
+			if err := key.UnmarshalBinary(b.Key); err != nil {
+				return nil, nil
+			}
+			for key.OpCode == micheline.D_PAIR && len(key.Args) > 0 {
+				key = key.Args[0]
+			}
+			n, ok := model.BigmapNatKey(key)
+			if !ok || n < from || n > to {
+				return nil, nil
+			}
+			return b, nil
+		},
+		func(b *model.BigmapValue) error {
+			return r.appendMatch(&items, b)
+		},
+	)
+	err = q.Stream(ctx, func(row pack.Row) error {
+		b := &model.BigmapValue{}
+		if err := row.Decode(b); err != nil {
+			return err
+		}
+		return dec.Submit(b)
+	})
+	if cerr := dec.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return items, nil
+}
+
+// BigmapRecentKey is the latest update of a bigmap key within a height range
+// together with the key's current live value (nil when the key is removed).
+type BigmapRecentKey struct {
+	Update model.BigmapUpdate
+	Live   *model.BigmapValue
+}
+
+// ListBigmapRecentKeys returns keys updated or removed in the height range
+// [r.Since, r.Until], deduplicated to their latest update in that range and
+// ordered by last update height. Offset and limit apply to unique keys.
+func (m *Indexer) ListBigmapRecentKeys(ctx context.Context, r ListRequest) ([]BigmapRecentKey, error) {
+	updTable, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	valTable, err := m.Table(model.BigmapValueTableKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// collect the latest update per key, updates stream in ascending order;
+	// track keys by their bytes because key ids may collide
+	latest := make(map[string]int)
+	list := make([]BigmapRecentKey, 0)
+	q := pack.NewQuery("api.list_bigmap_recent").
+		WithTable(updTable).
+		AndEqual("bigmap_id", r.BigmapId).
+		AndIn("action", []micheline.DiffAction{micheline.DiffActionUpdate, micheline.DiffActionRemove})
+	if r.Since > 0 {
+		q = q.AndGte("height", r.Since)
+	}
+	if r.Until > 0 {
+		q = q.AndLte("height", r.Until)
+	}
+	err = q.Stream(ctx, func(row pack.Row) error {
+		b := model.BigmapUpdate{}
+		if err := row.Decode(&b); err != nil {
+			return err
+		}
+		// skip bigmap removal which has no key
+		if len(b.Key) == 0 {
+			return nil
+		}
+		if i, ok := latest[string(b.Key)]; ok {
+			list[i].Update = b
+			return nil
+		}
+		latest[string(b.Key)] = len(list)
+		list = append(list, BigmapRecentKey{Update: b})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// order by last update height
+	sort.SliceStable(list, func(i, j int) bool {
+		if r.Order == pack.OrderDesc {
+			return list[i].Update.RowId > list[j].Update.RowId
+		}
+		return list[i].Update.RowId < list[j].Update.RowId
+	})
+
+	// paginate
+	if int(r.Offset) >= len(list) {
+		return nil, nil
+	}
+	list = list[r.Offset:]
+	if r.Limit > 0 && int(r.Limit) < len(list) {
+		list = list[:r.Limit]
+	}
+
+	// join current live values
+	keyIds := make([]uint64, 0, len(list))
+	index := make(map[uint64][]int, len(list))
+	for i, v := range list {
+		keyIds = append(keyIds, v.Update.KeyId)
+		index[v.Update.KeyId] = append(index[v.Update.KeyId], i)
+	}
+	if len(keyIds) == 0 {
+		return list, nil
+	}
+	err = pack.NewQuery("api.list_bigmap_recent_values").
+		WithTable(valTable).
+		AndEqual("bigmap_id", r.BigmapId).
+		AndIn("key_id", keyIds).
+		Stream(ctx, func(row pack.Row) error {
+			b := &model.BigmapValue{}
+			if err := row.Decode(b); err != nil {
+				return err
+			}
+			// skip hash collisions on key_id
+			for _, i := range index[b.KeyId] {
+				if list[i].Update.GetKeyHash().Equal(b.GetKeyHash()) {
+					list[i].Live = b
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListBigmapRefs lists bigmap keys whose key or value embeds the address of
+// r.Account. Only available when bigmap address indexing is enabled. Refs
+// for the same key are reported once, at the height of their most recent
+// (desc) or first (asc) mention.
+func (m *Indexer) ListBigmapRefs(ctx context.Context, r ListRequest) ([]*model.BigmapRef, error) {
+	table, err := m.Table(model.BigmapRefTableKey)
+	if err != nil {
+		return nil, err
+	}
+	q := pack.NewQuery("api.list_bigmap_refs").
+		WithTable(table).
+		WithOrder(r.Order).
+		AndEqual("account_id", r.Account.RowId)
+	if r.BigmapId > 0 {
+		q = q.AndEqual("bigmap_id", r.BigmapId)
+	}
+	if r.Since > 0 {
+		q = q.AndGt("height", r.Since)
+	}
+	if r.Until > 0 {
+		q = q.AndLte("height", r.Until)
+	}
+	if r.Cursor > 0 {
+		r.Offset = 0
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("I", r.Cursor)
+		} else {
+			q = q.AndGt("I", r.Cursor)
+		}
+	}
+	seen := make(map[uint64]struct{})
+	items := make([]*model.BigmapRef, 0)
+	err = q.Stream(ctx, func(row pack.Row) error {
+		ref := &model.BigmapRef{}
+		if err := row.Decode(ref); err != nil {
+			return err
+		}
+		if _, ok := seen[ref.KeyId]; ok {
+			return nil
+		}
+		seen[ref.KeyId] = struct{}{}
+		if r.Offset > 0 {
+			r.Offset--
+			return nil
+		}
+		items = append(items, ref)
+		if len(items) == int(r.Limit) {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return items, nil
+}
+
+// LookupBigmapRefKeys returns the most recent update for each key referenced
+// by refs, keyed by key id. Keys are read from the update table in a single
+// query, so keys removed since the ref was written are resolved as well.
+func (m *Indexer) LookupBigmapRefKeys(ctx context.Context, refs []*model.BigmapRef) (map[uint64]*model.BigmapUpdate, error) {
+	keys := make(map[uint64]*model.BigmapUpdate, len(refs))
+	if len(refs) == 0 {
+		return keys, nil
+	}
+	table, err := m.Table(model.BigmapUpdateTableKey)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0, len(refs))
+	for _, v := range refs {
+		if _, ok := keys[v.KeyId]; !ok {
+			keys[v.KeyId] = nil
+			ids = append(ids, v.KeyId)
+		}
+	}
+	n := len(ids)
+	err = pack.NewQuery("api.lookup_bigmap_ref_keys").
+		WithTable(table).
+		WithDesc().
+		AndIn("key_id", ids).
+		AndIn("action", []micheline.DiffAction{micheline.DiffActionUpdate, micheline.DiffActionRemove}).
+		Stream(ctx, func(row pack.Row) error {
+			upd := &model.BigmapUpdate{}
+			if err := row.Decode(upd); err != nil {
+				return err
+			}
+			if v, ok := keys[upd.KeyId]; !ok || v != nil {
+				return nil
+			}
+			keys[upd.KeyId] = upd
+			if n--; n == 0 {
+				return io.EOF
+			}
+			return nil
+		})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// BigmapSizeBucket counts live bigmaps with Min <= NKeys <= Max.
+type BigmapSizeBucket struct {
+	Min   int64
+	Max   int64
+	Count int
+}
+
+// BigmapHistogram is the distribution of live bigmaps by number of keys.
+type BigmapHistogram struct {
+	Count   int
+	Buckets []BigmapSizeBucket
+	Top     []*model.BigmapAlloc
+}
+
+// BigmapHistogram buckets all live bigmaps by their number of active keys
+// in decimal orders of magnitude (0, 1-10, 11-100, ...) and collects the
+// n largest bigmaps. Only alloc table counters are scanned.
+func (m *Indexer) BigmapHistogram(ctx context.Context, n int) (*BigmapHistogram, error) {
+	table, err := m.Table(model.BigmapAllocTableKey)
+	if err != nil {
+		return nil, err
+	}
+	h := &BigmapHistogram{
+		Buckets: []BigmapSizeBucket{{}},
+		Top:     make([]*model.BigmapAlloc, 0, n+1),
+	}
+	alloc := &model.BigmapAlloc{}
+	err = pack.NewQuery("api.bigmap_histogram").
+		WithTable(table).
+		WithFields("bigmap_id", "account_id", "n_keys", "delete_height").
+		AndEqual("delete_height", 0).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(alloc); err != nil {
+				return err
+			}
+			h.Count++
+
+			// bucket i > 0 holds 10^(i-1) < n_keys <= 10^i
+			i := 0
+			for lim := int64(0); lim < alloc.NKeys; i++ {
+				lim = max(10, lim*10)
+			}
+			for len(h.Buckets) <= i {
+				lo := h.Buckets[len(h.Buckets)-1].Max + 1
+				h.Buckets = append(h.Buckets, BigmapSizeBucket{Min: lo, Max: max(10, (lo-1)*10)})
+			}
+			h.Buckets[i].Count++
+
+			// keep the top list sorted by size desc
+			if n <= 0 || (len(h.Top) == n && h.Top[n-1].NKeys >= alloc.NKeys) {
+				return nil
+			}
+			pos := sort.Search(len(h.Top), func(k int) bool {
+				return h.Top[k].NKeys < alloc.NKeys
+			})
+			h.Top = append(h.Top, nil)
+			copy(h.Top[pos+1:], h.Top[pos:])
+			a := *alloc
+			h.Top[pos] = &a
+			if len(h.Top) > n {
+				h.Top = h.Top[:n]
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// ListLargestBigmapValues returns the n live values of bigmap id with the
+// largest encoded size, largest first. Only the value_size column is
+// scanned, values stored without size are measured from their bytes.
+func (m *Indexer) ListLargestBigmapValues(ctx context.Context, id int64, n int) ([]*model.BigmapValue, error) {
+	table, err := m.Table(model.BigmapValueTableKey)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	// keep the top list sorted by size desc
+	top := make([]*model.BigmapValue, 0, n+1)
+	insert := func(v *model.BigmapValue) {
+		if len(top) == n && top[n-1].Size >= v.Size {
+			return
+		}
+		pos := sort.Search(len(top), func(k int) bool {
+			return top[k].Size < v.Size
+		})
+		top = append(top, nil)
+		copy(top[pos+1:], top[pos:])
+		top[pos] = v
+		if len(top) > n {
+			top = top[:n]
+		}
+	}
+
+	unsized := make([]uint64, 0)
+	val := &model.BigmapValue{}
+	err = pack.NewQuery("api.bigmap_largest").
+		WithTable(table).
+		WithFields("row_id", "bigmap_id", "value_size").
+		AndEqual("bigmap_id", id).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(val); err != nil {
+				return err
+			}
+			if val.Size == 0 {
+				unsized = append(unsized, val.RowId)
+				return nil
+			}
+			insert(&model.BigmapValue{RowId: val.RowId, Size: val.Size})
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	if len(unsized) > 0 {
+		err = table.StreamLookup(ctx, unsized, func(r pack.Row) error {
+			v := &model.BigmapValue{}
+			if err := r.Decode(v); err != nil {
+				return err
+			}
+			v.Size = int32(len(v.Value))
+			insert(v)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// load full rows for the top list
+	ids := make([]uint64, 0, len(top))
+	for _, v := range top {
+		if v.Key == nil {
+			ids = append(ids, v.RowId)
+		}
+	}
+	if len(ids) == 0 {
+		return top, nil
+	}
+	rows := make(map[uint64]*model.BigmapValue, len(ids))
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	err = table.StreamLookup(ctx, ids, func(r pack.Row) error {
+		v := &model.BigmapValue{}
+		if err := r.Decode(v); err != nil {
+			return err
+		}
+		rows[v.RowId] = v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range top {
+		if row, ok := rows[v.RowId]; ok {
+			row.Size = v.Size
+			top[i] = row
+		}
+	}
+	return top, nil
+}
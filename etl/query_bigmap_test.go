@@ -0,0 +1,298 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	_ "blockwatch.cc/packdb/store/bolt"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestBigmapChurnCounter(t *testing.T) {
+	const (
+		upd = micheline.DiffActionUpdate
+		rem = micheline.DiffActionRemove
+	)
+	c := newChurnCounter(map[uint64]struct{}{1: {}, 2: {}, 3: {}, 4: {}})
+
+	// block 10: rewrite key 1 twice and remove key 2
+	c.Apply(1, upd)
+	c.Apply(1, upd)
+	c.Apply(2, rem)
+	r := c.Flush(10)
+	if r.NUpdated != 2 || r.NKeys != 3 || r.Ratio != 0.5 {
+		t.Errorf("block 10: got %+v", r)
+	}
+
+	// block 11: no updates
+	if r := c.Flush(11); r.NUpdated != 0 || r.NKeys != 3 || r.Ratio != 0 {
+		t.Errorf("block 11: got %+v", r)
+	}
+
+	// block 12: insert 3 new keys, insert and remove another, update key 3
+	c.Apply(5, upd)
+	c.Apply(6, upd)
+	c.Apply(7, upd)
+	c.Apply(8, upd)
+	c.Apply(8, rem)
+	c.Apply(3, upd)
+	c.Apply(9, micheline.DiffActionAlloc)
+	r = c.Flush(12)
+	if r.NUpdated != 5 || r.NKeys != 6 || r.Ratio != 5.0/7.0 {
+		t.Errorf("block 12: got %+v", r)
+	}
+}
+
+// newBigmapTestIndexer returns an indexer backed by a temporary bigmap index.
+func newBigmapTestIndexer(t *testing.T) *Indexer {
+	t.Helper()
+	dir := t.TempDir()
+	idx := index.NewBigmapIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	m := &Indexer{tables: make(map[string]*pack.Table)}
+	for _, v := range idx.Tables() {
+		m.tables[v.Name()] = v
+	}
+	return m
+}
+
+func TestBigmapRecentKeysCollision(t *testing.T) {
+	m := newBigmapTestIndexer(t)
+	ctx := context.Background()
+	upd := micheline.DiffActionUpdate
+
+	// keys a and b share a key id, a is updated again after b
+	a, b := micheline.NewString("a"), micheline.NewString("b")
+	ka, _ := a.MarshalBinary()
+	kb, _ := b.MarshalBinary()
+	for _, v := range []*model.BigmapUpdate{
+		{BigmapId: 5, KeyId: 7, Key: ka, Action: upd, Height: 10},
+		{BigmapId: 5, KeyId: 7, Key: kb, Action: upd, Height: 11},
+		{BigmapId: 5, KeyId: 7, Key: ka, Action: upd, Height: 12},
+	} {
+		if err := m.tables[model.BigmapUpdateTableKey].Insert(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := m.ListBigmapRecentKeys(ctx, ListRequest{BigmapId: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("want 2 keys, got %d", len(list))
+	}
+	if list[0].Update.Height != 11 || list[1].Update.Height != 12 {
+		t.Errorf("want keys at height 11, 12, got %d, %d", list[0].Update.Height, list[1].Update.Height)
+	}
+}
+
+func TestBigmapLifecycle(t *testing.T) {
+	m := newBigmapTestIndexer(t)
+	ctx := context.Background()
+	insert := func(upd *model.BigmapUpdate) *model.BigmapUpdate {
+		t.Helper()
+		if err := m.tables[model.BigmapUpdateTableKey].Insert(ctx, upd); err != nil {
+			t.Fatal(err)
+		}
+		return upd
+	}
+	const (
+		alloc = micheline.DiffActionAlloc
+		cp    = micheline.DiffActionCopy
+		upd   = micheline.DiffActionUpdate
+		rem   = micheline.DiffActionRemove
+	)
+	neg := func(id int64) uint64 { return uint64(id) }
+
+	// block 10: alloc bigmap 5 and a key
+	insert(&model.BigmapUpdate{BigmapId: 5, Action: alloc, OpId: 1, Height: 10})
+	insert(&model.BigmapUpdate{BigmapId: 5, KeyId: 99, Action: upd, OpId: 1, Height: 10})
+
+	// block 11: copy 5 to 6 directly, to 7 through temp -1 and
+	// reuse temp -1 for an unrelated copy from 8 to 9
+	insert(&model.BigmapUpdate{BigmapId: 6, KeyId: 5, Action: cp, OpId: 2, Height: 11})
+	tmp := insert(&model.BigmapUpdate{BigmapId: -1, KeyId: 5, Action: cp, OpId: 3, Height: 11})
+	insert(&model.BigmapUpdate{BigmapId: 7, KeyId: neg(-1), Action: cp, OpId: 3, Height: 11})
+	insert(&model.BigmapUpdate{BigmapId: -1, KeyId: 8, Action: cp, OpId: 4, Height: 11})
+	insert(&model.BigmapUpdate{BigmapId: 9, KeyId: neg(-1), Action: cp, OpId: 4, Height: 11})
+
+	// block 12: remove one key, then the bigmap
+	insert(&model.BigmapUpdate{BigmapId: 5, KeyId: 99, Action: rem, OpId: 5, Height: 12})
+	insert(&model.BigmapUpdate{BigmapId: 5, Action: rem, OpId: 5, Height: 12})
+
+	list, err := m.ListBigmapLifecycle(ctx, &model.BigmapAlloc{BigmapId: 5, Height: 10, Deleted: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id     int64
+		action micheline.DiffAction
+	}{{5, alloc}, {6, cp}, {-1, cp}, {5, rem}}
+	if len(list) != len(want) {
+		t.Fatalf("lifecycle: want %d events, got %d", len(want), len(list))
+	}
+	for i, w := range want {
+		if list[i].BigmapId != w.id || list[i].Action != w.action {
+			t.Errorf("lifecycle %d: want %d %s, got %d %s", i, w.id, w.action, list[i].BigmapId, list[i].Action)
+		}
+	}
+
+	copies, err := m.ListTempBigmapCopies(ctx, tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 1 || copies[0].BigmapId != 7 {
+		t.Errorf("temp copies: want copy to 7, got %d copies", len(copies))
+	}
+}
+
+func TestBigmapRefKeys(t *testing.T) {
+	m := newBigmapTestIndexer(t)
+	ctx := context.Background()
+	for _, v := range []*model.BigmapUpdate{
+		{BigmapId: 5, KeyId: 7, Action: micheline.DiffActionUpdate, Height: 10},
+		{BigmapId: 5, KeyId: 8, Action: micheline.DiffActionRemove, Height: 11},
+		{BigmapId: 5, KeyId: 7, Action: micheline.DiffActionUpdate, Height: 12},
+		{BigmapId: 6, KeyId: 5, Action: micheline.DiffActionCopy, Height: 13},
+	} {
+		if err := m.tables[model.BigmapUpdateTableKey].Insert(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refs := []*model.BigmapRef{
+		{BigmapId: 5, KeyId: 7},
+		{BigmapId: 5, KeyId: 8},
+		{BigmapId: 5, KeyId: 5},
+		{BigmapId: 5, KeyId: 7},
+	}
+	keys, err := m.LookupBigmapRefKeys(ctx, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upd := keys[7]; upd == nil || upd.Height != 12 {
+		t.Errorf("key 7: want update at height 12, got %+v", upd)
+	}
+	if upd := keys[8]; upd == nil || upd.Height != 11 {
+		t.Errorf("key 8: want removal at height 11, got %+v", upd)
+	}
+	if upd := keys[5]; upd != nil {
+		t.Errorf("key 5: want no update, got %+v", upd)
+	}
+}
+
+func TestBigmapUpdateFeedSkipsTemp(t *testing.T) {
+	m := newBigmapTestIndexer(t)
+	ctx := context.Background()
+	for _, v := range []*model.BigmapUpdate{
+		{BigmapId: 5, KeyId: 1, Action: micheline.DiffActionUpdate, Height: 10},
+		{BigmapId: -1, KeyId: 2, Action: micheline.DiffActionUpdate, Height: 10},
+		{BigmapId: -1, KeyId: 5, Action: micheline.DiffActionCopy, Height: 10},
+		{BigmapId: 6, KeyId: 3, Action: micheline.DiffActionUpdate, Height: 11},
+	} {
+		if err := m.tables[model.BigmapUpdateTableKey].Insert(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := m.ListBigmapUpdateFeed(ctx, ListRequest{Limit: 10}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].BigmapId != 6 || list[1].BigmapId != 5 {
+		t.Errorf("expected updates of bigmaps 6, 5, got %+v", list)
+	}
+}
+
+func TestBigmapValueSeries(t *testing.T) {
+	m := newBigmapTestIndexer(t)
+	ctx := context.Background()
+
+	// key a is set at 10, updated at 20 and removed at 30, key b shares
+	// the key id of a
+	a, b := micheline.NewString("a"), micheline.NewString("b")
+	ka, _ := a.MarshalBinary()
+	kb, _ := b.MarshalBinary()
+	v1, _ := micheline.NewInt64(1).MarshalBinary()
+	v2, _ := micheline.NewInt64(2).MarshalBinary()
+	hash := micheline.KeyHash(ka)
+	kid := model.GetKeyId(5, hash)
+	for _, v := range []*model.BigmapUpdate{
+		{BigmapId: 5, KeyId: kid, Key: ka, Value: v1, Action: micheline.DiffActionUpdate, Height: 10},
+		{BigmapId: 5, KeyId: kid, Key: kb, Value: v1, Action: micheline.DiffActionUpdate, Height: 15},
+		{BigmapId: 5, KeyId: kid, Key: ka, Value: v2, Action: micheline.DiffActionUpdate, Height: 20},
+		{BigmapId: 5, KeyId: kid, Key: ka, Action: micheline.DiffActionRemove, Height: 30},
+	} {
+		if err := m.tables[model.BigmapUpdateTableKey].Insert(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the test indexer has no history cache, series must not use it
+	series, err := m.BigmapValueSeries(ctx, 5, hash, 5, 35, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		height int64
+		value  []byte
+	}{{5, nil}, {10, v1}, {15, v1}, {20, v2}, {25, v2}, {30, nil}, {35, nil}}
+	if len(series) != len(want) {
+		t.Fatalf("expected %d samples, got %d", len(want), len(series))
+	}
+	for i, w := range want {
+		s := series[i]
+		if s.Height != w.height {
+			t.Errorf("sample %d: expected height %d, got %d", i, w.height, s.Height)
+		}
+		switch {
+		case w.value == nil && s.Value != nil:
+			t.Errorf("sample %d: expected no value, got %x", i, s.Value.Value)
+		case w.value != nil && (s.Value == nil || !bytes.Equal(s.Value.Value, w.value)):
+			t.Errorf("sample %d: expected value %x, got %v", i, w.value, s.Value)
+		}
+	}
+}
+
+func TestBigmapNatRangeKeys(t *testing.T) {
+	m := newBigmapTestIndexer(t)
+	ctx := context.Background()
+	for _, n := range []int64{1, 5, 300, 1000} {
+		k := micheline.NewInt64(n)
+		buf, _ := k.MarshalBinary()
+		v := &model.BigmapValue{BigmapId: 5, KeyId: uint64(n), Key: buf, Height: 10}
+		v.NatKey, _ = model.BigmapNatKey(k)
+		if err := m.tables[model.BigmapValueTableKey].Insert(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nat := micheline.NewType(micheline.NewCode(micheline.T_NAT))
+	for _, c := range []struct {
+		from, to uint64
+		want     int
+	}{
+		{1, 5, 2},            // listed keys
+		{6, 299, 0},          // listed keys without match
+		{2, 1000, 3},         // range
+		{1000, 1<<64 - 1, 1}, // range up to the largest key
+	} {
+		list, err := m.ListBigmapNatRangeKeys(ctx, ListRequest{BigmapId: 5}, nat, c.from, c.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != c.want {
+			t.Errorf("[%d,%d]: want %d keys, got %d", c.from, c.to, c.want, len(list))
+		}
+	}
+}
@@ -5,6 +5,8 @@ package etl
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"sort"
 
 	"blockwatch.cc/packdb/pack"
@@ -32,6 +34,9 @@ func (m *Indexer) LookupContract(ctx context.Context, addr mavryk.Address) (*mod
 	if cc.RowId == 0 {
 		return nil, model.ErrNoContract
 	}
+	if err := m.joinScripts(ctx, table, cc); err != nil {
+		return nil, err
+	}
 	return cc, nil
 }
 
@@ -51,9 +56,32 @@ func (m *Indexer) LookupContractId(ctx context.Context, id model.AccountID) (*mo
 	if cc.RowId == 0 {
 		return nil, model.ErrNoContract
 	}
+	if err := m.joinScripts(ctx, table, cc); err != nil {
+		return nil, err
+	}
 	return cc, nil
 }
 
+// joinScripts restores shared scripts of contracts loaded from table.
+func (m *Indexer) joinScripts(ctx context.Context, table *pack.Table, list ...*model.Contract) error {
+	for _, cc := range list {
+		if !cc.IsSharedScript() {
+			continue
+		}
+		code, ok := m.script_code.Get(cc.CodeHash)
+		if !ok {
+			var err error
+			code, err = model.LoadScriptCode(ctx, table, cc.ScriptRef)
+			if err != nil {
+				return fmt.Errorf("contract %s: %w", cc, err)
+			}
+			m.script_code.Add(cc.CodeHash, code)
+		}
+		cc.JoinScript(code)
+	}
+	return nil
+}
+
 func (m *Indexer) LookupContractType(ctx context.Context, id model.AccountID) (micheline.Type, micheline.Type, uint64, error) {
 	elem, ok := m.contract_types.Get(id)
 	if !ok {
@@ -119,6 +147,9 @@ func (m *Indexer) ListContracts(ctx context.Context, r ListRequest) ([]*model.Co
 		if err != nil {
 			return nil, err
 		}
+		if err := m.joinScripts(ctx, table, ccs...); err != nil {
+			return nil, err
+		}
 		return ccs, nil
 	} else {
 		// contract factories (1: list ids from op table, 2: list contracts)
@@ -162,10 +193,92 @@ func (m *Indexer) ListContracts(ctx context.Context, r ListRequest) ([]*model.Co
 		if err != nil {
 			return nil, err
 		}
+		if err := m.joinScripts(ctx, table, ccs...); err != nil {
+			return nil, err
+		}
 		return ccs, nil
 	}
 }
 
+// ListOriginatedContracts returns contracts filtered by creator (r.Account,
+// optional) and origination height range (r.Since and r.Until, inclusive,
+// zero for open ranges). Use r.Cursor (row id) for paging.
+func (m *Indexer) ListOriginatedContracts(ctx context.Context, r ListRequest) ([]*model.Contract, error) {
+	table, err := m.Table(model.ContractTableKey)
+	if err != nil {
+		return nil, err
+	}
+	// cursor and offset are mutually exclusive
+	if r.Cursor > 0 {
+		r.Offset = 0
+	}
+	q := pack.NewQuery("api.list_originated_contracts").
+		WithTable(table).
+		WithOrder(r.Order).
+		WithLimit(int(r.Limit)).
+		WithOffset(int(r.Offset))
+	if r.Account != nil {
+		q = q.AndEqual("creator_id", r.Account.RowId)
+	}
+	if r.Since > 0 {
+		q = q.AndGte("first_seen", r.Since)
+	}
+	if r.Until > 0 {
+		q = q.AndLte("first_seen", r.Until)
+	}
+	if r.Cursor > 0 {
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("I", r.Cursor)
+		} else {
+			q = q.AndGt("I", r.Cursor)
+		}
+	}
+	ccs := make([]*model.Contract, 0)
+	if err := q.Execute(ctx, &ccs); err != nil {
+		return nil, err
+	}
+	if err := m.joinScripts(ctx, table, ccs...); err != nil {
+		return nil, err
+	}
+	return ccs, nil
+}
+
+// ListContractsByCodeHash returns contracts that share the same code hash,
+// i.e. instances of the same contract template. Global constants are
+// expanded before hashing, so contracts using constants match their
+// expanded equivalents.
+func (m *Indexer) ListContractsByCodeHash(ctx context.Context, hash uint64, r ListRequest) ([]*model.Contract, error) {
+	table, err := m.Table(model.ContractTableKey)
+	if err != nil {
+		return nil, err
+	}
+	// cursor and offset are mutually exclusive
+	if r.Cursor > 0 {
+		r.Offset = 0
+	}
+	q := pack.NewQuery("api.list_contracts_by_code").
+		WithTable(table).
+		AndEqual("code_hash", hash).
+		WithOrder(r.Order).
+		WithLimit(int(r.Limit)).
+		WithOffset(int(r.Offset))
+	if r.Cursor > 0 {
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("I", r.Cursor)
+		} else {
+			q = q.AndGt("I", r.Cursor)
+		}
+	}
+	ccs := make([]*model.Contract, 0)
+	if err := q.Execute(ctx, &ccs); err != nil {
+		return nil, err
+	}
+	if err := m.joinScripts(ctx, table, ccs...); err != nil {
+		return nil, err
+	}
+	return ccs, nil
+}
+
 func (m *Indexer) LookupConstant(ctx context.Context, hash mavryk.ExprHash) (*model.Constant, error) {
 	if !hash.IsValid() {
 		return nil, model.ErrInvalidExprHash
@@ -211,6 +324,39 @@ func (m *Indexer) FindPreviousStorage(ctx context.Context, id model.AccountID, s
 	return store, nil
 }
 
+// LookupStorageBefore returns the storage of contract id before operation
+// opId was applied, i.e. the result storage of the latest earlier successful
+// call or origination. Falls back to the latest storage update below height
+// when earlier operations are not indexed.
+func (m *Indexer) LookupStorageBefore(ctx context.Context, id model.AccountID, opId model.OpID, height int64) (*model.Storage, error) {
+	table, err := m.Table(model.OpTableKey)
+	if err != nil {
+		return nil, err
+	}
+	prev := &model.Op{}
+	err = pack.NewQuery("api.storage.before").
+		WithTable(table).
+		WithFields("row_id", "height", "storage_hash").
+		WithDesc().
+		WithLimit(1).
+		AndLt("row_id", opId).
+		AndEqual("receiver_id", id).
+		AndEqual("is_success", true).
+		AndIn("type", model.OpTypeList{
+			model.OpTypeTransaction,
+			model.OpTypeOrigination,
+			model.OpTypeSubsidy,
+		}).
+		Execute(ctx, prev)
+	if err != nil {
+		return nil, err
+	}
+	if prev.RowId == 0 {
+		return m.FindPreviousStorage(ctx, id, 0, height-1)
+	}
+	return m.LookupStorage(ctx, id, prev.StorageHash, 0, prev.Height)
+}
+
 func (m *Indexer) LookupStorage(ctx context.Context, id model.AccountID, h uint64, since, until int64) (*model.Storage, error) {
 	table, err := m.Table(model.StorageTableKey)
 	if err != nil {
@@ -288,3 +434,102 @@ func (m *Indexer) ListOpEvents(ctx context.Context, id uint64, sndr model.Accoun
 	}
 	return events, nil
 }
+
+// ListRolesByAddress returns active contract roles held by addr, optionally
+// restricted to a single role name. Cursor is a role row id.
+func (m *Indexer) ListRolesByAddress(ctx context.Context, addr mavryk.Address, role string, r ListRequest) ([]*model.ContractRole, error) {
+	table, err := m.Table(model.ContractRoleTableKey)
+	if err != nil {
+		return nil, err
+	}
+	// cursor and offset are mutually exclusive
+	if r.Cursor > 0 {
+		r.Offset = 0
+	}
+	q := pack.NewQuery("api.list_roles_by_address").
+		WithTable(table).
+		WithOrder(r.Order).
+		WithLimit(int(r.Limit)).
+		WithOffset(int(r.Offset)).
+		AndEqual("address", addr).
+		AndEqual("last_height", 0)
+	if role != "" {
+		q = q.AndEqual("role", role)
+	}
+	if r.Cursor > 0 {
+		if r.Order == pack.OrderDesc {
+			q = q.AndLt("row_id", r.Cursor)
+		} else {
+			q = q.AndGt("row_id", r.Cursor)
+		}
+	}
+	list := make([]*model.ContractRole, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ScanContractStorage decodes the current storage of contracts in row id
+// order after r.Cursor and returns contracts that contain value. At most
+// maxScan contracts are decoded per call and at most r.Limit matches are
+// returned. The returned cursor is the last scanned contract row id, or
+// zero when the end of the table was reached.
+func (m *Indexer) ScanContractStorage(ctx context.Context, value string, r ListRequest, maxScan int) ([]*model.StorageMatch, uint64, error) {
+	table, err := m.Table(model.ContractTableKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	q := pack.NewQuery("api.scan_contract_storage").
+		WithTable(table).
+		WithoutCache().
+		WithOrder(pack.OrderAsc)
+	if r.Cursor > 0 {
+		q = q.AndGt("row_id", r.Cursor)
+	}
+	ccs := make([]*model.Contract, 0)
+	err = q.Stream(ctx, func(row pack.Row) error {
+		cc := &model.Contract{}
+		if err := row.Decode(cc); err != nil {
+			return err
+		}
+		ccs = append(ccs, cc)
+		if len(ccs) == maxScan {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	more := err == io.EOF
+
+	// join shared scripts after streaming, loading code locks the table
+	if err := m.joinScripts(ctx, table, ccs...); err != nil {
+		return nil, 0, err
+	}
+	var (
+		list   = make([]*model.StorageMatch, 0)
+		cursor uint64
+	)
+	for _, cc := range ccs {
+		cursor = cc.RowId.U64()
+		if len(cc.Storage) > 0 {
+			if _, styp, err := cc.LoadType(); err == nil {
+				var prim micheline.Prim
+				if err := prim.UnmarshalBinary(cc.Storage); err == nil {
+					if paths := model.FindStorageValue(micheline.NewValue(styp, prim), value); len(paths) > 0 {
+						list = append(list, &model.StorageMatch{Contract: cc, Paths: paths})
+					}
+				}
+			}
+		}
+		if r.Limit > 0 && len(list) == int(r.Limit) {
+			return list, cursor, nil
+		}
+	}
+	if !more {
+		cursor = 0
+	}
+	return list, cursor, nil
+}
@@ -58,6 +58,44 @@ func (m *Indexer) LookupOp(ctx context.Context, opIdent string, r ListRequest) (
 	return ops, nil
 }
 
+// LookupOpGroups returns all operations of the groups with the given hashes
+// in a single query. At most r.Limit operations are returned per group.
+func (m *Indexer) LookupOpGroups(ctx context.Context, hashes []mavryk.OpHash, r ListRequest) (map[mavryk.OpHash][]*model.Op, error) {
+	groups := make(map[mavryk.OpHash][]*model.Op)
+	if len(hashes) == 0 {
+		return groups, nil
+	}
+	table, err := m.Table(model.OpTableKey)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, len(hashes))
+	for i := range hashes {
+		keys[i] = hashes[i][:]
+	}
+	ops := make([]*model.Op, 0)
+	err = pack.NewQuery("api.find_tx_groups").
+		WithTable(table).
+		AndIn("hash", keys).
+		Execute(ctx, &ops)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, op := range ops {
+		if r.Limit > 0 && uint(len(groups[op.Hash])) >= r.Limit {
+			continue
+		}
+		groups[op.Hash] = append(groups[op.Hash], op)
+		ops[n] = op
+		n++
+	}
+	if r.WithStorage {
+		m.joinStorage(ctx, ops[:n])
+	}
+	return groups, nil
+}
+
 func (m *Indexer) LookupOpHash(ctx context.Context, opid model.OpID) mavryk.OpHash {
 	table, err := m.Table(model.OpTableKey)
 	if err != nil {
@@ -76,6 +114,28 @@ func (m *Indexer) LookupOpHash(ctx context.Context, opid model.OpID) mavryk.OpHa
 	return o.Hash
 }
 
+// ListOpFlows returns balance flows caused by operations at the given
+// block height and in-block positions.
+func (m *Indexer) ListOpFlows(ctx context.Context, height int64, opn []int) ([]*model.Flow, error) {
+	table, err := m.Table(model.FlowTableKey)
+	if err != nil {
+		return nil, err
+	}
+	flows := make([]*model.Flow, 0)
+	if len(opn) == 0 {
+		return flows, nil
+	}
+	err = pack.NewQuery("api.list_op_flows").
+		WithTable(table).
+		AndEqual("height", height).
+		AndIn("op_n", opn).
+		Execute(ctx, &flows)
+	if err != nil {
+		return nil, err
+	}
+	return flows, nil
+}
+
 func (m *Indexer) LookupEndorsement(ctx context.Context, opIdent string) ([]*model.Op, error) {
 	table, err := m.Table(model.EndorseOpTableKey)
 	if err != nil {
@@ -168,6 +228,13 @@ func (m *Indexer) ListBlockOps(ctx context.Context, r ListRequest) ([]*model.Op,
 	if r.ReceiverId > 0 {
 		q = q.AndEqual("receiver_id", r.ReceiverId)
 	}
+	if r.PayerId > 0 {
+		// all ops in a batch share the same source which pays the fees
+		q = q.AndEqual("sender_id", r.PayerId).AndGt("fee", 0)
+	}
+	if r.MinGas > 0 {
+		q = q.AndGte("gas_used", r.MinGas)
+	}
 	if r.Account != nil {
 		q = q.OrCondition(
 			pack.Equal("sender_id", r.Account.RowId),
@@ -201,6 +268,70 @@ func (m *Indexer) ListBlockOps(ctx context.Context, r ListRequest) ([]*model.Op,
 	return ops, nil
 }
 
+// ListProtocolOps lists implicit events injected by protocol migrations
+// (invoices, airdrops, contract migrations) across all blocks.
+func (m *Indexer) ListProtocolOps(ctx context.Context, r ListRequest) ([]*model.Op, error) {
+	table, err := m.Table(model.OpTableKey)
+	if err != nil {
+		return nil, err
+	}
+	// cursor and offset are mutually exclusive
+	if r.Cursor > 0 {
+		r.Offset = 0
+	}
+	if len(r.Typs) == 0 {
+		r.Typs = model.OpTypeList{model.OpTypeInvoice, model.OpTypeAirdrop, model.OpTypeMigration}
+		r.Mode = pack.FilterModeIn
+	}
+	q := pack.NewQuery("api.list_protocol_ops").
+		WithTable(table).
+		WithOrder(r.Order).
+		WithLimit(int(r.Limit)).
+		WithOffset(int(r.Offset)).
+		AndEqual("is_event", true)
+
+	if r.Mode.IsScalar() {
+		q = q.And("type", r.Mode, r.Typs[0])
+	} else {
+		q = q.And("type", r.Mode, r.Typs)
+	}
+	if r.ReceiverId > 0 {
+		q = q.AndEqual("receiver_id", r.ReceiverId)
+	}
+	if r.Cursor > 0 {
+		height := int64(r.Cursor >> 16)
+		opn := int64(r.Cursor & 0xFFFF)
+		if r.Order == pack.OrderDesc {
+			q = q.OrCondition(
+				pack.Lt("height", height),
+				pack.And(
+					pack.Equal("height", height),
+					pack.Lt("op_n", opn),
+				),
+			)
+		} else {
+			q = q.OrCondition(
+				pack.Gt("height", height),
+				pack.And(
+					pack.Equal("height", height),
+					pack.Gt("op_n", opn),
+				),
+			)
+		}
+	}
+	if r.Since > 0 {
+		q = q.AndGt("height", r.Since)
+	}
+	if r.Until > 0 {
+		q = q.AndLte("height", r.Until)
+	}
+	ops := make([]*model.Op, 0, r.Limit)
+	if err = q.Execute(ctx, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
 func (m *Indexer) ListBlockEndorsements(ctx context.Context, r ListRequest) ([]*model.Endorsement, error) {
 	table, err := m.Table(model.EndorseOpTableKey)
 	if err != nil {
@@ -348,6 +479,13 @@ func (m *Indexer) ListAccountOps(ctx context.Context, r ListRequest) ([]*model.O
 			)
 		}
 	}
+	if r.PayerId > 0 {
+		// all ops in a batch share the same source which pays the fees
+		q = q.AndEqual("sender_id", r.PayerId).AndGt("fee", 0)
+	}
+	if r.MinGas > 0 {
+		q = q.AndGte("gas_used", r.MinGas)
+	}
 
 	if r.Cursor > 0 {
 		height := int64(r.Cursor >> 16)
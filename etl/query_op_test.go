@@ -0,0 +1,61 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestLookupOpGroups(t *testing.T) {
+	dir := t.TempDir()
+	idx := index.NewOpIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	m := &Indexer{tables: make(map[string]*pack.Table)}
+	for _, v := range idx.Tables() {
+		m.tables[v.Name()] = v
+	}
+	ctx := context.Background()
+
+	hash := func(n byte) mavryk.OpHash {
+		var h mavryk.OpHash
+		h[0] = n
+		return h
+	}
+	a, b, c := hash(1), hash(2), hash(3)
+	for i, h := range []mavryk.OpHash{a, a, a, b, c, b} {
+		op := &model.Op{Hash: h, Height: 10, OpN: i, Type: model.OpTypeTransaction}
+		if err := m.tables[model.OpTableKey].Insert(ctx, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := m.LookupOpGroups(ctx, []mavryk.OpHash{a, b}, ListRequest{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	if l := groups[a]; len(l) != 2 || l[0].OpN != 0 || l[1].OpN != 1 {
+		t.Errorf("group a: expected first 2 ops in order, got %d", len(l))
+	}
+	if l := groups[b]; len(l) != 2 || l[0].OpN != 3 || l[1].OpN != 5 {
+		t.Errorf("group b: expected ops 3 and 5, got %d", len(l))
+	}
+	if _, ok := groups[c]; ok {
+		t.Errorf("unexpected group c")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// SnapshotBalances reconstructs own balances (spendable, frozen, staked and
+// unstaked) of all accounts at height by replaying balance flows. This is a
+// full scan over all flows up to height.
+func (m *Indexer) SnapshotBalances(ctx context.Context, height int64) (map[model.AccountID]int64, error) {
+	table, err := m.Table(model.FlowTableKey)
+	if err != nil {
+		return nil, err
+	}
+	sheets := make(map[model.AccountID]*model.BalanceSheet)
+	f := &model.Flow{}
+	err = pack.NewQuery("api.snapshot_balances").
+		WithTable(table).
+		WithoutCache().
+		WithFields("account_id", "kind", "type", "amount_in", "amount_out", "is_unfrozen").
+		AndLte("height", height).
+		AndNotEqual("kind", model.FlowKindDelegation).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(f); err != nil {
+				return err
+			}
+			b, ok := sheets[f.AccountId]
+			if !ok {
+				b = &model.BalanceSheet{}
+				sheets[f.AccountId] = b
+			}
+			b.Apply(f)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[model.AccountID]int64, len(sheets))
+	for id, b := range sheets {
+		res[id] = b.Total()
+	}
+	return res, nil
+}
+
+// SnapshotTokenBalances reconstructs balances of all holders of a token at
+// height by replaying token events.
+func (m *Indexer) SnapshotTokenBalances(ctx context.Context, id model.TokenID, height int64) (map[model.AccountID]mavryk.Z, error) {
+	table, err := m.Table(model.TokenEventTableKey)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[model.AccountID]mavryk.Z)
+	ev := &model.TokenEvent{}
+	err = pack.NewQuery("api.snapshot_token_balances").
+		WithTable(table).
+		WithoutCache().
+		WithFields("type", "sender", "receiver", "amount").
+		AndEqual("token", id).
+		AndLte("height", height).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(ev); err != nil {
+				return err
+			}
+			ev.ApplyBalance(res)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -76,3 +76,40 @@ func (m *Indexer) SupplyByTime(ctx context.Context, t time.Time) (*model.Supply,
 	}
 	return s, nil
 }
+
+// ListCycleSupply returns the supply at the last indexed block of each cycle
+// after cycle since in ascending order. The last entry may belong to the
+// current, incomplete cycle.
+func (m *Indexer) ListCycleSupply(ctx context.Context, since int64) ([]*model.Supply, error) {
+	table, err := m.Table(model.SupplyTableKey)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		list = make([]*model.Supply, 0)
+		last model.Supply
+		s    model.Supply
+	)
+	err = pack.NewQuery("api.list_cycle_supply").
+		WithTable(table).
+		AndGt("cycle", since).
+		AndGte("height", 1). // skip genesis block without supply
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(&s); err != nil {
+				return err
+			}
+			if last.RowId > 0 && last.Cycle != s.Cycle {
+				cp := last
+				list = append(list, &cp)
+			}
+			last = s
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	if last.RowId > 0 {
+		list = append(list, &last)
+	}
+	return list, nil
+}
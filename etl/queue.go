@@ -0,0 +1,141 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync/atomic"
+	"time"
+
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+var ErrQueueClosed = errors.New("block queue closed")
+
+// queueStats exports queue depth, capacity and the time the fetcher stalled
+// on a full queue (indexer too slow) or the indexer waited on an empty
+// queue (fetcher too slow).
+var queueStats = expvar.NewMap("crawler_queue")
+
+// BlockQueue is the bounded pipeline between block fetcher and indexer.
+// Fetched blocks wait here until the indexer picks them up, so memory is
+// bounded by the queue size. When the indexer falls behind, Push blocks
+// and the fetcher stops loading blocks until space becomes available.
+//
+// On reorg the queue is flushed. Blocks queued before a flush belong to an
+// older epoch and are dropped even when the indexer receives them late.
+type BlockQueue struct {
+	ch    chan queuedBundle
+	epoch atomic.Uint64
+}
+
+type queuedBundle struct {
+	b     *rpc.Bundle
+	epoch uint64
+}
+
+func NewBlockQueue(size int) *BlockQueue {
+	q := &BlockQueue{
+		// the fetcher kicks off with a signal of the same size, so never
+		// use an unbuffered channel
+		ch: make(chan queuedBundle, max(size, 1)),
+	}
+	queueStats.Set("capacity", expvar.Func(func() any { return q.Cap() }))
+	queueStats.Set("depth", expvar.Func(func() any { return q.Len() }))
+	return q
+}
+
+// Len returns the number of queued blocks.
+func (q *BlockQueue) Len() int {
+	return len(q.ch)
+}
+
+// Cap returns the max number of queued blocks.
+func (q *BlockQueue) Cap() int {
+	return cap(q.ch)
+}
+
+// Push appends a block and blocks while the queue is full. Time spent
+// waiting is exported as stall time.
+func (q *BlockQueue) Push(ctx context.Context, b *rpc.Bundle, quit <-chan struct{}) error {
+	item := queuedBundle{b: b, epoch: q.epoch.Load()}
+	select {
+	case q.ch <- item:
+		return nil
+	default:
+	}
+	queueStats.Add("push_stalls", 1)
+	start := time.Now()
+	defer func() {
+		queueStats.Add("push_stall_ms", time.Since(start).Milliseconds())
+	}()
+	select {
+	case q.ch <- item:
+		return nil
+	case <-quit: // unblock on shutdown
+		return context.Canceled
+	case <-ctx.Done(): // unblock on forced shutdown
+		return ctx.Err()
+	}
+}
+
+// Pop returns the next block and blocks while the queue is empty. Blocks
+// queued before the last flush are skipped. Returns ErrQueueClosed after
+// the fetcher has closed the queue.
+func (q *BlockQueue) Pop(ctx context.Context, quit <-chan struct{}) (*rpc.Bundle, error) {
+	start := time.Now()
+	defer func() {
+		queueStats.Add("pop_wait_ms", time.Since(start).Milliseconds())
+	}()
+	for {
+		select {
+		case item, ok := <-q.ch:
+			if !ok {
+				return nil, ErrQueueClosed
+			}
+			if item.epoch != q.epoch.Load() {
+				queueStats.Add("flushed_blocks", 1)
+				continue
+			}
+			return item.b, nil
+		case <-quit:
+			return nil, context.Canceled
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Flush drops all queued blocks and returns their number. Blocks the
+// indexer receives concurrently are skipped by Pop.
+func (q *BlockQueue) Flush() int {
+	q.epoch.Add(1)
+	var n int
+	for {
+		select {
+		case _, ok := <-q.ch:
+			if !ok {
+				return n
+			}
+			n++
+			queueStats.Add("flushed_blocks", 1)
+		default:
+			return n
+		}
+	}
+}
+
+// Close is called by the fetcher when it stops pushing blocks.
+func (q *BlockQueue) Close() {
+	close(q.ch)
+}
+
+// Drain discards queued blocks until the fetcher has closed the queue, so
+// the fetcher never blocks on shutdown and queued blocks are released.
+func (q *BlockQueue) Drain() {
+	for range q.ch {
+	}
+}
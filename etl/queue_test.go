@@ -0,0 +1,102 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mavryk-network/mvindex/rpc"
+)
+
+func testBundle(height int64) *rpc.Bundle {
+	return &rpc.Bundle{Block: &rpc.Block{Header: rpc.BlockHeader{Level: height}}}
+}
+
+func TestBlockQueue(t *testing.T) {
+	ctx := context.Background()
+	quit := make(chan struct{})
+	q := NewBlockQueue(2)
+
+	// push blocks until the queue is full
+	for h := int64(1); h <= 2; h++ {
+		if err := q.Push(ctx, testBundle(h), quit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.Len() != 2 {
+		t.Fatalf("expected 2 queued blocks, got %d", q.Len())
+	}
+
+	// the fetcher stalls while the queue is full
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	err := q.Push(tctx, testBundle(3), quit)
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected push to block on full queue, got %v", err)
+	}
+
+	// a reorg flushes queued blocks
+	if n := q.Flush(); n != 2 {
+		t.Fatalf("expected 2 flushed blocks, got %d", n)
+	}
+	if err := q.Push(ctx, testBundle(2), quit); err != nil {
+		t.Fatal(err)
+	}
+	b, err := q.Pop(ctx, quit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Height() != 2 {
+		t.Errorf("expected height 2 after flush, got %d", b.Height())
+	}
+
+	// blocks pushed before a flush are skipped when received late
+	stale := queuedBundle{b: testBundle(3), epoch: q.epoch.Load()}
+	q.epoch.Add(1)
+	q.ch <- stale
+	if err := q.Push(ctx, testBundle(4), quit); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = q.Pop(ctx, quit); err != nil || b.Height() != 4 {
+		t.Errorf("expected height 4 after stale block, got %v %v", b, err)
+	}
+
+	// remaining blocks are delivered before the closed queue stops the indexer
+	if err := q.Push(ctx, testBundle(5), quit); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+	if b, err = q.Pop(ctx, quit); err != nil || b.Height() != 5 {
+		t.Errorf("expected height 5 before close, got %v %v", b, err)
+	}
+	if _, err = q.Pop(ctx, quit); err != ErrQueueClosed {
+		t.Errorf("expected closed queue, got %v", err)
+	}
+	q.Drain()
+}
+
+func TestBlockQueueDrain(t *testing.T) {
+	ctx := context.Background()
+	quit := make(chan struct{})
+	q := NewBlockQueue(1)
+
+	// fetcher blocked on a full queue stops on shutdown and closes the queue
+	done := make(chan error, 1)
+	go func() {
+		defer q.Close()
+		for h := int64(1); ; h++ {
+			if err := q.Push(ctx, testBundle(h), quit); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	close(quit)
+	q.Drain()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected canceled push, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+var truncatedBlocks = expvar.NewInt("recovery_truncated_blocks")
+
+// blockTables lists tables with rows written per block and their height
+// column. Rows above an index tip belong to blocks that were not
+// completely stored before an unclean shutdown. Tables with rows for
+// future heights (rights) or cycles are not listed.
+var blockTables = map[string]string{
+	model.BlockTableKey:            "height",
+	model.OpTableKey:               "height",
+	model.EndorseOpTableKey:        "height",
+	model.FlowTableKey:             "height",
+	model.EventTableKey:            "height",
+	model.SupplyTableKey:           "height",
+	model.BigmapAllocTableKey:      "alloc_height",
+	model.BigmapUpdateTableKey:     "height",
+	model.BigmapValueTableKey:      "height",
+	model.BigmapCheckpointTableKey: "height",
+	model.TicketUpdateTableKey:     "height",
+	model.TicketEventTableKey:      "height",
+	model.TokenEventTableKey:       "height",
+	model.TokenMetaChangeTableKey:  "height",
+}
+
+// FlushAll finalizes and flushes all indexes and the task table so that
+// everything written up to the current tips is persisted. It is called on
+// shutdown before tips are stored.
+func (m *Indexer) FlushAll(ctx context.Context) error {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	for _, idx := range m.indexes {
+		if err := idx.FinalizeSync(ctx); err != nil {
+			return fmt.Errorf("finalizing %s: %w", idx.Name(), err)
+		}
+	}
+	return m.Flush(ctx)
+}
+
+// NeedCheckpoint returns true when tables must be flushed and tips stored
+// after the current block during catch-up. Tables flush a full journal on
+// their own, which persists data of all blocks since tips were last
+// stored. Flushing before any journal fills up keeps stored data at most
+// one block ahead of the tips. A table that flushed on its own anyway,
+// e.g. after a very large block, is caught at the end of the same block.
+func (m *Indexer) NeedCheckpoint() bool {
+	calls, full := m.flushState()
+	return full || calls != m.flushCalls
+}
+
+// Checkpoint flushes all tables before tips are stored.
+func (m *Indexer) Checkpoint(ctx context.Context) error {
+	if err := m.Flush(ctx); err != nil {
+		return err
+	}
+	m.flushCalls, _ = m.flushState()
+	return nil
+}
+
+// flushState returns the number of table flushes and whether any table
+// journal is more than half full.
+func (m *Indexer) flushState() (int64, bool) {
+	var (
+		calls int64
+		full  bool
+	)
+	for _, idx := range m.indexes {
+		for _, t := range idx.Tables() {
+			s := t.Stats()[0]
+			calls += s.FlushCalls
+			if 2*(s.JournalTuplesCount+s.TombstoneTuplesCount) > s.JournalTuplesThreshold {
+				full = true
+			}
+		}
+	}
+	return calls, full
+}
+
+// TruncateIncomplete removes data of blocks above the stored index tips.
+// Such data is left behind when the process is killed after tables were
+// partially flushed but before tips were updated. Reindexing these blocks
+// on top would duplicate rows and break bigmap rollbacks.
+func (m *Indexer) TruncateIncomplete(ctx context.Context) error {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	n, err := truncateIncompleteBlocks(ctx, m.indexes, m.tips)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return m.Flush(ctx)
+	}
+	return nil
+}
+
+// truncateIncompleteBlocks rolls back the block above the tip of each index
+// and returns the number of truncated blocks. Rows a rollback could not
+// remove, e.g. bigmap updates without alloc, are deleted afterwards.
+//
+// Tables are flushed together with the tips (see NeedCheckpoint), so an
+// unclean shutdown leaves data of at most one block above a tip. More
+// incomplete blocks are only found in databases of older versions or
+// after a table flushed in the middle of a block and the process was
+// killed before the checkpoint. Non-block tables like accounts cannot be
+// restored by rolling back single blocks, so this requires a rebuild.
+func truncateIncompleteBlocks(ctx context.Context, indexes []model.BlockIndexer, tips map[string]*IndexTip) (int, error) {
+	var (
+		minTip    int64 = -1
+		maxHeight int64 = -1
+	)
+	for _, idx := range indexes {
+		tip, ok := tips[idx.Key()]
+		if !ok {
+			continue
+		}
+		for _, t := range idx.Tables() {
+			col, ok := blockTables[t.Name()]
+			if !ok {
+				continue
+			}
+			h, err := maxHeightAbove(ctx, t, col, tip.Height)
+			if err != nil {
+				return 0, fmt.Errorf("checking %s: %w", t.Name(), err)
+			}
+			if h > tip.Height {
+				log.Warnf("Table %s has data up to block %d above %s tip %d.", t.Name(), h, idx.Name(), tip.Height)
+				maxHeight = max(maxHeight, h)
+				if minTip < 0 || tip.Height < minTip {
+					minTip = tip.Height
+				}
+			}
+		}
+	}
+	if maxHeight < 0 {
+		return 0, nil
+	}
+
+	if maxHeight > minTip+1 {
+		return 0, fmt.Errorf("blocks %d..%d are incomplete after unclean shutdown: %w",
+			minTip+1, maxHeight, index.ErrReindexRequired)
+	}
+
+	log.Warnf("Truncating incomplete block %d after unclean shutdown.", maxHeight)
+	for _, idx := range indexes {
+		tip, ok := tips[idx.Key()]
+		if !ok || maxHeight <= tip.Height {
+			continue
+		}
+		if err := idx.DeleteBlock(ctx, maxHeight); err != nil {
+			return 0, fmt.Errorf("truncating %s block %d: %w", idx.Name(), maxHeight, err)
+		}
+	}
+
+	// remove rows left behind by failed rollbacks, bigmap values carry the
+	// height of their last update and are restored by the rollback above
+	for _, idx := range indexes {
+		tip, ok := tips[idx.Key()]
+		if !ok {
+			continue
+		}
+		for _, t := range idx.Tables() {
+			col, ok := blockTables[t.Name()]
+			if !ok || t.Name() == model.BigmapValueTableKey {
+				continue
+			}
+			_, err := pack.NewQuery("etl.truncate").
+				WithTable(t).
+				AndGt(col, tip.Height).
+				Delete(ctx)
+			if err != nil {
+				return 0, fmt.Errorf("truncating %s: %w", t.Name(), err)
+			}
+		}
+	}
+
+	n := int(maxHeight - minTip)
+	truncatedBlocks.Add(int64(n))
+	return n, nil
+}
+
+// maxHeightAbove returns the largest value of column col above height or
+// -1 when there is none.
+func maxHeightAbove(ctx context.Context, t *pack.Table, col string, height int64) (int64, error) {
+	field := t.Fields().Find(col)
+	if !field.IsValid() {
+		return -1, nil
+	}
+	maxHeight := int64(-1)
+	err := pack.NewQuery("etl.check_tip").
+		WithTable(t).
+		WithFields(col).
+		AndGt(col, height).
+		Stream(ctx, func(r pack.Row) error {
+			v, err := r.Field(field.Name)
+			if err != nil {
+				return err
+			}
+			if h, ok := v.(int64); ok {
+				maxHeight = max(maxHeight, h)
+			}
+			return nil
+		})
+	if err != nil {
+		return -1, err
+	}
+	return maxHeight, nil
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	_ "blockwatch.cc/packdb/store/bolt"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func newRecoveryTestIndexes(t *testing.T) ([]model.BlockIndexer, map[string]*pack.Table, map[string]*IndexTip) {
+	t.Helper()
+	dir := t.TempDir()
+	indexes := []model.BlockIndexer{index.NewBigmapIndex(), index.NewSupplyIndex()}
+	tables := make(map[string]*pack.Table)
+	tips := make(map[string]*IndexTip)
+	for _, idx := range indexes {
+		if err := idx.Create(dir, "test", nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Init(dir, "test", nil); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { idx.Close() })
+		for _, v := range idx.Tables() {
+			tables[v.Name()] = v
+		}
+		tips[idx.Key()] = &IndexTip{Height: 10}
+	}
+	return indexes, tables, tips
+}
+
+func TestTruncateIncompleteBlocks(t *testing.T) {
+	indexes, tables, tips := newRecoveryTestIndexes(t)
+
+	// blocks 10 and earlier were completely stored
+	ctx := context.Background()
+	insert := func(key string, v pack.Item) {
+		t.Helper()
+		if err := tables[key].Insert(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k1, _ := micheline.NewString("a").MarshalBinary()
+	v1, _ := micheline.NewInt64(1).MarshalBinary()
+	v2, _ := micheline.NewInt64(2).MarshalBinary()
+	kid := model.GetKeyId(1, micheline.KeyHash(k1))
+	upd := micheline.DiffActionUpdate
+	insert(model.SupplyTableKey, &model.Supply{Height: 10})
+	insert(model.BigmapAllocTableKey, &model.BigmapAlloc{BigmapId: 1, Height: 5, NKeys: 1})
+	insert(model.BigmapUpdateTableKey, &model.BigmapUpdate{BigmapId: 1, KeyId: kid, Key: k1, Value: v1, Action: upd, Height: 5})
+
+	// process was killed while writing block 11 which updated the live key
+	// of bigmap 1 and allocated bigmap 2
+	insert(model.SupplyTableKey, &model.Supply{Height: 11})
+	insert(model.BigmapValueTableKey, &model.BigmapValue{BigmapId: 1, KeyId: kid, Key: k1, Value: v2, Height: 11})
+	insert(model.BigmapUpdateTableKey, &model.BigmapUpdate{BigmapId: 1, KeyId: kid, Key: k1, Value: v2, Action: upd, Height: 11})
+	insert(model.BigmapAllocTableKey, &model.BigmapAlloc{BigmapId: 2, Height: 11})
+	insert(model.BigmapUpdateTableKey, &model.BigmapUpdate{BigmapId: 2, Action: micheline.DiffActionAlloc, Height: 11})
+
+	n, err := truncateIncompleteBlocks(ctx, indexes, tips)
+	if err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("truncate: expected 1 block, got %d", n)
+	}
+
+	for key, col := range blockTables {
+		tbl, ok := tables[key]
+		if !ok {
+			continue
+		}
+		h, err := maxHeightAbove(ctx, tbl, col, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h >= 0 {
+			t.Errorf("%s: expected no rows above tip, found height %d", key, h)
+		}
+		cnt, err := pack.NewQuery("test").WithTable(tbl).AndLte(col, 10).Count(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cnt != 1 {
+			t.Errorf("%s: expected 1 row at or below tip, got %d", key, cnt)
+		}
+	}
+
+	// the live key was restored, not deleted
+	val := &model.BigmapValue{}
+	err = pack.NewQuery("test").WithTable(tables[model.BigmapValueTableKey]).AndEqual("key_id", kid).Execute(ctx, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.Height != 5 || !bytes.Equal(val.Value, v1) {
+		t.Errorf("expected live key restored at height 5, got height %d value %x", val.Height, val.Value)
+	}
+
+	// recovered state is stable
+	if n, err := truncateIncompleteBlocks(ctx, indexes, tips); err != nil || n != 0 {
+		t.Errorf("second truncate: n=%d err=%v", n, err)
+	}
+}
+
+func TestTruncateIncompleteBlocksFails(t *testing.T) {
+	ctx := context.Background()
+
+	// more than one incomplete block requires a rebuild
+	indexes, tables, tips := newRecoveryTestIndexes(t)
+	for _, h := range []int64{10, 11, 12} {
+		if err := tables[model.SupplyTableKey].Insert(ctx, &model.Supply{Height: h}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := truncateIncompleteBlocks(ctx, indexes, tips); !errors.Is(err, index.ErrReindexRequired) {
+		t.Errorf("expected reindex required, got %v", err)
+	}
+
+	// rollbacks must not fail silently, here an update lost its alloc
+	indexes, tables, tips = newRecoveryTestIndexes(t)
+	if err := tables[model.BigmapUpdateTableKey].Insert(ctx, &model.BigmapUpdate{BigmapId: 3, KeyId: 3, Height: 11}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := truncateIncompleteBlocks(ctx, indexes, tips); err == nil {
+		t.Errorf("expected rollback error")
+	}
+}
+
+func TestNeedCheckpoint(t *testing.T) {
+	indexes, tables, _ := newRecoveryTestIndexes(t)
+	m := &Indexer{indexes: indexes}
+	m.flushCalls, _ = m.flushState()
+	if m.NeedCheckpoint() {
+		t.Fatal("unexpected checkpoint on empty tables")
+	}
+
+	// a journal filling up requires a flush before the table flushes alone
+	ctx := context.Background()
+	supply := tables[model.SupplyTableKey]
+	limit := supply.Stats()[0].JournalTuplesThreshold
+	rows := make([]pack.Item, limit/2+1)
+	for i := range rows {
+		rows[i] = &model.Supply{Height: int64(i + 1)}
+	}
+	if err := supply.Insert(ctx, rows); err != nil {
+		t.Fatal(err)
+	}
+	if !m.NeedCheckpoint() {
+		t.Error("expected checkpoint on half full journal")
+	}
+
+	// a table that flushed on its own requires storing tips
+	if err := supply.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !m.NeedCheckpoint() {
+		t.Error("expected checkpoint after table flush")
+	}
+	m.flushCalls, _ = m.flushState()
+	if m.NeedCheckpoint() {
+		t.Error("unexpected checkpoint after tips were stored")
+	}
+}
@@ -166,6 +166,11 @@ func (c *Crawler) reorganize(ctx context.Context, formerBest, newBest *model.Blo
 			"completed successfully.", tip.BestHash, tip.BestHeight)
 	}
 
+	// tell subscribers to drop orphaned blocks before new blocks arrive
+	if c.feed.Len() > 0 {
+		c.feed.Publish(NewRewindSummary(tip))
+	}
+
 	// setup builder for attaching
 	// on forward reorg use forkblock as initial parent
 	// when no block will be attached, this sets the correct parent block as well
@@ -257,6 +262,11 @@ func (c *Crawler) reorganize(ctx context.Context, formerBest, newBest *model.Blo
 		c.updateTip(newTip)
 		tip = newTip
 
+		// notify subscribers
+		if c.feed.Len() > 0 {
+			c.feed.Publish(NewBlockSummary(block, c.builder))
+		}
+
 		// cleanup and prepare for next block (forward attach keeps parent relation in builder)
 		c.builder.Clean()
 	}
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"time"
+
+	"blockwatch.cc/packdb/store"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+// ReplicaConfig configures a read replica which serves API calls from
+// databases written by a separate indexer process.
+type ReplicaConfig struct {
+	Interval  time.Duration               // chain tip polling interval
+	OpenState func() (store.DB, error)    // opens a new read-only state database handle
+	Indexes   func() []model.BlockIndexer // creates indexes for a new database generation
+	OnReload  func()                      // called after reload, e.g. to purge API caches
+}
+
+// RunReplica polls the chain tip stored by the writing indexer and reloads
+// all databases when it changes. Database files are memory-mapped on open
+// and table journals are read once, so changes made by another process are
+// invisible until the databases are opened again. Each reload opens a new
+// generation of databases together with the state database handle of the
+// poll, see Indexer.Acquire. Blocks until ctx is canceled.
+func (c *Crawler) RunReplica(ctx context.Context, cfg ReplicaConfig) {
+	log.Infof("Polling chain tip every %s.", cfg.Interval)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		db, err := cfg.OpenState()
+		if err != nil {
+			log.Errorf("Opening state database: %v", err)
+			continue
+		}
+		var tip *model.ChainTip
+		err = db.View(func(dbTx store.Tx) error {
+			tip, err = dbLoadChainTip(dbTx)
+			return err
+		})
+		if err != nil {
+			log.Errorf("Reading chain tip: %v", err)
+			db.Close()
+			continue
+		}
+		if cur := c.Tip(); cur.BestHeight == tip.BestHeight && cur.BestHash.Equal(tip.BestHash) {
+			db.Close()
+			continue
+		}
+
+		// on failure the current tip is kept and reload is retried next poll
+		if err := c.indexer.reload(ctx, db, cfg.Indexes(), tip); err != nil {
+			log.Errorf("Reloading databases at block %d: %v", tip.BestHeight, err)
+			db.Close()
+			continue
+		}
+		c.db = db
+		c.updateTip(tip)
+		if cfg.OnReload != nil {
+			cfg.OnReload()
+		}
+		log.Debugf("Reloaded databases at block %d.", tip.BestHeight)
+	}
+}
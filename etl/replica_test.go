@@ -0,0 +1,61 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"blockwatch.cc/packdb/store"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestReplicaGenerations(t *testing.T) {
+	dir := t.TempDir()
+	open := func(name string) store.DB {
+		t.Helper()
+		db, err := store.Create("bolt", filepath.Join(dir, name), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	isOpen := func(db store.DB) bool {
+		return db.View(func(store.Tx) error { return nil }) == nil
+	}
+	first, second := open("first.db"), open("second.db")
+	m := NewIndexer(IndexerConfig{DBPath: dir, StateDB: first, ReadOnly: true})
+
+	// a call started before reload keeps using the first generation
+	g1, release1 := m.Acquire()
+	if g1 != m {
+		t.Fatal("expected first generation")
+	}
+	ctx := context.Background()
+	if err := m.reload(ctx, second, nil, &model.ChainTip{Symbol: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	g2, release2 := m.Acquire()
+	if g2 == g1 || g2.statedb != second {
+		t.Fatal("expected second generation after reload")
+	}
+	if !isOpen(first) {
+		t.Fatal("first generation closed while in use")
+	}
+
+	// the first generation closes with its last call, the current one stays open
+	release1()
+	if isOpen(first) {
+		t.Error("first generation not closed after last call")
+	}
+	release2()
+	if !isOpen(second) {
+		t.Error("current generation closed")
+	}
+	m.Close()
+	if isOpen(second) {
+		t.Error("current generation not closed on shutdown")
+	}
+}
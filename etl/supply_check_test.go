@@ -0,0 +1,51 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package etl
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestSupplyInvariant(t *testing.T) {
+	s := &model.Supply{
+		Total:          1_000_000,
+		Unclaimed:      100_000,
+		FrozenDeposits: 50_000,
+		FrozenStake:    250_000,
+	}
+	balances := int64(600_000)
+
+	// balanced
+	for _, m := range []SupplyCheckMode{SupplyCheckLenient, SupplyCheckStrict} {
+		c := NewSupplyChecker(m)
+		if err := c.verify(1, s, balances); err != nil {
+			t.Errorf("%s: unexpected violation: %v", m, err)
+		}
+	}
+
+	// inject an imbalance (e.g. a missing burn flow)
+	before := supplyViolations.Value()
+	c := NewSupplyChecker(SupplyCheckStrict)
+	if err := c.verify(2, s, balances+42); err == nil {
+		t.Errorf("strict: expected violation for imbalanced supply")
+	}
+	c = NewSupplyChecker(SupplyCheckLenient)
+	c.balances = balances + 42
+	if err := c.verify(2, s, c.balances); err != nil {
+		t.Errorf("lenient: unexpected error %v", err)
+	}
+	if got := supplyViolations.Value() - before; got != 2 {
+		t.Errorf("expected 2 counted violations, got %d", got)
+	}
+
+	// lenient mode accepts the difference and only reports it once
+	if err := c.verify(3, s, c.balances); err != nil {
+		t.Errorf("lenient: unexpected error %v", err)
+	}
+	if got := supplyViolations.Value() - before; got != 2 {
+		t.Errorf("expected no repeated violation, got %d", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -40,6 +41,8 @@ type Client struct {
 	retryDelay time.Duration
 	// Api key
 	apiKey string
+	// Max response body size, 0 = unlimited
+	maxSize int64
 }
 
 func New() *Client {
@@ -52,7 +55,8 @@ func New() *Client {
 			config.GetInt("meta.http.max_retries"),
 			config.GetDuration("meta.http.retry_delay"),
 		).
-		WithApiKey(config.GetString("meta.http.api_key"))
+		WithApiKey(config.GetString("meta.http.api_key")).
+		WithMaxResponseSize(config.GetInt64("meta.http.max_response_size"))
 }
 
 func (c *Client) Connect(base string) error {
@@ -93,6 +97,13 @@ func (c *Client) WithUserAgent(s string) *Client {
 	return c
 }
 
+// WithMaxResponseSize limits the size of response bodies. Larger responses
+// fail with a permanent error.
+func (c *Client) WithMaxResponseSize(n int64) *Client {
+	c.maxSize = n
+	return c
+}
+
 func (c *Client) WithRetry(num int, delay time.Duration) *Client {
 	c.numRetries = num
 	if num < 0 {
@@ -206,8 +217,18 @@ func (c *Client) NewRawResponseDecoder(v *bytes.Buffer) ResponseHandler {
 		if v == nil {
 			v = new(bytes.Buffer)
 		}
-		_, err := io.Copy(v, resp.Body)
-		return err
+		if c.maxSize <= 0 {
+			_, err := io.Copy(v, resp.Body)
+			return err
+		}
+		n, err := io.Copy(v, io.LimitReader(resp.Body, c.maxSize+1))
+		if err != nil {
+			return err
+		}
+		if n > c.maxSize {
+			return WrapError(fmt.Errorf("response larger than %d bytes", c.maxSize), ErrPermanent)
+		}
+		return nil
 	}
 }
 
@@ -227,7 +248,7 @@ func (c *Client) Do(req *http.Request, fn ResponseHandler) error {
 			err = handleError(resp)
 			resp.Body.Close()
 			resp = nil
-		} else if !IsNetError(err) {
+		} else if !IsNetError(err) || errors.Is(err, ErrPermanent) {
 			return err
 		}
 		select {
@@ -262,6 +283,8 @@ func (c *Client) Do(req *http.Request, fn ResponseHandler) error {
 	if statusClass == 2 {
 		err = fn(req.Context(), resp)
 		if err != nil {
+			// don't read the rest of oversized responses
+			mustClear = !errors.Is(err, ErrPermanent)
 			return err
 		}
 		mustClear = false
@@ -0,0 +1,36 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 1024)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	c := New().WithRetry(0, time.Second).WithMaxResponseSize(1024)
+	buf, err := c.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != len(body) {
+		t.Errorf("expected %d bytes, got %d", len(body), len(buf))
+	}
+
+	c.WithMaxResponseSize(1023)
+	if _, err := c.Get(context.Background(), srv.URL); !errors.Is(err, ErrPermanent) {
+		t.Errorf("expected permanent error, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	for _, v := range []struct {
+		ip     string
+		public bool
+	}{
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+	} {
+		if got := IsPublicAddr(netip.MustParseAddr(v.ip)); got != v.public {
+			t.Errorf("%s: expected public=%t, got %t", v.ip, v.public, got)
+		}
+	}
+}
+
+func TestPublicHttpClient(t *testing.T) {
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	c := New().
+		WithHttpClient(NewPublicHttpClient(time.Second)).
+		WithRetry(3, time.Second).
+		WithApiKey("")
+	start := time.Now()
+	_, err := c.Get(context.Background(), srv.URL)
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected permanent error, got %v", err)
+	}
+	if called {
+		t.Errorf("request reached loopback server")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("blocked request was retried")
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,7 +35,11 @@ type Scheduler struct {
 	taskq         chan struct{}
 	taskLimiter   *time.Ticker
 	table         *pack.Table
-	client        *client.Client
+	client        *client.Client // configured metadata services, sends the api key
+	web           *client.Client // untrusted urls, keyless and public hosts only
+	ipfs          *client.Client
+	gateways      []string
+	trusted       []string // scheme and host of configured metadata services
 }
 
 func NewScheduler() *Scheduler {
@@ -50,6 +57,23 @@ func NewScheduler() *Scheduler {
 		taskLimiter:   time.NewTicker(time.Second / time.Duration(rateLimit)),
 		retryInterval: config.GetDuration("meta.http.retry_interval"),
 		client:        client.New(),
+		// gateways are third-party services, don't leak the api key
+		ipfs: client.New().
+			WithHttpClient(&http.Client{Timeout: config.GetDuration("meta.ipfs.timeout")}).
+			WithRetry(config.GetInt("meta.ipfs.max_retries"), config.GetDuration("meta.ipfs.retry_delay")).
+			WithApiKey(""),
+		// off-chain urls are read from chain, don't leak the api key and
+		// don't let them reach internal services
+		web: client.New().
+			WithHttpClient(client.NewPublicHttpClient(config.GetDuration("meta.ipfs.timeout"))).
+			WithRetry(config.GetInt("meta.ipfs.max_retries"), config.GetDuration("meta.ipfs.retry_delay")).
+			WithApiKey(""),
+		gateways: config.GetStringSlice("meta.ipfs.gateways"),
+	}
+	for _, key := range []string{"meta.token.url", "meta.kepler.url"} {
+		if origin := urlOrigin(config.GetString(key)); origin != "" {
+			s.trusted = append(s.trusted, origin)
+		}
 	}
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 	for i := maxTasks; i > 0; i-- {
@@ -71,11 +95,15 @@ func (s *Scheduler) WithCallback(cb TaskCompletionCallback) *Scheduler {
 func (s *Scheduler) SetLogLevel(lvl log.Level) {
 	s.log.SetLevel(lvl)
 	s.client.SetLogLevel(lvl)
+	s.web.SetLogLevel(lvl)
+	s.ipfs.SetLogLevel(lvl)
 }
 
 func (s *Scheduler) WithLogger(logger log.Logger) *Scheduler {
 	s.log = logger
 	s.client.WithLogger(logger)
+	s.web.WithLogger(logger)
+	s.ipfs.WithLogger(logger)
 	return s
 }
 
@@ -277,7 +305,7 @@ func (s *Scheduler) runLoop() {
 
 func (s *Scheduler) fetch(r TaskRequest) TaskRequest {
 	s.log.Debugf("T_%d %s fetch: %s", r.Id, r.Owner, r.Url)
-	buf, err := s.client.Get(s.ctx, r.Url)
+	buf, err := s.get(r.Url)
 	if err != nil {
 		s.log.Warnf("T_%d %s fetch: %v", r.Id, r.Owner, err)
 	}
@@ -297,6 +325,55 @@ func (s *Scheduler) fetch(r TaskRequest) TaskRequest {
 	return r
 }
 
+// get fetches url. IPFS urls are resolved through the configured gateways
+// which are tried in order until one succeeds. Only urls of configured
+// metadata services are fetched with the api key, all other urls are
+// untrusted.
+func (s *Scheduler) get(url string) ([]byte, error) {
+	path, ok := strings.CutPrefix(url, "ipfs://")
+	if !ok {
+		if s.isTrusted(url) {
+			return s.client.Get(s.ctx, url)
+		}
+		return s.web.Get(s.ctx, url)
+	}
+	if len(s.gateways) == 0 {
+		return nil, fmt.Errorf("%w: no ipfs gateway configured", client.ErrPermanent)
+	}
+	var err error
+	for _, gw := range s.gateways {
+		var buf []byte
+		buf, err = s.ipfs.Get(s.ctx, strings.TrimSuffix(gw, "/")+"/"+path)
+		if err == nil {
+			return buf, nil
+		}
+		if errors.Is(err, context.Canceled) {
+			break
+		}
+		s.log.Debugf("ipfs gateway %s: %v", gw, err)
+	}
+	return nil, err
+}
+
+func (s *Scheduler) isTrusted(u string) bool {
+	origin := urlOrigin(u)
+	for _, v := range s.trusted {
+		if origin == v {
+			return true
+		}
+	}
+	return false
+}
+
+// urlOrigin returns scheme and host of u or an empty string.
+func urlOrigin(u string) string {
+	p, err := url.Parse(u)
+	if err != nil || p.Host == "" {
+		return ""
+	}
+	return strings.ToLower(p.Scheme + "://" + p.Host)
+}
+
 func (s *Scheduler) tryDeliver(r TaskRequest) error {
 	if r.Ordered {
 		// ensure serial consistency with other requests, deliver results in-order
@@ -7,8 +7,31 @@ import (
 	"fmt"
 
 	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
 )
 
+// EmbeddedAddressWalker returns a micheline walk function that calls add
+// for each address embedded in a primitive as string or binary.
+func EmbeddedAddressWalker(add func(mavryk.Address)) func(micheline.Prim) error {
+	return func(p micheline.Prim) error {
+		switch {
+		case len(p.String) == 36 || len(p.String) == 37:
+			if a, err := mavryk.ParseAddress(p.String); err == nil {
+				add(a)
+			}
+			return micheline.PrimSkip
+		case mavryk.IsAddressBytes(p.Bytes):
+			a := mavryk.Address{}
+			if err := a.Decode(p.Bytes); err == nil {
+				add(a)
+			}
+			return micheline.PrimSkip
+		default:
+			return nil
+		}
+	}
+}
+
 func (b *Block) CollectAddresses(addUnique func(mavryk.Address)) error {
 	// collect from block-level balance updates if invoice is found
 	if inv, ok := b.Invoices(); ok {
@@ -125,6 +148,7 @@ func (b *Block) CollectAddresses(addUnique func(mavryk.Address)) error {
 
 				case *UpdateConsensusKey:
 					addUnique(tx.Source)
+					addUnique(tx.Pk.Address())
 
 				case *DrainDelegate:
 					addUnique(tx.ConsensusKey)
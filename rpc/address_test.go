@@ -0,0 +1,27 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package rpc
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+func TestEmbeddedAddressWalker(t *testing.T) {
+	kt1 := mavryk.MustParseAddress("KT1QuofAgnsWffHzLA7D78rxytJruGHDe7XG")
+	mv1 := mavryk.MustParseAddress("mv1V4h45W3p4e1sjSBvRkK2uYbvkTnSuHg8g")
+	prim := micheline.NewPair(
+		micheline.NewString(mv1.String()),
+		micheline.NewSeq(micheline.NewBytes(kt1.EncodePadded()), micheline.NewString("not an address")),
+	)
+	found := make([]mavryk.Address, 0)
+	_ = prim.Walk(EmbeddedAddressWalker(func(a mavryk.Address) {
+		found = append(found, a)
+	}))
+	if len(found) != 2 || !found[0].Equal(mv1) || !found[1].Equal(kt1) {
+		t.Errorf("unexpected addresses %v", found)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package rpc
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the node while the circuit
+// breaker is open after too many consecutive failed requests.
+var ErrCircuitOpen = errors.New("rpc: circuit open, node unavailable")
+
+var rpcStats = expvar.NewMap("rpc")
+
+type CircuitState byte
+
+const (
+	CircuitClosed   CircuitState = iota // normal operation
+	CircuitOpen                         // fail fast, node considered down
+	CircuitHalfOpen                     // probing node with a single request
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "invalid"
+	}
+}
+
+func (s CircuitState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Health reports the node connection state as seen by the circuit breaker.
+type Health struct {
+	State     CircuitState `json:"state"`
+	Failures  int          `json:"failures"`             // consecutive failed requests
+	LastError string       `json:"last_error,omitempty"` // most recent failure
+	OpenSince *time.Time   `json:"open_since,omitempty"`
+}
+
+func (h Health) IsHealthy() bool {
+	return h.State == CircuitClosed
+}
+
+// breaker opens after threshold consecutive failed requests and rejects
+// requests until timeout has passed. Then a single probe request is allowed
+// which either closes the circuit on success or re-opens it on failure.
+// A zero threshold disables the breaker.
+type breaker struct {
+	sync.Mutex
+	threshold int
+	timeout   time.Duration
+	state     CircuitState
+	failures  int
+	lastErr   error
+	openSince time.Time
+	probing   bool
+}
+
+// allow reports whether a request may be sent. Probe is true for the single
+// request admitted in half-open state, which must be settled by success,
+// failure or release.
+func (b *breaker) allow() (ok, probe bool) {
+	if b.threshold <= 0 {
+		return true, false
+	}
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openSince) < b.timeout {
+			return false, false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true, true
+	case CircuitHalfOpen:
+		// only one probe at a time
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// release returns a probe that ended without a node response, e.g. when the
+// caller cancelled the request, so the next request probes again.
+func (b *breaker) release() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *breaker) success() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.state != CircuitClosed {
+		log.Infof("rpc: node recovered after %d failures, closing circuit", b.failures)
+	}
+	b.state = CircuitClosed
+	b.failures = 0
+	b.lastErr = nil
+	b.probing = false
+}
+
+func (b *breaker) failure(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.failures++
+	b.lastErr = err
+	b.probing = false
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.threshold) {
+		if b.state == CircuitClosed {
+			log.Errorf("rpc: %d consecutive failures, opening circuit for %s: %v", b.failures, b.timeout, err)
+		}
+		b.state = CircuitOpen
+		b.openSince = time.Now().UTC()
+		rpcStats.Add("circuit_open", 1)
+	}
+}
+
+func (b *breaker) health() Health {
+	b.Lock()
+	defer b.Unlock()
+	h := Health{
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.lastErr != nil {
+		h.LastError = b.lastErr.Error()
+	}
+	if b.state != CircuitClosed {
+		tm := b.openSince
+		h.OpenSince = &tm
+	}
+	return h
+}
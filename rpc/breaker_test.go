@@ -0,0 +1,93 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const (
+		statusOK = iota
+		statusDown
+		statusHang
+	)
+	var mode atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch mode.Load() {
+		case statusDown:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case statusHang:
+			<-r.Context().Done()
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer srv.Close()
+
+	const timeout = 20 * time.Millisecond
+	c, err := NewClient(srv.URL, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.WithRetry(0, 0).WithCircuitBreaker(2, timeout)
+
+	ctx := context.Background()
+	get := func(ctx context.Context) error {
+		var v map[string]any
+		return c.Get(ctx, "x", &v)
+	}
+	expect := func(step string, state CircuitState) {
+		t.Helper()
+		if h := c.Health(); h.State != state {
+			t.Fatalf("%s: expected %s circuit, got %s", step, state, h.State)
+		}
+	}
+
+	// closed: failures below threshold keep the circuit closed
+	mode.Store(statusDown)
+	if err := get(ctx); err == nil {
+		t.Fatal("expected error on 503")
+	}
+	expect("first failure", CircuitClosed)
+
+	// open: threshold reached, requests fail fast
+	_ = get(ctx)
+	expect("second failure", CircuitOpen)
+	if err := get(ctx); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	// half-open: a failed probe re-opens the circuit
+	time.Sleep(timeout)
+	_ = get(ctx)
+	expect("failed probe", CircuitOpen)
+
+	// half-open: a cancelled probe is released and the next request probes
+	time.Sleep(timeout)
+	mode.Store(statusHang)
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	_ = get(cctx)
+	cancel()
+	expect("cancelled probe", CircuitHalfOpen)
+	if ok, _ := c.breaker.allow(); !ok {
+		t.Fatal("cancelled probe left the circuit blocked")
+	}
+	c.breaker.release()
+
+	// closed: a successful probe closes the circuit
+	mode.Store(statusOK)
+	if err := get(ctx); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	expect("successful probe", CircuitClosed)
+	if h := c.Health(); h.Failures != 0 {
+		t.Errorf("expected failures reset, got %d", h.Failures)
+	}
+}
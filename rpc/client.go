@@ -42,6 +42,10 @@ type Client struct {
 	numRetries int
 	// Time between retries
 	retryDelay time.Duration
+	// Upper bound for exponential backoff, zero uses a constant delay
+	maxRetryDelay time.Duration
+	// Fail fast when the node is down
+	breaker breaker
 }
 
 // NewClient returns a new Tezos RPC client.
@@ -114,6 +118,26 @@ func (c *Client) WithRetry(num int, delay time.Duration) *Client {
 	return c
 }
 
+// WithBackoff doubles the retry delay after each failed attempt up to max.
+func (c *Client) WithBackoff(max time.Duration) *Client {
+	c.maxRetryDelay = max
+	return c
+}
+
+// WithCircuitBreaker makes requests fail fast with ErrCircuitOpen after
+// threshold consecutive failed requests until timeout has passed.
+// A zero threshold disables the circuit breaker.
+func (c *Client) WithCircuitBreaker(threshold int, timeout time.Duration) *Client {
+	c.breaker.threshold = threshold
+	c.breaker.timeout = timeout
+	return c
+}
+
+// Health returns the node connection state.
+func (c *Client) Health() Health {
+	return c.breaker.health()
+}
+
 func (c *Client) ResolveChainConfig(ctx context.Context) error {
 	id, err := c.GetChainId(ctx)
 	if err != nil {
@@ -226,11 +250,36 @@ func (c *Client) handleResponseMonitor(ctx context.Context, resp *http.Response,
 
 // Do retrieves values from the API and marshals them into the provided interface.
 func (c *Client) Do(req *http.Request, v interface{}) error {
+	ok, probe := c.breaker.allow()
+	if !ok {
+		return ErrCircuitOpen
+	}
 	var (
-		resp *http.Response
-		err  error
+		resp    *http.Response
+		err     error
+		nodeErr error
+		delay   = c.retryDelay
 	)
-	for retries := c.numRetries + 1; retries > 0; retries-- {
+	// settle the breaker on every exit, requests that end without a node
+	// response (cancelled or not sent) only return a half-open probe
+	defer func() {
+		switch {
+		case nodeErr != nil:
+			rpcStats.Add("failures", 1)
+			c.breaker.failure(nodeErr)
+		case resp != nil:
+			c.breaker.success()
+		case probe:
+			c.breaker.release()
+		}
+	}()
+
+	// only idempotent requests are safe to retry
+	numRetries := c.numRetries
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		numRetries = 0
+	}
+	for retries := numRetries + 1; retries > 0; retries-- {
 		resp, err = c.client.Do(req)
 		if err == nil && resp != nil && resp.StatusCode <= 500 {
 			break
@@ -240,20 +289,33 @@ func (c *Client) Do(req *http.Request, v interface{}) error {
 			log.Warnf("rpc: %T %v", err, err)
 			return err
 		}
-		if resp != nil && retries > 1 {
+		if retries == 1 {
+			break
+		}
+		if resp != nil {
 			resp.Body.Close()
 			resp = nil
 		}
+		rpcStats.Add("retries", 1)
 		select {
 		case <-req.Context().Done():
 			return req.Context().Err()
-		case <-time.After(c.retryDelay):
+		case <-time.After(delay):
 			// continue
 		}
+		if c.maxRetryDelay > 0 {
+			delay = min(2*delay, c.maxRetryDelay)
+		}
 	}
 	if err != nil {
+		if req.Context().Err() == nil {
+			nodeErr = err
+		}
 		return err
 	}
+	if resp.StatusCode > 500 {
+		nodeErr = fmt.Errorf("rpc: %s", resp.Status)
+	}
 
 	mustClear := true
 	defer func() {
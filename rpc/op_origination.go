@@ -49,23 +49,7 @@ func (o Origination) AddEmbeddedAddresses(add func(mavryk.Address)) {
 	if o.Script == nil || !o.Script.Storage.IsValid() {
 		return
 	}
-	collect := func(p micheline.Prim) error {
-		switch {
-		case len(p.String) == 36 || len(p.String) == 37:
-			if a, err := mavryk.ParseAddress(p.String); err == nil {
-				add(a)
-			}
-			return micheline.PrimSkip
-		case mavryk.IsAddressBytes(p.Bytes):
-			a := mavryk.Address{}
-			if err := a.Decode(p.Bytes); err == nil {
-				add(a)
-			}
-			return micheline.PrimSkip
-		default:
-			return nil
-		}
-	}
+	collect := EmbeddedAddressWalker(add)
 
 	// from storage
 	_ = o.Script.Storage.Walk(collect)
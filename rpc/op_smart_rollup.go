@@ -279,6 +279,12 @@ func (o SmartRollupExecuteOutboxMessage) Addresses(set *mavryk.AddressSet) {
 	set.AddUnique(o.Rollup)
 }
 
+// TicketUpdates returns the ticket receipt of this operation completed with
+// the rollup's debit, see RollupWithdrawal.
+func (o SmartRollupExecuteOutboxMessage) TicketUpdates() []TicketUpdate {
+	return RollupWithdrawal(o.Rollup, o.Metadata.Result.TicketUpdates())
+}
+
 func (o SmartRollupExecuteOutboxMessage) Encode() []byte {
 	type alias struct {
 		CementedCommitment mavryk.SmartRollupCommitHash `json:"cemented_commitment"`
@@ -34,23 +34,7 @@ func (t Transaction) AddEmbeddedAddresses(addUnique func(mavryk.Address)) {
 	if !t.Destination.IsContract() {
 		return
 	}
-	collect := func(p micheline.Prim) error {
-		switch {
-		case len(p.String) == 36 || len(p.String) == 37:
-			if a, err := mavryk.ParseAddress(p.String); err == nil {
-				addUnique(a)
-			}
-			return micheline.PrimSkip
-		case mavryk.IsAddressBytes(p.Bytes):
-			a := mavryk.Address{}
-			if err := a.Decode(p.Bytes); err == nil {
-				addUnique(a)
-			}
-			return micheline.PrimSkip
-		default:
-			return nil
-		}
-	}
+	collect := EmbeddedAddressWalker(addUnique)
 
 	// from params
 	_ = t.Parameters.Value.Walk(collect)
@@ -137,6 +121,16 @@ type InternalResult struct {
 	Tag         string               `json:"tag"`            // event
 }
 
+// TicketUpdates returns the ticket receipt of this internal operation.
+// Ticket deposits into a rollup are completed with the rollup's credit,
+// see RollupInternalDeposit.
+func (r InternalResult) TicketUpdates() []TicketUpdate {
+	if r.Kind != mavryk.OpTypeTransaction {
+		return r.Result.TicketUpdates()
+	}
+	return RollupInternalDeposit(r.Destination, r.Result.TicketUpdates())
+}
+
 // found in block metadata from v010+
 type ImplicitResult struct {
 	Kind                mavryk.OpType     `json:"kind"`
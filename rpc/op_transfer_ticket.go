@@ -69,23 +69,7 @@ func (t TransferTicket) AddEmbeddedAddresses(addUnique func(mavryk.Address)) {
 	if !t.Destination.IsContract() {
 		return
 	}
-	collect := func(p micheline.Prim) error {
-		switch {
-		case len(p.String) == 36 || len(p.String) == 37:
-			if a, err := mavryk.ParseAddress(p.String); err == nil {
-				addUnique(a)
-			}
-			return micheline.PrimSkip
-		case mavryk.IsAddressBytes(p.Bytes):
-			a := mavryk.Address{}
-			if err := a.Decode(p.Bytes); err == nil {
-				addUnique(a)
-			}
-			return micheline.PrimSkip
-		default:
-			return nil
-		}
-	}
+	collect := EmbeddedAddressWalker(addUnique)
 
 	// from storage
 	_ = t.Metadata.Result.Storage.Walk(collect)
@@ -127,3 +111,136 @@ func (t TransferTicket) AddEmbeddedAddresses(addUnique func(mavryk.Address)) {
 		}
 	}
 }
+
+// Ticket returns the ticket transferred by this operation.
+func (t TransferTicket) Ticket() Ticket {
+	return Ticket{
+		Ticketer: t.Ticketer,
+		Type:     t.Type,
+		Content:  t.Contents,
+	}
+}
+
+// RollupDeposit returns the balance update that credits a rollup destination
+// with the deposited ticket amount. Rollups keep deposited tickets in their
+// own state, so receipts only contain the sender's debit. For regular
+// contracts the receipt already credits the receiver and ok is false.
+func (t TransferTicket) RollupDeposit() (TicketUpdate, bool) {
+	if !t.Destination.IsRollup() || !t.Result().IsSuccess() || t.Amount.IsZero() {
+		return TicketUpdate{}, false
+	}
+	return TicketUpdate{
+		Ticket: t.Ticket(),
+		Updates: []TicketBalanceUpdate{{
+			Account: t.Destination,
+			Amount:  t.Amount,
+		}},
+	}, true
+}
+
+// TicketUpdates returns the ticket receipt of this operation. Deposits into
+// a rollup are completed with the rollup's credit unless the receipt
+// already contains it, so that deposits appear as transfers from the sender
+// to the rollup rather than burns.
+func (t TransferTicket) TicketUpdates() []TicketUpdate {
+	receipt := t.Metadata.Result.TicketUpdates()
+	dep, ok := t.RollupDeposit()
+	if !ok {
+		return receipt
+	}
+	var (
+		key   = dep.Ticket.Hash64()
+		found bool
+		list  = make([]TicketUpdate, 0, len(receipt)+1)
+	)
+	for _, v := range receipt {
+		if !found && v.Ticket.Hash64() == key {
+			found = true
+			if !hasTicketCredit(v.Updates, t.Destination) {
+				upd := make([]TicketBalanceUpdate, 0, len(v.Updates)+1)
+				v.Updates = append(append(upd, v.Updates...), dep.Updates...)
+			}
+		}
+		list = append(list, v)
+	}
+	if !found {
+		list = append(list, dep)
+	}
+	return list
+}
+
+// RollupWithdrawal completes the ticket receipt of an outbox message executed
+// for rollup with the rollup's debit. Rollups keep tickets in their own
+// state, so receipts only credit the receivers. For each ticket without a
+// rollup debit, the rollup is debited with the sum of all credits, so that
+// withdrawals appear as transfers from the rollup rather than mints.
+func RollupWithdrawal(rollup mavryk.Address, receipt []TicketUpdate) []TicketUpdate {
+	if !rollup.IsRollup() {
+		return receipt
+	}
+	list := make([]TicketUpdate, 0, len(receipt))
+	for _, v := range receipt {
+		if !hasTicketDebit(v.Updates, rollup) {
+			var sum mavryk.Z
+			for _, u := range v.Updates {
+				if !u.Account.Equal(rollup) && !u.Amount.IsNeg() {
+					sum = sum.Add(u.Amount)
+				}
+			}
+			if !sum.IsZero() {
+				upd := make([]TicketBalanceUpdate, 0, len(v.Updates)+1)
+				upd = append(upd, TicketBalanceUpdate{Account: rollup, Amount: sum.Neg()})
+				v.Updates = append(upd, v.Updates...)
+			}
+		}
+		list = append(list, v)
+	}
+	return list
+}
+
+// RollupInternalDeposit completes the ticket receipt of an internal
+// transaction to rollup with the rollup's credit. Contracts deposit tickets
+// into rollups by calling them, and receipts only debit the sending
+// contract. For each ticket without a rollup credit, the rollup is credited
+// with the sum of all debits, so that deposits appear as transfers to the
+// rollup rather than burns.
+func RollupInternalDeposit(rollup mavryk.Address, receipt []TicketUpdate) []TicketUpdate {
+	if !rollup.IsRollup() {
+		return receipt
+	}
+	list := make([]TicketUpdate, 0, len(receipt))
+	for _, v := range receipt {
+		if !hasTicketCredit(v.Updates, rollup) {
+			var sum mavryk.Z
+			for _, u := range v.Updates {
+				if !u.Account.Equal(rollup) && u.Amount.IsNeg() {
+					sum = sum.Add(u.Amount.Neg())
+				}
+			}
+			if !sum.IsZero() {
+				upd := make([]TicketBalanceUpdate, 0, len(v.Updates)+1)
+				v.Updates = append(append(upd, v.Updates...), TicketBalanceUpdate{Account: rollup, Amount: sum})
+			}
+		}
+		list = append(list, v)
+	}
+	return list
+}
+
+func hasTicketDebit(updates []TicketBalanceUpdate, addr mavryk.Address) bool {
+	for _, v := range updates {
+		if v.Account.Equal(addr) && v.Amount.IsNeg() {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTicketCredit(updates []TicketBalanceUpdate, addr mavryk.Address) bool {
+	for _, v := range updates {
+		if v.Account.Equal(addr) && !v.Amount.IsNeg() && !v.Amount.IsZero() {
+			return true
+		}
+	}
+	return false
+}
@@ -21,3 +21,12 @@ func (t UpdateConsensusKey) Costs() mavryk.Costs {
 		GasUsed: t.Metadata.Result.Gas(),
 	}
 }
+
+// Addresses adds all addresses used in this operation to the set.
+// Implements TypedOperation interface.
+func (t UpdateConsensusKey) Addresses(set *mavryk.AddressSet) {
+	set.AddUnique(t.Source)
+	if t.Pk.IsValid() {
+		set.AddUnique(t.Pk.Address())
+	}
+}
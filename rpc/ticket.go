@@ -49,3 +49,42 @@ func (u TicketUpdate) Prim() m.Prim {
 	}
 	return p
 }
+
+// NetTicketUpdates combines balance updates of the same ticket and account
+// into a single signed delta. Tickets and accounts keep the order of their
+// first appearance, accounts with a zero net delta are dropped.
+func NetTicketUpdates(lists ...[]TicketUpdate) []TicketUpdate {
+	res := make([]TicketUpdate, 0)
+	pos := make(map[uint64]int)
+	for _, list := range lists {
+		for _, u := range list {
+			key := u.Ticket.Hash64()
+			i, ok := pos[key]
+			if !ok {
+				i = len(res)
+				pos[key] = i
+				res = append(res, TicketUpdate{Ticket: u.Ticket})
+			}
+		next:
+			for _, v := range u.Updates {
+				for j := range res[i].Updates {
+					if res[i].Updates[j].Account.Equal(v.Account) {
+						res[i].Updates[j].Amount = res[i].Updates[j].Amount.Add(v.Amount)
+						continue next
+					}
+				}
+				res[i].Updates = append(res[i].Updates, v)
+			}
+		}
+	}
+	for i := range res {
+		upd := res[i].Updates[:0]
+		for _, v := range res[i].Updates {
+			if !v.Amount.IsZero() {
+				upd = append(upd, v)
+			}
+		}
+		res[i].Updates = upd
+	}
+	return res
+}
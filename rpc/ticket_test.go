@@ -0,0 +1,238 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package rpc
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+)
+
+func TestNetTicketUpdates(t *testing.T) {
+	addr := func(typ mavryk.AddressType, n byte) mavryk.Address {
+		hash := make([]byte, 20)
+		hash[19] = n
+		return mavryk.NewAddress(typ, hash)
+	}
+	var (
+		sender   = addr(mavryk.AddressTypeEd25519, 1)
+		splitter = addr(mavryk.AddressTypeContract, 2)
+		alice    = addr(mavryk.AddressTypeEd25519, 3)
+		bob      = addr(mavryk.AddressTypeEd25519, 4)
+		ticket   = Ticket{
+			Ticketer: addr(mavryk.AddressTypeContract, 9),
+			Type:     micheline.NewPrim(micheline.T_STRING),
+			Content:  micheline.NewString("coin"),
+		}
+	)
+	upd := func(a mavryk.Address, n int64) TicketBalanceUpdate {
+		return TicketBalanceUpdate{Account: a, Amount: mavryk.NewZ(n)}
+	}
+
+	// sender transfers 10 to a splitter contract which forwards 6 to alice
+	// and 4 to bob, the receipt lists the splitter three times
+	var op TransferTicket
+	op.Metadata = &OperationMetadata{}
+	op.Metadata.Result.Status = mavryk.OpStatusApplied
+	op.Metadata.Result.TicketUpdatesCorrect = []TicketUpdate{{
+		Ticket: ticket,
+		Updates: []TicketBalanceUpdate{
+			upd(sender, -10), upd(splitter, 10),
+			upd(splitter, -6), upd(alice, 6),
+			upd(splitter, -4), upd(bob, 4),
+		},
+	}}
+	op.Destination = splitter
+
+	// the splitter's forwarded amount nets out
+	deltas := NetTicketUpdates(op.TicketUpdates())
+	if len(deltas) != 1 {
+		t.Fatalf("got %d tickets, want 1", len(deltas))
+	}
+	want := []TicketBalanceUpdate{upd(sender, -10), upd(alice, 6), upd(bob, 4)}
+	got := deltas[0].Updates
+	if len(got) != len(want) {
+		t.Fatalf("got %d deltas, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Account.Equal(want[i].Account) || !got[i].Amount.Equal(want[i].Amount) {
+			t.Errorf("delta %d: got %s %s, want %s %s", i,
+				got[i].Account, got[i].Amount, want[i].Account, want[i].Amount)
+		}
+	}
+}
+
+func TestTransferTicketRollupDeposit(t *testing.T) {
+	addr := func(typ mavryk.AddressType, n byte) mavryk.Address {
+		hash := make([]byte, 20)
+		hash[19] = n
+		return mavryk.NewAddress(typ, hash)
+	}
+	var (
+		sender = addr(mavryk.AddressTypeEd25519, 1)
+		rollup = addr(mavryk.AddressTypeSmartRollup, 2)
+		ticket = Ticket{
+			Ticketer: addr(mavryk.AddressTypeContract, 9),
+			Type:     micheline.NewPrim(micheline.T_STRING),
+			Content:  micheline.NewString("coin"),
+		}
+	)
+	newOp := func(dst mavryk.Address) TransferTicket {
+		var op TransferTicket
+		op.Metadata = &OperationMetadata{}
+		op.Metadata.Result.Status = mavryk.OpStatusApplied
+		op.Metadata.Result.TicketUpdatesCorrect = []TicketUpdate{{
+			Ticket:  ticket,
+			Updates: []TicketBalanceUpdate{{Account: sender, Amount: mavryk.NewZ(-5)}},
+		}}
+		op.Destination = dst
+		op.Ticketer = ticket.Ticketer
+		op.Type = ticket.Type
+		op.Contents = ticket.Content
+		op.Amount = mavryk.NewZ(5)
+		return op
+	}
+
+	// deposit into a rollup credits the rollup
+	op := newOp(rollup)
+	list := op.TicketUpdates()
+	if len(list) != 1 || len(list[0].Updates) != 2 {
+		t.Fatalf("got %v, want sender debit and rollup credit", list)
+	}
+	if got := list[0].Updates[1]; !got.Account.Equal(rollup) || !got.Amount.Equal(mavryk.NewZ(5)) {
+		t.Errorf("got credit %s %s, want %s 5", got.Account, got.Amount, rollup)
+	}
+	if n := len(op.Metadata.Result.TicketUpdatesCorrect[0].Updates); n != 1 {
+		t.Errorf("receipt was modified, got %d updates", n)
+	}
+
+	// receipts that already credit the rollup are kept
+	op.Metadata.Result.TicketUpdatesCorrect = list
+	if got := op.TicketUpdates(); len(got[0].Updates) != 2 {
+		t.Errorf("rollup credited twice: %v", got)
+	}
+
+	// regular contracts are credited by the receipt
+	op = newOp(addr(mavryk.AddressTypeContract, 3))
+	if _, ok := op.RollupDeposit(); ok {
+		t.Errorf("unexpected rollup deposit for contract destination")
+	}
+	if got := op.TicketUpdates(); len(got[0].Updates) != 1 {
+		t.Errorf("unexpected updates for contract destination: %v", got)
+	}
+}
+
+func TestRollupWithdrawal(t *testing.T) {
+	addr := func(typ mavryk.AddressType, n byte) mavryk.Address {
+		hash := make([]byte, 20)
+		hash[19] = n
+		return mavryk.NewAddress(typ, hash)
+	}
+	var (
+		rollup = addr(mavryk.AddressTypeSmartRollup, 1)
+		alice  = addr(mavryk.AddressTypeContract, 2)
+		bob    = addr(mavryk.AddressTypeContract, 3)
+		ticket = Ticket{
+			Ticketer: addr(mavryk.AddressTypeContract, 9),
+			Type:     micheline.NewPrim(micheline.T_STRING),
+			Content:  micheline.NewString("coin"),
+		}
+	)
+	var op SmartRollupExecuteOutboxMessage
+	op.Rollup = rollup
+	op.Metadata = &OperationMetadata{}
+	op.Metadata.Result.Status = mavryk.OpStatusApplied
+	op.Metadata.Result.TicketUpdatesCorrect = []TicketUpdate{{
+		Ticket: ticket,
+		Updates: []TicketBalanceUpdate{
+			{Account: alice, Amount: mavryk.NewZ(3)},
+			{Account: bob, Amount: mavryk.NewZ(4)},
+		},
+	}}
+
+	// outbox receipts debit the rollup with all credits
+	list := op.TicketUpdates()
+	if len(list) != 1 || len(list[0].Updates) != 3 {
+		t.Fatalf("got %v, want rollup debit and two credits", list)
+	}
+	if got := list[0].Updates[0]; !got.Account.Equal(rollup) || !got.Amount.Equal(mavryk.NewZ(-7)) {
+		t.Errorf("got debit %s %s, want %s -7", got.Account, got.Amount, rollup)
+	}
+	if n := len(op.Metadata.Result.TicketUpdatesCorrect[0].Updates); n != 2 {
+		t.Errorf("receipt was modified, got %d updates", n)
+	}
+
+	// receipts that already debit the rollup are kept
+	op.Metadata.Result.TicketUpdatesCorrect = list
+	if got := op.TicketUpdates(); len(got[0].Updates) != 3 {
+		t.Errorf("rollup debited twice: %v", got)
+	}
+}
+
+func TestRollupInternalDeposit(t *testing.T) {
+	addr := func(typ mavryk.AddressType, n byte) mavryk.Address {
+		hash := make([]byte, 20)
+		hash[19] = n
+		return mavryk.NewAddress(typ, hash)
+	}
+	var (
+		rollup = addr(mavryk.AddressTypeSmartRollup, 1)
+		bridge = addr(mavryk.AddressTypeContract, 2)
+		alice  = addr(mavryk.AddressTypeContract, 3)
+		ticket = Ticket{
+			Ticketer: addr(mavryk.AddressTypeContract, 9),
+			Type:     micheline.NewPrim(micheline.T_STRING),
+			Content:  micheline.NewString("coin"),
+		}
+	)
+
+	// a bridge contract deposits 5 into the rollup with an internal call
+	var deposit InternalResult
+	deposit.Kind = mavryk.OpTypeTransaction
+	deposit.Source = bridge
+	deposit.Destination = rollup
+	deposit.Result.Status = mavryk.OpStatusApplied
+	deposit.Result.TicketReceipts = []TicketUpdate{{
+		Ticket:  ticket,
+		Updates: []TicketBalanceUpdate{{Account: bridge, Amount: mavryk.NewZ(-5)}},
+	}}
+
+	// alice withdraws all of it through the outbox
+	var withdraw SmartRollupExecuteOutboxMessage
+	withdraw.Rollup = rollup
+	withdraw.Metadata = &OperationMetadata{}
+	withdraw.Metadata.Result.Status = mavryk.OpStatusApplied
+	withdraw.Metadata.Result.TicketUpdatesCorrect = []TicketUpdate{{
+		Ticket:  ticket,
+		Updates: []TicketBalanceUpdate{{Account: alice, Amount: mavryk.NewZ(5)}},
+	}}
+
+	// replay both receipts, the rollup balance never goes negative
+	var bal mavryk.Z
+	for i, list := range [][]TicketUpdate{deposit.TicketUpdates(), withdraw.TicketUpdates()} {
+		for _, v := range list {
+			for _, u := range v.Updates {
+				if u.Account.Equal(rollup) {
+					bal = bal.Add(u.Amount)
+				}
+			}
+		}
+		if bal.IsNeg() {
+			t.Fatalf("step %d: negative rollup balance %s", i, bal)
+		}
+	}
+	if !bal.IsZero() {
+		t.Errorf("got final rollup balance %s, want 0", bal)
+	}
+	if n := len(deposit.Result.TicketReceipts[0].Updates); n != 1 {
+		t.Errorf("receipt was modified, got %d updates", n)
+	}
+
+	// calls to regular contracts are credited by the receipt
+	deposit.Destination = alice
+	if got := deposit.TicketUpdates(); len(got[0].Updates) != 1 {
+		t.Errorf("unexpected updates for contract destination: %v", got)
+	}
+}
@@ -99,6 +99,9 @@ type HttpConfig struct {
 	CacheControl        string        `json:"cache_control"`
 	CacheExpires        time.Duration `json:"cache_expires"`
 	CacheMaxExpires     time.Duration `json:"cache_max"`
+	MaxResponseSize     int64         `json:"max_response_size"` // streamed bytes, 0 = unlimited
+	MaxHeavyQueries     int           `json:"max_heavy_queries"` // concurrent expensive queries, 0 = unlimited
+	AdminKey            string        `json:"-"`                 // bearer token for admin overrides
 }
 
 func (c HttpConfig) Address() string {
@@ -155,6 +155,11 @@ func (api *Context) ParseRequestArgs(args interface{}) {
 // this is executed in a goroutine per call, panics on error
 func (api *Context) serve() {
 	defer api.complete()
+	if api.Indexer != nil {
+		var release func()
+		api.Indexer, release = api.Indexer.Acquire()
+		defer release()
+	}
 	var status int
 	api.result, status = api.f(api)
 	if status > 0 {
@@ -266,6 +271,12 @@ func (api *Context) sendResponse() {
 	}
 
 	if api.err == nil {
+		// answer conditional requests for resources with known modification time
+		if api.checkNotModified() {
+			api.writeResponseHeaders("", "")
+			return
+		}
+
 		// make sure to set response headers before writing body
 		api.writeResponseHeaders("", "")
 
@@ -302,6 +313,35 @@ func (api *Context) sendResponse() {
 	}
 }
 
+// checkNotModified sets an ETag header on successful GET and HEAD responses
+// of resources that implement LastModified and switches the response status
+// to 304 when the client already holds a matching representation.
+func (api *Context) checkNotModified() bool {
+	switch api.Request.Method {
+	case http.MethodGet, http.MethodHead:
+	default:
+		return false
+	}
+	if api.status != http.StatusOK {
+		return false
+	}
+	res, ok := api.result.(Resource)
+	if !ok {
+		return false
+	}
+	modtime := res.LastModified()
+	if modtime.IsZero() {
+		return false
+	}
+	etag := makeETag(api.Request.URL.RequestURI(), modtime)
+	api.ResponseWriter.Header().Set("ETag", etag)
+	if !matchETag(api.Request.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	api.status = http.StatusNotModified
+	return true
+}
+
 func (api *Context) RequestString() string {
 	return strings.Join([]string{
 		api.Request.Method,
@@ -314,6 +354,9 @@ func (api *Context) StreamResponseHeaders(status int, contentType string) {
 	api.isStreamed = true
 	api.status = status
 	api.writeResponseHeaders(contentType, headerTrailer)
+	if max := api.maxResponseSize(); max > 0 {
+		api.ResponseWriter = &limitWriter{ResponseWriter: api.ResponseWriter, max: max}
+	}
 	// Attempt to flush the header immediately so the client
 	// gets the header information and knows the query was accepted.
 	if w, ok := api.ResponseWriter.(http.Flusher); ok {
@@ -337,7 +380,7 @@ func (api *Context) StreamTrailer(cursor string, count int, err error) {
 			api.Log.Debugf("streaming %d (%d) %s - %s failed (%s): %v", api.status, api.err.Code, path, api.err.Scope, api.err.Detail, api.err.Cause)
 		case 429:
 			// don't log
-		case 400, 404:
+		case 400, 404, 413:
 			api.Log.Debugf("streaming %d (%d) %s - %s failed (%s): %v", api.status, api.err.Code, path, api.err.Scope, api.err.Detail, api.err.Cause)
 		default:
 			// api.err may be nil on premature stream close
@@ -386,7 +429,7 @@ func (api *Context) writeResponseHeaders(contentType, trailers string) {
 	}
 
 	// set content type if not already set by request handler function
-	if h.Get("Content-Type") == "" && api.status != http.StatusNoContent {
+	if h.Get("Content-Type") == "" && api.status != http.StatusNoContent && api.status != http.StatusNotModified {
 		if contentType == "" {
 			contentType = jsonContentType
 		}
@@ -413,9 +456,9 @@ func (api *Context) writeResponseHeaders(contentType, trailers string) {
 	// Set cache headers ONLY if ALL of the following applies
 	// - caching is enabled in config
 	// - request method is GET, HEAD or OPTIONS
-	// - return status is 2xx
+	// - return status is 2xx or 304
 	//
-	cacheStatus := api.status >= 200 && api.status <= 299
+	cacheStatus := api.status >= 200 && api.status <= 299 || api.status == http.StatusNotModified
 	cacheMethod := false
 	switch api.Request.Method {
 	case http.MethodGet, http.MethodHead, http.MethodOptions:
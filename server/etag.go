@@ -0,0 +1,38 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// makeETag derives a weak entity tag from a resource's identity (request URI
+// incl. query args which select the representation) and its last
+// modification time.
+func makeETag(uri string, modtime time.Time) string {
+	h := xxhash.New()
+	_, _ = h.WriteString(uri)
+	_, _ = h.WriteString(strconv.FormatInt(modtime.UnixNano(), 10))
+	return `W/"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// matchETag reports whether an If-None-Match header value matches etag using
+// weak comparison.
+func matchETag(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tag := makeETag("/explorer/token/KT1/0", now)
+	if tag != makeETag("/explorer/token/KT1/0", now) {
+		t.Errorf("etag not stable")
+	}
+	if tag == makeETag("/explorer/token/KT1/0", now.Add(time.Second)) {
+		t.Errorf("etag must change with modification time")
+	}
+	if tag == makeETag("/explorer/token/KT1/0?meta=1", now) {
+		t.Errorf("etag must change with request args")
+	}
+	for _, c := range []struct {
+		header string
+		match  bool
+	}{
+		{"", false},
+		{tag, true},
+		{tag[2:], true}, // strong form of weak tag
+		{`"other", ` + tag, true},
+		{"*", true},
+		{`W/"other"`, false},
+	} {
+		if got := matchETag(c.header, tag); got != c.match {
+			t.Errorf("%q: got %t, want %t", c.header, got, c.match)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package explorer
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -18,6 +19,14 @@ import (
 	"github.com/mavryk-network/mvindex/server"
 )
 
+const (
+	// max pages scanned for merged batches matching min_gas
+	maxMinGasPages = 10
+
+	// response header with the cursor to continue a truncated scan from
+	headerCursor = "X-Cursor"
+)
+
 func init() {
 	server.Register(Account{})
 }
@@ -72,6 +81,7 @@ type Account struct {
 	NTxOut             int                  `json:"n_tx_out"`
 	NTxIn              int                  `json:"n_tx_in"`
 	Metadata           map[string]*Metadata `json:"metadata,omitempty"`
+	Names              map[string]string    `json:"names,omitempty"`
 
 	// LEGACY
 	Ops OpList `json:"ops,omitempty"`
@@ -164,6 +174,14 @@ func NewAccount(ctx *server.Context, a *model.Account, args server.Options) *Acc
 		}
 	}
 
+	if args.WithNames() {
+		acc.Names = lookupNames(ctx,
+			a.Address,
+			ctx.Indexer.LookupAddress(ctx, a.BakerId),
+			ctx.Indexer.LookupAddress(ctx, a.CreatorId),
+		)
+	}
+
 	// resolve baking rewards
 	if a.IsStaked {
 		if bkr, err := ctx.Indexer.LookupBakerId(ctx, a.BakerId); err == nil {
@@ -200,12 +218,21 @@ func (b Account) RegisterDirectRoutes(r *mux.Router) error {
 func (b Account) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/{ident}", server.C(ReadAccount)).Methods("GET").Name("account")
 	r.HandleFunc("/{ident}/contracts", server.C(ReadDeployedContracts)).Methods("GET")
-	r.HandleFunc("/{ident}/operations", server.C(ListAccountOperations)).Methods("GET")
+	// not at /contracts which lists deployed contracts, see ListAccountInteractions
+	r.HandleFunc("/{ident}/interactions", server.H(ListAccountInteractions)).Methods("GET")
+	r.HandleFunc("/{ident}/activity", server.H(ListAccountActivity)).Methods("GET")
+	r.HandleFunc("/{ident}/called_entrypoints", server.H(ListAccountCalledEntrypoints)).Methods("GET")
+	r.HandleFunc("/{ident}/operations", server.C(Columnar(ListAccountOperations))).Methods("GET")
 	r.HandleFunc("/{ident}/metadata", server.C(ReadMetadata)).Methods("GET")
 	r.HandleFunc("/{ident}/token_balances", server.C(ListAccountTokenBalances)).Methods("GET")
-	r.HandleFunc("/{ident}/token_events", server.C(ListAccountTokenEvents)).Methods("GET")
+	r.HandleFunc("/{ident}/token_events", server.C(Columnar(ListAccountTokenEvents))).Methods("GET")
+	r.HandleFunc("/{ident}/operators", server.C(ListAccountTokenOperators)).Methods("GET")
 	r.HandleFunc("/{ident}/ticket_balances", server.C(ListAccountTicketBalances)).Methods("GET")
-	r.HandleFunc("/{ident}/ticket_events", server.C(ListAccountTicketEvents)).Methods("GET")
+	r.HandleFunc("/{ident}/ticket_events", server.C(Columnar(ListAccountTicketEvents))).Methods("GET")
+	r.HandleFunc("/{ident}/unstake_requests", server.C(ListAccountUnstakeRequests)).Methods("GET")
+	r.HandleFunc("/{ident}/balance_history", server.H(ListAccountBalanceHistory)).Methods("GET")
+	r.HandleFunc("/{ident}/ledger", server.C(ListAccountLedger)).Methods("GET")
+	r.HandleFunc("/{ident}/bigmap_refs", server.H(ListAccountBigmapRefs)).Methods("GET")
 
 	// LEGACY: keep here for dapp and wallet compatibility
 	r.HandleFunc("/{ident}/op", server.C(ReadAccountOps)).Methods("GET")
@@ -214,7 +241,8 @@ func (b Account) RegisterRoutes(r *mux.Router) error {
 
 type AccountRequest struct {
 	ListRequest      // offset, limit, cursor, order
-	Meta        bool `schema:"meta"` // include account metadata
+	Meta        bool `schema:"meta"`       // include account metadata
+	Names       bool `schema:"with_names"` // include domain names
 }
 
 func (r *AccountRequest) WithPrim() bool    { return false }
@@ -224,6 +252,7 @@ func (r *AccountRequest) WithMeta() bool    { return r != nil && r.Meta }
 func (r *AccountRequest) WithRights() bool  { return false }
 func (r *AccountRequest) WithMerge() bool   { return false }
 func (r *AccountRequest) WithStorage() bool { return false }
+func (r *AccountRequest) WithNames() bool   { return r != nil && r.Names }
 
 func loadAccount(ctx *server.Context) *model.Account {
 	if accIdent, ok := mux.Vars(ctx.Request)["ident"]; !ok || accIdent == "" {
@@ -294,7 +323,11 @@ func ReadDeployedContracts(ctx *server.Context) (interface{}, int) {
 	if err != nil {
 		panic(server.EInternal(server.EC_DATABASE, "cannot read deployed contracts", err))
 	}
+	return newContractList(ctx, ccs, args), http.StatusOK
+}
 
+// newContractList renders contracts together with their account data.
+func newContractList(ctx *server.Context, ccs []*model.Contract, args server.Options) []*Contract {
 	// we also need the account data for contracts
 	ids := make([]uint64, 0, len(ccs))
 	for _, v := range ccs {
@@ -313,7 +346,7 @@ func ReadDeployedContracts(ctx *server.Context) (interface{}, int) {
 	for _, v := range ccs {
 		resp = append(resp, NewContract(ctx, v, accMap[v.AccountId], args))
 	}
-	return resp, http.StatusOK
+	return resp
 }
 
 // LEGACY
@@ -352,6 +385,13 @@ func ReadAccountOps(ctx *server.Context) (interface{}, int) {
 			r.ReceiverId = a.RowId
 		}
 	}
+	if args.FeePayer.IsValid() {
+		if a, err := ctx.Indexer.LookupAccount(ctx.Context, args.FeePayer); err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such fee payer account", err))
+		} else {
+			r.PayerId = a.RowId
+		}
+	}
 
 	ops, err := ctx.Indexer.ListAccountOps(ctx, r)
 	if err != nil {
@@ -387,6 +427,13 @@ func ListAccountOperations(ctx *server.Context) (interface{}, int) {
 		Order:       args.Order,
 		WithStorage: args.WithStorage(),
 	}
+	if args.OrderBy == OrderByGas {
+		panic(server.EBadRequest(server.EC_PARAM_NOTEXPECTED, "order_by gas is only supported for block operations", nil))
+	}
+	// merged batches are filtered by their total gas below
+	if !args.WithMerge() {
+		r.MinGas = args.MinGas
+	}
 
 	if args.Sender.IsValid() {
 		if a, err := ctx.Indexer.LookupAccount(ctx.Context, args.Sender); err != nil {
@@ -402,15 +449,66 @@ func ListAccountOperations(ctx *server.Context) (interface{}, int) {
 			r.ReceiverId = a.RowId
 		}
 	}
+	if args.FeePayer.IsValid() {
+		if a, err := ctx.Indexer.LookupAccount(ctx.Context, args.FeePayer); err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such fee payer account", err))
+		} else {
+			r.PayerId = a.RowId
+		}
+	}
 
-	ops, err := ctx.Indexer.ListAccountOps(ctx, r)
-	if err != nil {
-		panic(server.EInternal(server.EC_DATABASE, "cannot read account operations", err))
+	var (
+		limit = int(r.Limit)
+		resp  = make(OpList, 0)
+		cache = make(map[int64]interface{})
+		last  uint64 // id of the last listed op
+		prev  uint64 // id of the last op before the last batch
+	)
+	for page := 1; ; page++ {
+		ops, err := ctx.Indexer.ListAccountOps(ctx, r)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot read account operations", err))
+		}
+		var internal map[uint64][]*InternalOp
+		if args.Internal {
+			internal = listInternalOps(ctx, ops, args)
+		}
+		for _, v := range ops {
+			o := NewOp(ctx, v, nil, nil, args, cache)
+			o.InternalOps = internal[v.Id()]
+			n := len(resp)
+			resp.Append(o, args.WithMerge())
+			if len(resp) > n {
+				prev = last
+			}
+			last = v.Id()
+		}
+
+		// merged batches are matched by their total gas which is only known
+		// after merging, so keep paging until enough batches match; the last
+		// batch may continue on the next page and is not counted yet
+		if r.MinGas > 0 || args.MinGas == 0 || len(ops) == 0 || len(ops) < limit {
+			break
+		}
+		if resp[:len(resp)-1].CountMinGas(args.MinGas) >= limit {
+			break
+		}
+
+		// stop scanning sparse matches and return a cursor to continue
+		// from, it excludes the last batch which may be incomplete
+		if page == maxMinGasPages {
+			cursor := last
+			if prev > 0 {
+				resp, cursor = resp[:len(resp)-1], prev
+			}
+			ctx.ResponseWriter.Header().Set(headerCursor, strconv.FormatUint(cursor, 10))
+			break
+		}
+		r.Cursor = last
 	}
-	resp := make(OpList, 0)
-	cache := make(map[int64]interface{})
-	for _, v := range ops {
-		resp.Append(NewOp(ctx, v, nil, nil, args, cache), args.WithMerge())
+	resp = resp.FilterMinGas(args.MinGas)
+	if limit > 0 && len(resp) > limit {
+		resp = resp[:limit]
 	}
 	return resp, http.StatusOK
 }
@@ -0,0 +1,88 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// upper bound for buckets in a single activity response
+const maxActivityBuckets = 1000
+
+type AccountActivityRequest struct {
+	Collapse string `schema:"collapse"` // interval, e.g. 1d, 1w, 1000blocks, 1cycle
+}
+
+type AccountActivityPoint struct {
+	Time   time.Time `json:"time"`             // bucket start
+	Height int64     `json:"height,omitempty"` // first block, block and cycle intervals only
+	NOps   int       `json:"n_ops"`
+	NFlows int       `json:"n_flows"`
+}
+
+// ListAccountActivity counts operations and balance flows of an account per
+// collapse interval, e.g. for rendering activity heatmaps. The range defaults
+// to the account's lifetime and can be narrowed with height and time filters.
+// Buckets without activity are included with zero counts.
+func ListAccountActivity(ctx *server.Context) (interface{}, int) {
+	args := &AccountActivityRequest{}
+	ctx.ParseRequestArgs(args)
+	if args.Collapse == "" {
+		args.Collapse = "1d"
+	}
+	ival, err := ParseInterval(args.Collapse)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, err.Error(), err))
+	}
+	acc := loadAccount(ctx)
+
+	// clamp the requested range to the account's lifetime
+	from, to, ok := parseBlockRange(ctx)
+	from = max(from, acc.FirstSeen)
+	if to == 0 || to > acc.LastSeen {
+		to = acc.LastSeen
+	}
+	resp := make([]AccountActivityPoint, 0)
+	if !ok || acc.LastSeen == 0 || from > to {
+		return resp, http.StatusOK
+	}
+
+	bucketAt := func(height int64) int64 {
+		cycle := ctx.Crawler.ParamsByHeight(height).HeightToCycle(height)
+		return ival.Bucket(height, cycle, ctx.Indexer.LookupBlockTime(ctx, height))
+	}
+	first, last := bucketAt(from), bucketAt(to)
+	if n := last - first + 1; n > maxActivityBuckets {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID,
+			fmt.Sprintf("range spans %d buckets, max is %d, use a larger collapse interval or a narrower range", n, maxActivityBuckets), nil))
+	}
+
+	counts, err := ctx.Indexer.AccountActivity(ctx, acc, from, to, ival.Bucket)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read account activity", err))
+	}
+	for b := first; b <= last; b++ {
+		p := AccountActivityPoint{}
+		switch ival.Unit {
+		case IntervalBlock:
+			p.Height = b * ival.Value
+			p.Time = ctx.Indexer.LookupBlockTime(ctx, p.Height)
+		case IntervalCycle:
+			cycle := b * ival.Value
+			p.Height = ctx.Crawler.ParamsByCycle(cycle).CycleStartHeight(cycle)
+			p.Time = ctx.Indexer.LookupBlockTime(ctx, p.Height)
+		default:
+			p.Time = time.Unix(b*int64(ival.Duration()/time.Second), 0).UTC()
+		}
+		if c, ok := counts[b]; ok {
+			p.NOps, p.NFlows = c.NOps, c.NFlows
+		}
+		resp = append(resp, p)
+	}
+	return resp, http.StatusOK
+}
@@ -94,6 +94,7 @@ type Baker struct {
 	IsOverDelegated    bool            `json:"is_over_delegated"`
 	IsOverStaked       bool            `json:"is_over_staked"`
 	IsActive           bool            `json:"is_active"`
+	Status             string          `json:"status"`
 
 	Events   *BakerEvents     `json:"events,omitempty"`
 	Stats    *BakerStatistics `json:"stats,omitempty"`
@@ -137,6 +138,7 @@ func NewBaker(ctx *server.Context, b *model.Baker, args server.Options) *Baker {
 		ActiveDelegations:  b.ActiveDelegations,
 		ActiveStakers:      b.ActiveStakers,
 		IsActive:           b.IsActive,
+		Status:             b.Status(tip.Cycle),
 		IsOverDelegated:    b.IsOverDelegated(ctx.Params),
 		IsOverStaked:       b.IsOverStaked(ctx.Params),
 		expires:            ctx.Expires,
@@ -244,12 +246,14 @@ func (a BakerList) RegisterDirectRoutes(r *mux.Router) error {
 
 func (b BakerList) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/{ident}", server.C(ReadBaker)).Methods("GET").Name("baker")
-	r.HandleFunc("/{ident}/votes", server.C(ListBakerVotes)).Methods("GET")
-	r.HandleFunc("/{ident}/endorsements", server.C(ListBakerEndorsements)).Methods("GET")
-	r.HandleFunc("/{ident}/delegations", server.C(ListBakerDelegations)).Methods("GET")
+	r.HandleFunc("/{ident}/votes", server.C(Columnar(ListBakerVotes))).Methods("GET")
+	r.HandleFunc("/{ident}/endorsements", server.C(Columnar(ListBakerEndorsements))).Methods("GET")
+	r.HandleFunc("/{ident}/delegations", server.C(Columnar(ListBakerDelegations))).Methods("GET")
+	r.HandleFunc("/{ident}/delegators", server.C(ListBakerDelegators)).Methods("GET")
+	r.HandleFunc("/{ident}/status_history", server.C(ListBakerStatusHistory)).Methods("GET")
 	r.HandleFunc("/{ident}/income/{cycle}", server.C(GetBakerIncome)).Methods("GET")
 	r.HandleFunc("/{ident}/rights/{cycle}", server.C(GetBakerRights)).Methods("GET")
-	r.HandleFunc("/{ident}/snapshot/{cycle}", server.C(GetBakerSnapshot)).Methods("GET")
+	r.HandleFunc("/{ident}/snapshot/{cycle}", server.H(GetBakerSnapshot)).Methods("GET")
 	r.HandleFunc("/{ident}/metadata", server.C(ReadMetadata)).Methods("GET")
 	return nil
 }
@@ -418,6 +422,7 @@ func ListBakers(ctx *server.Context) (interface{}, int) {
 			ActiveDelegations:  v.ActiveDelegations,
 			ActiveStakers:      v.ActiveStakers,
 			IsActive:           v.IsActive,
+			Status:             v.Status(tip.Cycle),
 			IsOverDelegated:    v.IsOverDelegated(ctx.Params),
 			IsOverStaked:       v.IsOverStaked(ctx.Params),
 			Stats: &BakerStatistics{
@@ -694,6 +699,127 @@ func ListBakerDelegations(ctx *server.Context) (interface{}, int) {
 	return resp, http.StatusOK
 }
 
+type BakerStatusEvent struct {
+	RowId       uint64    `json:"row_id"`
+	Height      int64     `json:"height"`
+	Cycle       int64     `json:"cycle"`
+	Time        time.Time `json:"time"`
+	Status      string    `json:"status"`
+	GracePeriod int64     `json:"grace_period"`
+}
+
+// ListBakerStatusHistory lists activation and deactivation events of a
+// baker. Events indexed before this table existed are not backfilled.
+func ListBakerStatusHistory(ctx *server.Context) (interface{}, int) {
+	args := &ListRequest{
+		Order: pack.OrderDesc,
+	}
+	ctx.ParseRequestArgs(args)
+	bkr := loadBaker(ctx)
+
+	r := etl.ListRequest{
+		Account: bkr.Account,
+		Offset:  args.Offset,
+		Limit:   ctx.Cfg.ClampExplore(args.Limit),
+		Cursor:  args.Cursor,
+		Order:   args.Order,
+	}
+	list, err := ctx.Indexer.ListBakerStatus(ctx, r)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read baker status history", err))
+	}
+
+	resp := make([]BakerStatusEvent, 0, len(list))
+	for _, v := range list {
+		resp = append(resp, BakerStatusEvent{
+			RowId:       uint64(v.Id),
+			Height:      v.Height,
+			Cycle:       v.Cycle,
+			Time:        ctx.Indexer.LookupBlockTime(ctx.Context, v.Height),
+			Status:      v.Status(),
+			GracePeriod: v.GracePeriod,
+		})
+	}
+	return resp, http.StatusOK
+}
+
+type BakerDelegator struct {
+	Address          mavryk.Address `json:"address"`
+	DelegatedBalance float64        `json:"delegated_balance"`
+	StakedBalance    float64        `json:"staked_balance"`
+	StakeShares      int64          `json:"stake_shares"`
+	StakeShare       float64        `json:"stake_share"` // share of staker rewards
+	DelegatedSince   int64          `json:"delegated_since"`
+	IsStaked         bool           `json:"is_staked"`
+}
+
+type BakerDelegatorRequest struct {
+	ListRequest
+	SortBy string `schema:"sort"` // stake (default), balance
+}
+
+// ListBakerDelegators lists accounts delegating to a baker with their
+// delegated (unstaked) balance and their stake. Staked balances are
+// derived from stake shares and the baker's current stake pool, so they
+// include earned staking rewards. StakeShare is the fraction of the pool
+// owned by a staker and equals its proportional share of rewards paid to
+// stakers. Accounts that only delegate own no shares.
+func ListBakerDelegators(ctx *server.Context) (interface{}, int) {
+	args := &BakerDelegatorRequest{
+		ListRequest: ListRequest{
+			Order: pack.OrderDesc,
+		},
+	}
+	ctx.ParseRequestArgs(args)
+	bkr := loadBaker(ctx)
+
+	accs, err := ctx.Indexer.ListBakerDelegators(ctx, bkr.AccountId)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read delegators", err))
+	}
+
+	var less func(i, j int) bool
+	switch args.SortBy {
+	case "", "stake":
+		less = func(i, j int) bool {
+			if accs[i].StakeShares == accs[j].StakeShares {
+				return accs[i].Balance() < accs[j].Balance()
+			}
+			return accs[i].StakeShares < accs[j].StakeShares
+		}
+	case "balance":
+		less = func(i, j int) bool {
+			return accs[i].Balance() < accs[j].Balance()
+		}
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid sort field "+args.SortBy, nil))
+	}
+	if args.Order == pack.OrderDesc {
+		sort.SliceStable(accs, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(accs, less)
+	}
+	accs = accs[min(int(args.Offset), len(accs)):]
+	accs = accs[:min(int(ctx.Cfg.ClampExplore(args.Limit)), len(accs))]
+
+	resp := make([]*BakerDelegator, 0, len(accs))
+	for _, v := range accs {
+		d := &BakerDelegator{
+			Address:          v.Address,
+			DelegatedBalance: ctx.Params.ConvertValue(v.Balance()),
+			StakeShares:      v.StakeShares,
+			DelegatedSince:   v.DelegatedSince,
+			IsStaked:         v.IsStaked,
+		}
+		if v.StakeShares > 0 && bkr.TotalShares > 0 {
+			d.StakedBalance = ctx.Params.ConvertValue(bkr.StakeAmount(v.StakeShares))
+			d.StakeShare = float64(v.StakeShares) / float64(bkr.TotalShares)
+		}
+		resp = append(resp, d)
+	}
+	return resp, http.StatusOK
+}
+
 type ExplorerRights struct {
 	Address  mavryk.Address `json:"address"`
 	Cycle    int64          `json:"cycle"`
@@ -0,0 +1,100 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type BalanceHistoryEntry struct {
+	Id         uint64                `json:"id"`
+	Height     int64                 `json:"height"`
+	Cycle      int64                 `json:"cycle"`
+	Time       time.Time             `json:"time"`
+	OpN        int                   `json:"op_n"`
+	OpC        int                   `json:"op_c"`
+	OpI        int                   `json:"op_i"`
+	Kind       string                `json:"kind"`
+	Type       string                `json:"type"`
+	Category   model.BalanceCategory `json:"category"`
+	AmountIn   float64               `json:"amount_in"`
+	AmountOut  float64               `json:"amount_out"`
+	IsFee      bool                  `json:"is_fee,omitempty"`
+	IsBurned   bool                  `json:"is_burned,omitempty"`
+	IsFrozen   bool                  `json:"is_frozen,omitempty"`
+	IsUnfrozen bool                  `json:"is_unfrozen,omitempty"`
+	Origin     string                `json:"origin"`
+	Spendable  float64               `json:"spendable_balance"`
+	Frozen     float64               `json:"frozen_balance"`
+	Staked     float64               `json:"staked_balance"`
+	Unstaked   float64               `json:"unstaked_balance"`
+	Total      float64               `json:"total_balance"`
+}
+
+func NewBalanceHistoryEntry(ctx *server.Context, e *model.BalanceHistoryEntry) *BalanceHistoryEntry {
+	p, f := ctx.Params, e.Flow
+	return &BalanceHistoryEntry{
+		Id:         f.RowId,
+		Height:     f.Height,
+		Cycle:      f.Cycle,
+		Time:       f.Timestamp,
+		OpN:        f.OpN,
+		OpC:        f.OpC,
+		OpI:        f.OpI,
+		Kind:       f.Kind.String(),
+		Type:       f.Type.String(),
+		Category:   e.Category,
+		AmountIn:   p.ConvertValue(f.AmountIn),
+		AmountOut:  p.ConvertValue(f.AmountOut),
+		IsFee:      f.IsFee,
+		IsBurned:   f.IsBurned,
+		IsFrozen:   f.IsFrozen,
+		IsUnfrozen: f.IsUnfrozen,
+		Origin:     f.Origin.String(),
+		Spendable:  p.ConvertValue(e.Balance.Spendable),
+		Frozen:     p.ConvertValue(e.Balance.Frozen),
+		Staked:     p.ConvertValue(e.Balance.Staked),
+		Unstaked:   p.ConvertValue(e.Balance.Unstaked),
+		Total:      p.ConvertValue(e.Balance.Total()),
+	}
+}
+
+// ListAccountBalanceHistory lists balance flows of an account with running
+// balances after each flow (an account statement). Delegation flows are
+// excluded. Spendable, frozen, staked and unstaked movements are reported
+// as separate categories. Supports `height` and `time` range filters, limit,
+// offset and cursor. Results are always in chain order.
+func ListAccountBalanceHistory(ctx *server.Context) (interface{}, int) {
+	args := &ListRequest{}
+	ctx.ParseRequestArgs(args)
+	acc := loadAccount(ctx)
+
+	r := etl.ListRequest{
+		Account: acc,
+		Offset:  args.Offset,
+		Limit:   ctx.Cfg.ClampExplore(args.Limit),
+		Cursor:  args.Cursor,
+	}
+	var (
+		list []*model.BalanceHistoryEntry
+		err  error
+		ok   bool
+	)
+	if r.Since, r.Until, ok = parseBlockRange(ctx); ok {
+		list, err = ctx.Indexer.ListBalanceHistory(ctx, r)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list balance history", err))
+		}
+	}
+	resp := make([]*BalanceHistoryEntry, len(list))
+	for i, v := range list {
+		resp[i] = NewBalanceHistoryEntry(ctx, v)
+	}
+	return resp, http.StatusOK
+}
@@ -5,16 +5,23 @@ package explorer
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"blockwatch.cc/packdb/vec"
 	"github.com/gorilla/mux"
 
 	"github.com/mavryk-network/mvgo/mavryk"
 	"github.com/mavryk-network/mvgo/micheline"
 	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/cache"
 	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/rpc"
 	"github.com/mavryk-network/mvindex/server"
 )
 
@@ -88,15 +95,28 @@ func (b Bigmap) RESTPath(r *mux.Router) string {
 }
 
 func (b Bigmap) RegisterDirectRoutes(r *mux.Router) error {
+	r.HandleFunc(b.RESTPrefix(), server.C(ListBigmapsByType)).Methods("GET")
 	return nil
 }
 
 func (b Bigmap) RegisterRoutes(r *mux.Router) error {
+	r.HandleFunc("/updates", server.C(ListBigmapUpdateFeed)).Methods("GET")
 	r.HandleFunc("/{id}", server.C(ReadBigmap)).Methods("GET").Name("bigmap")
 	r.HandleFunc("/{id}/keys", server.C(ListBigmapKeys)).Methods("GET")
 	r.HandleFunc("/{id}/values", server.C(ListBigmapValues)).Methods("GET")
+	r.HandleFunc("/{id}/largest_values", server.H(ListLargestBigmapValues)).Methods("GET")
 	r.HandleFunc("/{id}/updates", server.C(ListBigmapUpdates)).Methods("GET")
+	r.HandleFunc("/{id}/prefix", server.H(ListBigmapPrefixValues)).Methods("GET")
+	r.HandleFunc("/{id}/range", server.H(ListBigmapRangeValues)).Methods("GET")
+	r.HandleFunc("/{id}/recent", server.C(ListBigmapRecentValues)).Methods("GET")
+	r.HandleFunc("/{id}/ops", server.C(Columnar(ListBigmapOps))).Methods("GET")
+	r.HandleFunc("/{id}/provenance", server.C(ReadBigmapProvenance)).Methods("GET")
+	r.HandleFunc("/{id}/lifecycle", server.H(ReadBigmapLifecycle)).Methods("GET")
+	r.HandleFunc("/{id}/commitment", server.H(ReadBigmapCommitment)).Methods("GET")
+	r.HandleFunc("/{id}/churn", server.H(ListBigmapChurn)).Methods("GET")
 	r.HandleFunc("/{id}/{key}/updates", server.C(ListBigmapKeyUpdates)).Methods("GET")
+	r.HandleFunc("/{id}/{key}/proof", server.H(ReadBigmapKeyProof)).Methods("GET")
+	r.HandleFunc("/{id}/{key}/series", server.H(ListBigmapValueSeries)).Methods("GET")
 	r.HandleFunc("/{id}/{key}", server.C(ReadBigmapValue)).Methods("GET")
 	return nil
 }
@@ -134,14 +154,16 @@ var _ server.Resource = (*BigmapKeyList)(nil)
 
 // values
 type BigmapValue struct {
-	Key       *micheline.Key   `json:"key,omitempty"`   // omit on bigmap clear
-	KeyHash   *mavryk.ExprHash `json:"hash,omitempty"`  // omit on bigmap clear
-	Value     *micheline.Value `json:"value,omitempty"` // omit on removal updates
-	Meta      *BigmapMeta      `json:"meta,omitempty"`
-	KeyPrim   *micheline.Prim  `json:"key_prim,omitempty"`
-	ValuePrim *micheline.Prim  `json:"value_prim,omitempty"`
-	modified  time.Time        `json:"-"`
-	expires   time.Time        `json:"-"`
+	Key       *micheline.Key      `json:"key,omitempty"`   // omit on bigmap clear
+	KeyHash   *mavryk.ExprHash    `json:"hash,omitempty"`  // omit on bigmap clear
+	Value     *micheline.Value    `json:"value,omitempty"` // omit on removal updates
+	Meta      *BigmapMeta         `json:"meta,omitempty"`
+	KeyPrim   *micheline.Prim     `json:"key_prim,omitempty"`
+	ValuePrim *micheline.Prim     `json:"value_prim,omitempty"`
+	Contracts []*EmbeddedContract `json:"contracts,omitempty"` // with_creators only
+	valueJSON json.RawMessage     `json:"-"`                   // cached encoded value
+	modified  time.Time           `json:"-"`
+	expires   time.Time           `json:"-"`
 }
 
 func (t BigmapValue) LastModified() time.Time { return t.modified }
@@ -149,15 +171,35 @@ func (t BigmapValue) Expires() time.Time      { return t.expires }
 
 var _ server.Resource = (*BigmapValue)(nil)
 
+// encodedBigmapValue outputs a cached value encoding in place of the typed value
+type encodedBigmapValue struct {
+	BigmapValue
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (t BigmapValue) encode() server.Resource {
+	if t.valueJSON == nil {
+		return t
+	}
+	return encodedBigmapValue{BigmapValue: t, Value: t.valueJSON}
+}
+
 type BigmapValueList struct {
 	list     []BigmapValue
 	modified time.Time
 	expires  time.Time
 }
 
-func (l BigmapValueList) MarshalJSON() ([]byte, error) { return json.Marshal(l.list) }
-func (l BigmapValueList) LastModified() time.Time      { return l.modified }
-func (l BigmapValueList) Expires() time.Time           { return l.expires }
+func (l BigmapValueList) LastModified() time.Time { return l.modified }
+func (l BigmapValueList) Expires() time.Time      { return l.expires }
+
+func (l BigmapValueList) MarshalJSON() ([]byte, error) {
+	list := make([]server.Resource, len(l.list))
+	for i, v := range l.list {
+		list[i] = v.encode()
+	}
+	return json.Marshal(list)
+}
 
 var _ server.Resource = (*BigmapKeyList)(nil)
 
@@ -225,6 +267,23 @@ func parseBigmapKey(ctx *server.Context, typ micheline.OpCode) mavryk.ExprHash {
 	}
 }
 
+// parses the left-most component of a pair key
+func parseBigmapKeyPrefix(ctx *server.Context, typ micheline.Type, val string) micheline.Key {
+	if val == "" {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing key prefix", nil))
+	}
+	if typ.OpCode != micheline.T_PAIR || len(typ.Args) == 0 {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "bigmap key is not a pair", nil))
+	}
+	leftType := micheline.NewType(typ.Args[0])
+	key, err := micheline.ParseKey(leftType.OpCode, val)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid key prefix", err))
+	}
+	key.Type = leftType
+	return key
+}
+
 func ReadBigmap(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
@@ -253,7 +312,7 @@ func ListBigmapKeys(ctx *server.Context) (interface{}, int) {
 	if r.Since == 0 {
 		items, err = ctx.Indexer.ListBigmapKeys(ctx.Context, r)
 	} else {
-		items, err = ctx.Indexer.ListHistoricBigmapKeys(ctx.Context, r)
+		items = listHistoricBigmapKeys(ctx, r)
 	}
 	if err != nil {
 		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
@@ -321,7 +380,7 @@ func ListBigmapValues(ctx *server.Context) (interface{}, int) {
 	if r.Since == 0 {
 		items, err = ctx.Indexer.ListBigmapKeys(ctx.Context, r)
 	} else {
-		items, err = ctx.Indexer.ListHistoricBigmapKeys(ctx.Context, r)
+		items = listHistoricBigmapKeys(ctx, r)
 	}
 	if err != nil {
 		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
@@ -335,15 +394,188 @@ func ListBigmapValues(ctx *server.Context) (interface{}, int) {
 
 	keyType, valueType := alloc.GetKeyType(), alloc.GetValueType()
 	contract := ctx.Indexer.LookupAddress(ctx, alloc.AccountId)
+	resp.list = decodeBigmapValues(ctx, items, func(v *model.BigmapValue) *BigmapValue {
+		key, err := v.GetKey(keyType)
+		if err != nil {
+			log.Errorf("explorer: decode bigmap key: %v", err)
+			return nil
+		}
+		keyHash := v.GetKeyHash()
+		val := &BigmapValue{
+			Key:     &key,
+			KeyHash: &keyHash,
+		}
+		if args.WithMeta() {
+			val.Meta = &BigmapMeta{
+				Contract:     contract,
+				BigmapId:     alloc.BigmapId,
+				UpdateHeight: v.Height,
+				UpdateTime:   ctx.Indexer.LookupBlockTime(ctx, v.Height),
+			}
+		}
+		if args.WithPrim() {
+			typedValue := v.GetValue(valueType)
+			val.KeyPrim = key.PrimPtr()
+			val.ValuePrim = &typedValue.Value
+		}
+		if args.WithUnpack() && val.Key.IsPacked() {
+			if up, err := val.Key.Unpack(); err == nil {
+				val.Key = &up
+			}
+		}
+		setBigmapValue(ctx, val, v, valueType, args.WithUnpack())
+		if args.Creators {
+			val.Contracts = embeddedContracts(ctx, v)
+		}
+		return val
+	})
+
+	return resp, http.StatusOK
+}
+
+// BigmapValueSize is a live bigmap key with the encoded size of its value.
+type BigmapValueSize struct {
+	Key          micheline.Key   `json:"key"`
+	KeyHash      mavryk.ExprHash `json:"hash"`
+	KeyPrim      *micheline.Prim `json:"key_prim,omitempty"`
+	Size         int             `json:"size"`
+	UpdateHeight int64           `json:"update_height"`
+}
+
+// ListLargestBigmapValues lists live keys with the largest values to find
+// storage hotspots. Use limit to control the number of keys.
+func ListLargestBigmapValues(ctx *server.Context) (interface{}, int) {
+	args := &ContractRequest{}
+	ctx.ParseRequestArgs(args)
+	alloc := loadBigmap(ctx)
+
+	items, err := ctx.Indexer.ListLargestBigmapValues(ctx.Context, alloc.BigmapId, int(ctx.Cfg.ClampExplore(args.Limit)))
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+	keyType := alloc.GetKeyType()
+	resp := make([]BigmapValueSize, 0, len(items))
 	for _, v := range items {
 		key, err := v.GetKey(keyType)
 		if err != nil {
 			log.Errorf("explorer: decode bigmap key: %v", err)
 			continue
 		}
+		val := BigmapValueSize{
+			KeyHash:      v.GetKeyHash(),
+			Size:         int(v.Size),
+			UpdateHeight: v.Height,
+		}
+		if args.WithPrim() {
+			val.KeyPrim = key.PrimPtr()
+		}
+		if args.WithUnpack() && key.IsPacked() {
+			if up, err := key.Unpack(); err == nil {
+				key = up
+			}
+		}
+		val.Key = key
+		resp = append(resp, val)
+	}
+	return resp, http.StatusOK
+}
+
+type BigmapPrefixRequest struct {
+	ContractRequest
+
+	Key string `schema:"key"` // left-most component of a pair key
+}
+
+// ListBigmapPrefixValues lists live values of a pair-keyed bigmap whose left key
+// component matches the `key` argument (e.g. all token ids held by an owner in an
+// FA2 ledger). This is a full scan over the bigmap's live keys, so it's expensive
+// on large bigmaps. Supports limit, offset and cursor.
+func ListBigmapPrefixValues(ctx *server.Context) (interface{}, int) {
+	args := &BigmapPrefixRequest{}
+	ctx.ParseRequestArgs(args)
+	alloc := loadBigmap(ctx)
+
+	prefix := parseBigmapKeyPrefix(ctx, alloc.GetKeyType(), args.Key)
+
+	r := etl.ListRequest{
+		BigmapId: alloc.BigmapId,
+		Cursor:   args.Cursor,
+		Offset:   args.Offset,
+		Limit:    ctx.Cfg.ClampExplore(args.Limit),
+		Order:    args.Order,
+	}
+
+	items, err := ctx.Indexer.ListBigmapPrefixKeys(ctx.Context, r, prefix)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+
+	return newBigmapValueList(ctx, alloc, items, &args.ContractRequest), http.StatusOK
+}
+
+type BigmapRangeRequest struct {
+	ContractRequest
+
+	Min uint64  `schema:"min"` // lower bound (inclusive)
+	Max *uint64 `schema:"max"` // upper bound (inclusive), default unbounded
+}
+
+// ListBigmapRangeValues lists live values whose numeric key lies in the range
+// [min, max]. Applies to nat or int keys and pair keys whose left-most
+// component is numeric (e.g. token ids). Nat keyed bigmaps use an indexed
+// column, other key types require a full scan. Supports limit, offset and
+// cursor.
+func ListBigmapRangeValues(ctx *server.Context) (interface{}, int) {
+	args := &BigmapRangeRequest{}
+	ctx.ParseRequestArgs(args)
+	alloc := loadBigmap(ctx)
+
+	keyType := alloc.GetKeyType()
+	if !etl.IsNatRangeKeyType(keyType) {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "bigmap key is not numeric", nil))
+	}
+	from, to := args.Min, uint64(math.MaxUint64)
+	if args.Max != nil {
+		to = *args.Max
+	}
+	if to < from {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid key range", nil))
+	}
+
+	r := etl.ListRequest{
+		BigmapId: alloc.BigmapId,
+		Cursor:   args.Cursor,
+		Offset:   args.Offset,
+		Limit:    ctx.Cfg.ClampExplore(args.Limit),
+		Order:    args.Order,
+	}
+
+	items, err := ctx.Indexer.ListBigmapNatRangeKeys(ctx.Context, r, keyType, from, to)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+	return newBigmapValueList(ctx, alloc, items, &args.ContractRequest), http.StatusOK
+}
+
+// newBigmapValueList renders live values with typed key and value.
+func newBigmapValueList(ctx *server.Context, alloc *model.BigmapAlloc, items []*model.BigmapValue, args *ContractRequest) *BigmapValueList {
+	keyType, valueType := alloc.GetKeyType(), alloc.GetValueType()
+	resp := &BigmapValueList{
+		list:     make([]BigmapValue, 0, len(items)),
+		expires:  ctx.Expires,
+		modified: ctx.Indexer.LookupBlockTime(ctx, alloc.Updated),
+	}
+
+	contract := ctx.Indexer.LookupAddress(ctx, alloc.AccountId)
+	resp.list = decodeBigmapValues(ctx, items, func(v *model.BigmapValue) *BigmapValue {
+		key, err := v.GetKey(keyType)
+		if err != nil {
+			log.Errorf("explorer: decode bigmap key: %v", err)
+			return nil
+		}
 		keyHash := v.GetKeyHash()
 		typedValue := v.GetValue(valueType)
-		val := BigmapValue{
+		val := &BigmapValue{
 			Key:     &key,
 			KeyHash: &keyHash,
 			Value:   &typedValue,
@@ -360,8 +592,132 @@ func ListBigmapValues(ctx *server.Context) (interface{}, int) {
 			val.KeyPrim = key.PrimPtr()
 			val.ValuePrim = &typedValue.Value
 		}
+		if args.WithUnpack() && val.Value.IsPackedAny() {
+			if up, err := val.Value.UnpackAll(); err == nil {
+				val.Value = &up
+			}
+		}
+		return val
+	})
+
+	return resp
+}
+
+// decodeBigmapValues renders bigmap values with fn and returns them in input
+// order, skipping nil results. When parallel decoding is enabled fn runs on
+// multiple workers, so it must be safe for concurrent use, and typed values
+// are encoded to JSON on the workers because most of the decoding cost is
+// spent walking the value type during encoding.
+func decodeBigmapValues(ctx *server.Context, items []*model.BigmapValue, fn func(*model.BigmapValue) *BigmapValue) []BigmapValue {
+	workers := ctx.Indexer.BigmapDecodeWorkers()
+	list := make([]BigmapValue, 0, len(items))
+	dec := etl.NewStreamDecoder(ctx, workers,
+		func(v *model.BigmapValue) (*BigmapValue, error) {
+			val := fn(v)
+			if val == nil || val.Value == nil || workers < 2 {
+				return val, nil
+			}
+			buf, err := json.Marshal(val.Value)
+			if err != nil {
+				return nil, err
+			}
+			val.valueJSON = buf
+			val.Value = nil
+			return val, nil
+		},
+		func(val *BigmapValue) error {
+			if val != nil {
+				list = append(list, *val)
+			}
+			return nil
+		},
+	)
+	for _, v := range items {
+		if dec.Submit(v) != nil {
+			break
+		}
+	}
+	if err := dec.Close(); err != nil {
+		panic(server.EInternal(server.EC_SERVER, "cannot decode bigmap values", err))
+	}
+	return list
+}
+
+type BigmapRecentRequest struct {
+	ContractRequest
+
+	From int64 `schema:"from"` // first height of the update window
+	To   int64 `schema:"to"`   // last height of the update window
+}
+
+// ListBigmapRecentValues lists keys updated or removed within a height window
+// together with their current live value. Keys touched multiple times are
+// reported once at their latest update. Removed keys have no value.
+func ListBigmapRecentValues(ctx *server.Context) (interface{}, int) {
+	args := &BigmapRecentRequest{}
+	ctx.ParseRequestArgs(args)
+	alloc := loadBigmap(ctx)
+
+	if args.From <= 0 {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing from height", nil))
+	}
+	if args.To > 0 && args.To < args.From {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid height range", nil))
+	}
+
+	r := etl.ListRequest{
+		BigmapId: alloc.BigmapId,
+		Since:    args.From,
+		Until:    args.To,
+		Offset:   args.Offset,
+		Limit:    ctx.Cfg.ClampExplore(args.Limit),
+		Order:    args.Order,
+	}
+
+	items, err := ctx.Indexer.ListBigmapRecentKeys(ctx.Context, r)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+
+	resp := &BigmapValueList{
+		list:     make([]BigmapValue, 0, len(items)),
+		expires:  ctx.Expires,
+		modified: ctx.Indexer.LookupBlockTime(ctx, alloc.Updated),
+	}
+
+	keyType, valueType := alloc.GetKeyType(), alloc.GetValueType()
+	contract := ctx.Indexer.LookupAddress(ctx, alloc.AccountId)
+	for _, v := range items {
+		key, err := v.Update.GetKey(keyType)
+		if err != nil {
+			log.Errorf("explorer: decode bigmap key: %v", err)
+			continue
+		}
+		keyHash := v.Update.GetKeyHash()
+		val := BigmapValue{
+			Key:     &key,
+			KeyHash: &keyHash,
+		}
+		if v.Live != nil {
+			typedValue := v.Live.GetValue(valueType)
+			val.Value = &typedValue
+		}
+		if args.WithMeta() {
+			val.Meta = &BigmapMeta{
+				Contract:     contract,
+				BigmapId:     alloc.BigmapId,
+				UpdateHeight: v.Update.Height,
+				UpdateTime:   v.Update.Timestamp,
+			}
+		}
+		if args.WithPrim() {
+			val.KeyPrim = key.PrimPtr()
+			if val.Value != nil {
+				val.ValuePrim = &val.Value.Value
+			}
+		}
 		if args.WithUnpack() {
-			if val.Value.IsPackedAny() {
+			if val.Value != nil && val.Value.IsPackedAny() {
 				if up, err := val.Value.UnpackAll(); err == nil {
 					val.Value = &up
 				}
@@ -400,7 +756,7 @@ func ReadBigmapValue(ctx *server.Context) (interface{}, int) {
 	if r.Since == 0 {
 		items, err = ctx.Indexer.ListBigmapKeys(ctx.Context, r)
 	} else {
-		items, err = ctx.Indexer.ListHistoricBigmapKeys(ctx.Context, r)
+		items = listHistoricBigmapKeys(ctx, r)
 	}
 	if err != nil {
 		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
@@ -415,12 +771,10 @@ func ReadBigmapValue(ctx *server.Context) (interface{}, int) {
 	}
 
 	keyHash := v.GetKeyHash()
-	typedValue := v.GetValue(valType)
 
 	resp := &BigmapValue{
 		Key:      &key,
 		KeyHash:  &keyHash,
-		Value:    &typedValue,
 		modified: ctx.Indexer.LookupBlockTime(ctx, v.Height),
 		expires:  ctx.Expires,
 	}
@@ -433,22 +787,183 @@ func ReadBigmapValue(ctx *server.Context) (interface{}, int) {
 		}
 	}
 	if args.WithPrim() {
+		typedValue := v.GetValue(valType)
 		resp.KeyPrim = key.PrimPtr()
 		resp.ValuePrim = &typedValue.Value
 	}
-	if args.WithUnpack() {
-		if resp.Value.IsPackedAny() {
-			if up, err := resp.Value.UnpackAll(); err == nil {
-				resp.Value = &up
-			}
+	if args.WithUnpack() && resp.Key.IsPacked() {
+		if up, err := resp.Key.Unpack(); err == nil {
+			resp.Key = &up
+		}
+	}
+	setBigmapValue(ctx, resp, v, valType, args.WithUnpack())
+	if args.Creators {
+		resp.Contracts = embeddedContracts(ctx, v)
+	}
+
+	return resp.encode(), http.StatusOK
+}
+
+// setBigmapValue decodes the typed value of v into val. When the indexer's
+// value cache is enabled, the encoded natural JSON is reused across calls
+// since decoding large values is expensive.
+func setBigmapValue(ctx *server.Context, val *BigmapValue, v *model.BigmapValue, typ micheline.Type, unpack bool) {
+	if buf, ok := ctx.Indexer.LookupBigmapValueJSON(v, unpack); ok {
+		val.valueJSON = buf
+		return
+	}
+	typedValue := v.GetValue(typ)
+	val.Value = &typedValue
+	if unpack && val.Value.IsPackedAny() {
+		if up, err := val.Value.UnpackAll(); err == nil {
+			val.Value = &up
+		}
+	}
+	if !ctx.Indexer.CanCacheBigmapValues() {
+		return
+	}
+	buf, err := json.Marshal(val.Value)
+	if err != nil {
+		return
+	}
+	ctx.Indexer.CacheBigmapValueJSON(v, unpack, buf)
+	val.valueJSON = buf
+	val.Value = nil
+}
+
+// max number of embedded contracts resolved per bigmap value
+const maxEmbeddedContracts = 16
+
+// EmbeddedContract is a contract referenced in a bigmap key or value,
+// e.g. a contract created by a factory, with its creator.
+type EmbeddedContract struct {
+	Address mavryk.Address `json:"address"`
+	Creator mavryk.Address `json:"creator"`
+	Height  int64          `json:"first_seen"`
+	Time    time.Time      `json:"first_seen_time"`
+}
+
+// embeddedContracts resolves creator and origination height of contracts
+// referenced in the key or value of v, including packed data. Addresses
+// of unknown contracts are skipped.
+func embeddedContracts(ctx *server.Context, v *model.BigmapValue) []*EmbeddedContract {
+	addrs := make([]mavryk.Address, 0)
+	seen := make(map[mavryk.Address]struct{})
+	walk := rpc.EmbeddedAddressWalker(func(a mavryk.Address) {
+		if _, ok := seen[a]; ok || !a.IsContract() || len(addrs) == maxEmbeddedContracts {
+			return
+		}
+		seen[a] = struct{}{}
+		addrs = append(addrs, a)
+	})
+	for _, buf := range [][]byte{v.Key, v.Value} {
+		var p micheline.Prim
+		if err := p.UnmarshalBinary(buf); err != nil {
+			continue
 		}
-		if resp.Key.IsPacked() {
-			if up, err := resp.Key.Unpack(); err == nil {
-				resp.Key = &up
+		if p.IsPacked() {
+			if up, err := p.Unpack(); err == nil {
+				p = up
 			}
 		}
+		_ = p.Walk(walk)
 	}
 
+	list := make([]*EmbeddedContract, 0, len(addrs))
+	for _, a := range addrs {
+		cc, err := ctx.Indexer.LookupContract(ctx, a)
+		if err != nil {
+			continue
+		}
+		list = append(list, &EmbeddedContract{
+			Address: a,
+			Creator: ctx.Indexer.LookupAddress(ctx, cc.CreatorId),
+			Height:  cc.FirstSeen,
+			Time:    ctx.Indexer.LookupBlockTime(ctx, cc.FirstSeen),
+		})
+	}
+	return list
+}
+
+type BigmapSeriesRequest struct {
+	ContractRequest
+
+	Step string `schema:"step"` // sample distance in blocks, e.g. 1000blocks
+	From int64  `schema:"from"` // first height, default bigmap allocation
+	To   int64  `schema:"to"`   // last height, default current block
+}
+
+// BigmapSample is a key's value at a sampled height, Value is null when the
+// key did not exist yet or was removed.
+type BigmapSample struct {
+	Height int64            `json:"height"`
+	Time   time.Time        `json:"time"`
+	Value  *micheline.Value `json:"value"`
+}
+
+// parseBlockStep parses a step in blocks with an optional `blocks` suffix.
+func parseBlockStep(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSuffix(s, "blocks"), 10, 64)
+	if err == nil && n <= 0 {
+		err = fmt.Errorf("step must be positive")
+	}
+	return n, err
+}
+
+// ListBigmapValueSeries returns the value of a bigmap key at regular height
+// intervals between `from` and `to`, for example to chart an oracle value
+// over time. The number of samples is capped by limit, continue with a
+// later `from` to read more.
+func ListBigmapValueSeries(ctx *server.Context) (interface{}, int) {
+	args := &BigmapSeriesRequest{}
+	ctx.ParseRequestArgs(args)
+	alloc := loadBigmap(ctx)
+	keyType, valType := alloc.GetKeyType(), alloc.GetValueType()
+	expr := parseBigmapKey(ctx, keyType.OpCode)
+
+	if args.Step == "" {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing step", nil))
+	}
+	step, err := parseBlockStep(args.Step)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid step %q", args.Step), err))
+	}
+	from, to := max(args.From, alloc.Height), args.To
+	if to <= 0 || to > ctx.Tip.BestHeight {
+		to = ctx.Tip.BestHeight
+	}
+	if alloc.Deleted > 0 && to > alloc.Deleted {
+		to = alloc.Deleted
+	}
+	if to < from {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid height range", nil))
+	}
+	if limit := int64(ctx.Cfg.ClampExplore(args.Limit)); (to-from)/step >= limit {
+		to = from + (limit-1)*step
+	}
+
+	series, err := ctx.Indexer.BigmapValueSeries(ctx.Context, alloc.BigmapId, expr, from, to, step)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+
+	resp := make([]BigmapSample, len(series))
+	for i, v := range series {
+		resp[i] = BigmapSample{
+			Height: v.Height,
+			Time:   ctx.Indexer.LookupBlockTime(ctx, v.Height),
+		}
+		if v.Value == nil {
+			continue
+		}
+		typedValue := v.Value.GetValue(valType)
+		if args.WithUnpack() && typedValue.IsPackedAny() {
+			if up, err := typedValue.UnpackAll(); err == nil {
+				typedValue = up
+			}
+		}
+		resp[i].Value = &typedValue
+	}
 	return resp, http.StatusOK
 }
 
@@ -589,6 +1104,239 @@ func ListBigmapUpdates(ctx *server.Context) (interface{}, int) {
 	return resp, http.StatusOK
 }
 
+type BigmapFeedRequest struct {
+	ContractRequest
+	Action   string         `schema:"action"`   // comma separated list of alloc, update, remove, copy
+	Decode   bool           `schema:"decode"`   // decode keys and values using bigmap types
+	Contract mavryk.Address `schema:"contract"` // updates from ops targeting this contract
+}
+
+// ListBigmapUpdateFeed returns the latest updates across all bigmaps, newest
+// first, joined with the owning contract. Keys and values are only decoded
+// when requested and the bigmap type is known. The sender and contract filters
+// select updates caused by operations from an account or to a contract.
+func ListBigmapUpdateFeed(ctx *server.Context) (interface{}, int) {
+	args := &BigmapFeedRequest{}
+	ctx.ParseRequestArgs(args)
+
+	var actions []micheline.DiffAction
+	if args.Action != "" {
+		for _, v := range strings.Split(args.Action, ",") {
+			a, err := micheline.ParseDiffAction(v)
+			if err != nil {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid action %q", v), err))
+			}
+			actions = append(actions, a)
+		}
+	}
+
+	r := etl.ListRequest{
+		Since:  args.SinceHeight + 1,
+		Until:  args.BlockHeight,
+		Cursor: args.Cursor,
+		Offset: args.Offset,
+		Limit:  ctx.Cfg.ClampExplore(args.Limit),
+	}
+	if args.Sender.IsValid() {
+		id, err := ctx.Indexer.LookupAccountId(ctx, args.Sender)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such sender account", err))
+		}
+		r.SenderId = id
+	}
+	if args.Contract.IsValid() {
+		id, err := ctx.Indexer.LookupAccountId(ctx, args.Contract)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such contract", err))
+		}
+		r.ReceiverId = id
+	}
+	items, err := ctx.Indexer.ListBigmapUpdateFeed(ctx.Context, r, actions)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap updates", err))
+	}
+
+	// lookup ops for hash and sender
+	opCache := make(map[model.OpID]*model.Op)
+	if len(items) > 0 {
+		opIds := make([]uint64, 0, len(items))
+		for _, v := range items {
+			opIds = append(opIds, v.OpId.U64())
+		}
+		ops, err := ctx.Indexer.LookupOpIds(ctx, vec.UniqueUint64Slice(opIds))
+		if err != nil {
+			log.Errorf("%s: missing ops in %#v", ctx.RequestString(), opIds)
+		} else {
+			for _, v := range ops {
+				opCache[v.RowId] = v
+			}
+		}
+	}
+
+	resp := &BigmapUpdateList{
+		diff:    make([]BigmapUpdate, 0, len(items)),
+		expires: ctx.Expires,
+	}
+	allocs := make(map[int64]*model.BigmapAlloc)
+	for _, v := range items {
+		// bigmap ids of copies are stored as destination
+		alloc, ok := allocs[v.BigmapId]
+		if !ok {
+			alloc, _ = ctx.Indexer.LookupBigmapType(ctx, v.BigmapId)
+			allocs[v.BigmapId] = alloc
+		}
+		upd := BigmapUpdate{
+			Action:   v.Action,
+			BigmapId: v.BigmapId,
+		}
+		switch v.Action {
+		case micheline.DiffActionAlloc, micheline.DiffActionCopy:
+			if v.Action == micheline.DiffActionCopy {
+				upd.SourceId = int64(v.KeyId)
+				upd.DestId = v.BigmapId
+			}
+			if args.Decode {
+				kt, vt := v.GetKeyType(), v.GetValueType()
+				upd.KeyType = kt.TypedefPtr(micheline.CONST_KEY)
+				upd.ValueType = vt.TypedefPtr(micheline.CONST_VALUE)
+				if args.WithPrim() {
+					upd.KeyTypePrim = &kt.Prim
+					upd.ValueTypePrim = &vt.Prim
+				}
+			}
+
+		case micheline.DiffActionUpdate, micheline.DiffActionRemove:
+			// key is empty when entire bigmap is removed
+			if len(v.Key) == 0 {
+				break
+			}
+			keyHash := v.GetKeyHash()
+			upd.KeyHash = &keyHash
+			if !args.Decode || alloc == nil {
+				break
+			}
+			key, err := v.GetKey(alloc.GetKeyType())
+			if err == nil {
+				upd.Key = &key
+				if args.WithPrim() {
+					upd.KeyPrim = key.PrimPtr()
+				}
+			}
+			if v.Action == micheline.DiffActionUpdate {
+				typedValue := v.GetValue(alloc.GetValueType())
+				upd.Value = &typedValue
+				if args.WithPrim() {
+					upd.ValuePrim = &typedValue.Value
+				}
+			}
+			if args.WithUnpack() {
+				if upd.Value != nil && upd.Value.IsPackedAny() {
+					if up, err := upd.Value.UnpackAll(); err == nil {
+						upd.Value = &up
+					}
+				}
+				if upd.Key != nil && upd.Key.IsPacked() {
+					if up, err := upd.Key.Unpack(); err == nil {
+						upd.Key = &up
+					}
+				}
+			}
+		}
+		upd.BigmapValue.Meta = &BigmapMeta{
+			BigmapId:     v.BigmapId,
+			UpdateTime:   v.Timestamp,
+			UpdateHeight: v.Height,
+		}
+		if alloc != nil {
+			upd.BigmapValue.Meta.Contract = ctx.Indexer.LookupAddress(ctx, alloc.AccountId)
+		}
+		if op, ok := opCache[v.OpId]; ok {
+			upd.BigmapValue.Meta.UpdateOp = op.Hash
+			upd.BigmapValue.Meta.Sender = ctx.Indexer.LookupAddress(ctx, op.SenderId)
+			if op.CreatorId != 0 {
+				upd.BigmapValue.Meta.Source = ctx.Indexer.LookupAddress(ctx, op.CreatorId)
+			} else {
+				upd.BigmapValue.Meta.Source = upd.BigmapValue.Meta.Sender
+			}
+		}
+		resp.diff = append(resp.diff, upd)
+		if v.Timestamp.After(resp.modified) {
+			resp.modified = v.Timestamp
+		}
+	}
+
+	return resp, http.StatusOK
+}
+
+type BigmapOp struct {
+	OpId     uint64         `json:"op_id"`
+	Hash     mavryk.OpHash  `json:"hash"`
+	Type     model.OpType   `json:"type"`
+	Height   int64          `json:"height"`
+	Time     time.Time      `json:"time"`
+	Sender   mavryk.Address `json:"sender"`
+	NUpdates int            `json:"n_updates"`
+	Actions  map[string]int `json:"actions"`
+}
+
+// ListBigmapOps lists operations that updated a bigmap, one row per
+// operation with a summary of produced update actions.
+func ListBigmapOps(ctx *server.Context) (interface{}, int) {
+	args := &ContractRequest{}
+	ctx.ParseRequestArgs(args)
+	alloc := loadBigmap(ctx)
+	r := etl.ListRequest{
+		BigmapId: alloc.BigmapId,
+		Since:    args.SinceHeight + 1,
+		Until:    args.BlockHeight,
+		Cursor:   args.Cursor,
+		Offset:   args.Offset,
+		Limit:    ctx.Cfg.ClampExplore(args.Limit),
+		Order:    args.Order,
+	}
+	items, err := ctx.Indexer.ListBigmapOps(ctx.Context, r)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap ops", err))
+	}
+
+	opCache := make(map[model.OpID]*model.Op)
+	if len(items) > 0 {
+		opIds := make([]uint64, 0, len(items))
+		for _, v := range items {
+			opIds = append(opIds, v.OpId.U64())
+		}
+		ops, err := ctx.Indexer.LookupOpIds(ctx, opIds)
+		if err != nil {
+			log.Errorf("%s: missing ops in %#v", ctx.RequestString(), opIds)
+		} else {
+			for _, v := range ops {
+				opCache[v.RowId] = v
+			}
+		}
+	}
+
+	resp := make([]BigmapOp, 0, len(items))
+	for _, v := range items {
+		bop := BigmapOp{
+			OpId:     v.OpId.U64(),
+			Height:   v.Height,
+			Time:     ctx.Indexer.LookupBlockTime(ctx, v.Height),
+			NUpdates: v.NUpdates,
+			Actions:  make(map[string]int, len(v.Actions)),
+		}
+		for a, n := range v.Actions {
+			bop.Actions[a.String()] = n
+		}
+		if op, ok := opCache[v.OpId]; ok {
+			bop.Hash = op.Hash
+			bop.Type = op.Type
+			bop.Sender = ctx.Indexer.LookupAddress(ctx, op.SenderId)
+		}
+		resp = append(resp, bop)
+	}
+	return resp, http.StatusOK
+}
+
 func ListBigmapKeyUpdates(ctx *server.Context) (interface{}, int) {
 	args := &ContractRequest{}
 	ctx.ParseRequestArgs(args)
@@ -707,3 +1455,89 @@ func ListBigmapKeyUpdates(ctx *server.Context) (interface{}, int) {
 
 	return resp, http.StatusOK
 }
+
+// listHistoricBigmapKeys reads bigmap keys live at a past height. The number of
+// updates replayed to build the historic state is exposed as response header.
+func listHistoricBigmapKeys(ctx *server.Context, r etl.ListRequest) []*model.BigmapValue {
+	items, n, err := ctx.Indexer.ListHistoricBigmapKeys(ctx.Context, r)
+	if err != nil {
+		var e *cache.BudgetError
+		if errors.As(err, &e) {
+			panic(server.EServiceUnavailable(server.EC_SERVER,
+				"bigmap history too large, query a height close to an earlier request or the current state", err))
+		}
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+	ctx.ResponseWriter.Header().Set("X-Bigmap-History-Updates", strconv.Itoa(n))
+	return items
+}
+
+type BigmapChurnRequest struct {
+	ListRequest
+
+	Step string `schema:"step"` // blocks per sample, default 1
+	From int64  `schema:"from"` // first height, default bigmap allocation
+	To   int64  `schema:"to"`   // last height, default current block
+}
+
+type BigmapChurn struct {
+	Height   int64     `json:"height"`
+	Time     time.Time `json:"time"`
+	NUpdated int       `json:"n_updated"`
+	NKeys    int       `json:"n_keys"`
+	Churn    float64   `json:"churn"`
+}
+
+// ListBigmapChurn returns the share of a bigmap's live keys that changed
+// per block between `from` and `to` to find contracts that rewrite much of
+// their storage. With `step` each sample covers multiple blocks and counts
+// every key once. The number of samples is capped by limit, continue with
+// a later `from` to read more.
+func ListBigmapChurn(ctx *server.Context) (interface{}, int) {
+	args := &BigmapChurnRequest{}
+	ctx.ParseRequestArgs(args)
+	alloc := loadBigmap(ctx)
+
+	step := int64(1)
+	if args.Step != "" {
+		var err error
+		step, err = parseBlockStep(args.Step)
+		if err != nil {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid step %q", args.Step), err))
+		}
+	}
+	from, to := max(args.From, alloc.Height), args.To
+	if to <= 0 || to > ctx.Tip.BestHeight {
+		to = ctx.Tip.BestHeight
+	}
+	if alloc.Deleted > 0 && to > alloc.Deleted {
+		to = alloc.Deleted
+	}
+	if to < from {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid height range", nil))
+	}
+	if limit := int64(ctx.Cfg.ClampExplore(args.Limit)); (to-from)/step >= limit {
+		to = from + limit*step - 1
+	}
+
+	list, err := ctx.Indexer.BigmapChurn(ctx.Context, alloc.BigmapId, from, to, step)
+	if err != nil {
+		var e *cache.BudgetError
+		if errors.As(err, &e) {
+			panic(server.EServiceUnavailable(server.EC_SERVER,
+				"bigmap history too large, use a later from height", err))
+		}
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+	resp := make([]BigmapChurn, len(list))
+	for i, v := range list {
+		resp[i] = BigmapChurn{
+			Height:   v.Height,
+			Time:     ctx.Indexer.LookupBlockTime(ctx, v.Height),
+			NUpdated: v.NUpdated,
+			NKeys:    v.NKeys,
+			Churn:    v.Ratio,
+		}
+	}
+	return resp, http.StatusOK
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type BigmapLifecycleEvent struct {
+	Action      string          `json:"action"`              // alloc, copy_from, copy_to, remove
+	SourceId    *int64          `json:"source_id,omitempty"` // copy_from only
+	DestId      *int64          `json:"dest_id,omitempty"`   // copy_to only
+	Contract    *mavryk.Address `json:"contract,omitempty"`  // owner of the copy source or destination
+	Via         *int64          `json:"via,omitempty"`       // temporary bigmap the copy passed through
+	IsEphemeral bool            `json:"ephemeral,omitempty"` // copy source or destination is temporary
+	Height      int64           `json:"height"`
+	Time        time.Time       `json:"time"`
+	OpHash      mavryk.OpHash   `json:"op_hash"`
+}
+
+type BigmapLifecycle struct {
+	BigmapId     int64                  `json:"bigmap_id"`
+	Contract     mavryk.Address         `json:"contract"`
+	AllocHeight  int64                  `json:"alloc_height"`
+	DeleteHeight int64                  `json:"delete_height,omitempty"`
+	NUpdates     int64                  `json:"n_updates"`
+	NKeys        int64                  `json:"n_keys"`
+	NCopiesOut   int                    `json:"n_copies_out"`
+	IsCopy       bool                   `json:"is_copy"`
+	IsRemoved    bool                   `json:"is_removed"`
+	Events       []BigmapLifecycleEvent `json:"events"`
+}
+
+// ReadBigmapLifecycle lists structural events of a bigmap: its alloc or the
+// copy it was created from, copies into other bigmaps and its removal. Copies
+// through temporary bigmaps are resolved where the temporary bigmap left copy
+// records and are otherwise listed as ephemeral.
+func ReadBigmapLifecycle(ctx *server.Context) (interface{}, int) {
+	alloc := loadBigmap(ctx)
+	list, err := ctx.Indexer.ListBigmapLifecycle(ctx, alloc)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap lifecycle", err))
+	}
+	resp := &BigmapLifecycle{
+		BigmapId:     alloc.BigmapId,
+		Contract:     ctx.Indexer.LookupAddress(ctx, alloc.AccountId),
+		AllocHeight:  alloc.Height,
+		DeleteHeight: alloc.Deleted,
+		NUpdates:     alloc.NUpdates,
+		NKeys:        alloc.NKeys,
+		Events:       make([]BigmapLifecycleEvent, 0, len(list)),
+	}
+	for _, upd := range list {
+		ev := newBigmapLifecycleEvent(ctx, upd)
+		switch upd.Action {
+		case micheline.DiffActionAlloc:
+			ev.Action = "alloc"
+		case micheline.DiffActionRemove:
+			ev.Action = "remove"
+			resp.IsRemoved = true
+		case micheline.DiffActionCopy:
+			if upd.BigmapId == alloc.BigmapId {
+				// copy creating this bigmap, resolve the source of temporary
+				// bigmaps created earlier in the same block
+				resp.IsCopy = true
+				ev.Action = "copy_from"
+				src := int64(upd.KeyId)
+				ev.SourceId = &src
+				if src < 0 {
+					ev.IsEphemeral = true
+					tmp, err := ctx.Indexer.FindBigmapCopy(ctx, src, upd.Height, upd.OpId)
+					if err != nil {
+						panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap copies", err))
+					}
+					if tmp != nil && int64(tmp.KeyId) >= 0 {
+						orig := int64(tmp.KeyId)
+						ev.SourceId, ev.Via, ev.IsEphemeral = &orig, &src, false
+					}
+				}
+				if !ev.IsEphemeral {
+					ev.Contract = lookupBigmapOwner(ctx, *ev.SourceId)
+				}
+				break
+			}
+
+			// copy out of this bigmap
+			ev.Action = "copy_to"
+			dst := upd.BigmapId
+			ev.DestId = &dst
+			if dst >= 0 {
+				ev.Contract = lookupBigmapOwner(ctx, dst)
+				resp.NCopiesOut++
+				break
+			}
+
+			// copy into a temporary bigmap, list its copies instead when
+			// they are indexed
+			copies, err := ctx.Indexer.ListTempBigmapCopies(ctx, upd)
+			if err != nil {
+				panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap copies", err))
+			}
+			if len(copies) == 0 {
+				ev.IsEphemeral = true
+				break
+			}
+			for _, v := range copies {
+				cp := newBigmapLifecycleEvent(ctx, v)
+				cp.Action = "copy_to"
+				dst := v.BigmapId
+				cp.DestId, cp.Via = &dst, &upd.BigmapId
+				if dst < 0 {
+					cp.IsEphemeral = true
+				} else {
+					cp.Contract = lookupBigmapOwner(ctx, dst)
+					resp.NCopiesOut++
+				}
+				resp.Events = append(resp.Events, cp)
+			}
+			continue
+		default:
+			continue
+		}
+		resp.Events = append(resp.Events, ev)
+	}
+	return resp, http.StatusOK
+}
+
+func newBigmapLifecycleEvent(ctx *server.Context, upd *model.BigmapUpdate) BigmapLifecycleEvent {
+	return BigmapLifecycleEvent{
+		Height: upd.Height,
+		Time:   upd.Timestamp,
+		OpHash: ctx.Indexer.LookupOpHash(ctx, upd.OpId),
+	}
+}
+
+// lookupBigmapOwner returns the contract owning bigmap id or nil when the
+// bigmap is not indexed.
+func lookupBigmapOwner(ctx *server.Context, id int64) *mavryk.Address {
+	a, err := ctx.Indexer.LookupBigmapAlloc(ctx, id)
+	if err != nil {
+		return nil
+	}
+	addr := ctx.Indexer.LookupAddress(ctx, a.AccountId)
+	return &addr
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/cache"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type BigmapProofRequest struct {
+	Height int64 `schema:"height"` // defaults to current height
+	Unpack bool  `schema:"unpack"` // unpack packed key/values
+	Prim   bool  `schema:"prim"`   // for prim/value rendering
+}
+
+type BigmapKeyProof struct {
+	BigmapId int64           `json:"bigmap_id"`
+	KeyHash  mavryk.ExprHash `json:"hash"`
+	Height   int64           `json:"height"`  // requested height
+	Updates  []BigmapUpdate  `json:"updates"` // updates defining the value at height
+	OpId     model.OpID      `json:"op_id"`   // defining update operation
+	OpHash   mavryk.OpHash   `json:"op_hash"`
+}
+
+// ReadBigmapKeyProof returns the updates that define the value of a single
+// bigmap key at a given height. Since updates store full values, the last
+// update at or before height is sufficient to derive the value without
+// reconstructing the bigmap.
+func ReadBigmapKeyProof(ctx *server.Context) (interface{}, int) {
+	args := &BigmapProofRequest{}
+	ctx.ParseRequestArgs(args)
+	if args.Height < 0 || args.Height > ctx.Tip.BestHeight {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "height out of range", nil))
+	}
+	if args.Height == 0 {
+		args.Height = ctx.Tip.BestHeight
+	}
+
+	alloc := loadBigmap(ctx)
+	if alloc.Height > args.Height || (alloc.Deleted > 0 && alloc.Deleted <= args.Height) {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "bigmap not live at height", nil))
+	}
+	keyType, valType := alloc.GetKeyType(), alloc.GetValueType()
+	expr := parseBigmapKey(ctx, keyType.OpCode)
+
+	items, err := ctx.Indexer.ListBigmapUpdates(ctx.Context, etl.ListRequest{
+		BigmapId:  alloc.BigmapId,
+		BigmapKey: expr,
+		Until:     args.Height,
+		Limit:     1,
+		Order:     pack.OrderDesc,
+	})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+	if len(items) == 0 || items[0].Action == micheline.DiffActionRemove {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such bigmap key at height", nil))
+	}
+	v := items[0]
+
+	key, err := v.GetKey(keyType)
+	if err != nil {
+		panic(server.EInternal(server.EC_SERVER, "cannot decode bigmap key", err))
+	}
+	value := v.GetValue(valType)
+	upd := BigmapUpdate{
+		BigmapValue: BigmapValue{
+			Key:     &key,
+			KeyHash: &expr,
+			Value:   &value,
+			Meta: &BigmapMeta{
+				Contract:     ctx.Indexer.LookupAddress(ctx, alloc.AccountId),
+				BigmapId:     alloc.BigmapId,
+				UpdateTime:   v.Timestamp,
+				UpdateHeight: v.Height,
+				UpdateOp:     ctx.Indexer.LookupOpHash(ctx, v.OpId),
+			},
+		},
+		Action:   v.Action,
+		BigmapId: v.BigmapId,
+	}
+	if args.Prim {
+		upd.KeyPrim = key.PrimPtr()
+		upd.ValuePrim = &value.Value
+	}
+	if args.Unpack {
+		if upd.Value.IsPackedAny() {
+			if up, err := upd.Value.UnpackAll(); err == nil {
+				upd.Value = &up
+			}
+		}
+		if upd.Key.IsPacked() {
+			if up, err := upd.Key.Unpack(); err == nil {
+				upd.Key = &up
+			}
+		}
+	}
+
+	return BigmapKeyProof{
+		BigmapId: alloc.BigmapId,
+		KeyHash:  expr,
+		Height:   args.Height,
+		Updates:  []BigmapUpdate{upd},
+		OpId:     v.OpId,
+		OpHash:   upd.Meta.UpdateOp,
+	}, http.StatusOK
+}
+
+type BigmapCommitmentRequest struct {
+	Height int64 `schema:"height"` // defaults to current height
+}
+
+type BigmapCommitment struct {
+	BigmapId int64  `json:"bigmap_id"`
+	Height   int64  `json:"height"`
+	NumKeys  int    `json:"n_keys"`
+	Root     string `json:"root"`   // hex encoded Merkle root
+	Scheme   string `json:"scheme"` // hashing scheme version
+}
+
+// ReadBigmapCommitment returns a Merkle root over the live key set of a
+// bigmap at a given height. Indexers that agree on contract state produce
+// the same root, see model.BigmapCommitment for the hashing scheme.
+func ReadBigmapCommitment(ctx *server.Context) (interface{}, int) {
+	args := &BigmapCommitmentRequest{}
+	ctx.ParseRequestArgs(args)
+	if args.Height < 0 || args.Height > ctx.Tip.BestHeight {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "height out of range", nil))
+	}
+	if args.Height == 0 {
+		args.Height = ctx.Tip.BestHeight
+	}
+
+	alloc := loadBigmap(ctx)
+	if alloc.Height > args.Height || (alloc.Deleted > 0 && alloc.Deleted <= args.Height) {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "bigmap not live at height", nil))
+	}
+
+	root, n, err := ctx.Indexer.BigmapCommitment(ctx.Context, alloc.BigmapId, args.Height)
+	if err != nil {
+		var e *cache.BudgetError
+		if errors.As(err, &e) {
+			panic(server.EServiceUnavailable(server.EC_SERVER,
+				"bigmap history too large, query a height close to an earlier request or the current state", err))
+		}
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap", err))
+	}
+
+	return BigmapCommitment{
+		BigmapId: alloc.BigmapId,
+		Height:   args.Height,
+		NumKeys:  n,
+		Root:     hex.EncodeToString(root[:]),
+		Scheme:   model.BigmapCommitmentScheme,
+	}, http.StatusOK
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type BigmapProvenance struct {
+	BigmapId    int64           `json:"bigmap_id"`
+	Contract    *mavryk.Address `json:"contract,omitempty"`
+	Action      string          `json:"action,omitempty"`    // alloc or copy, empty when unknown
+	SourceId    *int64          `json:"source_id,omitempty"` // copy source
+	IsEphemeral bool            `json:"ephemeral,omitempty"` // temporary bigmap
+	Height      int64           `json:"height"`
+	Time        time.Time       `json:"time"`
+	OpHash      *mavryk.OpHash  `json:"op_hash,omitempty"`
+}
+
+// ReadBigmapProvenance walks the copy chain of a bigmap backwards from the
+// requested bigmap to its original allocation. Temporary bigmaps are listed
+// as ephemeral links. Their source can only be resolved when the copy into
+// the temporary bigmap was indexed, otherwise the chain ends there.
+func ReadBigmapProvenance(ctx *server.Context) (interface{}, int) {
+	alloc := loadBigmap(ctx)
+	var (
+		id     = alloc.BigmapId
+		height = alloc.Height
+		maxOp  model.OpID
+		seen   = make(map[uint64]struct{})
+		chain  = make([]BigmapProvenance, 0)
+	)
+	for {
+		link := BigmapProvenance{
+			BigmapId:    id,
+			IsEphemeral: id < 0,
+			Height:      height,
+		}
+		if id >= 0 {
+			a, err := ctx.Indexer.LookupBigmapAlloc(ctx, id)
+			if err != nil {
+				switch err {
+				case model.ErrNoBigmap:
+					// source was not indexed
+					chain = append(chain, link)
+					return chain, http.StatusOK
+				default:
+					panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
+				}
+			}
+			addr := ctx.Indexer.LookupAddress(ctx, a.AccountId)
+			link.Contract = &addr
+			link.Height = a.Height
+			link.Time = ctx.Indexer.LookupBlockTime(ctx, a.Height)
+			maxOp = 0
+		}
+
+		upd, err := ctx.Indexer.FindBigmapCopy(ctx, id, link.Height, maxOp)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
+		}
+		if upd == nil {
+			if id >= 0 {
+				link.Action = "alloc"
+			}
+			chain = append(chain, link)
+			break
+		}
+
+		src := int64(upd.KeyId)
+		link.Action = "copy"
+		link.SourceId = &src
+		link.Time = upd.Timestamp
+		opHash := ctx.Indexer.LookupOpHash(ctx, upd.OpId)
+		link.OpHash = &opHash
+		chain = append(chain, link)
+
+		// guard against cycles through reused temporary ids
+		if _, ok := seen[upd.RowId]; ok {
+			break
+		}
+		seen[upd.RowId] = struct{}{}
+		id, height, maxOp = src, upd.Height, upd.OpId
+	}
+	return chain, http.StatusOK
+}
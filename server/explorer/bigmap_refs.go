@@ -0,0 +1,99 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type BigmapRefRequest struct {
+	ListRequest
+
+	BigmapId int64 `schema:"bigmap"` // restrict to a single bigmap
+	Since    int64 `schema:"since"`  // first height (exclusive)
+	Until    int64 `schema:"until"`  // last height (inclusive)
+	Unpack   bool  `schema:"unpack"` // unpack packed keys
+	Prim     bool  `schema:"prim"`   // include key prim
+}
+
+type BigmapRef struct {
+	RowId    uint64          `json:"row_id"`
+	Contract mavryk.Address  `json:"contract"`
+	BigmapId int64           `json:"bigmap_id"`
+	Key      *micheline.Key  `json:"key,omitempty"`
+	KeyHash  mavryk.ExprHash `json:"hash"`
+	Prim     *micheline.Prim `json:"prim,omitempty"`
+	Height   int64           `json:"height"`
+	Time     time.Time       `json:"time"`
+}
+
+// ListAccountBigmapRefs lists bigmap keys whose key or value embeds the
+// account's address. Requires bigmap address indexing (`bigmap.index_addresses`).
+func ListAccountBigmapRefs(ctx *server.Context) (interface{}, int) {
+	args := &BigmapRefRequest{}
+	ctx.ParseRequestArgs(args)
+	acc := loadAccount(ctx)
+
+	r := etl.ListRequest{
+		Account:  acc,
+		BigmapId: args.BigmapId,
+		Since:    args.Since,
+		Until:    args.Until,
+		Cursor:   args.Cursor,
+		Offset:   args.Offset,
+		Limit:    ctx.Cfg.ClampExplore(args.Limit),
+		Order:    args.Order,
+	}
+	refs, err := ctx.Indexer.ListBigmapRefs(ctx, r)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot list bigmap refs", err))
+	}
+	keys, err := ctx.Indexer.LookupBigmapRefKeys(ctx, refs)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap keys", err))
+	}
+
+	resp := make([]BigmapRef, 0, len(refs))
+	allocs := make(map[int64]*model.BigmapAlloc)
+	for _, v := range refs {
+		alloc, ok := allocs[v.BigmapId]
+		if !ok {
+			alloc, err = ctx.Indexer.LookupBigmapAlloc(ctx, v.BigmapId)
+			if err != nil {
+				continue
+			}
+			allocs[v.BigmapId] = alloc
+		}
+		ref := BigmapRef{
+			RowId:    v.RowId,
+			Contract: ctx.Indexer.LookupAddress(ctx, alloc.AccountId),
+			BigmapId: v.BigmapId,
+			Height:   v.Height,
+			Time:     ctx.Indexer.LookupBlockTime(ctx, v.Height),
+		}
+		if upd := keys[v.KeyId]; upd != nil {
+			ref.KeyHash = upd.GetKeyHash()
+			if k, err := upd.GetKey(alloc.GetKeyType()); err == nil {
+				if args.Prim {
+					ref.Prim = k.PrimPtr()
+				}
+				if args.Unpack && k.IsPacked() {
+					if up, err := k.Unpack(); err == nil {
+						k = up
+					}
+				}
+				ref.Key = &k
+			}
+		}
+		resp = append(resp, ref)
+	}
+	return resp, http.StatusOK
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type BigmapTypeRequest struct {
+	ContractRequest
+	KeyType   string `schema:"key_type"`   // Micheline JSON or simple type name, e.g. address
+	ValueType string `schema:"value_type"` // Micheline JSON or simple type name, e.g. nat
+}
+
+func parseBigmapType(name, s string) micheline.Type {
+	if s == "" {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, fmt.Sprintf("missing %s", name), nil))
+	}
+	var prim micheline.Prim
+	if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+		if err := json.Unmarshal([]byte(s), &prim); err != nil {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid %s", name), err))
+		}
+	} else {
+		op, err := micheline.ParseOpCode(s)
+		if err != nil {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid %s", name), err))
+		}
+		prim = micheline.NewPrim(op)
+	}
+	if !prim.IsValid() || !prim.OpCode.IsTypeCode() {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("%s is not a type", name), nil))
+	}
+	return micheline.NewType(prim)
+}
+
+// ListBigmapsByType lists bigmaps whose key and value types structurally
+// match the requested types, e.g. to find all token ledgers of a kind.
+func ListBigmapsByType(ctx *server.Context) (interface{}, int) {
+	args := &BigmapTypeRequest{}
+	ctx.ParseRequestArgs(args)
+	kt := parseBigmapType("key_type", args.KeyType)
+	vt := parseBigmapType("value_type", args.ValueType)
+
+	allocs, err := ctx.Indexer.ListBigmapsByType(ctx, kt, vt, etl.ListRequest{
+		Cursor: args.Cursor,
+		Offset: args.Offset,
+		Limit:  ctx.Cfg.ClampExplore(args.Limit),
+		Order:  args.Order,
+	})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list bigmaps", err))
+	}
+	resp := make([]*Bigmap, 0, len(allocs))
+	for _, v := range allocs {
+		resp = append(resp, NewBigmap(ctx, v, args))
+	}
+	return resp, http.StatusOK
+}
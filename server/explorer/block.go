@@ -71,6 +71,7 @@ type Block struct {
 	AiVote               mavryk.FeatureVote        `json:"ai_vote"`
 	AiEma                int64                     `json:"ai_ema"`
 	Metadata             map[string]*ShortMetadata `json:"metadata,omitempty"`
+	Names                map[string]string         `json:"names,omitempty"`
 	Rights               []Right                   `json:"rights,omitempty"`
 
 	// LEGACY
@@ -231,6 +232,10 @@ func NewBlock(ctx *server.Context, block *model.Block, args server.Options) *Blo
 		}
 	}
 
+	if args.WithNames() {
+		b.Names = lookupNames(ctx, b.Baker, b.Proposer)
+	}
+
 	switch {
 	case b.Height == nowHeight:
 		// cache most recent block only until next block and endorsements are due
@@ -270,7 +275,7 @@ func (b Block) RegisterDirectRoutes(r *mux.Router) error {
 
 func (b Block) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/{ident}", server.C(ReadBlock)).Methods("GET").Name("block")
-	r.HandleFunc("/{ident}/operations", server.C(ListBlockOps)).Methods("GET")
+	r.HandleFunc("/{ident}/operations", server.C(Columnar(ListBlockOps))).Methods("GET")
 
 	// LEGACY
 	r.HandleFunc("/{ident}/op", server.C(ReadBlockOps)).Methods("GET")
@@ -299,8 +304,9 @@ func loadBlock(ctx *server.Context) *model.Block {
 }
 
 type BlockRequest struct {
-	Meta   bool `schema:"meta"`   // include account metadata
-	Rights bool `schema:"rights"` // include rights
+	Meta   bool `schema:"meta"`       // include account metadata
+	Rights bool `schema:"rights"`     // include rights
+	Names  bool `schema:"with_names"` // include domain names
 }
 
 func (r *BlockRequest) WithPrim() bool    { return false }
@@ -310,6 +316,7 @@ func (r *BlockRequest) WithMeta() bool    { return r != nil && r.Meta }
 func (r *BlockRequest) WithRights() bool  { return r != nil && r.Rights }
 func (r *BlockRequest) WithMerge() bool   { return false }
 func (r *BlockRequest) WithStorage() bool { return false }
+func (r *BlockRequest) WithNames() bool   { return r != nil && r.Names }
 
 func ReadBlock(ctx *server.Context) (interface{}, int) {
 	args := &BlockRequest{}
@@ -347,6 +354,11 @@ func listBlockOps(ctx *server.Context) OpList {
 		WithStorage: args.WithStorage(),
 	}
 
+	// merged batches are filtered by their total gas below
+	if !args.WithMerge() {
+		r.MinGas = args.MinGas
+	}
+
 	if args.Sender.IsValid() {
 		if a, err := ctx.Indexer.LookupAccount(ctx.Context, args.Sender); err != nil {
 			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such sender account", err))
@@ -361,6 +373,13 @@ func listBlockOps(ctx *server.Context) OpList {
 			r.ReceiverId = a.RowId
 		}
 	}
+	if args.FeePayer.IsValid() {
+		if a, err := ctx.Indexer.LookupAccount(ctx.Context, args.FeePayer); err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such fee payer account", err))
+		} else {
+			r.PayerId = a.RowId
+		}
+	}
 	if args.Address.IsValid() {
 		if a, err := ctx.Indexer.LookupAccount(ctx.Context, args.Address); err != nil {
 			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such account", err))
@@ -373,7 +392,7 @@ func listBlockOps(ctx *server.Context) OpList {
 		endorse []*model.Endorsement
 		err     error
 	)
-	if args.TypeList.IsEmpty() || args.TypeList.Contains(model.OpTypeEndorsement) {
+	if args.MinGas == 0 && (args.TypeList.IsEmpty() || args.TypeList.Contains(model.OpTypeEndorsement)) {
 		endorse, err = ctx.Indexer.ListBlockEndorsements(ctx, r)
 		if err != nil {
 			panic(server.EInternal(server.EC_DATABASE, "cannot read block endorsements", err))
@@ -395,6 +414,10 @@ func listBlockOps(ctx *server.Context) OpList {
 		}
 		sort.Slice(resp, func(i, j int) bool { return resp[i].OpN < resp[j].OpN })
 	}
+	resp = resp.FilterMinGas(args.MinGas)
+	if args.OrderBy == OrderByGas {
+		resp.SortByGas(args.Order)
+	}
 
 	// apply offset/limit
 	if args.Offset > 0 || args.Limit > 0 {
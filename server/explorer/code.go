@@ -0,0 +1,70 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+func init() {
+	server.Register(Code{})
+}
+
+var _ server.RESTful = (*Code)(nil)
+
+// Code groups contracts by code hash.
+type Code struct{}
+
+func (c Code) RESTPrefix() string {
+	return "/explorer/code"
+}
+
+func (c Code) RESTPath(r *mux.Router) string {
+	return c.RESTPrefix()
+}
+
+func (c Code) RegisterDirectRoutes(r *mux.Router) error {
+	return nil
+}
+
+func (c Code) RegisterRoutes(r *mux.Router) error {
+	r.HandleFunc("/{hash}/contracts", server.C(ListCodeContracts)).Methods("GET")
+	return nil
+}
+
+func parseCodeHash(ctx *server.Context) uint64 {
+	if s, ok := mux.Vars(ctx.Request)["hash"]; !ok || s == "" {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MISSING, "missing code hash", nil))
+	} else {
+		h, err := util.DecodeU64String(s)
+		if err != nil {
+			panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid code hash", err))
+		}
+		return h.U64()
+	}
+}
+
+// ListCodeContracts lists all contracts that share a code hash.
+func ListCodeContracts(ctx *server.Context) (interface{}, int) {
+	args := &ContractRequest{}
+	ctx.ParseRequestArgs(args)
+	hash := parseCodeHash(ctx)
+
+	ccs, err := ctx.Indexer.ListContractsByCodeHash(ctx, hash, etl.ListRequest{
+		Offset: args.Offset,
+		Limit:  ctx.Cfg.ClampExplore(args.Limit),
+		Cursor: args.Cursor,
+		Order:  args.Order,
+	})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read contracts", err))
+	}
+	return newContractList(ctx, ccs, args), http.StatusOK
+}
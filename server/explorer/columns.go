@@ -0,0 +1,170 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const (
+	FormatObjects = "objects" // default, a JSON array of objects
+	FormatColumns = "columns" // parallel arrays, see ColumnList
+	FormatCSV     = "csv"     // comma separated rows, export endpoints only
+)
+
+var _ server.Resource = (*ColumnList)(nil)
+
+// ColumnList renders a list response as parallel arrays, one per field.
+// For n rows the JSON encoding is
+//
+//	{
+//	  "count": n,
+//	  "columns": ["name_0", ..., "name_k"],
+//	  "values": [[v_0_0, ..., v_0_n-1], ..., [v_k_0, ..., v_k_n-1]]
+//	}
+//
+// where values[i][j] is field columns[i] of row j. Field names and value
+// encodings equal the object format. Columns follow the field order of
+// the object format. Fields omitted from a row are null and fields
+// omitted from all rows have no column. Nested objects and lists such as
+// batch or internal operations remain nested.
+type ColumnList struct {
+	list interface{}
+}
+
+// Columnar wraps list API calls so they honor the format query argument.
+func Columnar(f server.ApiCall) server.ApiCall {
+	return func(ctx *server.Context) (interface{}, int) {
+		format := ctx.Request.URL.Query().Get("format")
+		switch format {
+		case "", "json", FormatObjects:
+			return f(ctx)
+		case FormatColumns:
+			res, status := f(ctx)
+			return ColumnList{res}, status
+		default:
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid format '%s'", format), nil))
+		}
+	}
+}
+
+func (l ColumnList) LastModified() time.Time {
+	if res, ok := l.list.(server.Resource); ok {
+		return res.LastModified()
+	}
+	return time.Time{}
+}
+
+func (l ColumnList) Expires() time.Time {
+	if res, ok := l.list.(server.Resource); ok {
+		return res.Expires()
+	}
+	return time.Time{}
+}
+
+func (l ColumnList) MarshalJSON() ([]byte, error) {
+	val := reflect.ValueOf(l.list)
+	if val.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("columns: unsupported type %T", l.list)
+	}
+	var (
+		n       = val.Len()
+		columns = make([]string, 0)
+		index   = make(map[string]int)
+		rows    = make([]map[string]json.RawMessage, n)
+		size    int
+	)
+	for j := 0; j < n; j++ {
+		buf, err := json.Marshal(val.Index(j).Interface())
+		if err != nil {
+			return nil, err
+		}
+		keys, row, err := decodeObject(buf)
+		if err != nil {
+			return nil, fmt.Errorf("columns: row %d: %w", j, err)
+		}
+		rows[j] = row
+		size += len(buf)
+
+		// merge keys into the column list keeping their relative order, new
+		// keys are placed after the previous key of the same row
+		prev := -1
+		for _, key := range keys {
+			if i, ok := index[key]; ok {
+				prev = i
+				continue
+			}
+			prev++
+			columns = append(columns, "")
+			copy(columns[prev+1:], columns[prev:])
+			columns[prev] = key
+			for i, c := range columns[prev:] {
+				index[c] = prev + i
+			}
+		}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	buf.WriteString(`{"count":`)
+	buf.WriteString(strconv.Itoa(n))
+	buf.WriteString(`,"columns":`)
+	b, _ := json.Marshal(columns)
+	buf.Write(b)
+	buf.WriteString(`,"values":[`)
+	for i, c := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('[')
+		for j, row := range rows {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			if v, ok := row[c]; ok {
+				buf.Write(v)
+			} else {
+				buf.Write(null)
+			}
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes(), nil
+}
+
+// decodeObject returns the keys of a JSON object in encoding order and
+// their raw values.
+func decodeObject(buf []byte) ([]string, map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	if tok, err := dec.Token(); err != nil {
+		return nil, nil, err
+	} else if tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("not an object")
+	}
+	keys := make([]string, 0)
+	vals := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := tok.(string)
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := vals[key]; !ok {
+			keys = append(keys, key)
+		}
+		vals[key] = v
+	}
+	return keys, vals, nil
+}
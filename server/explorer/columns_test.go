@@ -0,0 +1,44 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestColumnList(t *testing.T) {
+	type row struct {
+		A int    `json:"a"`
+		B string `json:"b,omitempty"`
+		C []int  `json:"c,omitempty"`
+		D bool   `json:"d"`
+		E string `json:"-"`
+	}
+	list := []*row{
+		{A: 1, D: true},
+		{A: 2, B: "x", C: []int{1, 2}},
+		{A: 3, C: []int{3}, E: "hidden"},
+	}
+	buf, err := json.Marshal(ColumnList{list})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"count":3,"columns":["a","b","c","d"],"values":[[1,2,3],[null,"x",null],[null,[1,2],[3]],[true,false,false]]}`
+	if string(buf) != want {
+		t.Errorf("got  %s\nwant %s", buf, want)
+	}
+
+	buf, err = json.Marshal(ColumnList{[]*row{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"count":0,"columns":[],"values":[]}`; string(buf) != want {
+		t.Errorf("empty list: got %s", buf)
+	}
+
+	if _, err := json.Marshal(ColumnList{&row{}}); err == nil {
+		t.Errorf("expected error for non-list value")
+	}
+}
@@ -52,7 +52,9 @@ type Contract struct {
 	CallStats     map[string]int            `json:"call_stats"`
 	Features      micheline.Features        `json:"features"`
 	Interfaces    micheline.Interfaces      `json:"interfaces"`
+	Paused        *bool                     `json:"paused,omitempty"` // token ledgers only
 	Metadata      map[string]*ShortMetadata `json:"metadata,omitempty"`
+	Names         map[string]string         `json:"names,omitempty"`
 
 	expires time.Time `json:"-"`
 }
@@ -109,6 +111,14 @@ func NewContract(ctx *server.Context, c *model.Contract, a *model.Account, args
 		}
 	}
 
+	if args.WithNames() {
+		cc.Names = lookupNames(ctx,
+			a.Address,
+			ctx.Indexer.LookupAddress(ctx, a.CreatorId),
+			ctx.Indexer.LookupAddress(ctx, a.BakerId),
+		)
+	}
+
 	return cc
 }
 
@@ -130,18 +140,28 @@ func (a Contract) RESTPath(r *mux.Router) string {
 }
 
 func (b Contract) RegisterDirectRoutes(r *mux.Router) error {
+	r.HandleFunc(b.RESTPrefix(), server.C(ListContracts)).Methods("GET")
 	return nil
 }
 
 func (b Contract) RegisterRoutes(r *mux.Router) error {
+	r.HandleFunc("/compare", server.C(CompareContractLayouts)).Methods("GET")
+	r.HandleFunc("/search", server.H(SearchContractStorage)).Methods("GET")
 	r.HandleFunc("/{ident}", server.C(ReadContract)).Methods("GET").Name("contract")
-	r.HandleFunc("/{ident}/calls", server.C(ListContractCalls)).Methods("GET")
+	r.HandleFunc("/{ident}/calls", server.C(Columnar(ListContractCalls))).Methods("GET")
 	r.HandleFunc("/{ident}/script", server.C(ReadContractScript)).Methods("GET")
+	r.HandleFunc("/{ident}/entrypoints/types", server.C(ListContractEntrypointTypes)).Methods("GET")
+	r.HandleFunc("/{ident}/views/bigmaps", server.C(ListContractViewBigmaps)).Methods("GET")
 	r.HandleFunc("/{ident}/storage", server.C(ReadContractStorage)).Methods("GET")
-	r.HandleFunc("/{ident}/events", server.C(ListContractEvents)).Methods("GET")
+	r.HandleFunc("/{ident}/events", server.C(Columnar(ListContractEvents))).Methods("GET")
 	r.HandleFunc("/{ident}/tickets", server.C(ListTickets)).Methods("GET")
-	r.HandleFunc("/{ident}/ticket_events", server.C(ListTicketEvents)).Methods("GET")
+	r.HandleFunc("/{ident}/ticket_events", server.C(Columnar(ListTicketEvents))).Methods("GET")
 	r.HandleFunc("/{ident}/ticket_balances", server.C(ListTicketBalances)).Methods("GET")
+	r.HandleFunc("/{ident}/traits", server.C(ReadContractTraits)).Methods("GET")
+	r.HandleFunc("/{ident}/pauses", server.C(ListContractTokenPauses)).Methods("GET")
+	r.HandleFunc("/{ident}/roles", server.C(ListContractRoles)).Methods("GET")
+	r.HandleFunc("/{ident}/upgrades", server.C(ListContractUpgrades)).Methods("GET")
+	r.HandleFunc("/{ident}/holder_overlap", server.H(ListContractHolderOverlap)).Methods("GET")
 	return nil
 
 }
@@ -149,14 +169,17 @@ func (b Contract) RegisterRoutes(r *mux.Router) error {
 type ContractRequest struct {
 	ListRequest // offset, limit, cursor, order
 
-	Block   string         `schema:"block"`   // height or hash for time-lock
-	Since   string         `schema:"since"`   // block hash or height for updates
-	Unpack  bool           `schema:"unpack"`  // unpack packed key/values
-	Prim    bool           `schema:"prim"`    // for prim/value rendering
-	Meta    bool           `schema:"meta"`    // include account metadata
-	Merge   bool           `schema:"merge"`   // collapse internal calls
-	Storage bool           `schema:"storage"` // embed storage updates
-	Sender  mavryk.Address `schema:"sender"`  // sender address
+	Block    string         `schema:"block"`         // height or hash for time-lock
+	Since    string         `schema:"since"`         // block hash or height for updates
+	Unpack   bool           `schema:"unpack"`        // unpack packed key/values
+	Prim     bool           `schema:"prim"`          // for prim/value rendering
+	Meta     bool           `schema:"meta"`          // include account metadata
+	Merge    bool           `schema:"merge"`         // collapse internal calls
+	Storage  bool           `schema:"storage"`       // embed storage updates
+	Names    bool           `schema:"with_names"`    // include domain names
+	Internal bool           `schema:"with_internal"` // include internal operations
+	Sender   mavryk.Address `schema:"sender"`        // sender address
+	Creators bool           `schema:"with_creators"` // resolve contracts embedded in bigmap values
 
 	// decoded entrypoint condition (list of name, num or branch)
 	EntrypointMode pack.FilterMode `schema:"-"`
@@ -182,6 +205,7 @@ func (r *ContractRequest) WithMeta() bool    { return r != nil && r.Meta }
 func (r *ContractRequest) WithRights() bool  { return false }
 func (r *ContractRequest) WithMerge() bool   { return r != nil && r.Merge }
 func (r *ContractRequest) WithStorage() bool { return r != nil && r.Storage }
+func (r *ContractRequest) WithNames() bool   { return r != nil && r.Names }
 
 func (r *ContractRequest) Parse(ctx *server.Context) {
 	if len(r.Block) > 0 {
@@ -259,7 +283,12 @@ func ReadContract(ctx *server.Context) (interface{}, int) {
 			panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
 		}
 	}
-	return NewContract(ctx, cc, acc, args), http.StatusOK
+	c := NewContract(ctx, cc, acc, args)
+	if cc.LedgerType.IsValid() {
+		paused := isLedgerPaused(loadTokenPauses(ctx, cc.AccountId))
+		c.Paused = &paused
+	}
+	return c, http.StatusOK
 }
 
 var (
@@ -348,11 +377,18 @@ func ListContractCalls(ctx *server.Context) (interface{}, int) {
 		panic(server.EInternal(server.EC_DATABASE, "cannot read contract calls", err))
 	}
 
+	var internal map[uint64][]*InternalOp
+	if args.Internal {
+		internal = listInternalOps(ctx, ops, args)
+	}
+
 	// we reuse explorer ops here
 	resp := make(OpList, 0)
 	cache := make(map[int64]interface{})
 	for _, v := range ops {
-		resp.Append(NewOp(ctx, v, nil, cc, args, cache), args.WithMerge())
+		o := NewOp(ctx, v, nil, cc, args, cache)
+		o.InternalOps = internal[v.Id()]
+		resp.Append(o, args.WithMerge())
 	}
 
 	return resp, http.StatusOK
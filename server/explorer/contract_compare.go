@@ -0,0 +1,159 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type ContractCompareRequest struct {
+	A mavryk.Address `schema:"a"`
+	B mavryk.Address `schema:"b"`
+}
+
+type BigmapLayoutChange string
+
+const (
+	BigmapLayoutAdded     BigmapLayoutChange = "added"      // slot only in b
+	BigmapLayoutRemoved   BigmapLayoutChange = "removed"    // slot only in a
+	BigmapLayoutKeyType   BigmapLayoutChange = "key_type"   // key types differ
+	BigmapLayoutValueType BigmapLayoutChange = "value_type" // value types differ
+	BigmapLayoutRenamed   BigmapLayoutChange = "renamed"    // equal types, different annotation
+)
+
+type BigmapLayoutDiff struct {
+	Slot       int                `json:"slot"`
+	Change     BigmapLayoutChange `json:"change"`
+	NameA      string             `json:"name_a,omitempty"`
+	NameB      string             `json:"name_b,omitempty"`
+	KeyTypeA   *micheline.Typedef `json:"key_type_a,omitempty"`
+	KeyTypeB   *micheline.Typedef `json:"key_type_b,omitempty"`
+	ValueTypeA *micheline.Typedef `json:"value_type_a,omitempty"`
+	ValueTypeB *micheline.Typedef `json:"value_type_b,omitempty"`
+}
+
+type ContractLayoutComparison struct {
+	A           mavryk.Address     `json:"a"`
+	B           mavryk.Address     `json:"b"`
+	NumBigmapsA int                `json:"n_bigmaps_a"`
+	NumBigmapsB int                `json:"n_bigmaps_b"`
+	Equal       bool               `json:"equal"` // structurally equal bigmap types
+	Diffs       []BigmapLayoutDiff `json:"diffs"`
+}
+
+type bigmapSlot struct {
+	name string
+	typ  micheline.Type
+}
+
+// CompareContractLayouts compares bigmap types in the storage of two contracts
+// slot by slot in storage order. Types are compared structurally the same way
+// the bigmap index matches allocated bigmaps against script types.
+func CompareContractLayouts(ctx *server.Context) (interface{}, int) {
+	args := &ContractCompareRequest{}
+	ctx.ParseRequestArgs(args)
+	if !args.A.IsValid() || !args.B.IsValid() {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing contract addresses a and b", nil))
+	}
+
+	slotsA := loadBigmapSlots(ctx, args.A)
+	slotsB := loadBigmapSlots(ctx, args.B)
+	resp := &ContractLayoutComparison{
+		A:           args.A,
+		B:           args.B,
+		NumBigmapsA: len(slotsA),
+		NumBigmapsB: len(slotsB),
+		Equal:       len(slotsA) == len(slotsB),
+		Diffs:       make([]BigmapLayoutDiff, 0),
+	}
+
+	for i := 0; i < max(len(slotsA), len(slotsB)); i++ {
+		diff := BigmapLayoutDiff{Slot: i}
+		switch {
+		case i >= len(slotsB):
+			a := slotsA[i]
+			diff.Change = BigmapLayoutRemoved
+			diff.NameA = a.name
+			diff.KeyTypeA = a.typ.Left().TypedefPtr("")
+			diff.ValueTypeA = a.typ.Right().TypedefPtr("")
+		case i >= len(slotsA):
+			b := slotsB[i]
+			diff.Change = BigmapLayoutAdded
+			diff.NameB = b.name
+			diff.KeyTypeB = b.typ.Left().TypedefPtr("")
+			diff.ValueTypeB = b.typ.Right().TypedefPtr("")
+		default:
+			a, b := slotsA[i], slotsB[i]
+			diff.NameA, diff.NameB = a.name, b.name
+			ka, kb := a.typ.Left().Typedef("").Unfold(), b.typ.Left().Typedef("").Unfold()
+			va, vb := a.typ.Right().Typedef("").Unfold(), b.typ.Right().Typedef("").Unfold()
+			switch {
+			case !ka.Equal(kb):
+				diff.Change = BigmapLayoutKeyType
+				diff.KeyTypeA, diff.KeyTypeB = &ka, &kb
+				resp.Equal = false
+			case !va.Equal(vb):
+				diff.Change = BigmapLayoutValueType
+				diff.ValueTypeA, diff.ValueTypeB = &va, &vb
+				resp.Equal = false
+			case a.name != b.name:
+				diff.Change = BigmapLayoutRenamed
+			default:
+				continue
+			}
+		}
+		resp.Diffs = append(resp.Diffs, diff)
+	}
+	return resp, http.StatusOK
+}
+
+// loadBigmapSlots lists bigmap types in contract storage in declaration order,
+// including bigmaps nested in maps and lists.
+func loadBigmapSlots(ctx *server.Context, addr mavryk.Address) []bigmapSlot {
+	cc, err := ctx.Indexer.LookupContract(ctx, addr)
+	if err != nil {
+		switch err {
+		case model.ErrNoContract:
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such contract "+addr.String(), err))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
+		}
+	}
+	script, err := cc.LoadScript()
+	if err != nil {
+		panic(server.EInternal(server.EC_SERVER, "script unmarshal failed", err))
+	}
+	slots := make([]bigmapSlot, 0)
+	if script == nil {
+		return slots
+	}
+	_ = script.Code.Storage.Walk(func(p micheline.Prim) error {
+		switch p.OpCode {
+		case micheline.T_BIG_MAP:
+			slots = append(slots, bigmapSlot{p.GetVarAnnoAny(), micheline.NewType(p)})
+			return micheline.PrimSkip
+		case micheline.T_MAP, micheline.T_LIST:
+			inner := p.Args[len(p.Args)-1]
+			if inner.OpCode != micheline.T_BIG_MAP {
+				return micheline.PrimSkip
+			}
+			name := p.GetVarAnnoAny()
+			if n := inner.GetVarAnnoAny(); n != "" {
+				name = n
+			}
+			slots = append(slots, bigmapSlot{name, micheline.NewType(inner)})
+			return micheline.PrimSkip
+		case micheline.T_LAMBDA:
+			return micheline.PrimSkip
+		default:
+			return nil
+		}
+	})
+	return slots
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/util"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type ContractListRequest struct {
+	ContractRequest
+	Creator mavryk.Address `schema:"creator"` // creator address
+}
+
+// ListContracts lists contracts by creator and origination period. The
+// period is selected with `height` and `time` filters using the standard
+// filter modes, e.g. height.gte=100, time.rg=2024-01-01,2024-02-01.
+func ListContracts(ctx *server.Context) (interface{}, int) {
+	args := &ContractListRequest{}
+	ctx.ParseRequestArgs(args)
+
+	r := etl.ListRequest{
+		Offset: args.Offset,
+		Limit:  ctx.Cfg.ClampExplore(args.Limit),
+		Cursor: args.Cursor,
+		Order:  args.Order,
+	}
+	if args.Creator.IsValid() {
+		acc, err := ctx.Indexer.LookupAccount(ctx, args.Creator)
+		if err != nil {
+			switch err {
+			case model.ErrNoAccount:
+				panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such creator", err))
+			default:
+				panic(server.EInternal(server.EC_DATABASE, err.Error(), nil))
+			}
+		}
+		r.Account = acc
+	}
+	var ok bool
+	r.Since, r.Until, ok = parseBlockRange(ctx)
+	if !ok {
+		return newContractList(ctx, nil, args), http.StatusOK
+	}
+
+	ccs, err := ctx.Indexer.ListOriginatedContracts(ctx, r)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list contracts", err))
+	}
+	return newContractList(ctx, ccs, args), http.StatusOK
+}
+
+// parseBlockRange combines `height` and `time` filter conditions into an
+// inclusive height range. Zero values denote open ranges. Returns false when
+// the conditions cannot match any block.
+func parseBlockRange(ctx *server.Context) (since, until int64, ok bool) {
+	since, until, ok = parseHeightRange(ctx, "height", func(s string) (int64, bool, error) {
+		h, err := strconv.ParseInt(s, 10, 64)
+		return h, true, err
+	})
+	if !ok {
+		return
+	}
+	tsince, tuntil, ok := parseHeightRange(ctx, "time", func(s string) (int64, bool, error) {
+		tm, err := util.ParseTime(s)
+		if err != nil {
+			return 0, false, err
+		}
+		h := ctx.Indexer.LookupBlockHeightFromTime(ctx, tm.Time())
+		return h, ctx.Indexer.LookupBlockTime(ctx, h).Equal(tm.Time()), nil
+	})
+	if !ok {
+		return
+	}
+	if tsince > 0 {
+		since = max(since, tsince)
+	}
+	if tuntil > 0 {
+		until = util.NonZeroMin64(until, tuntil)
+	}
+	ok = until == 0 || since <= until
+	return
+}
+
+// parseHeightRange converts a filter condition on key into an inclusive
+// height range. Zero values denote open ranges. Conv returns the height of
+// the last block at or before a value and whether this block matches the
+// value exactly. Returns false when the condition cannot match any block.
+// Since no data is indexed at genesis, upper bounds below 1 match nothing.
+func parseHeightRange(ctx *server.Context, key string, conv func(string) (int64, bool, error)) (since, until int64, ok bool) {
+	mode, val, found := server.Query(ctx, key)
+	if !found {
+		return 0, 0, true
+	}
+	parse := func(s string) (int64, bool) {
+		h, exact, err := conv(s)
+		if err != nil || h < 0 {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid %s value %q", key, s), err))
+		}
+		return h, exact
+	}
+	// first block after a value unless a block matches exactly
+	after := func(s string) int64 {
+		h, exact := parse(s)
+		if !exact {
+			h++
+		}
+		return h
+	}
+	switch mode {
+	case pack.FilterModeEqual:
+		h, exact := parse(val)
+		if !exact {
+			return 0, 0, false
+		}
+		since, until = h, h
+	case pack.FilterModeGt:
+		h, _ := parse(val)
+		since = h + 1
+	case pack.FilterModeGte:
+		since = after(val)
+	case pack.FilterModeLt:
+		// last block before a value
+		h, exact := parse(val)
+		if exact {
+			h--
+		}
+		until = h
+	case pack.FilterModeLte:
+		until, _ = parse(val)
+	case pack.FilterModeRange:
+		from, to, ok := strings.Cut(val, ",")
+		if !ok {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid %s range value %q", key, val), nil))
+		}
+		since = after(from)
+		until, _ = parse(to)
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid %s mode %q", key, mode), nil))
+	}
+	switch mode {
+	case pack.FilterModeGt, pack.FilterModeGte:
+		return since, 0, true
+	default:
+		return since, until, until >= 1 && since <= until
+	}
+}
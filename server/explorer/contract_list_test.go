@@ -0,0 +1,50 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mavryk-network/mvindex/server"
+)
+
+func TestParseHeightRange(t *testing.T) {
+	// blocks at even values, odd values fall between blocks
+	conv := func(s string) (int64, bool, error) {
+		v, err := strconv.ParseInt(s, 10, 64)
+		return v / 2, v%2 == 0, err
+	}
+	tests := []struct {
+		query        string
+		since, until int64
+		ok           bool
+	}{
+		{"", 0, 0, true},
+		{"h=20", 10, 10, true},
+		{"h=21", 0, 0, false},
+		{"h.gt=20", 11, 0, true},
+		{"h.gt=21", 11, 0, true},
+		{"h.gte=20", 10, 0, true},
+		{"h.gte=21", 11, 0, true},
+		{"h.lt=20", 0, 9, true},
+		{"h.lt=21", 0, 10, true},
+		{"h.lt=2", 0, 0, false},
+		{"h.lt=3", 0, 1, true},
+		{"h.lte=20", 0, 10, true},
+		{"h.lte=21", 0, 10, true},
+		{"h.lte=1", 0, 0, false},
+		{"h.rg=20,30", 10, 15, true},
+		{"h.rg=21,31", 11, 15, true},
+		{"h.rg=21,21", 0, 0, false},
+	}
+	for _, tc := range tests {
+		ctx := &server.Context{Request: httptest.NewRequest("GET", "/?"+tc.query, nil)}
+		since, until, ok := parseHeightRange(ctx, "h", conv)
+		if ok != tc.ok || (ok && (since != tc.since || until != tc.until)) {
+			t.Errorf("%q: got %d,%d,%t want %d,%d,%t", tc.query, since, until, ok, tc.since, tc.until, tc.ok)
+		}
+	}
+}
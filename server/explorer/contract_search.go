@@ -0,0 +1,112 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// maxStorageScan limits the number of contracts decoded per scan request.
+const maxStorageScan = 10000
+
+const (
+	StorageSearchIndexed = "indexed"
+	StorageSearchScan    = "scan"
+)
+
+type ContractSearchRequest struct {
+	ListRequest        // offset, limit, cursor, order
+	Contains    string `schema:"storage_contains"` // address or value to search
+	Role        string `schema:"role"`             // indexed mode: restrict to role name
+	Scan        bool   `schema:"scan"`             // decode storage of all contracts
+}
+
+type StorageSearchResult struct {
+	Contract mavryk.Address `json:"contract"`
+	Field    string         `json:"field"` // role name (indexed) or storage path (scan)
+}
+
+type StorageSearchResponse struct {
+	Mode    string                 `json:"mode"`
+	Results []*StorageSearchResult `json:"results"`
+	Cursor  uint64                 `json:"cursor,omitempty"` // set when more results may follow
+}
+
+// SearchContractStorage finds contracts whose storage contains an address
+// or value.
+//
+// The default indexed mode looks up addresses in contract roles which are
+// extracted at index time for contracts matching a configured role pattern
+// (config key `role.patterns`, e.g. admin fields). It is cheap but only
+// covers configured contracts and addresses.
+//
+// With `scan=1` the current storage of every contract is decoded against
+// its storage type and searched for the value, matching addresses, strings
+// and numbers by their string form and map keys by address. Bigmap contents
+// are not searched. Scans are expensive: each request decodes at most
+// 10,000 contracts and returns a cursor to continue, so a full search over
+// all contracts takes many requests, even without matches.
+func SearchContractStorage(ctx *server.Context) (interface{}, int) {
+	args := &ContractSearchRequest{}
+	ctx.ParseRequestArgs(args)
+	if args.Contains == "" {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing storage_contains", nil))
+	}
+	r := etl.ListRequest{
+		Offset: args.Offset,
+		Limit:  ctx.Cfg.ClampExplore(args.Limit),
+		Cursor: args.Cursor,
+		Order:  args.Order,
+	}
+	resp := &StorageSearchResponse{
+		Results: make([]*StorageSearchResult, 0),
+	}
+
+	if args.Scan {
+		resp.Mode = StorageSearchScan
+		list, cursor, err := ctx.Indexer.ScanContractStorage(ctx, args.Contains, r, maxStorageScan)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot scan contract storage", err))
+		}
+		for _, v := range list {
+			for _, path := range v.Paths {
+				resp.Results = append(resp.Results, &StorageSearchResult{
+					Contract: v.Contract.Address,
+					Field:    path,
+				})
+			}
+		}
+		resp.Cursor = cursor
+		return resp, http.StatusOK
+	}
+
+	resp.Mode = StorageSearchIndexed
+	addr, err := mavryk.ParseAddress(args.Contains)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "indexed search requires an address, use scan=1 for other values", err))
+	}
+	list, err := ctx.Indexer.ListRolesByAddress(ctx, addr, args.Role, r)
+	if err != nil {
+		switch err {
+		case etl.ErrNoTable:
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "roles not indexed, use scan=1", err))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, "cannot search contract roles", err))
+		}
+	}
+	for _, v := range list {
+		resp.Results = append(resp.Results, &StorageSearchResult{
+			Contract: ctx.Indexer.LookupAddress(ctx, v.Contract),
+			Field:    v.Role,
+		})
+	}
+	if len(list) > 0 && len(list) == int(r.Limit) {
+		resp.Cursor = uint64(list[len(list)-1].Id)
+	}
+	return resp, http.StatusOK
+}
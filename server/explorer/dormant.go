@@ -0,0 +1,136 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type DormantRequest struct {
+	ListRequest             // limit, cursor
+	Since            int64  `schema:"since"`             // last seen before height (required)
+	MinBalance       int64  `schema:"min_balance"`       // min balance in base units (inclusive)
+	ExcludeContracts bool   `schema:"exclude_contracts"` // skip smart contracts
+	ExcludeBakers    bool   `schema:"exclude_bakers"`    // skip bakers
+	Format           string `schema:"format"`            // json (default) or csv
+}
+
+type DormantAccount struct {
+	Id           uint64         `json:"id"`
+	Address      mavryk.Address `json:"address"`
+	Balance      float64        `json:"balance"` // incl. stake
+	FirstSeen    int64          `json:"first_seen"`
+	LastSeen     int64          `json:"last_seen"`
+	LastSeenTime time.Time      `json:"last_seen_time"`
+	LastIn       int64          `json:"last_in"`
+	LastOut      int64          `json:"last_out"`
+	IsContract   bool           `json:"is_contract"`
+	IsBaker      bool           `json:"is_baker"`
+}
+
+var dormantCSVHeader = []string{
+	"id", "address", "balance", "first_seen", "last_seen", "last_seen_time",
+	"last_in", "last_out", "is_contract", "is_baker",
+}
+
+func NewDormantAccount(ctx *server.Context, a *model.Account) *DormantAccount {
+	return &DormantAccount{
+		Id:           a.RowId.U64(),
+		Address:      a.Address,
+		Balance:      ctx.Params.ConvertValue(a.Balance() + a.StakedBalance),
+		FirstSeen:    a.FirstSeen,
+		LastSeen:     a.LastSeen,
+		LastSeenTime: ctx.Indexer.LookupBlockTime(ctx, a.LastSeen),
+		LastIn:       a.LastIn,
+		LastOut:      a.LastOut,
+		IsContract:   a.IsContract,
+		IsBaker:      a.IsBaker,
+	}
+}
+
+func (a *DormantAccount) CSV() []string {
+	return []string{
+		strconv.FormatUint(a.Id, 10),
+		a.Address.String(),
+		strconv.FormatFloat(a.Balance, 'f', -1, 64),
+		strconv.FormatInt(a.FirstSeen, 10),
+		strconv.FormatInt(a.LastSeen, 10),
+		a.LastSeenTime.UTC().Format(time.RFC3339),
+		strconv.FormatInt(a.LastIn, 10),
+		strconv.FormatInt(a.LastOut, 10),
+		strconv.FormatBool(a.IsContract),
+		strconv.FormatBool(a.IsBaker),
+	}
+}
+
+// ListDormantAccounts lists funded accounts that were last seen before
+// height `since` and hold at least `min_balance` base units including stake,
+// e.g. to study lost or stale coins. Results are paged with limit and
+// cursor (account id). With `format=csv` pages use the larger table export
+// limit, the trailer returns the cursor of the next page.
+func ListDormantAccounts(ctx *server.Context) (interface{}, int) {
+	args := &DormantRequest{}
+	ctx.ParseRequestArgs(args)
+	switch args.Format {
+	case "", "json", FormatCSV:
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid format '%s'", args.Format), nil))
+	}
+	if args.Since <= 0 {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing since height", nil))
+	}
+	f := etl.DormantFilter{
+		Since:            args.Since,
+		MinBalance:       args.MinBalance,
+		ExcludeContracts: args.ExcludeContracts,
+		ExcludeBakers:    args.ExcludeBakers,
+	}
+	r := etl.ListRequest{
+		Cursor: args.Cursor,
+		Limit:  ctx.Cfg.ClampList(args.Limit),
+	}
+
+	if args.Format != FormatCSV {
+		r.Limit = ctx.Cfg.ClampExplore(args.Limit)
+		resp := make([]*DormantAccount, 0)
+		err := ctx.Indexer.StreamDormantAccounts(ctx, f, r, func(a *model.Account) error {
+			resp = append(resp, NewDormantAccount(ctx, a))
+			return nil
+		})
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list dormant accounts", err))
+		}
+		return resp, http.StatusOK
+	}
+
+	ctx.StreamResponseHeaders(http.StatusOK, "text/csv")
+	w := csv.NewWriter(ctx.ResponseWriter)
+	err := w.Write(dormantCSVHeader)
+	var (
+		count  int
+		cursor string
+	)
+	if err == nil {
+		err = ctx.Indexer.StreamDormantAccounts(ctx, f, r, func(a *model.Account) error {
+			count++
+			cursor = strconv.FormatUint(a.RowId.U64(), 10)
+			return w.Write(NewDormantAccount(ctx, a).CSV())
+		})
+	}
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	ctx.StreamTrailer(cursor, count, err)
+	return nil, -1
+}
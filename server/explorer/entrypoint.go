@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// EntrypointType describes a callable entrypoint of a contract with its
+// parameter type as raw Micheline and as unfolded type definition.
+type EntrypointType struct {
+	Id          int               `json:"id"`
+	Name        string            `json:"name"`
+	Branch      string            `json:"branch"`       // or-tree path, empty for root
+	IsAnnotated bool              `json:"is_annotated"` // false when only callable via root/default branch
+	IsRoot      bool              `json:"is_root"`      // entrypoint takes the full parameter
+	Prim        micheline.Prim    `json:"prim"`
+	Type        micheline.Typedef `json:"type"`
+}
+
+func newEntrypointType(id int, name, branch string, prim micheline.Prim) EntrypointType {
+	return EntrypointType{
+		Id:          id,
+		Name:        name,
+		Branch:      branch,
+		IsAnnotated: prim.GetVarAnnoAny() != "",
+		Prim:        prim,
+		Type:        micheline.NewType(prim).Typedef("").Unfold(),
+	}
+}
+
+// ListContractEntrypointTypes lists all entrypoints derived from a contract's
+// parameter or-tree. Besides named branches the list contains the root
+// entrypoint when the parameter is annotated (e.g. %root) and the implicit
+// default entrypoint when no branch is annotated %default.
+func ListContractEntrypointTypes(ctx *server.Context) (interface{}, int) {
+	cc := loadContract(ctx)
+	script, err := cc.LoadScript()
+	if err != nil {
+		panic(server.EInternal(server.EC_SERVER, "script unmarshal failed", err))
+	}
+	if script == nil {
+		return nil, http.StatusNoContent
+	}
+	param := script.ParamType()
+	eps, err := param.Entrypoints(true)
+	if err != nil {
+		panic(server.EInternal(server.EC_SERVER, "script entrypoint parsing failed", err))
+	}
+
+	resp := make([]EntrypointType, 0, len(eps)+2)
+	var hasDefault bool
+	for _, v := range eps {
+		if v.Prim == nil {
+			continue
+		}
+		ep := newEntrypointType(v.Id, v.Name, v.Branch, *v.Prim)
+		switch {
+		case v.Branch == "":
+			// a parameter without or-tree is the default entrypoint
+			ep.IsRoot = true
+		case !ep.IsAnnotated:
+			// unannotated branches are named by position only
+			ep.Name = fmt.Sprintf("%s_%d", micheline.CONST_ENTRYPOINT, v.Id)
+		}
+		hasDefault = hasDefault || ep.Name == micheline.DEFAULT
+		resp = append(resp, ep)
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].Id < resp[j].Id })
+
+	// or-tree root is callable by its annotation and, in absence of an
+	// explicit default branch, as default entrypoint
+	if param.OpCode == micheline.T_OR {
+		if name := param.GetVarAnnoAny(); name != "" && name != micheline.DEFAULT {
+			ep := newEntrypointType(len(resp), name, "", param.Prim)
+			ep.IsRoot = true
+			resp = append(resp, ep)
+		}
+		if !hasDefault {
+			ep := newEntrypointType(len(resp), micheline.DEFAULT, "", param.Prim)
+			ep.IsRoot = true
+			resp = append(resp, ep)
+		}
+	}
+	return resp, http.StatusOK
+}
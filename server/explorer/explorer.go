@@ -23,6 +23,10 @@ func PurgeCaches() {
 	purgeCycleStore()
 	purgeTipStore()
 	purgeMetadataStore()
+	purgeTraitStore()
+	purgeOverlapStore()
+	purgeSupplyStore()
+	purgeInteractionStore()
 }
 
 type Explorer struct{}
@@ -51,9 +55,13 @@ func (b Explorer) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/tip", server.C(GetBlockchainTip)).Methods("GET")
 	r.HandleFunc("/protocols", server.C(GetBlockchainProtocols)).Methods("GET")
 	r.HandleFunc("/config/{ident}", server.C(GetBlockchainConfig)).Methods("GET")
+	r.HandleFunc("/chain/supply", server.C(ListSupplySeries)).Methods("GET")
 	r.HandleFunc("/chain/{ident}", server.C(ReadChain)).Methods("GET")
 	r.HandleFunc("/supply/{ident}", server.C(ReadSupply)).Methods("GET")
 	r.HandleFunc("/status", server.C(GetStatus)).Methods("GET")
+	r.HandleFunc("/ws", server.WS(StreamBlocks)).Methods("GET")
+	r.HandleFunc("/snapshot/balances", server.H(ListSnapshotBalances)).Methods("GET")
+	r.HandleFunc("/accounts/dormant", server.H(ListDormantAccounts)).Methods("GET")
 	return nil
 }
 
@@ -0,0 +1,180 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	feedBufferSize = 16 // blocks queued per client before it is dropped
+	maxFeedFilters = 32
+)
+
+type BlockFeedRequest struct {
+	Contracts string `schema:"contracts"` // comma separated account or contract addresses
+	Tokens    string `schema:"tokens"`    // comma separated token addresses
+	Events    bool   `schema:"events"`    // include contract events
+}
+
+// BlockFeedMessage is sent for each new block that passes the client's
+// filters. On reorg all clients receive a message with rewind=true for the
+// fork point and must discard blocks above its height before new main chain
+// blocks follow. Slow clients receive an error message before they are
+// disconnected.
+type BlockFeedMessage struct {
+	Rewind     bool             `json:"rewind,omitempty"`
+	Height     int64            `json:"height"`
+	Hash       mavryk.BlockHash `json:"hash"`
+	ParentHash mavryk.BlockHash `json:"predecessor"`
+	Timestamp  time.Time        `json:"time"`
+	Cycle      int64            `json:"cycle"`
+	NOps       int              `json:"n_ops"`
+	NEvents    int              `json:"n_events"`
+	Events     []*Event         `json:"events,omitempty"`
+}
+
+// feedFilter selects accounts of interest, an empty filter matches all.
+type feedFilter map[model.AccountID]struct{}
+
+func (f feedFilter) Match(id model.AccountID) bool {
+	_, ok := f[id]
+	return ok || len(f) == 0
+}
+
+// MatchBlock reports whether a block has operations or events of
+// interest. Rewinds always match.
+func (f feedFilter) MatchBlock(b *etl.BlockSummary) bool {
+	if len(f) == 0 || b.Rewind {
+		return true
+	}
+	for id := range f {
+		if b.Touches(id) {
+			return true
+		}
+	}
+	for _, e := range b.Events {
+		if f.Match(e.AccountId) {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamBlocks pushes a summary of each newly indexed block to WebSocket
+// clients. Clients may restrict the feed to blocks with operations on
+// given accounts, contracts or token ledgers and request contract events.
+func StreamBlocks(ctx *server.Context) server.SocketCall {
+	args := &BlockFeedRequest{}
+	ctx.ParseRequestArgs(args)
+
+	ids := make(feedFilter)
+	for _, v := range splitFeedFilter(args.Contracts) {
+		addr, err := mavryk.ParseAddress(v)
+		if err != nil {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid address %q", v), err))
+		}
+		id, err := ctx.Indexer.LookupAccountId(ctx, addr)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no such account %s", addr), err))
+		}
+		ids[id] = struct{}{}
+	}
+	for _, v := range splitFeedFilter(args.Tokens) {
+		tokn, err := mavryk.ParseToken(v)
+		if err != nil {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid token address %q", v), err))
+		}
+		id, err := ctx.Indexer.LookupAccountId(ctx, tokn.Contract())
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no such token %s", tokn), err))
+		}
+		ids[id] = struct{}{}
+	}
+	if len(ids) > maxFeedFilters {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("too many filters, max %d", maxFeedFilters), nil))
+	}
+
+	return func(ctx *server.Context, conn *websocket.Conn) {
+		defer conn.Close()
+		sub := ctx.Crawler.Feed().Subscribe(feedBufferSize)
+		defer sub.Close()
+
+		// clients don't send data, read until the connection closes
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var msg []byte
+			for websocket.Message.Receive(conn, &msg) == nil {
+			}
+		}()
+
+		for {
+			select {
+			case <-closed:
+				return
+			case <-ctx.Done():
+				return
+			case b, ok := <-sub.C:
+				if !ok {
+					if sub.Dropped() {
+						ctx.Log.Debugf("feed: dropping slow client %s", ctx.RemoteIP)
+						_ = sendFeedMessage(ctx, conn, server.EServiceUnavailable(server.EC_ACCESS_RATE_LIMITED, "client too slow", nil))
+					}
+					return
+				}
+				if !ids.MatchBlock(b) {
+					continue
+				}
+				msg := newBlockFeedMessage(ctx, b, args.Events, ids)
+				if err := sendFeedMessage(ctx, conn, msg); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func newBlockFeedMessage(ctx *server.Context, b *etl.BlockSummary, withEvents bool, filter feedFilter) *BlockFeedMessage {
+	msg := &BlockFeedMessage{
+		Rewind:     b.Rewind,
+		Height:     b.Height,
+		Hash:       b.Hash,
+		ParentHash: b.Parent,
+		Timestamp:  b.Time,
+		Cycle:      b.Cycle,
+		NOps:       b.NOps,
+		NEvents:    b.NEvents,
+	}
+	if withEvents {
+		for _, e := range b.Events {
+			if filter.Match(e.AccountId) {
+				msg.Events = append(msg.Events, NewEvent(ctx, e))
+			}
+		}
+	}
+	return msg
+}
+
+func sendFeedMessage(ctx *server.Context, conn *websocket.Conn, v interface{}) error {
+	if ctx.Cfg.Http.WriteTimeout > 0 {
+		_ = conn.SetWriteDeadline(time.Now().Add(ctx.Cfg.Http.WriteTimeout))
+	}
+	return websocket.JSON.Send(conn, v)
+}
+
+func splitFeedFilter(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
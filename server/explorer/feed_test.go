@@ -0,0 +1,28 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestFeedFilterRewind(t *testing.T) {
+	filter := feedFilter{7: struct{}{}}
+	other := &etl.BlockSummary{Height: 11, Accounts: map[model.AccountID]struct{}{8: {}}}
+	if filter.MatchBlock(other) {
+		t.Errorf("block without filtered accounts should not match")
+	}
+
+	// rewinds reach every client so it can drop orphaned blocks
+	rewind := etl.NewRewindSummary(&model.ChainTip{BestHeight: 10})
+	if !filter.MatchBlock(rewind) {
+		t.Errorf("rewind should match any filter")
+	}
+	if msg := newBlockFeedMessage(nil, rewind, true, filter); !msg.Rewind || msg.Height != 10 {
+		t.Errorf("unexpected rewind message %+v", msg)
+	}
+}
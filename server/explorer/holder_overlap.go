@@ -0,0 +1,199 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const (
+	overlapCacheSize = 256
+	overlapCacheTTL  = 10 * time.Minute
+	overlapBatchSize = 1024
+)
+
+var overlapCache *lru.Cache[model.AccountID, *HolderOverlap]
+
+func init() {
+	overlapCache, _ = lru.New[model.AccountID, *HolderOverlap](overlapCacheSize)
+}
+
+func purgeOverlapStore() {
+	overlapCache.Purge()
+}
+
+type ContractOverlap struct {
+	Contract   mavryk.Address `json:"contract"`
+	NumHolders int            `json:"n_holders"` // holders shared with the source contract
+	Share      float64        `json:"share"`     // share of source contract holders
+}
+
+// HolderOverlap lists token contracts most commonly held by holders of
+// a token contract.
+type HolderOverlap struct {
+	Contract   mavryk.Address    `json:"contract"`
+	NumHolders int               `json:"n_holders"`
+	Overlaps   []ContractOverlap `json:"overlaps"`
+	IsEstimate bool              `json:"is_estimate,omitempty"` // counts are extrapolated from a sample
+	SampleSize int               `json:"sample_size,omitempty"`
+
+	modified time.Time
+	expires  time.Time
+}
+
+func (h HolderOverlap) LastModified() time.Time { return h.modified }
+func (h HolderOverlap) Expires() time.Time      { return h.expires }
+
+var _ server.Resource = (*HolderOverlap)(nil)
+
+// HolderOverlapRequest limits the number of returned contracts and
+// optionally bounds the cost by counting holdings of at most Sample
+// randomly selected holders. Omit Sample for exact counts.
+type HolderOverlapRequest struct {
+	Limit  uint `schema:"limit"`
+	Sample int  `schema:"sample"`
+}
+
+// ListContractHolderOverlap ranks other token contracts by the number of
+// current holders they share with a token contract. Exact results are
+// cached, sampled results are never cached.
+func ListContractHolderOverlap(ctx *server.Context) (interface{}, int) {
+	var args HolderOverlapRequest
+	ctx.ParseRequestArgs(&args)
+	if args.Sample < 0 {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid sample size", nil))
+	}
+	limit := int(ctx.Cfg.ClampExplore(args.Limit))
+	cc := loadContract(ctx)
+
+	h, ok := overlapCache.Get(cc.AccountId)
+	if !ok || args.Sample > 0 || !ctx.Now.Before(h.expires) {
+		h = &HolderOverlap{
+			Contract: ctx.Indexer.LookupAddress(ctx, cc.AccountId),
+			Overlaps: make([]ContractOverlap, 0),
+			modified: ctx.Now,
+			expires:  ctx.Now.Add(overlapCacheTTL),
+		}
+		if err := h.build(ctx, cc.AccountId, args.Sample); err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot read token owners", err))
+		}
+		if args.Sample == 0 {
+			overlapCache.Add(cc.AccountId, h)
+		}
+	}
+
+	// return a truncated copy, cached entries keep the full ranking
+	resp := *h
+	if len(resp.Overlaps) > limit {
+		resp.Overlaps = resp.Overlaps[:limit]
+	}
+	return resp, http.StatusOK
+}
+
+// build collects current holders of ledger and counts how many of them
+// hold a non-zero balance in other ledgers. With sample > 0 only a uniform
+// random sample of holders is considered (reservoir sampling) and counts
+// are extrapolated to all holders.
+func (h *HolderOverlap) build(ctx *server.Context, ledger model.AccountID, sample int) error {
+	table, err := ctx.Indexer.Table(model.TokenOwnerTableKey)
+	if err != nil {
+		return err
+	}
+
+	// an account may hold multiple tokens of the same ledger
+	seen := make(map[model.AccountID]struct{})
+	res := newReservoir[model.AccountID](sample, ctx.Now.UnixNano())
+	ownr := &model.TokenOwner{}
+	err = pack.NewQuery("token.overlap_holders").
+		WithTable(table).
+		WithFields("account", "balance").
+		AndEqual("ledger", ledger).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(ownr); err != nil {
+				return err
+			}
+			if ownr.Balance.IsZero() {
+				return nil
+			}
+			if _, ok := seen[ownr.Account]; ok {
+				return nil
+			}
+			seen[ownr.Account] = struct{}{}
+			res.Add(ownr.Account)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	h.NumHolders = len(seen)
+	if h.NumHolders == 0 {
+		return nil
+	}
+	holders := res.items
+
+	// count distinct holders per other ledger
+	type pair struct{ ledger, account model.AccountID }
+	counted := make(map[pair]struct{})
+	counts := make(map[model.AccountID]int)
+	for len(holders) > 0 {
+		n := min(overlapBatchSize, len(holders))
+		err := pack.NewQuery("token.overlap_holdings").
+			WithTable(table).
+			WithFields("account", "ledger", "balance").
+			AndIn("account", holders[:n]).
+			AndNotEqual("ledger", ledger).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(ownr); err != nil {
+					return err
+				}
+				if ownr.Balance.IsZero() {
+					return nil
+				}
+				key := pair{ownr.Ledger, ownr.Account}
+				if _, ok := counted[key]; ok {
+					return nil
+				}
+				counted[key] = struct{}{}
+				counts[ownr.Ledger]++
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+		holders = holders[n:]
+	}
+
+	scale := func(n int) int { return n }
+	if sample > 0 && h.NumHolders > sample {
+		h.IsEstimate = true
+		h.SampleSize = sample
+		scale = func(n int) int {
+			return int(float64(n) * float64(h.NumHolders) / float64(sample))
+		}
+	}
+	for id, n := range counts {
+		n = scale(n)
+		h.Overlaps = append(h.Overlaps, ContractOverlap{
+			Contract:   ctx.Indexer.LookupAddress(ctx, id),
+			NumHolders: n,
+			Share:      float64(n) / float64(h.NumHolders),
+		})
+	}
+	sort.Slice(h.Overlaps, func(i, j int) bool {
+		if h.Overlaps[i].NumHolders == h.Overlaps[j].NumHolders {
+			return h.Overlaps[i].Contract.String() < h.Overlaps[j].Contract.String()
+		}
+		return h.Overlaps[i].NumHolders > h.Overlaps[j].NumHolders
+	})
+	return nil
+}
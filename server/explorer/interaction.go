@@ -0,0 +1,188 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const (
+	interactionCacheSize = 1024
+	interactionCacheTTL  = 10 * time.Minute // picks up token events on untouched accounts
+)
+
+type interactionEntry struct {
+	list     []*model.ContractInteraction
+	lastSeen int64
+	modified time.Time
+	expires  time.Time
+}
+
+var interactionCache *lru.Cache[model.AccountID, *interactionEntry]
+
+func init() {
+	interactionCache, _ = lru.New[model.AccountID, *interactionEntry](interactionCacheSize)
+}
+
+func purgeInteractionStore() {
+	interactionCache.Purge()
+}
+
+type ContractInteraction struct {
+	Contract    mavryk.Address `json:"contract"`
+	FirstHeight int64          `json:"first_height"`
+	FirstTime   time.Time      `json:"first_time"`
+	LastHeight  int64          `json:"last_height"`
+	LastTime    time.Time      `json:"last_time"`
+	Count       int            `json:"n_interactions"`
+}
+
+type ContractInteractionList struct {
+	list     []*ContractInteraction
+	modified time.Time
+	expires  time.Time
+}
+
+func (l ContractInteractionList) MarshalJSON() ([]byte, error) { return json.Marshal(l.list) }
+func (l ContractInteractionList) LastModified() time.Time      { return l.modified }
+func (l ContractInteractionList) Expires() time.Time           { return l.expires }
+
+var _ server.Resource = (*ContractInteractionList)(nil)
+
+// ListAccountInteractions lists contracts an account has called, was called
+// or paid by, or exchanged tokens on, with first and last interaction and
+// the number of interactions. Internal calls are attributed to the calling
+// contract, not the signer. Sorted by last interaction, most recent first
+// unless order=asc. Results are cached per account until the account is
+// active again or the cache entry expires.
+//
+// Served at /explorer/account/{ident}/interactions because /contracts
+// already lists contracts deployed by the account and changing its response
+// would break existing clients.
+func ListAccountInteractions(ctx *server.Context) (interface{}, int) {
+	args := &AccountRequest{
+		ListRequest: ListRequest{
+			Order: pack.OrderDesc,
+		},
+	}
+	ctx.ParseRequestArgs(args)
+	acc := loadAccount(ctx)
+
+	e, ok := interactionCache.Get(acc.RowId)
+	if !ok || e.lastSeen != acc.LastSeen || !ctx.Now.Before(e.expires) {
+		list, err := ctx.Indexer.ListContractInteractions(ctx, acc)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list contract interactions", err))
+		}
+		e = &interactionEntry{
+			list:     list,
+			lastSeen: acc.LastSeen,
+			modified: ctx.Now,
+			expires:  ctx.Now.Add(interactionCacheTTL),
+		}
+		interactionCache.Add(acc.RowId, e)
+	}
+
+	// cached entries are shared, page on a copy
+	list := e.list
+	if args.Order == pack.OrderAsc {
+		list = slices.Clone(list)
+		slices.Reverse(list)
+	}
+	start := min(int(args.Offset), len(list))
+	end := min(start+int(ctx.Cfg.ClampExplore(args.Limit)), len(list))
+
+	resp := &ContractInteractionList{
+		list:     make([]*ContractInteraction, 0, end-start),
+		modified: e.modified,
+		expires:  ctx.Expires,
+	}
+	for _, v := range list[start:end] {
+		resp.list = append(resp.list, &ContractInteraction{
+			Contract:    ctx.Indexer.LookupAddress(ctx, v.Contract),
+			FirstHeight: v.FirstHeight,
+			FirstTime:   v.FirstTime,
+			LastHeight:  v.LastHeight,
+			LastTime:    v.LastTime,
+			Count:       v.Count,
+		})
+	}
+	return resp, http.StatusOK
+}
+
+type CalledEntrypointRequest struct {
+	ListRequest                // offset, limit
+	Contract    mavryk.Address `schema:"contract"` // only calls to this contract
+}
+
+type CalledEntrypoint struct {
+	Contract    mavryk.Address `json:"contract"`
+	Entrypoint  string         `json:"entrypoint"`
+	Count       int            `json:"n_calls"`
+	NInternal   int            `json:"n_internal"` // calls from the account's contract code
+	FirstHeight int64          `json:"first_height"`
+	LastHeight  int64          `json:"last_height"`
+}
+
+// ListAccountCalledEntrypoints lists contract entrypoints an account has
+// called with the number of successful calls, most frequent first. Calls
+// count for their direct source: the signer of a top-level call or the
+// contract that emitted an internal call. Use contract to filter calls to
+// a single contract.
+func ListAccountCalledEntrypoints(ctx *server.Context) (interface{}, int) {
+	args := &CalledEntrypointRequest{}
+	ctx.ParseRequestArgs(args)
+	acc := loadAccount(ctx)
+
+	var contract model.AccountID
+	if args.Contract.IsValid() {
+		id, err := ctx.Indexer.LookupAccountId(ctx, args.Contract)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such contract", err))
+		}
+		contract = id
+	}
+	list, err := ctx.Indexer.ListCalledEntrypoints(ctx, acc, contract)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list called entrypoints", err))
+	}
+	start := min(int(args.Offset), len(list))
+	end := min(start+int(ctx.Cfg.ClampExplore(args.Limit)), len(list))
+
+	names := make(map[model.AccountID][]string)
+	resp := make([]*CalledEntrypoint, 0, end-start)
+	for _, v := range list[start:end] {
+		byId, ok := names[v.Contract]
+		if !ok {
+			if cc, err := ctx.Indexer.LookupContractId(ctx, v.Contract); err == nil {
+				byId, _ = cc.EntrypointNames()
+			}
+			names[v.Contract] = byId
+		}
+		ep := strconv.Itoa(v.Entrypoint)
+		if v.Entrypoint >= 0 && v.Entrypoint < len(byId) {
+			ep = byId[v.Entrypoint]
+		}
+		resp = append(resp, &CalledEntrypoint{
+			Contract:    ctx.Indexer.LookupAddress(ctx, v.Contract),
+			Entrypoint:  ep,
+			Count:       v.Count,
+			NInternal:   v.NInternal,
+			FirstHeight: v.FirstHeight,
+			LastHeight:  v.LastHeight,
+		})
+	}
+	return resp, http.StatusOK
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mavryk-network/mvindex/server/series"
+)
+
+const (
+	IntervalMinute = 'm'
+	IntervalHour   = 'h'
+	IntervalDay    = 'd'
+	IntervalWeek   = 'w'
+	IntervalBlock  = 'b'
+	IntervalCycle  = 'c'
+
+	// smallest intervals accepted by series endpoints, finer intervals
+	// produce large responses and expensive scans
+	minIntervalDuration = time.Hour
+	minIntervalBlocks   = 100
+)
+
+// Interval is a collapse interval for series endpoints. Intervals are
+// either time based (e.g. 6h, 3d), block based (e.g. 100blocks) or cycle
+// based (e.g. 1cycle).
+type Interval struct {
+	Value int64
+	Unit  rune
+}
+
+// ParseInterval parses an interval like 6h, 3d, 100blocks or 1cycle. Time
+// based intervals use the collapse syntax of table series, see
+// series.ParseCollapse, limited to fixed length units (m, h, d, w). Block
+// and cycle intervals accept the suffixes b, block(s), c and cycle(s).
+// A missing value defaults to 1. Intervals below the minimum granularity
+// are rejected.
+func ParseInterval(s string) (Interval, error) {
+	var i Interval
+	num := strings.TrimRightFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	switch s[len(num):] {
+	case "b", "block", "blocks":
+		i.Unit = IntervalBlock
+	case "c", "cycle", "cycles":
+		i.Unit = IntervalCycle
+	default:
+		c, err := series.ParseCollapse(s)
+		if err != nil {
+			return i, fmt.Errorf("interval: %v", err)
+		}
+		switch c.Unit {
+		case IntervalMinute, IntervalHour, IntervalDay, IntervalWeek:
+		default:
+			return i, fmt.Errorf("interval: unsupported unit in %q", s)
+		}
+		i.Unit, i.Value = c.Unit, int64(c.Value)
+	}
+	if !i.IsTime() {
+		i.Value = 1
+		if num != "" {
+			n, err := strconv.ParseInt(num, 10, 64)
+			if err != nil || n <= 0 {
+				return i, fmt.Errorf("interval: invalid value %q", s)
+			}
+			i.Value = n
+		}
+	}
+	switch {
+	case i.IsTime() && i.Duration() < minIntervalDuration:
+		return i, fmt.Errorf("interval: %q is below minimum of %s", s, minIntervalDuration)
+	case i.Unit == IntervalBlock && i.Value < minIntervalBlocks:
+		return i, fmt.Errorf("interval: %q is below minimum of %d blocks", s, minIntervalBlocks)
+	}
+	return i, nil
+}
+
+func (i Interval) String() string {
+	switch i.Unit {
+	case IntervalBlock:
+		return strconv.FormatInt(i.Value, 10) + "blocks"
+	case IntervalCycle:
+		return strconv.FormatInt(i.Value, 10) + "cycles"
+	default:
+		return strconv.FormatInt(i.Value, 10) + string(i.Unit)
+	}
+}
+
+func (i Interval) IsTime() bool {
+	return i.Unit != IntervalBlock && i.Unit != IntervalCycle
+}
+
+// Duration returns the length of time based intervals and zero otherwise.
+func (i Interval) Duration() time.Duration {
+	var base time.Duration
+	switch i.Unit {
+	case IntervalMinute:
+		base = time.Minute
+	case IntervalHour:
+		base = time.Hour
+	case IntervalDay:
+		base = 24 * time.Hour
+	case IntervalWeek:
+		base = 7 * 24 * time.Hour
+	}
+	return time.Duration(i.Value) * base
+}
+
+// Bucket returns the number of the interval that contains a point at block
+// height, cycle and time. Time buckets are aligned to the unix epoch in UTC.
+func (i Interval) Bucket(height, cycle int64, t time.Time) int64 {
+	switch i.Unit {
+	case IntervalBlock:
+		return height / i.Value
+	case IntervalCycle:
+		return cycle / i.Value
+	default:
+		return t.Unix() / int64(i.Duration()/time.Second)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want Interval
+		ok   bool
+	}{
+		{"6h", Interval{6, IntervalHour}, true},
+		{"3d", Interval{3, IntervalDay}, true},
+		{"w", Interval{1, IntervalWeek}, true},
+		{"90m", Interval{90, IntervalMinute}, true},
+		{"100blocks", Interval{100, IntervalBlock}, true},
+		{"1cycle", Interval{1, IntervalCycle}, true},
+		{"10c", Interval{10, IntervalCycle}, true},
+		{"30m", Interval{}, false},      // below minimum duration
+		{"10blocks", Interval{}, false}, // below minimum block count
+		{"0blocks", Interval{}, false},
+		{"1M", Interval{}, false}, // months have no fixed length
+		{"90min", Interval{}, false},
+		{"", Interval{}, false},
+	} {
+		got, err := ParseInterval(c.in)
+		if c.ok != (err == nil) {
+			t.Errorf("%q: unexpected error state %v", c.in, err)
+			continue
+		}
+		if c.ok && got != c.want {
+			t.Errorf("%q: got %+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestIntervalBucket(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	blocks, _ := ParseInterval("100blocks")
+	hours, _ := ParseInterval("6h")
+
+	// blocks 100..199 share a bucket independent of block time
+	if blocks.Bucket(100, 0, base) != blocks.Bucket(199, 0, base.Add(24*time.Hour)) {
+		t.Errorf("blocks 100 and 199 should share a bucket")
+	}
+	if blocks.Bucket(199, 0, base) == blocks.Bucket(200, 0, base) {
+		t.Errorf("blocks 199 and 200 should not share a bucket")
+	}
+
+	// time buckets are aligned to UTC and independent of height
+	if hours.Bucket(1, 0, base) != hours.Bucket(5000, 0, base.Add(6*time.Hour-time.Second)) {
+		t.Errorf("times within 6h should share a bucket")
+	}
+	if hours.Bucket(1, 0, base) == hours.Bucket(1, 0, base.Add(6*time.Hour)) {
+		t.Errorf("times 6h apart should not share a bucket")
+	}
+}
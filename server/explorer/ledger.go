@@ -0,0 +1,174 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type LedgerRequest struct {
+	ListRequest        // offset, limit, cursor, order
+	Format      string `schema:"format"` // json (default) or csv
+}
+
+// LedgerEntry is a single double-entry ledger row. Out-flows debit and
+// in-flows credit the account's sub-account. Category is the flow type.
+type LedgerEntry struct {
+	Id                     uint64                `json:"id"`
+	Height                 int64                 `json:"height"`
+	Cycle                  int64                 `json:"cycle"`
+	Time                   time.Time             `json:"time"`
+	OpN                    int                   `json:"op_n"`
+	OpC                    int                   `json:"op_c"`
+	OpI                    int                   `json:"op_i"`
+	Account                mavryk.Address        `json:"account"`
+	SubAccount             model.BalanceCategory `json:"sub_account"`
+	Counterparty           *mavryk.Address       `json:"counterparty,omitempty"`
+	CounterpartySubAccount model.BalanceCategory `json:"counterparty_sub_account,omitempty"`
+	Category               string                `json:"category"`
+	Debit                  float64               `json:"debit"`
+	Credit                 float64               `json:"credit"`
+	IsTransfer             bool                  `json:"is_transfer,omitempty"`
+	IsFee                  bool                  `json:"is_fee,omitempty"`
+	IsBurned               bool                  `json:"is_burned,omitempty"`
+}
+
+var ledgerCSVHeader = []string{
+	"id", "height", "cycle", "time", "op_n", "op_c", "op_i",
+	"account", "sub_account", "counterparty", "counterparty_sub_account",
+	"category", "debit", "credit", "is_transfer", "is_fee", "is_burned",
+}
+
+func NewLedgerEntry(ctx *server.Context, acc *model.Account, e *model.LedgerEntry) *LedgerEntry {
+	p, f := ctx.Params, e.Flow
+	entry := &LedgerEntry{
+		Id:         f.RowId,
+		Height:     f.Height,
+		Cycle:      f.Cycle,
+		Time:       f.Timestamp,
+		OpN:        f.OpN,
+		OpC:        f.OpC,
+		OpI:        f.OpI,
+		Account:    acc.Address,
+		SubAccount: e.Category,
+		Category:   f.Type.String(),
+		Debit:      p.ConvertValue(e.Debit),
+		Credit:     p.ConvertValue(e.Credit),
+		IsTransfer: e.IsTransfer,
+		IsFee:      f.IsFee,
+		IsBurned:   f.IsBurned,
+	}
+	switch {
+	case e.IsTransfer:
+		entry.Counterparty = &acc.Address
+		entry.CounterpartySubAccount = e.CounterCategory
+	case f.CounterPartyId > 0:
+		addr := ctx.Indexer.LookupAddress(ctx, f.CounterPartyId)
+		entry.Counterparty = &addr
+	}
+	return entry
+}
+
+func (e *LedgerEntry) CSV() []string {
+	var cntr, cntrSub string
+	if e.Counterparty != nil {
+		cntr = e.Counterparty.String()
+	}
+	if e.CounterpartySubAccount.IsValid() {
+		cntrSub = e.CounterpartySubAccount.String()
+	}
+	return []string{
+		strconv.FormatUint(e.Id, 10),
+		strconv.FormatInt(e.Height, 10),
+		strconv.FormatInt(e.Cycle, 10),
+		e.Time.UTC().Format(time.RFC3339),
+		strconv.Itoa(e.OpN),
+		strconv.Itoa(e.OpC),
+		strconv.Itoa(e.OpI),
+		e.Account.String(),
+		e.SubAccount.String(),
+		cntr,
+		cntrSub,
+		e.Category,
+		strconv.FormatFloat(e.Debit, 'f', -1, 64),
+		strconv.FormatFloat(e.Credit, 'f', -1, 64),
+		strconv.FormatBool(e.IsTransfer),
+		strconv.FormatBool(e.IsFee),
+		strconv.FormatBool(e.IsBurned),
+	}
+}
+
+// ListAccountLedger exports balance flows of an account as double-entry
+// ledger rows for accounting. Moves between spendable, frozen, staked and
+// unstaked balance are transfers to the account itself. Delegation flows
+// are excluded. Supports `height` and `time` range filters, limit, offset,
+// cursor, order and `format=csv`.
+func ListAccountLedger(ctx *server.Context) (interface{}, int) {
+	args := &LedgerRequest{
+		ListRequest: ListRequest{
+			Order: pack.OrderAsc,
+		},
+	}
+	ctx.ParseRequestArgs(args)
+	switch args.Format {
+	case "", "json", FormatCSV:
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid format '%s'", args.Format), nil))
+	}
+	acc := loadAccount(ctx)
+
+	r := etl.ListRequest{
+		Account: acc,
+		Offset:  args.Offset,
+		Limit:   ctx.Cfg.ClampExplore(args.Limit),
+		Cursor:  args.Cursor,
+		Order:   args.Order,
+	}
+	var (
+		list []*model.LedgerEntry
+		err  error
+		ok   bool
+	)
+	if r.Since, r.Until, ok = parseBlockRange(ctx); ok {
+		list, err = ctx.Indexer.ListLedger(ctx, r)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list ledger", err))
+		}
+	}
+	resp := make([]*LedgerEntry, len(list))
+	for i, v := range list {
+		resp[i] = NewLedgerEntry(ctx, acc, v)
+	}
+	if args.Format != FormatCSV {
+		return resp, http.StatusOK
+	}
+
+	ctx.StreamResponseHeaders(http.StatusOK, "text/csv")
+	w := csv.NewWriter(ctx.ResponseWriter)
+	err = w.Write(ledgerCSVHeader)
+	var cursor string
+	for _, v := range resp {
+		if err != nil {
+			break
+		}
+		err = w.Write(v.CSV())
+		cursor = strconv.FormatUint(v.Id, 10)
+	}
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	ctx.StreamTrailer(cursor, len(resp), err)
+	return nil, -1
+}
@@ -43,6 +43,23 @@ func purgeMetadataStore() {
 	metadataCache.Purge()
 }
 
+// lookupNames returns registered domain names by address or nil when
+// none of the addresses has a name.
+func lookupNames(ctx *server.Context, addrs ...mavryk.Address) map[string]string {
+	var names map[string]string
+	for _, a := range addrs {
+		name, ok := ctx.Indexer.LookupName(ctx, a)
+		if !ok {
+			continue
+		}
+		if names == nil {
+			names = make(map[string]string)
+		}
+		names[a.String()] = name
+	}
+	return names
+}
+
 func lookupAddressIdMetadata(ctx *server.Context, id model.AccountID) (*Metadata, bool) {
 	if id == 0 {
 		return nil, false
@@ -72,13 +89,22 @@ func lookupAddressIdMetadata(ctx *server.Context, id model.AccountID) (*Metadata
 }
 
 func lookupTokenIdMetadata(ctx *server.Context, id model.TokenID) []byte {
+	if md := lookupTokenMeta(ctx, id); md != nil {
+		return md.Data
+	}
+	return nil
+}
+
+// lookupTokenMeta returns the latest resolved metadata record of a token
+// including the status of the last fetch attempt.
+func lookupTokenMeta(ctx *server.Context, id model.TokenID) *model.TokenMeta {
 	if id == 0 {
 		return nil
 	}
 	key := id.U64() | (1 << 63)
 	val, ok := metadataCache.Get(key)
 	if ok {
-		return val.([]byte)
+		return val.(*model.TokenMeta)
 	}
 	table, err := ctx.Indexer.Table(model.TokenMetaTableKey)
 	if err != nil {
@@ -90,13 +116,15 @@ func lookupTokenIdMetadata(ctx *server.Context, id model.TokenID) []byte {
 	md := &model.TokenMeta{}
 	err = pack.NewQuery("token.metadata.find").
 		WithTable(table).
+		WithDesc().
+		WithLimit(1).
 		AndEqual("token", id).
 		Execute(ctx, md)
 	if err != nil || md.Id == 0 {
 		return nil
 	}
-	metadataCache.Add(key, md.Data)
-	return md.Data
+	metadataCache.Add(key, md)
+	return md
 }
 
 func lookupAddressMetadata(ctx *server.Context, addr mavryk.Address) (*Metadata, bool) {
@@ -306,8 +334,8 @@ func (a Metadata) RESTPath(r *mux.Router) string {
 
 func (a Metadata) RegisterDirectRoutes(r *mux.Router) error {
 	r.HandleFunc(a.RESTPrefix(), server.C(ListMetadata)).Methods("GET")
-	r.HandleFunc(a.RESTPrefix(), server.C(CreateMetadata)).Methods("POST")
-	r.HandleFunc(a.RESTPrefix(), server.C(PurgeMetadata)).Methods("DELETE")
+	r.HandleFunc(a.RESTPrefix(), server.W(CreateMetadata)).Methods("POST")
+	r.HandleFunc(a.RESTPrefix(), server.W(PurgeMetadata)).Methods("DELETE")
 	return nil
 }
 
@@ -319,8 +347,8 @@ func (b Metadata) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/schemas/{schema}.json", server.C(ReadMetadataSchema)).Methods("GET")
 	r.HandleFunc("/schemas/{schema}", server.C(ReadMetadataSchema)).Methods("GET")
 	r.HandleFunc("/{ident}", server.C(ReadMetadata)).Methods("GET").Name("meta")
-	r.HandleFunc("/{ident}", server.C(UpdateMetadata)).Methods("PUT")
-	r.HandleFunc("/{ident}", server.C(RemoveMetadata)).Methods("DELETE")
+	r.HandleFunc("/{ident}", server.W(UpdateMetadata)).Methods("PUT")
+	r.HandleFunc("/{ident}", server.W(RemoveMetadata)).Methods("DELETE")
 	return nil
 }
 
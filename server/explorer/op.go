@@ -4,9 +4,11 @@
 package explorer
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -99,6 +101,36 @@ func (l *OpList) Append(op *Op, collapsed bool) {
 	ins.Internal = append(ins.Internal, op)
 }
 
+// FilterMinGas removes ops that used less than minGas. Merged batches are
+// matched by the sum of their members' gas.
+func (l OpList) FilterMinGas(minGas int64) OpList {
+	if minGas <= 0 {
+		return l
+	}
+	return slices.DeleteFunc(l, func(op *Op) bool { return op.GasUsed < minGas })
+}
+
+// CountMinGas returns the number of ops that used at least minGas.
+func (l OpList) CountMinGas(minGas int64) int {
+	var n int
+	for _, op := range l {
+		if op.GasUsed >= minGas {
+			n++
+		}
+	}
+	return n
+}
+
+// SortByGas sorts ops by gas used, ties keep their list order.
+func (l OpList) SortByGas(order pack.OrderType) {
+	slices.SortStableFunc(l, func(a, b *Op) int {
+		if order == pack.OrderDesc {
+			a, b = b, a
+		}
+		return cmp.Compare(a.GasUsed, b.GasUsed)
+	})
+}
+
 func (l OpList) LastModified() time.Time {
 	if len(l) == 0 {
 		return time.Time{}
@@ -155,6 +187,7 @@ type Op struct {
 	IsEvent       bool                      `json:"is_event,omitempty"`
 	IsInternal    bool                      `json:"is_internal,omitempty"`
 	IsRollup      bool                      `json:"is_rollup,omitempty"`
+	IsProtocol    bool                      `json:"is_protocol,omitempty"`
 	GasLimit      int64                     `json:"gas_limit,omitempty"`
 	GasUsed       int64                     `json:"gas_used,omitempty"`
 	StorageLimit  int64                     `json:"storage_limit,omitempty"`
@@ -191,7 +224,9 @@ type Op struct {
 	NOps          int                       `json:"n_ops,omitempty"`
 	Batch         []*Op                     `json:"batch,omitempty"`
 	Internal      []*Op                     `json:"internal,omitempty"`
+	InternalOps   []*InternalOp             `json:"internal_ops,omitempty"`
 	Metadata      map[string]*ShortMetadata `json:"metadata,omitempty"`
+	Names         map[string]string         `json:"names,omitempty"`
 	Events        []*Event                  `json:"events,omitempty"`
 	TicketUpdates []*TicketUpdate           `json:"ticket_updates,omitempty"`
 
@@ -371,6 +406,17 @@ func (o *Op) AddAccounts(ctx *server.Context, op *model.Op, args server.Options)
 			o.Metadata = meta
 		}
 	}
+
+	// add domain names of involved accounts
+	if args.WithNames() {
+		addrs := make([]mavryk.Address, 0, 4)
+		for _, v := range []*mavryk.Address{o.Sender, o.Receiver, o.Creator, o.Baker, o.Source} {
+			if v != nil {
+				addrs = append(addrs, *v)
+			}
+		}
+		o.Names = lookupNames(ctx, addrs...)
+	}
 }
 
 func (o *Op) UnpackData(ctx *server.Context, op *model.Op, cc *model.Contract, args server.Options) error {
@@ -650,6 +696,7 @@ func NewOp(ctx *server.Context, op *model.Op, block *model.Block, cc *model.Cont
 		IsInternal:    op.IsInternal,
 		IsEvent:       op.IsEvent,
 		IsRollup:      op.IsRollup,
+		IsProtocol:    op.IsEvent && op.Type.IsProtocolEvent(),
 		GasLimit:      op.GasLimit,
 		GasUsed:       op.GasUsed,
 		StorageLimit:  op.StorageLimit,
@@ -731,6 +778,90 @@ func (o Op) RESTPrefix() string {
 	return "/explorer/op"
 }
 
+// OpParent identifies the operation that emitted an internal operation.
+type OpParent struct {
+	Type       model.OpType    `json:"type"`
+	OpN        int             `json:"op_n"`
+	Nonce      *int64          `json:"nonce,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	IsInternal bool            `json:"is_internal,omitempty"`
+	Sender     *mavryk.Address `json:"sender,omitempty"`
+	Receiver   *mavryk.Address `json:"receiver,omitempty"`
+	Entrypoint string          `json:"entrypoint,omitempty"`
+}
+
+func newOpParent(n *OpTreeNode) *OpParent {
+	p := &OpParent{
+		Type:       n.Type,
+		OpN:        n.OpN,
+		Status:     n.Status,
+		IsInternal: n.IsInternal,
+		Sender:     n.Sender,
+		Receiver:   n.Receiver,
+	}
+	if n.IsInternal {
+		nonce := n.src.Counter
+		p.Nonce = &nonce
+	}
+	if n.Parameters != nil {
+		p.Entrypoint = n.Parameters.Entrypoint
+	}
+	return p
+}
+
+// InternalOp is a single internal operation with its balance flows, the
+// operation that emitted it and the outer operation of its call tree.
+type InternalOp struct {
+	*OpTreeNode
+	Nonce  int64     `json:"nonce"`
+	Parent *OpParent `json:"parent,omitempty"`
+	Outer  *OpParent `json:"outer"`
+}
+
+// findInternalOp returns the path from the tree root to the internal
+// operation with the given nonce.
+func findInternalOp(node *OpTreeNode, nonce int64) []*OpTreeNode {
+	if node.src.IsInternal && node.src.Counter == nonce {
+		return []*OpTreeNode{node}
+	}
+	for _, c := range node.Children {
+		if path := findInternalOp(c, nonce); path != nil {
+			return append([]*OpTreeNode{node}, path...)
+		}
+	}
+	return nil
+}
+
+// ReadInternalOp returns a single internal operation identified by
+// its nonce within the operation group.
+func ReadInternalOp(ctx *server.Context) (interface{}, int) {
+	nonce, err := strconv.ParseInt(mux.Vars(ctx.Request)["nonce"], 10, 64)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid nonce", err))
+	}
+	args := &OpsRequest{
+		Storage: true,
+	}
+	ctx.ParseRequestArgs(args)
+	ops := loadOps(ctx, args, ctx.Cfg.Http.MaxListCount)
+	for _, root := range BuildOpTree(ctx, ops, args) {
+		path := findInternalOp(root, nonce)
+		if path == nil {
+			continue
+		}
+		resp := &InternalOp{
+			OpTreeNode: path[len(path)-1],
+			Nonce:      nonce,
+			Outer:      newOpParent(root),
+		}
+		if len(path) > 1 {
+			resp.Parent = newOpParent(path[len(path)-2])
+		}
+		return resp, http.StatusOK
+	}
+	panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no internal operation with nonce %d", nonce), nil))
+}
+
 func (o Op) RESTPath(r *mux.Router) string {
 	path, _ := r.Get("op").URLPath("ident", o.Hash)
 	return path.String()
@@ -741,26 +872,38 @@ func (o Op) RegisterDirectRoutes(r *mux.Router) error {
 }
 
 func (t Op) RegisterRoutes(r *mux.Router) error {
+	r.HandleFunc("", server.C(Columnar(ListProtocolOps))).Methods("GET")
 	r.HandleFunc("/{ident}", server.C(ReadOp)).Methods("GET").Name("op")
+	r.HandleFunc("/{ident}/tree", server.C(ReadOpTree)).Methods("GET")
+	r.HandleFunc("/{ident}/storage_diff", server.C(ReadOpStorageDiff)).Methods("GET")
+	r.HandleFunc("/{ident}/{nonce:[0-9]+}", server.C(ReadInternalOp)).Methods("GET")
 	return nil
 
 }
 
+// OrderByGas sorts op lists by gas used instead of position.
+const OrderByGas = "gas"
+
 // used when listing ops in block/account/contract context
 type OpsRequest struct {
 	ListRequest // offset, limit, cursor, order
 
-	Block    string         `schema:"block"`    // height or hash for time-lock
-	Since    string         `schema:"since"`    // block hash or height for updates
-	Unpack   bool           `schema:"unpack"`   // unpack packed key/values
-	Prim     bool           `schema:"prim"`     // for prim/value rendering
-	Meta     bool           `schema:"meta"`     // include account metadata
-	Rights   bool           `schema:"rights"`   // include block rights
-	Merge    bool           `schema:"merge"`    // merge batch lists and internal ops
-	Storage  bool           `schema:"storage"`  // embed storage update
-	Address  mavryk.Address `schema:"address"`  // filter by any address
-	Sender   mavryk.Address `schema:"sender"`   // filter by sender
-	Receiver mavryk.Address `schema:"receiver"` // filter by receiver
+	Block    string         `schema:"block"`         // height or hash for time-lock
+	Since    string         `schema:"since"`         // block hash or height for updates
+	Unpack   bool           `schema:"unpack"`        // unpack packed key/values
+	Prim     bool           `schema:"prim"`          // for prim/value rendering
+	Meta     bool           `schema:"meta"`          // include account metadata
+	Rights   bool           `schema:"rights"`        // include block rights
+	Merge    bool           `schema:"merge"`         // merge batch lists and internal ops
+	Storage  bool           `schema:"storage"`       // embed storage update
+	Names    bool           `schema:"with_names"`    // include domain names
+	Internal bool           `schema:"with_internal"` // include internal operations
+	Address  mavryk.Address `schema:"address"`       // filter by any address
+	Sender   mavryk.Address `schema:"sender"`        // filter by sender
+	Receiver mavryk.Address `schema:"receiver"`      // filter by receiver
+	FeePayer mavryk.Address `schema:"fee_payer"`     // filter by fee payer
+	MinGas   int64          `schema:"min_gas"`       // filter by min gas used
+	OrderBy  string         `schema:"order_by"`      // sort by gas (block lists only)
 
 	// decoded type condition
 	TypeMode pack.FilterMode  `schema:"-"`
@@ -785,6 +928,7 @@ func (r *OpsRequest) WithMeta() bool    { return r != nil && r.Meta }
 func (r *OpsRequest) WithRights() bool  { return r != nil && r.Rights }
 func (r *OpsRequest) WithMerge() bool   { return r != nil && r.Merge }
 func (r *OpsRequest) WithStorage() bool { return r != nil && r.Storage }
+func (r *OpsRequest) WithNames() bool   { return r != nil && r.Names }
 
 // implement ParsableRequest interface
 func (r *OpsRequest) Parse(ctx *server.Context) {
@@ -835,6 +979,14 @@ func (r *OpsRequest) Parse(ctx *server.Context) {
 			r.TypeList = append(r.TypeList, typ)
 		}
 	}
+	switch r.OrderBy {
+	case "", OrderByGas:
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid order_by %q", r.OrderBy), nil))
+	}
+	if r.MinGas < 0 {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "negative min_gas", nil))
+	}
 	// filter by time condition
 	if mode, val, ok := server.Query(ctx, "time"); ok {
 		switch mode {
@@ -925,3 +1077,277 @@ func ReadOp(ctx *server.Context) (interface{}, int) {
 	}
 	return resp, http.StatusOK
 }
+
+// ListProtocolOps lists balance changes injected by protocol migrations
+// (invoices, airdrops and contract migrations). These events are not part
+// of any block operation list, but they affect supply. Use `type` to select
+// a subset and `receiver` to filter by recipient.
+func ListProtocolOps(ctx *server.Context) (interface{}, int) {
+	args := &OpsRequest{}
+	ctx.ParseRequestArgs(args)
+
+	for _, typ := range args.TypeList {
+		if !typ.IsProtocolEvent() {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unsupported operation type %q", typ), nil))
+		}
+	}
+	if args.TypeMode.IsValid() && !(args.TypeMode == pack.FilterModeEqual || args.TypeMode == pack.FilterModeIn) {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("unsupported type filter mode %q", args.TypeMode), nil))
+	}
+
+	r := etl.ListRequest{
+		Mode:   args.TypeMode,
+		Typs:   args.TypeList,
+		Since:  args.SinceHeight,
+		Until:  args.BlockHeight,
+		Offset: args.Offset,
+		Limit:  ctx.Cfg.ClampExplore(args.Limit),
+		Cursor: args.Cursor,
+		Order:  args.Order,
+	}
+	if args.Receiver.IsValid() {
+		if a, err := ctx.Indexer.LookupAccount(ctx.Context, args.Receiver); err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such receiver account", err))
+		} else {
+			r.ReceiverId = a.RowId
+		}
+	}
+
+	ops, err := ctx.Indexer.ListProtocolOps(ctx, r)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read protocol operations", err))
+	}
+	resp := make(OpList, 0, len(ops))
+	cache := make(map[int64]interface{})
+	for _, v := range ops {
+		resp = append(resp, NewOp(ctx, v, nil, nil, args, cache))
+	}
+	return resp, http.StatusOK
+}
+
+// OpFlow is a balance update caused by a single operation tree node.
+type OpFlow struct {
+	Account   mavryk.Address `json:"address"`
+	Kind      string         `json:"kind"`
+	Type      string         `json:"type"`
+	AmountIn  float64        `json:"amount_in,omitempty"`
+	AmountOut float64        `json:"amount_out,omitempty"`
+	IsFee     bool           `json:"is_fee,omitempty"`
+	IsBurned  bool           `json:"is_burned,omitempty"`
+	IsFrozen  bool           `json:"is_frozen,omitempty"`
+}
+
+// OpTreeNode is an operation with its direct internal operations as children.
+type OpTreeNode struct {
+	*Op
+	Depth    int           `json:"depth"`
+	Flows    []*OpFlow     `json:"flows,omitempty"`
+	Children []*OpTreeNode `json:"children,omitempty"`
+
+	src *model.Op
+}
+
+// OpTree is a list of call trees, one per content of an operation group.
+type OpTree []*OpTreeNode
+
+func (t OpTree) LastModified() time.Time {
+	if len(t) == 0 {
+		return time.Time{}
+	}
+	return t[0].Timestamp
+}
+
+func (t OpTree) Expires() time.Time {
+	if len(t) == 0 {
+		return time.Time{}
+	}
+	return t[0].expires
+}
+
+var _ server.Resource = (*OpTree)(nil)
+
+// BuildOpTree reconstructs internal call trees from a flat, execution-ordered
+// list of operations. The indexer does not keep explicit parent links, so the
+// parent of an internal operation is the closest preceding node in the same
+// tree that targets the internal operation's direct source and was emitted
+// before it (i.e. is an outer operation or has a lower nonce). Self-calls that
+// emit further self-calls cannot be told apart from siblings and are attached
+// to the deepest matching node.
+func BuildOpTree(ctx *server.Context, ops []*model.Op, args server.Options) OpTree {
+	var (
+		nodes = make([]*OpTreeNode, 0, len(ops))
+		cache = make(map[int64]interface{})
+	)
+	for _, op := range ops {
+		node := &OpTreeNode{
+			Op:  NewOp(ctx, op, nil, nil, args, cache),
+			src: op,
+		}
+		nodes = append(nodes, node)
+	}
+	tree := linkOpTree(nodes)
+
+	// attach flows
+	if len(nodes) > 0 {
+		opn := make([]int, len(nodes))
+		byN := make(map[int]*OpTreeNode, len(nodes))
+		for i, n := range nodes {
+			opn[i] = n.src.OpN
+			byN[n.src.OpN] = n
+		}
+		flows, err := ctx.Indexer.ListOpFlows(ctx, nodes[0].src.Height, opn)
+		if err != nil {
+			log.Errorf("%s: cannot load flows: %v", ctx.RequestString(), err)
+		}
+		for _, f := range flows {
+			n, ok := byN[f.OpN]
+			if !ok {
+				continue
+			}
+			n.Flows = append(n.Flows, &OpFlow{
+				Account:   ctx.Indexer.LookupAddress(ctx, f.AccountId),
+				Kind:      f.Kind.String(),
+				Type:      f.Type.String(),
+				AmountIn:  ctx.Params.ConvertValue(f.AmountIn),
+				AmountOut: ctx.Params.ConvertValue(f.AmountOut),
+				IsFee:     f.IsFee,
+				IsBurned:  f.IsBurned,
+				IsFrozen:  f.IsFrozen,
+			})
+		}
+	}
+	return tree
+}
+
+// linkOpTree attaches internal operations to their parents, see BuildOpTree.
+func linkOpTree(nodes []*OpTreeNode) OpTree {
+	tree := make(OpTree, 0)
+	var first int
+	for i, node := range nodes {
+		op := node.src
+		if !op.IsInternal || len(tree) == 0 {
+			tree = append(tree, node)
+			first = i
+			continue
+		}
+		parent := tree[len(tree)-1]
+		for j := i - 1; j >= first; j-- {
+			n := nodes[j].src
+			if n.ReceiverId != op.CreatorId {
+				continue
+			}
+			if n.IsInternal && n.Counter >= op.Counter {
+				continue
+			}
+			parent = nodes[j]
+			break
+		}
+		node.Depth = parent.Depth + 1
+		parent.Children = append(parent.Children, node)
+	}
+	return tree
+}
+
+// InternalOps returns all internal operations emitted by the operation at
+// position opn, directly or through nested calls, in execution order.
+func (t OpTree) InternalOps(opn int) []*InternalOp {
+	for _, root := range t {
+		if node := findOpNode(root, opn); node != nil {
+			return flattenInternalOps(root, node)
+		}
+	}
+	return nil
+}
+
+func findOpNode(node *OpTreeNode, opn int) *OpTreeNode {
+	if node.src.OpN == opn {
+		return node
+	}
+	for _, c := range node.Children {
+		if n := findOpNode(c, opn); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// flattenInternalOps lists descendants of node without their children,
+// each linked to its parent and the outer operation root.
+func flattenInternalOps(root, node *OpTreeNode) []*InternalOp {
+	list := make([]*InternalOp, 0)
+	var walk func(*OpTreeNode)
+	walk = func(p *OpTreeNode) {
+		for _, c := range p.Children {
+			n := *c
+			n.Children = nil
+			list = append(list, &InternalOp{
+				OpTreeNode: &n,
+				Nonce:      c.src.Counter,
+				Parent:     newOpParent(p),
+				Outer:      newOpParent(root),
+			})
+			walk(c)
+		}
+	}
+	walk(node)
+	slices.SortStableFunc(list, func(a, b *InternalOp) int { return a.OpN - b.OpN })
+	return list
+}
+
+// listInternalOps loads the call trees of listed operations and returns
+// their internal operations by operation id. Operation groups are loaded
+// once per hash and only for operations which can emit internal calls.
+func listInternalOps(ctx *server.Context, ops []*model.Op, args server.Options) map[uint64][]*InternalOp {
+	res := make(map[uint64][]*InternalOp)
+	hasInternal := func(op *model.Op) bool {
+		return op.IsSuccess && (op.IsContract || op.IsRollup) && op.Hash.IsValid()
+	}
+	hashes := make([]mavryk.OpHash, 0)
+	seen := make(map[mavryk.OpHash]struct{})
+	for _, op := range ops {
+		if !hasInternal(op) {
+			continue
+		}
+		if _, ok := seen[op.Hash]; ok {
+			continue
+		}
+		seen[op.Hash] = struct{}{}
+		hashes = append(hashes, op.Hash)
+	}
+	if len(hashes) == 0 {
+		return res
+	}
+
+	// load all groups at once
+	r := etl.ListRequest{
+		Limit:       ctx.Cfg.ClampExplore(ctx.Cfg.Http.MaxListCount),
+		WithStorage: args.WithStorage(),
+	}
+	groups, err := ctx.Indexer.LookupOpGroups(ctx, hashes, r)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read operation groups", err))
+	}
+	trees := make(map[mavryk.OpHash]OpTree)
+	for _, op := range ops {
+		group, ok := groups[op.Hash]
+		if !ok || !hasInternal(op) {
+			continue
+		}
+		tree, ok := trees[op.Hash]
+		if !ok {
+			tree = BuildOpTree(ctx, group, args)
+			trees[op.Hash] = tree
+		}
+		if list := tree.InternalOps(op.OpN); len(list) > 0 {
+			res[op.Id()] = list
+		}
+	}
+	return res
+}
+
+func ReadOpTree(ctx *server.Context) (interface{}, int) {
+	args := &OpsRequest{}
+	ctx.ParseRequestArgs(args)
+	ops := loadOps(ctx, args, ctx.Cfg.Http.MaxListCount)
+	return BuildOpTree(ctx, ops, args), http.StatusOK
+}
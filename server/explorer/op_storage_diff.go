@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// StorageDiff is the storage change of a contract caused by an operation
+// including all internal calls to this contract.
+type StorageDiff struct {
+	Contract   mavryk.Address    `json:"contract"`
+	NCalls     int               `json:"n_calls"`
+	IsChanged  bool              `json:"is_changed"`
+	Before     *Storage          `json:"before,omitempty"` // empty on origination
+	After      *Storage          `json:"after,omitempty"`
+	BigmapDiff *BigmapUpdateList `json:"big_map_diff,omitempty"`
+}
+
+// storageOps groups successful contract calls and originations by target
+// contract in order of first appearance.
+func storageOps(ops []*model.Op) [][]*model.Op {
+	groups := make([][]*model.Op, 0)
+	index := make(map[model.AccountID]int)
+	for _, op := range ops {
+		if !op.IsSuccess || !op.IsContract {
+			continue
+		}
+		switch op.Type {
+		case model.OpTypeTransaction, model.OpTypeOrigination, model.OpTypeSubsidy:
+		default:
+			continue
+		}
+		i, ok := index[op.ReceiverId]
+		if !ok {
+			i = len(groups)
+			index[op.ReceiverId] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], op)
+	}
+	return groups
+}
+
+// ReadOpStorageDiff returns storage before and after an operation and the
+// bigmap updates it caused for each contract the operation called, including
+// internal calls. Storage before is the result of the latest earlier call to
+// the contract, which may be in the same block.
+func ReadOpStorageDiff(ctx *server.Context) (interface{}, int) {
+	args := &OpsRequest{
+		Storage: true,
+	}
+	ctx.ParseRequestArgs(args)
+	ops := loadOps(ctx, args, ctx.Cfg.Http.MaxListCount)
+
+	resp := make([]*StorageDiff, 0)
+	cache := make(map[int64]interface{})
+	for _, group := range storageOps(ops) {
+		first, last := group[0], group[len(group)-1]
+		_, sTyp, _, err := ctx.Indexer.LookupContractType(ctx, first.ReceiverId)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot load contract type", err))
+		}
+		diff := &StorageDiff{
+			Contract: ctx.Indexer.LookupAddress(ctx, first.ReceiverId),
+			NCalls:   len(group),
+		}
+
+		var before []byte
+		if first.Type != model.OpTypeOrigination {
+			store, err := ctx.Indexer.LookupStorageBefore(ctx, first.ReceiverId, first.RowId, first.Height)
+			switch err {
+			case nil:
+				before = store.Storage
+				diff.Before = NewStorage(ctx, before, sTyp, ctx.Indexer.LookupBlockTime(ctx, store.Height), args)
+			case model.ErrNoStorage:
+			default:
+				panic(server.EInternal(server.EC_DATABASE, "cannot load storage", err))
+			}
+		}
+		after := last.Storage
+		if len(after) > 0 {
+			diff.After = NewStorage(ctx, after, sTyp, last.Timestamp, args)
+		}
+		diff.IsChanged = !bytes.Equal(before, after)
+
+		// bigmap updates of all calls in order
+		for _, op := range group {
+			if len(op.BigmapUpdates) == 0 {
+				continue
+			}
+			o := &Op{}
+			o.AddBigmapUpdates(ctx, op, nil, args, cache)
+			if diff.BigmapDiff == nil {
+				diff.BigmapDiff = o.BigmapDiff
+			} else {
+				diff.BigmapDiff.diff = append(diff.BigmapDiff.diff, o.BigmapDiff.diff...)
+			}
+		}
+		resp = append(resp, diff)
+	}
+	return resp, http.StatusOK
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl/model"
+)
+
+func TestOpTreeInternalOps(t *testing.T) {
+	// outer call to KT1 (10) which calls KT2 (20) and pays tz (2), KT2
+	// calls KT3 (30) which pays tz (3); execution order is depth-first
+	// while nonces follow emission order
+	ops := []*model.Op{
+		{OpN: 0, SenderId: 1, ReceiverId: 10, IsContract: true},
+		{OpN: 1, Counter: 0, CreatorId: 10, ReceiverId: 20, IsInternal: true, IsContract: true},
+		{OpN: 2, Counter: 2, CreatorId: 20, ReceiverId: 30, IsInternal: true, IsContract: true},
+		{OpN: 3, Counter: 3, CreatorId: 30, ReceiverId: 3, IsInternal: true},
+		{OpN: 4, Counter: 1, CreatorId: 10, ReceiverId: 2, IsInternal: true},
+		{OpN: 5, SenderId: 1, ReceiverId: 2},
+	}
+	nodes := make([]*OpTreeNode, len(ops))
+	for i, op := range ops {
+		op.Type = model.OpTypeTransaction
+		op.IsSuccess = true
+		nodes[i] = &OpTreeNode{
+			Op:  &Op{Type: op.Type, OpN: op.OpN, IsInternal: op.IsInternal},
+			src: op,
+		}
+	}
+	tree := linkOpTree(nodes)
+	if got := len(tree); got != 2 {
+		t.Fatalf("want 2 roots, got %d", got)
+	}
+
+	list := tree.InternalOps(0)
+	want := []struct {
+		opn, depth, parent int
+		nonce              int64
+	}{
+		{1, 1, 0, 0},
+		{2, 2, 1, 2},
+		{3, 3, 2, 3},
+		{4, 1, 0, 1},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("want %d internal ops, got %d", len(want), len(list))
+	}
+	for i, w := range want {
+		v := list[i]
+		if v.OpN != w.opn || v.Depth != w.depth || v.Nonce != w.nonce {
+			t.Errorf("op %d: got op_n=%d depth=%d nonce=%d", i, v.OpN, v.Depth, v.Nonce)
+		}
+		if v.Parent == nil || v.Parent.OpN != w.parent {
+			t.Errorf("op %d: wrong parent %v", i, v.Parent)
+		}
+		if v.Outer == nil || v.Outer.OpN != 0 {
+			t.Errorf("op %d: wrong outer op %v", i, v.Outer)
+		}
+		if v.Children != nil {
+			t.Errorf("op %d: unexpected children", i)
+		}
+	}
+
+	// listing a nested internal call only returns its own subtree
+	list = tree.InternalOps(1)
+	if len(list) != 2 || list[0].OpN != 2 || list[1].OpN != 3 {
+		t.Errorf("unexpected subtree %v", list)
+	}
+	if list[0].Outer.OpN != 0 || list[0].Parent.OpN != 1 {
+		t.Errorf("wrong links in subtree")
+	}
+	if list := tree.InternalOps(5); len(list) != 0 {
+		t.Errorf("unexpected internal ops for plain transfer")
+	}
+	if list := tree.InternalOps(9); list != nil {
+		t.Errorf("unexpected internal ops for unknown op")
+	}
+}
+
+func TestOpListFilterMinGas(t *testing.T) {
+	newOp := func(opn, opp int, gas int64) *Op {
+		return &Op{Type: model.OpTypeTransaction, Height: 1, OpN: opn, OpP: &opp, GasUsed: gas}
+	}
+
+	// batch at position 0 with two small members, single ops at 1 and 2
+	var merged OpList
+	for _, op := range []*Op{newOp(0, 0, 600), newOp(1, 0, 600), newOp(2, 1, 1000), newOp(3, 2, 999)} {
+		merged.Append(op, true)
+	}
+	if got := merged.CountMinGas(1000); got != 2 {
+		t.Errorf("merged: want 2 matching ops, got %d", got)
+	}
+	merged = merged.FilterMinGas(1000)
+	if len(merged) != 2 {
+		t.Fatalf("merged: want 2 ops, got %d", len(merged))
+	}
+	if merged[0].Type != model.OpTypeBatch || merged[0].GasUsed != 1200 {
+		t.Errorf("merged: want batch with 1200 gas, got %s with %d", merged[0].Type, merged[0].GasUsed)
+	}
+	if merged[1].OpN != 2 {
+		t.Errorf("merged: want op 2 at threshold, got op %d", merged[1].OpN)
+	}
+
+	// unmerged batch members are matched individually
+	list := OpList{newOp(0, 0, 600), newOp(1, 0, 600), newOp(2, 1, 1000)}
+	if got := len(list.FilterMinGas(601)); got != 1 {
+		t.Errorf("unmerged: want 1 op, got %d", got)
+	}
+	if got := len(list.FilterMinGas(0)); got != 3 {
+		t.Errorf("no threshold: want 3 ops, got %d", got)
+	}
+
+	list = OpList{newOp(0, 0, 5), newOp(1, 1, 20), newOp(2, 2, 5), newOp(3, 3, 10)}
+	list.SortByGas(pack.OrderDesc)
+	for i, want := range []int{1, 3, 0, 2} {
+		if list[i].OpN != want {
+			t.Errorf("sort: pos %d want op %d, got %d", i, want, list[i].OpN)
+		}
+	}
+}
+
+func TestOpStorageOps(t *testing.T) {
+	// KT1 (10) calls KT2 (20) which calls back into KT1, the failed
+	// call and transfers to implicit accounts are skipped
+	ops := []*model.Op{
+		{OpN: 0, Type: model.OpTypeTransaction, ReceiverId: 10, IsContract: true, IsSuccess: true},
+		{OpN: 1, Type: model.OpTypeTransaction, ReceiverId: 20, IsContract: true, IsSuccess: true},
+		{OpN: 2, Type: model.OpTypeTransaction, ReceiverId: 2, IsSuccess: true},
+		{OpN: 3, Type: model.OpTypeTransaction, ReceiverId: 10, IsContract: true, IsSuccess: true},
+		{OpN: 4, Type: model.OpTypeTransaction, ReceiverId: 30, IsContract: true},
+	}
+	groups := storageOps(ops)
+	if len(groups) != 2 {
+		t.Fatalf("want 2 contracts, got %d", len(groups))
+	}
+	for i, want := range [][]int{{0, 3}, {1}} {
+		if len(groups[i]) != len(want) {
+			t.Fatalf("contract %d: want %d calls, got %d", i, len(want), len(groups[i]))
+		}
+		for j, n := range want {
+			if groups[i][j].OpN != n {
+				t.Errorf("contract %d call %d: want op %d, got %d", i, j, n, groups[i][j].OpN)
+			}
+		}
+	}
+}
@@ -15,7 +15,7 @@ import (
 
 type Parameters struct {
 	Entrypoint string          `json:"entrypoint,omitempty"`      // contract, ticket transfer
-	Value      interface{}     `json:"value,omitempty"`           // contract
+	Value      interface{}     `json:"value,omitempty"`           // contract, ticket transfer
 	Prim       *micheline.Prim `json:"prim,omitempty"`            // contract
 	Kind       string          `json:"kind,omitempty"`            // rollup kind
 	L2Address  *mavryk.Address `json:"l2_address,omitempty"`      // tx rollup
@@ -113,6 +113,7 @@ func NewTicketTransferParameters(ctx *server.Context, op *model.Op, args server.
 	p.Ticketer = &addr
 	z := mavryk.NewBigZ(prim.Args[1].Args[1].Args[1].Int)
 	p.Amount = &z
+	p.Value = decodeTicketContent(*p.Type, *p.Contents, args.WithUnpack())
 	return p
 }
 
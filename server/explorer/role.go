@@ -0,0 +1,66 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type ContractRole struct {
+	Role        string         `json:"role"`
+	Address     mavryk.Address `json:"address"`
+	FirstHeight int64          `json:"first_height"`
+	LastHeight  int64          `json:"last_height,omitempty"`
+	IsActive    bool           `json:"is_active"`
+}
+
+type ContractRoleRequest struct {
+	ListRequest
+	All bool `schema:"all"` // include removed roles
+}
+
+// ListContractRoles lists admin/operator roles extracted from contract
+// storage. Only contracts matching a configured role pattern are indexed.
+func ListContractRoles(ctx *server.Context) (interface{}, int) {
+	args := &ContractRoleRequest{}
+	ctx.ParseRequestArgs(args)
+	cc := loadContract(ctx)
+
+	table, err := ctx.Indexer.Table(model.ContractRoleTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "roles not indexed", err))
+	}
+	q := pack.NewQuery("api.list_contract_roles").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset)).
+		AndEqual("contract", cc.AccountId)
+	if !args.All {
+		q = q.AndEqual("last_height", 0)
+	}
+	if args.Cursor > 0 {
+		q = q.And("row_id", args.Mode(), args.Cursor)
+	}
+	list := make([]*model.ContractRole, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list contract roles", err))
+	}
+	resp := make([]*ContractRole, len(list))
+	for i, v := range list {
+		resp[i] = &ContractRole{
+			Role:        v.Role,
+			Address:     v.Address,
+			FirstHeight: v.FirstHeight,
+			LastHeight:  v.LastHeight,
+			IsActive:    v.IsActive(),
+		}
+	}
+	return resp, http.StatusOK
+}
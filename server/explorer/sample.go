@@ -0,0 +1,47 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"math/rand"
+)
+
+// reservoir keeps a uniform random sample of at most size items from a
+// stream of unknown length (reservoir sampling). Size 0 keeps all items.
+type reservoir[T any] struct {
+	items []T
+	size  int
+	n     int
+	rnd   *rand.Rand
+}
+
+func newReservoir[T any](size int, seed int64) *reservoir[T] {
+	return &reservoir[T]{
+		size: size,
+		rnd:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Slot counts the next stream item and returns the index where it must be
+// stored, or -1 when the item is not part of the sample.
+func (r *reservoir[T]) Slot() int {
+	r.n++
+	if r.size == 0 || len(r.items) < r.size {
+		var zero T
+		r.items = append(r.items, zero)
+		return len(r.items) - 1
+	}
+	// replace a random element with probability size/n
+	if i := r.rnd.Intn(r.n); i < r.size {
+		return i
+	}
+	return -1
+}
+
+// Add offers v to the sample.
+func (r *reservoir[T]) Add(v T) {
+	if i := r.Slot(); i >= 0 {
+		r.items[i] = v
+	}
+}
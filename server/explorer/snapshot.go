@@ -0,0 +1,136 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/csv"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const snapshotBatchSize = 1024
+
+type SnapshotRequest struct {
+	Height           int64  `schema:"height"`            // snapshot height (required)
+	Min              string `schema:"min"`               // min balance in base units (inclusive)
+	Token            string `schema:"token"`             // token address, empty for native balances
+	ExcludeContracts bool   `schema:"exclude_contracts"` // skip smart contracts
+	ExcludeBakers    bool   `schema:"exclude_bakers"`    // skip bakers
+}
+
+// ListSnapshotBalances streams `address,balance` CSV rows for all accounts
+// with a balance of at least `min` at `height`. Native balances are rebuilt
+// from balance flows, token balances (with `token`) from token events. All
+// amounts are in base units. Bakers are excluded by their current status.
+// Native snapshots scan the entire flow table into memory and require the
+// admin key.
+func ListSnapshotBalances(ctx *server.Context) (interface{}, int) {
+	args := &SnapshotRequest{}
+	ctx.ParseRequestArgs(args)
+	if args.Height <= 0 {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing height", nil))
+	}
+	if args.Height > ctx.Tip.BestHeight {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "height is in the future", nil))
+	}
+
+	var (
+		balances map[model.AccountID]string
+		err      error
+	)
+	if args.Token != "" {
+		addr, perr := mavryk.ParseToken(args.Token)
+		if perr != nil {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid token address", perr))
+		}
+		minZ := mavryk.Zero
+		if args.Min != "" {
+			if minZ, err = mavryk.ParseZ(args.Min); err != nil {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid min balance", err))
+			}
+		}
+		tokn := lookupToken(ctx, addr)
+		list, qerr := ctx.Indexer.SnapshotTokenBalances(ctx, tokn.Id, args.Height)
+		if qerr != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot read token balances", qerr))
+		}
+		balances = make(map[model.AccountID]string, len(list))
+		for id, bal := range list {
+			if bal.IsZero() || bal.IsLess(minZ) {
+				continue
+			}
+			balances[id] = bal.String()
+		}
+	} else {
+		if !ctx.IsAdmin() {
+			panic(server.EUnauthorized(server.EC_ACCESS_TOKEN_MISSING, "native balance snapshots require the admin key", nil))
+		}
+		var minN int64
+		if args.Min != "" {
+			if minN, err = strconv.ParseInt(args.Min, 10, 64); err != nil {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid min balance", err))
+			}
+		}
+		list, qerr := ctx.Indexer.SnapshotBalances(ctx, args.Height)
+		if qerr != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot read balances", qerr))
+		}
+		balances = make(map[model.AccountID]string, len(list))
+		for id, bal := range list {
+			if bal <= 0 || bal < minN {
+				continue
+			}
+			balances[id] = strconv.FormatInt(bal, 10)
+		}
+	}
+
+	table, err := ctx.Indexer.Table(model.AccountTableKey)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot access account table", err))
+	}
+
+	// stable output order
+	ids := make([]model.AccountID, 0, len(balances))
+	for id := range balances {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	ctx.StreamResponseHeaders(http.StatusOK, "text/csv")
+	w := csv.NewWriter(ctx.ResponseWriter)
+	err = w.Write([]string{"address", "balance"})
+	var count int
+	for len(ids) > 0 && err == nil {
+		n := min(len(ids), snapshotBatchSize)
+		batch := ids[:n]
+		ids = ids[n:]
+		acc := &model.Account{}
+		err = pack.NewQuery("api.snapshot_accounts").
+			WithTable(table).
+			WithFields("row_id", "address", "is_contract", "is_baker").
+			AndIn("row_id", batch).
+			Stream(ctx, func(r pack.Row) error {
+				if err := r.Decode(acc); err != nil {
+					return err
+				}
+				if args.ExcludeContracts && acc.IsContract || args.ExcludeBakers && acc.IsBaker {
+					return nil
+				}
+				count++
+				return w.Write([]string{acc.Address.String(), balances[acc.RowId]})
+			})
+		w.Flush()
+		if err == nil {
+			err = w.Error()
+		}
+	}
+	ctx.StreamTrailer("", count, err)
+	return nil, -1
+}
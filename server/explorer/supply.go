@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -147,3 +148,132 @@ func ReadSupply(ctx *server.Context) (interface{}, int) {
 		return Supply{*s, ctx.Crawler.Params()}, http.StatusOK
 	}
 }
+
+// completed cycle supply is immutable, only the current cycle is re-read
+var supplyStore = &cycleSupplyStore{cycle: -1}
+
+type cycleSupplyStore struct {
+	sync.Mutex
+	list  []*model.Supply // supply at the end of each completed cycle
+	cycle int64           // last completed cycle in list
+}
+
+func purgeSupplyStore() {
+	supplyStore.Lock()
+	defer supplyStore.Unlock()
+	supplyStore.list = nil
+	supplyStore.cycle = -1
+}
+
+func (s *cycleSupplyStore) Get(ctx *server.Context) []*model.Supply {
+	s.Lock()
+	defer s.Unlock()
+	fresh, err := ctx.Indexer.ListCycleSupply(ctx, s.cycle)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read supply data", err))
+	}
+	if n := len(fresh); n > 1 {
+		s.list = append(s.list, fresh[:n-1]...)
+		s.cycle = fresh[n-2].Cycle
+		fresh = fresh[n-1:]
+	}
+	list := make([]*model.Supply, 0, len(s.list)+len(fresh))
+	list = append(list, s.list...)
+	return append(list, fresh...)
+}
+
+type SupplySeriesPoint struct {
+	StartCycle  int64     `json:"start_cycle"`
+	EndCycle    int64     `json:"end_cycle"`
+	Height      int64     `json:"height"`
+	Timestamp   time.Time `json:"time"`
+	Total       float64   `json:"total"`
+	Circulating float64   `json:"circulating"`
+	Frozen      float64   `json:"frozen"`
+	Staked      float64   `json:"staked"`
+	Minted      float64   `json:"minted"`
+	Burned      float64   `json:"burned"`
+	DeltaTotal  float64   `json:"total_delta"`
+	DeltaFrozen float64   `json:"frozen_delta"`
+	DeltaStaked float64   `json:"staked_delta"`
+	DeltaMinted float64   `json:"minted_delta"`
+	DeltaBurned float64   `json:"burned_delta"`
+}
+
+type SupplySeries struct {
+	list     []SupplySeriesPoint
+	modified time.Time
+	expires  time.Time
+}
+
+func (s SupplySeries) MarshalJSON() ([]byte, error) { return json.Marshal(s.list) }
+func (s SupplySeries) LastModified() time.Time      { return s.modified }
+func (s SupplySeries) Expires() time.Time           { return s.expires }
+
+var _ server.Resource = (*SupplySeries)(nil)
+
+type SupplySeriesRequest struct {
+	Collapse string `schema:"collapse"` // interval, e.g. 1cycle, 10cycles, 1000blocks, 3d
+}
+
+// ListSupplySeries returns supply since genesis at the end of each collapse
+// interval together with changes over the interval. Values are taken from
+// per-cycle supply records, so intervals shorter than a cycle yield one point
+// per cycle. Supply changes injected during protocol migrations are accounted
+// at their migration block.
+func ListSupplySeries(ctx *server.Context) (interface{}, int) {
+	args := &SupplySeriesRequest{}
+	ctx.ParseRequestArgs(args)
+	if args.Collapse == "" {
+		args.Collapse = "1cycle"
+	}
+	ival, err := ParseInterval(args.Collapse)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, err.Error(), err))
+	}
+
+	params := ctx.Crawler.Params()
+	list := supplyStore.Get(ctx)
+	resp := &SupplySeries{
+		list:    make([]SupplySeriesPoint, 0),
+		expires: ctx.Expires,
+	}
+	var (
+		prev  model.Supply
+		start int64 = -1
+	)
+	for i, v := range list {
+		bucket := ival.Bucket(v.Height, v.Cycle, v.Timestamp)
+		if start < 0 {
+			start = v.Cycle
+		}
+		// emit at the end of each interval and for the current cycle
+		if i < len(list)-1 {
+			next := list[i+1]
+			if ival.Bucket(next.Height, next.Cycle, next.Timestamp) == bucket {
+				continue
+			}
+		}
+		resp.list = append(resp.list, SupplySeriesPoint{
+			StartCycle:  start,
+			EndCycle:    v.Cycle,
+			Height:      v.Height,
+			Timestamp:   v.Timestamp,
+			Total:       params.ConvertValue(v.Total),
+			Circulating: params.ConvertValue(v.Circulating),
+			Frozen:      params.ConvertValue(v.Frozen),
+			Staked:      params.ConvertValue(v.FrozenStake),
+			Minted:      params.ConvertValue(v.Minted),
+			Burned:      params.ConvertValue(v.Burned),
+			DeltaTotal:  params.ConvertValue(v.Total - prev.Total),
+			DeltaFrozen: params.ConvertValue(v.Frozen - prev.Frozen),
+			DeltaStaked: params.ConvertValue(v.FrozenStake - prev.FrozenStake),
+			DeltaMinted: params.ConvertValue(v.Minted - prev.Minted),
+			DeltaBurned: params.ConvertValue(v.Burned - prev.Burned),
+		})
+		prev = *v
+		start = -1
+		resp.modified = v.Timestamp
+	}
+	return resp, http.StatusOK
+}
@@ -6,6 +6,7 @@ package explorer
 import (
 	"errors"
 	"net/http"
+	"slices"
 	"time"
 
 	"blockwatch.cc/packdb/pack"
@@ -21,6 +22,7 @@ type Ticket struct {
 	Ticketer     mavryk.Address `json:"ticketer"`
 	Type         micheline.Prim `json:"type"`
 	Content      micheline.Prim `json:"content"`
+	Value        any            `json:"value,omitempty"`
 	Hash         string         `json:"hash"`
 	Creator      mavryk.Address `json:"creator"`
 	FirstBlock   int64          `json:"first_block"`
@@ -40,6 +42,7 @@ func NewTicket(ctx *server.Context, tick *model.Ticket) *Ticket {
 		Ticketer:     tick.Address,
 		Type:         tick.Type,
 		Content:      tick.Content,
+		Value:        decodeTicketContent(tick.Type, tick.Content, false),
 		Hash:         util.U64String(tick.Hash).String(),
 		Creator:      ctx.Indexer.LookupAddress(ctx, tick.Creator),
 		FirstBlock:   tick.FirstBlock,
@@ -67,6 +70,7 @@ type TicketOwner struct {
 	Ticketer     mavryk.Address `json:"ticketer"`
 	Type         micheline.Prim `json:"type"`
 	Content      micheline.Prim `json:"content"`
+	Value        any            `json:"value,omitempty"`
 	Hash         string         `json:"hash"`
 	Account      mavryk.Address `json:"account"`
 	Balance      mavryk.Z       `json:"balance"`
@@ -89,6 +93,7 @@ func NewTicketOwner(ctx *server.Context, ownr *model.TicketOwner, tick *model.Ti
 		Ticketer:     tick.Address,
 		Type:         tick.Type,
 		Content:      tick.Content,
+		Value:        decodeTicketContent(tick.Type, tick.Content, false),
 		Hash:         util.U64String(tick.Hash).String(),
 		Account:      ctx.Indexer.LookupAddress(ctx, ownr.Account),
 		Balance:      ownr.Balance,
@@ -158,11 +163,12 @@ type TicketUpdate struct {
 	Ticketer mavryk.Address `json:"ticketer"`
 	Type     micheline.Prim `json:"type"`
 	Content  micheline.Prim `json:"content"`
+	Value    any            `json:"value,omitempty"`
 	Account  mavryk.Address `json:"account"`
 	Amount   mavryk.Z       `json:"amount"`
 }
 
-func NewTicketUpdate(ctx *server.Context, u *model.TicketUpdate, _ server.Options) *TicketUpdate {
+func NewTicketUpdate(ctx *server.Context, u *model.TicketUpdate, args server.Options) *TicketUpdate {
 	typ, err := ctx.Indexer.LookupTicket(ctx, u.TicketId)
 	if err != nil {
 		return nil
@@ -171,17 +177,43 @@ func NewTicketUpdate(ctx *server.Context, u *model.TicketUpdate, _ server.Option
 		Ticketer: typ.Address,
 		Type:     typ.Type,
 		Content:  typ.Content,
+		Value:    decodeTicketContent(typ.Type, typ.Content, args.WithUnpack()),
 		Account:  ctx.Indexer.LookupAddress(ctx, u.AccountId),
 		Amount:   u.Amount,
 	}
 }
 
+// decodeTicketContent renders ticket contents as natural Micheline JSON
+// using the ticket's content type, the same way bigmap values are rendered.
+// Annotated record types decode into JSON objects.
+func decodeTicketContent(typ, content micheline.Prim, unpack bool) any {
+	if !typ.IsValid() || !content.IsValid() {
+		return nil
+	}
+	if unpack && content.IsPackedAny() {
+		if up, err := content.UnpackAll(); err == nil {
+			content = up
+		}
+	}
+	t := micheline.NewType(typ)
+	t.Prim.Anno = nil
+	m, err := micheline.NewValuePtr(t, content).Map()
+	if err != nil {
+		log.Debugf("ticket content %s: %v", content.Dump(), err)
+		return nil
+	}
+	return m
+}
+
 type TicketListRequest struct {
 	ListRequest
 	Account mavryk.Address  `schema:"account"`
 	Type    mavryk.HexBytes `schema:"type"`
 	Content mavryk.HexBytes `schema:"content"`
 	Hash    util.U64String  `schema:"hash"`
+	OrderBy string          `schema:"order_by"` // balance lists only, balance or empty for id order
+	Holder  string          `schema:"holder"`   // balance lists only, contract or rollup
+	Held    bool            `schema:"held"`     // list tickets held instead of issued
 }
 
 func (r TicketListRequest) Load(ctx *server.Context, issuer mavryk.Address) (*model.Ticket, error) {
@@ -210,11 +242,43 @@ func (r TicketListRequest) Load(ctx *server.Context, issuer mavryk.Address) (*mo
 	return tick, nil
 }
 
+// HeldTicketList lists tickets locked in a contract or rollup.
+type HeldTicketList struct {
+	Holder  mavryk.Address `json:"holder"`
+	Kind    string         `json:"kind"`         // contract or rollup
+	Type    string         `json:"address_type"` // e.g. smart_rollup
+	Tickets []*TicketOwner `json:"tickets"`
+}
+
+// ListTickets lists tickets issued by a contract. With held=true it lists
+// tickets a contract or rollup currently holds, e.g. assets locked in a
+// rollup bridge, sortable by balance with order_by=balance.
 func ListTickets(ctx *server.Context) (any, int) {
 	var args TicketListRequest
 	ctx.ParseRequestArgs(&args)
 	issuer := loadAccount(ctx)
 
+	if args.Held {
+		if !issuer.Address.IsContract() && !issuer.Address.IsRollup() {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, "address is not a contract or rollup", nil))
+		}
+		checkTicketBalanceArgs(args.OrderBy, "")
+		held := AccountTicketListRequest{
+			ListRequest: args.ListRequest,
+			OrderBy:     args.OrderBy,
+		}
+		resp := &HeldTicketList{
+			Holder:  issuer.Address,
+			Kind:    TicketHolderContract,
+			Type:    issuer.Address.Type().String(),
+			Tickets: listAccountTicketBalances(ctx, issuer, held, true),
+		}
+		if issuer.Address.IsRollup() {
+			resp.Kind = TicketHolderRollup
+		}
+		return resp, http.StatusOK
+	}
+
 	q := pack.NewQuery("api.list_tickets").
 		WithOrder(args.Order).
 		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
@@ -254,14 +318,13 @@ func ListTicketBalances(ctx *server.Context) (any, int) {
 	var args TicketListRequest
 	ctx.ParseRequestArgs(&args)
 	issuer := loadAccount(ctx)
+	checkTicketBalanceArgs(args.OrderBy, args.Holder)
 
 	q := pack.NewQuery("api.list_ticket_balances").
 		WithOrder(args.Order).
-		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
-		WithOffset(int(args.Offset)).
 		AndEqual("ticketer", issuer.RowId)
 
-	if args.Cursor > 0 {
+	if args.Cursor > 0 && args.OrderBy == "" {
 		q = q.And("id", args.Mode(), args.Cursor)
 	}
 
@@ -277,32 +340,7 @@ func ListTicketBalances(ctx *server.Context) (any, int) {
 		}
 	}
 
-	owners, err := ctx.Indexer.Table(model.TicketOwnerTableKey)
-	if err != nil {
-		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no ticket owners table", err))
-	}
-
-	tickets, err := ctx.Indexer.Table(model.TicketTableKey)
-	if err != nil {
-		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no ticket table", err))
-	}
-
-	list, err := model.ListTicketOwners(ctx, owners, q)
-	if err != nil {
-		panic(server.EInternal(server.EC_DATABASE, "cannot list ticket balances", err))
-	}
-
-	resp := make([]*TicketOwner, 0, len(list))
-	for _, v := range list {
-		if tick == nil || tick.Id != v.Ticket {
-			tick, err = model.GetTicketId(ctx, tickets, v.Ticket)
-			if err != nil {
-				continue
-			}
-		}
-		resp = append(resp, NewTicketOwner(ctx, v, tick))
-	}
-	return resp, http.StatusOK
+	return listTicketBalances(ctx, q, args.ListRequest, args.OrderBy, args.Holder, false, tick), http.StatusOK
 }
 
 type TicketEventListRequest struct {
@@ -401,6 +439,7 @@ type AccountTicketListRequest struct {
 	Sender    mavryk.Address        `schema:"sender"`
 	Receiver  mavryk.Address        `schema:"receiver"`
 	Height    int64                 `schema:"height"`
+	OrderBy   string                `schema:"order_by"` // balance lists only, balance or empty for id order
 }
 
 func (r AccountTicketListRequest) Load(ctx *server.Context) (*model.Ticket, error) {
@@ -433,14 +472,18 @@ func ListAccountTicketBalances(ctx *server.Context) (any, int) {
 	var args AccountTicketListRequest
 	ctx.ParseRequestArgs(&args)
 	acc := loadAccount(ctx)
+	checkTicketBalanceArgs(args.OrderBy, "")
+	return listAccountTicketBalances(ctx, acc, args, false), http.StatusOK
+}
 
+// listAccountTicketBalances lists ticket balances of an account, with
+// nonZero only tickets the account currently holds.
+func listAccountTicketBalances(ctx *server.Context, acc *model.Account, args AccountTicketListRequest, nonZero bool) []*TicketOwner {
 	q := pack.NewQuery("api.list_account_ticket_balances").
 		WithOrder(args.Order).
-		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
-		WithOffset(int(args.Offset)).
 		AndEqual("account", acc.RowId)
 
-	if args.Cursor > 0 {
+	if args.Cursor > 0 && args.OrderBy == "" {
 		q = q.And("id", args.Mode(), args.Cursor)
 	}
 
@@ -452,6 +495,34 @@ func ListAccountTicketBalances(ctx *server.Context) (any, int) {
 		}
 	}
 
+	return listTicketBalances(ctx, q, args.ListRequest, args.OrderBy, "", nonZero, tick)
+}
+
+const (
+	TicketOrderByBalance = "balance"
+	TicketHolderContract = "contract"
+	TicketHolderRollup   = "rollup"
+)
+
+// checkTicketBalanceArgs validates balance list sorting and holder filters.
+func checkTicketBalanceArgs(orderBy, holder string) {
+	switch orderBy {
+	case "", TicketOrderByBalance:
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid order_by, use balance", nil))
+	}
+	switch holder {
+	case "", TicketHolderContract, TicketHolderRollup:
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid holder, use contract or rollup", nil))
+	}
+}
+
+// listTicketBalances runs a ticket balance query and returns a page of
+// results. Balances and holder address types are not indexed, so when
+// sorting by balance, filtering by holder kind or skipping zero balances
+// all matching rows are loaded and paged here.
+func listTicketBalances(ctx *server.Context, q pack.Query, args ListRequest, orderBy, holder string, nonZero bool, tick *model.Ticket) []*TicketOwner {
 	owners, err := ctx.Indexer.Table(model.TicketOwnerTableKey)
 	if err != nil {
 		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no ticket owners table", err))
@@ -462,11 +533,44 @@ func ListAccountTicketBalances(ctx *server.Context) (any, int) {
 		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no ticket table", err))
 	}
 
+	limit := int(ctx.Cfg.ClampExplore(args.Limit))
+	byBalance := orderBy == TicketOrderByBalance
+	inMemory := byBalance || holder != "" || nonZero
+	if !inMemory {
+		q = q.WithLimit(limit).WithOffset(int(args.Offset))
+	}
 	list, err := model.ListTicketOwners(ctx, owners, q)
 	if err != nil {
 		panic(server.EInternal(server.EC_DATABASE, "cannot list ticket balances", err))
 	}
 
+	if inMemory {
+		list = slices.DeleteFunc(list, func(v *model.TicketOwner) bool {
+			if nonZero && v.Balance.IsZero() {
+				return true
+			}
+			switch holder {
+			case TicketHolderContract:
+				return !ctx.Indexer.LookupAddress(ctx, v.Account).IsContract()
+			case TicketHolderRollup:
+				return !ctx.Indexer.LookupAddress(ctx, v.Account).IsRollup()
+			}
+			return false
+		})
+		if byBalance {
+			slices.SortStableFunc(list, func(a, b *model.TicketOwner) int {
+				if args.Order == pack.OrderDesc {
+					a, b = b, a
+				}
+				return a.Balance.Cmp(b.Balance)
+			})
+		}
+		list = list[min(int(args.Offset), len(list)):]
+		if limit > 0 {
+			list = list[:min(limit, len(list))]
+		}
+	}
+
 	resp := make([]*TicketOwner, 0, len(list))
 	for _, v := range list {
 		if tick == nil || tick.Id != v.Ticket {
@@ -477,7 +581,7 @@ func ListAccountTicketBalances(ctx *server.Context) (any, int) {
 		}
 		resp = append(resp, NewTicketOwner(ctx, v, tick))
 	}
-	return resp, http.StatusOK
+	return resp
 }
 
 func ListAccountTicketEvents(ctx *server.Context) (any, int) {
@@ -0,0 +1,113 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+func TestListTicketBalances(t *testing.T) {
+	m := newTestIndexer(t, index.NewAccountIndex(), index.NewTicketIndex())
+	ctx := context.Background()
+
+	// ticketer (1) issues two tickets held by a user (2), a contract (3)
+	// with zero balance and a rollup (4)
+	accounts, _ := m.Table(model.AccountTableKey)
+	owners, _ := m.Table(model.TicketOwnerTableKey)
+	tickets, _ := m.Table(model.TicketTableKey)
+	addrs := []mavryk.Address{
+		mavryk.NewAddress(mavryk.AddressTypeContract, []byte{1, 19: 0}),
+		mavryk.NewAddress(mavryk.AddressTypeEd25519, []byte{2, 19: 0}),
+		mavryk.NewAddress(mavryk.AddressTypeContract, []byte{3, 19: 0}),
+		mavryk.NewAddress(mavryk.AddressTypeSmartRollup, []byte{4, 19: 0}),
+	}
+	for _, a := range addrs {
+		if err := accounts.Insert(ctx, &model.Account{Address: a, Type: a.Type()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for h := uint64(1); h <= 2; h++ {
+		if err := tickets.Insert(ctx, &model.Ticket{
+			Address:  addrs[0],
+			Ticketer: 1,
+			Type:     micheline.NewCode(micheline.T_NAT),
+			Content:  micheline.NewNat(big.NewInt(int64(h))),
+			Hash:     h,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, o := range []*model.TicketOwner{
+		{Ticket: 1, Ticketer: 1, Account: 2, Balance: mavryk.NewZ(5)},
+		{Ticket: 1, Ticketer: 1, Account: 3, Balance: mavryk.NewZ(0)},
+		{Ticket: 1, Ticketer: 1, Account: 4, Balance: mavryk.NewZ(30)},
+		{Ticket: 2, Ticketer: 1, Account: 4, Balance: mavryk.NewZ(10)},
+	} {
+		if err := owners.Insert(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(fn server.ApiCall, addr mavryk.Address, query string) []*TicketOwner {
+		req := httptest.NewRequest(http.MethodGet, "/explorer/contract/x?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"ident": addr.String()})
+		resp, _ := fn(&server.Context{
+			Context: ctx,
+			Request: req,
+			Cfg:     &server.Config{},
+			Indexer: m,
+		})
+		if held, ok := resp.(*HeldTicketList); ok {
+			return held.Tickets
+		}
+		return resp.([]*TicketOwner)
+	}
+	balances := func(l []*TicketOwner) (res []int64) {
+		for _, v := range l {
+			res = append(res, v.Balance.Int64())
+		}
+		return
+	}
+
+	// holders of issued tickets filtered by kind
+	if got := balances(list(ListTicketBalances, addrs[0], "holder=rollup&order_by=balance&order=desc")); !slices.Equal(got, []int64{30, 10}) {
+		t.Errorf("rollup holders: got %v", got)
+	}
+	if got := balances(list(ListTicketBalances, addrs[0], "holder=contract")); !slices.Equal(got, []int64{0}) {
+		t.Errorf("contract holders: got %v", got)
+	}
+
+	// tickets held by a rollup sorted and paged by balance
+	if got := balances(list(ListTickets, addrs[3], "held=true&order_by=balance")); !slices.Equal(got, []int64{10, 30}) {
+		t.Errorf("held by rollup: got %v", got)
+	}
+	if got := balances(list(ListTickets, addrs[3], "held=true&order_by=balance&order=desc&offset=1&limit=1")); !slices.Equal(got, []int64{10}) {
+		t.Errorf("held by rollup paged: got %v", got)
+	}
+
+	// held lists name the holder kind and address type
+	req := httptest.NewRequest(http.MethodGet, "/explorer/contract/x?held=true", nil)
+	req = mux.SetURLVars(req, map[string]string{"ident": addrs[3].String()})
+	resp, _ := ListTickets(&server.Context{Context: ctx, Request: req, Cfg: &server.Config{}, Indexer: m})
+	if held := resp.(*HeldTicketList); held.Holder != addrs[3] || held.Kind != TicketHolderRollup || held.Type != "smart_rollup" {
+		t.Errorf("held by rollup: got holder %s kind %s type %s", held.Holder, held.Kind, held.Type)
+	}
+
+	// zero balances are not held
+	if got := list(ListTickets, addrs[2], "held=true"); len(got) != 0 {
+		t.Errorf("held by contract: got %v", balances(got))
+	}
+}
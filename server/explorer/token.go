@@ -5,13 +5,19 @@ package explorer
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 
 	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/vec"
 	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
 	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/server"
 )
@@ -36,11 +42,22 @@ type Token struct {
 	TotalBurn    mavryk.Z        `json:"total_burn"`
 	NumTransfers int             `json:"num_transfers"`
 	NumHolders   int             `json:"num_holders"`
+	Paused       *bool           `json:"paused,omitempty"` // only on single token reads
 	Metadata     json.RawMessage `json:"metadata,omitempty"`
+
+	// off-chain metadata resolution
+	MetadataStatus  model.TokenMetaStatus `json:"metadata_status,omitempty"`
+	MetadataUpdated *time.Time            `json:"metadata_updated,omitempty"`
+
+	// optional, decimals=1
+	Decimals     *int   `json:"decimals,omitempty"`
+	SupplyFmt    string `json:"total_supply_fmt,omitempty"`
+	TotalMintFmt string `json:"total_mint_fmt,omitempty"`
+	TotalBurnFmt string `json:"total_burn_fmt,omitempty"`
 }
 
 func NewToken(ctx *server.Context, tokn *model.Token) *Token {
-	return &Token{
+	t := &Token{
 		Contract:     ctx.Indexer.LookupAddress(ctx, tokn.Ledger),
 		TokenId:      tokn.TokenId,
 		Creator:      ctx.Indexer.LookupAddress(ctx, tokn.Creator),
@@ -54,8 +71,15 @@ func NewToken(ctx *server.Context, tokn *model.Token) *Token {
 		TotalBurn:    tokn.TotalBurn,
 		NumTransfers: tokn.NumTransfers,
 		NumHolders:   tokn.NumHolders,
-		Metadata:     lookupTokenIdMetadata(ctx, tokn.Id),
 	}
+	if md := lookupTokenMeta(ctx, tokn.Id); md != nil {
+		t.Metadata = md.Data
+		t.MetadataStatus = md.Status
+		if !md.Updated.IsZero() {
+			t.MetadataUpdated = &md.Updated
+		}
+	}
+	return t
 }
 
 func (t Token) LastModified() time.Time {
@@ -81,9 +105,15 @@ func (t Token) RegisterDirectRoutes(r *mux.Router) error {
 }
 
 func (t Token) RegisterRoutes(r *mux.Router) error {
+	r.HandleFunc("/events", server.C(Columnar(ListMultiTokenEvents))).Methods("GET")
+	r.HandleFunc("/sync", server.C(SyncTokens)).Methods("GET")
 	r.HandleFunc("/{ident}", server.C(ReadToken)).Methods("GET").Name("token")
-	r.HandleFunc("/{ident}/events", server.C(ListTokenEvents)).Methods("GET")
+	r.HandleFunc("/{ident}/events", server.C(Columnar(ListTokenEvents))).Methods("GET")
 	r.HandleFunc("/{ident}/balances", server.C(ListTokenBalances)).Methods("GET")
+	r.HandleFunc("/{ident}/operators", server.C(ListTokenOperators)).Methods("GET")
+	r.HandleFunc("/{ident}/pauses", server.C(ListTokenPauses)).Methods("GET")
+	r.HandleFunc("/{ident}/metadata/history", server.C(ListTokenMetaHistory)).Methods("GET")
+	r.HandleFunc("/{ident}/verify", server.H(VerifyTokenBalances)).Methods("POST")
 	return nil
 }
 
@@ -104,6 +134,13 @@ type TokenOwner struct {
 	VolMint      mavryk.Z        `json:"vol_mint"`
 	VolBurn      mavryk.Z        `json:"vol_burn"`
 	Metadata     json.RawMessage `json:"metadata,omitempty"`
+
+	// optional, decimals=1
+	Decimals   *int   `json:"decimals,omitempty"`
+	VolSentFmt string `json:"vol_sent_fmt,omitempty"`
+	VolRecvFmt string `json:"vol_recv_fmt,omitempty"`
+	VolMintFmt string `json:"vol_mint_fmt,omitempty"`
+	VolBurnFmt string `json:"vol_burn_fmt,omitempty"`
 }
 
 func NewTokenOwner(ctx *server.Context, ownr *model.TokenOwner, tokn *model.Token) *TokenOwner {
@@ -136,16 +173,26 @@ func (t TokenOwner) Expires() time.Time {
 }
 
 type TokenEvent struct {
-	Contract mavryk.Address       `json:"contract"`
-	TokenId  mavryk.Z             `json:"token_id"`
-	Type     model.TokenEventType `json:"type"`
-	Signer   mavryk.Address       `json:"signer"`
-	Sender   mavryk.Address       `json:"sender"`
-	Receiver mavryk.Address       `json:"receiver"`
-	Amount   mavryk.Z             `json:"amount"`
-	Height   int64                `json:"height"`
-	Time     time.Time            `json:"time"`
-	OpId     model.OpID           `json:"op_id"`
+	Contract mavryk.Address        `json:"contract"`
+	TokenId  mavryk.Z              `json:"token_id"`
+	Type     model.TokenEventType  `json:"type"`
+	Signer   mavryk.Address        `json:"signer"`
+	Sender   mavryk.Address        `json:"sender"`
+	Receiver mavryk.Address        `json:"receiver"`
+	Amount   mavryk.Z              `json:"amount"`
+	Height   int64                 `json:"height"`
+	Time     time.Time             `json:"time"`
+	OpId     model.OpID            `json:"op_id"`
+	IsSelf   bool                  `json:"is_self,omitempty"`
+	Origin   model.TokenMintOrigin `json:"mint_origin,omitempty"`
+
+	// optional, with_op=1
+	OpHash     *mavryk.OpHash `json:"op_hash,omitempty"`
+	Entrypoint string         `json:"entrypoint,omitempty"`
+
+	// optional, decimals=1
+	Decimals  *int   `json:"decimals,omitempty"`
+	AmountFmt string `json:"amount_fmt,omitempty"`
 }
 
 func NewTokenEvent(ctx *server.Context, evnt *model.TokenEvent, tokn *model.Token) *TokenEvent {
@@ -160,9 +207,66 @@ func NewTokenEvent(ctx *server.Context, evnt *model.TokenEvent, tokn *model.Toke
 		Height:   evnt.Height,
 		Time:     evnt.Time,
 		OpId:     evnt.OpId,
+		IsSelf:   evnt.IsSelfTransfer(),
+		Origin:   evnt.Origin,
 	}
 }
 
+// addTokenEventOps resolves operation hash and called entrypoint for a page
+// of token events using a single batch lookup.
+func addTokenEventOps(ctx *server.Context, events []*TokenEvent) {
+	if len(events) == 0 {
+		return
+	}
+	ids := make([]uint64, 0, len(events))
+	for _, v := range events {
+		ids = append(ids, v.OpId.U64())
+	}
+	ops, err := ctx.Indexer.LookupOpIds(ctx, vec.UniqueUint64Slice(ids))
+	if err != nil {
+		log.Errorf("%s: missing ops in %#v", ctx.RequestString(), ids)
+		return
+	}
+	opMap := make(map[model.OpID]*model.Op, len(ops))
+	for _, op := range ops {
+		opMap[op.RowId] = op
+	}
+	entrypoints := make(map[model.OpID]string, len(ops))
+	for _, v := range events {
+		op, ok := opMap[v.OpId]
+		if !ok {
+			continue
+		}
+		v.OpHash = &op.Hash
+		ep, ok := entrypoints[op.RowId]
+		if !ok {
+			ep = tokenEventEntrypoint(ctx, op)
+			entrypoints[op.RowId] = ep
+		}
+		v.Entrypoint = ep
+	}
+}
+
+func tokenEventEntrypoint(ctx *server.Context, op *model.Op) string {
+	if len(op.Parameters) == 0 || !op.IsContract {
+		return ""
+	}
+	p := &micheline.Parameters{}
+	if err := p.UnmarshalBinary(op.Parameters); err != nil {
+		return ""
+	}
+	pTyp, _, _, err := ctx.Indexer.LookupContractType(ctx.Context, op.ReceiverId)
+	if err != nil || !pTyp.IsValid() {
+		return p.Entrypoint
+	}
+	// use real name when called via default or a branch
+	ep, _, err := p.MapEntrypoint(pTyp)
+	if err != nil {
+		return p.Entrypoint
+	}
+	return ep.Name
+}
+
 func (t TokenEvent) LastModified() time.Time {
 	return t.Time
 }
@@ -180,6 +284,10 @@ func loadToken(ctx *server.Context) *model.Token {
 	if err != nil {
 		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid token address", err))
 	}
+	return lookupToken(ctx, addr)
+}
+
+func lookupToken(ctx *server.Context, addr mavryk.Token) *model.Token {
 	acc, err := ctx.Indexer.LookupAccountId(ctx, addr.Contract())
 	if err != nil {
 		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "no such contract", err))
@@ -223,12 +331,19 @@ func loadTokenId(ctx *server.Context, id model.TokenID) *model.Token {
 }
 
 func ReadToken(ctx *server.Context) (interface{}, int) {
+	args := &TokenFormat{}
+	ctx.ParseRequestArgs(args)
 	tokn := loadToken(ctx)
-	return NewToken(ctx, tokn), http.StatusOK
+	t := NewToken(ctx, tokn)
+	t.setDecimals(ctx, *args, tokn.Id)
+	paused := model.IsTokenPaused(loadTokenPauses(ctx, tokn.Ledger), tokn.TokenId)
+	t.Paused = &paused
+	return t, http.StatusOK
 }
 
 type TokenListRequest struct {
 	ListRequest
+	TokenFormat
 	Contract mavryk.Address  `schema:"contract"`
 	Type     model.TokenType `schema:"type"`
 }
@@ -266,13 +381,16 @@ func ListTokens(ctx *server.Context) (interface{}, int) {
 
 	resp := make([]*Token, 0, len(list))
 	for _, v := range list {
-		resp = append(resp, NewToken(ctx, v))
+		t := NewToken(ctx, v)
+		t.setDecimals(ctx, args.TokenFormat, v.Id)
+		resp = append(resp, t)
 	}
 	return resp, http.StatusOK
 }
 
 type TokenBalanceListRequest struct {
 	ListRequest
+	TokenFormat
 	Contract mavryk.Address `schema:"contract"`
 	WithZero bool           `schema:"zero"`
 }
@@ -306,17 +424,194 @@ func ListTokenBalances(ctx *server.Context) (interface{}, int) {
 
 	resp := make([]*TokenOwner, 0, len(list))
 	for _, v := range list {
-		resp = append(resp, NewTokenOwner(ctx, v, tokn))
+		t := NewTokenOwner(ctx, v, tokn)
+		t.setDecimals(ctx, args.TokenFormat, tokn.Id)
+		resp = append(resp, t)
 	}
 	return resp, http.StatusOK
 }
 
 type TokenEventListRequest struct {
 	ListRequest
-	Contract mavryk.Address       `schema:"contract"`
-	Type     model.TokenEventType `schema:"type"`
+	TokenFormat
+	Contract mavryk.Address        `schema:"contract"`
+	Type     model.TokenEventType  `schema:"type"`
+	Origin   model.TokenMintOrigin `schema:"mint_origin"`
+	Sender   mavryk.Address        `schema:"sender"`   // transfers and burns only
+	Receiver mavryk.Address        `schema:"receiver"` // transfers and mints only
+	SortBy   string                `schema:"sort"`     // id (default), amount
+	WithOp   bool                  `schema:"with_op"`  // resolve op hash and entrypoint
+}
+
+// parseAmountRange converts an `amount` filter condition into an inclusive
+// range of raw token amounts (without decimals), e.g. amount.gte=1000000.
+func parseAmountRange(ctx *server.Context) (r model.TokenAmountRange) {
+	mode, val, ok := server.Query(ctx, "amount")
+	if !ok {
+		return
+	}
+	parse := func(s string) *mavryk.Z {
+		z, err := mavryk.ParseZ(s)
+		if err != nil || z.IsNeg() {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid amount value %q", s), err))
+		}
+		return &z
+	}
+	switch mode {
+	case pack.FilterModeEqual:
+		r.Min = parse(val)
+		r.Max = r.Min
+	case pack.FilterModeGt:
+		z := parse(val).Add64(1)
+		r.Min = &z
+	case pack.FilterModeGte:
+		r.Min = parse(val)
+	case pack.FilterModeLt:
+		z := parse(val).Sub64(1)
+		if z.IsNeg() {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, "empty amount range", nil))
+		}
+		r.Max = &z
+	case pack.FilterModeLte:
+		r.Max = parse(val)
+	case pack.FilterModeRange:
+		from, to, ok := strings.Cut(val, ",")
+		if !ok {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid amount range value %q", val), nil))
+		}
+		r.Min, r.Max = parse(from), parse(to)
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid amount mode %q", mode), nil))
+	}
+	return
+}
+
+// findTokenEvents runs a token event query and returns one page of results.
+// Without amount filter or sort the page is selected by the database.
+// Otherwise events are streamed, their exact amounts are checked (amounts
+// beyond int64 are only bounded by the amount64 column) and the page is
+// selected in memory. Sorting by amount keeps at most offset+limit events
+// in memory, but scans all events matching the query.
+func findTokenEvents(ctx *server.Context, q pack.Query, args *TokenEventListRequest, limit uint) []*model.TokenEvent {
+	var byAmount bool
+	switch args.SortBy {
+	case "", "id":
+	case "amount":
+		byAmount = true
+	default:
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid sort field "+args.SortBy, nil))
+	}
+	amount := parseAmountRange(ctx)
+
+	list := make([]*model.TokenEvent, 0)
+	if !amount.IsValid() && !byAmount {
+		err := q.WithLimit(int(limit)).WithOffset(int(args.Offset)).Execute(ctx, &list)
+		if err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot list token events", err))
+		}
+		return list
+	}
+
+	offset, size := int(args.Offset), int(ctx.Cfg.ClampExplore(limit))
+	less := func(i, j int) bool {
+		if c := list[i].Amount.Cmp(list[j].Amount); c != 0 {
+			return c < 0
+		}
+		return list[i].Id < list[j].Id
+	}
+	trim := func() {
+		if args.Order == pack.OrderDesc {
+			sort.Slice(list, func(i, j int) bool { return less(j, i) })
+		} else {
+			sort.Slice(list, less)
+		}
+		list = list[:min(offset+size, len(list))]
+	}
+	err := amount.Query(q).Stream(ctx, func(r pack.Row) error {
+		ev := &model.TokenEvent{}
+		if err := r.Decode(ev); err != nil {
+			return err
+		}
+		if !amount.Match(ev) {
+			return nil
+		}
+		if !byAmount {
+			if offset > 0 {
+				offset--
+				return nil
+			}
+			list = append(list, ev)
+			if len(list) == size {
+				return io.EOF
+			}
+			return nil
+		}
+		list = append(list, ev)
+		if len(list) >= 2*(offset+size) {
+			trim()
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list token events", err))
+	}
+	if byAmount {
+		trim()
+		list = list[min(offset, len(list)):]
+	}
+	return list
+}
+
+// checkTokenParties rejects counterparty filters that cannot match the
+// event type. Mints have no sender and burns have no receiver.
+func checkTokenParties(typ model.TokenEventType, sender, receiver bool) error {
+	switch {
+	case sender && typ == model.TokenEventTypeMint:
+		return fmt.Errorf("mint events have no sender")
+	case receiver && typ == model.TokenEventTypeBurn:
+		return fmt.Errorf("burn events have no receiver")
+	}
+	return nil
+}
+
+// addTokenPartyFilter restricts a token event query to events sent or
+// received by the accounts in `sender` and `receiver`. A sender filter
+// excludes mints and a receiver filter excludes burns.
+func addTokenPartyFilter(ctx *server.Context, q pack.Query, args *TokenEventListRequest) pack.Query {
+	if err := checkTokenParties(args.Type, args.Sender.IsValid(), args.Receiver.IsValid()); err != nil {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, err.Error(), nil))
+	}
+	var sender, receiver model.AccountID
+	if args.Sender.IsValid() {
+		id, err := ctx.Indexer.LookupAccountId(ctx, args.Sender)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such sender", err))
+		}
+		sender = id
+	}
+	if args.Receiver.IsValid() {
+		id, err := ctx.Indexer.LookupAccountId(ctx, args.Receiver)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such receiver", err))
+		}
+		receiver = id
+	}
+	return tokenPartyQuery(q, sender, receiver)
+}
+
+// tokenPartyQuery adds conditions for non-zero sender and receiver ids.
+func tokenPartyQuery(q pack.Query, sender, receiver model.AccountID) pack.Query {
+	if sender > 0 {
+		q = q.AndEqual("sender", sender)
+	}
+	if receiver > 0 {
+		q = q.AndEqual("receiver", receiver)
+	}
+	return q
 }
 
+// ListTokenEvents lists events of a single token. Use `sender` and
+// `receiver` to list transfers involving a specific account.
 func ListTokenEvents(ctx *server.Context) (interface{}, int) {
 	args := &TokenEventListRequest{}
 	ctx.ParseRequestArgs(args)
@@ -327,12 +622,9 @@ func ListTokenEvents(ctx *server.Context) (interface{}, int) {
 		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token event table", err))
 	}
 
-	list := make([]*model.TokenEvent, 0)
 	q := pack.NewQuery("token.list.events").
 		WithTable(table).
 		AndEqual("token", tokn.Id).
-		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
-		WithOffset(int(args.Offset)).
 		AndGt("row_id", args.Cursor)
 
 	if args.Contract.IsValid() {
@@ -345,15 +637,20 @@ func ListTokenEvents(ctx *server.Context) (interface{}, int) {
 	if args.Type.IsValid() {
 		q = q.AndEqual("type", args.Type)
 	}
-
-	err = q.Execute(ctx, &list)
-	if err != nil {
-		panic(server.EInternal(server.EC_DATABASE, "cannot list token events", err))
+	if args.Origin.IsValid() {
+		q = q.AndEqual("mint_origin", args.Origin)
 	}
+	q = addTokenPartyFilter(ctx, q, args)
 
+	list := findTokenEvents(ctx, q, args, ctx.Cfg.ClampExplore(args.Limit))
 	resp := make([]*TokenEvent, 0, len(list))
 	for _, v := range list {
-		resp = append(resp, NewTokenEvent(ctx, v, tokn))
+		t := NewTokenEvent(ctx, v, tokn)
+		t.setDecimals(ctx, args.TokenFormat, tokn.Id)
+		resp = append(resp, t)
+	}
+	if args.WithOp {
+		addTokenEventOps(ctx, resp)
 	}
 	return resp, http.StatusOK
 }
@@ -384,7 +681,9 @@ func ListAccountTokenBalances(ctx *server.Context) (interface{}, int) {
 	resp := make([]*TokenOwner, 0, len(list))
 	for _, v := range list {
 		tokn := loadTokenId(ctx, v.Token)
-		resp = append(resp, NewTokenOwner(ctx, v, tokn))
+		t := NewTokenOwner(ctx, v, tokn)
+		t.setDecimals(ctx, args.TokenFormat, tokn.Id)
+		resp = append(resp, t)
 	}
 	return resp, http.StatusOK
 }
@@ -399,7 +698,6 @@ func ListAccountTokenEvents(ctx *server.Context) (interface{}, int) {
 		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token event table", err))
 	}
 
-	list := make([]*model.TokenEvent, 0)
 	q := pack.NewQuery("token.list").
 		WithTable(table).
 		OrCondition(
@@ -407,8 +705,6 @@ func ListAccountTokenEvents(ctx *server.Context) (interface{}, int) {
 			pack.Equal("sender", acc.RowId),
 			pack.Equal("receiver", acc.RowId),
 		).
-		WithLimit(int(args.Limit)).
-		WithOffset(int(args.Offset)).
 		AndGt("row_id", args.Cursor)
 
 	if args.Contract.IsValid() {
@@ -421,6 +717,90 @@ func ListAccountTokenEvents(ctx *server.Context) (interface{}, int) {
 	if args.Type.IsValid() {
 		q = q.AndEqual("type", args.Type)
 	}
+	if args.Origin.IsValid() {
+		q = q.AndEqual("mint_origin", args.Origin)
+	}
+	q = addTokenPartyFilter(ctx, q, args)
+
+	list := findTokenEvents(ctx, q, args, args.Limit)
+	resp := make([]*TokenEvent, 0, len(list))
+	for _, v := range list {
+		tokn := loadTokenId(ctx, v.Token)
+		t := NewTokenEvent(ctx, v, tokn)
+		t.setDecimals(ctx, args.TokenFormat, tokn.Id)
+		resp = append(resp, t)
+	}
+	if args.WithOp {
+		addTokenEventOps(ctx, resp)
+	}
+	return resp, http.StatusOK
+}
+
+// max number of ledger contracts per multi-contract event request
+const maxTokenEventContracts = 32
+
+type MultiTokenEventListRequest struct {
+	ListRequest
+	TokenFormat
+	Contracts string               `schema:"contracts"` // comma separated ledger addresses
+	Type      model.TokenEventType `schema:"type"`
+	Since     int64                `schema:"since"`   // only events after this height
+	WithOp    bool                 `schema:"with_op"` // resolve op hash and entrypoint
+}
+
+// ListMultiTokenEvents returns a merged, time-ordered stream of token events
+// across multiple ledger contracts. Use `since` (height) or `cursor` (row id)
+// for incremental polling.
+func ListMultiTokenEvents(ctx *server.Context) (interface{}, int) {
+	args := &MultiTokenEventListRequest{}
+	ctx.ParseRequestArgs(args)
+
+	addrs := strings.Split(args.Contracts, ",")
+	if args.Contracts == "" {
+		panic(server.EBadRequest(server.EC_PARAM_REQUIRED, "missing contracts", nil))
+	}
+	if len(addrs) > maxTokenEventContracts {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("too many contracts, max %d", maxTokenEventContracts), nil))
+	}
+	conds := make([]pack.UnboundCondition, 0, len(addrs))
+	for _, v := range addrs {
+		addr, err := mavryk.ParseAddress(v)
+		if err != nil || !addr.IsContract() {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid contract address %q", v), err))
+		}
+		id, err := ctx.Indexer.LookupAccountId(ctx, addr)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no such contract %s", addr), err))
+		}
+		conds = append(conds, pack.Equal("ledger", id))
+	}
+
+	table, err := ctx.Indexer.Table(model.TokenEventTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token event table", err))
+	}
+
+	list := make([]*model.TokenEvent, 0)
+	q := pack.NewQuery("token.list.multi").
+		WithTable(table).
+		OrCondition(conds...).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset))
+
+	if args.Cursor > 0 {
+		if args.Order == pack.OrderDesc {
+			q = q.AndLt("row_id", args.Cursor)
+		} else {
+			q = q.AndGt("row_id", args.Cursor)
+		}
+	}
+	if args.Since > 0 {
+		q = q.AndGt("height", args.Since)
+	}
+	if args.Type.IsValid() {
+		q = q.AndEqual("type", args.Type)
+	}
 
 	err = q.Execute(ctx, &list)
 	if err != nil {
@@ -428,9 +808,19 @@ func ListAccountTokenEvents(ctx *server.Context) (interface{}, int) {
 	}
 
 	resp := make([]*TokenEvent, 0, len(list))
+	tokens := make(map[model.TokenID]*model.Token)
 	for _, v := range list {
-		tokn := loadTokenId(ctx, v.Token)
-		resp = append(resp, NewTokenEvent(ctx, v, tokn))
+		tokn, ok := tokens[v.Token]
+		if !ok {
+			tokn = loadTokenId(ctx, v.Token)
+			tokens[v.Token] = tokn
+		}
+		t := NewTokenEvent(ctx, v, tokn)
+		t.setDecimals(ctx, args.TokenFormat, tokn.Id)
+		resp = append(resp, t)
+	}
+	if args.WithOp {
+		addTokenEventOps(ctx, resp)
 	}
 	return resp, http.StatusOK
 }
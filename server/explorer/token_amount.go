@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// TokenFormat enables rendering of formatted token amounts using decimals
+// from token metadata in addition to raw amounts.
+type TokenFormat struct {
+	Decimals bool `schema:"decimals"`
+}
+
+// tokenDecimals returns decimals of a token when decimal rendering is
+// requested and the token has valid metadata decimals.
+func tokenDecimals(ctx *server.Context, f TokenFormat, id model.TokenID) (int, bool) {
+	if !f.Decimals {
+		return 0, false
+	}
+	return model.ParseTokenDecimals(lookupTokenIdMetadata(ctx, id))
+}
+
+// formatTokenAmount renders z as decimal string without float conversion.
+func formatTokenAmount(z mavryk.Z, decimals int) string {
+	return z.Decimals(decimals)
+}
+
+func (t *Token) setDecimals(ctx *server.Context, f TokenFormat, id model.TokenID) {
+	d, ok := tokenDecimals(ctx, f, id)
+	if !ok {
+		return
+	}
+	t.Decimals = &d
+	t.SupplyFmt = formatTokenAmount(t.Supply, d)
+	t.TotalMintFmt = formatTokenAmount(t.TotalMint, d)
+	t.TotalBurnFmt = formatTokenAmount(t.TotalBurn, d)
+}
+
+func (t *TokenOwner) setDecimals(ctx *server.Context, f TokenFormat, id model.TokenID) {
+	d, ok := tokenDecimals(ctx, f, id)
+	if !ok {
+		return
+	}
+	t.Decimals = &d
+	t.VolSentFmt = formatTokenAmount(t.VolSent, d)
+	t.VolRecvFmt = formatTokenAmount(t.VolRecv, d)
+	t.VolMintFmt = formatTokenAmount(t.VolMint, d)
+	t.VolBurnFmt = formatTokenAmount(t.VolBurn, d)
+}
+
+func (t *TokenEvent) setDecimals(ctx *server.Context, f TokenFormat, id model.TokenID) {
+	d, ok := tokenDecimals(ctx, f, id)
+	if !ok {
+		return
+	}
+	t.Decimals = &d
+	t.AmountFmt = formatTokenAmount(t.Amount, d)
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"testing"
+
+	"github.com/mavryk-network/mvgo/mavryk"
+)
+
+func TestFormatTokenAmount(t *testing.T) {
+	// larger than float64 mantissa to catch precision loss
+	z, err := mavryk.ParseZ("123456789012345678901234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := formatTokenAmount(z, 18), "123456789012.345678901234567890"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := formatTokenAmount(mavryk.NewZ(5), 3), "0.005"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := formatTokenAmount(mavryk.NewZ(42), 0), "42"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
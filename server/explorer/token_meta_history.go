@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type TokenMetaHistoryRequest struct {
+	ListRequest      // offset, limit, cursor, order
+	Value       bool `schema:"with_value"` // load new token_info values
+}
+
+type TokenMetaChange struct {
+	Id       uint64          `json:"id"`
+	Height   int64           `json:"height"`
+	Time     time.Time       `json:"time"`
+	OpHash   mavryk.OpHash   `json:"op"`
+	BigmapId int64           `json:"bigmap_id"`
+	OldHash  string          `json:"old_hash,omitempty"` // empty on first write
+	NewHash  string          `json:"new_hash,omitempty"` // empty on removal
+	IsRemove bool            `json:"is_remove,omitempty"`
+	Value    *micheline.Prim `json:"value,omitempty"`
+}
+
+// ListTokenMetaHistory lists changes of a token's token_metadata bigmap
+// entry. Values are identified by expression hash, with_value=1 loads the
+// new value of each change from bigmap updates.
+func ListTokenMetaHistory(ctx *server.Context) (interface{}, int) {
+	args := &TokenMetaHistoryRequest{}
+	ctx.ParseRequestArgs(args)
+	tokn := loadToken(ctx)
+
+	table, err := ctx.Indexer.Table(model.TokenMetaChangeTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token metadata history table", err))
+	}
+	q := pack.NewQuery("token.list.meta_changes").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		AndEqual("token", tokn.Id)
+	if args.Cursor > 0 {
+		q = q.And("row_id", args.Mode(), args.Cursor)
+	} else {
+		q = q.WithOffset(int(args.Offset))
+	}
+	list := make([]*model.TokenMetaChange, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list token metadata changes", err))
+	}
+
+	resp := make([]*TokenMetaChange, 0, len(list))
+	for _, v := range list {
+		c := &TokenMetaChange{
+			Id:       uint64(v.Id),
+			Height:   v.Height,
+			Time:     v.Time,
+			OpHash:   ctx.Indexer.LookupOpHash(ctx, v.OpId),
+			BigmapId: v.BigmapId,
+			IsRemove: v.IsRemove(),
+		}
+		if v.OldHash.IsValid() {
+			c.OldHash = v.OldHash.String()
+		}
+		if v.NewHash.IsValid() {
+			c.NewHash = v.NewHash.String()
+			if args.Value {
+				c.Value = loadTokenMetaValue(ctx, v)
+			}
+		}
+		resp = append(resp, c)
+	}
+	return resp, http.StatusOK
+}
+
+// loadTokenMetaValue returns the value written by a metadata change or nil
+// when bigmap updates are not indexed.
+func loadTokenMetaValue(ctx *server.Context, c *model.TokenMetaChange) *micheline.Prim {
+	upds, err := ctx.Indexer.ListBigmapUpdates(ctx, etl.ListRequest{
+		BigmapId: c.BigmapId,
+		OpId:     c.OpId,
+	})
+	if err != nil {
+		return nil
+	}
+	for _, upd := range upds {
+		if upd.Action != micheline.DiffActionUpdate {
+			continue
+		}
+		var val micheline.Prim
+		if err := val.UnmarshalBinary(upd.Value); err != nil {
+			continue
+		}
+		if model.TokenInfoHash(val).Equal(c.NewHash) {
+			return &val
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type TokenOperator struct {
+	Contract  mavryk.Address `json:"contract"`
+	TokenId   *mavryk.Z      `json:"token_id,omitempty"` // empty for all-token operators
+	IsAll     bool           `json:"all_tokens"`
+	Owner     mavryk.Address `json:"owner"`
+	Operator  mavryk.Address `json:"operator"`
+	IsGranted bool           `json:"is_granted"`
+	Height    int64          `json:"height"`
+	Time      time.Time      `json:"time"`
+	OpId      model.OpID     `json:"op_id"`
+}
+
+func NewTokenOperator(ctx *server.Context, op *model.TokenOperator) *TokenOperator {
+	t := &TokenOperator{
+		Contract:  ctx.Indexer.LookupAddress(ctx, op.Ledger),
+		IsAll:     op.IsAll,
+		Owner:     ctx.Indexer.LookupAddress(ctx, op.Owner),
+		Operator:  ctx.Indexer.LookupAddress(ctx, op.Operator),
+		IsGranted: op.IsGranted,
+		Height:    op.Height,
+		Time:      op.Time,
+		OpId:      op.OpId,
+	}
+	if !op.IsAll {
+		id := op.TokenId
+		t.TokenId = &id
+	}
+	return t
+}
+
+type TokenOperatorListRequest struct {
+	ListRequest
+	Contract   mavryk.Address `schema:"contract"`
+	History    bool           `schema:"history"`     // list all updates incl. revocations
+	AsOperator bool           `schema:"as_operator"` // account is operator, not owner
+}
+
+// ListTokenOperators lists operators currently permitted to transfer a token,
+// including all-token operators of the token's ledger.
+func ListTokenOperators(ctx *server.Context) (interface{}, int) {
+	args := &TokenOperatorListRequest{}
+	ctx.ParseRequestArgs(args)
+	tokn := loadToken(ctx)
+
+	q := pack.NewQuery("token.list.operators").
+		AndEqual("ledger", tokn.Ledger).
+		OrCondition(
+			pack.Equal("token_id", tokn.TokenId),
+			pack.Equal("is_all", true),
+		)
+	return listTokenOperators(ctx, q, args), http.StatusOK
+}
+
+// ListAccountTokenOperators lists operator permissions granted by an account
+// or, with `as_operator`, permissions granted to an account.
+func ListAccountTokenOperators(ctx *server.Context) (interface{}, int) {
+	args := &TokenOperatorListRequest{}
+	ctx.ParseRequestArgs(args)
+	acc := loadAccount(ctx)
+
+	q := pack.NewQuery("account.list.operators")
+	if args.AsOperator {
+		q = q.AndEqual("operator", acc.RowId)
+	} else {
+		q = q.AndEqual("owner", acc.RowId)
+	}
+	if args.Contract.IsValid() {
+		id, err := ctx.Indexer.LookupAccountId(ctx, args.Contract)
+		if err != nil {
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such contract", err))
+		}
+		q = q.AndEqual("ledger", id)
+	}
+	return listTokenOperators(ctx, q, args), http.StatusOK
+}
+
+// listTokenOperators executes an operator update query. Without history
+// all matching updates are reduced to currently granted permissions before
+// pagination is applied.
+func listTokenOperators(ctx *server.Context, q pack.Query, args *TokenOperatorListRequest) []*TokenOperator {
+	table, err := ctx.Indexer.Table(model.TokenOperatorTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token operator table", err))
+	}
+	limit := int(ctx.Cfg.ClampExplore(args.Limit))
+	q = q.WithTable(table)
+	if args.History {
+		q = q.WithLimit(limit).
+			WithOffset(int(args.Offset)).
+			AndGt("row_id", args.Cursor)
+	}
+
+	list := make([]*model.TokenOperator, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list token operators", err))
+	}
+
+	if !args.History {
+		list = model.CurrentTokenOperators(list)
+		n := 0
+		for _, v := range list {
+			if v.Id > model.TokenOperatorID(args.Cursor) {
+				list[n] = v
+				n++
+			}
+		}
+		list = list[:n]
+		list = list[min(int(args.Offset), len(list)):]
+		list = list[:min(limit, len(list))]
+	}
+
+	resp := make([]*TokenOperator, 0, len(list))
+	for _, v := range list {
+		resp = append(resp, NewTokenOperator(ctx, v))
+	}
+	return resp
+}
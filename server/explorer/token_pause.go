@@ -0,0 +1,105 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type TokenPause struct {
+	Contract mavryk.Address `json:"contract"`
+	TokenId  *mavryk.Z      `json:"token_id,omitempty"` // empty for ledger-wide pauses
+	IsAll    bool           `json:"all_tokens"`
+	IsPaused bool           `json:"paused"`
+	Height   int64          `json:"height"`
+	Time     time.Time      `json:"time"`
+	OpId     model.OpID     `json:"op_id"`
+}
+
+func NewTokenPause(ctx *server.Context, p *model.TokenPause) *TokenPause {
+	t := &TokenPause{
+		Contract: ctx.Indexer.LookupAddress(ctx, p.Ledger),
+		IsAll:    p.IsAll,
+		IsPaused: p.IsPaused,
+		Height:   p.Height,
+		Time:     p.Time,
+		OpId:     p.OpId,
+	}
+	if !p.IsAll {
+		id := p.TokenId
+		t.TokenId = &id
+	}
+	return t
+}
+
+// loadTokenPauses returns all pause updates of a ledger in row id order.
+func loadTokenPauses(ctx *server.Context, ledger model.AccountID) []*model.TokenPause {
+	table, err := ctx.Indexer.Table(model.TokenPauseTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token pause table", err))
+	}
+	list := make([]*model.TokenPause, 0)
+	err = pack.NewQuery("token.list.pauses").
+		WithTable(table).
+		AndEqual("ledger", ledger).
+		Execute(ctx, &list)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list token pauses", err))
+	}
+	return list
+}
+
+// isLedgerPaused returns the ledger-wide pause state, i.e. the most recent
+// update that applies to all tokens.
+func isLedgerPaused(list []*model.TokenPause) bool {
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].IsAll {
+			return list[i].IsPaused
+		}
+	}
+	return false
+}
+
+// ListTokenPauses lists pause state changes that apply to a token.
+func ListTokenPauses(ctx *server.Context) (interface{}, int) {
+	args := &ListRequest{}
+	ctx.ParseRequestArgs(args)
+	tokn := loadToken(ctx)
+	list := make([]*model.TokenPause, 0)
+	for _, v := range loadTokenPauses(ctx, tokn.Ledger) {
+		if v.Applies(tokn.TokenId) {
+			list = append(list, v)
+		}
+	}
+	return listTokenPauses(ctx, list, args), http.StatusOK
+}
+
+// ListContractTokenPauses lists all pause state changes of a token ledger.
+func ListContractTokenPauses(ctx *server.Context) (interface{}, int) {
+	args := &ListRequest{}
+	ctx.ParseRequestArgs(args)
+	cc := loadContract(ctx)
+	return listTokenPauses(ctx, loadTokenPauses(ctx, cc.AccountId), args), http.StatusOK
+}
+
+func listTokenPauses(ctx *server.Context, list []*model.TokenPause, args *ListRequest) []*TokenPause {
+	if args.Order == pack.OrderDesc {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+	list = list[min(int(args.Offset), len(list)):]
+	list = list[:min(int(ctx.Cfg.ClampExplore(args.Limit)), len(list))]
+	resp := make([]*TokenPause, 0, len(list))
+	for _, v := range list {
+		resp = append(resp, NewTokenPause(ctx, v))
+	}
+	return resp
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// max reorg depth, when a reorg replaced the block of a client cursor the
+// client rewinds this many blocks below the cursor (or tip)
+const tokenSyncFinality = 2
+
+var errInvalidSyncCursor = errors.New("invalid sync cursor")
+
+type TokenSyncRequest struct {
+	Since string `schema:"since"` // cursor from a previous response, empty to start
+	Limit uint   `schema:"limit"`
+}
+
+// TokenSyncCursor is the position of a client mirror in the token event
+// table, the height and row id of the last applied event and a prefix of
+// the hash of its block to detect reorgs.
+type TokenSyncCursor struct {
+	Height int64
+	RowId  uint64
+	Hash   [4]byte
+}
+
+func NewTokenSyncCursor(height int64, id uint64, hash mavryk.BlockHash) TokenSyncCursor {
+	c := TokenSyncCursor{Height: height, RowId: id}
+	copy(c.Hash[:], hash[:])
+	return c
+}
+
+func (c TokenSyncCursor) IsZero() bool {
+	return c.Height == 0 && c.RowId == 0
+}
+
+// Matches returns true when the cursor was created on the same branch as
+// block hash.
+func (c TokenSyncCursor) Matches(hash mavryk.BlockHash) bool {
+	return bytes.Equal(c.Hash[:], hash[:len(c.Hash)])
+}
+
+func (c TokenSyncCursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	var buf [20]byte
+	binary.BigEndian.PutUint64(buf[0:], uint64(c.Height))
+	binary.BigEndian.PutUint64(buf[8:], c.RowId)
+	copy(buf[16:], c.Hash[:])
+	return base64.RawURLEncoding.EncodeToString(buf[:])
+}
+
+func ParseTokenSyncCursor(s string) (TokenSyncCursor, error) {
+	var c TokenSyncCursor
+	if s == "" {
+		return c, nil
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(buf) != 20 {
+		return c, errInvalidSyncCursor
+	}
+	c.Height = int64(binary.BigEndian.Uint64(buf[0:]))
+	c.RowId = binary.BigEndian.Uint64(buf[8:])
+	copy(c.Hash[:], buf[16:])
+	if c.Height < 0 {
+		return c, errInvalidSyncCursor
+	}
+	return c, nil
+}
+
+type TokenSyncEvent struct {
+	Id       uint64               `json:"id"`
+	Height   int64                `json:"height"`
+	OpId     model.OpID           `json:"op_id"`
+	Type     model.TokenEventType `json:"type"`
+	Token    mavryk.Token         `json:"token"`
+	Sender   *mavryk.Address      `json:"sender,omitempty"`   // empty on mint
+	Receiver *mavryk.Address      `json:"receiver,omitempty"` // empty on burn
+	Amount   mavryk.Z             `json:"amount"`
+}
+
+type TokenSyncBalance struct {
+	Account mavryk.Address `json:"account"`
+	Token   mavryk.Token   `json:"token"`
+	Delta   mavryk.Z       `json:"delta"`
+}
+
+// TokenSyncResponse is a batch of token events with the resulting balance
+// changes per owner. When Rewind is set the client must roll back all
+// state above this height before continuing from Cursor.
+type TokenSyncResponse struct {
+	Rewind   *int64              `json:"rewind,omitempty"`
+	Events   []*TokenSyncEvent   `json:"events"`
+	Balances []*TokenSyncBalance `json:"balances"`
+	Cursor   string              `json:"cursor"`
+	HasMore  bool                `json:"has_more"`
+}
+
+// tokenBalanceDelta is the net balance change of an owner over a batch.
+type tokenBalanceDelta struct {
+	Account model.AccountID
+	Token   model.TokenID
+	Delta   mavryk.Z
+}
+
+// tokenBalanceDeltas sums balance changes per owner and token in order of
+// first appearance. Self-transfers and net zero changes are omitted.
+func tokenBalanceDeltas(events []*model.TokenEvent) []*tokenBalanceDelta {
+	type key struct {
+		acc model.AccountID
+		tok model.TokenID
+	}
+	index := make(map[key]*tokenBalanceDelta)
+	list := make([]*tokenBalanceDelta, 0)
+	add := func(acc model.AccountID, tok model.TokenID, amount mavryk.Z) {
+		k := key{acc, tok}
+		d, ok := index[k]
+		if !ok {
+			d = &tokenBalanceDelta{Account: acc, Token: tok}
+			index[k] = d
+			list = append(list, d)
+		}
+		d.Delta = d.Delta.Add(amount)
+	}
+	for _, ev := range events {
+		if ev.IsSelfTransfer() {
+			continue
+		}
+		if ev.Type != model.TokenEventTypeMint {
+			add(ev.Sender, ev.Token, ev.Amount.Neg())
+		}
+		if ev.Type != model.TokenEventTypeBurn {
+			add(ev.Receiver, ev.Token, ev.Amount)
+		}
+	}
+	res := list[:0]
+	for _, d := range list {
+		if !d.Delta.IsZero() {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// SyncTokens returns token events after a cursor for clients that keep a
+// local mirror of token balances. Each batch contains events in index
+// order and net balance changes of the affected owners. Clients apply
+// either, store the returned cursor and repeat while has_more is set.
+// When the block of a cursor was replaced by a reorg, the response only
+// contains a rewind height and a cursor to continue from there.
+func SyncTokens(ctx *server.Context) (interface{}, int) {
+	args := &TokenSyncRequest{}
+	ctx.ParseRequestArgs(args)
+	cursor, err := ParseTokenSyncCursor(args.Since)
+	if err != nil {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid since cursor", err))
+	}
+	table, err := ctx.Indexer.Table(model.TokenEventTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token event table", err))
+	}
+	tip := ctx.Tip.BestHeight
+	resp := &TokenSyncResponse{
+		Events:   make([]*TokenSyncEvent, 0),
+		Balances: make([]*TokenSyncBalance, 0),
+		Cursor:   cursor.String(),
+	}
+
+	// detect reorgs on the cursor block
+	if !cursor.IsZero() {
+		hash, err := ctx.Indexer.BlockHashByHeight(ctx, cursor.Height)
+		if cursor.Height > tip || err != nil || !cursor.Matches(hash) {
+			rewind := max(0, min(cursor.Height, tip)-tokenSyncFinality)
+			resp.Rewind = &rewind
+			resp.Cursor = tokenSyncCursorAt(ctx, table, rewind).String()
+			resp.HasMore = true
+			return resp, http.StatusOK
+		}
+	}
+
+	// fetch one more event to detect the end
+	limit := int(ctx.Cfg.ClampExplore(args.Limit))
+	events := make([]*model.TokenEvent, 0, limit+1)
+	err = pack.NewQuery("token.sync").
+		WithTable(table).
+		AndGt("row_id", cursor.RowId).
+		AndLte("height", tip).
+		WithLimit(limit+1).
+		Execute(ctx, &events)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list token events", err))
+	}
+	if len(events) > limit {
+		events = events[:limit]
+		resp.HasMore = true
+	}
+	if len(events) == 0 {
+		return resp, http.StatusOK
+	}
+
+	tokens := make(map[model.TokenID]mavryk.Token)
+	lookupToken := func(id model.TokenID) mavryk.Token {
+		t, ok := tokens[id]
+		if !ok {
+			tokn := loadTokenId(ctx, id)
+			t = mavryk.NewToken(ctx.Indexer.LookupAddress(ctx, tokn.Ledger), tokn.TokenId)
+			tokens[id] = t
+		}
+		return t
+	}
+	for _, v := range events {
+		ev := &TokenSyncEvent{
+			Id:     uint64(v.Id),
+			Height: v.Height,
+			OpId:   v.OpId,
+			Type:   v.Type,
+			Token:  lookupToken(v.Token),
+			Amount: v.Amount,
+		}
+		if v.Type != model.TokenEventTypeMint {
+			addr := ctx.Indexer.LookupAddress(ctx, v.Sender)
+			ev.Sender = &addr
+		}
+		if v.Type != model.TokenEventTypeBurn {
+			addr := ctx.Indexer.LookupAddress(ctx, v.Receiver)
+			ev.Receiver = &addr
+		}
+		resp.Events = append(resp.Events, ev)
+	}
+	for _, d := range tokenBalanceDeltas(events) {
+		resp.Balances = append(resp.Balances, &TokenSyncBalance{
+			Account: ctx.Indexer.LookupAddress(ctx, d.Account),
+			Token:   lookupToken(d.Token),
+			Delta:   d.Delta,
+		})
+	}
+
+	last := events[len(events)-1]
+	hash, err := ctx.Indexer.BlockHashByHeight(ctx, last.Height)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read block hash", err))
+	}
+	resp.Cursor = NewTokenSyncCursor(last.Height, uint64(last.Id), hash).String()
+	return resp, http.StatusOK
+}
+
+// tokenSyncCursorAt returns a cursor after the last event at or below
+// height. Row ids grow with height because rows above a reorg point are
+// deleted before new blocks are indexed.
+func tokenSyncCursorAt(ctx *server.Context, table *pack.Table, height int64) TokenSyncCursor {
+	if height == 0 {
+		return TokenSyncCursor{}
+	}
+	hash, err := ctx.Indexer.BlockHashByHeight(ctx, height)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read block hash", err))
+	}
+	last := &model.TokenEvent{}
+	err = pack.NewQuery("token.sync.rewind").
+		WithTable(table).
+		AndLte("height", height).
+		WithDesc().
+		WithLimit(1).
+		Execute(ctx, last)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read token events", err))
+	}
+	return NewTokenSyncCursor(height, uint64(last.Id), hash)
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"blockwatch.cc/packdb/pack"
+	"blockwatch.cc/packdb/store"
+	_ "blockwatch.cc/packdb/store/bolt"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+func TestCheckTokenParties(t *testing.T) {
+	for _, c := range []struct {
+		typ      model.TokenEventType
+		sender   bool
+		receiver bool
+		ok       bool
+	}{
+		{model.TokenEventTypeInvalid, true, true, true},
+		{model.TokenEventTypeTransfer, true, true, true},
+		{model.TokenEventTypeMint, false, true, true},
+		{model.TokenEventTypeMint, true, false, false},
+		{model.TokenEventTypeBurn, true, false, true},
+		{model.TokenEventTypeBurn, false, true, false},
+	} {
+		err := checkTokenParties(c.typ, c.sender, c.receiver)
+		if (err == nil) != c.ok {
+			t.Errorf("%s sender=%t receiver=%t: unexpected result %v", c.typ, c.sender, c.receiver, err)
+		}
+	}
+}
+
+func TestTokenSyncCursor(t *testing.T) {
+	var hash mavryk.BlockHash
+	copy(hash[:], []byte{1, 2, 3, 4, 5})
+	c := NewTokenSyncCursor(1200, 77, hash)
+	p, err := ParseTokenSyncCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != c || !p.Matches(hash) {
+		t.Errorf("roundtrip: got %+v, want %+v", p, c)
+	}
+	hash[2] = 9
+	if p.Matches(hash) {
+		t.Errorf("cursor matches different block hash")
+	}
+	if p, err := ParseTokenSyncCursor(""); err != nil || !p.IsZero() {
+		t.Errorf("empty cursor: got %+v, %v", p, err)
+	}
+	for _, s := range []string{"xyz", c.String()[:10], "!" + c.String()[1:]} {
+		if _, err := ParseTokenSyncCursor(s); err == nil {
+			t.Errorf("cursor %q: expected error", s)
+		}
+	}
+}
+
+func TestTokenBalanceDeltas(t *testing.T) {
+	events := []*model.TokenEvent{
+		{Type: model.TokenEventTypeMint, Receiver: 1, Token: 7, Amount: mavryk.NewZ(100)},
+		{Type: model.TokenEventTypeTransfer, Sender: 1, Receiver: 2, Token: 7, Amount: mavryk.NewZ(30)},
+		{Type: model.TokenEventTypeTransfer, Sender: 2, Receiver: 2, Token: 7, Amount: mavryk.NewZ(30), Excluded: true},
+		{Type: model.TokenEventTypeBurn, Sender: 2, Token: 7, Amount: mavryk.NewZ(10)},
+		{Type: model.TokenEventTypeTransfer, Sender: 3, Receiver: 1, Token: 8, Amount: mavryk.NewZ(5)},
+		{Type: model.TokenEventTypeTransfer, Sender: 1, Receiver: 3, Token: 8, Amount: mavryk.NewZ(5)},
+	}
+	want := []struct {
+		acc   model.AccountID
+		tok   model.TokenID
+		delta int64
+	}{
+		{1, 7, 70},
+		{2, 7, 20},
+	}
+	got := tokenBalanceDeltas(events)
+	if len(got) != len(want) {
+		t.Fatalf("want %d deltas, got %d", len(want), len(got))
+	}
+	for i, w := range want {
+		d := got[i]
+		if d.Account != w.acc || d.Token != w.tok || d.Delta.Int64() != w.delta {
+			t.Errorf("delta %d: got %d/%d %s", i, d.Account, d.Token, d.Delta)
+		}
+	}
+}
+
+func TestTokenPartyQuery(t *testing.T) {
+	dir := t.TempDir()
+	idx := index.NewTokenIndex()
+	if err := idx.Create(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Init(dir, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	var table *pack.Table
+	for _, v := range idx.Tables() {
+		if v.Name() == model.TokenEventTableKey {
+			table = v
+		}
+	}
+
+	// alice (1) mints to bob (2), bob sends to carol (3) and alice, carol burns
+	ctx := context.Background()
+	for _, ev := range []*model.TokenEvent{
+		{Type: model.TokenEventTypeMint, Receiver: 2},
+		{Type: model.TokenEventTypeTransfer, Sender: 2, Receiver: 3},
+		{Type: model.TokenEventTypeTransfer, Sender: 2, Receiver: 1},
+		{Type: model.TokenEventTypeBurn, Sender: 3},
+	} {
+		if err := table.Insert(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		sender, receiver model.AccountID
+		want             []model.TokenEventID
+	}{
+		{0, 0, []model.TokenEventID{1, 2, 3, 4}},
+		{2, 0, []model.TokenEventID{2, 3}},
+		{0, 2, []model.TokenEventID{1}},
+		{2, 3, []model.TokenEventID{2}},
+		{3, 0, []model.TokenEventID{4}},
+		{1, 0, nil},
+	} {
+		list := make([]*model.TokenEvent, 0)
+		q := pack.NewQuery("test").WithTable(table)
+		if err := tokenPartyQuery(q, c.sender, c.receiver).Execute(ctx, &list); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]model.TokenEventID, len(list))
+		for i, v := range list {
+			got[i] = v.Id
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("sender=%d receiver=%d: got events %v, want %v", c.sender, c.receiver, got, c.want)
+		}
+	}
+}
+
+// newTestIndexer returns an indexer with empty tables of indexes.
+func newTestIndexer(t *testing.T, indexes ...model.BlockIndexer) *etl.Indexer {
+	dir := t.TempDir()
+	db, err := store.Create("bolt", filepath.Join(dir, etl.StateDBName), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m := etl.NewIndexer(etl.IndexerConfig{
+		DBPath:  dir,
+		StateDB: db,
+		Indexes: indexes,
+	})
+	if err := m.Init(context.Background(), &model.ChainTip{Symbol: "test"}, etl.MODE_INFO); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestSyncTokensReorg(t *testing.T) {
+	m := newTestIndexer(t, index.NewBlockIndex(), index.NewTokenIndex())
+	ctx := context.Background()
+
+	// blocks 1..10 with one token event each
+	blocks, _ := m.Table(model.BlockTableKey)
+	events, _ := m.Table(model.TokenEventTableKey)
+	hash := func(height int64) (h mavryk.BlockHash) {
+		h[0] = byte(height)
+		return
+	}
+	for h := int64(1); h <= 10; h++ {
+		if err := blocks.Insert(ctx, &model.Block{Height: h, Hash: hash(h)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := events.Insert(ctx, &model.TokenEvent{Height: h, Type: model.TokenEventTypeMint}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync := func(cursor TokenSyncCursor) *TokenSyncResponse {
+		req := httptest.NewRequest(http.MethodGet, "/explorer/tokens/sync?since="+cursor.String(), nil)
+		sctx := &server.Context{
+			Context: ctx,
+			Request: req,
+			Cfg:     &server.Config{},
+			Indexer: m,
+			Tip:     &model.ChainTip{BestHeight: 10},
+		}
+		resp, _ := SyncTokens(sctx)
+		return resp.(*TokenSyncResponse)
+	}
+	rewind := func(resp *TokenSyncResponse) int64 {
+		if resp.Rewind == nil {
+			return -1
+		}
+		return *resp.Rewind
+	}
+
+	// the block of a client cursor at 8 was replaced, block 7 may be too
+	var stale mavryk.BlockHash
+	stale[0] = 0xff
+	resp := sync(NewTokenSyncCursor(8, 8, stale))
+	if got := rewind(resp); got != 6 {
+		t.Fatalf("expected rewind to 6, got %d", got)
+	}
+	if len(resp.Events) > 0 || !resp.HasMore {
+		t.Errorf("expected empty rewind response with more events")
+	}
+	if want := NewTokenSyncCursor(6, 6, hash(6)).String(); resp.Cursor != want {
+		t.Errorf("rewind cursor: got %s, want %s", resp.Cursor, want)
+	}
+
+	// cursors above tip rewind below tip
+	resp = sync(NewTokenSyncCursor(12, 12, hash(12)))
+	if got := rewind(resp); got != 8 {
+		t.Errorf("expected rewind to 8, got %d", got)
+	}
+
+	// cursors on the main chain are not rewound
+	resp = sync(NewTokenSyncCursor(10, 10, hash(10)))
+	if resp.Rewind != nil || len(resp.Events) > 0 || resp.HasMore {
+		t.Errorf("unexpected response at tip: %+v", resp)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const (
+	tokenVerifyBatchSize = 1024
+	tokenVerifyMaxBody   = 64 << 20
+)
+
+type TokenBalanceStatus string
+
+const (
+	TokenBalanceMatch   TokenBalanceStatus = "match"
+	TokenBalanceDiffer  TokenBalanceStatus = "differ"
+	TokenBalanceMissing TokenBalanceStatus = "missing" // account or owner not indexed
+	TokenBalanceInvalid TokenBalanceStatus = "invalid" // malformed csv row
+)
+
+type TokenBalanceMismatch struct {
+	Line     int                `json:"line"`
+	Account  string             `json:"account"`
+	Status   TokenBalanceStatus `json:"status"`
+	Expected *mavryk.Z          `json:"expected,omitempty"`
+	Actual   *mavryk.Z          `json:"actual,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+type TokenBalanceReport struct {
+	Contract   mavryk.Address         `json:"contract"`
+	TokenId    mavryk.Z               `json:"token_id"`
+	NumRows    int                    `json:"n_rows"`
+	NumMatch   int                    `json:"n_match"`
+	NumDiffer  int                    `json:"n_differ"`
+	NumMissing int                    `json:"n_missing"`
+	NumInvalid int                    `json:"n_invalid"`
+	Mismatches []TokenBalanceMismatch `json:"mismatches"`
+	Truncated  bool                   `json:"truncated"` // more mismatches than limit
+}
+
+type tokenVerifyRow struct {
+	line     int
+	addr     mavryk.Address
+	expected mavryk.Z
+}
+
+// VerifyTokenBalances compares a CSV of expected balances (`address,balance`
+// per line, optional header) against indexed token owner balances. The
+// request body is streamed and compared in batches. The response contains
+// summary counts and up to `limit` mismatching rows.
+func VerifyTokenBalances(ctx *server.Context) (interface{}, int) {
+	tokn := loadToken(ctx)
+
+	limit := ctx.Cfg.ClampExplore(0)
+	if s := ctx.Request.URL.Query().Get("limit"); s != "" {
+		l, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid limit", err))
+		}
+		limit = ctx.Cfg.ClampExplore(uint(l))
+	}
+
+	table, err := ctx.Indexer.Table(model.TokenOwnerTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token owner table", err))
+	}
+
+	resp := &TokenBalanceReport{
+		Contract:   ctx.Indexer.LookupAddress(ctx, tokn.Ledger),
+		TokenId:    tokn.TokenId,
+		Mismatches: make([]TokenBalanceMismatch, 0),
+	}
+	report := func(m TokenBalanceMismatch) {
+		switch m.Status {
+		case TokenBalanceMatch:
+			resp.NumMatch++
+			return
+		case TokenBalanceDiffer:
+			resp.NumDiffer++
+		case TokenBalanceMissing:
+			resp.NumMissing++
+		case TokenBalanceInvalid:
+			resp.NumInvalid++
+		}
+		if len(resp.Mismatches) < int(limit) {
+			resp.Mismatches = append(resp.Mismatches, m)
+		} else {
+			resp.Truncated = true
+		}
+	}
+
+	// compare a batch of rows with a single owner table lookup
+	batch := make([]tokenVerifyRow, 0, tokenVerifyBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ids := make([]model.AccountID, 0, len(batch))
+		accs := make([]model.AccountID, len(batch))
+		for i, row := range batch {
+			if id, err := ctx.Indexer.LookupAccountId(ctx, row.addr); err == nil {
+				accs[i] = id
+				ids = append(ids, id)
+			}
+		}
+		balances := make(map[model.AccountID]mavryk.Z, len(ids))
+		if len(ids) > 0 {
+			ownr := &model.TokenOwner{}
+			err := pack.NewQuery("token.verify_owners").
+				WithTable(table).
+				WithFields("account", "balance").
+				AndEqual("token", tokn.Id).
+				AndIn("account", ids).
+				Stream(ctx, func(r pack.Row) error {
+					if err := r.Decode(ownr); err != nil {
+						return err
+					}
+					balances[ownr.Account] = ownr.Balance
+					return nil
+				})
+			if err != nil {
+				panic(server.EInternal(server.EC_DATABASE, "cannot read token balances", err))
+			}
+		}
+		for i, row := range batch {
+			expected := row.expected
+			m := TokenBalanceMismatch{
+				Line:     row.line,
+				Account:  row.addr.String(),
+				Expected: &expected,
+			}
+			if bal, ok := balances[accs[i]]; !ok || accs[i] == 0 {
+				// an unknown owner with zero expected balance is consistent
+				if row.expected.IsZero() {
+					m.Status = TokenBalanceMatch
+				} else {
+					m.Status = TokenBalanceMissing
+				}
+			} else {
+				m.Actual = &bal
+				if bal.Equal(row.expected) {
+					m.Status = TokenBalanceMatch
+				} else {
+					m.Status = TokenBalanceDiffer
+				}
+			}
+			report(m)
+		}
+		batch = batch[:0]
+	}
+
+	r := csv.NewReader(http.MaxBytesReader(nil, ctx.Request.Body, tokenVerifyMaxBody))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	r.ReuseRecord = true
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				panic(server.EBadRequest(server.EC_PARAM_INVALID, "cannot read csv", err))
+			}
+			resp.NumRows++
+			report(TokenBalanceMismatch{
+				Line:   perr.Line,
+				Status: TokenBalanceInvalid,
+				Error:  perr.Err.Error(),
+			})
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		if len(rec) < 2 {
+			resp.NumRows++
+			report(TokenBalanceMismatch{
+				Line:   line,
+				Status: TokenBalanceInvalid,
+				Error:  fmt.Sprintf("expected 2 columns, got %d", len(rec)),
+			})
+			continue
+		}
+		addr, err := mavryk.ParseAddress(strings.TrimSpace(rec[0]))
+		if err != nil {
+			// skip header
+			if resp.NumRows == 0 {
+				continue
+			}
+			resp.NumRows++
+			report(TokenBalanceMismatch{
+				Line:    line,
+				Account: rec[0],
+				Status:  TokenBalanceInvalid,
+				Error:   err.Error(),
+			})
+			continue
+		}
+		resp.NumRows++
+		bal, err := mavryk.ParseZ(strings.TrimSpace(rec[1]))
+		if err != nil {
+			report(TokenBalanceMismatch{
+				Line:    line,
+				Account: addr.String(),
+				Status:  TokenBalanceInvalid,
+				Error:   fmt.Sprintf("invalid balance %q: %v", rec[1], err),
+			})
+			continue
+		}
+		batch = append(batch, tokenVerifyRow{line: line, addr: addr, expected: bal})
+		if len(batch) == tokenVerifyBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	return resp, http.StatusOK
+}
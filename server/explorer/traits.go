@@ -0,0 +1,284 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/tidwall/gjson"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const (
+	traitCacheSize = 256
+	traitCacheTTL  = 10 * time.Minute // picks up late metadata resolution
+)
+
+var traitCache *lru.Cache[model.AccountID, *TokenTraits]
+
+func init() {
+	traitCache, _ = lru.New[model.AccountID, *TokenTraits](traitCacheSize)
+}
+
+func purgeTraitStore() {
+	traitCache.Purge()
+}
+
+type TraitValue struct {
+	Value     string  `json:"value"`
+	Count     int     `json:"count"`
+	Frequency float64 `json:"frequency"` // share of tokens with metadata
+}
+
+type TraitDistribution struct {
+	Name   string       `json:"name"`
+	Count  int          `json:"count"`
+	Values []TraitValue `json:"values"`
+}
+
+// TokenTraits is the trait frequency distribution across all tokens
+// of a collection, the basis for rarity scoring.
+type TokenTraits struct {
+	Contract     mavryk.Address      `json:"contract"`
+	NumTokens    int                 `json:"n_tokens"`
+	NumWithMeta  int                 `json:"n_with_metadata"`
+	NumWithTrait int                 `json:"n_with_traits"`
+	NumInvalid   int                 `json:"n_invalid"` // metadata with unknown attribute schema
+	Traits       []TraitDistribution `json:"traits"`
+	IsEstimate   bool                `json:"is_estimate,omitempty"` // counts are extrapolated from a sample
+	SampleSize   int                 `json:"sample_size,omitempty"`
+
+	// cache fingerprint
+	maxTokenId model.TokenID
+	modified   time.Time
+	expires    time.Time
+}
+
+func (t TokenTraits) LastModified() time.Time { return t.modified }
+func (t TokenTraits) Expires() time.Time      { return t.expires }
+
+var _ server.Resource = (*TokenTraits)(nil)
+
+// TraitsRequest selects approximate statistics computed from a random
+// sample of at most Sample token metadata records. Omit for exact counts.
+type TraitsRequest struct {
+	Sample int `schema:"sample"`
+}
+
+// ReadContractTraits aggregates trait values from token metadata of all
+// tokens in a ledger contract. Results are cached and rebuilt when new
+// tokens are minted or the cache entry expires. Sampled results are
+// never cached.
+func ReadContractTraits(ctx *server.Context) (interface{}, int) {
+	var args TraitsRequest
+	ctx.ParseRequestArgs(&args)
+	if args.Sample < 0 {
+		panic(server.EBadRequest(server.EC_PARAM_INVALID, "invalid sample size", nil))
+	}
+	cc := loadContract(ctx)
+
+	// list token ids, also used to detect new mints
+	table, err := ctx.Indexer.Table(model.TokenTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "cannot access token table", err))
+	}
+	ids := make([]model.TokenID, 0)
+	var maxId model.TokenID
+	tokn := &model.Token{}
+	err = pack.NewQuery("token.list_ids").
+		WithTable(table).
+		WithFields("row_id").
+		AndEqual("ledger", cc.AccountId).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(tokn); err != nil {
+				return err
+			}
+			ids = append(ids, tokn.Id)
+			maxId = max(maxId, tokn.Id)
+			return nil
+		})
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list tokens", err))
+	}
+
+	if t, ok := traitCache.Get(cc.AccountId); ok && args.Sample == 0 {
+		if t.NumTokens == len(ids) && t.maxTokenId == maxId && ctx.Now.Before(t.expires) {
+			return t, http.StatusOK
+		}
+	}
+
+	t := &TokenTraits{
+		Contract:   ctx.Indexer.LookupAddress(ctx, cc.AccountId),
+		NumTokens:  len(ids),
+		Traits:     make([]TraitDistribution, 0),
+		maxTokenId: maxId,
+		modified:   ctx.Now,
+		expires:    ctx.Now.Add(traitCacheTTL),
+	}
+	if len(ids) > 0 {
+		if err := t.build(ctx, ids, args.Sample); err != nil {
+			panic(server.EInternal(server.EC_DATABASE, "cannot read token metadata", err))
+		}
+	}
+	if args.Sample == 0 {
+		traitCache.Add(cc.AccountId, t)
+	}
+	return t, http.StatusOK
+}
+
+// build counts trait values across token metadata. With sample > 0 only a
+// uniform random sample of metadata records is parsed (reservoir sampling)
+// and counts are extrapolated to all tokens with metadata.
+func (t *TokenTraits) build(ctx *server.Context, ids []model.TokenID, sample int) error {
+	table, err := ctx.Indexer.Table(model.TokenMetaTableKey)
+	if err != nil {
+		return err
+	}
+
+	// name -> value -> count
+	counts := make(map[string]map[string]int)
+	add := func(name, value string) {
+		if name == "" {
+			return
+		}
+		m, ok := counts[name]
+		if !ok {
+			m = make(map[string]int)
+			counts[name] = m
+		}
+		m[value]++
+	}
+
+	// newest metadata first, skip outdated versions
+	seen := make(map[model.TokenID]struct{}, len(ids))
+	res := newReservoir[[]byte](sample, ctx.Now.UnixNano())
+	md := &model.TokenMeta{}
+	err = pack.NewQuery("token.list_metadata").
+		WithTable(table).
+		WithDesc().
+		AndIn("token", ids).
+		Stream(ctx, func(r pack.Row) error {
+			if err := r.Decode(md); err != nil {
+				return err
+			}
+			if _, ok := seen[md.Token]; ok {
+				return nil
+			}
+			seen[md.Token] = struct{}{}
+			t.NumWithMeta++
+			if sample == 0 {
+				t.parse(md.Data, add)
+			} else if i := res.Slot(); i >= 0 {
+				res.items[i] = bytes.Clone(md.Data)
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if sample > 0 {
+		for _, buf := range res.items {
+			t.parse(buf, add)
+		}
+		if t.NumWithMeta > len(res.items) {
+			t.IsEstimate = true
+			t.SampleSize = len(res.items)
+			scale := func(n int) int {
+				return int(float64(n) * float64(t.NumWithMeta) / float64(t.SampleSize))
+			}
+			for _, values := range counts {
+				for v, n := range values {
+					values[v] = scale(n)
+				}
+			}
+			t.NumWithTrait = scale(t.NumWithTrait)
+			t.NumInvalid = scale(t.NumInvalid)
+		}
+	}
+
+	for name, values := range counts {
+		dist := TraitDistribution{
+			Name:   name,
+			Values: make([]TraitValue, 0, len(values)),
+		}
+		for v, n := range values {
+			dist.Count += n
+			dist.Values = append(dist.Values, TraitValue{
+				Value:     v,
+				Count:     n,
+				Frequency: float64(n) / float64(t.NumWithMeta),
+			})
+		}
+		sort.Slice(dist.Values, func(i, j int) bool {
+			if dist.Values[i].Count == dist.Values[j].Count {
+				return dist.Values[i].Value < dist.Values[j].Value
+			}
+			return dist.Values[i].Count > dist.Values[j].Count
+		})
+		t.Traits = append(t.Traits, dist)
+	}
+	sort.Slice(t.Traits, func(i, j int) bool {
+		return t.Traits[i].Name < t.Traits[j].Name
+	})
+	return nil
+}
+
+// parse extracts trait name/value pairs from the attributes list in token
+// metadata.
+func (t *TokenTraits) parse(buf []byte, add func(name, value string)) {
+	// support TZIP-21 (name/value), common NFT (trait_type/value)
+	// list styles and plain key/value maps
+	attrs := gjson.GetBytes(buf, "attributes")
+	switch {
+	case !attrs.Exists():
+		return
+	case attrs.IsArray():
+		var n int
+		attrs.ForEach(func(_, v gjson.Result) bool {
+			if !v.IsObject() {
+				return true
+			}
+			name := v.Get("name")
+			if !name.Exists() {
+				name = v.Get("trait_type")
+			}
+			if !name.Exists() {
+				name = v.Get("key")
+			}
+			val := v.Get("value")
+			if !name.Exists() || !val.Exists() {
+				return true
+			}
+			add(name.String(), val.String())
+			n++
+			return true
+		})
+		if n > 0 {
+			t.NumWithTrait++
+		} else if len(attrs.Array()) > 0 {
+			t.NumInvalid++
+		}
+	case attrs.IsObject():
+		var n int
+		attrs.ForEach(func(k, v gjson.Result) bool {
+			add(k.String(), v.String())
+			n++
+			return true
+		})
+		if n > 0 {
+			t.NumWithTrait++
+		}
+	default:
+		t.NumInvalid++
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type UnstakeRequest struct {
+	Height           int64   `json:"height"`
+	Cycle            int64   `json:"cycle"`
+	FinalizableCycle int64   `json:"finalizable_cycle"`
+	Amount           float64 `json:"amount"`
+	Remaining        float64 `json:"remaining"`
+	IsFinalizable    bool    `json:"is_finalizable"`
+}
+
+func NewUnstakeRequest(ctx *server.Context, r *model.UnstakeRequest) *UnstakeRequest {
+	p := ctx.Params
+	return &UnstakeRequest{
+		Height:           r.Height,
+		Cycle:            r.Cycle,
+		FinalizableCycle: r.FinalizableCycle,
+		Amount:           p.ConvertValue(r.Amount),
+		Remaining:        p.ConvertValue(r.Remaining),
+		IsFinalizable:    r.IsFinalizable(p.HeightToCycle(ctx.Tip.BestHeight)),
+	}
+}
+
+// ListAccountUnstakeRequests returns the pending unstake request queue of an
+// account, oldest request first.
+func ListAccountUnstakeRequests(ctx *server.Context) (interface{}, int) {
+	acc := loadAccount(ctx)
+	reqs, err := ctx.Indexer.ListUnstakeRequests(ctx, acc, ctx.Params)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list unstake requests", err))
+	}
+	resp := make([]*UnstakeRequest, len(reqs))
+	for i, v := range reqs {
+		resp[i] = NewUnstakeRequest(ctx, v)
+	}
+	return resp, http.StatusOK
+}
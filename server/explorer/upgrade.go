@@ -0,0 +1,61 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+	"time"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+type ContractUpgrade struct {
+	Id             uint64         `json:"id"`
+	Implementation mavryk.Address `json:"implementation"`
+	Previous       mavryk.Address `json:"previous"`
+	Height         int64          `json:"height"`
+	Time           time.Time      `json:"time"`
+	OpHash         mavryk.OpHash  `json:"op_hash"`
+}
+
+// ListContractUpgrades lists implementation changes of a proxy contract.
+// Only contracts matching a configured upgrade pattern are indexed.
+func ListContractUpgrades(ctx *server.Context) (interface{}, int) {
+	args := &ListRequest{}
+	ctx.ParseRequestArgs(args)
+	cc := loadContract(ctx)
+
+	table, err := ctx.Indexer.Table(model.ContractUpgradeTableKey)
+	if err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "upgrades not indexed", err))
+	}
+	q := pack.NewQuery("api.list_contract_upgrades").
+		WithTable(table).
+		WithOrder(args.Order).
+		WithLimit(int(ctx.Cfg.ClampExplore(args.Limit))).
+		WithOffset(int(args.Offset)).
+		AndEqual("contract", cc.AccountId)
+	if args.Cursor > 0 {
+		q = q.And("row_id", args.Mode(), args.Cursor)
+	}
+	list := make([]*model.ContractUpgrade, 0)
+	if err := q.Execute(ctx, &list); err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot list contract upgrades", err))
+	}
+	resp := make([]*ContractUpgrade, len(list))
+	for i, v := range list {
+		resp[i] = &ContractUpgrade{
+			Id:             v.ID(),
+			Implementation: v.Implementation,
+			Previous:       v.Previous,
+			Height:         v.Height,
+			Time:           v.Time,
+			OpHash:         ctx.Indexer.LookupOpHash(ctx, v.OpId),
+		}
+	}
+	return resp, http.StatusOK
+}
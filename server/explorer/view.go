@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package explorer
+
+import (
+	"net/http"
+
+	"github.com/mavryk-network/mvgo/micheline"
+	"github.com/mavryk-network/mvindex/etl/model"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+// ViewBigmaps lists the storage bigmaps an on-chain view reads. Dynamic
+// views read bigmaps which are only known at runtime, e.g. passed as
+// parameter, in addition to the listed bigmaps.
+type ViewBigmaps struct {
+	View    string          `json:"view"`
+	Bigmaps []ViewBigmapRef `json:"bigmaps"`
+	Dynamic bool            `json:"dynamic"`
+}
+
+type ViewBigmapRef struct {
+	BigmapId int64  `json:"bigmap_id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"` // storage pair tree path, 0 = left, 1 = right
+}
+
+// ListContractViewBigmaps lists bigmap read dependencies for each view
+// of a contract. Bigmaps are resolved from the current storage.
+func ListContractViewBigmaps(ctx *server.Context) (interface{}, int) {
+	cc := loadContract(ctx)
+	script, err := cc.LoadScript()
+	if err != nil {
+		panic(server.EInternal(server.EC_SERVER, "script unmarshal failed", err))
+	}
+	if script == nil {
+		return nil, http.StatusNoContent
+	}
+	var storage micheline.Prim
+	if err := storage.UnmarshalBinary(cc.Storage); err != nil {
+		panic(server.EInternal(server.EC_SERVER, "storage unmarshal failed", err))
+	}
+	allocs, err := ctx.Indexer.ListContractBigmaps(ctx.Context, cc.AccountId, ctx.Tip.BestHeight)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read contract bigmaps", err))
+	}
+	names := make(map[int64]string)
+	for n, id := range cc.NamedBigmaps(allocs) {
+		names[id] = n
+	}
+
+	deps := model.AnalyzeViewBigmaps(script)
+	resp := make([]ViewBigmaps, 0, len(deps))
+	for _, v := range deps {
+		view := ViewBigmaps{
+			View:    v.View,
+			Bigmaps: make([]ViewBigmapRef, 0, len(v.Paths)),
+			Dynamic: v.Dynamic,
+		}
+		for _, path := range v.Paths {
+			id, ok := model.BigmapAtPath(script.StorageType().Prim, storage, path)
+			if !ok {
+				view.Dynamic = true
+				continue
+			}
+			view.Bigmaps = append(view.Bigmaps, ViewBigmapRef{
+				BigmapId: id,
+				Name:     names[id],
+				Path:     path,
+			})
+		}
+		resp = append(resp, view)
+	}
+	return resp, http.StatusOK
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2018 - 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerMaxResponseSize = "X-Max-Response-Size"
+	headerRetryAfter      = "Retry-After"
+
+	// seconds clients should wait when all expensive query slots are busy
+	heavyRetryAfter = 5
+)
+
+// Limiter is a counting semaphore which bounds the number of concurrently
+// running calls. A nil Limiter is unlimited.
+type Limiter struct {
+	sem chan struct{}
+}
+
+// NewLimiter returns a limiter allowing n concurrent calls, or nil when
+// n is not positive.
+func NewLimiter(n int) *Limiter {
+	if n <= 0 {
+		return nil
+	}
+	return &Limiter{sem: make(chan struct{}, n)}
+}
+
+// TryAcquire takes a slot without waiting and reports whether it succeeded.
+func (l *Limiter) TryAcquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *Limiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.sem
+}
+
+// limitHeavy runs f in a slot of the server-wide pool for expensive
+// queries and fails with 503 when the pool is saturated.
+func limitHeavy(f ApiCall) ApiCall {
+	return func(ctx *Context) (interface{}, int) {
+		l := ctx.Server.heavy
+		if !l.TryAcquire() {
+			ctx.ResponseWriter.Header().Set(headerRetryAfter, strconv.Itoa(heavyRetryAfter))
+			panic(EServiceUnavailable(EC_ACCESS_RATE_LIMITED, "too many concurrent expensive queries, retry later", nil))
+		}
+		defer l.Release()
+		return f(ctx)
+	}
+}
+
+// limitWriter fails all writes once a streamed response would grow beyond
+// max bytes. Writes are rejected as a whole so rows are never truncated.
+type limitWriter struct {
+	http.ResponseWriter
+	max int64
+	n   int64
+	err error
+}
+
+func (w *limitWriter) Write(buf []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.n+int64(len(buf)) > w.max {
+		w.err = ERequestTooLarge(
+			EC_PARAM_INVALID,
+			fmt.Sprintf("response exceeds size limit of %d bytes, use limit and cursor to paginate", w.max),
+			nil,
+		)
+		return 0, w.err
+	}
+	n, err := w.ResponseWriter.Write(buf)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *limitWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// IsAdmin returns true when the request carries the configured admin key
+// as bearer token. Always false when no admin key is configured.
+func (api *Context) IsAdmin() bool {
+	key := api.Cfg.Http.AdminKey
+	if key == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(api.Request.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1
+}
+
+// maxResponseSize returns the byte limit for streamed responses. Admin
+// requests may override the configured limit, zero disables the limit.
+func (api *Context) maxResponseSize() int64 {
+	if v := api.Request.Header.Get(headerMaxResponseSize); v != "" && api.IsAdmin() {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return api.Cfg.Http.MaxResponseSize
+}
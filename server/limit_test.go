@@ -0,0 +1,71 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestLimitHeavy(t *testing.T) {
+	const limit = 2
+	s := &RestServer{heavy: NewLimiter(limit)}
+
+	var (
+		started = make(chan struct{})
+		block   = make(chan struct{})
+	)
+	call := limitHeavy(func(_ *Context) (interface{}, int) {
+		started <- struct{}{}
+		<-block
+		return nil, http.StatusOK
+	})
+	run := func() (w *httptest.ResponseRecorder, err error) {
+		w = httptest.NewRecorder()
+		defer func() {
+			if e := recover(); e != nil {
+				err = e.(error)
+			}
+		}()
+		call(&Context{Server: s, ResponseWriter: w})
+		return
+	}
+
+	// saturate the pool
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := run(); err != nil {
+				t.Errorf("call within limit failed: %v", err)
+			}
+		}()
+		<-started
+	}
+
+	w, err := run()
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when saturated, got %v", err)
+	}
+	if w.Header().Get(headerRetryAfter) == "" {
+		t.Errorf("missing Retry-After header")
+	}
+
+	// release slots and retry
+	close(block)
+	wg.Wait()
+	go func() { <-started }()
+	if _, err := run(); err != nil {
+		t.Errorf("call after release failed: %v", err)
+	}
+
+	// nil limiter is unlimited
+	s.heavy = NewLimiter(0)
+	if s.heavy != nil || !s.heavy.TryAcquire() {
+		t.Errorf("zero limit must disable the limiter")
+	}
+}
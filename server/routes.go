@@ -27,6 +27,7 @@ type Options interface {
 	WithRights() bool
 	WithMerge() bool
 	WithStorage() bool
+	WithNames() bool
 }
 
 type Resource interface {
@@ -24,6 +24,7 @@ type RestServer struct {
 	srv        *http.Server
 	dispatcher *Dispatcher
 	cfg        *Config
+	heavy      *Limiter // shared pool for expensive queries
 	shutdown   atomic.Value
 	offline    atomic.Value
 }
@@ -62,6 +63,7 @@ func New(cfg *Config) (*RestServer, error) {
 	srv = &RestServer{
 		cfg:    cfg,
 		router: r,
+		heavy:  NewLimiter(cfg.Http.MaxHeavyQueries),
 		srv: &http.Server{
 			Addr:              cfg.Http.Address(),
 			Handler:           h2c.NewHandler(r, h2s),
@@ -131,6 +133,22 @@ func C(f ApiCall) func(http.ResponseWriter, *http.Request) {
 	return wrapper(f)
 }
 
+// W wraps API calls that write to databases. Read replicas reject them.
+func W(f ApiCall) func(http.ResponseWriter, *http.Request) {
+	return wrapper(func(ctx *Context) (interface{}, int) {
+		if ctx.Indexer.IsReadOnly() {
+			panic(EForbidden(EC_ACCESS_READONLY, "read-only replica", nil))
+		}
+		return f(ctx)
+	})
+}
+
+// H wraps expensive API calls like full table scans. They share a pool
+// of at most MaxHeavyQueries concurrent calls.
+func H(f ApiCall) func(http.ResponseWriter, *http.Request) {
+	return wrapper(limitHeavy(f))
+}
+
 func wrapper(f ApiCall) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
@@ -0,0 +1,52 @@
+// Copyright (c) 2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// SocketCall serves an upgraded WebSocket connection. It must return when
+// the connection or the context is closed.
+type SocketCall func(*Context, *websocket.Conn)
+
+// WS wraps WebSocket API calls. Like regular API calls f parses arguments
+// and rejects invalid requests by panicking, then returns the SocketCall
+// that serves the connection after upgrade. Sockets are long-lived, so
+// they bypass the dispatcher and request timeouts and do not hold a
+// database generation of read replicas.
+func WS(f func(*Context) SocketCall) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		api := NewContext(ctx, r, w, nil, srv)
+		call := api.prepareSocket(f)
+		if call == nil {
+			api.sendResponse()
+			return
+		}
+		websocket.Server{
+			Handler: func(conn *websocket.Conn) {
+				// clear request deadlines inherited from the HTTP server
+				_ = conn.SetDeadline(time.Time{})
+				call(api, conn)
+			},
+		}.ServeHTTP(w, r)
+	}
+}
+
+func (api *Context) prepareSocket(f func(*Context) SocketCall) SocketCall {
+	defer api.complete()
+	if api.Indexer != nil {
+		var release func()
+		api.Indexer, release = api.Indexer.Acquire()
+		defer release()
+	}
+	return f(api)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package system
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const (
+	CompactStatusRunning = "running"
+	CompactStatusDone    = "done"
+	CompactStatusFailed  = "failed"
+)
+
+// CompactJob reports the state of a background table compaction.
+type CompactJob struct {
+	Table   string     `json:"table"`
+	Status  string     `json:"status"` // running, done or failed
+	Error   string     `json:"error,omitempty"`
+	Started time.Time  `json:"started"`
+	Ended   *time.Time `json:"ended,omitempty"`
+}
+
+// compactJobs keeps the most recent compaction job per table.
+var compactJobs = struct {
+	sync.Mutex
+	jobs map[string]*CompactJob
+}{
+	jobs: make(map[string]*CompactJob),
+}
+
+// CompactTable starts compacting a table in the background and returns the
+// job state. While a job is running for the same table the running job is
+// returned instead of starting another one.
+func CompactTable(ctx *server.Context) (interface{}, int) {
+	name := mux.Vars(ctx.Request)["key"]
+	if _, err := ctx.Indexer.Table(name); err != nil {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no such table %q", name), err))
+	}
+
+	compactJobs.Lock()
+	defer compactJobs.Unlock()
+	if job, ok := compactJobs.jobs[name]; ok && job.Status == CompactStatusRunning {
+		return *job, http.StatusAccepted
+	}
+	job := &CompactJob{
+		Table:   name,
+		Status:  CompactStatusRunning,
+		Started: time.Now().UTC(),
+	}
+	compactJobs.jobs[name] = job
+
+	// outlive the request, but keep its values
+	go runCompactJob(context.WithoutCancel(ctx.Context), ctx.Indexer, job)
+
+	return *job, http.StatusAccepted
+}
+
+// GetCompactStatus returns the state of the most recent compaction job
+// for a table.
+func GetCompactStatus(ctx *server.Context) (interface{}, int) {
+	name := mux.Vars(ctx.Request)["key"]
+	compactJobs.Lock()
+	defer compactJobs.Unlock()
+	job, ok := compactJobs.jobs[name]
+	if !ok {
+		panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no compaction job for table %q", name), nil))
+	}
+	return *job, http.StatusOK
+}
+
+func runCompactJob(ctx context.Context, idx *etl.Indexer, job *CompactJob) {
+	err := idx.CompactTable(ctx, job.Table)
+	compactJobs.Lock()
+	defer compactJobs.Unlock()
+	now := time.Now().UTC()
+	job.Ended = &now
+	if err != nil {
+		log.Errorf("Compacting %s: %v", job.Table, err)
+		job.Status = CompactStatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = CompactStatusDone
+	}
+}
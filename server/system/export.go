@@ -0,0 +1,162 @@
+// Copyright (c) 2020-2024 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package system
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/gorilla/mux"
+
+	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/server"
+)
+
+const (
+	exportDefaultChunk = 1000
+	exportMaxChunk     = 50000
+	exportDefaultRate  = 10000 // rows per second
+)
+
+type ExportRequest struct {
+	SinceRowId uint64 `schema:"since_row_id"` // resume after this row id
+	Limit      uint64 `schema:"limit"`        // max rows, 0 = all
+	ChunkSize  int    `schema:"chunk_size"`   // rows per chunk and checksum
+	Rate       int    `schema:"rows_per_sec"` // throttle, 0 = default
+}
+
+type ExportHeader struct {
+	Table      string   `json:"table"`
+	Fields     []string `json:"fields"`
+	SinceRowId uint64   `json:"since_row_id"`
+}
+
+// ExportChunk closes each chunk of rows. The checksum is the xxhash64 of all
+// row lines in the chunk including newlines, so a consumer can verify a
+// chunk before committing LastRowId as resume cursor.
+type ExportChunk struct {
+	Chunk      int    `json:"chunk"`
+	Rows       int    `json:"rows"`
+	FirstRowId uint64 `json:"first_row_id"`
+	LastRowId  uint64 `json:"last_row_id"`
+	Checksum   string `json:"checksum"`
+}
+
+// ExportTable streams all rows of an index table as newline delimited JSON
+// starting after since_row_id in row id order. Rows are read in chunks with
+// separate queries so that throttling never holds database transactions open.
+// Output starts with a header line listing the field names, followed by one
+// JSON array per row and a checksum line after each chunk. The last exported
+// row id is returned in the cursor trailer.
+func ExportTable(ctx *server.Context) (interface{}, int) {
+	args := &ExportRequest{}
+	ctx.ParseRequestArgs(args)
+	if args.ChunkSize <= 0 {
+		args.ChunkSize = exportDefaultChunk
+	}
+	args.ChunkSize = min(args.ChunkSize, exportMaxChunk)
+	if args.Rate <= 0 {
+		args.Rate = exportDefaultRate
+	}
+
+	name := mux.Vars(ctx.Request)["table"]
+	table, err := ctx.Indexer.Table(name)
+	if err != nil {
+		switch err {
+		case etl.ErrNoTable:
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, fmt.Sprintf("no such table %q", name), err))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, "cannot access table", err))
+		}
+	}
+	fields := table.Fields()
+	pk := fields.Pk().Name
+
+	ctx.StreamResponseHeaders(http.StatusOK, "application/x-ndjson")
+	enc := json.NewEncoder(ctx.ResponseWriter)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(ExportHeader{
+		Table:      name,
+		Fields:     fields.Aliases(),
+		SinceRowId: args.SinceRowId,
+	})
+
+	var (
+		count  int
+		cursor = args.SinceRowId
+		start  = time.Now()
+		row    = make([]any, len(fields))
+	)
+	for n := 0; err == nil; n++ {
+		limit := args.ChunkSize
+		if args.Limit > 0 {
+			limit = min(limit, int(args.Limit)-count)
+			if limit <= 0 {
+				break
+			}
+		}
+		chunk := ExportChunk{Chunk: n}
+		h := xxhash.New()
+		w := io.MultiWriter(ctx.ResponseWriter, h)
+		renc := json.NewEncoder(w)
+		renc.SetEscapeHTML(false)
+		err = pack.NewQuery("system.export").
+			WithTable(table).
+			WithLimit(limit).
+			AndGt(pk, cursor).
+			Stream(ctx, func(r pack.Row) error {
+				for i, f := range fields {
+					v, err := r.Field(f.Name)
+					if err != nil {
+						return err
+					}
+					row[i] = v
+				}
+				if err := renc.Encode(row); err != nil {
+					return err
+				}
+				id := r.Result().PkColumn()[r.N()]
+				if chunk.Rows == 0 {
+					chunk.FirstRowId = id
+				}
+				chunk.LastRowId = id
+				chunk.Rows++
+				return nil
+			})
+		if err != nil || chunk.Rows == 0 {
+			break
+		}
+		chunk.Checksum = hex.EncodeToString(h.Sum(nil))
+		if err = enc.Encode(chunk); err != nil {
+			break
+		}
+		if w, ok := ctx.ResponseWriter.(http.Flusher); ok {
+			w.Flush()
+		}
+		count += chunk.Rows
+		cursor = chunk.LastRowId
+		if chunk.Rows < limit {
+			break
+		}
+
+		// throttle to configured rows per second
+		if wait := time.Duration(count)*time.Second/time.Duration(args.Rate) - time.Since(start); wait > 0 {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+	}
+
+	ctx.StreamTrailer(strconv.FormatUint(cursor, 10), count, err)
+	return nil, -1
+}
@@ -4,17 +4,22 @@
 package system
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 
 	"blockwatch.cc/packdb/pack"
+	"github.com/mavryk-network/mvgo/mavryk"
 	"github.com/mavryk-network/mvindex/etl"
+	"github.com/mavryk-network/mvindex/etl/index"
+	"github.com/mavryk-network/mvindex/etl/model"
 	"github.com/mavryk-network/mvindex/server"
 	"github.com/mavryk-network/mvindex/server/explorer"
 
@@ -50,6 +55,8 @@ func (t SystemRequest) RESTPath(r *mux.Router) string {
 }
 
 func (t SystemRequest) RegisterDirectRoutes(r *mux.Router) error {
+	r.HandleFunc("/explorer/system/table/{key}/compact", server.W(CompactTable)).Methods("POST")
+	r.HandleFunc("/explorer/system/table/{key}/compact", server.C(GetCompactStatus)).Methods("GET")
 	return nil
 }
 
@@ -59,15 +66,20 @@ func (t SystemRequest) RegisterRoutes(r *mux.Router) error {
 	r.HandleFunc("/tables", server.C(GetTableStats)).Methods("GET")
 	r.HandleFunc("/caches", server.C(GetCacheStats)).Methods("GET")
 	r.HandleFunc("/sysstat", server.C(GetSysStats)).Methods("GET")
+	r.HandleFunc("/bigmap_anomalies", server.H(GetBigmapAnomalies)).Methods("GET")
+	r.HandleFunc("/bigmap/histogram", server.H(GetBigmapHistogram)).Methods("GET")
+	r.HandleFunc("/tables/journal", server.C(GetJournalStats)).Methods("GET")
+	r.HandleFunc("/tables/export/{table}", server.H(ExportTable)).Methods("GET")
 
 	// actions
-	r.HandleFunc("/tables/snapshot", server.C(SnapshotDatabases)).Methods("PUT")
-	r.HandleFunc("/tables/flush", server.C(FlushDatabases)).Methods("PUT")
-	r.HandleFunc("/tables/flush_journal", server.C(FlushJournals)).Methods("PUT")
-	r.HandleFunc("/tables/gc", server.C(GcDatabases)).Methods("PUT")
-	r.HandleFunc("/tables/dump/{table}/{part}", server.C(DumpTable)).Methods("PUT")
-	r.HandleFunc("/caches/purge", server.C(PurgeCaches)).Methods("PUT")
-	r.HandleFunc("/rollback", server.C(RollbackDatabases)).Methods("PUT")
+	r.HandleFunc("/tables/snapshot", server.W(SnapshotDatabases)).Methods("PUT")
+	r.HandleFunc("/tables/flush", server.W(FlushDatabases)).Methods("PUT")
+	r.HandleFunc("/tables/flush_journal", server.W(FlushJournals)).Methods("PUT")
+	r.HandleFunc("/tables/gc", server.W(GcDatabases)).Methods("PUT")
+	r.HandleFunc("/tables/dump/{table}/{part}", server.W(DumpTable)).Methods("PUT")
+	r.HandleFunc("/caches/purge", server.W(PurgeCaches)).Methods("PUT")
+	r.HandleFunc("/rollback", server.W(RollbackDatabases)).Methods("PUT")
+	r.HandleFunc("/bigmap/{id}/repair_counts", server.W(RepairBigmapCounts)).Methods("PUT")
 	r.HandleFunc("/log/{subsystem}/{level}", server.C(UpdateLog)).Methods("PUT")
 	return nil
 }
@@ -80,6 +92,44 @@ func GetTableStats(ctx *server.Context) (interface{}, int) {
 	return stats, http.StatusOK
 }
 
+type JournalStats struct {
+	TableName         string    `json:"table_name"`
+	TupleCount        int64     `json:"tuples_count"`
+	JournalTuples     int64     `json:"journal_tuples_count"`
+	JournalThreshold  int64     `json:"journal_tuples_threshold"`
+	JournalSize       int64     `json:"journal_size"`
+	JournalDiskSize   int64     `json:"journal_disk_size"`
+	TombstoneTuples   int64     `json:"tomb_tuples_count"`
+	TombstoneDiskSize int64     `json:"tombstone_disk_size"`
+	LastFlushTime     time.Time `json:"last_flush_time"`
+}
+
+// GetJournalStats lists journal and tombstone state per table to help decide
+// when to flush or compact.
+func GetJournalStats(ctx *server.Context) (interface{}, int) {
+	stats := make([]JournalStats, 0)
+	for _, v := range ctx.Indexer.TableStats() {
+		if v.IndexName != "" {
+			continue
+		}
+		stats = append(stats, JournalStats{
+			TableName:         v.TableName,
+			TupleCount:        v.TupleCount,
+			JournalTuples:     v.JournalTuplesCount,
+			JournalThreshold:  v.JournalTuplesThreshold,
+			JournalSize:       v.JournalSize,
+			JournalDiskSize:   v.JournalDiskSize,
+			TombstoneTuples:   v.TombstoneTuplesCount,
+			TombstoneDiskSize: v.TombstoneDiskSize,
+			LastFlushTime:     v.LastFlushTime,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].TableName < stats[j].TableName
+	})
+	return stats, http.StatusOK
+}
+
 func GetCacheStats(ctx *server.Context) (interface{}, int) {
 	cs := ctx.Crawler.CacheStats()
 	for n, v := range ctx.Indexer.CacheStats() {
@@ -96,8 +146,96 @@ func GetSysStats(ctx *server.Context) (interface{}, int) {
 	return s, http.StatusOK
 }
 
-func GetConfig(ctx *server.Context) (interface{}, int) {
-	return config.All(), http.StatusOK
+type BigmapAnomalyRequest struct {
+	Limit int `schema:"limit"`
+}
+
+type BigmapAnomalyResponse struct {
+	Count     int64                 `json:"count"`
+	Anomalies []index.BigmapAnomaly `json:"anomalies"`
+}
+
+func GetBigmapAnomalies(ctx *server.Context) (interface{}, int) {
+	var args BigmapAnomalyRequest
+	ctx.ParseRequestArgs(&args)
+	list, n := ctx.Indexer.BigmapAnomalies(args.Limit)
+	if list == nil {
+		list = make([]index.BigmapAnomaly, 0)
+	}
+	return BigmapAnomalyResponse{
+		Count:     n,
+		Anomalies: list,
+	}, http.StatusOK
+}
+
+type BigmapSizeBucket struct {
+	Min   int64 `json:"min"`
+	Max   int64 `json:"max"`
+	Count int   `json:"count"`
+}
+
+type BigmapSize struct {
+	BigmapId int64          `json:"bigmap_id"`
+	Contract mavryk.Address `json:"contract"`
+	NKeys    int64          `json:"n_keys"`
+}
+
+type BigmapHistogram struct {
+	Count   int                `json:"count"`
+	Buckets []BigmapSizeBucket `json:"buckets"`
+	Top     []BigmapSize       `json:"top"`
+}
+
+// GetBigmapHistogram returns the distribution of live bigmaps by number
+// of keys and the largest bigmaps for storage capacity planning.
+func GetBigmapHistogram(ctx *server.Context) (interface{}, int) {
+	h, err := ctx.Indexer.BigmapHistogram(ctx.Context, 10)
+	if err != nil {
+		panic(server.EInternal(server.EC_DATABASE, "cannot read bigmap histogram", err))
+	}
+	resp := BigmapHistogram{
+		Count:   h.Count,
+		Buckets: make([]BigmapSizeBucket, 0, len(h.Buckets)),
+		Top:     make([]BigmapSize, 0, len(h.Top)),
+	}
+	for _, b := range h.Buckets {
+		resp.Buckets = append(resp.Buckets, BigmapSizeBucket(b))
+	}
+	for _, v := range h.Top {
+		resp.Top = append(resp.Top, BigmapSize{
+			BigmapId: v.BigmapId,
+			Contract: ctx.Indexer.LookupAddress(ctx, v.AccountId),
+			NKeys:    v.NKeys,
+		})
+	}
+	return resp, http.StatusOK
+}
+
+type BigmapRepairResponse struct {
+	BigmapId int64 `json:"bigmap_id"`
+	Repaired bool  `json:"repaired"`
+}
+
+// RepairBigmapCounts recomputes the live key count of a bigmap and fixes
+// its alloc when the count has drifted.
+func RepairBigmapCounts(ctx *server.Context) (interface{}, int) {
+	id, err := strconv.ParseInt(mux.Vars(ctx.Request)["id"], 10, 64)
+	if err != nil || id < 0 {
+		panic(server.EBadRequest(server.EC_RESOURCE_ID_MALFORMED, "invalid bigmap id", err))
+	}
+	ok, err := ctx.Indexer.RepairBigmapCounts(ctx.Context, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrNoBigmapAlloc):
+			panic(server.ENotFound(server.EC_RESOURCE_NOTFOUND, "no such bigmap", err))
+		default:
+			panic(server.EInternal(server.EC_DATABASE, "repair failed", err))
+		}
+	}
+	return BigmapRepairResponse{
+		BigmapId: id,
+		Repaired: ok,
+	}, http.StatusOK
 }
 
 func PurgeCaches(ctx *server.Context) (interface{}, int) {
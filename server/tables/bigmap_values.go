@@ -69,6 +69,8 @@ func (b *BigmapValueItem) MarshalJSONVerbose() ([]byte, error) {
 		Key      string    `json:"key"`
 		Value    string    `json:"value"`
 		Time     time.Time `json:"time"`
+		NatKey   uint64    `json:"nat_key"`
+		Size     int32     `json:"value_size"`
 	}{
 		RowId:    b.RowId,
 		BigmapId: b.BigmapId,
@@ -78,6 +80,8 @@ func (b *BigmapValueItem) MarshalJSONVerbose() ([]byte, error) {
 		Key:      hex.EncodeToString(b.Key),
 		Value:    hex.EncodeToString(b.Value),
 		Time:     b.ctx.Indexer.LookupBlockTime(b.ctx.Context, b.Height),
+		NatKey:   b.NatKey,
+		Size:     b.Size,
 	}
 	return json.Marshal(bigmap)
 }
@@ -103,6 +107,10 @@ func (b *BigmapValueItem) MarshalJSONBrief() ([]byte, error) {
 			buf = strconv.AppendQuote(buf, hex.EncodeToString(b.Value))
 		case "time":
 			buf = strconv.AppendInt(buf, b.ctx.Indexer.LookupBlockTimeMs(b.ctx.Context, b.Height), 10)
+		case "nat_key":
+			buf = strconv.AppendUint(buf, b.NatKey, 10)
+		case "value_size":
+			buf = strconv.AppendInt(buf, int64(b.Size), 10)
 		default:
 			continue
 		}
@@ -134,6 +142,10 @@ func (b *BigmapValueItem) MarshalCSV() ([]string, error) {
 			res[i] = strconv.Quote(hex.EncodeToString(b.Value))
 		case "time":
 			res[i] = strconv.FormatInt(b.ctx.Indexer.LookupBlockTimeMs(b.ctx.Context, b.Height), 10)
+		case "nat_key":
+			res[i] = strconv.FormatUint(b.NatKey, 10)
+		case "value_size":
+			res[i] = strconv.FormatInt(int64(b.Size), 10)
 		default:
 			continue
 		}
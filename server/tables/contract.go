@@ -10,6 +10,7 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -62,6 +63,25 @@ func (c *Contract) MarshalJSON() ([]byte, error) {
 	}
 }
 
+// joinScript restores the full script of a contract that shares its code
+// with another contract. Code segments are cached in codes.
+func (c *Contract) joinScript(table *pack.Table, codes map[model.ContractID][]byte) error {
+	if !c.IsSharedScript() || c.Script == nil {
+		return nil
+	}
+	code, ok := codes[c.ScriptRef]
+	if !ok {
+		var err error
+		code, err = model.LoadScriptCode(c.ctx, table, c.ScriptRef)
+		if err != nil {
+			return fmt.Errorf("contract %d: %w", c.RowId, err)
+		}
+		codes[c.ScriptRef] = code
+	}
+	c.JoinScript(code)
+	return nil
+}
+
 func (c *Contract) MarshalJSONVerbose() ([]byte, error) {
 	cc := struct {
 		RowId         uint64  `json:"row_id"`
@@ -77,6 +97,7 @@ func (c *Contract) MarshalJSONVerbose() ([]byte, error) {
 		StoragePaid   int64   `json:"storage_paid"`
 		StorageBurn   float64 `json:"storage_burn"`
 		Script        string  `json:"script"`
+		ScriptRef     uint64  `json:"script_ref"`
 		Storage       string  `json:"storage"`
 		InterfaceHash string  `json:"iface_hash"`
 		CodeHash      string  `json:"code_hash"`
@@ -98,6 +119,7 @@ func (c *Contract) MarshalJSONVerbose() ([]byte, error) {
 		StoragePaid:   c.StoragePaid,
 		StorageBurn:   c.params.ConvertValue(c.StorageBurn),
 		Script:        hex.EncodeToString(c.Script),
+		ScriptRef:     c.ScriptRef.U64(),
 		Storage:       hex.EncodeToString(c.Storage),
 		CallStats:     hex.EncodeToString(c.CallStats),
 		Features:      c.Features.String(),
@@ -145,6 +167,8 @@ func (c *Contract) MarshalJSONBrief() ([]byte, error) {
 			} else {
 				buf = append(buf, null...)
 			}
+		case "script_ref":
+			buf = strconv.AppendUint(buf, c.ScriptRef.U64(), 10)
 		case "storage":
 			// code is binary
 			if c.Storage != nil {
@@ -205,6 +229,8 @@ func (c *Contract) MarshalCSV() ([]string, error) {
 			res[i] = strconv.FormatInt(c.StoragePaid, 10)
 		case "script":
 			res[i] = strconv.Quote(hex.EncodeToString(c.Script))
+		case "script_ref":
+			res[i] = strconv.FormatUint(c.ScriptRef.U64(), 10)
 		case "storage":
 			res[i] = strconv.Quote(hex.EncodeToString(c.Storage))
 		case "iface_hash":
@@ -257,6 +283,10 @@ func StreamContractTable(ctx *server.Context, args *TableRequest) (interface{},
 			}
 			srcNames = append(srcNames, n)
 		}
+		// shared scripts are joined with their code, which needs script_ref
+		if slices.Contains(srcNames, "s") && !slices.Contains(srcNames, "r") {
+			srcNames = append(srcNames, "r")
+		}
 	} else {
 		// use all table columns in order and reverse lookup their long names
 		srcNames = table.Fields().Names()
@@ -502,6 +532,9 @@ func StreamContractTable(ctx *server.Context, args *TableRequest) (interface{},
 		ctx:     ctx,
 	}
 
+	// shared script code segments loaded for this request
+	codes := make(map[model.ContractID][]byte)
+
 	// prepare response stream
 	ctx.StreamResponseHeaders(http.StatusOK, mimetypes[args.Format])
 
@@ -533,6 +566,9 @@ func StreamContractTable(ctx *server.Context, args *TableRequest) (interface{},
 			if err := r.Decode(contract); err != nil {
 				return err
 			}
+			if err := contract.joinScript(table, codes); err != nil {
+				return err
+			}
 			if err := enc.Encode(contract); err != nil {
 				return err
 			}
@@ -560,6 +596,9 @@ func StreamContractTable(ctx *server.Context, args *TableRequest) (interface{},
 				if err := r.Decode(contract); err != nil {
 					return err
 				}
+				if err := contract.joinScript(table, codes); err != nil {
+					return err
+				}
 				if err := enc.EncodeRecord(contract); err != nil {
 					return err
 				}
@@ -87,6 +87,7 @@ func (f *Flow) MarshalJSONVerbose() ([]byte, error) {
 		IsShielded     bool    `json:"is_shielded"`
 		IsUnshielded   bool    `json:"is_unshielded"`
 		TokenAge       int64   `json:"token_age"`
+		Origin         string  `json:"origin"`
 	}{
 		RowId:          f.RowId,
 		Height:         f.Height,
@@ -110,6 +111,7 @@ func (f *Flow) MarshalJSONVerbose() ([]byte, error) {
 		IsShielded:     f.IsShielded,
 		IsUnshielded:   f.IsUnshielded,
 		TokenAge:       f.TokenAge,
+		Origin:         f.Origin.String(),
 	}
 	return json.Marshal(flow)
 }
@@ -188,6 +190,8 @@ func (f *Flow) MarshalJSONBrief() ([]byte, error) {
 			}
 		case "token_age":
 			buf = strconv.AppendInt(buf, f.TokenAge, 10)
+		case "origin":
+			buf = strconv.AppendQuote(buf, f.Origin.String())
 		default:
 			continue
 		}
@@ -248,6 +252,8 @@ func (f *Flow) MarshalCSV() ([]string, error) {
 			res[i] = strconv.FormatBool(f.IsUnshielded)
 		case "token_age":
 			res[i] = strconv.FormatInt(f.TokenAge, 10)
+		case "origin":
+			res[i] = strconv.Quote(f.Origin.String())
 		default:
 			continue
 		}
@@ -472,6 +478,21 @@ func StreamFlowTable(ctx *server.Context, args *TableRequest) (interface{}, int)
 						styps = append(styps, strconv.FormatUint(uint64(i), 10))
 					}
 					v = strings.Join(styps, ",")
+				case "origin":
+					// consider comma separated lists, convert origin to int and back to string list
+					typs := make([]uint8, 0)
+					for _, t := range strings.Split(v, ",") {
+						typ := model.ParseFlowOrigin(t)
+						if t == "" || !typ.IsValid() {
+							panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid origin '%s'", val[0]), nil))
+						}
+						typs = append(typs, uint8(typ))
+					}
+					styps := make([]string, 0)
+					for _, i := range vec.UniqueUint8Slice(typs) {
+						styps = append(styps, strconv.FormatUint(uint64(i), 10))
+					}
+					v = strings.Join(styps, ",")
 				}
 				if cond, err := pack.ParseCondition(key, v, table.Fields()); err != nil {
 					panic(server.EBadRequest(server.EC_PARAM_INVALID, fmt.Sprintf("invalid %s filter value '%s'", key, v), err))